@@ -1,8 +1,16 @@
 package apitest
 
 import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	b64 "encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"sync"
 
 	"github.com/CMSgov/dpc/api/model"
 	"github.com/bxcodec/faker/v3"
@@ -353,3 +361,39 @@ func ToBytes(a interface{}) []byte {
 	}
 	return b
 }
+
+var (
+	keyOnce      sync.Once
+	testKey      *rsa.PrivateKey
+	testKeyError error
+)
+
+// TestRSAKey returns a 4096 bit RSA key that is generated once and shared across tests
+func TestRSAKey() *rsa.PrivateKey {
+	keyOnce.Do(func() {
+		testKey, testKeyError = rsa.GenerateKey(rand.Reader, 4096)
+	})
+	if testKeyError != nil {
+		panic(testKeyError)
+	}
+	return testKey
+}
+
+// PublicKeyPEM PEM encodes the public half of the given key
+func PublicKeyPEM(pub crypto.PublicKey) string {
+	b, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		panic(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b}))
+}
+
+// SignSnippet signs the DPC key verification snippet with the given key and returns it base64 encoded
+func SignSnippet(key crypto.Signer) string {
+	hash := sha256.Sum256([]byte("This is the snippet used to verify a key pair in DPC."))
+	sig, err := key.Sign(rand.Reader, hash[:], crypto.SHA256)
+	if err != nil {
+		panic(err)
+	}
+	return b64.StdEncoding.EncodeToString(sig)
+}
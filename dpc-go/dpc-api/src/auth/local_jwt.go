@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/CMSgov/dpc/api/client"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// Authenticator issues access tokens for client_credentials token requests
+type Authenticator interface {
+	Authenticate(ctx context.Context, request []byte) ([]byte, error)
+}
+
+// LocalJWTConfig holds the options for a LocalJWTProvider
+type LocalJWTConfig struct {
+	// PublicKey verifies access token signatures, RS384 for RSA keys and ES384 for EC keys
+	PublicKey crypto.PublicKey
+	// Issuer is the required iss claim
+	Issuer string
+	// Authenticator issues the tokens, typically SSAS. Authenticate fails when nil.
+	Authenticator Authenticator
+}
+
+// LocalJWTProvider validates access tokens by checking their signature and claims locally instead of calling SSAS,
+// reading the organization from the dat claim and the scopes from the scp claim
+type LocalJWTProvider struct {
+	config LocalJWTConfig
+	method jwt.SigningMethod
+}
+
+// NewLocalJWTProvider creates a LocalJWTProvider for an RSA or EC public key
+func NewLocalJWTProvider(config LocalJWTConfig) (*LocalJWTProvider, error) {
+	p := &LocalJWTProvider{config: config}
+	switch config.PublicKey.(type) {
+	case *rsa.PublicKey:
+		p.method = jwt.SigningMethodRS384
+	case *ecdsa.PublicKey:
+		p.method = jwt.SigningMethodES384
+	default:
+		return nil, errors.Errorf("unsupported public key type %T for local JWT provider", config.PublicKey)
+	}
+	return p, nil
+}
+
+// Authenticate passes the token request to the configured Authenticator
+func (p *LocalJWTProvider) Authenticate(ctx context.Context, request []byte) ([]byte, error) {
+	if p.config.Authenticator == nil {
+		return nil, errors.New("local JWT provider has no authenticator to issue tokens")
+	}
+	return p.config.Authenticator.Authenticate(ctx, request)
+}
+
+// ValidateToken answers the introspection request from the token's own claims
+func (p *LocalJWTProvider) ValidateToken(ctx context.Context, request []byte) ([]byte, error) {
+	token, err := tokenFromIntrospectionRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := p.parse(token)
+	if err != nil {
+		return introspectionResponse(false, "", "", time.Time{})
+	}
+	return introspectionResponse(true, claims.ClientID, strings.Join(claims.Scopes, " "), time.Unix(claims.ExpiresAt, 0))
+}
+
+// GetTokenInfo verifies the token and returns the organization and scopes from its claims
+func (p *LocalJWTProvider) GetTokenInfo(ctx context.Context, token string) (client.TokenInfo, error) {
+	claims, err := p.parse(token)
+	if err != nil {
+		return client.TokenInfo{}, errors.Wrap(err, "Invalid access token")
+	}
+	var data map[string]string
+	if err := json.Unmarshal([]byte(claims.Data), &data); err != nil || data["organizationID"] == "" {
+		return client.TokenInfo{}, errors.New("Invalid access token: missing organizationID")
+	}
+	return client.TokenInfo{OrganizationID: data["organizationID"], Scope: strings.Join(claims.Scopes, " ")}, nil
+}
+
+func (p *LocalJWTProvider) parse(token string) (*CommonClaims, error) {
+	claims := &CommonClaims{}
+	parser := &jwt.Parser{ValidMethods: []string{p.method.Alg()}}
+	if _, err := parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return p.config.PublicKey, nil
+	}); err != nil {
+		return nil, err
+	}
+	if claims.ExpiresAt == 0 {
+		return nil, errors.New("token has no expiration")
+	}
+	if !claims.VerifyIssuer(p.config.Issuer, true) {
+		return nil, errors.Errorf("unexpected issuer %s", claims.Issuer)
+	}
+	return claims, nil
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"time"
+
+	"github.com/CMSgov/dpc/api/client"
+	"github.com/CMSgov/dpc/api/conf"
+	"github.com/pkg/errors"
+)
+
+// Supported values of the auth.provider config key
+const (
+	ProviderSSAS     = "ssas"
+	ProviderStatic   = "static"
+	ProviderLocalJWT = "local-jwt"
+)
+
+// Provider authenticates clients and validates the access tokens they present.
+// AuthCtx and the /Token routes go through the Provider selected by config, so the API can run against SSAS,
+// against locally verified JWTs, or with a single static token for development.
+type Provider interface {
+	// Authenticate exchanges a client_credentials token request body for a token response body
+	Authenticate(ctx context.Context, request []byte) ([]byte, error)
+	// ValidateToken answers a form encoded RFC 7662 introspection request
+	ValidateToken(ctx context.Context, request []byte) ([]byte, error)
+	// GetTokenInfo returns the organization and scopes of a valid access token, or an error
+	GetTokenInfo(ctx context.Context, token string) (client.TokenInfo, error)
+}
+
+// NewProvider creates the Provider named by the auth.provider config key, defaulting to SSAS
+func NewProvider(ssasClient client.SsasClient) (Provider, error) {
+	switch name := conf.GetAsString("auth.provider", ProviderSSAS); name {
+	case ProviderSSAS:
+		return NewSSASProvider(ssasClient), nil
+	case ProviderStatic:
+		return NewStaticProvider(StaticConfig{
+			Token:          conf.GetAsString("auth.static.token"),
+			OrganizationID: conf.GetAsString("auth.static.organization-id"),
+			ClientID:       conf.GetAsString("auth.static.client-id"),
+			Scope:          conf.GetAsString("auth.static.scope"),
+		})
+	case ProviderLocalJWT:
+		pem, err := ioutil.ReadFile(conf.GetAsString("auth.local-jwt.public-key-file"))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read auth.local-jwt.public-key-file")
+		}
+		pub, err := ParsePublicKey(string(pem))
+		if err != nil {
+			return nil, err
+		}
+		return NewLocalJWTProvider(LocalJWTConfig{
+			PublicKey:     pub,
+			Issuer:        conf.GetAsString("auth.local-jwt.issuer", "ssas"),
+			Authenticator: ssasClient,
+		})
+	default:
+		return nil, errors.Errorf("unknown auth provider %s", name)
+	}
+}
+
+// tokenFromIntrospectionRequest reads the token parameter of a form encoded introspection request
+func tokenFromIntrospectionRequest(request []byte) (string, error) {
+	form, err := url.ParseQuery(string(request))
+	if err != nil {
+		return "", errors.Wrap(err, "could not parse introspection request")
+	}
+	token := form.Get("token")
+	if token == "" {
+		return "", errors.New("token is required")
+	}
+	return token, nil
+}
+
+func introspectionResponse(active bool, clientID string, scope string, expiresAt time.Time) ([]byte, error) {
+	if !active {
+		return json.Marshal(map[string]interface{}{"active": false})
+	}
+	return json.Marshal(map[string]interface{}{
+		"active":     true,
+		"client_id":  clientID,
+		"scope":      scope,
+		"token_type": "bearer",
+		"exp":        expiresAt.Unix(),
+	})
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/CMSgov/dpc/api/apitest"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ProviderTestSuite struct {
+	suite.Suite
+}
+
+func TestProviderTestSuite(t *testing.T) {
+	suite.Run(t, new(ProviderTestSuite))
+}
+
+func introspectionRequest(token string) []byte {
+	return []byte(url.Values{"token": {token}}.Encode())
+}
+
+func (suite *ProviderTestSuite) TestStaticProviderOnlyLocalOrTest() {
+	config := StaticConfig{Token: "dev-token", OrganizationID: "org-1"}
+	for _, env := range []string{"", "dev", "prod"} {
+		suite.T().Setenv("ENV", env)
+		_, err := NewStaticProvider(config)
+		assert.Error(suite.T(), err, env)
+	}
+	for _, env := range []string{"local", "test"} {
+		suite.T().Setenv("ENV", env)
+		_, err := NewStaticProvider(config)
+		assert.NoError(suite.T(), err, env)
+	}
+}
+
+func (suite *ProviderTestSuite) TestStaticProvider() {
+	suite.T().Setenv("ENV", "test")
+	_, err := NewStaticProvider(StaticConfig{Token: "dev-token"})
+	assert.Error(suite.T(), err)
+
+	p, err := NewStaticProvider(StaticConfig{Token: "dev-token", OrganizationID: "org-1", Scope: "system/Group.read"})
+	assert.NoError(suite.T(), err)
+	ctx := context.Background()
+
+	b, err := p.Authenticate(ctx, []byte("grant_type=client_credentials"))
+	assert.NoError(suite.T(), err)
+	assert.Contains(suite.T(), string(b), `"access_token":"dev-token"`)
+
+	info, err := p.GetTokenInfo(ctx, "dev-token")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "org-1", info.OrganizationID)
+	assert.Equal(suite.T(), "system/Group.read", info.Scope)
+
+	_, err = p.GetTokenInfo(ctx, "other-token")
+	assert.Error(suite.T(), err)
+
+	b, err = p.ValidateToken(ctx, introspectionRequest("dev-token"))
+	assert.NoError(suite.T(), err)
+	assert.Contains(suite.T(), string(b), `"active":true`)
+	assert.Contains(suite.T(), string(b), `"client_id":"dpc-static-client"`)
+	b, _ = p.ValidateToken(ctx, introspectionRequest("other-token"))
+	assert.JSONEq(suite.T(), `{"active":false}`, string(b))
+
+	_, err = p.ValidateToken(ctx, []byte(""))
+	assert.Error(suite.T(), err)
+}
+
+func (suite *ProviderTestSuite) TestLocalJWTProvider() {
+	key := apitest.TestRSAKey()
+	p, err := NewLocalJWTProvider(LocalJWTConfig{PublicKey: key.Public(), Issuer: "ssas"})
+	assert.NoError(suite.T(), err)
+	ctx := context.Background()
+
+	token := suite.sign(jwt.SigningMethodRS384, key, "ssas", time.Minute)
+	info, err := p.GetTokenInfo(ctx, token)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "org-1", info.OrganizationID)
+	assert.Equal(suite.T(), "dpcv2-api system/Group.read", info.Scope)
+
+	b, err := p.ValidateToken(ctx, introspectionRequest(token))
+	assert.NoError(suite.T(), err)
+	assert.Contains(suite.T(), string(b), `"active":true`)
+	assert.Contains(suite.T(), string(b), `"client_id":"client-1"`)
+
+	_, err = p.GetTokenInfo(ctx, suite.sign(jwt.SigningMethodRS384, key, "ssas", -time.Minute))
+	assert.Error(suite.T(), err)
+	_, err = p.GetTokenInfo(ctx, suite.sign(jwt.SigningMethodRS384, key, "someone-else", time.Minute))
+	assert.Error(suite.T(), err)
+	_, err = p.GetTokenInfo(ctx, suite.sign(jwt.SigningMethodRS256, key, "ssas", time.Minute))
+	assert.Error(suite.T(), err)
+
+	_, err = p.Authenticate(ctx, []byte("grant_type=client_credentials"))
+	assert.Error(suite.T(), err)
+}
+
+func (suite *ProviderTestSuite) TestLocalJWTProviderEC() {
+	key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	p, err := NewLocalJWTProvider(LocalJWTConfig{PublicKey: key.Public(), Issuer: "ssas"})
+	assert.NoError(suite.T(), err)
+
+	info, err := p.GetTokenInfo(context.Background(), suite.sign(jwt.SigningMethodES384, key, "ssas", time.Minute))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "org-1", info.OrganizationID)
+}
+
+func (suite *ProviderTestSuite) TestLocalJWTProviderUnsupportedKey() {
+	_, err := NewLocalJWTProvider(LocalJWTConfig{PublicKey: "not a key"})
+	assert.Error(suite.T(), err)
+}
+
+func (suite *ProviderTestSuite) sign(method jwt.SigningMethod, key interface{}, issuer string, ttl time.Duration) string {
+	now := time.Now()
+	claims := CommonClaims{
+		ClientID: "client-1",
+		SystemID: "system-1",
+		Data:     `{"organizationID": "org-1"}`,
+		Scopes:   []string{"dpcv2-api", "system/Group.read"},
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    issuer,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(ttl).Unix(),
+		},
+	}
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	return token
+}
@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	b64 "encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// KeyVerificationSnippet is the text a client signs with its private key to prove ownership of a public key
+const KeyVerificationSnippet = "This is the snippet used to verify a key pair in DPC."
+
+// MinRSAKeyBits is the minimum size of an RSA public key accepted by DPC
+const MinRSAKeyBits = 4096
+
+// PublicKeyError is returned when an uploaded public key or its signature does not satisfy the key policy
+type PublicKeyError struct {
+	Message string
+}
+
+func (e *PublicKeyError) Error() string {
+	return e.Message
+}
+
+func keyError(format string, a ...interface{}) error {
+	return &PublicKeyError{Message: fmt.Sprintf(format, a...)}
+}
+
+// VerifyPublicKey parses the PEM encoded key (or certificate), checks it against the key policy
+// and verifies that the signature over KeyVerificationSnippet was produced by the matching private key
+func VerifyPublicKey(publicKeyPem string, signature string) (crypto.PublicKey, error) {
+	pub, err := ParsePublicKey(publicKeyPem)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateKeyPolicy(pub); err != nil {
+		return nil, err
+	}
+	if err := VerifySnippetSignature(pub, signature); err != nil {
+		return nil, err
+	}
+	return pub, nil
+}
+
+// ParsePublicKey parses a PEM encoded PUBLIC KEY or CERTIFICATE block, rejecting certificates outside their validity period
+func ParsePublicKey(publicKeyPem string) (crypto.PublicKey, error) {
+	pub, cert, err := decodePublicKey(publicKeyPem)
+	if err != nil {
+		return nil, err
+	}
+	if cert != nil {
+		now := time.Now()
+		if now.After(cert.NotAfter) {
+			return nil, keyError("Certificate expired on %s", cert.NotAfter.UTC().Format(time.RFC3339))
+		}
+		if now.Before(cert.NotBefore) {
+			return nil, keyError("Certificate is not valid until %s", cert.NotBefore.UTC().Format(time.RFC3339))
+		}
+	}
+	return pub, nil
+}
+
+func decodePublicKey(publicKeyPem string) (crypto.PublicKey, *x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(strings.TrimSpace(publicKeyPem)))
+	if block == nil {
+		return nil, nil, keyError("Public key could not be parsed: no PEM data found")
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, nil, keyError("Public key could not be parsed: %s", err)
+		}
+		return pub, nil, nil
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, nil, keyError("Certificate could not be parsed: %s", err)
+		}
+		return cert.PublicKey, cert, nil
+	default:
+		return nil, nil, keyError("Unsupported PEM block type `%s`, expected PUBLIC KEY or CERTIFICATE", block.Type)
+	}
+}
+
+// ValidateKeyPolicy checks that the key is either RSA of at least MinRSAKeyBits or EC on the P-384 curve
+func ValidateKeyPolicy(pub crypto.PublicKey) error {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < MinRSAKeyBits {
+			return keyError("RSA public key must be at least %d bits, got %d", MinRSAKeyBits, k.N.BitLen())
+		}
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P384() {
+			return keyError("EC public key must use curve P-384, got %s", k.Curve.Params().Name)
+		}
+	default:
+		return keyError("Unsupported key type %T, expected RSA or EC", pub)
+	}
+	return nil
+}
+
+// VerifySnippetSignature verifies a base64 encoded SHA-256 signature of KeyVerificationSnippet
+func VerifySnippetSignature(pub crypto.PublicKey, signature string) error {
+	sig, err := b64.StdEncoding.DecodeString(strings.NewReplacer("\n", "", "\r", "").Replace(signature))
+	if err != nil {
+		return keyError("Signature is not valid base64")
+	}
+
+	hash := sha256.Sum256([]byte(KeyVerificationSnippet))
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, hash[:], sig); err != nil {
+			return keyError("Signature does not match public key")
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, hash[:], sig) {
+			return keyError("Signature does not match public key")
+		}
+	default:
+		return keyError("Unsupported key type %T, expected RSA or EC", pub)
+	}
+	return nil
+}
+
+// SamePublicKey reports whether the PEM encoded key (or certificate) holds the given public key
+func SamePublicKey(pub crypto.PublicKey, publicKeyPem string) bool {
+	other, _, err := decodePublicKey(publicKeyPem)
+	if err != nil {
+		return false
+	}
+	k, ok := pub.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && k.Equal(other)
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Access is the access level granted by a scope
+type Access string
+
+const (
+	// Read allows reading and exporting a resource type
+	Read Access = "read"
+	// Write allows creating and updating a resource type
+	Write Access = "write"
+	// AllAccess allows both read and write
+	AllAccess Access = "*"
+	// AllResources matches every resource type in a scope
+	AllResources = "*"
+)
+
+var scopePattern = regexp.MustCompile(`^system/([A-Za-z]+|\*)\.(read|write|\*)$`)
+
+// Scope is a single SMART backend services scope, e.g. system/Group.read
+type Scope struct {
+	Resource string
+	Access   Access
+}
+
+func (s Scope) String() string {
+	return fmt.Sprintf("system/%s.%s", s.Resource, s.Access)
+}
+
+func (s Scope) allows(resource string, access Access) bool {
+	return (s.Resource == AllResources || s.Resource == resource) &&
+		(s.Access == AllAccess || s.Access == access)
+}
+
+// ParseScope parses a single system/<Resource>.<read|write|*> scope
+func ParseScope(scope string) (Scope, error) {
+	m := scopePattern.FindStringSubmatch(scope)
+	if m == nil {
+		return Scope{}, fmt.Errorf("invalid scope `%s`, expected system/<Resource>.<read|write|*>", scope)
+	}
+	return Scope{Resource: m[1], Access: Access(m[2])}, nil
+}
+
+// Scopes is the set of scopes granted to an access token
+type Scopes []Scope
+
+// FullAccess is granted to tokens that carry only the API scope and no resource scopes
+var FullAccess = Scopes{{Resource: AllResources, Access: AllAccess}}
+
+// ParseScopes parses a space separated scope string as returned by SSAS. Entries that are not resource scopes,
+// such as the API scope, are ignored. When no resource scopes are present the token has FullAccess.
+func ParseScopes(scope string) Scopes {
+	var scopes Scopes
+	for _, s := range strings.Fields(scope) {
+		if parsed, err := ParseScope(s); err == nil {
+			scopes = append(scopes, parsed)
+		}
+	}
+	if len(scopes) == 0 {
+		return FullAccess
+	}
+	return scopes
+}
+
+// Allows reports whether any scope grants the access on the resource type
+func (s Scopes) Allows(resource string, access Access) bool {
+	for _, scope := range s {
+		if scope.allows(resource, access) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAny reports whether any scope grants the access on at least one resource type
+func (s Scopes) AllowsAny(access Access) bool {
+	for _, scope := range s {
+		if scope.Access == AllAccess || scope.Access == access {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Scopes) String() string {
+	parts := make([]string, len(s))
+	for i, scope := range s {
+		parts[i] = scope.String()
+	}
+	return strings.Join(parts, " ")
+}
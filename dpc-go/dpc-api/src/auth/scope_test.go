@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseScope(t *testing.T) {
+	s, err := ParseScope("system/Group.read")
+	assert.NoError(t, err)
+	assert.Equal(t, Scope{Resource: "Group", Access: Read}, s)
+
+	s, err = ParseScope("system/*.*")
+	assert.NoError(t, err)
+	assert.Equal(t, Scope{Resource: AllResources, Access: AllAccess}, s)
+
+	_, err = ParseScope("user/Group.read")
+	assert.Error(t, err)
+	_, err = ParseScope("system/Group.delete")
+	assert.Error(t, err)
+}
+
+func TestParseScopesAPIScopeOnly(t *testing.T) {
+	assert.Equal(t, FullAccess, ParseScopes("dpcv2-api"))
+	assert.Equal(t, FullAccess, ParseScopes(""))
+}
+
+func TestScopesAllows(t *testing.T) {
+	scopes := ParseScopes("dpcv2-api system/Group.read system/Patient.*")
+	assert.Len(t, scopes, 2)
+	assert.True(t, scopes.Allows("Group", Read))
+	assert.False(t, scopes.Allows("Group", Write))
+	assert.True(t, scopes.Allows("Patient", Write))
+	assert.False(t, scopes.Allows("Coverage", Read))
+	assert.True(t, scopes.AllowsAny(Read))
+
+	all := ParseScopes("system/*.read")
+	assert.True(t, all.Allows("ExplanationOfBenefit", Read))
+	assert.False(t, all.Allows("Group", Write))
+
+	writeOnly := ParseScopes("system/Group.write")
+	assert.False(t, writeOnly.AllowsAny(Read))
+	assert.Equal(t, "system/Group.write", writeOnly.String())
+}
@@ -1,14 +1,13 @@
 package auth
 
 import (
-	"encoding/json"
-	"fmt"
-	"net/http"
+	"context"
 
+	"github.com/CMSgov/dpc/api/client"
 	"github.com/golang-jwt/jwt/v4"
-	"github.com/pkg/errors"
 )
 
+// CommonClaims are the claims of an access token signed by SSAS
 type CommonClaims struct {
 	ClientID string   `json:"cid,omitempty"`
 	SystemID string   `json:"sys,omitempty"`
@@ -19,48 +18,27 @@ type CommonClaims struct {
 	jwt.StandardClaims
 }
 
-type Credentials struct {
-	ClientID     string
-	ClientSecret string
-	ClientName   string
+// SSASProvider is an implementation of Provider that uses the SSAS API for every call
+type SSASProvider struct {
+	ssasClient client.SsasClient
 }
 
-// SSASPlugin is an implementation of Provider that uses the SSAS API.
-type SSASPlugin struct {
+// NewSSASProvider creates a provider backed by the given SSAS client
+func NewSSASProvider(ssasClient client.SsasClient) *SSASProvider {
+	return &SSASProvider{ssasClient}
 }
 
-// MakeAccessToken mints an access token for the given credentials.
-func (s SSASPlugin) MakeAccessToken(credentials Credentials) (string, error) {
-	publicURL := "http://localhost:3103"
-	url := fmt.Sprintf("%s/token", publicURL)
-
-	req, err := http.NewRequest("POST", url, nil)
-	if err != nil {
-		return "", err
-	}
-
-	req.SetBasicAuth(credentials.ClientID, credentials.ClientSecret)
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", errors.Wrap(err, "token request failed")
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("token request failed; %v", resp.StatusCode)
-	}
-
-	type TokenResponse struct {
-		AccessToken string `json:"access_token"`
-		TokenType   string `json:"token_type"`
-	}
-
-	var t = TokenResponse{}
-	if err = json.NewDecoder(resp.Body).Decode(&t); err != nil {
-		return "", errors.Wrap(err, "could not decode token response")
-	}
+// Authenticate proxies the token request to SSAS
+func (p *SSASProvider) Authenticate(ctx context.Context, request []byte) ([]byte, error) {
+	return p.ssasClient.Authenticate(ctx, request)
+}
 
-	ts := []byte(t.AccessToken)
+// ValidateToken proxies the introspection request to SSAS
+func (p *SSASProvider) ValidateToken(ctx context.Context, request []byte) ([]byte, error) {
+	return p.ssasClient.ValidateToken(ctx, request)
+}
 
-	return string(ts), nil
+// GetTokenInfo asks SSAS for the organization and scopes of the access token
+func (p *SSASProvider) GetTokenInfo(ctx context.Context, token string) (client.TokenInfo, error) {
+	return p.ssasClient.GetTokenInfo(ctx, token)
 }
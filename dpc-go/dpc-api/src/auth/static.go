@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"time"
+
+	"github.com/CMSgov/dpc/api/client"
+	"github.com/CMSgov/dpc/api/conf"
+	"github.com/pkg/errors"
+)
+
+// staticTokenTTL is the expires_in reported for the static token; the token itself never expires
+const staticTokenTTL = 24 * time.Hour
+
+// staticClientID is the client_id reported for the static token when none is configured
+const staticClientID = "dpc-static-client"
+
+// StaticConfig holds the options for a StaticProvider
+type StaticConfig struct {
+	// Token is handed out by Authenticate and is the only access token accepted
+	Token          string
+	OrganizationID string
+	// ClientID is the client_id reported by introspection, defaulting to staticClientID
+	ClientID string
+	// Scope is the space separated scope granted to the token. Empty grants full access.
+	Scope string
+}
+
+// StaticProvider is a development Provider that issues a single configured token for every token request
+// and maps it to a fixed organization. It must not be used in a deployed environment.
+type StaticProvider struct {
+	config StaticConfig
+}
+
+// NewStaticProvider creates a StaticProvider, requiring both a token and an organization ID. It fails unless ENV is
+// local or test.
+func NewStaticProvider(config StaticConfig) (*StaticProvider, error) {
+	if !conf.IsLocal() && !conf.IsTest() {
+		return nil, errors.New("static auth provider is only allowed when ENV is local or test")
+	}
+	if config.Token == "" || config.OrganizationID == "" {
+		return nil, errors.New("static auth provider requires auth.static.token and auth.static.organization-id")
+	}
+	if config.ClientID == "" {
+		config.ClientID = staticClientID
+	}
+	return &StaticProvider{config}, nil
+}
+
+// Authenticate returns the static token without checking the request
+func (p *StaticProvider) Authenticate(ctx context.Context, request []byte) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"access_token": p.config.Token,
+		"token_type":   "bearer",
+		"expires_in":   int(staticTokenTTL.Seconds()),
+		"scope":        p.config.Scope,
+	})
+}
+
+// ValidateToken reports the token as active when it is the static token
+func (p *StaticProvider) ValidateToken(ctx context.Context, request []byte) ([]byte, error) {
+	token, err := tokenFromIntrospectionRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	return introspectionResponse(p.matches(token), p.config.ClientID, p.config.Scope, time.Now().Add(staticTokenTTL))
+}
+
+// GetTokenInfo returns the configured organization and scope for the static token
+func (p *StaticProvider) GetTokenInfo(ctx context.Context, token string) (client.TokenInfo, error) {
+	if !p.matches(token) {
+		return client.TokenInfo{}, errors.New("Invalid access token")
+	}
+	return client.TokenInfo{OrganizationID: p.config.OrganizationID, Scope: p.config.Scope}, nil
+}
+
+func (p *StaticProvider) matches(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(p.config.Token)) == 1
+}
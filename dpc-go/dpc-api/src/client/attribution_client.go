@@ -59,6 +59,7 @@ type ProviderOrg struct {
 // Client interface for testing purposes
 type Client interface {
 	Get(ctx context.Context, resourceType ResourceType, id string) ([]byte, error)
+	List(ctx context.Context, resourceType ResourceType) ([]byte, error)
 	Post(ctx context.Context, resourceType ResourceType, body []byte) ([]byte, error)
 	Delete(ctx context.Context, resourceType ResourceType, id string) error
 	Put(ctx context.Context, resourceType ResourceType, id string, body []byte) ([]byte, error)
@@ -66,6 +67,35 @@ type Client interface {
 	GetProviderOrgs(ctx context.Context, implID string) ([]ProviderOrg, error)
 	CreateImplOrg(ctx context.Context, body []byte) (ImplementerOrg, error)
 	GetImplOrg(ctx context.Context) ([]byte, error)
+	GetPriorityTier(ctx context.Context, orgID string) ([]byte, error)
+	UpdatePriorityTier(ctx context.Context, orgID string, body []byte) ([]byte, error)
+	GetRetention(ctx context.Context, orgID string) ([]byte, error)
+	UpdateRetention(ctx context.Context, orgID string, body []byte) ([]byte, error)
+	DeleteRetention(ctx context.Context, orgID string) error
+	GetWebhook(ctx context.Context) ([]byte, error)
+	UpdateWebhook(ctx context.Context, body []byte) ([]byte, error)
+	DeleteWebhook(ctx context.Context) error
+	GetWebhookDeliveries(ctx context.Context) ([]byte, error)
+	GetExportSchedules(ctx context.Context) ([]byte, error)
+	GetExportSchedule(ctx context.Context, id string) ([]byte, error)
+	CreateExportSchedule(ctx context.Context, body []byte) ([]byte, error)
+	UpdateExportSchedule(ctx context.Context, id string, body []byte) ([]byte, error)
+	DeleteExportSchedule(ctx context.Context, id string) error
+}
+
+// ErrWebhookNotFound is returned when the organization has no registered webhook
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// ErrExportScheduleNotFound is returned when the export schedule does not exist for the organization
+var ErrExportScheduleNotFound = errors.New("export schedule not found")
+
+// RejectedError is returned when attribution rejects a request as invalid, with the reason it gave
+type RejectedError struct {
+	Message string
+}
+
+func (e *RejectedError) Error() string {
+	return e.Message
 }
 
 // AttributionClient is a struct to hold the retryablehttp client and configs
@@ -239,6 +269,12 @@ func (ac *AttributionClient) Get(ctx context.Context, resourceType ResourceType,
 	return ac.doGet(ctx, url)
 }
 
+// List A function to enable communication with attribution service via GET for all of an organization's resources
+func (ac *AttributionClient) List(ctx context.Context, resourceType ResourceType) ([]byte, error) {
+	url := fmt.Sprintf("%s/%s", ac.config.URL, resourceType)
+	return ac.doGet(ctx, url)
+}
+
 func (ac *AttributionClient) doGet(ctx context.Context, url string) ([]byte, error) {
 	log := logger.WithContext(ctx)
 	ac.httpClient.Logger = newLogger(*log)
@@ -406,6 +442,132 @@ func (ac *AttributionClient) GetProviderOrgs(ctx context.Context, implID string)
 	return resp, nil
 }
 
+// GetPriorityTier function to retrieve the priority tier and concurrency cap of an organization's exports
+func (ac *AttributionClient) GetPriorityTier(ctx context.Context, orgID string) ([]byte, error) {
+	url := fmt.Sprintf("%s/%s/%s/priority", ac.config.URL, Organization, orgID)
+	return ac.doGet(ctx, url)
+}
+
+// UpdatePriorityTier function to set the priority tier and concurrency cap of an organization's exports
+func (ac *AttributionClient) UpdatePriorityTier(ctx context.Context, orgID string, body []byte) ([]byte, error) {
+	url := fmt.Sprintf("%s/%s/%s/priority", ac.config.URL, Organization, orgID)
+	return ac.doPut(ctx, url, body)
+}
+
+// GetRetention function to retrieve how many hours the export files of an organization are kept
+func (ac *AttributionClient) GetRetention(ctx context.Context, orgID string) ([]byte, error) {
+	url := fmt.Sprintf("%s/%s/%s/retention", ac.config.URL, Organization, orgID)
+	return ac.doGet(ctx, url)
+}
+
+// UpdateRetention function to override how many hours the export files of an organization are kept
+func (ac *AttributionClient) UpdateRetention(ctx context.Context, orgID string, body []byte) ([]byte, error) {
+	url := fmt.Sprintf("%s/%s/%s/retention", ac.config.URL, Organization, orgID)
+	return ac.doPut(ctx, url, body)
+}
+
+// DeleteRetention function to reset an organization to the default retention of export files
+func (ac *AttributionClient) DeleteRetention(ctx context.Context, orgID string) error {
+	path := fmt.Sprintf("%s/%s/retention", Organization, orgID)
+	_, err := ac.doOrgResource(ctx, http.MethodDelete, path, nil, errors.Errorf("Failed to delete resource %s", path))
+	return err
+}
+
+// GetWebhook function to retrieve the webhook the organization registered to be notified of finished jobs
+func (ac *AttributionClient) GetWebhook(ctx context.Context) ([]byte, error) {
+	return ac.doOrgResource(ctx, http.MethodGet, "Webhook", nil, ErrWebhookNotFound)
+}
+
+// UpdateWebhook function to register the webhook of the organization, the response holds its new signing secret
+func (ac *AttributionClient) UpdateWebhook(ctx context.Context, body []byte) ([]byte, error) {
+	return ac.doOrgResource(ctx, http.MethodPut, "Webhook", body, ErrWebhookNotFound)
+}
+
+// DeleteWebhook function to remove the webhook of the organization
+func (ac *AttributionClient) DeleteWebhook(ctx context.Context) error {
+	_, err := ac.doOrgResource(ctx, http.MethodDelete, "Webhook", nil, ErrWebhookNotFound)
+	return err
+}
+
+// GetWebhookDeliveries function to retrieve the latest webhook deliveries of the organization
+func (ac *AttributionClient) GetWebhookDeliveries(ctx context.Context) ([]byte, error) {
+	return ac.doOrgResource(ctx, http.MethodGet, "Webhook/deliveries", nil, ErrWebhookNotFound)
+}
+
+// GetExportSchedules function to retrieve the export schedules of the organization
+func (ac *AttributionClient) GetExportSchedules(ctx context.Context) ([]byte, error) {
+	return ac.doOrgResource(ctx, http.MethodGet, "ExportSchedule", nil, ErrExportScheduleNotFound)
+}
+
+// GetExportSchedule function to retrieve an export schedule of the organization
+func (ac *AttributionClient) GetExportSchedule(ctx context.Context, id string) ([]byte, error) {
+	return ac.doOrgResource(ctx, http.MethodGet, fmt.Sprintf("ExportSchedule/%s", id), nil, ErrExportScheduleNotFound)
+}
+
+// CreateExportSchedule function to schedule recurring exports of a group of the organization
+func (ac *AttributionClient) CreateExportSchedule(ctx context.Context, body []byte) ([]byte, error) {
+	return ac.doOrgResource(ctx, http.MethodPost, "ExportSchedule", body, ErrExportScheduleNotFound)
+}
+
+// UpdateExportSchedule function to replace the settings of an export schedule of the organization
+func (ac *AttributionClient) UpdateExportSchedule(ctx context.Context, id string, body []byte) ([]byte, error) {
+	return ac.doOrgResource(ctx, http.MethodPut, fmt.Sprintf("ExportSchedule/%s", id), body, ErrExportScheduleNotFound)
+}
+
+// DeleteExportSchedule function to remove an export schedule of the organization
+func (ac *AttributionClient) DeleteExportSchedule(ctx context.Context, id string) error {
+	_, err := ac.doOrgResource(ctx, http.MethodDelete, fmt.Sprintf("ExportSchedule/%s", id), nil, ErrExportScheduleNotFound)
+	return err
+}
+
+// doOrgResource sends a request for a resource of the organization in the context, returning notFound on a 404 and
+// a RejectedError when attribution rejects the request as invalid
+func (ac *AttributionClient) doOrgResource(ctx context.Context, method string, path string, body []byte, notFound error) ([]byte, error) {
+	log := logger.WithContext(ctx)
+	ac.httpClient.Logger = newLogger(*log)
+
+	url := fmt.Sprintf("%s/%s", ac.config.URL, path)
+	req, err := retryablehttp.NewRequest(method, url, body)
+	if err != nil {
+		log.Error("Failed to create request", zap.Error(err))
+		return nil, errors.Errorf("Failed to %s resource %s", method, path)
+	}
+
+	req.Header.Add(middleware.RequestIDHeader, ctx.Value(middleware.RequestIDKey).(string))
+	if ctx.Value(constants.ContextKeyOrganization) != nil {
+		req.Header.Add(constants.OrgHeader, ctx.Value(constants.ContextKeyOrganization).(string))
+	}
+	resp, err := ac.httpClient.Do(req)
+	if err != nil {
+		log.Error("Failed to send request", zap.Error(err))
+		return nil, errors.Errorf("Failed to %s resource %s", method, path)
+	}
+
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			log.Error("Failed to close response body", zap.Error(err))
+		}
+	}()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, notFound
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Error("Failed to read the response body", zap.Error(err))
+		return nil, errors.Errorf("Failed to %s resource %s", method, path)
+	}
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnprocessableEntity {
+		return nil, &RejectedError{checkForErrorMsg(b)}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, errors.Errorf("Failed to %s resource %s", method, path)
+	}
+	return b, nil
+}
+
 func (ac *AttributionClient) doPut(ctx context.Context, url string, body []byte) ([]byte, error) {
 	log := logger.WithContext(ctx)
 	ac.httpClient.Logger = newLogger(*log)
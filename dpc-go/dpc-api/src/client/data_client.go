@@ -24,6 +24,9 @@ type DataClient interface {
 	Data(ctx context.Context, path string) ([]byte, error)
 }
 
+// ErrFilePurged is returned when the file expired and was deleted by the retention sweeper
+var ErrFilePurged = errors.New("file purged")
+
 // DataClientImpl is a struct to hold the retryablehttp client and configs
 type DataClientImpl struct {
 	config     DataConfig
@@ -62,10 +65,6 @@ func (ac *DataClientImpl) Data(ctx context.Context, path string) ([]byte, error)
 		return nil, errors.Errorf("Failed to get data info %s", path)
 	}
 
-	if resp.StatusCode != 200 {
-		return nil, errors.Errorf("Failed to get data info %s", path)
-	}
-
 	defer func() {
 		err := resp.Body.Close()
 		if err != nil {
@@ -73,6 +72,13 @@ func (ac *DataClientImpl) Data(ctx context.Context, path string) ([]byte, error)
 		}
 	}()
 
+	if resp.StatusCode == http.StatusGone {
+		return nil, ErrFilePurged
+	}
+	if resp.StatusCode != 200 {
+		return nil, errors.Errorf("Failed to get data info %s", path)
+	}
+
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		log.Error("Failed to read the response body", zap.Error(err))
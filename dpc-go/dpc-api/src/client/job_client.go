@@ -12,6 +12,9 @@ import (
 	"go.uber.org/zap"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/hashicorp/go-retryablehttp"
 )
@@ -25,9 +28,21 @@ type JobConfig struct {
 // JobClient interface for testing purposes
 type JobClient interface {
 	Status(ctx context.Context, jobID string) ([]byte, error)
-	Export(ctx context.Context, request model.ExportRequest) ([]byte, error)
+	WaitForStatus(ctx context.Context, jobID string, wait time.Duration) ([]byte, error)
+	Export(ctx context.Context, request model.ExportRequest) ([]byte, bool, error)
+	Cancel(ctx context.Context, jobID string) error
+	List(ctx context.Context, query url.Values) ([]byte, error)
 }
 
+// ErrJobNotFound is returned when the job does not exist for the organization or was already cancelled
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrIdempotencyKeyReused is returned when a kickoff gives an Idempotency-Key already used for a different export
+var ErrIdempotencyKeyReused = errors.New("idempotency key was used for a different request")
+
+// ErrNoExistingJob is returned for an ExistingOnly export that is not a repeat of an earlier kickoff
+var ErrNoExistingJob = errors.New("no existing job for the export request")
+
 // JobClientImpl is a struct to hold the retryablehttp client and configs
 type JobClientImpl struct {
 	config     JobConfig
@@ -47,11 +62,24 @@ func NewJobClient(config JobConfig) JobClient {
 
 // Status function to get status from job service
 func (jc *JobClientImpl) Status(ctx context.Context, jobID string) ([]byte, error) {
+	return jc.status(ctx, jobID, nil)
+}
+
+// WaitForStatus function to get status from job service once the job has finished, or once the wait is over. The
+// job service holds the request instead of it being polled.
+func (jc *JobClientImpl) WaitForStatus(ctx context.Context, jobID string, wait time.Duration) ([]byte, error) {
+	return jc.status(ctx, jobID, url.Values{"wait": {strconv.Itoa(int(wait.Seconds()))}})
+}
+
+func (jc *JobClientImpl) status(ctx context.Context, jobID string, query url.Values) ([]byte, error) {
 	log := logger.WithContext(ctx)
 	jc.httpClient.Logger = newLogger(*log)
 
-	url := fmt.Sprintf("%s/%s/%s", jc.config.URL, "Job", jobID)
-	req, err := retryablehttp.NewRequest(http.MethodGet, url, nil)
+	u := fmt.Sprintf("%s/%s/%s", jc.config.URL, "Job", jobID)
+	if len(query) > 0 {
+		u = fmt.Sprintf("%s?%s", u, query.Encode())
+	}
+	req, err := retryablehttp.NewRequest(http.MethodGet, u, nil)
 	if err != nil {
 		log.Error("Failed to create request", zap.Error(err))
 		return nil, errors.Errorf("Failed to retrieve status for job %s", jobID)
@@ -67,10 +95,88 @@ func (jc *JobClientImpl) Status(ctx context.Context, jobID string) ([]byte, erro
 		return nil, errors.Errorf("Failed to retrieve status for job %s", jobID)
 	}
 
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			log.Error("Failed to close response body", zap.Error(err))
+		}
+	}()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrJobNotFound
+	}
 	if resp.StatusCode < 200 || resp.StatusCode > 299 {
 		return nil, errors.Errorf("Failed to retrieve status for job %s", jobID)
 	}
 
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Error("Failed to read the response body", zap.Error(err))
+		return nil, errors.Errorf("Failed to retrieve status for job %s", jobID)
+	}
+	return body, nil
+}
+
+// Cancel function to cancel a job and delete its files through the job service
+func (jc *JobClientImpl) Cancel(ctx context.Context, jobID string) error {
+	log := logger.WithContext(ctx)
+	jc.httpClient.Logger = newLogger(*log)
+
+	url := fmt.Sprintf("%s/%s/%s", jc.config.URL, "Job", jobID)
+	req, err := retryablehttp.NewRequest(http.MethodDelete, url, nil)
+	if err != nil {
+		log.Error("Failed to create request", zap.Error(err))
+		return errors.Errorf("Failed to cancel job %s", jobID)
+	}
+
+	req.Header.Add(middleware.RequestIDHeader, ctx.Value(middleware.RequestIDKey).(string))
+	if ctx.Value(constants.ContextKeyOrganization) != nil {
+		req.Header.Add(constants.OrgHeader, ctx.Value(constants.ContextKeyOrganization).(string))
+	}
+	resp, err := jc.httpClient.Do(req)
+	if err != nil {
+		log.Error("Failed to send request", zap.Error(err))
+		return errors.Errorf("Failed to cancel job %s", jobID)
+	}
+
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			log.Error("Failed to close response body", zap.Error(err))
+		}
+	}()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrJobNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("Failed to cancel job %s", jobID)
+	}
+	return nil
+}
+
+// List function to get a page of the organization's jobs from job service
+func (jc *JobClientImpl) List(ctx context.Context, query url.Values) ([]byte, error) {
+	log := logger.WithContext(ctx)
+	jc.httpClient.Logger = newLogger(*log)
+
+	u := fmt.Sprintf("%s/Job?%s", jc.config.URL, query.Encode())
+	req, err := retryablehttp.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		log.Error("Failed to create request", zap.Error(err))
+		return nil, errors.New("Failed to list jobs")
+	}
+
+	req.Header.Add(middleware.RequestIDHeader, ctx.Value(middleware.RequestIDKey).(string))
+	if ctx.Value(constants.ContextKeyOrganization) != nil {
+		req.Header.Add(constants.OrgHeader, ctx.Value(constants.ContextKeyOrganization).(string))
+	}
+	resp, err := jc.httpClient.Do(req)
+	if err != nil {
+		log.Error("Failed to send request", zap.Error(err))
+		return nil, errors.New("Failed to list jobs")
+	}
+
 	defer func() {
 		err := resp.Body.Close()
 		if err != nil {
@@ -81,27 +187,30 @@ func (jc *JobClientImpl) Status(ctx context.Context, jobID string) ([]byte, erro
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		log.Error("Failed to read the response body", zap.Error(err))
-		return nil, errors.Errorf("Failed to retrieve status for job %s", jobID)
+		return nil, errors.New("Failed to list jobs")
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, errors.Errorf("Failed to list jobs: %s", checkForErrorMsg(body))
 	}
 	return body, nil
 }
 
-// Export function to export data for patients
-func (jc *JobClientImpl) Export(ctx context.Context, request model.ExportRequest) ([]byte, error) {
+// Export function to start an export job, returning its id and whether it was started by an earlier kickoff
+func (jc *JobClientImpl) Export(ctx context.Context, request model.ExportRequest) ([]byte, bool, error) {
 	log := logger.WithContext(ctx)
 	jc.httpClient.Logger = newLogger(*log)
 
 	requestBytes, err := json.Marshal(request)
 	if err != nil {
 		log.Error("Failed to convert request into bytes", zap.Error(err))
-		return nil, errors.Wrap(err, "Failed to export")
+		return nil, false, errors.Wrap(err, "Failed to export")
 	}
 
 	url := fmt.Sprintf("%s/Job", jc.config.URL)
 	req, err := retryablehttp.NewRequest(http.MethodPost, url, requestBytes)
 	if err != nil {
 		log.Error("Failed to create request", zap.Error(err))
-		return nil, errors.Wrap(err, "Failed to export")
+		return nil, false, errors.Wrap(err, "Failed to export")
 	}
 
 	req.Header.Add(middleware.RequestIDHeader, ctx.Value(middleware.RequestIDKey).(string))
@@ -111,7 +220,7 @@ func (jc *JobClientImpl) Export(ctx context.Context, request model.ExportRequest
 	resp, err := jc.httpClient.Do(req)
 	if err != nil {
 		log.Error("Failed to send request", zap.Error(err))
-		return nil, errors.Wrap(err, "Failed to export")
+		return nil, false, errors.Wrap(err, "Failed to export")
 	}
 
 	defer func() {
@@ -124,18 +233,24 @@ func (jc *JobClientImpl) Export(ctx context.Context, request model.ExportRequest
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		log.Error("Failed to read the response body", zap.Error(err))
-		return nil, errors.Wrap(err, "Failed to export")
+		return nil, false, errors.Wrap(err, "Failed to export")
 	}
 
+	if resp.StatusCode == http.StatusConflict {
+		return nil, false, ErrIdempotencyKeyReused
+	}
+	if request.ExistingOnly && resp.StatusCode == http.StatusNotFound {
+		return nil, false, ErrNoExistingJob
+	}
 	errMsg := checkForErrorMsg(body)
 	if errMsg != "" {
-		return nil, errors.Errorf(errMsg)
+		return nil, false, errors.Errorf(errMsg)
 	}
 	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return nil, errors.Errorf("Failed to export")
+		return nil, false, errors.Errorf("Failed to export")
 	}
 
-	return body, nil
+	return body, resp.Header.Get(constants.DuplicateJobHeader) == "true", nil
 }
 
 func checkForErrorMsg(body []byte) string {
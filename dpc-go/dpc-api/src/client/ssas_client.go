@@ -54,7 +54,7 @@ type SsasClient interface {
 	DeleteToken(ctx context.Context, systemID string, tokenID string) error
 	AddPublicKey(ctx context.Context, systemID string, request model.ProxyPublicKeyRequest) (map[string]string, error)
 	DeletePublicKey(ctx context.Context, systemID string, keyID string) error
-	GetOrgIDFromToken(ctx context.Context, token string) (string, error)
+	GetTokenInfo(ctx context.Context, token string) (TokenInfo, error)
 	ValidateToken(ctx context.Context, reqBytes []byte) ([]byte, error)
 }
 
@@ -267,8 +267,8 @@ func (sc *SsasHTTPClient) CreateGroup(ctx context.Context, request CreateGroupRe
 	return resp, nil
 }
 
-// GetOrgIDFromToken validates with access token with SSAS and returns the org ID
-func (sc *SsasHTTPClient) GetOrgIDFromToken(ctx context.Context, token string) (string, error) {
+// GetTokenInfo validates the access token with SSAS and returns the org ID and scopes it was granted
+func (sc *SsasHTTPClient) GetTokenInfo(ctx context.Context, token string) (TokenInfo, error) {
 	log := logger.WithContext(ctx)
 	url := fmt.Sprintf("%s/%s", sc.config.PublicURL, TokenInfoEndpoint)
 
@@ -279,13 +279,13 @@ func (sc *SsasHTTPClient) GetOrgIDFromToken(ctx context.Context, token string) (
 	reqBytes, err := json.Marshal(body)
 	if err != nil {
 		log.Error("Token authentication failed", zap.Error(err))
-		return "", errors.Errorf("Failed to authenticate token: %s", err)
+		return TokenInfo{}, errors.Errorf("Failed to authenticate token: %s", err)
 	}
 
 	resBytes, err := sc.doPost(ctx, url, reqBytes, nil)
 	if err != nil {
 		log.Error("Token authentication failed", zap.Error(err))
-		return "", errors.Errorf("Failed to authenticate token: %s", err)
+		return TokenInfo{}, errors.Errorf("Failed to authenticate token: %s", err)
 	}
 
 	response := make(map[string]interface{})
@@ -293,31 +293,32 @@ func (sc *SsasHTTPClient) GetOrgIDFromToken(ctx context.Context, token string) (
 	err = json.Unmarshal(resBytes, &response)
 	if err != nil {
 		log.Error("Unable to parse response", zap.Error(err))
-		return "", errors.Errorf("Failed to authenticate token: %s", err)
+		return TokenInfo{}, errors.Errorf("Failed to authenticate token: %s", err)
 	}
 
-	valid := response["valid"].(bool)
+	valid, _ := response["valid"].(bool)
 	if !valid {
 		log.Error("Invalid access token")
-		return "", errors.Errorf("Invalid access token")
+		return TokenInfo{}, errors.Errorf("Invalid access token")
 	}
 
-	orgID := response["system_data"].(string)
+	orgID, _ := response["system_data"].(string)
 
 	o := make(map[string]string)
 
 	err = json.Unmarshal([]byte(orgID), &o)
 	if err != nil {
 		log.Error("No organization ID provided", zap.Error(err))
-		return "", errors.Errorf("Invalid access token")
+		return TokenInfo{}, errors.Errorf("Invalid access token")
 	}
 
 	if o["organizationID"] == "" {
 		log.Error("No organization ID provided")
-		return "", errors.Errorf("Invalid access token")
+		return TokenInfo{}, errors.Errorf("Invalid access token")
 	}
 
-	return o["organizationID"], nil
+	scope, _ := response["scope"].(string)
+	return TokenInfo{OrganizationID: o["organizationID"], Scope: scope}, nil
 }
 
 // ValidateToken proxies a request to SSAS to determine if a token is valid
@@ -524,6 +525,12 @@ func (sc *SsasHTTPClient) doGet(ctx context.Context, url string) ([]byte, error)
 	return b, nil
 }
 
+// TokenInfo struct to model what SSAS reports about a valid access token
+type TokenInfo struct {
+	OrganizationID string
+	Scope          string
+}
+
 // CreateGroupRequest struct to model a ssas request to create a group
 type CreateGroupRequest struct {
 	Name    string `json:"name"`
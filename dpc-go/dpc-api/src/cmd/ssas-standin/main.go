@@ -0,0 +1,58 @@
+// Command ssas-standin runs the in-memory SSAS stand-in from package ssastest, so dpc-api can be run locally
+// without the SSAS stack. The public and admin ports default to the ssas-client URLs in configs/base.yml.
+package main
+
+import (
+	"crypto/rsa"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/CMSgov/dpc/api/ssastest"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func main() {
+	publicPort := flag.Int("public-port", 3103, "port for the public SSAS routes")
+	adminPort := flag.Int("admin-port", 3104, "port for the admin SSAS routes")
+	clientID := flag.String("client-id", "", "admin client ID; admin routes are unauthenticated when empty")
+	clientSecret := flag.String("client-secret", "", "admin client secret")
+	keyFile := flag.String("signing-key", "", "PEM encoded RSA private key used to sign access tokens; generated when empty")
+	flag.Parse()
+
+	var key *rsa.PrivateKey
+	if *keyFile != "" {
+		b, err := ioutil.ReadFile(*keyFile)
+		if err != nil {
+			log.Fatalf("Failed to read signing key: %s", err)
+		}
+		key, err = jwt.ParseRSAPrivateKeyFromPEM(b)
+		if err != nil {
+			log.Fatalf("Failed to parse signing key: %s", err)
+		}
+	}
+
+	s, err := ssastest.NewServer(ssastest.Config{
+		ClientID:     *clientID,
+		ClientSecret: *clientSecret,
+		SigningKey:   key,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create SSAS stand-in: %s", err)
+	}
+
+	h := s.Handler()
+	wg := new(sync.WaitGroup)
+	for _, port := range []int{*publicPort, *adminPort} {
+		wg.Add(1)
+		go func(port int) {
+			defer wg.Done()
+			fmt.Printf("Starting UNSECURE SSAS stand-in on port %d\n", port)
+			log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), h))
+		}(port)
+	}
+	wg.Wait()
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
 )
 
 var config viper.Viper
@@ -50,6 +51,21 @@ func NewConfig(dir ...string) {
 	}
 }
 
+// IsLocal reports whether the service runs in the local environment, set by ENV=local
+func IsLocal() bool {
+	return os.Getenv("ENV") == "local"
+}
+
+// IsTest reports whether the service runs under test, set by ENV=test
+func IsTest() bool {
+	return os.Getenv("ENV") == "test"
+}
+
+// ServerWriteTimeout returns how long the API servers allow for a request before the connection's write deadline
+func ServerWriteTimeout() time.Duration {
+	return time.Duration(GetAsInt("SERVER_WRITE_TIMEOUT_SECONDS", 20)) * time.Second
+}
+
 // GetAsString is a function to retrieve the value from the viper config as a string
 // allowing to also pass in a default value
 func GetAsString(key string, dv ...string) string {
@@ -9,6 +9,8 @@ const (
 	FwdHeader string = "X-Forwarded-For"
 	// RequestURLHeader is used to pass on the requestingUrl to attribution
 	RequestURLHeader string = "X-Request-Url"
+	// DuplicateJobHeader is set by attribution when a kickoff returned the job of an earlier one
+	DuplicateJobHeader string = "X-Duplicate-Job"
 	// FhirNdjson is an allowed output format strings for export requests
 	FhirNdjson string = "application/fhir+ndjson"
 	// ApplicationNdjson is an allowed output format strings for export requests
@@ -23,8 +25,12 @@ const (
 	AllResources string = "Patient,Coverage,ExplanationOfBenefit"
 	// SinceLayout is the time format for the since parameter
 	SinceLayout string = "2006-01-02T15:04:05-07:00"
+	// SinceAuto is the _since value that resolves to the transaction time of the group's last successful export
+	SinceAuto string = "auto"
 	// Ndjson is an allowed output format strings for export requests
 	Ndjson string = "ndjson"
+	// IdempotencyKeyHeader lets a client retry a kickoff without starting a second export
+	IdempotencyKeyHeader string = "Idempotency-Key"
 	// ProvenanceHeader is the provenance header
 	ProvenanceHeader string = "X-Provenance"
 	// FHIRIdentifierSystemHeader is the mbi identifier system
@@ -61,4 +67,20 @@ const (
 	ContextKeyProvenanceHeader
 	// ContextKeyMBI is the key in the context to pass on the mbi header value
 	ContextKeyMBI
+	// ContextKeyScopes is the key in the context to retrieve the scopes granted to the access token
+	ContextKeyScopes
+	// ContextKeyTypeFilter is the key in the context to pass on the validated _typeFilter param values
+	ContextKeyTypeFilter
+	// ContextKeyElements is the key in the context to pass on the validated _elements param value
+	ContextKeyElements
+	// ContextKeyPatients is the key in the context to pass on the patient MBIs a POST kickoff is restricted to
+	ContextKeyPatients
+	// ContextKeyExportWarnings is the key in the context to pass on the warnings for kickoff params ignored by lenient handling
+	ContextKeyExportWarnings
+	// ContextKeyWebhook is the key in the context to pass on the validated _webhook kickoff param value
+	ContextKeyWebhook
+	// ContextKeyExportSchedule is the key in the context to retrieve the export schedule ID
+	ContextKeyExportSchedule
+	// ContextKeyRespondAsync is the key in the context to pass on whether the Prefer header includes respond-async
+	ContextKeyRespondAsync
 )
@@ -6,7 +6,11 @@ import (
 	"github.com/darahayes/go-boom"
 	"github.com/go-chi/chi/middleware"
 	"github.com/samply/golang-fhir-models/fhir-models/fhir"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // GenericServerIssue Write a generic 500 server error OperationOutcome to the response
@@ -24,29 +28,56 @@ func NotFound(ctx context.Context, w http.ResponseWriter, message string) {
 	fhirError(ctx, w, http.StatusNotFound, fhir.IssueSeverityWarning, fhir.IssueTypeNotFound, message)
 }
 
+// Forbidden Write a specific forbidden OperationOutcome to the response
+func Forbidden(ctx context.Context, w http.ResponseWriter, message string) {
+	fhirError(ctx, w, http.StatusForbidden, fhir.IssueSeverityError, fhir.IssueTypeForbidden, message)
+}
+
+// Gone Write a deleted OperationOutcome with a 410 status to the response, for content that expired and was removed
+func Gone(ctx context.Context, w http.ResponseWriter, message string) {
+	fhirError(ctx, w, http.StatusGone, fhir.IssueSeverityError, fhir.IssueTypeDeleted, message)
+}
+
+// TooManyRequests Write a throttled OperationOutcome with a 429 status to the response, with a Retry-After header of
+// the whole seconds until the client may try again
+func TooManyRequests(ctx context.Context, w http.ResponseWriter, retryAfter time.Duration, message string) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(retryAfter.Seconds())))))
+	fhirError(ctx, w, http.StatusTooManyRequests, fhir.IssueSeverityError, fhir.IssueTypeThrottled, message)
+}
+
 // BusinessViolation Write a generic business rule OperationOutcome to the response
 func BusinessViolation(ctx context.Context, w http.ResponseWriter, statusCode int, message string) {
 	fhirError(ctx, w, statusCode, fhir.IssueSeverityWarning, fhir.IssueTypeBusinessRule, message)
 }
 
+// BusinessViolations Write a business rule OperationOutcome to the response, with an issue for each message
+func BusinessViolations(ctx context.Context, w http.ResponseWriter, statusCode int, messages []string) {
+	fhirErrors(ctx, w, statusCode, fhir.IssueSeverityWarning, fhir.IssueTypeBusinessRule, messages)
+}
+
 func fhirError(ctx context.Context, w http.ResponseWriter, statusCode int, severity fhir.IssueSeverity, code fhir.IssueType, message string) {
+	fhirErrors(ctx, w, statusCode, severity, code, []string{message})
+}
+
+func fhirErrors(ctx context.Context, w http.ResponseWriter, statusCode int, severity fhir.IssueSeverity, code fhir.IssueType, messages []string) {
 
 	rqID := fmt.Sprintf("%s", ctx.Value(middleware.RequestIDKey))
 	o := fhir.OperationOutcome{
-		Issue: []fhir.OperationOutcomeIssue{
-			{
-				Severity:    severity,
-				Code:        code,
-				Diagnostics: &rqID,
-				Details: &fhir.CodeableConcept{
-					Text: &message,
-				},
+		Issue: make([]fhir.OperationOutcomeIssue, 0, len(messages)),
+	}
+	for i := range messages {
+		o.Issue = append(o.Issue, fhir.OperationOutcomeIssue{
+			Severity:    severity,
+			Code:        code,
+			Diagnostics: &rqID,
+			Details: &fhir.CodeableConcept{
+				Text: &messages[i],
 			},
-		},
+		})
 	}
 	b, err := o.MarshalJSON()
 	if err != nil {
-		boom.Internal(w, message)
+		boom.Internal(w, strings.Join(messages, "; "))
 	}
 
 	w.WriteHeader(statusCode)
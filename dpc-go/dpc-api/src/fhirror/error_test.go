@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestBusinessViolation(t *testing.T) {
@@ -63,3 +64,94 @@ func TestServerIssue(t *testing.T) {
         "resourceType": "OperationOutcome"
     }`)
 }
+
+func TestBusinessViolations(t *testing.T) {
+	w := httptest.NewRecorder()
+	c := context.WithValue(context.Background(), middleware.RequestIDKey, "testRequest")
+	ja := jsonassert.New(t)
+
+	BusinessViolations(c, w, http.StatusBadRequest, []string{"first", "second"})
+
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	ja.Assertf(string(body), `
+    {
+        "issue": [
+            {
+                "severity": "warning",
+                "code": "Business Rule Violation",
+                "details": {
+                    "text": "first"
+                },
+                "diagnostics": "testRequest"
+            },
+            {
+                "severity": "warning",
+                "code": "Business Rule Violation",
+                "details": {
+                    "text": "second"
+                },
+                "diagnostics": "testRequest"
+            }
+        ],
+        "resourceType": "OperationOutcome"
+    }`)
+}
+
+func TestGone(t *testing.T) {
+	w := httptest.NewRecorder()
+	c := context.WithValue(context.Background(), middleware.RequestIDKey, "testRequest")
+	ja := jsonassert.New(t)
+
+	Gone(c, w, "test")
+
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+	ja.Assertf(string(body), `
+    {
+        "issue": [
+            {
+                "severity": "error",
+                "code": "Deleted",
+                "details": {
+                    "text": "test"
+                },
+                "diagnostics": "testRequest"
+            }
+        ],
+        "resourceType": "OperationOutcome"
+    }`)
+}
+
+func TestTooManyRequests(t *testing.T) {
+	w := httptest.NewRecorder()
+	c := context.WithValue(context.Background(), middleware.RequestIDKey, "testRequest")
+	ja := jsonassert.New(t)
+
+	TooManyRequests(c, w, 1500*time.Millisecond, "test")
+
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get("Retry-After"))
+	ja.Assertf(string(body), `
+    {
+        "issue": [
+            {
+                "severity": "error",
+                "code": "Throttled",
+                "details": {
+                    "text": "test"
+                },
+                "diagnostics": "testRequest"
+            }
+        ],
+        "resourceType": "OperationOutcome"
+    }`)
+
+	w = httptest.NewRecorder()
+	TooManyRequests(c, w, time.Millisecond, "test")
+	assert.Equal(t, "1", w.Result().Header.Get("Retry-After"))
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"github.com/CMSgov/dpc/api/auth"
+	"github.com/CMSgov/dpc/api/client"
 	"github.com/CMSgov/dpc/api/conf"
 	"github.com/CMSgov/dpc/api/logger"
+	"github.com/CMSgov/dpc/api/ratelimit"
 	"github.com/CMSgov/dpc/api/service"
 	"github.com/CMSgov/dpc/api/service/admin"
 	"github.com/CMSgov/dpc/api/service/public"
@@ -20,12 +23,33 @@ func main() {
 		logger.WithContext(ctx).Fatal("Failed to start server", zap.Error(err))
 	}()
 
-	ps := public.NewPublicServer(ctx)
+	limiter, err := ratelimit.NewLimiterFromConfig()
+	if err != nil {
+		logger.WithContext(ctx).Fatal("Could not create rate limiter", zap.Error(err))
+	}
+
+	ssasClient := client.NewSsasHTTPClient(ctx, client.SsasHTTPClientConfig{
+		PublicURL:    conf.GetAsString("ssas-client.public-url"),
+		AdminURL:     conf.GetAsString("ssas-client.admin-url"),
+		Retries:      conf.GetAsInt("ssas-client.attrRetries", 3),
+		ClientID:     conf.GetAsString("ssas-client.client-id"),
+		ClientSecret: conf.GetAsString("ssas-client.client-secret"),
+		CACert:       conf.GetAsString("ssas-client.ca-cert"),
+		Cert:         conf.GetAsString("ssas-client.cert"),
+		CertKey:      conf.GetAsString("ssas-client.cert-key"),
+	})
+
+	authProvider, err := auth.NewProvider(ssasClient)
+	if err != nil {
+		logger.WithContext(ctx).Fatal("Could not create auth provider", zap.Error(err))
+	}
+
+	ps := public.NewPublicServer(ctx, limiter, ssasClient, authProvider)
 	if ps == nil {
 		log.Fatal("Could not create public server")
 	}
 
-	as := admin.NewAdminServer(ctx)
+	as := admin.NewAdminServer(ctx, limiter, ssasClient, authProvider)
 	if as == nil {
 		log.Fatal("Could not create admin server")
 	}
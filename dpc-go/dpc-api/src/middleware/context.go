@@ -3,7 +3,7 @@ package middleware
 import (
 	"context"
 	"fmt"
-	"github.com/CMSgov/dpc/api/client"
+	"github.com/CMSgov/dpc/api/auth"
 	"github.com/CMSgov/dpc/api/conf"
 	"github.com/CMSgov/dpc/api/constants"
 	"github.com/pkg/errors"
@@ -43,8 +43,8 @@ func OrganizationCtx(next http.Handler) http.Handler {
 	})
 }
 
-// AuthCtx middleware gets the organization ID from the access token
-func AuthCtx(ssasClient client.SsasClient) func(next http.Handler) http.Handler {
+// AuthCtx middleware gets the organization ID and granted scopes from the access token
+func AuthCtx(provider auth.Provider) func(next http.Handler) http.Handler {
 	// Return context with organizationID
 	return func(next http.Handler) http.Handler {
 		//return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -66,7 +66,7 @@ func AuthCtx(ssasClient client.SsasClient) func(next http.Handler) http.Handler
 				return
 			}
 
-			orgID, err := ssasClient.GetOrgIDFromToken(r.Context(), bearerToken)
+			info, err := provider.GetTokenInfo(r.Context(), bearerToken)
 
 			if err != nil {
 				log.Error("Invalid access token", zap.Error(err))
@@ -74,7 +74,8 @@ func AuthCtx(ssasClient client.SsasClient) func(next http.Handler) http.Handler
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), constants.ContextKeyOrganization, orgID)
+			ctx := context.WithValue(r.Context(), constants.ContextKeyOrganization, info.OrganizationID)
+			ctx = context.WithValue(ctx, constants.ContextKeyScopes, auth.ParseScopes(info.Scope))
 			next.ServeHTTP(w, r.WithContext(ctx))
 		}
 
@@ -172,11 +173,55 @@ func isValidType(t string) bool {
 	return false
 }
 
-// ExportSinceParamCtx middleware to extract the export _since param
+// ExportTypeFilterParamCtx middleware to extract and validate the export _typeFilter params.
+// It must run after ExportTypesParamCtx, as filters are only allowed for the requested types.
+func ExportTypeFilterParamCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := logger.WithContext(r.Context())
+		types, _ := r.Context().Value(constants.ContextKeyResourceTypes).(string)
+		filter, msg := parseTypeFilters(r.URL.Query()["_typeFilter"], types)
+		if msg != "" {
+			log.Error(msg)
+			fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, msg)
+			return
+		}
+		ctx := context.WithValue(r.Context(), constants.ContextKeyTypeFilter, filter)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ExportElementsParamCtx middleware to extract and validate the export _elements param
+func ExportElementsParamCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := logger.WithContext(r.Context())
+		elements, msg := parseElements(r.URL.Query().Get("_elements"))
+		if msg != "" {
+			log.Error(msg)
+			fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, msg)
+			return
+		}
+		ctx := context.WithValue(r.Context(), constants.ContextKeyElements, strings.Join(elements, ","))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ExportSinceParamCtx middleware to extract the export _since param. For group exports _since=auto is passed on as is,
+// attribution resolves it to the transaction time of the group's last successful export
 func ExportSinceParamCtx(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log := logger.WithContext(r.Context())
 		since := r.URL.Query().Get("_since")
+		if since == constants.SinceAuto {
+			if _, ok := r.Context().Value(constants.ContextKeyGroup).(string); !ok {
+				msg := "_since=auto is only supported for Group exports"
+				log.Error(msg)
+				fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, msg)
+				return
+			}
+			ctx := context.WithValue(r.Context(), constants.ContextKeySince, since)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
 		s, msg := validateSince(since)
 		if msg != "" {
 			log.Error(msg)
@@ -211,6 +256,15 @@ func JobCtx(next http.Handler) http.Handler {
 	})
 }
 
+// ExportScheduleCtx middleware to extract the scheduleID from the chi url param and set it into the request context
+func ExportScheduleCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheduleID := chi.URLParam(r, "scheduleID")
+		ctx := context.WithValue(r.Context(), constants.ContextKeyExportSchedule, scheduleID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 // TokenCtx middleware to extract the tokenID from the chi url param and set it into the request context
 func TokenCtx(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
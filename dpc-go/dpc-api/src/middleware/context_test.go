@@ -8,6 +8,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -65,6 +67,184 @@ func (suite *ContextTestSuite) TestExportTypesParamInvalid() {
 	assert.Equal(suite.T(), "", types)
 }
 
+func (suite *ContextTestSuite) TestExportTypeFilterParam() {
+	var filter string
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filter, _ = r.Context().Value(constants.ContextKeyTypeFilter).(string)
+	})
+
+	typeFilter := url.QueryEscape("ExplanationOfBenefit?type=carrier,outpatient&service-date=ge2021-01-01")
+	req := httptest.NewRequest(http.MethodGet, "http://www.example.com/Group/some-id/$export?_typeFilter="+typeFilter, nil)
+	res := httptest.NewRecorder()
+
+	e := ExportTypesParamCtx(ExportTypeFilterParamCtx(nextHandler))
+	e.ServeHTTP(res, req)
+	assert.Equal(suite.T(), http.StatusOK, res.Code)
+	assert.Equal(suite.T(), "ExplanationOfBenefit?service-date=ge2021-01-01&type=carrier%2Coutpatient", filter)
+}
+
+func (suite *ContextTestSuite) TestExportTypeFilterParamSeveralQueries() {
+	var filter string
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filter, _ = r.Context().Value(constants.ContextKeyTypeFilter).(string)
+	})
+
+	query := url.Values{"_typeFilter": {"ExplanationOfBenefit?type=dme,ExplanationOfBenefit?service-date=ge2021-01-01", "ExplanationOfBenefit?type=dme"}}
+	req := httptest.NewRequest(http.MethodGet, "http://www.example.com/Group/some-id/$export?"+query.Encode(), nil)
+	res := httptest.NewRecorder()
+
+	e := ExportTypesParamCtx(ExportTypeFilterParamCtx(nextHandler))
+	e.ServeHTTP(res, req)
+	assert.Equal(suite.T(), http.StatusOK, res.Code)
+	assert.Equal(suite.T(), "ExplanationOfBenefit?service-date=ge2021-01-01,ExplanationOfBenefit?type=dme", filter)
+}
+
+func (suite *ContextTestSuite) TestExportTypeFilterParamInvalid() {
+	tests := []struct {
+		types      string
+		typeFilter string
+	}{
+		{"", "ExplanationOfBenefit"},
+		{"", "ExplanationOfBenefit?type=pde"},
+		{"", "ExplanationOfBenefit?service-date=2021-01-01"},
+		{"", "ExplanationOfBenefit?service-date=ge2021-13-01"},
+		{"", "ExplanationOfBenefit?_lastUpdated=ge2021-01-01"},
+		{"", "Patient?gender=female"},
+		{"Patient", "ExplanationOfBenefit?type=carrier"},
+	}
+	for _, test := range tests {
+		called := false
+		nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		})
+
+		query := url.Values{"_typeFilter": {test.typeFilter}}
+		if test.types != "" {
+			query.Set("_type", test.types)
+		}
+		req := httptest.NewRequest(http.MethodGet, "http://www.example.com/Group/some-id/$export?"+query.Encode(), nil)
+		res := httptest.NewRecorder()
+
+		e := ExportTypesParamCtx(ExportTypeFilterParamCtx(nextHandler))
+		e.ServeHTTP(res, req)
+		assert.Equal(suite.T(), http.StatusBadRequest, res.Code, test.typeFilter)
+		assert.False(suite.T(), called, test.typeFilter)
+	}
+}
+
+func (suite *ContextTestSuite) TestExportElementsParam() {
+	var elements string
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		elements, _ = r.Context().Value(constants.ContextKeyElements).(string)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "http://www.example.com/Group/some-id/$export?_elements=patient,ExplanationOfBenefit.type", nil)
+	res := httptest.NewRecorder()
+
+	ExportElementsParamCtx(nextHandler).ServeHTTP(res, req)
+	assert.Equal(suite.T(), "patient,ExplanationOfBenefit.type", elements)
+
+	for _, invalid := range []string{"Patient", "name.family", "Patient.name.family", "name,"} {
+		req = httptest.NewRequest(http.MethodGet, "http://www.example.com/Group/some-id/$export?_elements="+url.QueryEscape(invalid), nil)
+		res = httptest.NewRecorder()
+		ExportElementsParamCtx(nextHandler).ServeHTTP(res, req)
+		assert.Equal(suite.T(), http.StatusBadRequest, res.Code, invalid)
+	}
+}
+
+func (suite *ContextTestSuite) TestExportParameters() {
+	var query url.Values
+	var patients []string
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		patients, _ = r.Context().Value(constants.ContextKeyPatients).([]string)
+	})
+
+	body := `{
+		"resourceType": "Parameters",
+		"parameter": [
+			{"name": "_type", "valueString": "Patient"},
+			{"name": "_type", "valueString": "ExplanationOfBenefit"},
+			{"name": "_since", "valueInstant": "2021-01-01T00:00:00.000-05:00"},
+			{"name": "_typeFilter", "valueString": "ExplanationOfBenefit?type=carrier"},
+			{"name": "_outputFormat", "valueString": "ndjson"},
+			{"name": "_webhook", "valueUrl": "https://example.com/hook"},
+			{"name": "patient", "valueReference": {"identifier": {"system": "http://hl7.org/fhir/sid/us-mbi", "value": "2SW4N00AA00"}}},
+			{"name": "patient", "valueReference": {"identifier": {"system": "http://hl7.org/fhir/sid/us-mbi", "value": "3SW4N00AA00"}}}
+		]
+	}`
+	req := httptest.NewRequest(http.MethodPost, "http://www.example.com/Group/some-id/$export", strings.NewReader(body))
+	res := httptest.NewRecorder()
+
+	ExportParametersCtx(nextHandler).ServeHTTP(res, req)
+	assert.Equal(suite.T(), http.StatusOK, res.Code)
+	assert.Equal(suite.T(), "Patient,ExplanationOfBenefit", query.Get("_type"))
+	assert.Equal(suite.T(), "2021-01-01T00:00:00.000-05:00", query.Get("_since"))
+	assert.Equal(suite.T(), "ExplanationOfBenefit?type=carrier", query.Get("_typeFilter"))
+	assert.Equal(suite.T(), "ndjson", query.Get("_outputFormat"))
+	assert.Equal(suite.T(), "https://example.com/hook", query.Get("_webhook"))
+	assert.Equal(suite.T(), []string{"2SW4N00AA00", "3SW4N00AA00"}, patients)
+}
+
+func (suite *ContextTestSuite) TestExportParametersIgnoresGet() {
+	var query url.Values
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "http://www.example.com/Group/some-id/$export?_type=Patient", nil)
+	res := httptest.NewRecorder()
+
+	ExportParametersCtx(nextHandler).ServeHTTP(res, req)
+	assert.Equal(suite.T(), "Patient", query.Get("_type"))
+}
+
+func (suite *ContextTestSuite) TestExportParametersInvalid() {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		suite.Fail("next handler should not be called")
+	})
+
+	for _, invalid := range []string{
+		`{"resourceType": "Patient"}`,
+		`not json`,
+		`{"resourceType": "Parameters", "parameter": [{"name": "_type"}]}`,
+		`{"resourceType": "Parameters", "parameter": [{"name": "patient", "valueReference": {"reference": "Patient/123"}}]}`,
+		`{"resourceType": "Parameters", "parameter": [{"name": "patient", "valueReference": {"identifier": {"system": "http://hl7.org/fhir/sid/us-npi", "value": "123"}}}]}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "http://www.example.com/Group/some-id/$export", strings.NewReader(invalid))
+		res := httptest.NewRecorder()
+		ExportParametersCtx(nextHandler).ServeHTTP(res, req)
+		assert.Equal(suite.T(), http.StatusBadRequest, res.Code, invalid)
+	}
+}
+
+func (suite *ContextTestSuite) TestSubsetResource() {
+	resource := map[string]interface{}{
+		"resourceType": "ExplanationOfBenefit",
+		"id":           "eob-1",
+		"meta":         map[string]interface{}{"lastUpdated": "2021-01-01"},
+		"type":         "carrier",
+		"patient":      "p-1",
+		"item":         []interface{}{},
+	}
+
+	subset := subsetResource(resource, []string{"Patient.name", "ExplanationOfBenefit.type", "patient"})
+
+	assert.Equal(suite.T(), map[string]interface{}{
+		"resourceType": "ExplanationOfBenefit",
+		"id":           "eob-1",
+		"meta":         map[string]interface{}{"lastUpdated": "2021-01-01", "tag": []interface{}{subsettedTag}},
+		"type":         "carrier",
+		"patient":      "p-1",
+	}, subset)
+	assert.Equal(suite.T(), resource, subsetResource(resource, []string{"Patient.name"}))
+}
+
+func (suite *ContextTestSuite) TestSplitTypeFilter() {
+	queries := splitTypeFilter("ExplanationOfBenefit?type=carrier,outpatient,Coverage?_id=1")
+	assert.Equal(suite.T(), []string{"ExplanationOfBenefit?type=carrier,outpatient", "Coverage?_id=1"}, queries)
+}
+
 func (suite *ContextTestSuite) TestExportSinceParamMinusTZ() {
 	var since string
 	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -151,6 +331,37 @@ func (suite *ContextTestSuite) TestExportSinceParamInvalid() {
 	assert.Equal(suite.T(), "", since)
 }
 
+func (suite *ContextTestSuite) TestExportSinceParamAuto() {
+	var since string
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		since, _ = r.Context().Value(constants.ContextKeySince).(string)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "http://www.example.com/Group/some-id/$export?_since=auto", nil)
+	req = req.WithContext(context.WithValue(req.Context(), constants.ContextKeyGroup, "some-id"))
+	res := httptest.NewRecorder()
+
+	e := ExportSinceParamCtx(nextHandler)
+	e.ServeHTTP(res, req)
+	assert.Equal(suite.T(), http.StatusOK, res.Code)
+	assert.Equal(suite.T(), constants.SinceAuto, since)
+}
+
+func (suite *ContextTestSuite) TestExportSinceParamAutoNotGroup() {
+	var called bool
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "http://www.example.com/Patient/$export?_since=auto", nil)
+	res := httptest.NewRecorder()
+
+	e := ExportSinceParamCtx(nextHandler)
+	e.ServeHTTP(res, req)
+	assert.Equal(suite.T(), http.StatusBadRequest, res.Code)
+	assert.False(suite.T(), called)
+}
+
 func (suite *ContextTestSuite) TestProvenanceHeader() {
 	ja := jsonassert.New(suite.T())
 	var header string
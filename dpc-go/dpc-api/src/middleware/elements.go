@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var elementPattern = regexp.MustCompile(`^(?:([A-Z][A-Za-z]+)\.)?([a-z][A-Za-z0-9]*)$`)
+
+// subsettedTag is the meta tag that marks a resource trimmed by _elements, per the FHIR spec
+var subsettedTag = map[string]interface{}{
+	"system": "http://terminology.hl7.org/CodeSystem/v3-ObservationValue",
+	"code":   "SUBSETTED",
+}
+
+// parseElements validates an _elements value. Elements are top-level element names, optionally prefixed with a
+// resource type to only apply to that type, e.g. Patient.name. It returns the elements or a message describing
+// the first invalid one.
+func parseElements(value string) ([]string, string) {
+	if value == "" {
+		return nil, ""
+	}
+	elements := make([]string, 0)
+	for _, e := range strings.Split(value, ",") {
+		e = strings.TrimSpace(e)
+		if !elementPattern.MatchString(e) {
+			return nil, fmt.Sprintf("Invalid _elements value %s", e)
+		}
+		elements = append(elements, e)
+	}
+	return elements, ""
+}
+
+// subsetResource trims a resource to the requested elements of its type, keeping the mandatory id, resourceType and
+// meta elements, and tags it as SUBSETTED. Resources without requested elements are returned unchanged.
+func subsetResource(resource map[string]interface{}, elements []string) map[string]interface{} {
+	resourceType, _ := resource["resourceType"].(string)
+	keep := make(map[string]bool)
+	for _, e := range elements {
+		if i := strings.Index(e, "."); i > 0 {
+			if e[:i] == resourceType {
+				keep[e[i+1:]] = true
+			}
+			continue
+		}
+		keep[e] = true
+	}
+	if len(keep) == 0 {
+		return resource
+	}
+
+	subset := map[string]interface{}{"resourceType": resource["resourceType"]}
+	for name, value := range resource {
+		if keep[name] || name == "id" {
+			subset[name] = value
+		}
+	}
+	subset["meta"] = subsettedMeta(resource["meta"])
+	return subset
+}
+
+func subsettedMeta(m interface{}) map[string]interface{} {
+	meta := make(map[string]interface{})
+	switch existing := m.(type) {
+	case map[string]interface{}:
+		for k, v := range existing {
+			meta[k] = v
+		}
+	case map[string]string:
+		for k, v := range existing {
+			meta[k] = v
+		}
+	}
+	tags, _ := meta["tag"].([]interface{})
+	meta["tag"] = append(tags, subsettedTag)
+	return meta
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/CMSgov/dpc/api/constants"
+	"github.com/CMSgov/dpc/api/fhirror"
+	"github.com/CMSgov/dpc/api/logger"
+	"github.com/samply/golang-fhir-models/fhir-models/fhir"
+)
+
+const mbiSystem = "http://hl7.org/fhir/sid/us-mbi"
+
+// exportParameters is the FHIR Parameters resource accepted by a POST kickoff request
+type exportParameters struct {
+	ResourceType string `json:"resourceType"`
+	Parameter    []struct {
+		Name           string          `json:"name"`
+		ValueString    *string         `json:"valueString,omitempty"`
+		ValueInstant   *string         `json:"valueInstant,omitempty"`
+		ValueURL       *string         `json:"valueUrl,omitempty"`
+		ValueReference *fhir.Reference `json:"valueReference,omitempty"`
+	} `json:"parameter"`
+}
+
+// ExportParametersCtx middleware to support POST kickoff requests. It copies the params from the FHIR Parameters
+// body into the url query, so the kickoff and export param middleware that follow validate and parse them the same
+// way as for a GET kickoff, and sets the MBIs of any patient params into the request context. Other methods are passed through untouched.
+func ExportParametersCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		log := logger.WithContext(r.Context())
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			log.Error("Failed to read request body")
+			fhirror.GenericServerIssue(r.Context(), w)
+			return
+		}
+		query, patients, msg := parseExportParameters(body)
+		if msg != "" {
+			log.Error(msg)
+			fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, msg)
+			return
+		}
+		r.URL.RawQuery = query.Encode()
+		ctx := r.Context()
+		if len(patients) > 0 {
+			ctx = context.WithValue(ctx, constants.ContextKeyPatients, patients)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// parseExportParameters converts a Parameters body into kickoff query params and a list of patient MBIs.
+// It returns a message describing the first problem found if the body is not valid.
+func parseExportParameters(body []byte) (url.Values, []string, string) {
+	var params exportParameters
+	if err := json.Unmarshal(body, &params); err != nil || params.ResourceType != "Parameters" {
+		return nil, nil, "Request body must be a FHIR Parameters resource"
+	}
+
+	query := url.Values{}
+	patients := make([]string, 0)
+	for _, p := range params.Parameter {
+		switch {
+		case p.Name == "patient":
+			ref := p.ValueReference
+			if ref == nil || ref.Identifier == nil || ref.Identifier.System == nil || *ref.Identifier.System != mbiSystem ||
+				ref.Identifier.Value == nil || *ref.Identifier.Value == "" {
+				return nil, nil, fmt.Sprintf("patient parameter must be a reference with a %s identifier", mbiSystem)
+			}
+			patients = append(patients, *ref.Identifier.Value)
+		default:
+			value := p.ValueString
+			if value == nil {
+				value = p.ValueInstant
+			}
+			if value == nil {
+				value = p.ValueURL
+			}
+			if value == nil {
+				return nil, nil, fmt.Sprintf("%s parameter must have a value", p.Name)
+			}
+			query.Add(p.Name, *value)
+		}
+	}
+	if len(query["_type"]) > 1 {
+		query.Set("_type", strings.Join(query["_type"], ","))
+	}
+	return query, patients, ""
+}
@@ -65,10 +65,22 @@ func FHIRFilter(next http.Handler) http.Handler {
 
 // FHIRModel function that intercepts the bytes being returned from the response
 // if the response is successful, then the expected data is in the format of
-// model.Resource where this will convert it into the appropriate FHIR object
+// model.Resource where this will convert it into the appropriate FHIR object.
+// Reads are trimmed to the elements requested with _elements.
 func FHIRModel(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		log := logger.WithContext(r.Context())
+		var elements []string
+		if r.Method == http.MethodGet {
+			var msg string
+			elements, msg = parseElements(r.URL.Query().Get("_elements"))
+			if msg != "" {
+				log.Error(msg)
+				fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, msg)
+				return
+			}
+		}
+
 		rw := &responseWriter{
 			ResponseWriter: w,
 			buf:            &bytes.Buffer{},
@@ -78,7 +90,7 @@ func FHIRModel(next http.Handler) http.Handler {
 		next.ServeHTTP(rw, r)
 		b := rw.buf.Bytes()
 		if isSuccess(rw.Status) {
-			body, err := convertToFHIR(b)
+			body, err := convertToFHIR(b, elements)
 			if err != nil {
 				log.Error(err.Error(), zap.Error(err))
 				fhirror.GenericServerIssue(r.Context(), w)
@@ -94,7 +106,7 @@ func FHIRModel(next http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
-func convertToFHIR(body []byte) ([]byte, error) {
+func convertToFHIR(body []byte, elements []string) ([]byte, error) {
 	var result model.Resource
 	if err := json.Unmarshal(body, &result); err != nil {
 		return nil, err
@@ -105,7 +117,7 @@ func convertToFHIR(body []byte) ([]byte, error) {
 		return nil, errors.New("Malformed fhir model")
 	}
 	fhirModel["id"] = result.ID
-	meta := make(map[string]string)
+	meta := make(map[string]interface{})
 	meta["id"] = fmt.Sprintf("%s/%s", result.ResourceType(), result.ID)
 	meta["versionId"] = result.VersionID()
 	meta["lastUpdated"] = result.LastUpdated()
@@ -119,6 +131,9 @@ func convertToFHIR(body []byte) ([]byte, error) {
 		fhirModel["managingEntity"] = me
 	}
 
+	if len(elements) > 0 {
+		fhirModel = subsetResource(fhirModel, elements)
+	}
 	return json.Marshal(fhirModel)
 }
 
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -46,6 +47,50 @@ func (suite *FHIRMiddlewareTestSuite) TestFHIRModel() {
 	assert.NotNil(suite.T(), o.Meta.VersionId)
 }
 
+func (suite *FHIRMiddlewareTestSuite) TestFHIRModelElements() {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(apitest.AttributionOrgResponse())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "http://www.your-domain.com?_elements=name,Group.member", nil)
+	res := httptest.NewRecorder()
+
+	fm := FHIRModel(nextHandler)
+	fm.ServeHTTP(res, req)
+
+	var o map[string]interface{}
+	_ = json.NewDecoder(res.Body).Decode(&o)
+	assert.Equal(suite.T(), http.StatusOK, res.Code)
+	assert.ElementsMatch(suite.T(), []string{"resourceType", "id", "meta", "name"}, keys(o))
+	meta := o["meta"].(map[string]interface{})
+	assert.NotEmpty(suite.T(), meta["versionId"])
+	assert.Contains(suite.T(), meta["tag"], map[string]interface{}{"system": "http://terminology.hl7.org/CodeSystem/v3-ObservationValue", "code": "SUBSETTED"})
+}
+
+func (suite *FHIRMiddlewareTestSuite) TestFHIRModelInvalidElements() {
+	called := false
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "http://www.your-domain.com?_elements=name.family", nil)
+	res := httptest.NewRecorder()
+
+	fm := FHIRModel(nextHandler)
+	fm.ServeHTTP(res, req)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, res.Code)
+	assert.False(suite.T(), called)
+}
+
+func keys(m map[string]interface{}) []string {
+	k := make([]string, 0, len(m))
+	for key := range m {
+		k = append(k, key)
+	}
+	return k
+}
+
 func (suite *FHIRMiddlewareTestSuite) TestFHIRModelError() {
 	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		_, _ = w.Write([]byte("{}"))
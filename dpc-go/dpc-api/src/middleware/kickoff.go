@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/CMSgov/dpc/api/conf"
+	"github.com/CMSgov/dpc/api/constants"
+	"github.com/CMSgov/dpc/api/fhirror"
+	"github.com/CMSgov/dpc/api/logger"
+	"github.com/sjsdfg/common-lang-in-go/StringUtils"
+)
+
+// kickoffParams are the query params supported by the bulk export kickoff routes
+var kickoffParams = map[string]bool{
+	"_type":         true,
+	"_since":        true,
+	"_typeFilter":   true,
+	"_elements":     true,
+	"_outputFormat": true,
+	// _webhook is a custom param, the URL notified when the job finishes instead of the organization's webhook
+	"_webhook": true,
+}
+
+// ExportKickoffCtx middleware to validate a bulk export kickoff request according to its Prefer header.
+// The header must include respond-async. With handling=strict, unsupported params, an invalid _since and an
+// unsupported _outputFormat are rejected with an issue for each problem. Otherwise, handling is lenient and those
+// params are removed from the request, with a warning for each set into the request context to be reported in the
+// job's error output. A valid _webhook is set into the request context. It must run before the export param middleware, so they only see the params that are kept.
+func ExportKickoffCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log := logger.WithContext(r.Context())
+		respondAsync, strict := parsePrefer(r.Header.Values("Prefer"))
+		if !respondAsync {
+			log.Error("Missing respond-async Prefer header")
+			fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, "The 'Prefer' header is required and must include 'respond-async'")
+			return
+		}
+
+		query := r.URL.Query()
+		problems := validateKickoffParams(query)
+		if len(problems) > 0 && strict {
+			log.Error(fmt.Sprintf("Invalid kickoff request: %s", strings.Join(messages(problems), "; ")))
+			fhirror.BusinessViolations(r.Context(), w, http.StatusBadRequest, messages(problems))
+			return
+		}
+
+		ctx := r.Context()
+		if len(problems) > 0 {
+			warnings := make([]string, 0, len(problems))
+			for _, p := range problems {
+				query.Del(p.param)
+				warnings = append(warnings, fmt.Sprintf("%s, the parameter was ignored", p.message))
+			}
+			log.Warn(fmt.Sprintf("Ignoring kickoff params: %s", strings.Join(warnings, "; ")))
+			r.URL.RawQuery = query.Encode()
+			ctx = context.WithValue(ctx, constants.ContextKeyExportWarnings, warnings)
+		}
+		if webhook := query.Get("_webhook"); webhook != "" {
+			ctx = context.WithValue(ctx, constants.ContextKeyWebhook, webhook)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RespondAsyncCtx middleware to pass on whether the Prefer header includes respond-async, for operations that respond
+// synchronously unless the client would rather get a bulk data job than wait too long
+func RespondAsyncCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respondAsync, _ := parsePrefer(r.Header.Values("Prefer"))
+		ctx := context.WithValue(r.Context(), constants.ContextKeyRespondAsync, respondAsync)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// kickoffProblem is an invalid kickoff param and a message describing why
+type kickoffProblem struct {
+	param   string
+	message string
+}
+
+func messages(problems []kickoffProblem) []string {
+	m := make([]string, 0, len(problems))
+	for _, p := range problems {
+		m = append(m, p.message)
+	}
+	return m
+}
+
+// validWebhookURL reports whether the _webhook is an absolute https URL, plain http is only accepted locally
+func validWebhookURL(u string) bool {
+	parsed, err := url.Parse(u)
+	return err == nil && (parsed.Scheme == "https" || (parsed.Scheme == "http" && conf.IsLocal())) && parsed.Host != ""
+}
+
+// parsePrefer reads the respond-async and handling preferences from the Prefer headers
+func parsePrefer(headers []string) (respondAsync bool, strict bool) {
+	for _, h := range headers {
+		for _, pref := range strings.FieldsFunc(h, func(r rune) bool { return r == ',' || r == ';' }) {
+			switch strings.ToLower(strings.ReplaceAll(strings.TrimSpace(pref), " ", "")) {
+			case "respond-async":
+				respondAsync = true
+			case "handling=strict":
+				strict = true
+			}
+		}
+	}
+	return respondAsync, strict
+}
+
+// validateKickoffParams returns the problems with the kickoff query params, in param name order
+func validateKickoffParams(query url.Values) []kickoffProblem {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	problems := make([]kickoffProblem, 0)
+	for _, name := range names {
+		switch {
+		case !kickoffParams[name]:
+			problems = append(problems, kickoffProblem{name, fmt.Sprintf("Unsupported parameter %s", name)})
+		case name == "_since":
+			if _, msg := validateSince(query.Get(name)); msg != "" {
+				problems = append(problems, kickoffProblem{name, msg})
+			}
+		case name == "_outputFormat":
+			outputFormat := query.Get(name)
+			if StringUtils.IsNotBlank(outputFormat) && StringUtils.EqualsNoneIgnoreCase(outputFormat, constants.FhirNdjson, constants.ApplicationNdjson, constants.Ndjson) {
+				problems = append(problems, kickoffProblem{name, "'_outputFormat' query parameter must be 'application/fhir+ndjson', 'application/ndjson', or 'ndjson'"})
+			}
+		case name == "_webhook":
+			if !validWebhookURL(query.Get(name)) {
+				problems = append(problems, kickoffProblem{name, "'_webhook' query parameter must be an absolute https URL"})
+			}
+		}
+	}
+	return problems
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/CMSgov/dpc/api/constants"
+	"github.com/samply/golang-fhir-models/fhir-models/fhir"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type KickoffTestSuite struct {
+	suite.Suite
+	called   bool
+	query    url.Values
+	warnings []string
+	webhook  interface{}
+}
+
+func TestKickoffTestSuite(t *testing.T) {
+	suite.Run(t, new(KickoffTestSuite))
+}
+
+func (suite *KickoffTestSuite) serve(target string, prefer ...string) *http.Response {
+	suite.called, suite.query, suite.warnings, suite.webhook = false, nil, nil, nil
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		suite.called = true
+		suite.query = r.URL.Query()
+		suite.warnings, _ = r.Context().Value(constants.ContextKeyExportWarnings).([]string)
+		suite.webhook = r.Context().Value(constants.ContextKeyWebhook)
+		w.WriteHeader(http.StatusAccepted)
+	})
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for _, p := range prefer {
+		req.Header.Add("Prefer", p)
+	}
+	res := httptest.NewRecorder()
+	ExportKickoffCtx(nextHandler).ServeHTTP(res, req)
+	return res.Result()
+}
+
+func issues(res *http.Response) []string {
+	b, _ := ioutil.ReadAll(res.Body)
+	var oo fhir.OperationOutcome
+	_ = json.Unmarshal(b, &oo)
+	text := make([]string, 0)
+	for _, i := range oo.Issue {
+		text = append(text, *i.Details.Text)
+	}
+	return text
+}
+
+func (suite *KickoffTestSuite) TestRequiresRespondAsync() {
+	for _, prefer := range [][]string{nil, {"INVALID"}, {"handling=strict"}} {
+		res := suite.serve("http://www.example.com/Group/some-id/$export", prefer...)
+		assert.Equal(suite.T(), http.StatusBadRequest, res.StatusCode, prefer)
+		assert.Equal(suite.T(), []string{"The 'Prefer' header is required and must include 'respond-async'"}, issues(res))
+		assert.False(suite.T(), suite.called)
+	}
+}
+
+func (suite *KickoffTestSuite) TestValidRequest() {
+	for _, prefer := range [][]string{{"respond-async"}, {"respond-async, handling=strict"}, {"respond-async", "handling=strict"}} {
+		res := suite.serve("http://www.example.com/Group/some-id/$export?_type=Patient&_outputFormat=ndjson&_since=2021-01-01T00:00:00.000-05:00", prefer...)
+		assert.Equal(suite.T(), http.StatusAccepted, res.StatusCode, prefer)
+		assert.Equal(suite.T(), "ndjson", suite.query.Get("_outputFormat"))
+		assert.Nil(suite.T(), suite.warnings)
+	}
+}
+
+func (suite *KickoffTestSuite) TestStrictRejectsEveryProblem() {
+	res := suite.serve("http://www.example.com/Group/some-id/$export?_type=Patient&_count=10&_outputFormat=csv&_since=yesterday&patient=123",
+		"respond-async; handling=strict")
+
+	assert.Equal(suite.T(), http.StatusBadRequest, res.StatusCode)
+	assert.False(suite.T(), suite.called)
+	assert.Equal(suite.T(), []string{
+		"Unsupported parameter _count",
+		"'_outputFormat' query parameter must be 'application/fhir+ndjson', 'application/ndjson', or 'ndjson'",
+		"Could not parse _since",
+		"Unsupported parameter patient",
+	}, issues(res))
+}
+
+func (suite *KickoffTestSuite) TestLenientIgnoresProblems() {
+	res := suite.serve("http://www.example.com/Group/some-id/$export?_type=Patient&_count=10&_outputFormat=csv&_since=yesterday",
+		"respond-async")
+
+	assert.Equal(suite.T(), http.StatusAccepted, res.StatusCode)
+	assert.Equal(suite.T(), url.Values{"_type": {"Patient"}}, suite.query)
+	assert.Equal(suite.T(), []string{
+		"Unsupported parameter _count, the parameter was ignored",
+		"'_outputFormat' query parameter must be 'application/fhir+ndjson', 'application/ndjson', or 'ndjson', the parameter was ignored",
+		"Could not parse _since, the parameter was ignored",
+	}, suite.warnings)
+}
+
+func (suite *KickoffTestSuite) TestWebhook() {
+	res := suite.serve("http://www.example.com/Group/some-id/$export?_webhook="+url.QueryEscape("https://example.com/hook?id=1"), "respond-async")
+	assert.Equal(suite.T(), http.StatusAccepted, res.StatusCode)
+	assert.Equal(suite.T(), "https://example.com/hook?id=1", suite.webhook)
+
+	res = suite.serve("http://www.example.com/Group/some-id/$export?_webhook=ftp://example.com/hook", "respond-async; handling=strict")
+	assert.Equal(suite.T(), http.StatusBadRequest, res.StatusCode)
+	assert.Equal(suite.T(), []string{"'_webhook' query parameter must be an absolute https URL"}, issues(res))
+
+	res = suite.serve("http://www.example.com/Group/some-id/$export?_webhook=/hook", "respond-async")
+	assert.Equal(suite.T(), http.StatusAccepted, res.StatusCode)
+	assert.Nil(suite.T(), suite.webhook)
+	assert.Equal(suite.T(), []string{"'_webhook' query parameter must be an absolute https URL, the parameter was ignored"}, suite.warnings)
+}
+
+func TestRespondAsyncCtx(t *testing.T) {
+	for prefer, expected := range map[string]bool{"": false, "respond-async": true, "handling=lenient, respond-async": true, "return=minimal": false} {
+		var respondAsync interface{}
+		nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			respondAsync = r.Context().Value(constants.ContextKeyRespondAsync)
+		})
+		req := httptest.NewRequest(http.MethodGet, "http://www.example.com/Patient/$everything", nil)
+		if prefer != "" {
+			req.Header.Set("Prefer", prefer)
+		}
+		RespondAsyncCtx(nextHandler).ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, expected, respondAsync, prefer)
+	}
+}
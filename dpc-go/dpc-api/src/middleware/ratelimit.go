@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/CMSgov/dpc/api/constants"
+	"github.com/CMSgov/dpc/api/fhirror"
+	"github.com/CMSgov/dpc/api/logger"
+	"github.com/CMSgov/dpc/api/ratelimit"
+	"go.uber.org/zap"
+)
+
+// RateLimit middleware rejects requests of an organization that used up its request rate with a 429. It must follow
+// AuthCtx. When the limiter fails the request is let through, so an outage of a shared limit store does not take the
+// API down with it.
+func RateLimit(limiter *ratelimit.Limiter) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log := logger.WithContext(r.Context())
+			orgID, ok := r.Context().Value(constants.ContextKeyOrganization).(string)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			retryAfter, err := limiter.AllowRequest(r.Context(), orgID)
+			if err != nil {
+				log.Warn("Failed to check the request rate limit", zap.Error(err))
+				next.ServeHTTP(w, r)
+				return
+			}
+			if retryAfter > 0 {
+				log.Warn(fmt.Sprintf("Organization %s exceeded its request rate limit", orgID))
+				fhirror.TooManyRequests(r.Context(), w, retryAfter, "Too many requests, please slow down")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
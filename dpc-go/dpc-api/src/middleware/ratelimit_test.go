@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CMSgov/dpc/api/constants"
+	"github.com/CMSgov/dpc/api/ratelimit"
+	"github.com/go-chi/chi/middleware"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type failingStore struct {
+	*ratelimit.MemoryStore
+}
+
+func (fs failingStore) Take(ctx context.Context, orgID string, limits ratelimit.Limits, now time.Time) (time.Duration, error) {
+	return 0, errors.New("store is down")
+}
+
+type RateLimitTestSuite struct {
+	suite.Suite
+}
+
+func TestRateLimitTestSuite(t *testing.T) {
+	suite.Run(t, new(RateLimitTestSuite))
+}
+
+func (suite *RateLimitTestSuite) serve(limiter *ratelimit.Limiter, orgID string) *http.Response {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "http://www.example.com/Jobs", nil)
+	ctx := context.WithValue(req.Context(), middleware.RequestIDKey, "54321")
+	if orgID != "" {
+		ctx = context.WithValue(ctx, constants.ContextKeyOrganization, orgID)
+	}
+	res := httptest.NewRecorder()
+	RateLimit(limiter)(nextHandler).ServeHTTP(res, req.WithContext(ctx))
+	return res.Result()
+}
+
+func (suite *RateLimitTestSuite) TestRateLimit() {
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), ratelimit.Limits{RequestsPerSecond: 0.5, Burst: 2})
+
+	assert.Equal(suite.T(), http.StatusOK, suite.serve(limiter, "org-1").StatusCode)
+	assert.Equal(suite.T(), http.StatusOK, suite.serve(limiter, "org-1").StatusCode)
+	res := suite.serve(limiter, "org-1")
+	assert.Equal(suite.T(), http.StatusTooManyRequests, res.StatusCode)
+	assert.Equal(suite.T(), "2", res.Header.Get("Retry-After"))
+
+	// other organizations have their own buckets
+	assert.Equal(suite.T(), http.StatusOK, suite.serve(limiter, "org-2").StatusCode)
+}
+
+func (suite *RateLimitTestSuite) TestRateLimitWithoutOrganization() {
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), ratelimit.Limits{RequestsPerSecond: 0.5, Burst: 1})
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(suite.T(), http.StatusOK, suite.serve(limiter, "").StatusCode)
+	}
+}
+
+func (suite *RateLimitTestSuite) TestRateLimitStoreError() {
+	limiter := ratelimit.NewLimiter(failingStore{ratelimit.NewMemoryStore()}, ratelimit.Limits{RequestsPerSecond: 1, Burst: 1})
+
+	assert.Equal(suite.T(), http.StatusOK, suite.serve(limiter, "org-1").StatusCode)
+}
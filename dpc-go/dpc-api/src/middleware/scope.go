@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/CMSgov/dpc/api/auth"
+	"github.com/CMSgov/dpc/api/constants"
+	"github.com/CMSgov/dpc/api/fhirror"
+	"github.com/CMSgov/dpc/api/logger"
+)
+
+// RequireScope middleware rejects requests whose access token was not granted the access on the resource type
+func RequireScope(resource string, access auth.Access) func(next http.Handler) http.Handler {
+	return requireScopes(func(r *http.Request) []string {
+		return []string{resource}
+	}, access)
+}
+
+// RequireExportScopes middleware requires read access on every resource type set by ExportTypesParamCtx
+func RequireExportScopes(next http.Handler) http.Handler {
+	return requireScopes(func(r *http.Request) []string {
+		types, _ := r.Context().Value(constants.ContextKeyResourceTypes).(string)
+		return strings.Split(types, ",")
+	}, auth.Read)(next)
+}
+
+// RequireAnyReadScope middleware requires read access on at least one resource type, for routes such as
+// job status and file downloads that serve data already authorized at export kickoff
+func RequireAnyReadScope(next http.Handler) http.Handler {
+	return requireAnyScope(auth.Read, next)
+}
+
+// RequireAnyWriteScope middleware requires write access on at least one resource type, for routes that change
+// settings of the organization that are not tied to a resource type, such as its webhook
+func RequireAnyWriteScope(next http.Handler) http.Handler {
+	return requireAnyScope(auth.Write, next)
+}
+
+func requireAnyScope(access auth.Access, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scopes, ok := scopesFromContext(w, r)
+		if !ok {
+			return
+		}
+		if !scopes.AllowsAny(access) {
+			logger.WithContext(r.Context()).Error(fmt.Sprintf("Insufficient scope: granted %s", scopes))
+			fhirror.Forbidden(r.Context(), w, fmt.Sprintf("Insufficient scope: a %s scope is required", access))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func requireScopes(resources func(r *http.Request) []string, access auth.Access) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scopes, ok := scopesFromContext(w, r)
+			if !ok {
+				return
+			}
+			for _, resource := range resources(r) {
+				if !scopes.Allows(resource, access) {
+					required := auth.Scope{Resource: resource, Access: access}
+					logger.WithContext(r.Context()).Error(fmt.Sprintf("Insufficient scope: %s required, granted %s", required, scopes))
+					fhirror.Forbidden(r.Context(), w, fmt.Sprintf("Insufficient scope: %s is required", required))
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func scopesFromContext(w http.ResponseWriter, r *http.Request) (auth.Scopes, bool) {
+	scopes, ok := r.Context().Value(constants.ContextKeyScopes).(auth.Scopes)
+	if !ok {
+		logger.WithContext(r.Context()).Error("Scopes not found in context")
+		fhirror.GenericServerIssue(r.Context(), w)
+	}
+	return scopes, ok
+}
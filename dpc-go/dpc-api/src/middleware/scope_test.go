@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CMSgov/dpc/api/auth"
+	"github.com/CMSgov/dpc/api/constants"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ScopeTestSuite struct {
+	suite.Suite
+}
+
+func TestScopeTestSuite(t *testing.T) {
+	suite.Run(t, new(ScopeTestSuite))
+}
+
+func (suite *ScopeTestSuite) serve(h func(http.Handler) http.Handler, scope string, types string) *http.Response {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "http://www.example.com/Group/some-id/$export", nil)
+	ctx := context.WithValue(req.Context(), constants.ContextKeyScopes, auth.ParseScopes(scope))
+	ctx = context.WithValue(ctx, constants.ContextKeyResourceTypes, types)
+	res := httptest.NewRecorder()
+	h(nextHandler).ServeHTTP(res, req.WithContext(ctx))
+	return res.Result()
+}
+
+func (suite *ScopeTestSuite) TestRequireScope() {
+	res := suite.serve(RequireScope("Group", auth.Read), "dpcv2-api system/Group.read", "")
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+
+	res = suite.serve(RequireScope("Group", auth.Write), "dpcv2-api system/Group.read", "")
+	assert.Equal(suite.T(), http.StatusForbidden, res.StatusCode)
+	b, _ := ioutil.ReadAll(res.Body)
+	assert.Contains(suite.T(), string(b), "OperationOutcome")
+	assert.Contains(suite.T(), string(b), "Insufficient scope: system/Group.write is required")
+}
+
+func (suite *ScopeTestSuite) TestRequireScopeFullAccess() {
+	res := suite.serve(RequireScope("Group", auth.Write), "dpcv2-api", "")
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+}
+
+func (suite *ScopeTestSuite) TestRequireExportScopes() {
+	res := suite.serve(RequireExportScopes, "system/Patient.read system/Coverage.read", "Patient,Coverage")
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+
+	res = suite.serve(RequireExportScopes, "system/Patient.read system/Coverage.read", constants.AllResources)
+	assert.Equal(suite.T(), http.StatusForbidden, res.StatusCode)
+	b, _ := ioutil.ReadAll(res.Body)
+	assert.Contains(suite.T(), string(b), "system/ExplanationOfBenefit.read")
+}
+
+func (suite *ScopeTestSuite) TestRequireAnyReadScope() {
+	res := suite.serve(RequireAnyReadScope, "system/Coverage.read", "")
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+
+	res = suite.serve(RequireAnyReadScope, "system/Group.write", "")
+	assert.Equal(suite.T(), http.StatusForbidden, res.StatusCode)
+}
+
+func (suite *ScopeTestSuite) TestRequireAnyWriteScope() {
+	res := suite.serve(RequireAnyWriteScope, "system/Group.write", "")
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+
+	res = suite.serve(RequireAnyWriteScope, "system/*.*", "")
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+
+	res = suite.serve(RequireAnyWriteScope, "system/Group.read system/Patient.read", "")
+	assert.Equal(suite.T(), http.StatusForbidden, res.StatusCode)
+	b, _ := ioutil.ReadAll(res.Body)
+	assert.Contains(suite.T(), string(b), "a write scope is required")
+}
+
+func (suite *ScopeTestSuite) TestMissingScopes() {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "http://www.example.com/Jobs/1", nil)
+	res := httptest.NewRecorder()
+	RequireAnyReadScope(nextHandler).ServeHTTP(res, req)
+	assert.Equal(suite.T(), http.StatusInternalServerError, res.Result().StatusCode)
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var typeFilterQueryStart = regexp.MustCompile(`^[A-Za-z]+\?`)
+
+var serviceDatePattern = regexp.MustCompile(`^(eq|ge|gt|le|lt)(\d{4}-\d{2}-\d{2})$`)
+
+// claimTypes are the BFD claim types that can be requested with the ExplanationOfBenefit type search parameter
+var claimTypes = map[string]bool{
+	"carrier":    true,
+	"dme":        true,
+	"hha":        true,
+	"hospice":    true,
+	"inpatient":  true,
+	"outpatient": true,
+	"snf":        true,
+}
+
+// typeFilterParams is the allow-list of BFD search parameters per resource type, with a validator for each value
+var typeFilterParams = map[string]map[string]func(string) bool{
+	"ExplanationOfBenefit": {
+		"type":         validClaimTypes,
+		"service-date": validServiceDate,
+	},
+}
+
+func validClaimTypes(value string) bool {
+	for _, t := range strings.Split(value, ",") {
+		if !claimTypes[t] {
+			return false
+		}
+	}
+	return true
+}
+
+func validServiceDate(value string) bool {
+	m := serviceDatePattern.FindStringSubmatch(value)
+	if m == nil {
+		return false
+	}
+	_, err := time.Parse("2006-01-02", m[2])
+	return err == nil
+}
+
+// parseTypeFilters validates the _typeFilter values of an export against the requested types. It returns the
+// filters as a comma separated list of queries with their values encoded, or a message describing the first
+// invalid filter. A resource type can have several queries, a resource matching any of them is exported.
+func parseTypeFilters(values []string, types string) (string, string) {
+	requested := make(map[string]bool)
+	for _, t := range strings.Split(types, ",") {
+		requested[t] = true
+	}
+
+	filters := make(map[string]bool)
+	for _, value := range values {
+		for _, query := range splitTypeFilter(value) {
+			parts := strings.SplitN(query, "?", 2)
+			if len(parts) != 2 || parts[1] == "" {
+				return "", fmt.Sprintf("Invalid _typeFilter %s, must be in the form ResourceType?param=value", query)
+			}
+			resourceType := parts[0]
+			if !requested[resourceType] {
+				return "", fmt.Sprintf("Invalid _typeFilter %s, %s is not a requested resource type", query, resourceType)
+			}
+			params, err := url.ParseQuery(parts[1])
+			if err != nil {
+				return "", fmt.Sprintf("Invalid _typeFilter %s", query)
+			}
+			for name, vals := range params {
+				validate, ok := typeFilterParams[resourceType][name]
+				if !ok {
+					return "", fmt.Sprintf("Unsupported _typeFilter parameter %s for %s", name, resourceType)
+				}
+				for _, v := range vals {
+					if !validate(v) {
+						return "", fmt.Sprintf("Invalid value %s for _typeFilter parameter %s", v, name)
+					}
+				}
+			}
+			filters[fmt.Sprintf("%s?%s", resourceType, params.Encode())] = true
+		}
+	}
+
+	queries := make([]string, 0, len(filters))
+	for q := range filters {
+		queries = append(queries, q)
+	}
+	sort.Strings(queries)
+	return strings.Join(queries, ","), ""
+}
+
+// splitTypeFilter splits a _typeFilter value into its queries. Queries are comma separated, but commas are also
+// allowed within a query's parameter values, so a part only starts a new query when it begins with a resource type.
+func splitTypeFilter(value string) []string {
+	queries := make([]string, 0)
+	for _, part := range strings.Split(value, ",") {
+		if len(queries) > 0 && !typeFilterQueryStart.MatchString(part) {
+			queries[len(queries)-1] += "," + part
+			continue
+		}
+		queries = append(queries, part)
+	}
+	return queries
+}
@@ -22,6 +22,13 @@ type BatchInfo struct {
 	SubmitTime        time.Time  `json:"submitTime"`
 	CompleteTime      *time.Time `json:"completeTime"`
 	RequestURL        string     `json:"requestURL"`
+	// ExpiresAt is when the files of a finished batch are purged under the retention policy of its organization
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// QueuePosition and EstimatedWaitSeconds are only set for queued batches
+	QueuePosition        *int `json:"queuePosition,omitempty"`
+	EstimatedWaitSeconds *int `json:"estimatedWaitSeconds,omitempty"`
+	// EstimatedSecondsRemaining is how long until an unfinished batch completes, estimated from recent throughput
+	EstimatedSecondsRemaining *int `json:"estimatedSecondsRemaining,omitempty"`
 }
 
 // BatchFile is a struct to hold batch file information
@@ -33,6 +40,16 @@ type BatchFile struct {
 	Count        int    `json:"count"`
 	Checksum     string `json:"checksum"`
 	FileLength   int    `json:"fileLength"`
+	// CompressedChecksum and CompressedFileLength are only set for files stored gzipped
+	CompressedChecksum   string `json:"compressedChecksum,omitempty"`
+	CompressedFileLength int    `json:"compressedFileLength,omitempty"`
+	// PurgedAt is set once the file was deleted after its job expired
+	PurgedAt *time.Time `json:"purgedAt,omitempty"`
+}
+
+// Compressed reports whether the file is stored gzipped
+func (f *BatchFile) Compressed() bool {
+	return f.CompressedChecksum != ""
 }
 
 // FormOutputFileName is a helper function to construct the file name
@@ -57,3 +74,30 @@ type Status struct {
 	Error               []Output                 `json:"error"`
 	Extension           []map[string]interface{} `json:"extension"`
 }
+
+// JobSummary is a struct to hold a job rolled up from its batches
+type JobSummary struct {
+	JobID         string     `json:"jobID"`
+	Status        string     `json:"status"`
+	SubmitTime    time.Time  `json:"submitTime"`
+	CompleteTime  *time.Time `json:"completeTime,omitempty"`
+	ResourceTypes []string   `json:"resourceTypes"`
+	PatientCount  int        `json:"patientCount"`
+	RequestURL    string     `json:"requestURL"`
+	URL           string     `json:"url,omitempty"`
+	ScheduleID    string     `json:"scheduleID,omitempty"`
+}
+
+// JobList is a struct to hold a page of job summaries
+type JobList struct {
+	Jobs    []JobSummary `json:"jobs"`
+	HasMore bool         `json:"hasMore"`
+}
+
+// JobListResponse is the body returned when listing jobs
+type JobListResponse struct {
+	Jobs  []JobSummary `json:"jobs"`
+	Page  int          `json:"page"`
+	Count int          `json:"count"`
+	Next  string       `json:"next,omitempty"`
+}
@@ -19,8 +19,9 @@ type Organization struct {
 
 // GroupContainer is a struct that represents a minimum amount of info from attribution
 type GroupContainer struct {
-	ID   string `json:"id"`
-	Info Group  `json:"info"`
+	ID      string `json:"id"`
+	Version int    `json:"version"`
+	Info    Group  `json:"info"`
 }
 
 // Group is a struct that represents the filtered down fhir.Group
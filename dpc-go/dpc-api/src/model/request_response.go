@@ -12,6 +12,15 @@ type ExportRequest struct {
 	OutputFormat string   `json:"outputFormat"`
 	Since        string   `json:"since,omitempty"`
 	Type         string   `json:"type"`
+	TypeFilter   string   `json:"typeFilter,omitempty"`
+	Elements     string   `json:"elements,omitempty"`
 	MBIs         []string `json:"mbis"`
 	ProviderNPI  string   `json:"provider"`
+	Warnings     []string `json:"warnings,omitempty"`
+	WebhookURL   string   `json:"webhookURL,omitempty"`
+	// GroupVersion and IdempotencyKey let attribution return the existing job of a repeated kickoff
+	GroupVersion   int    `json:"groupVersion"`
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+	// ExistingOnly asks attribution for the job of a repeated kickoff without starting a new one
+	ExistingOnly bool `json:"existingOnly,omitempty"`
 }
@@ -0,0 +1,116 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type usage struct {
+	day      time.Time
+	jobs     int
+	patients int
+}
+
+// MemoryStore keeps limit state in the memory of a single API instance
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	usage   map[string]*usage
+	limits  map[string]Limits
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+		usage:   make(map[string]*usage),
+		limits:  make(map[string]Limits),
+	}
+}
+
+// Take removes a token from the organization's request bucket
+func (ms *MemoryStore) Take(ctx context.Context, orgID string, limits Limits, now time.Time) (time.Duration, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	b, ok := ms.buckets[orgID]
+	if !ok {
+		b = &bucket{tokens: float64(limits.Burst), updated: now}
+		ms.buckets[orgID] = b
+	}
+	b.tokens = refill(b.tokens, b.updated, limits, now)
+	b.updated = now
+	if b.tokens < 1 {
+		return wait(b.tokens, limits), nil
+	}
+	b.tokens--
+	return 0, nil
+}
+
+// Consume counts a job against the organization's quota for the day
+func (ms *MemoryStore) Consume(ctx context.Context, orgID string, limits Limits, patients int, now time.Time) (bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	u, ok := ms.usage[orgID]
+	if !ok || !u.day.Equal(day(now)) {
+		u = &usage{day: day(now)}
+		ms.usage[orgID] = u
+	}
+	if !withinQuota(u.jobs, u.patients, limits, patients) {
+		return false, nil
+	}
+	u.jobs++
+	u.patients += patients
+	return true, nil
+}
+
+// Release takes a job back off the organization's usage for the day
+func (ms *MemoryStore) Release(ctx context.Context, orgID string, patients int, now time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	u, ok := ms.usage[orgID]
+	if !ok || !u.day.Equal(day(now)) {
+		return nil
+	}
+	if u.jobs > 0 {
+		u.jobs--
+	}
+	u.patients -= patients
+	if u.patients < 0 {
+		u.patients = 0
+	}
+	return nil
+}
+
+// Limits returns the limits set for the organization
+func (ms *MemoryStore) Limits(ctx context.Context, orgID string) (*Limits, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	limits, ok := ms.limits[orgID]
+	if !ok {
+		return nil, nil
+	}
+	return &limits, nil
+}
+
+// SetLimits sets the limits of the organization
+func (ms *MemoryStore) SetLimits(ctx context.Context, orgID string, limits *Limits) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if limits == nil {
+		delete(ms.limits, orgID)
+	} else {
+		ms.limits[orgID] = *limits
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/CMSgov/dpc/api/logger"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/log/zapadapter"
+	"github.com/jackc/pgx/stdlib"
+	"github.com/pkg/errors"
+)
+
+const sqlFlavor = sqlbuilder.PostgreSQL
+
+// PostgresStore keeps limit state in Postgres, so every instance of the API enforces the same limits. Each check
+// locks the organization's row, so concurrent requests of an organization are counted one at a time.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore creates a PostgresStore over the database holding the rate limit tables
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{
+		db,
+	}
+}
+
+func openPostgres(dbURL string) (*sql.DB, error) {
+	log := logger.WithContext(context.Background())
+	dc := stdlib.DriverConfig{
+		ConnConfig: pgx.ConnConfig{
+			Logger:   zapadapter.NewLogger(log),
+			LogLevel: pgx.LogLevelError,
+		},
+	}
+	stdlib.RegisterDriverConfig(&dc)
+
+	db, err := sql.Open("pgx", dc.ConnectionString(dbURL))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open a connection to the rate limit db")
+	}
+	if err := db.Ping(); err != nil {
+		return nil, errors.Wrap(err, "could not ping the rate limit db")
+	}
+	return db, nil
+}
+
+// Take removes a token from the organization's request bucket
+func (ps *PostgresStore) Take(ctx context.Context, orgID string, limits Limits, now time.Time) (time.Duration, error) {
+	var retryAfter time.Duration
+	err := ps.inTx(ctx, func(tx *sql.Tx) error {
+		ib := sqlFlavor.NewInsertBuilder()
+		ib.InsertInto("rate_limit_bucket").
+			Cols("organization_id", "tokens", "updated_at").
+			Values(orgID, limits.Burst, now).
+			SQL("ON CONFLICT (organization_id) DO NOTHING")
+		q, args := ib.Build()
+		if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+			return err
+		}
+
+		sb := sqlFlavor.NewSelectBuilder()
+		sb.Select("tokens", "updated_at").
+			From("rate_limit_bucket").
+			Where(sb.Equal("organization_id", orgID)).
+			ForUpdate()
+		q, args = sb.Build()
+		var tokens float64
+		var updated time.Time
+		if err := tx.QueryRowContext(ctx, q, args...).Scan(&tokens, &updated); err != nil {
+			return err
+		}
+
+		tokens = refill(tokens, updated, limits, now)
+		if tokens < 1 {
+			retryAfter = wait(tokens, limits)
+		} else {
+			tokens--
+		}
+
+		ub := sqlFlavor.NewUpdateBuilder()
+		ub.Update("rate_limit_bucket").
+			Set(ub.Assign("tokens", tokens), ub.Assign("updated_at", now)).
+			Where(ub.Equal("organization_id", orgID))
+		q, args = ub.Build()
+		_, err := tx.ExecContext(ctx, q, args...)
+		return err
+	})
+	return retryAfter, err
+}
+
+// Consume counts a job against the organization's quota for the day
+func (ps *PostgresStore) Consume(ctx context.Context, orgID string, limits Limits, patients int, now time.Time) (bool, error) {
+	today := day(now)
+	allowed := false
+	err := ps.inTx(ctx, func(tx *sql.Tx) error {
+		ib := sqlFlavor.NewInsertBuilder()
+		ib.InsertInto("export_quota_usage").
+			Cols("organization_id", "day", "jobs", "patients").
+			Values(orgID, today, 0, 0).
+			SQL("ON CONFLICT (organization_id) DO NOTHING")
+		q, args := ib.Build()
+		if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+			return err
+		}
+
+		sb := sqlFlavor.NewSelectBuilder()
+		sb.Select("day", "jobs", "patients").
+			From("export_quota_usage").
+			Where(sb.Equal("organization_id", orgID)).
+			ForUpdate()
+		q, args = sb.Build()
+		var usedDay time.Time
+		var jobs, used int
+		if err := tx.QueryRowContext(ctx, q, args...).Scan(&usedDay, &jobs, &used); err != nil {
+			return err
+		}
+		if !day(usedDay).Equal(today) {
+			jobs, used = 0, 0
+		}
+		if !withinQuota(jobs, used, limits, patients) {
+			return nil
+		}
+		allowed = true
+
+		ub := sqlFlavor.NewUpdateBuilder()
+		ub.Update("export_quota_usage").
+			Set(ub.Assign("day", today), ub.Assign("jobs", jobs+1), ub.Assign("patients", used+patients)).
+			Where(ub.Equal("organization_id", orgID))
+		q, args = ub.Build()
+		_, err := tx.ExecContext(ctx, q, args...)
+		return err
+	})
+	return allowed, err
+}
+
+// Release takes a job back off the organization's usage for the day
+func (ps *PostgresStore) Release(ctx context.Context, orgID string, patients int, now time.Time) error {
+	ub := sqlFlavor.NewUpdateBuilder()
+	ub.Update("export_quota_usage").
+		Set("jobs = GREATEST(jobs - 1, 0)", "patients = GREATEST(patients - "+ub.Var(patients)+", 0)").
+		Where(ub.Equal("organization_id", orgID), ub.Equal("day", day(now)))
+	q, args := ub.Build()
+	_, err := ps.db.ExecContext(ctx, q, args...)
+	return err
+}
+
+// Limits returns the limits set for the organization
+func (ps *PostgresStore) Limits(ctx context.Context, orgID string) (*Limits, error) {
+	sb := sqlFlavor.NewSelectBuilder()
+	sb.Select("requests_per_second", "burst", "daily_jobs", "daily_patients").
+		From("organization_rate_limit").
+		Where(sb.Equal("organization_id", orgID))
+	q, args := sb.Build()
+
+	limits := new(Limits)
+	err := ps.db.QueryRowContext(ctx, q, args...).Scan(&limits.RequestsPerSecond, &limits.Burst, &limits.DailyJobs, &limits.DailyPatients)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return limits, nil
+}
+
+// SetLimits sets the limits of the organization
+func (ps *PostgresStore) SetLimits(ctx context.Context, orgID string, limits *Limits) error {
+	if limits == nil {
+		db := sqlFlavor.NewDeleteBuilder()
+		db.DeleteFrom("organization_rate_limit").
+			Where(db.Equal("organization_id", orgID))
+		q, args := db.Build()
+		_, err := ps.db.ExecContext(ctx, q, args...)
+		return err
+	}
+
+	ib := sqlFlavor.NewInsertBuilder()
+	ib.InsertInto("organization_rate_limit").
+		Cols("organization_id", "requests_per_second", "burst", "daily_jobs", "daily_patients", "updated_at").
+		Values(orgID, limits.RequestsPerSecond, limits.Burst, limits.DailyJobs, limits.DailyPatients, time.Now()).
+		SQL("ON CONFLICT (organization_id) DO UPDATE SET requests_per_second = EXCLUDED.requests_per_second, " +
+			"burst = EXCLUDED.burst, daily_jobs = EXCLUDED.daily_jobs, daily_patients = EXCLUDED.daily_patients, " +
+			"updated_at = EXCLUDED.updated_at")
+	q, args := ib.Build()
+	_, err := ps.db.ExecContext(ctx, q, args...)
+	return err
+}
+
+func (ps *PostgresStore) inTx(ctx context.Context, f func(tx *sql.Tx) error) error {
+	tx, err := ps.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,175 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type PostgresStoreTestSuite struct {
+	suite.Suite
+	mock  sqlmock.Sqlmock
+	store *PostgresStore
+	now   time.Time
+}
+
+func TestPostgresStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(PostgresStoreTestSuite))
+}
+
+func (suite *PostgresStoreTestSuite) SetupTest() {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		suite.T().Fatalf("failed to create sqlmock: %s", err)
+	}
+	suite.mock = mock
+	suite.store = NewPostgresStore(db)
+	suite.now = time.Date(2021, 6, 1, 18, 0, 0, 0, time.UTC)
+}
+
+func (suite *PostgresStoreTestSuite) expectBucket(tokens float64, updated time.Time) {
+	suite.mock.ExpectBegin()
+	suite.mock.ExpectExec(`INSERT INTO rate_limit_bucket \(organization_id, tokens, updated_at\) VALUES \(\$1, \$2, \$3\) ON CONFLICT \(organization_id\) DO NOTHING`).
+		WithArgs("org-1", 3, suite.now).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.mock.ExpectQuery(`SELECT tokens, updated_at FROM rate_limit_bucket WHERE organization_id = \$1 FOR UPDATE`).
+		WithArgs("org-1").
+		WillReturnRows(sqlmock.NewRows([]string{"tokens", "updated_at"}).AddRow(tokens, updated))
+}
+
+func (suite *PostgresStoreTestSuite) TestTake() {
+	limits := Limits{RequestsPerSecond: 2, Burst: 3}
+	suite.expectBucket(0.5, suite.now.Add(-time.Second))
+	suite.mock.ExpectExec(`UPDATE rate_limit_bucket SET tokens = \$1, updated_at = \$2 WHERE organization_id = \$3`).
+		WithArgs(1.5, suite.now, "org-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.mock.ExpectCommit()
+
+	wait, err := suite.store.Take(context.Background(), "org-1", limits, suite.now)
+
+	assert.NoError(suite.T(), err)
+	assert.Zero(suite.T(), wait)
+	assert.NoError(suite.T(), suite.mock.ExpectationsWereMet())
+}
+
+func (suite *PostgresStoreTestSuite) TestTakeEmpty() {
+	limits := Limits{RequestsPerSecond: 2, Burst: 3}
+	suite.expectBucket(0.5, suite.now)
+	suite.mock.ExpectExec(`UPDATE rate_limit_bucket`).
+		WithArgs(0.5, suite.now, "org-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.mock.ExpectCommit()
+
+	wait, err := suite.store.Take(context.Background(), "org-1", limits, suite.now)
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 250*time.Millisecond, wait)
+	assert.NoError(suite.T(), suite.mock.ExpectationsWereMet())
+}
+
+func (suite *PostgresStoreTestSuite) expectUsage(day time.Time, jobs int, patients int) {
+	suite.mock.ExpectBegin()
+	suite.mock.ExpectExec(`INSERT INTO export_quota_usage \(organization_id, day, jobs, patients\) VALUES \(\$1, \$2, \$3, \$4\) ON CONFLICT \(organization_id\) DO NOTHING`).
+		WithArgs("org-1", day, 0, 0).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.mock.ExpectQuery(`SELECT day, jobs, patients FROM export_quota_usage WHERE organization_id = \$1 FOR UPDATE`).
+		WithArgs("org-1").
+		WillReturnRows(sqlmock.NewRows([]string{"day", "jobs", "patients"}).AddRow(day, jobs, patients))
+}
+
+func (suite *PostgresStoreTestSuite) TestConsume() {
+	today := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	suite.expectUsage(today, 1, 40)
+	suite.mock.ExpectExec(`UPDATE export_quota_usage SET day = \$1, jobs = \$2, patients = \$3 WHERE organization_id = \$4`).
+		WithArgs(today, 2, 100, "org-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.mock.ExpectCommit()
+
+	ok, err := suite.store.Consume(context.Background(), "org-1", Limits{DailyJobs: 2, DailyPatients: 100}, 60, suite.now)
+
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+	assert.NoError(suite.T(), suite.mock.ExpectationsWereMet())
+}
+
+func (suite *PostgresStoreTestSuite) TestRelease() {
+	today := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	suite.mock.ExpectExec(`UPDATE export_quota_usage SET jobs = GREATEST\(jobs - 1, 0\), patients = GREATEST\(patients - \$1, 0\) WHERE organization_id = \$2 AND day = \$3`).
+		WithArgs(60, "org-1", today).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := suite.store.Release(context.Background(), "org-1", 60, suite.now)
+
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), suite.mock.ExpectationsWereMet())
+}
+
+func (suite *PostgresStoreTestSuite) TestConsumeExceeded() {
+	today := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	suite.expectUsage(today, 2, 40)
+	suite.mock.ExpectCommit()
+
+	ok, err := suite.store.Consume(context.Background(), "org-1", Limits{DailyJobs: 2}, 1, suite.now)
+
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+	assert.NoError(suite.T(), suite.mock.ExpectationsWereMet())
+}
+
+func (suite *PostgresStoreTestSuite) TestConsumeNewDay() {
+	today := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	suite.mock.ExpectBegin()
+	suite.mock.ExpectExec(`INSERT INTO export_quota_usage`).WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.mock.ExpectQuery(`SELECT day, jobs, patients FROM export_quota_usage`).
+		WillReturnRows(sqlmock.NewRows([]string{"day", "jobs", "patients"}).AddRow(today.AddDate(0, 0, -1), 2, 100))
+	suite.mock.ExpectExec(`UPDATE export_quota_usage`).
+		WithArgs(today, 1, 10, "org-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.mock.ExpectCommit()
+
+	ok, err := suite.store.Consume(context.Background(), "org-1", Limits{DailyJobs: 2, DailyPatients: 100}, 10, suite.now)
+
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+	assert.NoError(suite.T(), suite.mock.ExpectationsWereMet())
+}
+
+const expectedLimitsQuery = `SELECT requests_per_second, burst, daily_jobs, daily_patients FROM organization_rate_limit WHERE organization_id = \$1`
+
+func (suite *PostgresStoreTestSuite) TestLimits() {
+	suite.mock.ExpectQuery(expectedLimitsQuery).WithArgs("org-1").
+		WillReturnRows(sqlmock.NewRows([]string{"requests_per_second", "burst", "daily_jobs", "daily_patients"}).AddRow(5.0, 10, 20, 3000))
+
+	limits, err := suite.store.Limits(context.Background(), "org-1")
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), &Limits{RequestsPerSecond: 5, Burst: 10, DailyJobs: 20, DailyPatients: 3000}, limits)
+}
+
+func (suite *PostgresStoreTestSuite) TestLimitsDefault() {
+	suite.mock.ExpectQuery(expectedLimitsQuery).WithArgs("org-1").WillReturnError(sql.ErrNoRows)
+
+	limits, err := suite.store.Limits(context.Background(), "org-1")
+
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), limits)
+}
+
+func (suite *PostgresStoreTestSuite) TestSetLimits() {
+	suite.mock.ExpectExec(`INSERT INTO organization_rate_limit \(organization_id, requests_per_second, burst, daily_jobs, daily_patients, updated_at\) `+
+		`VALUES \(\$1, \$2, \$3, \$4, \$5, \$6\) ON CONFLICT \(organization_id\) DO UPDATE SET`).
+		WithArgs("org-1", 5.0, 10, 20, 3000, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.mock.ExpectExec(`DELETE FROM organization_rate_limit WHERE organization_id = \$1`).
+		WithArgs("org-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(suite.T(), suite.store.SetLimits(context.Background(), "org-1", &Limits{RequestsPerSecond: 5, Burst: 10, DailyJobs: 20, DailyPatients: 3000}))
+	assert.NoError(suite.T(), suite.store.SetLimits(context.Background(), "org-1", nil))
+	assert.NoError(suite.T(), suite.mock.ExpectationsWereMet())
+}
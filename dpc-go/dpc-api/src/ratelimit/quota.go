@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/CMSgov/dpc/api/client"
+	"github.com/CMSgov/dpc/api/constants"
+	"github.com/CMSgov/dpc/api/logger"
+	"github.com/CMSgov/dpc/api/model"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// QuotaExceededError is returned when an export would exceed the organization's daily quota
+type QuotaExceededError struct {
+	RetryAfter time.Duration
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("daily export quota exceeded, resets in %s", e.RetryAfter.Round(time.Second))
+}
+
+// QuotaJobClient is a JobClient that counts every new export job against the daily quota of its organization before
+// starting it. A repeated kickoff that returns the job of an earlier one is not counted, even once the quota is used
+// up. A failed kickoff still counts. Runs of export schedules are enqueued by attribution without passing through the
+// API, so they are exempt from the quota; they are bounded by exportSchedules.maxPerOrganization instead.
+type QuotaJobClient struct {
+	client.JobClient
+	limiter *Limiter
+}
+
+// NewQuotaJobClient wraps the job client to enforce export quotas
+func NewQuotaJobClient(jc client.JobClient, limiter *Limiter) *QuotaJobClient {
+	return &QuotaJobClient{
+		jc,
+		limiter,
+	}
+}
+
+// Export starts the export when the organization has quota left, or returns a QuotaExceededError
+func (qc *QuotaJobClient) Export(ctx context.Context, request model.ExportRequest) ([]byte, bool, error) {
+	log := logger.WithContext(ctx)
+	orgID, _ := ctx.Value(constants.ContextKeyOrganization).(string)
+	retryAfter, err := qc.limiter.AllowExport(ctx, orgID, len(request.MBIs))
+	if err != nil {
+		log.Warn("Failed to check the export quota", zap.Error(err))
+	}
+	if retryAfter > 0 {
+		return qc.existingExport(ctx, orgID, request, retryAfter)
+	}
+
+	jobID, duplicate, err := qc.JobClient.Export(ctx, request)
+	if err == nil && duplicate {
+		if err := qc.limiter.RefundExport(ctx, orgID, len(request.MBIs)); err != nil {
+			log.Warn("Failed to refund the export quota", zap.Error(err))
+		}
+	}
+	return jobID, duplicate, err
+}
+
+// existingExport returns the job of a repeated kickoff without counting it, as the quota is used up
+func (qc *QuotaJobClient) existingExport(ctx context.Context, orgID string, request model.ExportRequest, retryAfter time.Duration) ([]byte, bool, error) {
+	log := logger.WithContext(ctx)
+	request.ExistingOnly = true
+	jobID, duplicate, err := qc.JobClient.Export(ctx, request)
+	if err == nil && duplicate {
+		return jobID, true, nil
+	}
+	if errors.Is(err, client.ErrIdempotencyKeyReused) {
+		return nil, false, err
+	}
+	if err != nil && !errors.Is(err, client.ErrNoExistingJob) {
+		log.Warn("Failed to find an existing job for the export", zap.Error(err))
+	}
+	log.Warn(fmt.Sprintf("Organization %s exceeded its daily export quota", orgID))
+	return nil, false, &QuotaExceededError{RetryAfter: retryAfter}
+}
@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/CMSgov/dpc/api/client"
+	"github.com/CMSgov/dpc/api/constants"
+	"github.com/CMSgov/dpc/api/model"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockJobClient struct {
+	mock.Mock
+}
+
+func (mc *MockJobClient) Status(ctx context.Context, jobID string) ([]byte, error) {
+	args := mc.Called(ctx, jobID)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (mc *MockJobClient) WaitForStatus(ctx context.Context, jobID string, wait time.Duration) ([]byte, error) {
+	args := mc.Called(ctx, jobID, wait)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (mc *MockJobClient) Export(ctx context.Context, request model.ExportRequest) ([]byte, bool, error) {
+	args := mc.Called(ctx, request)
+	return args.Get(0).([]byte), args.Bool(1), args.Error(2)
+}
+
+func (mc *MockJobClient) Cancel(ctx context.Context, jobID string) error {
+	args := mc.Called(ctx, jobID)
+	return args.Error(0)
+}
+
+func (mc *MockJobClient) List(ctx context.Context, query url.Values) ([]byte, error) {
+	args := mc.Called(ctx, query)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func TestQuotaJobClientExport(t *testing.T) {
+	jc := new(MockJobClient)
+	jc.On("Export", mock.Anything, mock.MatchedBy(func(er model.ExportRequest) bool {
+		return !er.ExistingOnly
+	})).Return([]byte("job-1"), false, nil)
+	jc.On("Export", mock.Anything, mock.MatchedBy(func(er model.ExportRequest) bool {
+		return er.ExistingOnly
+	})).Return([]byte(nil), false, client.ErrNoExistingJob)
+	qc := NewQuotaJobClient(jc, NewLimiter(NewMemoryStore(), Limits{RequestsPerSecond: 1, Burst: 1, DailyPatients: 3}))
+	ctx := context.WithValue(context.Background(), constants.ContextKeyOrganization, "org-1")
+
+	b, _, err := qc.Export(ctx, model.ExportRequest{MBIs: []string{"1", "2"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "job-1", string(b))
+
+	_, _, err = qc.Export(ctx, model.ExportRequest{MBIs: []string{"3", "4"}})
+	var quotaErr *QuotaExceededError
+	assert.True(t, errors.As(err, &quotaErr))
+	assert.True(t, quotaErr.RetryAfter > 0 && quotaErr.RetryAfter <= 24*time.Hour)
+
+	// other organizations have their own quota
+	ctx = context.WithValue(context.Background(), constants.ContextKeyOrganization, "org-2")
+	_, _, err = qc.Export(ctx, model.ExportRequest{MBIs: []string{"3", "4"}})
+	assert.NoError(t, err)
+}
+
+func TestQuotaJobClientExportDuplicate(t *testing.T) {
+	jc := new(MockJobClient)
+	jc.On("Export", mock.Anything, mock.Anything).Return([]byte("job-1"), true, nil)
+	limiter := NewLimiter(NewMemoryStore(), Limits{RequestsPerSecond: 1, Burst: 1, DailyJobs: 1})
+	qc := NewQuotaJobClient(jc, limiter)
+	ctx := context.WithValue(context.Background(), constants.ContextKeyOrganization, "org-1")
+
+	// a repeated kickoff is refunded, so it leaves the quota untouched
+	for i := 0; i < 3; i++ {
+		b, duplicate, err := qc.Export(ctx, model.ExportRequest{MBIs: []string{"1"}, IdempotencyKey: "retry-1"})
+		assert.NoError(t, err)
+		assert.True(t, duplicate)
+		assert.Equal(t, "job-1", string(b))
+	}
+	retryAfter, err := limiter.AllowExport(ctx, "org-1", 1)
+	assert.NoError(t, err)
+	assert.Zero(t, retryAfter)
+
+	// with the quota used up, a repeated kickoff still gets its job
+	b, duplicate, err := qc.Export(ctx, model.ExportRequest{MBIs: []string{"1"}, IdempotencyKey: "retry-1"})
+	assert.NoError(t, err)
+	assert.True(t, duplicate)
+	assert.Equal(t, "job-1", string(b))
+	jc.AssertCalled(t, "Export", mock.Anything, mock.MatchedBy(func(er model.ExportRequest) bool {
+		return er.ExistingOnly && er.IdempotencyKey == "retry-1"
+	}))
+}
+
+func TestQuotaJobClientExportIdempotencyKeyReused(t *testing.T) {
+	jc := new(MockJobClient)
+	jc.On("Export", mock.Anything, mock.Anything).Return([]byte(nil), false, client.ErrIdempotencyKeyReused)
+	qc := NewQuotaJobClient(jc, NewLimiter(NewMemoryStore(), Limits{RequestsPerSecond: 1, Burst: 1, DailyJobs: 1}))
+	ctx := context.WithValue(context.Background(), constants.ContextKeyOrganization, "org-1")
+
+	for i := 0; i < 2; i++ {
+		_, _, err := qc.Export(ctx, model.ExportRequest{MBIs: []string{"1"}, IdempotencyKey: "retry-1"})
+		assert.ErrorIs(t, err, client.ErrIdempotencyKeyReused)
+	}
+}
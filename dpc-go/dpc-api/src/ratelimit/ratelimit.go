@@ -0,0 +1,172 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/CMSgov/dpc/api/conf"
+	"github.com/pkg/errors"
+)
+
+// Limits are the request rate and daily export quotas of an organization. A daily quota of 0 is unlimited.
+type Limits struct {
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	Burst             int     `json:"burst"`
+	DailyJobs         int     `json:"dailyJobs"`
+	DailyPatients     int     `json:"dailyPatients"`
+}
+
+// Validate checks that the limits can be enforced
+func (l Limits) Validate() error {
+	if l.RequestsPerSecond <= 0 || math.IsInf(l.RequestsPerSecond, 0) || math.IsNaN(l.RequestsPerSecond) {
+		return errors.New("requestsPerSecond must be more than 0")
+	}
+	if l.Burst < 1 {
+		return errors.New("burst must be 1 or more")
+	}
+	if l.DailyJobs < 0 || l.DailyPatients < 0 {
+		return errors.New("dailyJobs and dailyPatients must be 0 or more")
+	}
+	return nil
+}
+
+// Store keeps the request buckets, export usage and limit overrides of organizations
+type Store interface {
+	// Take removes a token from the organization's request bucket, returning how long until one is available when it
+	// is empty
+	Take(ctx context.Context, orgID string, limits Limits, now time.Time) (time.Duration, error)
+	// Consume counts a job of the given number of patients against the organization's quota for the day of now,
+	// returning false without counting it when it would exceed the quota
+	Consume(ctx context.Context, orgID string, limits Limits, patients int, now time.Time) (bool, error)
+	// Release takes a job of the given number of patients back off the organization's usage for the day of now
+	Release(ctx context.Context, orgID string, patients int, now time.Time) error
+	// Limits returns the limits set for the organization, or nil when it uses the defaults
+	Limits(ctx context.Context, orgID string) (*Limits, error)
+	// SetLimits sets the limits of the organization, or resets it to the defaults when nil
+	SetLimits(ctx context.Context, orgID string, limits *Limits) error
+}
+
+// Limiter enforces the limits of organizations, falling back to the configured defaults
+type Limiter struct {
+	store    Store
+	defaults Limits
+	now      func() time.Time
+}
+
+// NewLimiter creates a Limiter over the store
+func NewLimiter(store Store, defaults Limits) *Limiter {
+	return &Limiter{
+		store:    store,
+		defaults: defaults,
+		now:      time.Now,
+	}
+}
+
+// DefaultLimits reads the limits of organizations without an override from config
+func DefaultLimits() Limits {
+	return Limits{
+		RequestsPerSecond: float64(conf.GetAsInt("ratelimit.requestsPerSecond", 10)),
+		Burst:             conf.GetAsInt("ratelimit.burst", 20),
+		DailyJobs:         conf.GetAsInt("ratelimit.dailyJobs", 0),
+		DailyPatients:     conf.GetAsInt("ratelimit.dailyPatients", 0),
+	}
+}
+
+// NewLimiterFromConfig creates a Limiter with the store set by the ratelimit.store config. Limits are kept in memory
+// by default, which only holds for a single instance of the API; postgres shares them across instances.
+func NewLimiterFromConfig() (*Limiter, error) {
+	switch t := conf.GetAsString("ratelimit.store", "memory"); t {
+	case "memory":
+		return NewLimiter(NewMemoryStore(), DefaultLimits()), nil
+	case "postgres":
+		db, err := openPostgres(conf.GetAsString("ratelimit.postgres.url"))
+		if err != nil {
+			return nil, err
+		}
+		return NewLimiter(NewPostgresStore(db), DefaultLimits()), nil
+	default:
+		return nil, fmt.Errorf("unsupported rate limit store %s", t)
+	}
+}
+
+// Get returns the limits the organization is held to
+func (l *Limiter) Get(ctx context.Context, orgID string) (Limits, error) {
+	limits, err := l.store.Limits(ctx, orgID)
+	if err != nil {
+		return Limits{}, err
+	}
+	if limits == nil {
+		return l.defaults, nil
+	}
+	return *limits, nil
+}
+
+// Set overrides the limits of the organization, or resets it to the defaults when nil
+func (l *Limiter) Set(ctx context.Context, orgID string, limits *Limits) error {
+	if limits != nil {
+		if err := limits.Validate(); err != nil {
+			return err
+		}
+	}
+	return l.store.SetLimits(ctx, orgID, limits)
+}
+
+// AllowRequest returns 0 when the organization may make another request, or how long until it may
+func (l *Limiter) AllowRequest(ctx context.Context, orgID string) (time.Duration, error) {
+	limits, err := l.Get(ctx, orgID)
+	if err != nil {
+		return 0, err
+	}
+	return l.store.Take(ctx, orgID, limits, l.now())
+}
+
+// AllowExport returns 0 when the organization may start an export of the given number of patients, counting it
+// against the day's quota, or how long until the quota resets
+func (l *Limiter) AllowExport(ctx context.Context, orgID string, patients int) (time.Duration, error) {
+	limits, err := l.Get(ctx, orgID)
+	if err != nil {
+		return 0, err
+	}
+	now := l.now()
+	ok, err := l.store.Consume(ctx, orgID, limits, patients, now)
+	if err != nil || ok {
+		return 0, err
+	}
+	return untilTomorrow(now), nil
+}
+
+// RefundExport takes back an export counted by AllowExport that did not start a new job
+func (l *Limiter) RefundExport(ctx context.Context, orgID string, patients int) error {
+	return l.store.Release(ctx, orgID, patients, l.now())
+}
+
+// refill returns the tokens of a bucket last updated at the given time, topped up at the request rate
+func refill(tokens float64, updated time.Time, limits Limits, now time.Time) float64 {
+	if elapsed := now.Sub(updated).Seconds(); elapsed > 0 {
+		tokens += elapsed * limits.RequestsPerSecond
+	}
+	return math.Min(tokens, float64(limits.Burst))
+}
+
+// wait returns how long a bucket holding the given tokens takes to hold a whole one
+func wait(tokens float64, limits Limits) time.Duration {
+	return time.Duration((1 - tokens) / limits.RequestsPerSecond * float64(time.Second))
+}
+
+// withinQuota reports whether a day's usage plus a job of the given number of patients stays within the limits
+func withinQuota(jobs int, patients int, limits Limits, newPatients int) bool {
+	return (limits.DailyJobs == 0 || jobs+1 <= limits.DailyJobs) &&
+		(limits.DailyPatients == 0 || patients+newPatients <= limits.DailyPatients)
+}
+
+// day is the UTC date quotas are counted for
+func day(now time.Time) time.Time {
+	y, m, d := now.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func untilTomorrow(now time.Time) time.Duration {
+	return day(now).AddDate(0, 0, 1).Sub(now)
+}
@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type LimiterTestSuite struct {
+	suite.Suite
+	now     time.Time
+	limiter *Limiter
+}
+
+func TestLimiterTestSuite(t *testing.T) {
+	suite.Run(t, new(LimiterTestSuite))
+}
+
+func (suite *LimiterTestSuite) SetupTest() {
+	suite.now = time.Date(2021, 6, 1, 18, 0, 0, 0, time.UTC)
+	suite.limiter = NewLimiter(NewMemoryStore(), Limits{RequestsPerSecond: 2, Burst: 3, DailyJobs: 2, DailyPatients: 100})
+	suite.limiter.now = func() time.Time { return suite.now }
+}
+
+func (suite *LimiterTestSuite) TestAllowRequest() {
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		wait, err := suite.limiter.AllowRequest(ctx, "org-1")
+		assert.NoError(suite.T(), err)
+		assert.Zero(suite.T(), wait)
+	}
+
+	wait, _ := suite.limiter.AllowRequest(ctx, "org-1")
+	assert.Equal(suite.T(), 500*time.Millisecond, wait)
+
+	// a quarter second refills half a token
+	suite.now = suite.now.Add(250 * time.Millisecond)
+	wait, _ = suite.limiter.AllowRequest(ctx, "org-1")
+	assert.Equal(suite.T(), 250*time.Millisecond, wait)
+
+	suite.now = suite.now.Add(250 * time.Millisecond)
+	wait, _ = suite.limiter.AllowRequest(ctx, "org-1")
+	assert.Zero(suite.T(), wait)
+
+	// the bucket never holds more than the burst
+	suite.now = suite.now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		wait, _ = suite.limiter.AllowRequest(ctx, "org-1")
+		assert.Zero(suite.T(), wait)
+	}
+	wait, _ = suite.limiter.AllowRequest(ctx, "org-1")
+	assert.NotZero(suite.T(), wait)
+}
+
+func (suite *LimiterTestSuite) TestAllowExport() {
+	ctx := context.Background()
+
+	wait, err := suite.limiter.AllowExport(ctx, "org-1", 60)
+	assert.NoError(suite.T(), err)
+	assert.Zero(suite.T(), wait)
+
+	// too many patients for what is left of the day's quota
+	wait, _ = suite.limiter.AllowExport(ctx, "org-1", 41)
+	assert.Equal(suite.T(), 6*time.Hour, wait)
+
+	wait, _ = suite.limiter.AllowExport(ctx, "org-1", 40)
+	assert.Zero(suite.T(), wait)
+
+	// out of jobs
+	wait, _ = suite.limiter.AllowExport(ctx, "org-1", 0)
+	assert.Equal(suite.T(), 6*time.Hour, wait)
+
+	// the quota resets at midnight UTC
+	suite.now = suite.now.Add(6 * time.Hour)
+	wait, _ = suite.limiter.AllowExport(ctx, "org-1", 100)
+	assert.Zero(suite.T(), wait)
+}
+
+func (suite *LimiterTestSuite) TestAllowExportUnlimited() {
+	ctx := context.Background()
+	assert.NoError(suite.T(), suite.limiter.Set(ctx, "org-1", &Limits{RequestsPerSecond: 1, Burst: 1}))
+
+	for i := 0; i < 10; i++ {
+		wait, _ := suite.limiter.AllowExport(ctx, "org-1", 1000)
+		assert.Zero(suite.T(), wait)
+	}
+}
+
+func (suite *LimiterTestSuite) TestGetAndSet() {
+	ctx := context.Background()
+	custom := Limits{RequestsPerSecond: 50, Burst: 100, DailyJobs: 10, DailyPatients: 0}
+
+	limits, _ := suite.limiter.Get(ctx, "org-1")
+	assert.Equal(suite.T(), suite.limiter.defaults, limits)
+
+	assert.NoError(suite.T(), suite.limiter.Set(ctx, "org-1", &custom))
+	limits, _ = suite.limiter.Get(ctx, "org-1")
+	assert.Equal(suite.T(), custom, limits)
+	limits, _ = suite.limiter.Get(ctx, "org-2")
+	assert.Equal(suite.T(), suite.limiter.defaults, limits)
+
+	assert.NoError(suite.T(), suite.limiter.Set(ctx, "org-1", nil))
+	limits, _ = suite.limiter.Get(ctx, "org-1")
+	assert.Equal(suite.T(), suite.limiter.defaults, limits)
+
+	assert.Error(suite.T(), suite.limiter.Set(ctx, "org-1", &Limits{RequestsPerSecond: 0, Burst: 1}))
+}
+
+func TestLimitsValidate(t *testing.T) {
+	assert.NoError(t, Limits{RequestsPerSecond: 0.5, Burst: 1}.Validate())
+	assert.Error(t, Limits{RequestsPerSecond: 0, Burst: 1}.Validate())
+	assert.Error(t, Limits{RequestsPerSecond: 1, Burst: 0}.Validate())
+	assert.Error(t, Limits{RequestsPerSecond: 1, Burst: 1, DailyJobs: -1}.Validate())
+	assert.Error(t, Limits{RequestsPerSecond: 1, Burst: 1, DailyPatients: -1}.Validate())
+}
@@ -2,9 +2,11 @@ package admin
 
 import (
 	"context"
+	"github.com/CMSgov/dpc/api/auth"
 	"github.com/CMSgov/dpc/api/client"
 	"github.com/CMSgov/dpc/api/conf"
 	middleware2 "github.com/CMSgov/dpc/api/middleware"
+	"github.com/CMSgov/dpc/api/ratelimit"
 	"github.com/CMSgov/dpc/api/service"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
@@ -35,6 +37,14 @@ func buildAdminRoutes(c controllers) http.Handler {
 				r.With(middleware2.FHIRModel).Get("/", c.Org.Read)
 				r.Delete("/", c.Org.Delete)
 				r.With(middleware2.FHIRFilter, middleware2.FHIRModel).Put("/", c.Org.Update)
+				r.Get("/priority", c.Priority.Read)
+				r.Put("/priority", c.Priority.Update)
+				r.Get("/retention", c.Retention.Read)
+				r.Put("/retention", c.Retention.Update)
+				r.Delete("/retention", c.Retention.Delete)
+				r.Get("/limits", c.Limits.Read)
+				r.Put("/limits", c.Limits.Update)
+				r.Delete("/limits", c.Limits.Delete)
 			})
 			r.With(middleware2.FHIRFilter, middleware2.FHIRModel).Post("/", c.Org.Create)
 		})
@@ -65,8 +75,9 @@ func buildAdminRoutes(c controllers) http.Handler {
 	return r
 }
 
-// NewAdminServer configures clients, builds ADMIN routes, and creates a server.
-func NewAdminServer(ctx context.Context) *service.Server {
+// NewAdminServer configures clients, builds ADMIN routes, and creates a server. The SSAS client and the auth provider
+// built from config at startup are shared with the public server.
+func NewAdminServer(ctx context.Context, limiter *ratelimit.Limiter, ssasClient client.SsasClient, authProvider auth.Provider) *service.Server {
 	attrClient := client.NewAttributionClient(ctx, client.AttributionConfig{
 		URL:     conf.GetAsString("attribution-client.url"),
 		Retries: conf.GetAsInt("attribution-client.retries", 3),
@@ -75,24 +86,16 @@ func NewAdminServer(ctx context.Context) *service.Server {
 		CertKey: conf.GetAsString("ATTR_CERT_KEY"),
 	})
 
-	ssasClient := client.NewSsasHTTPClient(ctx, client.SsasHTTPClientConfig{
-		PublicURL:    conf.GetAsString("ssas-client.public-url"),
-		AdminURL:     conf.GetAsString("ssas-client.admin-url"),
-		Retries:      conf.GetAsInt("ssas-client.attrRetries", 3),
-		ClientID:     conf.GetAsString("ssas-client.client-id"),
-		ClientSecret: conf.GetAsString("ssas-client.client-secret"),
-        CACert: conf.GetAsString("ssas-client.ca-cert"),
-        Cert: conf.GetAsString("ssas-client.cert"),
-        CertKey: conf.GetAsString("ssas-client.cert-key"),
-	})
-
 	port := conf.GetAsInt("ADMIN_PORT", 3011)
 
 	controllers := controllers{
-		Org:     v2.NewOrganizationController(attrClient),
-		Impl:    v2.NewImplementerController(attrClient, ssasClient),
-		ImplOrg: v2.NewImplementerOrgController(attrClient),
-		Ssas:    v2.NewSSASController(ssasClient, attrClient),
+		Org:       v2.NewOrganizationController(attrClient),
+		Impl:      v2.NewImplementerController(attrClient, ssasClient),
+		ImplOrg:   v2.NewImplementerOrgController(attrClient),
+		Ssas:      v2.NewSSASController(ssasClient, attrClient, authProvider),
+		Priority:  v2.NewPriorityController(attrClient),
+		Retention: v2.NewRetentionController(attrClient),
+		Limits:    v2.NewLimitsController(limiter),
 	}
 
 	r := buildAdminRoutes(controllers)
@@ -101,9 +104,12 @@ func NewAdminServer(ctx context.Context) *service.Server {
 }
 
 type controllers struct {
-	Org     v2.Controller
-	Health  v2.Controller
-	Impl    v2.Controller
-	ImplOrg v2.Controller
-	Ssas    v2.AuthController
+	Org       v2.Controller
+	Health    v2.Controller
+	Impl      v2.Controller
+	ImplOrg   v2.Controller
+	Ssas      v2.AuthController
+	Priority  v2.PriorityController
+	Retention v2.RetentionController
+	Limits    v2.LimitsController
 }
@@ -83,12 +83,15 @@ func (mjc *MockSsasController) ValidateToken(w http.ResponseWriter, r *http.Requ
 
 type RouterTestSuite struct {
 	suite.Suite
-	router      http.Handler
-	mockOrg     *MockController
-	mockHealth  *MockController
-	mockImpl    *MockController
-	mockImplOrg *MockController
-	mockSsas    *MockSsasController
+	router        http.Handler
+	mockOrg       *MockController
+	mockHealth    *MockController
+	mockImpl      *MockController
+	mockImplOrg   *MockController
+	mockSsas      *MockSsasController
+	mockPriority  *MockController
+	mockRetention *MockController
+	mockLimits    *MockController
 }
 
 func (suite *RouterTestSuite) SetupTest() {
@@ -98,13 +101,19 @@ func (suite *RouterTestSuite) SetupTest() {
 	suite.mockImpl = &MockController{}
 	suite.mockImplOrg = &MockController{}
 	suite.mockSsas = &MockSsasController{}
+	suite.mockPriority = &MockController{}
+	suite.mockRetention = &MockController{}
+	suite.mockLimits = &MockController{}
 
 	c := controllers{
-		Org:     suite.mockOrg,
-		Health:  suite.mockHealth,
-		Impl:    suite.mockImpl,
-		ImplOrg: suite.mockImplOrg,
-		Ssas:    suite.mockSsas,
+		Org:       suite.mockOrg,
+		Health:    suite.mockHealth,
+		Impl:      suite.mockImpl,
+		ImplOrg:   suite.mockImplOrg,
+		Ssas:      suite.mockSsas,
+		Priority:  suite.mockPriority,
+		Retention: suite.mockRetention,
+		Limits:    suite.mockLimits,
 	}
 
 	suite.router = buildAdminRoutes(c)
@@ -285,3 +294,85 @@ func (suite *RouterTestSuite) TestOrganizationGetRoutes() {
 	assert.Contains(suite.T(), v, "resourceType")
 	assert.Equal(suite.T(), v["resourceType"], "Organization")
 }
+
+func (suite *RouterTestSuite) TestOrganizationPriorityRoutes() {
+	var orgIDs []string
+	capture := func(arg mock.Arguments) {
+		r := arg.Get(1).(*http.Request)
+		orgIDs = append(orgIDs, r.Context().Value(constants.ContextKeyOrganization).(string))
+		w := arg.Get(0).(http.ResponseWriter)
+		_, _ = w.Write([]byte(`{"organizationID":"12345","tier":"high","maxConcurrentBatches":2}`))
+	}
+	suite.mockPriority.On("Read", mock.Anything, mock.Anything).Once().Run(capture)
+	suite.mockPriority.On("Update", mock.Anything, mock.Anything).Once().Run(capture)
+
+	ts := httptest.NewServer(suite.router)
+
+	res, _ := http.Get(fmt.Sprintf("%s/%s", ts.URL, "api/v2/Organization/12345/priority"))
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+
+	req, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("%s/%s", ts.URL, "api/v2/Organization/12345/priority"), strings.NewReader(`{"tier":"high","maxConcurrentBatches":2}`))
+	res, _ = http.DefaultClient.Do(req)
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+	assert.Equal(suite.T(), []string{"12345", "12345"}, orgIDs)
+}
+
+func (suite *RouterTestSuite) TestOrganizationRetentionRoutes() {
+	write := func(arg mock.Arguments) {
+		r := arg.Get(1).(*http.Request)
+		assert.Equal(suite.T(), "12345", r.Context().Value(constants.ContextKeyOrganization))
+		w := arg.Get(0).(http.ResponseWriter)
+		_, _ = w.Write([]byte(`{"organizationID":"12345","hours":168}`))
+	}
+	suite.mockRetention.On("Read", mock.Anything, mock.Anything).Once().Run(write)
+	suite.mockRetention.On("Update", mock.Anything, mock.Anything).Once().Run(write)
+	suite.mockRetention.On("Delete", mock.Anything, mock.Anything).Once().Run(func(arg mock.Arguments) {
+		w := arg.Get(0).(http.ResponseWriter)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	ts := httptest.NewServer(suite.router)
+	url := fmt.Sprintf("%s/%s", ts.URL, "api/v2/Organization/12345/retention")
+
+	res, _ := http.Get(url)
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+
+	req, _ := http.NewRequest(http.MethodPut, url, strings.NewReader(`{"hours":168}`))
+	res, _ = http.DefaultClient.Do(req)
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+
+	req, _ = http.NewRequest(http.MethodDelete, url, nil)
+	res, _ = http.DefaultClient.Do(req)
+	assert.Equal(suite.T(), http.StatusNoContent, res.StatusCode)
+	suite.mockRetention.AssertExpectations(suite.T())
+}
+
+func (suite *RouterTestSuite) TestOrganizationLimitsRoutes() {
+	write := func(arg mock.Arguments) {
+		r := arg.Get(1).(*http.Request)
+		assert.Equal(suite.T(), "12345", r.Context().Value(constants.ContextKeyOrganization))
+		w := arg.Get(0).(http.ResponseWriter)
+		_, _ = w.Write([]byte(`{"requestsPerSecond":10,"burst":20,"dailyJobs":0,"dailyPatients":0}`))
+	}
+	suite.mockLimits.On("Read", mock.Anything, mock.Anything).Once().Run(write)
+	suite.mockLimits.On("Update", mock.Anything, mock.Anything).Once().Run(write)
+	suite.mockLimits.On("Delete", mock.Anything, mock.Anything).Once().Run(func(arg mock.Arguments) {
+		w := arg.Get(0).(http.ResponseWriter)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	ts := httptest.NewServer(suite.router)
+	url := fmt.Sprintf("%s/%s", ts.URL, "api/v2/Organization/12345/limits")
+
+	res, _ := http.Get(url)
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+
+	req, _ := http.NewRequest(http.MethodPut, url, strings.NewReader(`{"requestsPerSecond":10,"burst":20}`))
+	res, _ = http.DefaultClient.Do(req)
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+
+	req, _ = http.NewRequest(http.MethodDelete, url, nil)
+	res, _ = http.DefaultClient.Do(req)
+	assert.Equal(suite.T(), http.StatusNoContent, res.StatusCode)
+	suite.mockLimits.AssertExpectations(suite.T())
+}
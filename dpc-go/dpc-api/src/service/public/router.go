@@ -2,19 +2,25 @@ package public
 
 import (
 	"context"
+	"github.com/CMSgov/dpc/api/auth"
 	"github.com/CMSgov/dpc/api/client"
 	"github.com/CMSgov/dpc/api/conf"
+	"github.com/CMSgov/dpc/api/constants"
+	"github.com/CMSgov/dpc/api/logger"
 	middleware2 "github.com/CMSgov/dpc/api/middleware"
+	"github.com/CMSgov/dpc/api/ratelimit"
 	"github.com/CMSgov/dpc/api/service"
+	"github.com/CMSgov/dpc/api/storage"
 	v2 "github.com/CMSgov/dpc/api/v2"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/render"
+	"go.uber.org/zap"
 	"net/http"
 	"strings"
 )
 
-func buildPublicRoutes(cont controllers, ssasClient client.SsasClient) http.Handler {
+func buildPublicRoutes(cont controllers, authProvider auth.Provider, limiter *ratelimit.Limiter) http.Handler {
 	r := chi.NewRouter()
 	r.Use(middleware2.Logging())
 	r.Use(middleware2.RequestIPCtx)
@@ -31,47 +37,85 @@ func buildPublicRoutes(cont controllers, ssasClient client.SsasClient) http.Hand
 
 		//PATIENT
 		r.Route("/Patient", func(r chi.Router) {
-			r.Use(middleware2.AuthCtx(ssasClient))
-			r.Use(middleware2.ProvenanceHeaderValidator(true))
+			r.Use(middleware2.AuthCtx(authProvider))
+			r.Use(middleware2.RateLimit(limiter))
 			r.Use(middleware2.RequestURLCtx)
-			r.Use(middleware2.ExportTypesParamCtx)
-			r.Use(middleware2.ExportSinceParamCtx)
-			r.Use(middleware2.MBICtx)
-			r.Get("/$everything", cont.Patient.Export)
+			r.With(middleware2.ExportKickoffCtx, middleware2.ExportTypesParamCtx, middleware2.ExportTypeFilterParamCtx, middleware2.ExportElementsParamCtx, middleware2.ExportSinceParamCtx, middleware2.RequireScope(constants.PatientString, auth.Read), middleware2.RequireExportScopes).Get("/$export", cont.Patient.Export)
+			r.With(middleware2.ExportTypesParamCtx, middleware2.ExportSinceParamCtx, middleware2.ProvenanceHeaderValidator(true), middleware2.MBICtx, middleware2.RespondAsyncCtx, middleware2.RequireScope(constants.PatientString, auth.Read), middleware2.RequireExportScopes).Get("/$everything", cont.Patient.Everything)
 		})
 
 		//ORGANIZATION
 		r.Route("/Organization", func(r chi.Router) {
-			r.Use(middleware2.AuthCtx(ssasClient))
+			r.Use(middleware2.AuthCtx(authProvider))
+			r.Use(middleware2.RateLimit(limiter))
 			r.Route("/{organizationID}", func(r chi.Router) {
 				r.Use(middleware2.OrganizationCtx)
-				r.With(middleware2.FHIRModel).Get("/", cont.Org.Read)
+				r.With(middleware2.RequireScope("Organization", auth.Read), middleware2.FHIRModel).Get("/", cont.Org.Read)
 			})
 		})
 
 		//GROUP
 		r.Route("/Group", func(r chi.Router) {
-			r.Use(middleware2.AuthCtx(ssasClient))
-			r.With(middleware2.ProvenanceHeaderValidator(false), middleware2.FHIRFilter, middleware2.FHIRModel).Post("/", cont.Group.Create)
+			r.Use(middleware2.AuthCtx(authProvider))
+			r.Use(middleware2.RateLimit(limiter))
+			r.With(middleware2.RequireScope("Group", auth.Write), middleware2.ProvenanceHeaderValidator(false), middleware2.FHIRFilter, middleware2.FHIRModel).Post("/", cont.Group.Create)
 			r.Route("/{groupID}", func(r chi.Router) {
 				r.Use(middleware2.RequestURLCtx)
 				r.Use(middleware2.GroupCtx)
+				r.Use(middleware2.ExportParametersCtx)
+				r.Use(middleware2.ExportKickoffCtx)
 				r.Use(middleware2.ExportTypesParamCtx)
+				r.Use(middleware2.ExportTypeFilterParamCtx)
+				r.Use(middleware2.ExportElementsParamCtx)
 				r.Use(middleware2.ExportSinceParamCtx)
-				r.Get("/$export", cont.Group.Export)
+				r.With(middleware2.RequireScope("Group", auth.Read), middleware2.RequireExportScopes).Get("/$export", cont.Group.Export)
+				r.With(middleware2.RequireScope("Group", auth.Read), middleware2.RequireExportScopes).Post("/$export", cont.Group.Export)
 			})
 		})
 
 		//JOBS
 		r.Route("/Jobs", func(r chi.Router) {
 			r.Use(middleware.SetHeader("Content-Type", "application/json; charset=UTF-8"))
-			r.Use(middleware2.AuthCtx(ssasClient))
+			r.Use(middleware2.AuthCtx(authProvider))
+			r.Use(middleware2.RateLimit(limiter))
+			r.Use(middleware2.RequireAnyReadScope)
+			r.Get("/", cont.Job.List)
 			r.With(middleware2.JobCtx).Get("/{jobID}", cont.Job.Status)
+			r.With(middleware2.JobCtx).Delete("/{jobID}", cont.Job.Cancel)
+		})
+
+		//WEBHOOK
+		r.Route("/Webhook", func(r chi.Router) {
+			r.Use(middleware.SetHeader("Content-Type", "application/json; charset=UTF-8"))
+			r.Use(middleware2.AuthCtx(authProvider))
+			r.Use(middleware2.RateLimit(limiter))
+			r.With(middleware2.RequireAnyReadScope).Get("/", cont.Webhook.Read)
+			r.With(middleware2.RequireAnyWriteScope).Put("/", cont.Webhook.Update)
+			r.With(middleware2.RequireAnyWriteScope).Delete("/", cont.Webhook.Delete)
+			r.With(middleware2.RequireAnyReadScope).Get("/deliveries", cont.Webhook.Deliveries)
+		})
+
+		//EXPORT SCHEDULE
+		r.Route("/ExportSchedule", func(r chi.Router) {
+			r.Use(middleware.SetHeader("Content-Type", "application/json; charset=UTF-8"))
+			r.Use(middleware2.AuthCtx(authProvider))
+			r.Use(middleware2.RateLimit(limiter))
+			r.Use(middleware2.RequireScope("Group", auth.Read))
+			r.Get("/", cont.ExportSchedule.List)
+			r.Post("/", cont.ExportSchedule.Create)
+			r.Route("/{scheduleID}", func(r chi.Router) {
+				r.Use(middleware2.ExportScheduleCtx)
+				r.Get("/", cont.ExportSchedule.Read)
+				r.Put("/", cont.ExportSchedule.Update)
+				r.Delete("/", cont.ExportSchedule.Delete)
+			})
 		})
 
 		//DATA
 		r.Route("/Data", func(r chi.Router) {
-			r.Use(middleware2.AuthCtx(ssasClient))
+			r.Use(middleware2.AuthCtx(authProvider))
+			r.Use(middleware2.RateLimit(limiter))
+			r.Use(middleware2.RequireAnyReadScope)
 			r.With(middleware2.FileNameCtx).Get("/{fileName}", cont.Data.GetFile)
 		})
 
@@ -82,8 +126,9 @@ func buildPublicRoutes(cont controllers, ssasClient client.SsasClient) http.Hand
 	return r
 }
 
-// NewPublicServer configures clients, builds ADMIN routes, and creates a server.
-func NewPublicServer(ctx context.Context) *service.Server {
+// NewPublicServer configures clients, builds ADMIN routes, and creates a server. The SSAS client and the auth provider
+// built from config at startup are shared with the admin server.
+func NewPublicServer(ctx context.Context, limiter *ratelimit.Limiter, ssasClient client.SsasClient, authProvider auth.Provider) *service.Server {
 	attrClient := client.NewAttributionClient(ctx, client.AttributionConfig{
 		URL:     conf.GetAsString("attribution-client.url"),
 		Retries: conf.GetAsInt("attribution-client.retries", 3),
@@ -97,35 +142,32 @@ func NewPublicServer(ctx context.Context) *service.Server {
 		Retries: conf.GetAsInt("attribution-client.retries", 3),
 	})
 
-	jobClient := client.NewJobClient(client.JobConfig{
+	jobClient := ratelimit.NewQuotaJobClient(client.NewJobClient(client.JobConfig{
 		URL:     conf.GetAsString("attribution-client.url"),
 		Retries: conf.GetAsInt("attribution-client.retries", 3),
-	})
+	}), limiter)
 
-	ssasClient := client.NewSsasHTTPClient(ctx, client.SsasHTTPClientConfig{
-		PublicURL:    conf.GetAsString("ssas-client.public-url"),
-		AdminURL:     conf.GetAsString("ssas-client.admin-url"),
-		Retries:      conf.GetAsInt("ssas-client.attrRetries", 3),
-		ClientID:     conf.GetAsString("ssas-client.client-id"),
-		ClientSecret: conf.GetAsString("ssas-client.client-secret"),
-        CACert: conf.GetAsString("ssas-client.ca-cert"),
-        Cert: conf.GetAsString("ssas-client.cert"),
-        CertKey: conf.GetAsString("ssas-client.cert-key"),
-	})
+	store, err := storage.NewStore()
+	if err != nil {
+		logger.WithContext(ctx).Error("Failed to create export file storage", zap.Error(err))
+		return nil
+	}
 
 	port := conf.GetAsInt("PUBLIC_PORT", 3000)
 
 	controllers := controllers{
-		Org:      v2.NewOrganizationController(attrClient),
-		Metadata: v2.NewMetadataController(conf.GetAsString("capabilities.base")),
-		Group:    v2.NewGroupController(attrClient, jobClient),
-		Data:     v2.NewDataController(dataClient),
-		Job:      v2.NewJobController(jobClient),
-		Ssas:     v2.NewSSASController(ssasClient, attrClient),
-		Patient:  v2.NewPatientController(jobClient),
+		Org:            v2.NewOrganizationController(attrClient),
+		Metadata:       v2.NewMetadataController(conf.GetAsString("capabilities.base")),
+		Group:          v2.NewGroupController(attrClient, jobClient),
+		Data:           v2.NewDataController(dataClient, store),
+		Job:            v2.NewJobController(jobClient),
+		Ssas:           v2.NewSSASController(ssasClient, attrClient, authProvider),
+		Patient:        v2.NewPatientController(attrClient, jobClient, store),
+		Webhook:        v2.NewWebhookController(attrClient),
+		ExportSchedule: v2.NewExportScheduleController(attrClient),
 	}
 
-	r := buildPublicRoutes(controllers, ssasClient)
+	r := buildPublicRoutes(controllers, authProvider, limiter)
 	return service.NewServer("DPC-API Public Server", port, "NONE", r)
 
 }
@@ -149,12 +191,14 @@ func fileServer(r chi.Router, path string, root http.FileSystem) {
 }
 
 type controllers struct {
-	Org      v2.Controller
-	Metadata v2.ReadController
-	Health   v2.Controller
-	Group    v2.Controller
-	Data     v2.FileController
-	Job      v2.JobController
-	Ssas     v2.AuthController
-	Patient  v2.ExportController
+	Org            v2.Controller
+	Metadata       v2.ReadController
+	Health         v2.Controller
+	Group          v2.Controller
+	Data           v2.FileController
+	Job            v2.JobController
+	Ssas           v2.AuthController
+	Patient        v2.PatientExportController
+	Webhook        v2.WebhookController
+	ExportSchedule v2.ExportScheduleController
 }
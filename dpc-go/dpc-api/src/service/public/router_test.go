@@ -10,9 +10,11 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/CMSgov/dpc/api/auth"
 	"github.com/CMSgov/dpc/api/client"
 	"github.com/CMSgov/dpc/api/constants"
 	"github.com/CMSgov/dpc/api/model"
+	"github.com/CMSgov/dpc/api/ratelimit"
 
 	"github.com/CMSgov/dpc/api/apitest"
 	"github.com/go-chi/chi/middleware"
@@ -65,9 +67,9 @@ func (mc *MockSsasClient) DeletePublicKey(ctx context.Context, systemID string,
 	return args.Error(0)
 }
 
-func (mc *MockSsasClient) GetOrgIDFromToken(ctx context.Context, token string) (string, error) {
+func (mc *MockSsasClient) GetTokenInfo(ctx context.Context, token string) (client.TokenInfo, error) {
 	args := mc.Called(ctx, token)
-	return args.Get(0).(string), args.Error(1)
+	return args.Get(0).(client.TokenInfo), args.Error(1)
 }
 
 func (mc *MockSsasClient) ValidateToken(ctx context.Context, reqBytes []byte) ([]byte, error) {
@@ -115,6 +117,14 @@ func (mjc *MockJobController) Status(w http.ResponseWriter, r *http.Request) {
 	mjc.Called(w, r)
 }
 
+func (mjc *MockJobController) List(w http.ResponseWriter, r *http.Request) {
+	mjc.Called(w, r)
+}
+
+func (mjc *MockJobController) Cancel(w http.ResponseWriter, r *http.Request) {
+	mjc.Called(w, r)
+}
+
 type MockSsasController struct {
 	mock.Mock
 }
@@ -159,6 +169,54 @@ func (mec *MockExportController) Export(w http.ResponseWriter, r *http.Request)
 	mec.Called(w, r)
 }
 
+func (mec *MockExportController) Everything(w http.ResponseWriter, r *http.Request) {
+	mec.Called(w, r)
+}
+
+type MockWebhookController struct {
+	mock.Mock
+}
+
+func (mwc *MockWebhookController) Read(w http.ResponseWriter, r *http.Request) {
+	mwc.Called(w, r)
+}
+
+func (mwc *MockWebhookController) Update(w http.ResponseWriter, r *http.Request) {
+	mwc.Called(w, r)
+}
+
+func (mwc *MockWebhookController) Delete(w http.ResponseWriter, r *http.Request) {
+	mwc.Called(w, r)
+}
+
+func (mwc *MockWebhookController) Deliveries(w http.ResponseWriter, r *http.Request) {
+	mwc.Called(w, r)
+}
+
+type MockExportScheduleController struct {
+	mock.Mock
+}
+
+func (msc *MockExportScheduleController) List(w http.ResponseWriter, r *http.Request) {
+	msc.Called(w, r)
+}
+
+func (msc *MockExportScheduleController) Create(w http.ResponseWriter, r *http.Request) {
+	msc.Called(w, r)
+}
+
+func (msc *MockExportScheduleController) Read(w http.ResponseWriter, r *http.Request) {
+	msc.Called(w, r)
+}
+
+func (msc *MockExportScheduleController) Update(w http.ResponseWriter, r *http.Request) {
+	msc.Called(w, r)
+}
+
+func (msc *MockExportScheduleController) Delete(w http.ResponseWriter, r *http.Request) {
+	msc.Called(w, r)
+}
+
 type RouterTestSuite struct {
 	suite.Suite
 	router         http.Handler
@@ -171,6 +229,9 @@ type RouterTestSuite struct {
 	mockSsas       *MockSsasController
 	mockSassClient *MockSsasClient
 	mockPatient    *MockExportController
+	mockWebhook    *MockWebhookController
+	mockSchedules  *MockExportScheduleController
+	controllers    controllers
 }
 
 func (suite *RouterTestSuite) SetupTest() {
@@ -183,19 +244,25 @@ func (suite *RouterTestSuite) SetupTest() {
 	suite.mockSsas = &MockSsasController{}
 	suite.mockSassClient = &MockSsasClient{}
 	suite.mockPatient = &MockExportController{}
+	suite.mockWebhook = &MockWebhookController{}
+	suite.mockSchedules = &MockExportScheduleController{}
 
 	c := controllers{
-		Org:      suite.mockOrg,
-		Metadata: suite.mockMeta,
-		Health:   suite.mockHealth,
-		Group:    suite.mockGroup,
-		Data:     suite.mockData,
-		Job:      suite.mockJob,
-		Ssas:     suite.mockSsas,
-		Patient:  suite.mockPatient,
+		Org:            suite.mockOrg,
+		Metadata:       suite.mockMeta,
+		Health:         suite.mockHealth,
+		Group:          suite.mockGroup,
+		Data:           suite.mockData,
+		Job:            suite.mockJob,
+		Ssas:           suite.mockSsas,
+		Patient:        suite.mockPatient,
+		Webhook:        suite.mockWebhook,
+		ExportSchedule: suite.mockSchedules,
 	}
 
-	suite.router = buildPublicRoutes(c, suite.mockSassClient)
+	suite.controllers = c
+	suite.router = buildPublicRoutes(c, auth.NewSSASProvider(suite.mockSassClient),
+		ratelimit.NewLimiter(ratelimit.NewMemoryStore(), ratelimit.Limits{RequestsPerSecond: 100, Burst: 100}))
 }
 
 func TestRouterTestSuite(t *testing.T) {
@@ -233,7 +300,7 @@ func (suite *RouterTestSuite) TestGroupExportRoute() {
 		w.WriteHeader(http.StatusAccepted)
 	})
 
-	suite.mockSassClient.On("GetOrgIDFromToken", mock.Anything, mock.Anything).Return("12345", nil)
+	suite.mockSassClient.On("GetTokenInfo", mock.Anything, mock.Anything).Return(client.TokenInfo{OrganizationID: "12345"}, nil)
 
 	ts := httptest.NewServer(suite.router)
 
@@ -257,6 +324,97 @@ func (suite *RouterTestSuite) TestGroupExportRoute() {
 	assert.Nil(suite.T(), v)
 }
 
+func (suite *RouterTestSuite) TestGroupExportPostRoute() {
+	suite.mockGroup.On("Export", mock.Anything, mock.Anything).Once().Run(func(arg mock.Arguments) {
+		r := arg.Get(1).(*http.Request)
+		assert.Equal(suite.T(), "Patient,Coverage", r.Context().Value(constants.ContextKeyResourceTypes))
+		assert.Equal(suite.T(), []string{"2SW4N00AA00"}, r.Context().Value(constants.ContextKeyPatients))
+		assert.Equal(suite.T(), "ndjson", r.URL.Query().Get("_outputFormat"))
+		w := arg.Get(0).(http.ResponseWriter)
+		w.WriteHeader(http.StatusAccepted)
+	})
+	suite.mockSassClient.On("GetTokenInfo", mock.Anything, mock.Anything).Return(client.TokenInfo{
+		OrganizationID: "12345",
+		Scope:          "dpcv2-api system/Group.read system/Patient.read system/Coverage.read",
+	}, nil)
+
+	ts := httptest.NewServer(suite.router)
+
+	body := `{"resourceType": "Parameters", "parameter": [
+		{"name": "_type", "valueString": "Patient,Coverage"},
+		{"name": "_outputFormat", "valueString": "ndjson"},
+		{"name": "patient", "valueReference": {"identifier": {"system": "http://hl7.org/fhir/sid/us-mbi", "value": "2SW4N00AA00"}}}
+	]}`
+	req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/%s", ts.URL, "api/v2/Group/9876/$export"), strings.NewReader(body))
+	req.Header.Add("Authorization", "Bearer hello")
+	req.Header.Set("Prefer", "respond-async")
+	res, _ := http.DefaultClient.Do(req)
+
+	assert.Equal(suite.T(), http.StatusAccepted, res.StatusCode)
+	suite.mockGroup.AssertExpectations(suite.T())
+}
+
+func (suite *RouterTestSuite) TestGroupExportRouteInsufficientScope() {
+	suite.mockSassClient.On("GetTokenInfo", mock.Anything, mock.Anything).Return(client.TokenInfo{
+		OrganizationID: "12345",
+		Scope:          "dpcv2-api system/Group.read system/Patient.read",
+	}, nil)
+
+	ts := httptest.NewServer(suite.router)
+
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/%s", ts.URL, "api/v2/Group/9876/$export?_type=Patient,Coverage"), nil)
+	req.Header.Add("Authorization", "Bearer hello")
+	req.Header.Set("Prefer", "respond-async")
+	res, _ := http.DefaultClient.Do(req)
+
+	b, _ := ioutil.ReadAll(res.Body)
+
+	assert.Equal(suite.T(), http.StatusForbidden, res.StatusCode)
+	assert.Contains(suite.T(), string(b), "system/Coverage.read")
+	suite.mockGroup.AssertNotCalled(suite.T(), "Export", mock.Anything, mock.Anything)
+}
+
+func (suite *RouterTestSuite) TestPatientExportRoute() {
+	suite.mockPatient.On("Export", mock.Anything, mock.Anything).Once().Run(func(arg mock.Arguments) {
+		r := arg.Get(1).(*http.Request)
+		assert.Equal(suite.T(), "Patient,Coverage", r.Context().Value(constants.ContextKeyResourceTypes))
+		assert.Nil(suite.T(), r.Context().Value(constants.ContextKeyMBI))
+		w := arg.Get(0).(http.ResponseWriter)
+		w.WriteHeader(http.StatusAccepted)
+	})
+	suite.mockSassClient.On("GetTokenInfo", mock.Anything, mock.Anything).Return(client.TokenInfo{
+		OrganizationID: "12345",
+		Scope:          "dpcv2-api system/Patient.read system/Coverage.read",
+	}, nil)
+
+	ts := httptest.NewServer(suite.router)
+
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/%s", ts.URL, "api/v2/Patient/$export?_type=Patient,Coverage"), nil)
+	req.Header.Add("Authorization", "Bearer hello")
+	req.Header.Set("Prefer", "respond-async")
+	res, _ := http.DefaultClient.Do(req)
+
+	assert.Equal(suite.T(), http.StatusAccepted, res.StatusCode)
+	suite.mockPatient.AssertExpectations(suite.T())
+}
+
+func (suite *RouterTestSuite) TestPatientExportRouteInsufficientScope() {
+	suite.mockSassClient.On("GetTokenInfo", mock.Anything, mock.Anything).Return(client.TokenInfo{
+		OrganizationID: "12345",
+		Scope:          "dpcv2-api system/Patient.read",
+	}, nil)
+
+	ts := httptest.NewServer(suite.router)
+
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/%s", ts.URL, "api/v2/Patient/$export?_type=Patient,Coverage"), nil)
+	req.Header.Add("Authorization", "Bearer hello")
+	req.Header.Set("Prefer", "respond-async")
+	res, _ := http.DefaultClient.Do(req)
+
+	assert.Equal(suite.T(), http.StatusForbidden, res.StatusCode)
+	suite.mockPatient.AssertNotCalled(suite.T(), "Export", mock.Anything, mock.Anything)
+}
+
 func (suite *RouterTestSuite) TestOrganizationGetRoutes() {
 	var capturedRequestID string
 	suite.mockOrg.On("Read", mock.Anything, mock.Anything).Once().Run(func(arg mock.Arguments) {
@@ -266,7 +424,7 @@ func (suite *RouterTestSuite) TestOrganizationGetRoutes() {
 		_, _ = w.Write(apitest.AttributionOrgResponse())
 	})
 
-	suite.mockSassClient.On("GetOrgIDFromToken", mock.Anything, mock.Anything).Return("12345", nil)
+	suite.mockSassClient.On("GetTokenInfo", mock.Anything, mock.Anything).Return(client.TokenInfo{OrganizationID: "12345"}, nil)
 
 	ts := httptest.NewServer(suite.router)
 
@@ -303,3 +461,161 @@ func (suite *RouterTestSuite) TestGetAuthTokenProxyRoute() {
 	fmt.Println(err)
 	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
 }
+
+func (suite *RouterTestSuite) TestJobListRoute() {
+	suite.mockJob.On("List", mock.Anything, mock.Anything).Once().Run(func(arg mock.Arguments) {
+		r := arg.Get(1).(*http.Request)
+		assert.Equal(suite.T(), "12345", r.Context().Value(constants.ContextKeyOrganization))
+		w := arg.Get(0).(http.ResponseWriter)
+		_, _ = w.Write([]byte(`{"jobs":[],"page":1,"count":50}`))
+	})
+	suite.mockSassClient.On("GetTokenInfo", mock.Anything, mock.Anything).Return(client.TokenInfo{OrganizationID: "12345"}, nil)
+
+	ts := httptest.NewServer(suite.router)
+
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/%s", ts.URL, "api/v2/Jobs?status=COMPLETED"), nil)
+	req.Header.Add("Authorization", "Bearer hello")
+	res, _ := http.DefaultClient.Do(req)
+
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+	assert.Equal(suite.T(), "application/json; charset=UTF-8", res.Header.Get("Content-Type"))
+}
+
+func (suite *RouterTestSuite) TestJobListRouteRateLimited() {
+	suite.mockJob.On("List", mock.Anything, mock.Anything).Once().Run(func(arg mock.Arguments) {
+		w := arg.Get(0).(http.ResponseWriter)
+		_, _ = w.Write([]byte(`{"jobs":[],"page":1,"count":50}`))
+	})
+	suite.mockSassClient.On("GetTokenInfo", mock.Anything, mock.Anything).Return(client.TokenInfo{OrganizationID: "12345"}, nil)
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), ratelimit.Limits{RequestsPerSecond: 0.1, Burst: 1})
+
+	ts := httptest.NewServer(buildPublicRoutes(suite.controllers, auth.NewSSASProvider(suite.mockSassClient), limiter))
+
+	poll := func() *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/%s", ts.URL, "api/v2/Jobs"), nil)
+		req.Header.Add("Authorization", "Bearer hello")
+		res, _ := http.DefaultClient.Do(req)
+		return res
+	}
+
+	assert.Equal(suite.T(), http.StatusOK, poll().StatusCode)
+	res := poll()
+	body, _ := ioutil.ReadAll(res.Body)
+	assert.Equal(suite.T(), http.StatusTooManyRequests, res.StatusCode)
+	assert.Equal(suite.T(), "10", res.Header.Get("Retry-After"))
+	assert.Contains(suite.T(), string(body), "OperationOutcome")
+	suite.mockJob.AssertNumberOfCalls(suite.T(), "List", 1)
+}
+
+func (suite *RouterTestSuite) TestJobCancelRoute() {
+	suite.mockJob.On("Cancel", mock.Anything, mock.Anything).Once().Run(func(arg mock.Arguments) {
+		r := arg.Get(1).(*http.Request)
+		assert.Equal(suite.T(), "54321", r.Context().Value(constants.ContextKeyJobID))
+		w := arg.Get(0).(http.ResponseWriter)
+		w.WriteHeader(http.StatusAccepted)
+	})
+	suite.mockSassClient.On("GetTokenInfo", mock.Anything, mock.Anything).Return(client.TokenInfo{OrganizationID: "12345"}, nil)
+
+	ts := httptest.NewServer(suite.router)
+
+	req, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/%s", ts.URL, "api/v2/Jobs/54321"), nil)
+	req.Header.Add("Authorization", "Bearer hello")
+	res, _ := http.DefaultClient.Do(req)
+
+	assert.Equal(suite.T(), http.StatusAccepted, res.StatusCode)
+}
+
+func (suite *RouterTestSuite) TestWebhookRoutes() {
+	for _, method := range []string{"Read", "Update", "Delete", "Deliveries"} {
+		suite.mockWebhook.On(method, mock.Anything, mock.Anything).Once().Run(func(arg mock.Arguments) {
+			r := arg.Get(1).(*http.Request)
+			assert.Equal(suite.T(), "12345", r.Context().Value(constants.ContextKeyOrganization))
+		})
+	}
+	suite.mockSassClient.On("GetTokenInfo", mock.Anything, mock.Anything).Return(client.TokenInfo{OrganizationID: "12345"}, nil)
+
+	ts := httptest.NewServer(suite.router)
+
+	for _, route := range []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "api/v2/Webhook"},
+		{http.MethodPut, "api/v2/Webhook"},
+		{http.MethodDelete, "api/v2/Webhook"},
+		{http.MethodGet, "api/v2/Webhook/deliveries"},
+	} {
+		req, _ := http.NewRequest(route.method, fmt.Sprintf("%s/%s", ts.URL, route.path), strings.NewReader(`{"url":"https://example.com/hook"}`))
+		req.Header.Add("Authorization", "Bearer hello")
+		res, _ := http.DefaultClient.Do(req)
+
+		assert.Equal(suite.T(), http.StatusOK, res.StatusCode, route.path)
+		assert.Equal(suite.T(), "application/json; charset=UTF-8", res.Header.Get("Content-Type"))
+	}
+	suite.mockWebhook.AssertExpectations(suite.T())
+}
+
+func (suite *RouterTestSuite) TestWebhookRoutesReadOnlyScope() {
+	suite.mockWebhook.On("Read", mock.Anything, mock.Anything).Once()
+	suite.mockSassClient.On("GetTokenInfo", mock.Anything, mock.Anything).Return(client.TokenInfo{
+		OrganizationID: "12345",
+		Scope:          "dpcv2-api system/Group.read system/Patient.read",
+	}, nil)
+
+	ts := httptest.NewServer(suite.router)
+
+	for _, route := range []struct {
+		method string
+		status int
+	}{
+		{http.MethodGet, http.StatusOK},
+		{http.MethodPut, http.StatusForbidden},
+		{http.MethodDelete, http.StatusForbidden},
+	} {
+		req, _ := http.NewRequest(route.method, fmt.Sprintf("%s/%s", ts.URL, "api/v2/Webhook"), strings.NewReader(`{"url":"https://example.com/hook"}`))
+		req.Header.Add("Authorization", "Bearer hello")
+		res, _ := http.DefaultClient.Do(req)
+
+		assert.Equal(suite.T(), route.status, res.StatusCode, route.method)
+	}
+	suite.mockWebhook.AssertNotCalled(suite.T(), "Update", mock.Anything, mock.Anything)
+	suite.mockWebhook.AssertNotCalled(suite.T(), "Delete", mock.Anything, mock.Anything)
+}
+
+func (suite *RouterTestSuite) TestExportScheduleRoutes() {
+	for _, method := range []string{"List", "Create"} {
+		suite.mockSchedules.On(method, mock.Anything, mock.Anything).Once().Run(func(arg mock.Arguments) {
+			r := arg.Get(1).(*http.Request)
+			assert.Equal(suite.T(), "12345", r.Context().Value(constants.ContextKeyOrganization))
+		})
+	}
+	for _, method := range []string{"Read", "Update", "Delete"} {
+		suite.mockSchedules.On(method, mock.Anything, mock.Anything).Once().Run(func(arg mock.Arguments) {
+			r := arg.Get(1).(*http.Request)
+			assert.Equal(suite.T(), "12345", r.Context().Value(constants.ContextKeyOrganization))
+			assert.Equal(suite.T(), "54321", r.Context().Value(constants.ContextKeyExportSchedule))
+		})
+	}
+	suite.mockSassClient.On("GetTokenInfo", mock.Anything, mock.Anything).Return(client.TokenInfo{OrganizationID: "12345"}, nil)
+
+	ts := httptest.NewServer(suite.router)
+
+	for _, route := range []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "api/v2/ExportSchedule"},
+		{http.MethodPost, "api/v2/ExportSchedule"},
+		{http.MethodGet, "api/v2/ExportSchedule/54321"},
+		{http.MethodPut, "api/v2/ExportSchedule/54321"},
+		{http.MethodDelete, "api/v2/ExportSchedule/54321"},
+	} {
+		req, _ := http.NewRequest(route.method, fmt.Sprintf("%s/%s", ts.URL, route.path), strings.NewReader(`{"groupID":"67890","frequency":"DAILY"}`))
+		req.Header.Add("Authorization", "Bearer hello")
+		res, _ := http.DefaultClient.Do(req)
+
+		assert.Equal(suite.T(), http.StatusOK, res.StatusCode, route.method+" "+route.path)
+		assert.Equal(suite.T(), "application/json; charset=UTF-8", res.Header.Get("Content-Type"))
+	}
+	suite.mockSchedules.AssertExpectations(suite.T())
+}
@@ -0,0 +1,270 @@
+package ssastest
+
+import (
+	"crypto/rand"
+	b64 "encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CMSgov/dpc/api/auth"
+	"github.com/CMSgov/dpc/api/client"
+	"github.com/CMSgov/dpc/api/model"
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+)
+
+func (s *Server) createGroup(w http.ResponseWriter, r *http.Request) {
+	var req client.CreateGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.GroupID == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "group_id is required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.groups[req.GroupID]; ok {
+		writeError(w, http.StatusBadRequest, "invalid_request", "group already exists")
+		return
+	}
+	s.nextID++
+	g := &group{ID: s.nextID, GroupID: req.GroupID, Name: req.Name, XData: req.XData}
+	s.groups[g.GroupID] = g
+
+	writeJSON(w, http.StatusCreated, client.CreateGroupResponse{ID: g.ID, GroupID: g.GroupID})
+}
+
+func (s *Server) createSystem(w http.ResponseWriter, r *http.Request) {
+	var req client.CreateSystemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "could not parse request")
+		return
+	}
+	if req.ClientName == "" || req.Scope == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "client_name and scope are required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.groups[req.GroupID]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid_request", "group not found")
+		return
+	}
+
+	now := time.Now()
+	s.nextID++
+	sys := &system{
+		ID:         strconv.Itoa(s.nextID),
+		GID:        g.ID,
+		GroupID:    g.GroupID,
+		ClientID:   uuid.New().String(),
+		ClientName: req.ClientName,
+		Scope:      req.Scope,
+		XData:      req.XData,
+	}
+	for _, addr := range req.IPs {
+		sys.IPs = append(sys.IPs, ip{ID: uuid.New().String(), Address: addr, CreatedAt: now})
+	}
+
+	var keyID string
+	if req.PublicKey != "" {
+		k, err := newPublicKey(req.PublicKey, req.Signature)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		sys.PublicKeys = append(sys.PublicKeys, k)
+		keyID = k.ID
+	}
+
+	ct, err := s.newClientToken("Initial Token")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	sys.ClientTokens = append(sys.ClientTokens, ct)
+	s.systems[sys.ID] = sys
+
+	writeJSON(w, http.StatusCreated, client.CreateSystemResponse{
+		SystemID:    sys.ID,
+		ClientName:  sys.ClientName,
+		GroupID:     sys.GroupID,
+		Scope:       sys.Scope,
+		PublicKey:   req.PublicKey,
+		IPs:         req.IPs,
+		ClientID:    sys.ClientID,
+		ClientToken: ct.Token,
+		ExpiresAt:   ct.ExpiresAt.Format(time.RFC3339),
+		XData:       sys.XData,
+		PublicKeyID: keyID,
+	})
+}
+
+func (s *Server) getSystem(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sys, ok := s.systems[chi.URLParam(r, "systemID")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "system not found")
+		return
+	}
+
+	resp := client.GetSystemResponse{
+		GID:          strconv.Itoa(sys.GID),
+		GroupID:      sys.GroupID,
+		ClientID:     sys.ClientID,
+		SoftwareID:   "",
+		ClientName:   sys.ClientName,
+		APIScope:     sys.Scope,
+		XData:        sys.XData,
+		PublicKeys:   []map[string]string{},
+		IPs:          []map[string]string{},
+		ClientTokens: []map[string]string{},
+	}
+	if !sys.LastTokenAt.IsZero() {
+		resp.LastTokenAt = sys.LastTokenAt.Format(time.RFC3339)
+	}
+	for _, k := range sys.PublicKeys {
+		resp.PublicKeys = append(resp.PublicKeys, map[string]string{"id": k.ID, "key": k.Key, "creation_date": k.CreatedAt.Format(time.RFC3339)})
+	}
+	for _, i := range sys.IPs {
+		resp.IPs = append(resp.IPs, map[string]string{"id": i.ID, "ip": i.Address, "creation_date": i.CreatedAt.Format(time.RFC3339)})
+	}
+	for _, t := range sys.ClientTokens {
+		resp.ClientTokens = append(resp.ClientTokens, map[string]string{
+			"id":            t.UUID,
+			"uuid":          t.UUID,
+			"label":         t.Label,
+			"creation_date": t.CreatedAt.Format(time.RFC3339),
+			"expires_at":    t.ExpiresAt.Format(time.RFC3339),
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) createToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Label string `json:"label"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "could not parse request")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sys, ok := s.systems[chi.URLParam(r, "systemID")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "system not found")
+		return
+	}
+	ct, err := s.newClientToken(req.Label)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	sys.ClientTokens = append(sys.ClientTokens, ct)
+
+	writeJSON(w, http.StatusCreated, map[string]string{
+		"Token":     ct.Token,
+		"UUID":      ct.UUID,
+		"Label":     ct.Label,
+		"ExpiresAt": ct.ExpiresAt.Format(time.RFC3339),
+	})
+}
+
+func (s *Server) deleteToken(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sys, ok := s.systems[chi.URLParam(r, "systemID")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "system not found")
+		return
+	}
+	tokenID := chi.URLParam(r, "tokenID")
+	for i, t := range sys.ClientTokens {
+		if t.UUID == tokenID {
+			sys.ClientTokens = append(sys.ClientTokens[:i], sys.ClientTokens[i+1:]...)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "not_found", "token not found")
+}
+
+func (s *Server) addKey(w http.ResponseWriter, r *http.Request) {
+	var req model.ProxyPublicKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "could not parse request")
+		return
+	}
+	k, err := newPublicKey(req.PublicKey, req.Signature)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sys, ok := s.systems[chi.URLParam(r, "systemID")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "system not found")
+		return
+	}
+	sys.PublicKeys = append(sys.PublicKeys, k)
+
+	writeJSON(w, http.StatusCreated, map[string]string{
+		"client_id":  sys.ClientID,
+		"public_key": k.Key,
+		"id":         k.ID,
+	})
+}
+
+func (s *Server) deleteKey(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sys, ok := s.systems[chi.URLParam(r, "systemID")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "system not found")
+		return
+	}
+	keyID := chi.URLParam(r, "keyID")
+	for i, k := range sys.PublicKeys {
+		if k.ID == keyID {
+			sys.PublicKeys = append(sys.PublicKeys[:i], sys.PublicKeys[i+1:]...)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "not_found", "key not found")
+}
+
+// newPublicKey checks the key and signature the same way SSAS does, without DPC's stricter key policy
+func newPublicKey(pemKey string, signature string) (publicKey, error) {
+	pub, err := auth.ParsePublicKey(pemKey)
+	if err != nil {
+		return publicKey{}, err
+	}
+	if err := auth.VerifySnippetSignature(pub, signature); err != nil {
+		return publicKey{}, err
+	}
+	return publicKey{ID: uuid.New().String(), Key: pemKey, CreatedAt: time.Now()}, nil
+}
+
+func (s *Server) newClientToken(label string) (clientToken, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return clientToken{}, err
+	}
+	now := time.Now()
+	return clientToken{
+		UUID:      uuid.New().String(),
+		Label:     label,
+		Token:     b64.RawURLEncoding.EncodeToString(b),
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.config.ClientTokenTTL),
+	}, nil
+}
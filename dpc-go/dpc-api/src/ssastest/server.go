@@ -0,0 +1,184 @@
+// Package ssastest provides an in-memory stand-in for the SSAS public and admin APIs.
+// It implements the endpoints used by client.SsasHTTPClient and signs RS384 access tokens with a local key,
+// so it can back dpc-api tests through httptest or run as a standalone binary for local development.
+package ssastest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+const (
+	// DefaultAccessTokenTTL is how long minted access tokens are valid for
+	DefaultAccessTokenTTL = 5 * time.Minute
+	// DefaultClientTokenTTL is how long client tokens created through the admin API are valid for
+	DefaultClientTokenTTL = 90 * 24 * time.Hour
+	// Issuer is the iss claim of every access token signed by the stand-in
+	Issuer = "ssas"
+)
+
+// Config holds the options for a stand-in server
+type Config struct {
+	// ClientID and ClientSecret are the admin credentials. Admin requests are not authenticated when ClientID is empty.
+	ClientID     string
+	ClientSecret string
+	// SigningKey is used to sign access tokens. A new 2048 bit key is generated when nil.
+	SigningKey     *rsa.PrivateKey
+	AccessTokenTTL time.Duration
+	ClientTokenTTL time.Duration
+}
+
+// Server is an in-memory SSAS stand-in
+type Server struct {
+	config Config
+	key    *rsa.PrivateKey
+
+	mu           sync.Mutex
+	nextID       int
+	groups       map[string]*group
+	systems      map[string]*system
+	assertionIDs map[string]bool
+}
+
+type group struct {
+	ID      int
+	GroupID string
+	Name    string
+	XData   string
+}
+
+type system struct {
+	ID           string
+	GID          int
+	GroupID      string
+	ClientID     string
+	ClientName   string
+	Scope        string
+	XData        string
+	LastTokenAt  time.Time
+	IPs          []ip
+	PublicKeys   []publicKey
+	ClientTokens []clientToken
+}
+
+type ip struct {
+	ID        string
+	Address   string
+	CreatedAt time.Time
+}
+
+type publicKey struct {
+	ID        string
+	Key       string
+	CreatedAt time.Time
+}
+
+type clientToken struct {
+	UUID      string
+	Label     string
+	Token     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// NewServer creates an empty stand-in server
+func NewServer(config Config) (*Server, error) {
+	if config.AccessTokenTTL == 0 {
+		config.AccessTokenTTL = DefaultAccessTokenTTL
+	}
+	if config.ClientTokenTTL == 0 {
+		config.ClientTokenTTL = DefaultClientTokenTTL
+	}
+	key := config.SigningKey
+	if key == nil {
+		var err error
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &Server{
+		config:       config,
+		key:          key,
+		groups:       make(map[string]*group),
+		systems:      make(map[string]*system),
+		assertionIDs: make(map[string]bool),
+	}, nil
+}
+
+// PublicKey returns the key that verifies access tokens signed by the server
+func (s *Server) PublicKey() *rsa.PublicKey {
+	return &s.key.PublicKey
+}
+
+// Handler serves both the public and the admin SSAS routes, since their paths do not overlap
+func (s *Server) Handler() http.Handler {
+	r := chi.NewRouter()
+	r.Post("/token", s.basicAuthToken)
+	r.Route("/v2", func(r chi.Router) {
+		r.Post("/token", s.authenticate)
+		r.Post("/token_info", s.tokenInfo)
+		r.Post("/introspect", s.introspect)
+
+		r.Group(func(r chi.Router) {
+			r.Use(s.adminAuth)
+			r.Post("/group", s.createGroup)
+			r.Post("/system", s.createSystem)
+			r.Route("/system/{systemID}", func(r chi.Router) {
+				r.Get("/", s.getSystem)
+				r.Post("/token", s.createToken)
+				r.Delete("/token/{tokenID}", s.deleteToken)
+				r.Post("/key", s.addKey)
+				r.Delete("/key/{keyID}", s.deleteKey)
+			})
+		})
+	})
+	return r
+}
+
+func (s *Server) adminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.config.ClientID != "" {
+			id, secret, ok := r.BasicAuth()
+			if !ok || id != s.config.ClientID || secret != s.config.ClientSecret {
+				writeError(w, http.StatusUnauthorized, "invalid_client", "invalid admin credentials")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// findSystem must be called with s.mu held
+func (s *Server) findSystem(match func(*system) bool) *system {
+	for _, sys := range s.systems {
+		if match(sys) {
+			return sys
+		}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, code string, description string) {
+	writeJSON(w, status, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+func splitScope(scope string) []string {
+	return strings.Fields(scope)
+}
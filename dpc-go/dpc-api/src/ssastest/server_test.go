@@ -0,0 +1,197 @@
+package ssastest
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/CMSgov/dpc/api/apitest"
+	"github.com/CMSgov/dpc/api/auth"
+	"github.com/CMSgov/dpc/api/client"
+	"github.com/CMSgov/dpc/api/model"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ServerTestSuite struct {
+	suite.Suite
+	server *Server
+	ts     *httptest.Server
+	client client.SsasClient
+}
+
+func (suite *ServerTestSuite) SetupTest() {
+	s, err := NewServer(Config{ClientID: "admin", ClientSecret: "secret"})
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	suite.server = s
+	suite.ts = httptest.NewServer(s.Handler())
+	suite.client = client.NewSsasHTTPClient(context.Background(), client.SsasHTTPClientConfig{
+		PublicURL:    suite.ts.URL,
+		AdminURL:     suite.ts.URL,
+		ClientID:     "admin",
+		ClientSecret: "secret",
+	})
+}
+
+func (suite *ServerTestSuite) TearDownTest() {
+	suite.ts.Close()
+}
+
+func TestServerTestSuite(t *testing.T) {
+	suite.Run(t, new(ServerTestSuite))
+}
+
+func (suite *ServerTestSuite) createSystem() client.CreateSystemResponse {
+	ctx := context.Background()
+	_, err := suite.client.CreateGroup(ctx, client.CreateGroupRequest{Name: "Test Implementer", GroupID: "group-1"})
+	assert.NoError(suite.T(), err)
+
+	key := apitest.TestRSAKey()
+	resp, err := suite.client.CreateSystem(ctx, client.CreateSystemRequest{
+		ClientName: "Test Client",
+		GroupID:    "group-1",
+		Scope:      "dpcv2-api",
+		PublicKey:  apitest.PublicKeyPEM(key.Public()),
+		Signature:  apitest.SignSnippet(key),
+		IPs:        []string{"127.0.0.1"},
+		XData:      `{"organizationID": "org-1"}`,
+	})
+	assert.NoError(suite.T(), err)
+	return resp
+}
+
+func (suite *ServerTestSuite) TestSystemLifecycle() {
+	ctx := context.Background()
+	created := suite.createSystem()
+	assert.NotEmpty(suite.T(), created.ClientToken)
+	assert.NotEmpty(suite.T(), created.PublicKeyID)
+
+	token, err := suite.client.CreateToken(ctx, created.SystemID, "second token")
+	assert.NoError(suite.T(), err)
+	assert.NotEmpty(suite.T(), token)
+
+	sys, err := suite.client.GetSystem(ctx, created.SystemID)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), created.ClientID, sys.ClientID)
+	assert.Len(suite.T(), sys.PublicKeys, 1)
+	assert.Len(suite.T(), sys.ClientTokens, 2)
+	assert.Equal(suite.T(), "127.0.0.1", sys.IPs[0]["ip"])
+
+	assert.NoError(suite.T(), suite.client.DeleteToken(ctx, created.SystemID, sys.ClientTokens[1]["id"]))
+	assert.NoError(suite.T(), suite.client.DeletePublicKey(ctx, created.SystemID, created.PublicKeyID))
+	assert.Error(suite.T(), suite.client.DeletePublicKey(ctx, created.SystemID, created.PublicKeyID))
+
+	sys, _ = suite.client.GetSystem(ctx, created.SystemID)
+	assert.Len(suite.T(), sys.PublicKeys, 0)
+	assert.Len(suite.T(), sys.ClientTokens, 1)
+}
+
+func (suite *ServerTestSuite) TestAddPublicKeyBadSignature() {
+	created := suite.createSystem()
+	_, err := suite.client.AddPublicKey(context.Background(), created.SystemID, model.ProxyPublicKeyRequest{
+		PublicKey: apitest.PublicKeyPEM(apitest.TestRSAKey().Public()),
+		Signature: "c2lnbmF0dXJl",
+	})
+	assert.Error(suite.T(), err)
+}
+
+func (suite *ServerTestSuite) TestAdminRequiresCredentials() {
+	c := client.NewSsasHTTPClient(context.Background(), client.SsasHTTPClientConfig{AdminURL: suite.ts.URL})
+	_, err := c.CreateGroup(context.Background(), client.CreateGroupRequest{Name: "Test", GroupID: "group-2"})
+	assert.Error(suite.T(), err)
+}
+
+func (suite *ServerTestSuite) TestAuthenticateAndValidate() {
+	ctx := context.Background()
+	created := suite.createSystem()
+
+	form := url.Values{
+		"scope":                 {"system/*.*"},
+		"grant_type":            {"client_credentials"},
+		"client_assertion_type": {jwtBearerAssertion},
+		"client_assertion":      {suite.clientAssertion(created)},
+	}
+	resBytes, err := suite.client.Authenticate(ctx, []byte(form.Encode()))
+	assert.NoError(suite.T(), err)
+	assert.Contains(suite.T(), string(resBytes), "access_token")
+
+	accessToken, err := suite.server.IssueAccessToken(created.SystemID)
+	assert.NoError(suite.T(), err)
+
+	info, err := suite.client.GetTokenInfo(ctx, accessToken)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "org-1", info.OrganizationID)
+	assert.Equal(suite.T(), "dpcv2-api", info.Scope)
+
+	resBytes, err = suite.client.ValidateToken(ctx, []byte(url.Values{"token": {accessToken}}.Encode()))
+	assert.NoError(suite.T(), err)
+	assert.Contains(suite.T(), string(resBytes), `"active":true`)
+
+	_, err = suite.client.GetTokenInfo(ctx, "not-a-token")
+	assert.Error(suite.T(), err)
+}
+
+func (suite *ServerTestSuite) TestLocalJWTProvider() {
+	ctx := context.Background()
+	created := suite.createSystem()
+	accessToken, err := suite.server.IssueAccessToken(created.SystemID)
+	assert.NoError(suite.T(), err)
+
+	p, err := auth.NewLocalJWTProvider(auth.LocalJWTConfig{
+		PublicKey:     suite.server.PublicKey(),
+		Issuer:        Issuer,
+		Authenticator: suite.client,
+	})
+	assert.NoError(suite.T(), err)
+
+	info, err := p.GetTokenInfo(ctx, accessToken)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "org-1", info.OrganizationID)
+	assert.Equal(suite.T(), "dpcv2-api", info.Scope)
+
+	form := url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_assertion_type": {jwtBearerAssertion},
+		"client_assertion":      {suite.clientAssertion(created)},
+	}
+	resBytes, err := p.Authenticate(ctx, []byte(form.Encode()))
+	assert.NoError(suite.T(), err)
+	assert.Contains(suite.T(), string(resBytes), "access_token")
+}
+
+func (suite *ServerTestSuite) TestAuthenticateRejectsReplayedAssertion() {
+	created := suite.createSystem()
+	form := url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_assertion_type": {jwtBearerAssertion},
+		"client_assertion":      {suite.clientAssertion(created)},
+	}
+	_, err := suite.client.Authenticate(context.Background(), []byte(form.Encode()))
+	assert.NoError(suite.T(), err)
+	_, err = suite.client.Authenticate(context.Background(), []byte(form.Encode()))
+	assert.Error(suite.T(), err)
+}
+
+func (suite *ServerTestSuite) clientAssertion(created client.CreateSystemResponse) string {
+	now := time.Now()
+	t := jwt.NewWithClaims(jwt.SigningMethodRS384, jwt.StandardClaims{
+		Issuer:    created.ClientToken,
+		Subject:   created.ClientToken,
+		Audience:  suite.ts.URL + "/v2/Token/auth",
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(5 * time.Minute).Unix(),
+		Id:        uuid.New().String(),
+	})
+	t.Header["kid"] = created.PublicKeyID
+	signed, err := t.SignedString(apitest.TestRSAKey())
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	return signed
+}
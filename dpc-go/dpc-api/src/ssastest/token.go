@@ -0,0 +1,234 @@
+package ssastest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CMSgov/dpc/api/auth"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	jwtBearerAssertion = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	maxAssertionTTL    = 5 * time.Minute
+)
+
+// IssueAccessToken mints an access token for the system without going through the client assertion flow
+func (s *Server) IssueAccessToken(systemID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sys, ok := s.systems[systemID]
+	if !ok {
+		return "", errors.Errorf("system %s not found", systemID)
+	}
+	return s.issue(sys)
+}
+
+// issue must be called with s.mu held
+func (s *Server) issue(sys *system) (string, error) {
+	now := time.Now()
+	id := uuid.New().String()
+	claims := auth.CommonClaims{
+		ClientID: sys.ClientID,
+		SystemID: sys.ID,
+		Data:     sys.XData,
+		Scopes:   splitScope(sys.Scope),
+		UUID:     id,
+		StandardClaims: jwt.StandardClaims{
+			Id:        id,
+			Issuer:    Issuer,
+			Subject:   sys.ClientID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(s.config.AccessTokenTTL).Unix(),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS384, claims).SignedString(s.key)
+	if err != nil {
+		return "", err
+	}
+	sys.LastTokenAt = now
+	return token, nil
+}
+
+// parseAccessToken must be called with s.mu held
+func (s *Server) parseAccessToken(token string) (*auth.CommonClaims, *system, error) {
+	claims := &auth.CommonClaims{}
+	parser := &jwt.Parser{ValidMethods: []string{jwt.SigningMethodRS384.Alg()}}
+	if _, err := parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return s.PublicKey(), nil
+	}); err != nil {
+		return nil, nil, err
+	}
+	if claims.Issuer != Issuer {
+		return nil, nil, errors.Errorf("unexpected issuer %s", claims.Issuer)
+	}
+	sys, ok := s.systems[claims.SystemID]
+	if !ok {
+		return nil, nil, errors.Errorf("system %s not found", claims.SystemID)
+	}
+	return claims, sys, nil
+}
+
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "could not parse form")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "client_credentials" {
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be client_credentials")
+		return
+	}
+	if r.PostForm.Get("client_assertion_type") != jwtBearerAssertion {
+		writeError(w, http.StatusBadRequest, "invalid_client", fmt.Sprintf("client_assertion_type must be %s", jwtBearerAssertion))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sys *system
+	claims := &jwt.StandardClaims{}
+	parser := &jwt.Parser{ValidMethods: []string{jwt.SigningMethodRS384.Alg(), jwt.SigningMethodES384.Alg()}}
+	_, err := parser.ParseWithClaims(r.PostForm.Get("client_assertion"), claims, func(t *jwt.Token) (interface{}, error) {
+		sys = s.findSystem(func(sys *system) bool {
+			_, ok := sys.clientToken(claims.Issuer)
+			return ok
+		})
+		if sys == nil {
+			return nil, errors.New("client token not found or expired")
+		}
+		kid, _ := t.Header["kid"].(string)
+		for _, k := range sys.PublicKeys {
+			if k.ID == kid {
+				return auth.ParsePublicKey(k.Key)
+			}
+		}
+		return nil, errors.Errorf("public key %s not found", kid)
+	})
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "invalid_client", err.Error())
+		return
+	}
+	if claims.Subject != claims.Issuer {
+		writeError(w, http.StatusBadRequest, "invalid_client", "sub and iss must both be the client token")
+		return
+	}
+	if claims.ExpiresAt == 0 || time.Unix(claims.ExpiresAt, 0).After(time.Now().Add(maxAssertionTTL)) {
+		writeError(w, http.StatusBadRequest, "invalid_client", "exp must be set and no more than 5 minutes in the future")
+		return
+	}
+	if claims.Id == "" || s.assertionIDs[claims.Id] {
+		writeError(w, http.StatusBadRequest, "invalid_client", "jti must be set and unique")
+		return
+	}
+	s.assertionIDs[claims.Id] = true
+
+	s.writeAccessToken(w, sys)
+}
+
+func (s *Server) basicAuthToken(w http.ResponseWriter, r *http.Request) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid_request", "basic auth is required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sys := s.findSystem(func(sys *system) bool {
+		_, ok := sys.clientToken(secret)
+		return sys.ClientID == clientID && ok
+	})
+	if sys == nil {
+		writeError(w, http.StatusUnauthorized, "invalid_client", "invalid client credentials")
+		return
+	}
+	s.writeAccessToken(w, sys)
+}
+
+// writeAccessToken must be called with s.mu held
+func (s *Server) writeAccessToken(w http.ResponseWriter, sys *system) {
+	token, err := s.issue(sys)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "bearer",
+		"expires_in":   int(s.config.AccessTokenTTL.Seconds()),
+		"scope":        sys.Scope,
+	})
+}
+
+func (s *Server) tokenInfo(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	claims, sys, err := s.parseAccessToken(req.Token)
+	if err != nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"valid": false})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"valid":       true,
+		"client_id":   sys.ClientID,
+		"system_data": sys.XData,
+		"scope":       strings.Join(claims.Scopes, " "),
+		"expires_at":  claims.ExpiresAt,
+	})
+}
+
+func (s *Server) introspect(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("token") == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	claims, sys, err := s.parseAccessToken(r.PostForm.Get("token"))
+	if err != nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"active": false})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"active":     true,
+		"scope":      strings.Join(claims.Scopes, " "),
+		"client_id":  sys.ClientID,
+		"token_type": "bearer",
+		"sub":        claims.Subject,
+		"iss":        claims.Issuer,
+		"exp":        claims.ExpiresAt,
+		"iat":        claims.IssuedAt,
+		"jti":        claims.Id,
+	})
+}
+
+// clientToken finds an unexpired client token by value
+func (sys *system) clientToken(token string) (clientToken, bool) {
+	if token == "" {
+		return clientToken{}, false
+	}
+	now := time.Now()
+	for _, t := range sys.ClientTokens {
+		if t.Token == token && now.Before(t.ExpiresAt) {
+			return t, true
+		}
+	}
+	return clientToken{}, false
+}
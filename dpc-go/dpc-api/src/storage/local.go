@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+)
+
+// LocalStore keeps objects as files in a directory, which the API and the export worker must share
+type LocalStore struct {
+	root string
+}
+
+// NewLocalStore creates a store of the files in the root directory
+func NewLocalStore(root string) *LocalStore {
+	return &LocalStore{root}
+}
+
+// Open opens the named file, which can be seeked so it can be served in ranges
+func (s *LocalStore) Open(ctx context.Context, name string) (*Object, error) {
+	f, err := os.Open(filepath.Join(s.root, filepath.Clean("/"+name)))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &Object{Body: f, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// PresignedURL is not supported, the files are only reachable through the API
+func (s *LocalStore) PresignedURL(ctx context.Context, name string, headers ResponseHeaders) (string, error) {
+	return "", ErrPresignNotSupported
+}
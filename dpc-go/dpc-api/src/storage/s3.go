@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// S3Config is a struct to hold the configuration of an S3 compatible store
+type S3Config struct {
+	Bucket string
+	// Prefix is prepended to the names of the objects in the bucket
+	Prefix string
+	Region string
+	// Endpoint overrides the AWS endpoint, for S3 compatible services like MinIO
+	Endpoint       string
+	ForcePathStyle bool
+	// AccessKeyID and SecretAccessKey are optional, the default AWS credential chain is used without them
+	AccessKeyID     string
+	SecretAccessKey string
+	// PresignExpiry is how long pre-signed URLs are valid for, they are not handed out when it is zero
+	PresignExpiry time.Duration
+}
+
+// S3Store keeps objects in an S3 compatible bucket
+type S3Store struct {
+	config S3Config
+	client *s3.S3
+}
+
+// NewS3Store creates a store of the objects in the configured bucket
+func NewS3Store(config S3Config) (*S3Store, error) {
+	awsConfig := aws.NewConfig().WithRegion(config.Region).WithS3ForcePathStyle(config.ForcePathStyle)
+	if config.Endpoint != "" {
+		awsConfig = awsConfig.WithEndpoint(config.Endpoint)
+	}
+	if config.AccessKeyID != "" {
+		awsConfig = awsConfig.WithCredentials(credentials.NewStaticCredentials(config.AccessKeyID, config.SecretAccessKey, ""))
+	}
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &S3Store{config: config, client: s3.New(sess)}, nil
+}
+
+func (s *S3Store) key(name string) string {
+	return path.Join(s.config.Prefix, name)
+}
+
+// Open streams the named object from the bucket
+func (s *S3Store) Open(ctx context.Context, name string) (*Object, error) {
+	out, err := s.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.config.Bucket),
+		Key:    aws.String(s.key(name)),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Object{Body: out.Body, Size: aws.Int64Value(out.ContentLength), ModTime: aws.TimeValue(out.LastModified)}, nil
+}
+
+// PresignedURL returns a URL for getting the named object from the bucket, served with the given headers
+func (s *S3Store) PresignedURL(ctx context.Context, name string, headers ResponseHeaders) (string, error) {
+	if s.config.PresignExpiry <= 0 {
+		return "", ErrPresignNotSupported
+	}
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.config.Bucket),
+		Key:    aws.String(s.key(name)),
+	}
+	if headers.ContentType != "" {
+		input.ResponseContentType = aws.String(headers.ContentType)
+	}
+	if headers.ContentEncoding != "" {
+		input.ResponseContentEncoding = aws.String(headers.ContentEncoding)
+	}
+	if headers.ContentDisposition != "" {
+		input.ResponseContentDisposition = aws.String(headers.ContentDisposition)
+	}
+	req, _ := s.client.GetObjectRequest(input)
+	req.SetContext(ctx)
+	return req.Presign(s.config.PresignExpiry)
+}
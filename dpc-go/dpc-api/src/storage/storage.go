@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/CMSgov/dpc/api/conf"
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned when an object does not exist in the store
+var ErrNotFound = errors.New("object not found")
+
+// ErrPresignNotSupported is returned when a store does not hand out pre-signed URLs
+var ErrPresignNotSupported = errors.New("pre-signed URLs are not supported")
+
+// Object is an export file opened for streaming. Body is an io.ReadSeeker when the store supports seeking.
+type Object struct {
+	Body    io.ReadCloser
+	Size    int64
+	ModTime time.Time
+}
+
+// ResponseHeaders are the headers a pre-signed URL has its object served with
+type ResponseHeaders struct {
+	ContentType        string
+	ContentEncoding    string
+	ContentDisposition string
+}
+
+// Store is where the export worker keeps the files it writes, so any instance of the API can serve them
+type Store interface {
+	// Open opens the named object for streaming
+	Open(ctx context.Context, name string) (*Object, error)
+	// PresignedURL returns a time limited URL the client can download the named object from directly
+	PresignedURL(ctx context.Context, name string, headers ResponseHeaders) (string, error)
+}
+
+// NewStore creates the store set by the storage.type config, the local exportPath directory by default
+func NewStore() (Store, error) {
+	switch t := conf.GetAsString("storage.type", "local"); t {
+	case "local":
+		return NewLocalStore(conf.GetAsString("exportPath")), nil
+	case "s3":
+		return NewS3Store(S3Config{
+			Bucket:          conf.GetAsString("storage.s3.bucket"),
+			Prefix:          conf.GetAsString("storage.s3.prefix"),
+			Region:          conf.GetAsString("storage.s3.region", "us-east-1"),
+			Endpoint:        conf.GetAsString("storage.s3.endpoint"),
+			ForcePathStyle:  conf.GetAsString("storage.s3.forcePathStyle", "false") == "true",
+			AccessKeyID:     conf.GetAsString("storage.s3.accessKeyID"),
+			SecretAccessKey: conf.GetAsString("storage.s3.secretAccessKey"),
+			PresignExpiry:   time.Duration(conf.GetAsInt("storage.s3.presignSeconds", 0)) * time.Second,
+		})
+	default:
+		return nil, fmt.Errorf("unsupported storage type %s", t)
+	}
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// fakeS3 is a stand-in for an S3 compatible service like MinIO, serving objects from memory with path style URLs
+type fakeS3 struct {
+	*httptest.Server
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3() *fakeS3 {
+	f := &fakeS3{objects: make(map[string][]byte)}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	return f
+}
+
+func (f *fakeS3) serve(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		b, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+			return
+		}
+		w.Header().Set("Last-Modified", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC).Format(http.TimeFormat))
+		w.Header().Set("Content-Length", fmt.Sprint(len(b)))
+		_, _ = w.Write(b)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+type StorageTestSuite struct {
+	suite.Suite
+	s3 *fakeS3
+}
+
+func TestStorageTestSuite(t *testing.T) {
+	suite.Run(t, new(StorageTestSuite))
+}
+
+func (suite *StorageTestSuite) SetupTest() {
+	suite.s3 = newFakeS3()
+}
+
+func (suite *StorageTestSuite) TearDownTest() {
+	suite.s3.Close()
+}
+
+func (suite *StorageTestSuite) store(presignExpiry time.Duration) *S3Store {
+	store, err := NewS3Store(S3Config{
+		Bucket:          "exports",
+		Prefix:          "dpc",
+		Region:          "us-east-1",
+		Endpoint:        suite.s3.URL,
+		ForcePathStyle:  true,
+		AccessKeyID:     "test-key",
+		SecretAccessKey: "test-secret",
+		PresignExpiry:   presignExpiry,
+	})
+	assert.NoError(suite.T(), err)
+	return store
+}
+
+func (suite *StorageTestSuite) TestLocalStore() {
+	dir := suite.T().TempDir()
+	assert.NoError(suite.T(), ioutil.WriteFile(filepath.Join(dir, "batch-0.patient.ndjson.gz"), []byte("data"), 0600))
+	store := NewLocalStore(dir)
+
+	obj, err := store.Open(context.Background(), "batch-0.patient.ndjson.gz")
+	assert.NoError(suite.T(), err)
+	b, _ := ioutil.ReadAll(obj.Body)
+	_ = obj.Body.Close()
+	assert.Equal(suite.T(), "data", string(b))
+	assert.Equal(suite.T(), int64(4), obj.Size)
+	assert.Implements(suite.T(), (*io.Seeker)(nil), obj.Body)
+
+	_, err = store.Open(context.Background(), "missing.ndjson")
+	assert.ErrorIs(suite.T(), err, ErrNotFound)
+
+	_, err = store.PresignedURL(context.Background(), "batch-0.patient.ndjson.gz", ResponseHeaders{})
+	assert.ErrorIs(suite.T(), err, ErrPresignNotSupported)
+}
+
+func (suite *StorageTestSuite) TestS3Open() {
+	suite.s3.objects["/exports/dpc/batch-0.patient.ndjson.gz"] = []byte("data")
+	store := suite.store(0)
+
+	obj, err := store.Open(context.Background(), "batch-0.patient.ndjson.gz")
+	assert.NoError(suite.T(), err)
+	b, _ := ioutil.ReadAll(obj.Body)
+	_ = obj.Body.Close()
+	assert.Equal(suite.T(), "data", string(b))
+	assert.Equal(suite.T(), int64(4), obj.Size)
+	assert.Equal(suite.T(), time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), obj.ModTime.UTC())
+
+	_, err = store.Open(context.Background(), "missing.ndjson")
+	assert.ErrorIs(suite.T(), err, ErrNotFound)
+}
+
+func (suite *StorageTestSuite) TestS3PresignedURL() {
+	_, err := suite.store(0).PresignedURL(context.Background(), "batch-0.patient.ndjson.gz", ResponseHeaders{})
+	assert.ErrorIs(suite.T(), err, ErrPresignNotSupported)
+
+	u, err := suite.store(5*time.Minute).PresignedURL(context.Background(), "batch-0.patient.ndjson.gz", ResponseHeaders{
+		ContentType:     "application/octet-stream",
+		ContentEncoding: "gzip",
+	})
+	assert.NoError(suite.T(), err)
+	parsed, err := url.Parse(u)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "/exports/dpc/batch-0.patient.ndjson.gz", parsed.Path)
+	assert.Equal(suite.T(), "gzip", parsed.Query().Get("response-content-encoding"))
+	assert.Equal(suite.T(), "300", parsed.Query().Get("X-Amz-Expires"))
+	assert.NotEmpty(suite.T(), parsed.Query().Get("X-Amz-Signature"))
+	assert.True(suite.T(), strings.HasPrefix(u, suite.s3.URL))
+}
@@ -36,9 +36,17 @@ type ExportController interface {
 	Export(w http.ResponseWriter, r *http.Request)
 }
 
+// PatientExportController is an interface for patient level exports
+type PatientExportController interface {
+	ExportController
+	Everything(w http.ResponseWriter, r *http.Request)
+}
+
 // JobController is an interface for job status
 type JobController interface {
 	Status(w http.ResponseWriter, r *http.Request)
+	Cancel(w http.ResponseWriter, r *http.Request)
+	List(w http.ResponseWriter, r *http.Request)
 }
 
 // FileController is an interface for getting a file
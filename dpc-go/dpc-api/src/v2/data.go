@@ -1,6 +1,13 @@
 package v2
 
 import (
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/CMSgov/dpc/api/client"
@@ -9,20 +16,109 @@ import (
 	"github.com/CMSgov/dpc/api/fhirror"
 	"github.com/CMSgov/dpc/api/logger"
 	"github.com/CMSgov/dpc/api/model"
+	"github.com/CMSgov/dpc/api/storage"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"io"
 	"net/http"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
+// errCorruptFile is returned when a stored export file doesn't match the length and checksum recorded when written
+var errCorruptFile = errors.New("file does not match its recorded checksum")
+
 // DataController is a struct that defines what the controller has
 type DataController struct {
-	c client.DataClient
+	c     client.DataClient
+	store storage.Store
+	// verified remembers the size and modification time of the stored files that passed verification, so resuming
+	// a download doesn't read the whole file again
+	verified *verifiedFiles
 }
 
 // NewDataController function that creates a data controller and returns it's reference
-func NewDataController(c client.DataClient) *DataController {
+func NewDataController(c client.DataClient, store storage.Store) *DataController {
 	return &DataController{
 		c,
+		store,
+		newVerifiedFiles(conf.GetAsInt("storage.verifiedFiles", 10000)),
+	}
+}
+
+// verifiedFile is the stored file a verification passed for
+type verifiedFile struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+// verifiedFiles holds the most recently verified stored files, up to its capacity, evicting the least recently used
+type verifiedFiles struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	files    map[string]*list.Element
+}
+
+func newVerifiedFiles(capacity int) *verifiedFiles {
+	return &verifiedFiles{
+		capacity: capacity,
+		order:    list.New(),
+		files:    make(map[string]*list.Element),
+	}
+}
+
+// passed reports whether the stored file was verified as it is now
+func (vf *verifiedFiles) passed(name string, obj *storage.Object) bool {
+	vf.mu.Lock()
+	defer vf.mu.Unlock()
+
+	e, ok := vf.files[name]
+	if !ok {
+		return false
+	}
+	if f := e.Value.(verifiedFile); f.size != obj.Size || !f.modTime.Equal(obj.ModTime) {
+		vf.order.Remove(e)
+		delete(vf.files, name)
+		return false
+	}
+	vf.order.MoveToFront(e)
+	return true
+}
+
+// add records that the stored file passed verification
+func (vf *verifiedFiles) add(name string, obj *storage.Object) {
+	vf.mu.Lock()
+	defer vf.mu.Unlock()
+
+	f := verifiedFile{name, obj.Size, obj.ModTime}
+	if e, ok := vf.files[name]; ok {
+		e.Value = f
+		vf.order.MoveToFront(e)
+		return
+	}
+	vf.files[name] = vf.order.PushFront(f)
+	for vf.order.Len() > vf.capacity {
+		oldest := vf.order.Back()
+		vf.order.Remove(oldest)
+		delete(vf.files, oldest.Value.(verifiedFile).name)
+	}
+}
+
+// forget drops the stored files, which are gone or no longer pass verification
+func (vf *verifiedFiles) forget(names ...string) {
+	vf.mu.Lock()
+	defer vf.mu.Unlock()
+
+	for _, name := range names {
+		if e, ok := vf.files[name]; ok {
+			vf.order.Remove(e)
+			delete(vf.files, name)
+		}
 	}
 }
 
@@ -38,6 +134,12 @@ func (dc *DataController) GetFile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	b, err := dc.c.Data(r.Context(), fmt.Sprintf("validityCheck/%s", fileName[:len(fileName)-len(filepath.Ext(fileName))]))
+	if errors.Is(err, client.ErrFilePurged) {
+		base := fileName[:len(fileName)-len(filepath.Ext(fileName))]
+		dc.verified.forget(storedFileName(base, false), storedFileName(base, true))
+		fhirror.Gone(r.Context(), w, fmt.Sprintf("File %s has expired and was deleted", fileName))
+		return
+	}
 	if err != nil {
 		log.Error(fmt.Sprintf("Failed to check if file %s is valid", fileName), zap.Error(err))
 		fhirror.ServerIssue(r.Context(), w, http.StatusNotFound, fmt.Sprintf("Failed to get file %s", fileName))
@@ -49,11 +151,232 @@ func (dc *DataController) GetFile(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		log.Error("Failed to unmarshal json to map", zap.Error(err))
 		fhirror.GenericServerIssue(r.Context(), w)
+		return
 	}
 
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.ndjson\"", fileInfo.FileName))
+	disposition := fmt.Sprintf("attachment; filename=\"%s.ndjson\"", fileInfo.FileName)
+	w.Header().Set("Content-Disposition", disposition)
 	w.Header().Set("Content-Type", "application/octet-stream")
 
-	exportPath := conf.GetAsString("exportPath")
-	http.ServeFile(w, r, fmt.Sprintf("%s/%s.ndjson", exportPath, fileInfo.FileName))
+	compressed := fileInfo.CompressedCheckSum != nil
+	if compressed {
+		w.Header().Set("Vary", "Accept-Encoding")
+	}
+	sendAsIs := !compressed || acceptsGzip(r)
+	name := storedFileName(fileInfo.FileName, compressed)
+	storedLength, storedChecksum := fileInfo.FileLength, fileInfo.FileCheckSum
+	if compressed {
+		storedLength, storedChecksum = fileInfo.CompressedFileLength, fileInfo.CompressedCheckSum
+	}
+	if sendAsIs {
+		headers := storage.ResponseHeaders{ContentType: "application/octet-stream", ContentDisposition: disposition}
+		if compressed {
+			headers.ContentEncoding = "gzip"
+		}
+		url, err := dc.store.PresignedURL(r.Context(), name, headers)
+		if err == nil {
+			// the file is checked before the client is sent to the store for it, and the redirect carries its digest
+			// so the client can check what it downloads
+			if err := dc.verifyStored(r.Context(), name, int64(storedLength), storedChecksum); err != nil {
+				refuseFile(w, r, fileInfo.FileName, fileName, err)
+				return
+			}
+			setDigestHeaders(w, storedChecksum)
+			http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+			return
+		}
+		if !errors.Is(err, storage.ErrPresignNotSupported) {
+			log.Warn(fmt.Sprintf("Failed to pre-sign file %s, streaming it instead", fileInfo.FileName), zap.Error(err))
+		}
+	}
+
+	obj, err := dc.openVerified(r.Context(), name, int64(storedLength), storedChecksum)
+	if err != nil {
+		refuseFile(w, r, fileInfo.FileName, fileName, err)
+		return
+	}
+	defer obj.Body.Close()
+
+	if !sendAsIs {
+		// the client can't take gzip, so the file is decompressed as it is sent
+		gz, err := gzip.NewReader(obj.Body)
+		if err != nil {
+			log.Error(fmt.Sprintf("Failed to decompress file %s", fileInfo.FileName), zap.Error(err))
+			fhirror.GenericServerIssue(r.Context(), w)
+			return
+		}
+		setDigestHeaders(w, fileInfo.FileCheckSum)
+		w.Header().Set("Content-Length", strconv.Itoa(fileInfo.FileLength))
+		if _, err := io.Copy(w, gz); err != nil {
+			log.Error(fmt.Sprintf("Failed to write file %s to response", fileInfo.FileName), zap.Error(err))
+		}
+		return
+	}
+
+	if compressed {
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+	// with the ETag set, ServeContent answers conditional requests, so a client can resume a download with If-Range
+	setDigestHeaders(w, storedChecksum)
+	if seeker, ok := obj.Body.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, name, obj.ModTime, seeker)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	if _, err := io.Copy(w, obj.Body); err != nil {
+		log.Error(fmt.Sprintf("Failed to write file %s to response", fileInfo.FileName), zap.Error(err))
+	}
+}
+
+// refuseFile writes the error of a stored file that failed verification or could not be opened
+func refuseFile(w http.ResponseWriter, r *http.Request, storedName string, fileName string, err error) {
+	log := logger.WithContext(r.Context())
+	if errors.Is(err, errCorruptFile) {
+		log.Error(fmt.Sprintf("File %s does not match its recorded length and checksum, refusing to serve it", storedName))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, fmt.Sprintf("File %s failed its integrity check", fileName))
+		return
+	}
+	log.Error(fmt.Sprintf("Failed to open file %s", storedName), zap.Error(err))
+	fhirror.ServerIssue(r.Context(), w, http.StatusNotFound, fmt.Sprintf("Failed to get file %s", fileName))
+}
+
+// verifyStored checks a stored export file like openVerified without serving it, before a client is redirected to
+// download it from the store. The store serves the file as it is when downloaded, which is what was checked unless
+// it was replaced in between.
+func (dc *DataController) verifyStored(ctx context.Context, name string, length int64, checksum []byte) error {
+	if checksum == nil {
+		return nil
+	}
+	obj, err := dc.store.Open(ctx, name)
+	if err != nil {
+		dc.verified.forget(name)
+		return err
+	}
+	defer obj.Body.Close()
+	if dc.verified.passed(name, obj) {
+		return nil
+	}
+	if err := verifyFile(obj, length, checksum); err != nil {
+		return err
+	}
+	dc.verified.add(name, obj)
+	return nil
+}
+
+// openVerified opens a stored export file after checking it against the length and SHA-256 checksum recorded when it
+// was written, so a truncated or corrupted file is refused instead of served. The file is read through to check it,
+// then rewound, or opened again when the store only streams it. Files without a recorded checksum are not checked.
+func (dc *DataController) openVerified(ctx context.Context, name string, length int64, checksum []byte) (*storage.Object, error) {
+	obj, err := dc.store.Open(ctx, name)
+	if err != nil {
+		dc.verified.forget(name)
+		return nil, err
+	}
+	if checksum == nil || dc.verified.passed(name, obj) {
+		return obj, nil
+	}
+
+	if err := verifyFile(obj, length, checksum); err != nil {
+		_ = obj.Body.Close()
+		return nil, err
+	}
+	dc.verified.add(name, obj)
+
+	if seeker, ok := obj.Body.(io.Seeker); ok {
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			_ = obj.Body.Close()
+			return nil, err
+		}
+		return obj, nil
+	}
+	_ = obj.Body.Close()
+	return dc.store.Open(ctx, name)
+}
+
+// verifyFile reads the stored file through, returning errCorruptFile when its length or checksum differ from those
+// recorded
+func verifyFile(obj *storage.Object, length int64, checksum []byte) error {
+	if obj.Size != length {
+		return errCorruptFile
+	}
+	h := sha256.New()
+	n, err := io.Copy(h, obj.Body)
+	if err != nil {
+		return err
+	}
+	if n != length || !bytes.Equal(h.Sum(nil), checksum) {
+		return errCorruptFile
+	}
+	return nil
+}
+
+// setDigestHeaders describes the file as it is sent by its SHA-256 checksum, the same one listed in the job manifest,
+// in the Digest and Repr-Digest headers and as its ETag
+func setDigestHeaders(w http.ResponseWriter, checksum []byte) {
+	if checksum == nil {
+		return
+	}
+	digest := base64.StdEncoding.EncodeToString(checksum)
+	w.Header().Set("ETag", fmt.Sprintf("\"%s\"", hex.EncodeToString(checksum)))
+	w.Header().Set("Digest", fmt.Sprintf("sha-256=%s", digest))
+	w.Header().Set("Repr-Digest", fmt.Sprintf("sha-256=:%s:", digest))
+}
+
+// storedFileName returns the name of an export file in the store
+func storedFileName(fileName string, compressed bool) string {
+	if compressed {
+		return fmt.Sprintf("%s.ndjson.gz", fileName)
+	}
+	return fmt.Sprintf("%s.ndjson", fileName)
+}
+
+// acceptsGzip reports whether the request's Accept-Encoding header allows a gzip encoded response
+func acceptsGzip(r *http.Request) bool {
+	for _, h := range r.Header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(h, ",") {
+			parts := strings.Split(coding, ";")
+			name := strings.ToLower(strings.TrimSpace(parts[0]))
+			if name != "gzip" && name != "*" {
+				continue
+			}
+			rejected := false
+			for _, p := range parts[1:] {
+				if q := strings.ReplaceAll(strings.TrimSpace(p), " ", ""); strings.HasPrefix(q, "q=") {
+					weight, err := strconv.ParseFloat(strings.TrimPrefix(q, "q="), 64)
+					rejected = err != nil || weight == 0
+				}
+			}
+			if !rejected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// storedFile is an export file opened for reading its uncompressed content
+type storedFile struct {
+	io.Reader
+	body io.Closer
+}
+
+func (f *storedFile) Close() error {
+	return f.body.Close()
+}
+
+// openStoredFile opens an export file in the store, returning a reader of its uncompressed content
+func openStoredFile(ctx context.Context, store storage.Store, fileName string, compressed bool) (io.ReadCloser, error) {
+	obj, err := store.Open(ctx, storedFileName(fileName, compressed))
+	if err != nil {
+		return nil, err
+	}
+	if !compressed {
+		return obj.Body, nil
+	}
+	gz, err := gzip.NewReader(obj.Body)
+	if err != nil {
+		_ = obj.Body.Close()
+		return nil, err
+	}
+	return &storedFile{gz, obj.Body}, nil
 }
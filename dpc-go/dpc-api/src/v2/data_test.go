@@ -1,12 +1,18 @@
 package v2
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"github.com/CMSgov/dpc/api/client"
 	"github.com/CMSgov/dpc/api/conf"
 	"github.com/CMSgov/dpc/api/constants"
 	"github.com/CMSgov/dpc/api/model"
+	"github.com/CMSgov/dpc/api/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
@@ -17,6 +23,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 type MockDataClient struct {
@@ -28,6 +35,23 @@ func (ac *MockDataClient) Data(ctx context.Context, path string) ([]byte, error)
 	return args.Get(0).([]byte), args.Error(1)
 }
 
+type MockStore struct {
+	mock.Mock
+}
+
+func (ms *MockStore) Open(ctx context.Context, name string) (*storage.Object, error) {
+	args := ms.Called(ctx, name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*storage.Object), args.Error(1)
+}
+
+func (ms *MockStore) PresignedURL(ctx context.Context, name string, headers storage.ResponseHeaders) (string, error) {
+	args := ms.Called(ctx, name, headers)
+	return args.String(0), args.Error(1)
+}
+
 type DataControllerTestSuite struct {
 	suite.Suite
 	data *DataController
@@ -45,7 +69,7 @@ func (suite *DataControllerTestSuite) SetupTest() {
 	conf.NewConfig("../../configs")
 	mdc := new(MockDataClient)
 	suite.mdc = mdc
-	suite.data = NewDataController(mdc)
+	suite.data = NewDataController(mdc, storage.NewLocalStore(conf.GetAsString("exportPath")))
 }
 
 func (suite *DataControllerTestSuite) TearDownTest() {
@@ -84,3 +108,265 @@ func (suite *DataControllerTestSuite) TestGetFile() {
 	assert.Equal(suite.T(), "hello", string(b))
 	assert.Equal(suite.T(), resp.Header.Get("Content-Disposition"), fmt.Sprintf("attachment; filename=\"%s\"", f))
 }
+
+func (suite *DataControllerTestSuite) TestGetFileGzip() {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, _ = gz.Write([]byte("{\"id\":\"1\"}\n"))
+	_ = gz.Close()
+	f, _ := ioutil.TempFile("/tmp", "batch-*.patient.ndjson.gz")
+	_, _ = f.Write(compressed.Bytes())
+	_ = f.Close()
+	defer os.Remove(f.Name())
+	fileName := strings.TrimSuffix(strings.TrimPrefix(f.Name(), "/tmp/"), ".ndjson.gz")
+
+	plainSum := sha256.Sum256([]byte("{\"id\":\"1\"}\n"))
+	compressedSum := sha256.Sum256(compressed.Bytes())
+	fi := model.FileInfo{FileName: fileName, FileLength: 11, FileCheckSum: plainSum[:], CompressedFileLength: compressed.Len(), CompressedCheckSum: compressedSum[:]}
+	b, _ := json.Marshal(fi)
+	suite.mdc.On("Data", mock.Anything, fmt.Sprintf("validityCheck/%s", fileName)).Return(b, nil)
+
+	get := func(acceptEncoding string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, "http://blah.com", nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), constants.ContextKeyFileName, fileName+".ndjson"))
+		w := httptest.NewRecorder()
+		suite.data.GetFile(w, req)
+		return w.Result()
+	}
+
+	resp := get("gzip")
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(suite.T(), "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(suite.T(), "Accept-Encoding", resp.Header.Get("Vary"))
+	assert.Equal(suite.T(), compressed.Bytes(), body)
+	assert.Equal(suite.T(), fmt.Sprintf("\"%x\"", compressedSum), resp.Header.Get("ETag"))
+
+	resp = get("")
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.Empty(suite.T(), resp.Header.Get("Content-Encoding"))
+	assert.Equal(suite.T(), "11", resp.Header.Get("Content-Length"))
+	assert.Equal(suite.T(), "{\"id\":\"1\"}\n", string(body))
+	assert.Equal(suite.T(), fmt.Sprintf("\"%x\"", plainSum), resp.Header.Get("ETag"))
+	assert.Equal(suite.T(), "sha-256="+base64.StdEncoding.EncodeToString(plainSum[:]), resp.Header.Get("Digest"))
+}
+
+func (suite *DataControllerTestSuite) TestAcceptsGzip() {
+	tests := map[string]bool{
+		"":                    false,
+		"gzip":                true,
+		"deflate, gzip;q=1.0": true,
+		"GZIP":                true,
+		"*":                   true,
+		"gzip;q=0":            false,
+		"identity":            false,
+		"br, gzip; q=0.5":     true,
+	}
+	for header, accepts := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://blah.com", nil)
+		req.Header.Set("Accept-Encoding", header)
+		assert.Equal(suite.T(), accepts, acceptsGzip(req), header)
+	}
+}
+
+func (suite *DataControllerTestSuite) TestGetFilePresignedRedirect() {
+	store := new(MockStore)
+	suite.data = NewDataController(suite.mdc, store)
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, _ = gz.Write([]byte("{\"id\":\"1\"}\n"))
+	_ = gz.Close()
+	checksum := sha256.Sum256(compressed.Bytes())
+	fi := model.FileInfo{FileName: "batch-0.patient", FileLength: 11, CompressedFileLength: compressed.Len(), CompressedCheckSum: checksum[:]}
+	b, _ := json.Marshal(fi)
+	suite.mdc.On("Data", mock.Anything, "validityCheck/batch-0.patient").Return(b, nil)
+	store.On("PresignedURL", mock.Anything, "batch-0.patient.ndjson.gz", storage.ResponseHeaders{
+		ContentType:        "application/octet-stream",
+		ContentEncoding:    "gzip",
+		ContentDisposition: "attachment; filename=\"batch-0.patient.ndjson\"",
+	}).Return("https://bucket.example.com/batch-0.patient.ndjson.gz?X-Amz-Signature=abc", nil)
+
+	open := func() {
+		store.On("Open", mock.Anything, "batch-0.patient.ndjson.gz").Once().
+			Return(&storage.Object{Body: ioutil.NopCloser(bytes.NewReader(compressed.Bytes())), Size: int64(compressed.Len())}, nil)
+	}
+
+	// the file is verified before the redirect, which carries its digest
+	open()
+	req := httptest.NewRequest(http.MethodGet, "http://blah.com", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req = req.WithContext(context.WithValue(req.Context(), constants.ContextKeyFileName, "batch-0.patient.ndjson"))
+	w := httptest.NewRecorder()
+	suite.data.GetFile(w, req)
+
+	assert.Equal(suite.T(), http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(suite.T(), "https://bucket.example.com/batch-0.patient.ndjson.gz?X-Amz-Signature=abc", w.Header().Get("Location"))
+	assert.Equal(suite.T(), fmt.Sprintf("\"%x\"", checksum), w.Header().Get("ETag"))
+	assert.Equal(suite.T(), "sha-256="+base64.StdEncoding.EncodeToString(checksum[:]), w.Header().Get("Digest"))
+
+	// a client that can't take gzip gets the file streamed, decompressed, instead. It was verified already, so it is
+	// opened once.
+	open()
+	req.Header.Del("Accept-Encoding")
+	w = httptest.NewRecorder()
+	suite.data.GetFile(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+	assert.Equal(suite.T(), "{\"id\":\"1\"}\n", w.Body.String())
+	store.AssertNumberOfCalls(suite.T(), "PresignedURL", 1)
+	store.AssertNumberOfCalls(suite.T(), "Open", 2)
+}
+
+func (suite *DataControllerTestSuite) TestGetFilePresignedCorrupt() {
+	store := new(MockStore)
+	suite.data = NewDataController(suite.mdc, store)
+	content := []byte("{\"id\":\"1\"}\n")
+	checksum := sha256.Sum256(content)
+	fi := model.FileInfo{FileName: "batch-0.patient", FileLength: len(content), FileCheckSum: checksum[:]}
+	b, _ := json.Marshal(fi)
+	suite.mdc.On("Data", mock.Anything, "validityCheck/batch-0.patient").Return(b, nil)
+	store.On("PresignedURL", mock.Anything, "batch-0.patient.ndjson", mock.Anything).
+		Return("https://bucket.example.com/batch-0.patient.ndjson?X-Amz-Signature=abc", nil)
+	corrupted := []byte("{\"id\":\"9\"}\n")
+	store.On("Open", mock.Anything, "batch-0.patient.ndjson").
+		Return(&storage.Object{Body: ioutil.NopCloser(bytes.NewReader(corrupted)), Size: int64(len(corrupted))}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "http://blah.com", nil)
+	req = req.WithContext(context.WithValue(req.Context(), constants.ContextKeyFileName, "batch-0.patient.ndjson"))
+	w := httptest.NewRecorder()
+	suite.data.GetFile(w, req)
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Code)
+	assert.Empty(suite.T(), w.Header().Get("Location"))
+	assert.Contains(suite.T(), w.Body.String(), "failed its integrity check")
+}
+
+func (suite *DataControllerTestSuite) TestGetFileVerifiesChecksum() {
+	content := []byte("{\"id\":\"1\"}\n{\"id\":\"2\"}\n")
+	checksum := sha256.Sum256(content)
+	f, _ := ioutil.TempFile("/tmp", "batch-*.patient.ndjson")
+	_, _ = f.Write(content)
+	_ = f.Close()
+	defer os.Remove(f.Name())
+	fileName := strings.TrimSuffix(strings.TrimPrefix(f.Name(), "/tmp/"), ".ndjson")
+
+	fi := model.FileInfo{FileName: fileName, FileLength: len(content), FileCheckSum: checksum[:]}
+	b, _ := json.Marshal(fi)
+	suite.mdc.On("Data", mock.Anything, fmt.Sprintf("validityCheck/%s", fileName)).Return(b, nil)
+
+	get := func(headers map[string]string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, "http://blah.com", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), constants.ContextKeyFileName, fileName+".ndjson"))
+		w := httptest.NewRecorder()
+		suite.data.GetFile(w, req)
+		return w.Result()
+	}
+
+	resp := get(nil)
+	body, _ := ioutil.ReadAll(resp.Body)
+	etag := fmt.Sprintf("\"%x\"", checksum)
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+	assert.Equal(suite.T(), content, body)
+	assert.Equal(suite.T(), etag, resp.Header.Get("ETag"))
+	assert.Equal(suite.T(), "sha-256="+base64.StdEncoding.EncodeToString(checksum[:]), resp.Header.Get("Digest"))
+	assert.Equal(suite.T(), "sha-256=:"+base64.StdEncoding.EncodeToString(checksum[:])+":", resp.Header.Get("Repr-Digest"))
+
+	// a download is resumed while the file is unchanged, and sent whole when it isn't
+	resp = get(map[string]string{"Range": "bytes=11-", "If-Range": etag})
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.Equal(suite.T(), http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(suite.T(), "{\"id\":\"2\"}\n", string(body))
+	resp = get(map[string]string{"Range": "bytes=11-", "If-Range": "\"other\""})
+	assert.Equal(suite.T(), http.StatusOK, resp.StatusCode)
+	resp = get(map[string]string{"If-None-Match": etag})
+	assert.Equal(suite.T(), http.StatusNotModified, resp.StatusCode)
+
+	// a truncated file is refused
+	_ = ioutil.WriteFile(f.Name(), content[:20], 0600)
+	resp = get(nil)
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.Equal(suite.T(), http.StatusInternalServerError, resp.StatusCode)
+	assert.Contains(suite.T(), string(body), "failed its integrity check")
+
+	// so is one corrupted in place
+	corrupted := append([]byte{}, content...)
+	corrupted[8] = '9'
+	_ = ioutil.WriteFile(f.Name(), corrupted, 0600)
+	assert.Equal(suite.T(), http.StatusInternalServerError, get(nil).StatusCode)
+}
+
+func (suite *DataControllerTestSuite) TestGetFileMissing() {
+	fi := model.FileInfo{FileName: "missing-0.patient", FileLength: 11}
+	b, _ := json.Marshal(fi)
+	suite.mdc.On("Data", mock.Anything, "validityCheck/missing-0.patient").Return(b, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "http://blah.com", nil)
+	req = req.WithContext(context.WithValue(req.Context(), constants.ContextKeyFileName, "missing-0.patient.ndjson"))
+	w := httptest.NewRecorder()
+	suite.data.GetFile(w, req)
+
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+}
+
+func (suite *DataControllerTestSuite) TestGetFilePurged() {
+	suite.mdc.On("Data", mock.Anything, "validityCheck/purged-0.patient").Return([]byte{}, client.ErrFilePurged)
+	suite.data.verified.add("purged-0.patient.ndjson.gz", &storage.Object{Size: 11})
+
+	req := httptest.NewRequest(http.MethodGet, "http://blah.com", nil)
+	req = req.WithContext(context.WithValue(req.Context(), constants.ContextKeyFileName, "purged-0.patient.ndjson"))
+	w := httptest.NewRecorder()
+	suite.data.GetFile(w, req)
+
+	assert.Equal(suite.T(), http.StatusGone, w.Code)
+	assert.Contains(suite.T(), w.Body.String(), "OperationOutcome")
+	assert.Contains(suite.T(), w.Body.String(), "File purged-0.patient.ndjson has expired and was deleted")
+	assert.False(suite.T(), suite.data.verified.passed("purged-0.patient.ndjson.gz", &storage.Object{Size: 11}))
+}
+
+func (suite *DataControllerTestSuite) TestVerifiedFiles() {
+	vf := newVerifiedFiles(2)
+	modTime := time.Now()
+	vf.add("a.ndjson", &storage.Object{Size: 1, ModTime: modTime})
+	vf.add("b.ndjson", &storage.Object{Size: 2, ModTime: modTime})
+	assert.True(suite.T(), vf.passed("a.ndjson", &storage.Object{Size: 1, ModTime: modTime}))
+
+	// past its capacity, the least recently used file is evicted
+	vf.add("c.ndjson", &storage.Object{Size: 3, ModTime: modTime})
+	assert.False(suite.T(), vf.passed("b.ndjson", &storage.Object{Size: 2, ModTime: modTime}))
+	assert.True(suite.T(), vf.passed("a.ndjson", &storage.Object{Size: 1, ModTime: modTime}))
+	assert.True(suite.T(), vf.passed("c.ndjson", &storage.Object{Size: 3, ModTime: modTime}))
+
+	// a file that changed since it was verified is dropped
+	assert.False(suite.T(), vf.passed("c.ndjson", &storage.Object{Size: 4, ModTime: modTime}))
+	assert.Equal(suite.T(), 1, vf.order.Len())
+
+	vf.forget("a.ndjson")
+	assert.Equal(suite.T(), 0, vf.order.Len())
+	assert.Empty(suite.T(), vf.files)
+}
+
+func (suite *DataControllerTestSuite) TestGetFileMissingForgetsVerification() {
+	store := new(MockStore)
+	suite.data = NewDataController(suite.mdc, store)
+	content := []byte("{\"id\":\"1\"}\n")
+	checksum := sha256.Sum256(content)
+	fi := model.FileInfo{FileName: "batch-0.patient", FileLength: len(content), FileCheckSum: checksum[:]}
+	b, _ := json.Marshal(fi)
+	suite.mdc.On("Data", mock.Anything, "validityCheck/batch-0.patient").Return(b, nil)
+	store.On("PresignedURL", mock.Anything, "batch-0.patient.ndjson", mock.Anything).Return("", storage.ErrPresignNotSupported)
+	store.On("Open", mock.Anything, "batch-0.patient.ndjson").Return(nil, os.ErrNotExist)
+	suite.data.verified.add("batch-0.patient.ndjson", &storage.Object{Size: int64(len(content))})
+
+	req := httptest.NewRequest(http.MethodGet, "http://blah.com", nil)
+	req = req.WithContext(context.WithValue(req.Context(), constants.ContextKeyFileName, "batch-0.patient.ndjson"))
+	w := httptest.NewRecorder()
+	suite.data.GetFile(w, req)
+
+	assert.Equal(suite.T(), http.StatusNotFound, w.Code)
+	assert.Empty(suite.T(), suite.data.verified.files)
+}
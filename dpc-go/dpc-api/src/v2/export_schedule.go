@@ -0,0 +1,202 @@
+package v2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CMSgov/dpc/api/auth"
+	"github.com/CMSgov/dpc/api/client"
+	"github.com/CMSgov/dpc/api/constants"
+	"github.com/CMSgov/dpc/api/fhirror"
+	"github.com/CMSgov/dpc/api/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// ExportScheduleController is an interface for organizations to manage the group exports run on a schedule
+type ExportScheduleController interface {
+	ReadController
+	CreateController
+	UpdateController
+	DeleteController
+	List(w http.ResponseWriter, r *http.Request)
+}
+
+// exportSchedule is a group export an organization schedules to run DAILY, WEEKLY or MONTHLY. Each run exports what
+// changed since the group's previous successful export, and the full history of members added since then. The first
+// export of the group starts from Since.
+type exportSchedule struct {
+	GroupID    string     `json:"groupID"`
+	Frequency  string     `json:"frequency"`
+	StartAt    *time.Time `json:"startAt,omitempty"`
+	Type       string     `json:"type"`
+	Since      *time.Time `json:"since,omitempty"`
+	WebhookURL string     `json:"webhookURL,omitempty"`
+}
+
+// OrganizationExportScheduleController is a struct that defines what the controller has
+type OrganizationExportScheduleController struct {
+	ac client.Client
+}
+
+// NewExportScheduleController creates an export schedule controller and returns its reference
+func NewExportScheduleController(ac client.Client) *OrganizationExportScheduleController {
+	return &OrganizationExportScheduleController{
+		ac,
+	}
+}
+
+// List function returns the export schedules of the organization from attribution
+func (sc *OrganizationExportScheduleController) List(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	resp, err := sc.ac.GetExportSchedules(r.Context())
+	if err != nil {
+		log.Error("Failed to get the export schedules from attribution", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Failed to get export schedules")
+		return
+	}
+	writeResponse(w, r, resp)
+}
+
+// Read function returns an export schedule of the organization from attribution
+func (sc *OrganizationExportScheduleController) Read(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	id, _ := r.Context().Value(constants.ContextKeyExportSchedule).(string)
+	resp, err := sc.ac.GetExportSchedule(r.Context(), id)
+	if errors.Is(err, client.ErrExportScheduleNotFound) {
+		fhirror.NotFound(r.Context(), w, "Export schedule not found")
+		return
+	}
+	if err != nil {
+		log.Error("Failed to get the export schedule from attribution", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Failed to get export schedule")
+		return
+	}
+	writeResponse(w, r, resp)
+}
+
+// Create function validates the export schedule and saves it for the organization in attribution
+func (sc *OrganizationExportScheduleController) Create(w http.ResponseWriter, r *http.Request) {
+	body, ok := sc.readSchedule(w, r)
+	if !ok {
+		return
+	}
+	resp, err := sc.ac.CreateExportSchedule(r.Context(), body)
+	if !sc.savedSchedule(w, r, err) {
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	writeResponse(w, r, resp)
+}
+
+// Update function validates the export schedule and replaces the settings of the schedule in attribution, keeping
+// its run history
+func (sc *OrganizationExportScheduleController) Update(w http.ResponseWriter, r *http.Request) {
+	body, ok := sc.readSchedule(w, r)
+	if !ok {
+		return
+	}
+	id, _ := r.Context().Value(constants.ContextKeyExportSchedule).(string)
+	resp, err := sc.ac.UpdateExportSchedule(r.Context(), id, body)
+	if !sc.savedSchedule(w, r, err) {
+		return
+	}
+	writeResponse(w, r, resp)
+}
+
+// Delete function removes an export schedule of the organization, the jobs it already started are kept
+func (sc *OrganizationExportScheduleController) Delete(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	id, _ := r.Context().Value(constants.ContextKeyExportSchedule).(string)
+	err := sc.ac.DeleteExportSchedule(r.Context(), id)
+	if errors.Is(err, client.ErrExportScheduleNotFound) {
+		fhirror.NotFound(r.Context(), w, "Export schedule not found")
+		return
+	}
+	if err != nil {
+		log.Error("Failed to delete the export schedule in attribution", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Failed to delete export schedule")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readSchedule parses and validates the export schedule in the body, writing the error response when it is invalid.
+// The resource types default to all of them, like a kickoff without _type, and must all be in the token's scopes.
+func (sc *OrganizationExportScheduleController) readSchedule(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	log := logger.WithContext(r.Context())
+
+	var schedule exportSchedule
+	if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+		log.Error("Failed to parse export schedule", zap.Error(err))
+		fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, "Body must be an export schedule with a groupID and frequency")
+		return nil, false
+	}
+	if schedule.GroupID == "" {
+		fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, "groupID is required")
+		return nil, false
+	}
+	schedule.Frequency = strings.ToUpper(schedule.Frequency)
+	if schedule.Frequency != "DAILY" && schedule.Frequency != "WEEKLY" && schedule.Frequency != "MONTHLY" {
+		fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, "frequency must be one of DAILY, WEEKLY or MONTHLY")
+		return nil, false
+	}
+	if schedule.Type == "" {
+		schedule.Type = constants.AllResources
+	}
+	valid := make(map[string]bool)
+	for _, t := range strings.Split(constants.AllResources, ",") {
+		valid[t] = true
+	}
+	scopes, _ := r.Context().Value(constants.ContextKeyScopes).(auth.Scopes)
+	for _, t := range strings.Split(schedule.Type, ",") {
+		if !valid[t] {
+			fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, fmt.Sprintf("Invalid resource type %s", t))
+			return nil, false
+		}
+		if !scopes.Allows(t, auth.Read) {
+			fhirror.Forbidden(r.Context(), w, fmt.Sprintf("Insufficient scope: %s is required", auth.Scope{Resource: t, Access: auth.Read}))
+			return nil, false
+		}
+	}
+	if schedule.Since != nil && schedule.Since.After(time.Now()) {
+		fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, "since cannot be in the future")
+		return nil, false
+	}
+	if schedule.WebhookURL != "" && !validWebhookURL(schedule.WebhookURL) {
+		fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, "webhookURL must be an absolute https URL")
+		return nil, false
+	}
+	if !webhookRegistered(w, r, sc.ac, schedule.WebhookURL) {
+		return nil, false
+	}
+
+	body := new(bytes.Buffer)
+	if err := json.NewEncoder(body).Encode(schedule); err != nil {
+		log.Error("Failed to convert export schedule to bytes", zap.Error(err))
+		fhirror.GenericServerIssue(r.Context(), w)
+		return nil, false
+	}
+	return body.Bytes(), true
+}
+
+// savedSchedule writes the error response when attribution failed to save the export schedule
+func (sc *OrganizationExportScheduleController) savedSchedule(w http.ResponseWriter, r *http.Request, err error) bool {
+	var rejected *client.RejectedError
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, client.ErrExportScheduleNotFound):
+		fhirror.NotFound(r.Context(), w, "Export schedule not found")
+	case errors.As(err, &rejected):
+		fhirror.BusinessViolation(r.Context(), w, http.StatusUnprocessableEntity, rejected.Message)
+	default:
+		logger.WithContext(r.Context()).Error("Failed to save the export schedule to attribution", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Failed to save export schedule")
+	}
+	return false
+}
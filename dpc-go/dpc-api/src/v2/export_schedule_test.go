@@ -0,0 +1,141 @@
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CMSgov/dpc/api/auth"
+	"github.com/CMSgov/dpc/api/client"
+	"github.com/CMSgov/dpc/api/constants"
+	"github.com/go-chi/chi/middleware"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type ExportScheduleControllerTestSuite struct {
+	suite.Suite
+	mac *MockAttributionClient
+	sc  ExportScheduleController
+}
+
+func TestExportScheduleControllerTestSuite(t *testing.T) {
+	suite.Run(t, new(ExportScheduleControllerTestSuite))
+}
+
+func (suite *ExportScheduleControllerTestSuite) SetupTest() {
+	suite.mac = new(MockAttributionClient)
+	suite.sc = NewExportScheduleController(suite.mac)
+}
+
+func (suite *ExportScheduleControllerTestSuite) request(method string, body string, scopes string) *http.Request {
+	req := httptest.NewRequest(method, "http://example.com/ExportSchedule/54321", strings.NewReader(body))
+	ctx := context.WithValue(req.Context(), middleware.RequestIDKey, "54321")
+	ctx = context.WithValue(ctx, constants.ContextKeyOrganization, "12345")
+	ctx = context.WithValue(ctx, constants.ContextKeyExportSchedule, "54321")
+	ctx = context.WithValue(ctx, constants.ContextKeyScopes, auth.ParseScopes(scopes))
+	return req.WithContext(ctx)
+}
+
+func (suite *ExportScheduleControllerTestSuite) TestList() {
+	suite.mac.On("GetExportSchedules", mock.Anything).Return([]byte(`[{"id":"54321"}]`), nil)
+
+	w := httptest.NewRecorder()
+	suite.sc.List(w, suite.request(http.MethodGet, "", "system/*.read"))
+
+	resp, _ := ioutil.ReadAll(w.Result().Body)
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	assert.Equal(suite.T(), `[{"id":"54321"}]`, string(resp))
+}
+
+func (suite *ExportScheduleControllerTestSuite) TestReadNotFound() {
+	suite.mac.On("GetExportSchedule", mock.Anything, "54321").Return([]byte(nil), client.ErrExportScheduleNotFound)
+
+	w := httptest.NewRecorder()
+	suite.sc.Read(w, suite.request(http.MethodGet, "", "system/*.read"))
+
+	resp, _ := ioutil.ReadAll(w.Result().Body)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Result().StatusCode)
+	assert.Contains(suite.T(), string(resp), "OperationOutcome")
+}
+
+func (suite *ExportScheduleControllerTestSuite) TestCreate() {
+	suite.mac.On("CreateExportSchedule", mock.Anything, mock.MatchedBy(func(body []byte) bool {
+		var s exportSchedule
+		_ = json.Unmarshal(body, &s)
+		return s.GroupID == "67890" && s.Frequency == "WEEKLY" && s.Type == constants.AllResources
+	})).Return([]byte(`{"id":"54321"}`), nil)
+
+	w := httptest.NewRecorder()
+	suite.sc.Create(w, suite.request(http.MethodPost, `{"groupID":"67890","frequency":"weekly"}`, "system/*.read"))
+
+	assert.Equal(suite.T(), http.StatusCreated, w.Result().StatusCode)
+	suite.mac.AssertExpectations(suite.T())
+}
+
+func (suite *ExportScheduleControllerTestSuite) TestCreateInvalid() {
+	for _, body := range []string{
+		`not json`,
+		`{"frequency":"DAILY"}`,
+		`{"groupID":"67890","frequency":"HOURLY"}`,
+		`{"groupID":"67890","frequency":"DAILY","type":"Patient,Pat"}`,
+		`{"groupID":"67890","frequency":"DAILY","since":"2999-01-01T00:00:00Z"}`,
+		`{"groupID":"67890","frequency":"DAILY","webhookURL":"ftp://example.com/hook"}`,
+	} {
+		w := httptest.NewRecorder()
+		suite.sc.Create(w, suite.request(http.MethodPost, body, "system/*.read"))
+		assert.Equal(suite.T(), http.StatusBadRequest, w.Result().StatusCode, body)
+	}
+	suite.mac.AssertNotCalled(suite.T(), "CreateExportSchedule", mock.Anything, mock.Anything)
+}
+
+func (suite *ExportScheduleControllerTestSuite) TestCreateInsufficientScope() {
+	w := httptest.NewRecorder()
+	suite.sc.Create(w, suite.request(http.MethodPost, `{"groupID":"67890","frequency":"DAILY","type":"Patient,Coverage"}`, "system/Group.read system/Patient.read"))
+
+	assert.Equal(suite.T(), http.StatusForbidden, w.Result().StatusCode)
+	suite.mac.AssertNotCalled(suite.T(), "CreateExportSchedule", mock.Anything, mock.Anything)
+}
+
+func (suite *ExportScheduleControllerTestSuite) TestCreateRejected() {
+	suite.mac.On("CreateExportSchedule", mock.Anything, mock.Anything).Return([]byte(nil), &client.RejectedError{Message: "Group not found"})
+
+	w := httptest.NewRecorder()
+	suite.sc.Create(w, suite.request(http.MethodPost, `{"groupID":"67890","frequency":"DAILY"}`, "system/*.read"))
+
+	resp, _ := ioutil.ReadAll(w.Result().Body)
+	assert.Equal(suite.T(), http.StatusUnprocessableEntity, w.Result().StatusCode)
+	assert.Contains(suite.T(), string(resp), "Group not found")
+}
+
+func (suite *ExportScheduleControllerTestSuite) TestUpdate() {
+	suite.mac.On("UpdateExportSchedule", mock.Anything, "54321", mock.Anything).Return([]byte(`{"id":"54321"}`), nil).Once()
+	suite.mac.On("UpdateExportSchedule", mock.Anything, "54321", mock.Anything).Return([]byte(nil), client.ErrExportScheduleNotFound).Once()
+
+	w := httptest.NewRecorder()
+	suite.sc.Update(w, suite.request(http.MethodPut, `{"groupID":"67890","frequency":"MONTHLY","type":"Patient"}`, "system/*.read"))
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+
+	w = httptest.NewRecorder()
+	suite.sc.Update(w, suite.request(http.MethodPut, `{"groupID":"67890","frequency":"MONTHLY","type":"Patient"}`, "system/*.read"))
+	assert.Equal(suite.T(), http.StatusNotFound, w.Result().StatusCode)
+}
+
+func (suite *ExportScheduleControllerTestSuite) TestDelete() {
+	suite.mac.On("DeleteExportSchedule", mock.Anything, "54321").Return(nil).Once()
+	suite.mac.On("DeleteExportSchedule", mock.Anything, "54321").Return(errors.New("error")).Once()
+
+	w := httptest.NewRecorder()
+	suite.sc.Delete(w, suite.request(http.MethodDelete, "", "system/*.read"))
+	assert.Equal(suite.T(), http.StatusNoContent, w.Result().StatusCode)
+
+	w = httptest.NewRecorder()
+	suite.sc.Delete(w, suite.request(http.MethodDelete, "", "system/*.read"))
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Result().StatusCode)
+}
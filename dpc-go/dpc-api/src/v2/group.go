@@ -1,7 +1,6 @@
 package v2
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/CMSgov/dpc/api/conf"
@@ -14,14 +13,16 @@ import (
 	"github.com/CMSgov/dpc/api/fhirror"
 	"github.com/CMSgov/dpc/api/logger"
 	"github.com/CMSgov/dpc/api/model"
+	"github.com/CMSgov/dpc/api/ratelimit"
 	"github.com/google/fhir/go/jsonformat"
 	"github.com/pkg/errors"
-	"github.com/sjsdfg/common-lang-in-go/StringUtils"
 	"go.uber.org/zap"
 
 	"github.com/CMSgov/dpc/api/client"
 )
 
+const maxIdempotencyKeyLength = 255
+
 // GroupController is a struct that defines what the controller has
 type GroupController struct {
 	ac client.Client
@@ -78,11 +79,6 @@ func (gc *GroupController) Export(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	outputFormat := r.URL.Query().Get("_outputFormat")
-	if err := isValidExport(r.Context(), w, outputFormat, r.Header.Get("Prefer")); err != nil {
-		return
-	}
-
 	var groupContainer model.GroupContainer
 	if err := json.Unmarshal(b, &groupContainer); err != nil {
 		log.Error("Failed to convert group to struct")
@@ -103,12 +99,29 @@ func (gc *GroupController) Export(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if patients, ok := r.Context().Value(constants.ContextKeyPatients).([]string); ok {
+		var missing []string
+		attr, missing = filterAttributions(attr, patients)
+		if len(missing) > 0 {
+			log.Error(fmt.Sprintf("Requested patients are not members of group %s", groupID))
+			fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, fmt.Sprintf("Patients are not members of the group: %s", strings.Join(missing, ",")))
+			return
+		}
+	}
+
 	request := CreateExportRequest(r, groupContainer.ID, attr)
-	jobResponse, err := gc.jc.Export(r.Context(), request)
+	request.GroupVersion = groupContainer.Version
+	request.IdempotencyKey = r.Header.Get(constants.IdempotencyKeyHeader)
+	if !validIdempotencyKey(w, r, request.IdempotencyKey) || !webhookRegistered(w, r, gc.ac, request.WebhookURL) {
+		return
+	}
+	jobResponse, _, err := gc.jc.Export(r.Context(), request)
 
 	if err != nil {
 		log.Error("Failed to start export", zap.Error(err))
-		fhirror.GenericServerIssue(r.Context(), w)
+		if !quotaExceeded(w, r, err) && !idempotencyKeyReused(w, r, err) {
+			fhirror.GenericServerIssue(r.Context(), w)
+		}
 		return
 	}
 	contentLocation := contentLocationHeader(string(jobResponse))
@@ -120,6 +133,10 @@ func (gc *GroupController) Export(w http.ResponseWriter, r *http.Request) {
 func CreateExportRequest(r *http.Request, groupID string, attr []model.Attribution) model.ExportRequest {
 	since, _ := r.Context().Value(constants.ContextKeySince).(string)
 	types, _ := r.Context().Value(constants.ContextKeyResourceTypes).(string)
+	typeFilter, _ := r.Context().Value(constants.ContextKeyTypeFilter).(string)
+	elements, _ := r.Context().Value(constants.ContextKeyElements).(string)
+	warnings, _ := r.Context().Value(constants.ContextKeyExportWarnings).([]string)
+	webhook, _ := r.Context().Value(constants.ContextKeyWebhook).(string)
 
 	providers := make([]string, 0)
 	patients := make([]string, 0)
@@ -132,13 +149,72 @@ func CreateExportRequest(r *http.Request, groupID string, attr []model.Attributi
 		OutputFormat: r.URL.Query().Get("_outputFormat"),
 		Since:        since,
 		Type:         types,
+		TypeFilter:   typeFilter,
+		Elements:     elements,
 		MBIs:         patients,
 		ProviderNPI:  strings.Join(providers, ","),
 		GroupID:      groupID,
+		Warnings:     warnings,
+		WebhookURL:   webhook,
 	}
 	return er
 }
 
+// quotaExceeded writes a 429 to the response when the export failed because the organization's daily quota ran out
+func quotaExceeded(w http.ResponseWriter, r *http.Request, err error) bool {
+	var quotaErr *ratelimit.QuotaExceededError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+	fhirror.TooManyRequests(r.Context(), w, quotaErr.RetryAfter, "The daily export quota of the organization is used up")
+	return true
+}
+
+// validIdempotencyKey writes a 400 to the response when the Idempotency-Key header is too long or not printable
+func validIdempotencyKey(w http.ResponseWriter, r *http.Request, key string) bool {
+	valid := len(key) <= maxIdempotencyKeyLength
+	for _, c := range key {
+		valid = valid && c > ' ' && c <= '~'
+	}
+	if !valid {
+		fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest,
+			fmt.Sprintf("The Idempotency-Key header must be at most %d printable characters", maxIdempotencyKeyLength))
+	}
+	return valid
+}
+
+// idempotencyKeyReused writes a 409 to the response when the Idempotency-Key was already used for another export
+func idempotencyKeyReused(w http.ResponseWriter, r *http.Request, err error) bool {
+	if !errors.Is(err, client.ErrIdempotencyKeyReused) {
+		return false
+	}
+	fhirror.BusinessViolation(r.Context(), w, http.StatusConflict, "The Idempotency-Key was already used for a different export request")
+	return true
+}
+
+// filterAttributions restricts the attributions to the requested patient MBIs, returning any MBIs not attributed
+func filterAttributions(attr []model.Attribution, patients []string) ([]model.Attribution, []string) {
+	requested := make(map[string]bool)
+	for _, p := range patients {
+		requested[p] = true
+	}
+	filtered := make([]model.Attribution, 0)
+	for _, a := range attr {
+		if requested[a.PatientMBI] {
+			filtered = append(filtered, a)
+			delete(requested, a.PatientMBI)
+		}
+	}
+	missing := make([]string, 0)
+	for _, p := range patients {
+		if requested[p] {
+			missing = append(missing, p)
+			delete(requested, p)
+		}
+	}
+	return filtered, missing
+}
+
 func contentLocationHeader(id string) string {
 	return fmt.Sprintf("%s/Jobs/%s", conf.GetAsString("apiPath", ""), id)
 }
@@ -189,24 +265,3 @@ func isValidGroup(group []byte) error {
 	}
 	return nil
 }
-
-func isValidExport(ctx context.Context, w http.ResponseWriter, outputFormat string, headerPrefer string) error {
-	log := logger.WithContext(ctx)
-	if StringUtils.IsBlank(outputFormat) {
-		outputFormat = constants.FhirNdjson
-	}
-	// _outputFormat only supports FhirNdjson, ApplicationNdjson, Ndjson
-	if StringUtils.EqualsNoneIgnoreCase(outputFormat, constants.FhirNdjson, constants.ApplicationNdjson, constants.Ndjson) {
-		log.Error("Invalid outputFormat")
-		fhirror.BusinessViolation(ctx, w, http.StatusBadRequest, "'_outputFormat' query parameter must be 'application/fhir+ndjson', 'application/ndjson', or 'ndjson'")
-	}
-	if StringUtils.IsEmpty(headerPrefer) {
-		log.Error("Missing Prefer header")
-		fhirror.BusinessViolation(ctx, w, http.StatusBadRequest, "The 'Prefer' header is required and must be 'respond-async'")
-	}
-	if StringUtils.IsNotEmpty(headerPrefer) && headerPrefer != "respond-async" {
-		log.Error("Invalid Prefer header")
-		fhirror.BusinessViolation(ctx, w, http.StatusBadRequest, "The 'Prefer' header must be 'respond-async'")
-	}
-	return nil
-}
@@ -5,13 +5,16 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/CMSgov/dpc/api/client"
 	"github.com/CMSgov/dpc/api/constants"
 	"github.com/CMSgov/dpc/api/model"
+	"github.com/CMSgov/dpc/api/ratelimit"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/CMSgov/dpc/api/apitest"
 	"github.com/bxcodec/faker/v3"
@@ -147,7 +150,7 @@ func (suite *GroupControllerTestSuite) TestExportGroup() {
 	var r model.Resource
 	_ = json.Unmarshal(ab, &r)
 
-	suite.mjc.On("Export", mock.Anything, mock.Anything).Return([]byte(jobID), nil)
+	suite.mjc.On("Export", mock.Anything, mock.Anything).Return([]byte(jobID), false, nil)
 	suite.mac.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(ab, nil)
 
 	ja := jsonassert.New(suite.T())
@@ -173,132 +176,182 @@ func (suite *GroupControllerTestSuite) TestExportGroup() {
 	ja.Assertf(string(resp), "")
 }
 
-func (suite *GroupControllerTestSuite) TestExportGroupMissingPreferHeader() {
+func (suite *GroupControllerTestSuite) TestExportGroupQuotaExceeded() {
 	ab := apitest.AttributionToFHIRResponse(apitest.FilteredGroupjson)
 	var r model.Resource
 	_ = json.Unmarshal(ab, &r)
 
-	suite.mjc.On("Export", mock.Anything, mock.Anything).Return(apitest.AttributionResponse(apitest.JobJSON), nil)
+	suite.mjc.On("Export", mock.Anything, mock.Anything).Return([]byte(nil), false, &ratelimit.QuotaExceededError{RetryAfter: time.Hour})
 	suite.mac.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(ab, nil)
 
-	ja := jsonassert.New(suite.T())
-	req := httptest.NewRequest(http.MethodGet, "http://example.com/Group/9876/$export?_outputFormat=application/fhir%2Bndjson", nil)
-	ctx := req.Context()
-	ctx = context.WithValue(ctx, constants.ContextKeyOrganization, "12345")
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/Group/9876/$export", nil)
+	ctx := context.WithValue(req.Context(), constants.ContextKeyOrganization, "12345")
 	ctx = context.WithValue(ctx, constants.ContextKeyGroup, r.ID)
-	ctx = context.WithValue(ctx, constants.ContextKeyRequestURL, faker.URL())
-	ctx = context.WithValue(ctx, constants.ContextKeyRequestingIP, faker.IPv4())
-	ctx = context.WithValue(ctx, middleware.RequestIDKey, "12345")
-	ctx = context.WithValue(ctx, constants.ContextKeyResourceTypes, constants.AllResources)
 	req = req.WithContext(ctx)
 
 	w := httptest.NewRecorder()
 	suite.grp.Export(w, req)
 
 	res := w.Result()
+	resp, _ := ioutil.ReadAll(res.Body)
+	assert.Equal(suite.T(), http.StatusTooManyRequests, res.StatusCode)
+	assert.Equal(suite.T(), "3600", res.Header.Get("Retry-After"))
+	assert.Contains(suite.T(), string(resp), "daily export quota")
+}
 
-	assert.Equal(suite.T(), http.StatusBadRequest, res.StatusCode)
+func (suite *GroupControllerTestSuite) TestExportGroupIdempotencyKeyReusedThroughJobClient() {
+	ab := apitest.AttributionToFHIRResponse(apitest.FilteredGroupjson)
+	var r model.Resource
+	_ = json.Unmarshal(ab, &r)
+	suite.mac.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(ab, nil)
 
-	resp, _ := ioutil.ReadAll(res.Body)
+	// attribution refuses the key with a 409, which reaches the caller unchanged
+	attribution := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		_, _ = w.Write([]byte(`{"statusCode":409,"error":"Conflict","message":"The Idempotency-Key was already used for a different export request"}`))
+	}))
+	defer attribution.Close()
+	grp := NewGroupController(suite.mac, client.NewJobClient(client.JobConfig{URL: attribution.URL}))
+
+	req := suite.groupExportRequest(r.ID, "retry-1")
+	req = req.WithContext(context.WithValue(req.Context(), middleware.RequestIDKey, "12345"))
+	w := httptest.NewRecorder()
+	grp.Export(w, req)
 
-	ja.Assertf(string(resp), `
-    {
-        "issue": [
-            {
-                "severity": "warning",
-                "code": "Business Rule Violation",
-                "details": {
-                    "text": "The 'Prefer' header is required and must be 'respond-async'"
-                },
-                "diagnostics": "12345"
-            }
-        ],
-        "resourceType": "OperationOutcome"
-    }`)
+	assert.Equal(suite.T(), http.StatusConflict, w.Result().StatusCode)
+	assert.Contains(suite.T(), w.Body.String(), "Idempotency-Key was already used")
 }
 
-func (suite *GroupControllerTestSuite) TestExportGroupInvalidPreferHeader() {
+func (suite *GroupControllerTestSuite) groupExportRequest(groupID string, key string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/Group/9876/$export", nil)
+	ctx := context.WithValue(req.Context(), constants.ContextKeyOrganization, "12345")
+	ctx = context.WithValue(ctx, constants.ContextKeyGroup, groupID)
+	req = req.WithContext(ctx)
+	req.Header.Set(constants.IdempotencyKeyHeader, key)
+	return req
+}
+
+func (suite *GroupControllerTestSuite) TestExportGroupIdempotencyKey() {
 	ab := apitest.AttributionToFHIRResponse(apitest.FilteredGroupjson)
 	var r model.Resource
 	_ = json.Unmarshal(ab, &r)
+	r.Version = 3
+	ab, _ = json.Marshal(r)
 
-	suite.mjc.On("Export", mock.Anything, mock.Anything).Return(apitest.AttributionResponse(apitest.JobJSON), nil)
 	suite.mac.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(ab, nil)
+	suite.mjc.On("Export", mock.Anything, mock.MatchedBy(func(er model.ExportRequest) bool {
+		return er.IdempotencyKey == "retry-1" && er.GroupVersion == 3
+	})).Return([]byte("test-export-job"), false, nil)
+	suite.mjc.On("Export", mock.Anything, mock.MatchedBy(func(er model.ExportRequest) bool {
+		return er.IdempotencyKey == "retry-2"
+	})).Return([]byte(nil), false, client.ErrIdempotencyKeyReused)
 
-	ja := jsonassert.New(suite.T())
-	req := httptest.NewRequest(http.MethodGet, "http://example.com/Group/9876/$export?_outputFormat=application/fhir%2Bndjson", nil)
+	w := httptest.NewRecorder()
+	suite.grp.Export(w, suite.groupExportRequest(r.ID, "retry-1"))
+	assert.Equal(suite.T(), http.StatusAccepted, w.Result().StatusCode)
+	assert.Equal(suite.T(), "localhost:3000/api/v2/Jobs/test-export-job", w.Result().Header.Get("Content-Location"))
+
+	w = httptest.NewRecorder()
+	suite.grp.Export(w, suite.groupExportRequest(r.ID, "retry-2"))
+	assert.Equal(suite.T(), http.StatusConflict, w.Result().StatusCode)
+	assert.Contains(suite.T(), w.Body.String(), "Idempotency-Key was already used")
+
+	for _, key := range []string{"has space", strings.Repeat("k", 256)} {
+		w = httptest.NewRecorder()
+		suite.grp.Export(w, suite.groupExportRequest(r.ID, key))
+		assert.Equal(suite.T(), http.StatusBadRequest, w.Result().StatusCode)
+	}
+	suite.mjc.AssertNumberOfCalls(suite.T(), "Export", 2)
+}
+
+func (suite *GroupControllerTestSuite) TestExportGroupPatients() {
+	ab := apitest.AttributionToFHIRResponse(apitest.FilteredGroupjson)
+	var r model.Resource
+	_ = json.Unmarshal(ab, &r)
+
+	suite.mac.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(ab, nil)
+	suite.mjc.On("Export", mock.Anything, mock.MatchedBy(func(er model.ExportRequest) bool {
+		return len(er.MBIs) == 1 && er.MBIs[0] == "2SW4N00AA00"
+	})).Return([]byte("test-export-job"), false, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/Group/9876/$export", nil)
 	ctx := req.Context()
 	ctx = context.WithValue(ctx, constants.ContextKeyOrganization, "12345")
 	ctx = context.WithValue(ctx, constants.ContextKeyGroup, r.ID)
-	ctx = context.WithValue(ctx, constants.ContextKeyRequestURL, faker.URL())
-	ctx = context.WithValue(ctx, constants.ContextKeyRequestingIP, faker.IPv4())
-	ctx = context.WithValue(ctx, middleware.RequestIDKey, "12345")
 	ctx = context.WithValue(ctx, constants.ContextKeyResourceTypes, constants.AllResources)
+	ctx = context.WithValue(ctx, constants.ContextKeyPatients, []string{"2SW4N00AA00"})
 	req = req.WithContext(ctx)
-	req.Header.Set("Prefer", "INVALID")
+	req.Header.Set("Prefer", "respond-async")
 
 	w := httptest.NewRecorder()
 	suite.grp.Export(w, req)
 
-	res := w.Result()
+	assert.Equal(suite.T(), http.StatusAccepted, w.Result().StatusCode)
+	suite.mjc.AssertExpectations(suite.T())
+}
 
-	assert.Equal(suite.T(), http.StatusBadRequest, res.StatusCode)
+func (suite *GroupControllerTestSuite) TestExportGroupPatientsNotMembers() {
+	ab := apitest.AttributionToFHIRResponse(apitest.FilteredGroupjson)
+	var r model.Resource
+	_ = json.Unmarshal(ab, &r)
 
-	resp, _ := ioutil.ReadAll(res.Body)
+	suite.mac.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(ab, nil)
 
-	ja.Assertf(string(resp), `
-    {
-        "issue": [
-            {
-                "severity": "warning",
-                "code": "Business Rule Violation",
-                "details": {
-                    "text": "The 'Prefer' header must be 'respond-async'"
-                },
-                "diagnostics": "12345"
-            }
-        ],
-        "resourceType": "OperationOutcome"
-    }`)
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/Group/9876/$export", nil)
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, constants.ContextKeyOrganization, "12345")
+	ctx = context.WithValue(ctx, constants.ContextKeyGroup, r.ID)
+	ctx = context.WithValue(ctx, constants.ContextKeyPatients, []string{"2SW4N00AA00", "3SW4N00AA00"})
+	req = req.WithContext(ctx)
+	req.Header.Set("Prefer", "respond-async")
+
+	w := httptest.NewRecorder()
+	suite.grp.Export(w, req)
+	res := w.Result()
+
+	b, _ := ioutil.ReadAll(res.Body)
+	assert.Equal(suite.T(), http.StatusBadRequest, res.StatusCode)
+	assert.Contains(suite.T(), string(b), "3SW4N00AA00")
+	assert.NotContains(suite.T(), string(b), "2SW4N00AA00")
+	suite.mjc.AssertNotCalled(suite.T(), "Export", mock.Anything, mock.Anything)
 }
 
-func (suite *GroupControllerTestSuite) TestExportGroupMissingOutputFormat() {
+func (suite *GroupControllerTestSuite) TestExportGroupForwardsWarnings() {
 	ab := apitest.AttributionToFHIRResponse(apitest.FilteredGroupjson)
 	var r model.Resource
 	_ = json.Unmarshal(ab, &r)
 
-	suite.mjc.On("Export", mock.Anything, mock.Anything).Return(apitest.AttributionResponse(apitest.JobJSON), nil)
+	warnings := []string{"Unsupported parameter _count, the parameter was ignored"}
 	suite.mac.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(ab, nil)
+	suite.mjc.On("Export", mock.Anything, mock.MatchedBy(func(er model.ExportRequest) bool {
+		return assert.Equal(suite.T(), warnings, er.Warnings)
+	})).Return([]byte("test-export-job"), false, nil)
 
 	req := httptest.NewRequest(http.MethodGet, "http://example.com/Group/9876/$export", nil)
 	ctx := req.Context()
 	ctx = context.WithValue(ctx, constants.ContextKeyOrganization, "12345")
 	ctx = context.WithValue(ctx, constants.ContextKeyGroup, r.ID)
-	ctx = context.WithValue(ctx, constants.ContextKeyRequestURL, faker.URL())
-	ctx = context.WithValue(ctx, constants.ContextKeyRequestingIP, faker.IPv4())
-	ctx = context.WithValue(ctx, middleware.RequestIDKey, "12345")
 	ctx = context.WithValue(ctx, constants.ContextKeyResourceTypes, constants.AllResources)
+	ctx = context.WithValue(ctx, constants.ContextKeyExportWarnings, warnings)
 	req = req.WithContext(ctx)
-	req.Header.Set("Prefer", "respond-async")
 
 	w := httptest.NewRecorder()
 	suite.grp.Export(w, req)
 
-	res := w.Result()
-
-	assert.Equal(suite.T(), http.StatusAccepted, res.StatusCode)
+	assert.Equal(suite.T(), http.StatusAccepted, w.Result().StatusCode)
+	suite.mjc.AssertExpectations(suite.T())
 }
 
-func (suite *GroupControllerTestSuite) TestExportGroupInvalidOutputFormat() {
+func (suite *GroupControllerTestSuite) TestExportGroupMissingOutputFormat() {
 	ab := apitest.AttributionToFHIRResponse(apitest.FilteredGroupjson)
 	var r model.Resource
 	_ = json.Unmarshal(ab, &r)
 
-	suite.mjc.On("Export", mock.Anything, mock.Anything).Return(apitest.AttributionResponse(apitest.JobJSON), nil)
+	suite.mjc.On("Export", mock.Anything, mock.Anything).Return(apitest.AttributionResponse(apitest.JobJSON), false, nil)
 	suite.mac.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(ab, nil)
 
-	ja := jsonassert.New(suite.T())
-	req := httptest.NewRequest(http.MethodGet, "http://example.com/Group/9876/$export?_outputFormat=INVALID", nil)
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/Group/9876/$export", nil)
 	ctx := req.Context()
 	ctx = context.WithValue(ctx, constants.ContextKeyOrganization, "12345")
 	ctx = context.WithValue(ctx, constants.ContextKeyGroup, r.ID)
@@ -314,24 +367,7 @@ func (suite *GroupControllerTestSuite) TestExportGroupInvalidOutputFormat() {
 
 	res := w.Result()
 
-	assert.Equal(suite.T(), http.StatusBadRequest, res.StatusCode)
-
-	resp, _ := ioutil.ReadAll(res.Body)
-
-	ja.Assertf(string(resp), `
-    {
-        "issue": [
-            {
-                "severity": "warning",
-                "code": "Business Rule Violation",
-                "details": {
-                    "text": "'_outputFormat' query parameter must be 'application/fhir+ndjson', 'application/ndjson', or 'ndjson'"
-                },
-                "diagnostics": "12345"
-            }
-        ],
-        "resourceType": "OperationOutcome"
-    }`)
+	assert.Equal(suite.T(), http.StatusAccepted, res.StatusCode)
 }
 
 func (suite *GroupControllerTestSuite) TestReadNotImplemented() {
@@ -357,3 +393,34 @@ func (suite *GroupControllerTestSuite) TestUpdateNotImplemented() {
 	res := w.Result()
 	assert.Equal(suite.T(), http.StatusNotImplemented, res.StatusCode)
 }
+
+func (suite *GroupControllerTestSuite) TestExportGroupWebhook() {
+	ab := apitest.AttributionToFHIRResponse(apitest.FilteredGroupjson)
+	var r model.Resource
+	_ = json.Unmarshal(ab, &r)
+
+	suite.mac.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(ab, nil)
+	suite.mac.On("GetWebhook", mock.Anything).Once().Return([]byte(nil), client.ErrWebhookNotFound)
+	suite.mac.On("GetWebhook", mock.Anything).Once().Return([]byte(`{"url":"https://example.com/hook"}`), nil)
+	suite.mjc.On("Export", mock.Anything, mock.MatchedBy(func(er model.ExportRequest) bool {
+		return er.WebhookURL == "https://example.com/other"
+	})).Return([]byte("test-export-job"), false, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/Group/9876/$export", nil)
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, constants.ContextKeyOrganization, "12345")
+	ctx = context.WithValue(ctx, constants.ContextKeyGroup, r.ID)
+	ctx = context.WithValue(ctx, constants.ContextKeyResourceTypes, constants.AllResources)
+	ctx = context.WithValue(ctx, constants.ContextKeyWebhook, "https://example.com/other")
+	req = req.WithContext(ctx)
+
+	w := httptest.NewRecorder()
+	suite.grp.Export(w, req)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Result().StatusCode)
+	suite.mjc.AssertNotCalled(suite.T(), "Export", mock.Anything, mock.Anything)
+
+	w = httptest.NewRecorder()
+	suite.grp.Export(w, req)
+	assert.Equal(suite.T(), http.StatusAccepted, w.Result().StatusCode)
+	suite.mjc.AssertExpectations(suite.T())
+}
@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"github.com/CMSgov/dpc/api/constants"
 	"net/http"
+	"net/url"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/CMSgov/dpc/api/client"
@@ -14,6 +17,8 @@ import (
 	"github.com/CMSgov/dpc/api/fhirror"
 	"github.com/CMSgov/dpc/api/logger"
 	"github.com/CMSgov/dpc/api/model"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
@@ -40,54 +45,237 @@ func (jc *JobControllerImpl) Status(w http.ResponseWriter, r *http.Request) {
 	}
 
 	b, err := jc.jc.Status(r.Context(), jobID)
+	if errors.Is(err, client.ErrJobNotFound) {
+		fhirror.NotFound(r.Context(), w, "Job not found")
+		return
+	}
 	if err != nil {
 		log.Error("Failed to get the job status", zap.Error(err))
-		fhirror.NotFound(r.Context(), w, "Failed to get job status")
+		fhirror.GenericServerIssue(r.Context(), w)
 		return
 	}
 
 	var batches []model.BatchAndFiles
 	if err := json.Unmarshal(b, &batches); err != nil {
 		log.Error("Failed to unmarshal job data", zap.Error(err))
-		fhirror.NotFound(r.Context(), w, "Failed to get job status")
+		fhirror.GenericServerIssue(r.Context(), w)
+		return
+	}
+	if len(batches) == 0 {
+		fhirror.NotFound(r.Context(), w, "Job not found")
 		return
 	}
 
 	statuses := GetStatus(batches)
-	if statuses["FAILED"] {
-		log.Error(fmt.Sprintf("Failed batches found in job %s", jobID))
-		fhirror.GenericServerIssue(r.Context(), w)
-		return
-	} else if statuses["RUNNING"] || statuses["QUEUED"] {
+	if statuses["RUNNING"] || statuses["QUEUED"] {
 		inProgress(w, batches)
 		return
-	} else if len(statuses) == 1 && statuses["COMPLETED"] {
-		complete(r.Context(), w, batches)
+	}
+
+	// an expired job is gone however it finished, so it is checked before its failures
+	expiresAt := getExpiresAt(batches, getLatestCompleteTime(batches))
+	if !time.Now().Before(expiresAt) || isPurged(batches) {
+		fhirror.Gone(r.Context(), w, "The files of this job have expired and were deleted")
 		return
-	} else {
-		w.WriteHeader(http.StatusAccepted)
+	}
+
+	failures := getFailures(batches)
+	if failures.Batches > 0 {
+		if failures.exceedsThreshold(conf.GetAsInt("jobs.maxFailedPatientPercent", 50)) {
+			log.Error(fmt.Sprintf("Job %s failed, %d of %d batches and %d of %d patients failed", jobID,
+				failures.Batches, len(batches), failures.Patients, failures.TotalPatients))
+			fhirror.GenericServerIssue(r.Context(), w)
+			return
+		}
+		log.Warn(fmt.Sprintf("Job %s partially failed, %d of %d batches and %d of %d patients failed", jobID,
+			failures.Batches, len(batches), failures.Patients, failures.TotalPatients))
+	}
+
+	if statuses["COMPLETED"] || statuses["FAILED"] {
+		complete(r.Context(), w, batches, failures, acceptsGzip(r))
 		return
 	}
+	w.WriteHeader(http.StatusAccepted)
+}
 
+// jobFailures summarizes the failed batches of a finished job
+type jobFailures struct {
+	Batches       int
+	Patients      int
+	TotalBatches  int
+	TotalPatients int
 }
 
-func complete(ctx context.Context, w http.ResponseWriter, batches []model.BatchAndFiles) {
-	latestCompleteTime := getLatestCompleteTime(batches)
-	if latestCompleteTime.Before(time.Now().Add(-time.Duration(24) * time.Hour)) {
-		w.WriteHeader(http.StatusGone)
+// exceedsThreshold reports whether so much of the job failed that it is declared failed overall, judged by the
+// share of patients not exported, or of batches when the job has no patients
+func (f jobFailures) exceedsThreshold(maxFailedPercent int) bool {
+	if f.TotalPatients == 0 {
+		return f.Batches*100 > f.TotalBatches*maxFailedPercent
+	}
+	return f.Patients*100 > f.TotalPatients*maxFailedPercent
+}
+
+func getFailures(batches []model.BatchAndFiles) jobFailures {
+	f := jobFailures{TotalBatches: len(batches)}
+	for _, b := range batches {
+		f.TotalPatients += b.Batch.TotalPatients
+		if b.Batch.Status == "FAILED" {
+			f.Batches++
+			f.Patients += b.Batch.TotalPatients - b.Batch.PatientsProcessed
+		}
+	}
+	return f
+}
+
+// Cancel function that cancels a job and deletes its files according to FHIR Bulk Data
+func (jc *JobControllerImpl) Cancel(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	jobID, ok := r.Context().Value(constants.ContextKeyJobID).(string)
+	if !ok {
+		log.Error("Failed to extract the job id from the context")
+		fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, "Failed to extract job id from url, please check the url")
+		return
+	}
+
+	if err := jc.jc.Cancel(r.Context(), jobID); err != nil {
+		if errors.Is(err, client.ErrJobNotFound) {
+			fhirror.NotFound(r.Context(), w, "Job not found")
+			return
+		}
+		log.Error("Failed to cancel the job", zap.Error(err))
+		fhirror.GenericServerIssue(r.Context(), w)
+		return
+	}
+
+	log.Info(fmt.Sprintf("Cancelled job %s", jobID))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// List function that returns a page of the organization's jobs, filtered by status and submit date
+func (jc *JobControllerImpl) List(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+
+	query, page, count, err := jobListQuery(r.URL.Query())
+	if err != nil {
+		fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	b, err := jc.jc.List(r.Context(), query)
+	if err != nil {
+		log.Error("Failed to list jobs", zap.Error(err))
+		fhirror.GenericServerIssue(r.Context(), w)
+		return
+	}
+
+	var list model.JobList
+	if err := json.Unmarshal(b, &list); err != nil {
+		log.Error("Failed to unmarshal job list", zap.Error(err))
+		fhirror.GenericServerIssue(r.Context(), w)
+		return
+	}
+
+	apiPath := conf.GetAsString("apiPath", "")
+	resp := model.JobListResponse{Jobs: list.Jobs, Page: page, Count: count}
+	for i := range resp.Jobs {
+		resp.Jobs[i].URL = fmt.Sprintf("%s/Jobs/%s", apiPath, resp.Jobs[i].JobID)
+	}
+	if list.HasMore {
+		query.Set("page", strconv.Itoa(page+1))
+		resp.Next = fmt.Sprintf("%s/Jobs?%s", apiPath, query.Encode())
+	}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		log.Error("Failed to marshal job list", zap.Error(err))
+		fhirror.GenericServerIssue(r.Context(), w)
 		return
 	}
+	if _, err := w.Write(body); err != nil {
+		log.Error("Failed to write job list to response", zap.Error(err))
+		fhirror.GenericServerIssue(r.Context(), w)
+	}
+}
+
+var jobStatuses = map[string]bool{"QUEUED": true, "RUNNING": true, "COMPLETED": true, "FAILED": true, "CANCELLED": true}
+
+// jobListQuery validates the job list parameters and returns the query to forward to the job service
+func jobListQuery(params url.Values) (url.Values, int, int, error) {
+	query := url.Values{}
+
+	if s := params.Get("status"); s != "" {
+		statuses := strings.Split(strings.ToUpper(s), ",")
+		for i, status := range statuses {
+			statuses[i] = strings.TrimSpace(status)
+			if !jobStatuses[statuses[i]] {
+				return nil, 0, 0, errors.Errorf("Invalid status %s, must be one of QUEUED, RUNNING, COMPLETED, FAILED or CANCELLED", status)
+			}
+		}
+		query.Set("status", strings.Join(statuses, ","))
+	}
+
+	for _, param := range []string{"submittedAfter", "submittedBefore"} {
+		if s := params.Get(param); s != "" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				return nil, 0, 0, errors.Errorf("Invalid %s, must be an RFC3339 timestamp", param)
+			}
+			query.Set(param, s)
+		}
+	}
+
+	if s := params.Get("scheduleId"); s != "" {
+		if _, err := uuid.Parse(s); err != nil {
+			return nil, 0, 0, errors.New("Invalid scheduleId")
+		}
+		query.Set("scheduleId", s)
+	}
+
+	count := conf.GetAsInt("jobs.defaultPageSize", 50)
+	maxCount := conf.GetAsInt("jobs.maxPageSize", 500)
+	if s := params.Get("_count"); s != "" {
+		c, err := strconv.Atoi(s)
+		if err != nil || c < 1 || c > maxCount {
+			return nil, 0, 0, errors.Errorf("Invalid _count, must be between 1 and %d", maxCount)
+		}
+		count = c
+	}
+	query.Set("_count", strconv.Itoa(count))
+
+	page := 1
+	if s := params.Get("page"); s != "" {
+		p, err := strconv.Atoi(s)
+		if err != nil || p < 1 {
+			return nil, 0, 0, errors.New("Invalid page, must be a positive number")
+		}
+		page = p
+	}
+	query.Set("page", strconv.Itoa(page))
+	return query, page, count, nil
+}
+
+// complete writes the manifest of a finished job. Its file checksums and lengths describe the files as they will be
+// downloaded, gzip encoded when the client accepts it.
+func complete(ctx context.Context, w http.ResponseWriter, batches []model.BatchAndFiles, failures jobFailures, gzip bool) {
+	latestCompleteTime := getLatestCompleteTime(batches)
+	expiresAt := getExpiresAt(batches, latestCompleteTime)
 
 	files := make([]model.BatchFile, 0)
 	for _, b := range batches {
+		if b.Files == nil {
+			continue
+		}
 		files = append(files, *b.Files...)
 	}
 
-	outputs, errors := formOutputList(files)
+	outputs, errors := formOutputList(files, gzip)
 
 	jobExtension := make([]map[string]interface{}, 0)
 	jobExtension = append(jobExtension, map[string]interface{}{"url": "https://dpc.cms.gov/submit_time", "valueDateTime": getEarliestSubmitTime(batches)})
 	jobExtension = append(jobExtension, map[string]interface{}{"url": "https://dpc.cms.gov/complete_time", "valueDateTime": latestCompleteTime})
+	if failures.Batches > 0 {
+		jobExtension = append(jobExtension, map[string]interface{}{"url": "https://dpc.cms.gov/failed_batches", "valueInteger": failures.Batches})
+		jobExtension = append(jobExtension, map[string]interface{}{"url": "https://dpc.cms.gov/failed_patients", "valueInteger": failures.Patients})
+	}
 
 	status := &model.Status{
 		TransactionTime:     batches[0].Batch.TransactionTime,
@@ -104,7 +292,8 @@ func complete(ctx context.Context, w http.ResponseWriter, batches []model.BatchA
 		return
 	}
 
-	w.Header().Add("Expires", latestCompleteTime.Add(time.Duration(24)*time.Hour).Format(time.RFC1123))
+	w.Header().Set("Vary", "Accept-Encoding")
+	w.Header().Add("Expires", expiresAt.Format(time.RFC1123))
 	if _, err := w.Write(b); err != nil {
 		fhirror.GenericServerIssue(ctx, w)
 		return
@@ -121,7 +310,37 @@ func getLatestCompleteTime(batches []model.BatchAndFiles) time.Time {
 	return *batches[0].Batch.CompleteTime
 }
 
-func formOutputList(files []model.BatchFile) ([]model.Output, []model.Output) {
+// getExpiresAt returns when the files of the job are purged, which is decided by the retention policy of the
+// organization, falling back to 24 hours after completion when the job service doesn't report it
+func getExpiresAt(batches []model.BatchAndFiles, latestCompleteTime time.Time) time.Time {
+	var expiresAt *time.Time
+	for _, b := range batches {
+		if b.Batch.ExpiresAt != nil && (expiresAt == nil || b.Batch.ExpiresAt.After(*expiresAt)) {
+			expiresAt = b.Batch.ExpiresAt
+		}
+	}
+	if expiresAt == nil {
+		return latestCompleteTime.Add(time.Duration(24) * time.Hour)
+	}
+	return *expiresAt
+}
+
+// isPurged reports whether any file of the job was already deleted by the retention sweeper
+func isPurged(batches []model.BatchAndFiles) bool {
+	for _, b := range batches {
+		if b.Files == nil {
+			continue
+		}
+		for _, f := range *b.Files {
+			if f.PurgedAt != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func formOutputList(files []model.BatchFile, gzip bool) ([]model.Output, []model.Output) {
 	var outputs = make([]model.Output, 0)
 	var errors = make([]model.Output, 0)
 	for _, f := range files {
@@ -134,33 +353,104 @@ func formOutputList(files []model.BatchFile) ([]model.Output, []model.Output) {
 			errors = append(errors, output)
 		} else {
 			output.Count = f.Count
-			output.Extension = fhirExtensions(f)
+			output.Extension = fhirExtensions(f, gzip)
 			outputs = append(outputs, output)
 		}
 	}
 	return outputs, errors
 }
 
-func fhirExtensions(f model.BatchFile) []map[string]interface{} {
+func fhirExtensions(f model.BatchFile, gzip bool) []map[string]interface{} {
 	m := make([]map[string]interface{}, 0)
+	if gzip && f.Compressed() {
+		m = append(m, map[string]interface{}{"url": "https://dpc.cms.gov/checksum", "valueString": f.CompressedChecksum})
+		m = append(m, map[string]interface{}{"url": "https://dpc.cms.gov/file_length", "valueDecimal": f.CompressedFileLength})
+		m = append(m, map[string]interface{}{"url": "https://dpc.cms.gov/content_encoding", "valueString": "gzip"})
+		return m
+	}
 	m = append(m, map[string]interface{}{"url": "https://dpc.cms.gov/checksum", "valueString": f.Checksum})
 	m = append(m, map[string]interface{}{"url": "https://dpc.cms.gov/file_length", "valueDecimal": f.FileLength})
 	return m
 }
 
+// inProgress writes the progress of an unfinished job. Finished batches count all of their patients as done and
+// running ones the patients they have processed so far. The job finishes with its slowest batch, so its time remaining
+// is only known when every unfinished batch has an estimate.
 func inProgress(w http.ResponseWriter, batches []model.BatchAndFiles) {
-	progress := "QUEUED: 0.00%"
-	patientsProcessed := 0
-	totalPatients := 0
+	state := "QUEUED"
+	done, total := 0, 0
+	var remaining *int
+	estimated := true
 	for _, b := range batches {
-		patientsProcessed += b.Batch.PatientsProcessed
-		totalPatients += b.Batch.TotalPatients
+		total += b.Batch.TotalPatients
+		switch b.Batch.Status {
+		case "COMPLETED", "FAILED":
+			state = "RUNNING"
+			done += b.Batch.TotalPatients
+			continue
+		case "RUNNING":
+			state = "RUNNING"
+			done += b.Batch.PatientsProcessed
+		}
+		if b.Batch.EstimatedSecondsRemaining == nil {
+			estimated = false
+		} else if remaining == nil || *b.Batch.EstimatedSecondsRemaining > *remaining {
+			remaining = b.Batch.EstimatedSecondsRemaining
+		}
+	}
+	if !estimated {
+		remaining = nil
+	}
+
+	progress := 0.0
+	if total > 0 {
+		progress = float64(done) / float64(total) * 100.0
+	}
+	details := queueProgress(batches)
+	if remaining != nil {
+		details = append(details, fmt.Sprintf("estimated %ds remaining", *remaining))
+	}
+	header := fmt.Sprintf("%s: %.2f%%", state, progress)
+	if len(details) > 0 {
+		header += fmt.Sprintf(" (%s)", strings.Join(details, ", "))
+	}
+	w.Header().Add("X-Progress", header)
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter(remaining)))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// retryAfter paces the polling of an unfinished job by its time remaining, within the configured bounds
+func retryAfter(remaining *int) int {
+	if remaining == nil {
+		return conf.GetAsInt("jobs.retryAfterDefaultSeconds", 30)
+	}
+	minSeconds := conf.GetAsInt("jobs.retryAfterMinSeconds", 5)
+	maxSeconds := conf.GetAsInt("jobs.retryAfterMaxSeconds", 120)
+	if *remaining < minSeconds {
+		return minSeconds
+	}
+	if *remaining > maxSeconds {
+		return maxSeconds
+	}
+	return *remaining
+}
+
+// queueProgress describes where the job's next queued batch stands in the export queue, if any are still queued
+func queueProgress(batches []model.BatchAndFiles) []string {
+	var next *model.BatchInfo
+	for _, b := range batches {
+		if b.Batch.QueuePosition != nil && (next == nil || *b.Batch.QueuePosition < *next.QueuePosition) {
+			next = b.Batch
+		}
+	}
+	if next == nil {
+		return nil
 	}
-	if totalPatients > 0 {
-		progress = fmt.Sprintf("RUNNING: %.2f%%", float32(patientsProcessed)/float32(totalPatients)*100.0)
+	details := []string{fmt.Sprintf("queue position %d", *next.QueuePosition)}
+	if next.EstimatedWaitSeconds != nil {
+		details = append(details, fmt.Sprintf("estimated wait %ds", *next.EstimatedWaitSeconds))
 	}
-	w.Header().Add("X-Progress", progress)
-	w.WriteHeader(202)
+	return details
 }
 
 // GetStatus function returns a set of statues of the batches
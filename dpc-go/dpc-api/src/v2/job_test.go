@@ -5,16 +5,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/CMSgov/dpc/api/apitest"
+	"github.com/CMSgov/dpc/api/client"
 	"github.com/CMSgov/dpc/api/conf"
 	"github.com/CMSgov/dpc/api/constants"
 	"github.com/CMSgov/dpc/api/model"
 	"github.com/go-chi/chi/middleware"
 	"github.com/kinbiko/jsonassert"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 	"time"
 )
@@ -28,8 +32,23 @@ func (ac *MockJobClient) Status(ctx context.Context, jobID string) ([]byte, erro
 	return args.Get(0).([]byte), args.Error(1)
 }
 
-func (mc *MockJobClient) Export(ctx context.Context, request model.ExportRequest) ([]byte, error) {
+func (ac *MockJobClient) WaitForStatus(ctx context.Context, jobID string, wait time.Duration) ([]byte, error) {
+	args := ac.Called(ctx, jobID, wait)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (mc *MockJobClient) Export(ctx context.Context, request model.ExportRequest) ([]byte, bool, error) {
 	args := mc.Called(ctx, request)
+	return args.Get(0).([]byte), args.Bool(1), args.Error(2)
+}
+
+func (mc *MockJobClient) Cancel(ctx context.Context, jobID string) error {
+	args := mc.Called(ctx, jobID)
+	return args.Error(0)
+}
+
+func (mc *MockJobClient) List(ctx context.Context, query url.Values) ([]byte, error) {
+	args := mc.Called(ctx, query)
 	return args.Get(0).([]byte), args.Error(1)
 }
 
@@ -112,3 +131,355 @@ func (suite *JobControllerTestSuite) TestGetStatus() {
   ]
 }`, apiPath))
 }
+
+func (suite *JobControllerTestSuite) TestGetStatusPartialFailure() {
+	now := time.Now()
+	var batches []model.BatchAndFiles
+	_ = json.Unmarshal([]byte(apitest.GetBatchAndFilesJSON), &batches)
+	batches[0].Batch.CompleteTime = &now
+	failedFiles := []model.BatchFile{{ResourceType: "OperationOutcome", BatchID: "failed-batch", Sequence: 0, Count: 4}}
+	batches = append(batches, model.BatchAndFiles{
+		Batch: &model.BatchInfo{TotalPatients: 5, PatientsProcessed: 1, Status: "FAILED", SubmitTime: now, CompleteTime: &now},
+		Files: &failedFiles,
+	})
+	b, _ := json.Marshal(batches)
+	suite.mjc.On("Status", mock.Anything, mock.Anything).Return(b, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	ctx := context.WithValue(req.Context(), middleware.RequestIDKey, "12345")
+	ctx = context.WithValue(ctx, constants.ContextKeyJobID, "54321")
+	req = req.WithContext(ctx)
+
+	w := httptest.NewRecorder()
+	suite.job.Status(w, req)
+
+	res := w.Result()
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+	var status model.Status
+	_ = json.NewDecoder(res.Body).Decode(&status)
+	assert.Len(suite.T(), status.Output, 1)
+	assert.Len(suite.T(), status.Error, 1)
+	assert.Contains(suite.T(), status.Error[0].URL, "failed-batch-0.operationoutcome.ndjson")
+	assert.Contains(suite.T(), status.Extension, map[string]interface{}{"url": "https://dpc.cms.gov/failed_batches", "valueInteger": float64(1)})
+	assert.Contains(suite.T(), status.Extension, map[string]interface{}{"url": "https://dpc.cms.gov/failed_patients", "valueInteger": float64(4)})
+}
+
+func (suite *JobControllerTestSuite) TestGetStatusGzip() {
+	now := time.Now()
+	var batches []model.BatchAndFiles
+	_ = json.Unmarshal([]byte(apitest.GetBatchAndFilesJSON), &batches)
+	batches[0].Batch.CompleteTime = &now
+	(*batches[0].Files)[0].CompressedChecksum = "abcdef"
+	(*batches[0].Files)[0].CompressedFileLength = 123
+	b, _ := json.Marshal(batches)
+	suite.mjc.On("Status", mock.Anything, mock.Anything).Return(b, nil)
+
+	status := func(acceptEncoding string) model.Status {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		ctx := context.WithValue(req.Context(), middleware.RequestIDKey, "12345")
+		ctx = context.WithValue(ctx, constants.ContextKeyJobID, "54321")
+		w := httptest.NewRecorder()
+		suite.job.Status(w, req.WithContext(ctx))
+		assert.Equal(suite.T(), "Accept-Encoding", w.Result().Header.Get("Vary"))
+		var s model.Status
+		_ = json.NewDecoder(w.Result().Body).Decode(&s)
+		return s
+	}
+
+	gzipped := status("gzip, deflate")
+	assert.Equal(suite.T(), []map[string]interface{}{
+		{"url": "https://dpc.cms.gov/checksum", "valueString": "abcdef"},
+		{"url": "https://dpc.cms.gov/file_length", "valueDecimal": float64(123)},
+		{"url": "https://dpc.cms.gov/content_encoding", "valueString": "gzip"},
+	}, gzipped.Output[0].Extension)
+
+	plain := status("gzip;q=0")
+	assert.Equal(suite.T(), []map[string]interface{}{
+		{"url": "https://dpc.cms.gov/checksum", "valueString": (*batches[0].Files)[0].Checksum},
+		{"url": "https://dpc.cms.gov/file_length", "valueDecimal": float64(1234)},
+	}, plain.Output[0].Extension)
+}
+
+func (suite *JobControllerTestSuite) TestGetStatusExpiry() {
+	status := func(batches []model.BatchAndFiles) *http.Response {
+		b, _ := json.Marshal(batches)
+		mjc := new(MockJobClient)
+		mjc.On("Status", mock.Anything, mock.Anything).Return(b, nil)
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+		ctx := context.WithValue(req.Context(), middleware.RequestIDKey, "12345")
+		ctx = context.WithValue(ctx, constants.ContextKeyJobID, "54321")
+		w := httptest.NewRecorder()
+		NewJobController(mjc).Status(w, req.WithContext(ctx))
+		return w.Result()
+	}
+	batches := func(completeTime time.Time, expiresAt *time.Time) []model.BatchAndFiles {
+		var batches []model.BatchAndFiles
+		_ = json.Unmarshal([]byte(apitest.GetBatchAndFilesJSON), &batches)
+		batches[0].Batch.CompleteTime = &completeTime
+		batches[0].Batch.ExpiresAt = expiresAt
+		return batches
+	}
+
+	// the organization keeps its files for three days
+	completed := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	expiresAt := completed.Add(72 * time.Hour)
+	res := status(batches(completed, &expiresAt))
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+	assert.Equal(suite.T(), expiresAt.Format(time.RFC1123), res.Header.Get("Expires"))
+
+	// without an expiry from the job service the files are kept for a day
+	res = status(batches(completed, nil))
+	assert.Equal(suite.T(), http.StatusGone, res.StatusCode)
+	body, _ := ioutil.ReadAll(res.Body)
+	assert.Contains(suite.T(), string(body), "OperationOutcome")
+
+	purged := batches(completed, &expiresAt)
+	(*purged[0].Files)[0].PurgedAt = &completed
+	assert.Equal(suite.T(), http.StatusGone, status(purged).StatusCode)
+}
+
+func (suite *JobControllerTestSuite) TestGetStatusQueued() {
+	position, wait := 5, 90
+	now := time.Now()
+	batches := []model.BatchAndFiles{
+		{Batch: &model.BatchInfo{TotalPatients: 100, PatientsProcessed: 25, Status: "RUNNING", SubmitTime: now}},
+		{Batch: &model.BatchInfo{TotalPatients: 100, Status: "QUEUED", SubmitTime: now, QueuePosition: &position, EstimatedWaitSeconds: &wait}},
+	}
+	b, _ := json.Marshal(batches)
+	suite.mjc.On("Status", mock.Anything, mock.Anything).Return(b, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	ctx := context.WithValue(req.Context(), middleware.RequestIDKey, "12345")
+	ctx = context.WithValue(ctx, constants.ContextKeyJobID, "54321")
+	req = req.WithContext(ctx)
+
+	w := httptest.NewRecorder()
+	suite.job.Status(w, req)
+
+	assert.Equal(suite.T(), http.StatusAccepted, w.Result().StatusCode)
+	assert.Equal(suite.T(), "RUNNING: 12.50% (queue position 5, estimated wait 90s)", w.Result().Header.Get("X-Progress"))
+	assert.Equal(suite.T(), "30", w.Result().Header.Get("Retry-After"))
+}
+
+func (suite *JobControllerTestSuite) TestGetStatusProgress() {
+	status := func(batches ...*model.BatchInfo) *http.Response {
+		bf := make([]model.BatchAndFiles, 0)
+		for _, b := range batches {
+			bf = append(bf, model.BatchAndFiles{Batch: b})
+		}
+		b, _ := json.Marshal(bf)
+		mjc := new(MockJobClient)
+		mjc.On("Status", mock.Anything, mock.Anything).Return(b, nil)
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+		ctx := context.WithValue(req.Context(), middleware.RequestIDKey, "12345")
+		ctx = context.WithValue(ctx, constants.ContextKeyJobID, "54321")
+		w := httptest.NewRecorder()
+		NewJobController(mjc).Status(w, req.WithContext(ctx))
+		return w.Result()
+	}
+	seconds := func(s int) *int { return &s }
+
+	// a completed batch counts all of its patients, and the job finishes with its slowest batch
+	res := status(
+		&model.BatchInfo{TotalPatients: 100, PatientsProcessed: 100, Status: "COMPLETED"},
+		&model.BatchInfo{TotalPatients: 100, PatientsProcessed: 50, Status: "RUNNING", EstimatedSecondsRemaining: seconds(40)},
+		&model.BatchInfo{TotalPatients: 200, PatientsProcessed: 0, Status: "RUNNING", EstimatedSecondsRemaining: seconds(80)},
+	)
+	assert.Equal(suite.T(), http.StatusAccepted, res.StatusCode)
+	assert.Equal(suite.T(), "RUNNING: 37.50% (estimated 80s remaining)", res.Header.Get("X-Progress"))
+	assert.Equal(suite.T(), "80", res.Header.Get("Retry-After"))
+
+	res = status(&model.BatchInfo{TotalPatients: 10, Status: "QUEUED", EstimatedSecondsRemaining: seconds(1)})
+	assert.Equal(suite.T(), "QUEUED: 0.00% (estimated 1s remaining)", res.Header.Get("X-Progress"))
+	assert.Equal(suite.T(), "5", res.Header.Get("Retry-After"))
+
+	res = status(&model.BatchInfo{TotalPatients: 10, Status: "RUNNING", EstimatedSecondsRemaining: seconds(3600)})
+	assert.Equal(suite.T(), "120", res.Header.Get("Retry-After"))
+
+	// without an estimate for every unfinished batch the time remaining is unknown
+	res = status(
+		&model.BatchInfo{TotalPatients: 10, PatientsProcessed: 5, Status: "RUNNING", EstimatedSecondsRemaining: seconds(10)},
+		&model.BatchInfo{TotalPatients: 10, Status: "QUEUED"},
+	)
+	assert.Equal(suite.T(), "RUNNING: 25.00%", res.Header.Get("X-Progress"))
+	assert.Equal(suite.T(), "30", res.Header.Get("Retry-After"))
+}
+
+func (suite *JobControllerTestSuite) TestGetStatusNotFound() {
+	suite.mjc.On("Status", mock.Anything, "54321").Once().Return([]byte(nil), client.ErrJobNotFound)
+	suite.mjc.On("Status", mock.Anything, "54321").Once().Return([]byte(nil), errors.New("error"))
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	ctx := context.WithValue(req.Context(), middleware.RequestIDKey, "12345")
+	ctx = context.WithValue(ctx, constants.ContextKeyJobID, "54321")
+	req = req.WithContext(ctx)
+
+	w := httptest.NewRecorder()
+	suite.job.Status(w, req)
+	b, _ := ioutil.ReadAll(w.Result().Body)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Result().StatusCode)
+	assert.Contains(suite.T(), string(b), "Job not found")
+
+	w = httptest.NewRecorder()
+	suite.job.Status(w, req)
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Result().StatusCode)
+}
+
+func (suite *JobControllerTestSuite) TestGetStatusExpiredFailed() {
+	completed := time.Now().Add(-48 * time.Hour)
+	batches := []model.BatchAndFiles{
+		{Batch: &model.BatchInfo{TotalPatients: 100, Status: "FAILED", SubmitTime: completed, CompleteTime: &completed}},
+	}
+	b, _ := json.Marshal(batches)
+	suite.mjc.On("Status", mock.Anything, mock.Anything).Return(b, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	ctx := context.WithValue(req.Context(), middleware.RequestIDKey, "12345")
+	ctx = context.WithValue(ctx, constants.ContextKeyJobID, "54321")
+	req = req.WithContext(ctx)
+
+	w := httptest.NewRecorder()
+	suite.job.Status(w, req)
+
+	assert.Equal(suite.T(), http.StatusGone, w.Result().StatusCode)
+}
+
+func (suite *JobControllerTestSuite) TestGetStatusFailedOverThreshold() {
+	now := time.Now()
+	var batches []model.BatchAndFiles
+	_ = json.Unmarshal([]byte(apitest.GetBatchAndFilesJSON), &batches)
+	batches[0].Batch.CompleteTime = &now
+	batches = append(batches, model.BatchAndFiles{
+		Batch: &model.BatchInfo{TotalPatients: 100, PatientsProcessed: 0, Status: "FAILED", SubmitTime: now, CompleteTime: &now},
+	})
+	b, _ := json.Marshal(batches)
+	suite.mjc.On("Status", mock.Anything, mock.Anything).Return(b, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	ctx := context.WithValue(req.Context(), middleware.RequestIDKey, "12345")
+	ctx = context.WithValue(ctx, constants.ContextKeyJobID, "54321")
+	req = req.WithContext(ctx)
+
+	w := httptest.NewRecorder()
+	suite.job.Status(w, req)
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Result().StatusCode)
+}
+
+func (suite *JobControllerTestSuite) TestJobFailuresThreshold() {
+	tests := []struct {
+		failures jobFailures
+		exceeds  bool
+	}{
+		{jobFailures{Batches: 1, Patients: 10, TotalBatches: 4, TotalPatients: 100}, false},
+		{jobFailures{Batches: 2, Patients: 51, TotalBatches: 4, TotalPatients: 100}, true},
+		{jobFailures{Batches: 2, Patients: 0, TotalBatches: 2, TotalPatients: 0}, true},
+		{jobFailures{Batches: 1, Patients: 0, TotalBatches: 4, TotalPatients: 0}, false},
+		{jobFailures{Batches: 1, Patients: 1, TotalBatches: 1, TotalPatients: 100}, false},
+		{jobFailures{Batches: 1, Patients: 100, TotalBatches: 1, TotalPatients: 100}, true},
+	}
+	for _, test := range tests {
+		assert.Equal(suite.T(), test.exceeds, test.failures.exceedsThreshold(50), test.failures)
+	}
+}
+
+func (suite *JobControllerTestSuite) TestCancel() {
+	suite.mjc.On("Cancel", mock.Anything, "54321").Return(nil)
+
+	req := httptest.NewRequest(http.MethodDelete, "http://example.com/foo", nil)
+	ctx := context.WithValue(req.Context(), middleware.RequestIDKey, "12345")
+	ctx = context.WithValue(ctx, constants.ContextKeyJobID, "54321")
+	req = req.WithContext(ctx)
+
+	w := httptest.NewRecorder()
+	suite.job.Cancel(w, req)
+
+	assert.Equal(suite.T(), http.StatusAccepted, w.Result().StatusCode)
+}
+
+func (suite *JobControllerTestSuite) TestCancelNotFound() {
+	suite.mjc.On("Cancel", mock.Anything, "54321").Return(client.ErrJobNotFound)
+
+	req := httptest.NewRequest(http.MethodDelete, "http://example.com/foo", nil)
+	ctx := context.WithValue(req.Context(), middleware.RequestIDKey, "12345")
+	ctx = context.WithValue(ctx, constants.ContextKeyJobID, "54321")
+	req = req.WithContext(ctx)
+
+	w := httptest.NewRecorder()
+	suite.job.Cancel(w, req)
+
+	res := w.Result()
+	b, _ := ioutil.ReadAll(res.Body)
+	assert.Equal(suite.T(), http.StatusNotFound, res.StatusCode)
+	assert.Contains(suite.T(), string(b), "Job not found")
+}
+
+func (suite *JobControllerTestSuite) TestCancelError() {
+	suite.mjc.On("Cancel", mock.Anything, "54321").Return(errors.New("error"))
+
+	req := httptest.NewRequest(http.MethodDelete, "http://example.com/foo", nil)
+	ctx := context.WithValue(req.Context(), middleware.RequestIDKey, "12345")
+	ctx = context.WithValue(ctx, constants.ContextKeyJobID, "54321")
+	req = req.WithContext(ctx)
+
+	w := httptest.NewRecorder()
+	suite.job.Cancel(w, req)
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Result().StatusCode)
+}
+
+func (suite *JobControllerTestSuite) TestList() {
+	apiPath := conf.GetAsString("apiPath")
+	expectedQuery := url.Values{"status": {"COMPLETED,FAILED"}, "submittedAfter": {"2021-01-01T00:00:00Z"}, "scheduleId": {"0c527d2e-2e8a-4808-b11d-0fa06baf8254"}, "_count": {"1"}, "page": {"2"}}
+	suite.mjc.On("List", mock.Anything, expectedQuery).Return([]byte(`{
+		"jobs": [{"jobID": "54321", "status": "COMPLETED", "submitTime": "2021-01-02T00:00:00Z", "completeTime": "2021-01-02T00:10:00Z", "resourceTypes": ["Patient"], "patientCount": 2, "requestURL": "http://dpc/Group/1/$export", "scheduleID": "0c527d2e-2e8a-4808-b11d-0fa06baf8254"}],
+		"hasMore": true
+	}`), nil)
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/Jobs?status=completed,failed&submittedAfter=2021-01-01T00:00:00Z&scheduleId=0c527d2e-2e8a-4808-b11d-0fa06baf8254&_count=1&page=2", nil)
+	ctx := context.WithValue(req.Context(), middleware.RequestIDKey, "12345")
+	req = req.WithContext(ctx)
+
+	w := httptest.NewRecorder()
+	suite.job.List(w, req)
+
+	res := w.Result()
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+	b, _ := ioutil.ReadAll(res.Body)
+	var resp model.JobListResponse
+	_ = json.Unmarshal(b, &resp)
+	assert.Equal(suite.T(), 2, resp.Page)
+	assert.Equal(suite.T(), 1, resp.Count)
+	assert.Len(suite.T(), resp.Jobs, 1)
+	assert.Equal(suite.T(), fmt.Sprintf("%s/Jobs/54321", apiPath), resp.Jobs[0].URL)
+	assert.Equal(suite.T(), 2, resp.Jobs[0].PatientCount)
+	assert.Equal(suite.T(), "0c527d2e-2e8a-4808-b11d-0fa06baf8254", resp.Jobs[0].ScheduleID)
+	assert.Contains(suite.T(), resp.Next, fmt.Sprintf("%s/Jobs?", apiPath))
+	assert.Contains(suite.T(), resp.Next, "page=3")
+}
+
+func (suite *JobControllerTestSuite) TestListInvalidParams() {
+	for _, q := range []string{"status=DONE", "submittedBefore=yesterday", "_count=0", "_count=100000", "page=-1", "scheduleId=abc"} {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/Jobs?"+q, nil)
+		req = req.WithContext(context.WithValue(req.Context(), middleware.RequestIDKey, "12345"))
+
+		w := httptest.NewRecorder()
+		suite.job.List(w, req)
+
+		assert.Equal(suite.T(), http.StatusBadRequest, w.Result().StatusCode, q)
+	}
+	suite.mjc.AssertNotCalled(suite.T(), "List", mock.Anything, mock.Anything)
+}
+
+func (suite *JobControllerTestSuite) TestListError() {
+	suite.mjc.On("List", mock.Anything, mock.Anything).Return([]byte(nil), errors.New("error"))
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/Jobs", nil)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.RequestIDKey, "12345"))
+
+	w := httptest.NewRecorder()
+	suite.job.List(w, req)
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Result().StatusCode)
+}
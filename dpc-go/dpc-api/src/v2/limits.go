@@ -0,0 +1,96 @@
+package v2
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/CMSgov/dpc/api/constants"
+	"github.com/CMSgov/dpc/api/fhirror"
+	"github.com/CMSgov/dpc/api/logger"
+	"github.com/CMSgov/dpc/api/ratelimit"
+	"go.uber.org/zap"
+)
+
+// LimitsController is an interface for admins to manage the request rate and export quotas of an organization
+type LimitsController interface {
+	ReadController
+	UpdateController
+	DeleteController
+}
+
+// OrganizationLimitsController is a struct that defines what the controller has
+type OrganizationLimitsController struct {
+	limiter *ratelimit.Limiter
+}
+
+// NewLimitsController creates a limits controller and returns its reference
+func NewLimitsController(limiter *ratelimit.Limiter) *OrganizationLimitsController {
+	return &OrganizationLimitsController{
+		limiter,
+	}
+}
+
+// Read function returns the limits the organization is held to
+func (lc *OrganizationLimitsController) Read(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	orgID, _ := r.Context().Value(constants.ContextKeyOrganization).(string)
+
+	limits, err := lc.limiter.Get(r.Context(), orgID)
+	if err != nil {
+		log.Error("Failed to get the organization limits", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Failed to get organization limits")
+		return
+	}
+	writeLimits(w, r, limits)
+}
+
+// Update function overrides the limits of the organization
+func (lc *OrganizationLimitsController) Update(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	orgID, _ := r.Context().Value(constants.ContextKeyOrganization).(string)
+
+	var limits ratelimit.Limits
+	if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+		log.Error("Failed to parse organization limits", zap.Error(err))
+		fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, "Body must be limits with requestsPerSecond, burst, dailyJobs and dailyPatients")
+		return
+	}
+	if err := limits.Validate(); err != nil {
+		fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := lc.limiter.Set(r.Context(), orgID, &limits); err != nil {
+		log.Error("Failed to save the organization limits", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Failed to save organization limits")
+		return
+	}
+	writeLimits(w, r, limits)
+}
+
+// Delete function resets the organization to the default limits
+func (lc *OrganizationLimitsController) Delete(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	orgID, _ := r.Context().Value(constants.ContextKeyOrganization).(string)
+
+	if err := lc.limiter.Set(r.Context(), orgID, nil); err != nil {
+		log.Error("Failed to reset the organization limits", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Failed to reset organization limits")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeLimits(w http.ResponseWriter, r *http.Request, limits ratelimit.Limits) {
+	log := logger.WithContext(r.Context())
+	b, err := json.Marshal(limits)
+	if err != nil {
+		log.Error("Failed to convert organization limits to bytes", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if _, err := w.Write(b); err != nil {
+		log.Error("Failed to write data to response", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Internal server error")
+	}
+}
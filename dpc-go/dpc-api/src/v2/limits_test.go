@@ -0,0 +1,85 @@
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CMSgov/dpc/api/constants"
+	"github.com/CMSgov/dpc/api/ratelimit"
+	"github.com/go-chi/chi/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type LimitsControllerTestSuite struct {
+	suite.Suite
+	defaults ratelimit.Limits
+	limiter  *ratelimit.Limiter
+	lc       LimitsController
+}
+
+func TestLimitsControllerTestSuite(t *testing.T) {
+	suite.Run(t, new(LimitsControllerTestSuite))
+}
+
+func (suite *LimitsControllerTestSuite) SetupTest() {
+	suite.defaults = ratelimit.Limits{RequestsPerSecond: 10, Burst: 20}
+	suite.limiter = ratelimit.NewLimiter(ratelimit.NewMemoryStore(), suite.defaults)
+	suite.lc = NewLimitsController(suite.limiter)
+}
+
+func (suite *LimitsControllerTestSuite) request(method string, body string) *http.Request {
+	req := httptest.NewRequest(method, "http://example.com/Organization/12345/limits", strings.NewReader(body))
+	ctx := context.WithValue(req.Context(), middleware.RequestIDKey, "54321")
+	ctx = context.WithValue(ctx, constants.ContextKeyOrganization, "12345")
+	return req.WithContext(ctx)
+}
+
+func (suite *LimitsControllerTestSuite) read() ratelimit.Limits {
+	w := httptest.NewRecorder()
+	suite.lc.Read(w, suite.request(http.MethodGet, ""))
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+
+	var limits ratelimit.Limits
+	_ = json.NewDecoder(w.Result().Body).Decode(&limits)
+	return limits
+}
+
+func (suite *LimitsControllerTestSuite) TestReadUpdateDelete() {
+	assert.Equal(suite.T(), suite.defaults, suite.read())
+
+	w := httptest.NewRecorder()
+	suite.lc.Update(w, suite.request(http.MethodPut, `{"requestsPerSecond":2.5,"burst":5,"dailyJobs":10,"dailyPatients":5000}`))
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+
+	expected := ratelimit.Limits{RequestsPerSecond: 2.5, Burst: 5, DailyJobs: 10, DailyPatients: 5000}
+	assert.Equal(suite.T(), expected, suite.read())
+
+	w = httptest.NewRecorder()
+	suite.lc.Delete(w, suite.request(http.MethodDelete, ""))
+	assert.Equal(suite.T(), http.StatusNoContent, w.Result().StatusCode)
+	assert.Equal(suite.T(), suite.defaults, suite.read())
+}
+
+func (suite *LimitsControllerTestSuite) TestUpdateInvalid() {
+	for _, body := range []string{
+		``,
+		`{"requestsPerSecond":0,"burst":5}`,
+		`{"requestsPerSecond":1,"burst":0}`,
+		`{"requestsPerSecond":1,"burst":1,"dailyJobs":-1}`,
+	} {
+		w := httptest.NewRecorder()
+		suite.lc.Update(w, suite.request(http.MethodPut, body))
+
+		res := w.Result()
+		resp, _ := ioutil.ReadAll(res.Body)
+		assert.Equal(suite.T(), http.StatusBadRequest, res.StatusCode, body)
+		assert.Contains(suite.T(), string(resp), "OperationOutcome", body)
+	}
+	assert.Equal(suite.T(), suite.defaults, suite.read())
+}
@@ -85,6 +85,15 @@ func (suite *MetadataControllerTestSuite) TestMetadata() {
                   "definition": "http://hl7.org/fhir/uv/bulkdata/OperationDefinition/group-export"
                 }
               ]
+            },
+            {
+              "type": "Patient",
+              "operation": [
+                {
+                  "name": "export",
+                  "definition": "http://hl7.org/fhir/uv/bulkdata/OperationDefinition/patient-export"
+                }
+              ]
             }
           ]
         }
@@ -45,11 +45,86 @@ func (ac *MockAttributionClient) GetImplOrg(ctx context.Context) ([]byte, error)
 	return args.Get(0).([]byte), args.Error(1)
 }
 
+func (ac *MockAttributionClient) GetPriorityTier(ctx context.Context, orgID string) ([]byte, error) {
+	args := ac.Called(ctx, orgID)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (ac *MockAttributionClient) UpdatePriorityTier(ctx context.Context, orgID string, body []byte) ([]byte, error) {
+	args := ac.Called(ctx, orgID, body)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (ac *MockAttributionClient) GetRetention(ctx context.Context, orgID string) ([]byte, error) {
+	args := ac.Called(ctx, orgID)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (ac *MockAttributionClient) UpdateRetention(ctx context.Context, orgID string, body []byte) ([]byte, error) {
+	args := ac.Called(ctx, orgID, body)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (ac *MockAttributionClient) DeleteRetention(ctx context.Context, orgID string) error {
+	args := ac.Called(ctx, orgID)
+	return args.Error(0)
+}
+
+func (ac *MockAttributionClient) GetWebhook(ctx context.Context) ([]byte, error) {
+	args := ac.Called(ctx)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (ac *MockAttributionClient) UpdateWebhook(ctx context.Context, body []byte) ([]byte, error) {
+	args := ac.Called(ctx, body)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (ac *MockAttributionClient) DeleteWebhook(ctx context.Context) error {
+	args := ac.Called(ctx)
+	return args.Error(0)
+}
+
+func (ac *MockAttributionClient) GetWebhookDeliveries(ctx context.Context) ([]byte, error) {
+	args := ac.Called(ctx)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (ac *MockAttributionClient) GetExportSchedules(ctx context.Context) ([]byte, error) {
+	args := ac.Called(ctx)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (ac *MockAttributionClient) GetExportSchedule(ctx context.Context, id string) ([]byte, error) {
+	args := ac.Called(ctx, id)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (ac *MockAttributionClient) CreateExportSchedule(ctx context.Context, body []byte) ([]byte, error) {
+	args := ac.Called(ctx, body)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (ac *MockAttributionClient) UpdateExportSchedule(ctx context.Context, id string, body []byte) ([]byte, error) {
+	args := ac.Called(ctx, id, body)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (ac *MockAttributionClient) DeleteExportSchedule(ctx context.Context, id string) error {
+	args := ac.Called(ctx, id)
+	return args.Error(0)
+}
+
 func (ac *MockAttributionClient) Get(ctx context.Context, resourceType client.ResourceType, id string) ([]byte, error) {
 	args := ac.Called(ctx, resourceType, id)
 	return args.Get(0).([]byte), args.Error(1)
 }
 
+func (ac *MockAttributionClient) List(ctx context.Context, resourceType client.ResourceType) ([]byte, error) {
+	args := ac.Called(ctx, resourceType)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
 func (ac *MockAttributionClient) Post(ctx context.Context, resourceType client.ResourceType, body []byte) ([]byte, error) {
 	args := ac.Called(ctx, resourceType, body)
 	return args.Get(0).([]byte), args.Error(1)
@@ -110,9 +185,9 @@ func (mc *MockSsasClient) DeletePublicKey(ctx context.Context, systemID string,
 	return args.Error(0)
 }
 
-func (mc *MockSsasClient) GetOrgIDFromToken(ctx context.Context, token string) (string, error) {
+func (mc *MockSsasClient) GetTokenInfo(ctx context.Context, token string) (client.TokenInfo, error) {
 	args := mc.Called(ctx, token)
-	return args.Get(0).(string), args.Error(1)
+	return args.Get(0).(client.TokenInfo), args.Error(1)
 }
 
 func (mc *MockSsasClient) ValidateToken(ctx context.Context, request []byte) ([]byte, error) {
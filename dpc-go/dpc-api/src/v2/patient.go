@@ -4,48 +4,127 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
-	"fmt"
 	"github.com/CMSgov/dpc/api/client"
 	"github.com/CMSgov/dpc/api/conf"
 	"github.com/CMSgov/dpc/api/constants"
 	"github.com/CMSgov/dpc/api/fhirror"
 	"github.com/CMSgov/dpc/api/logger"
 	"github.com/CMSgov/dpc/api/model"
+	"github.com/CMSgov/dpc/api/storage"
 	"github.com/pkg/errors"
 	"github.com/samply/golang-fhir-models/fhir-models/fhir"
 	"go.uber.org/zap"
 	"net/http"
-	"os"
 	"time"
 )
 
 // PatientController is a struct that defines what the controller has
 type PatientController struct {
-	jc client.JobClient
+	ac    client.Client
+	jc    client.JobClient
+	store storage.Store
 }
 
-// NewPatientController function that creates a organization controller and returns it's reference
-func NewPatientController(jc client.JobClient) *PatientController {
+// NewPatientController function that creates a patient controller and returns it's reference
+func NewPatientController(ac client.Client, jc client.JobClient, store storage.Store) *PatientController {
 	return &PatientController{
+		ac,
 		jc,
+		store,
 	}
 }
 
-// Export is the patient everything function that uses v1 job to synchronously get data
+// Export function that starts a job to export data for every patient attributed to the organization across all of its groups
 func (pc *PatientController) Export(w http.ResponseWriter, r *http.Request) {
 	log := logger.WithContext(r.Context())
+
+	b, err := pc.ac.List(r.Context(), client.Group)
+	if err != nil {
+		log.Error("Failed to get the groups for the organization", zap.Error(err))
+		fhirror.GenericServerIssue(r.Context(), w)
+		return
+	}
+
+	var groups []model.GroupContainer
+	if err := json.Unmarshal(b, &groups); err != nil {
+		log.Error("Failed to convert groups to struct", zap.Error(err))
+		fhirror.GenericServerIssue(r.Context(), w)
+		return
+	}
+
+	attr, err := orgAttributions(groups)
+	if err != nil {
+		log.Error("Failed to get attribution info", zap.Error(err))
+		fhirror.GenericServerIssue(r.Context(), w)
+		return
+	}
+
+	if len(attr) == 0 {
+		log.Warn("No patients are attributed to the organization")
+		fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, "No patients are attributed to the organization")
+		return
+	}
+
+	request := CreateExportRequest(r, "", attr)
+	request.IdempotencyKey = r.Header.Get(constants.IdempotencyKeyHeader)
+	if !validIdempotencyKey(w, r, request.IdempotencyKey) || !webhookRegistered(w, r, pc.ac, request.WebhookURL) {
+		return
+	}
+	jobResponse, _, err := pc.jc.Export(r.Context(), request)
+	if err != nil {
+		log.Error("Failed to start export", zap.Error(err))
+		if !quotaExceeded(w, r, err) && !idempotencyKeyReused(w, r, err) {
+			fhirror.GenericServerIssue(r.Context(), w)
+		}
+		return
+	}
+	w.Header().Set("Content-Location", contentLocationHeader(string(jobResponse)))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// orgAttributions collects the attribution relationships from every group, keeping only the first one found for each MBI
+func orgAttributions(groups []model.GroupContainer) ([]model.Attribution, error) {
+	seen := make(map[string]bool)
+	attr := make([]model.Attribution, 0)
+	for _, g := range groups {
+		ga, err := g.Info.GetAttributionInfo()
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range ga {
+			if seen[a.PatientMBI] {
+				continue
+			}
+			seen[a.PatientMBI] = true
+			attr = append(attr, a)
+		}
+	}
+	return attr, nil
+}
+
+// Everything is the patient everything function that uses v1 job to synchronously get data
+func (pc *PatientController) Everything(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
 	mbi, _ := r.Context().Value(constants.ContextKeyMBI).(string)
 
 	jobID, err := pc.startExport(r, mbi)
 	if err != nil {
 		log.Error("Failed to start export", zap.Error(err))
-		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "failed to retrieve patient data")
+		if !quotaExceeded(w, r, err) {
+			fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "failed to retrieve patient data")
+		}
 		return
 	}
 
 	batches, err := pc.waitForJobBatches(r.Context(), jobID)
+	if errors.Is(err, errJobUnfinished) && respondAsync(r) {
+		log.Info("Job did not finish in time, responding with the bulk data job", zap.String("jobID", jobID))
+		w.Header().Set("Content-Location", contentLocationHeader(jobID))
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
 	if err != nil {
-		log.Error("Timed out waiting for job batches to finish", zap.Error(err))
+		log.Error("Failed waiting for job batches to finish", zap.Error(err))
 		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "failed to retrieve patient data")
 		return
 	}
@@ -58,9 +137,9 @@ func (pc *PatientController) Export(w http.ResponseWriter, r *http.Request) {
 	var resp []byte
 	var assembleErr error
 	if len(bf) == 1 && bf[0].ResourceType == "OperationOutcome" {
-		resp, assembleErr = assembleOperationOutcome(bf)
+		resp, assembleErr = assembleOperationOutcome(r.Context(), pc.store, bf)
 	} else {
-		resp, assembleErr = assembleBundle(bf)
+		resp, assembleErr = assembleBundle(r.Context(), pc.store, bf)
 	}
 
 	if assembleErr != nil {
@@ -75,12 +154,10 @@ func (pc *PatientController) Export(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func assembleOperationOutcome(files []model.BatchFile) ([]byte, error) {
-	exportPath := conf.GetAsString("exportPath")
-
+func assembleOperationOutcome(ctx context.Context, store storage.Store, files []model.BatchFile) ([]byte, error) {
 	oo := fhir.OperationOutcome{}
 	for _, f := range files {
-		file, err := os.Open(fmt.Sprintf("%s/%s.ndjson", exportPath, f.FileName))
+		file, err := openStoredFile(ctx, store, f.FileName, f.Compressed())
 		if err != nil {
 			return nil, err
 		}
@@ -102,11 +179,10 @@ func assembleOperationOutcome(files []model.BatchFile) ([]byte, error) {
 	return oo.MarshalJSON()
 }
 
-func assembleBundle(files []model.BatchFile) ([]byte, error) {
-	exportPath := conf.GetAsString("exportPath")
+func assembleBundle(ctx context.Context, store storage.Store, files []model.BatchFile) ([]byte, error) {
 	entries := make([]fhir.BundleEntry, 0)
 	for _, f := range files {
-		file, err := os.Open(fmt.Sprintf("%s/%s.ndjson", exportPath, f.FileName))
+		file, err := openStoredFile(ctx, store, f.FileName, f.Compressed())
 		if err != nil {
 			return nil, err
 		}
@@ -133,42 +209,44 @@ func assembleBundle(files []model.BatchFile) ([]byte, error) {
 	}.MarshalJSON()
 }
 
-func (pc *PatientController) waitForJobBatches(ctx context.Context, jobID string) ([]model.BatchAndFiles, error) {
-	jobWait := conf.GetAsInt("jobTimeoutInSeconds", 30)
-	timeout := time.After(time.Duration(jobWait) * time.Second)
-	for {
-		select {
-		case <-timeout:
-			return nil, errors.New("timed out")
-		default:
-			bf := pc.getJobBatches(ctx, jobID)
-			if bf != nil {
-				return bf, nil
-			}
-			time.Sleep(250 * time.Millisecond)
-		}
+// errJobUnfinished is returned when the job did not finish within the job wait
+var errJobUnfinished = errors.New("job did not finish in time")
+
+// jobWait returns how long Patient/$everything waits for its job: jobTimeoutInSeconds, but at most three quarters of
+// the server write timeout so the response after the wait is written before the connection's write deadline
+func jobWait() time.Duration {
+	wait := time.Duration(conf.GetAsInt("jobTimeoutInSeconds", 15)) * time.Second
+	if limit := conf.ServerWriteTimeout() * 3 / 4; wait > limit {
+		return limit
 	}
+	return wait
 }
 
-func (pc *PatientController) getJobBatches(ctx context.Context, jobID string) []model.BatchAndFiles {
-	log := logger.WithContext(ctx)
-	b, err := pc.jc.Status(ctx, jobID)
+// waitForJobBatches returns the batches of the job once it has finished. The job service holds the status request
+// for up to the job wait until it has, so the job is not polled.
+func (pc *PatientController) waitForJobBatches(ctx context.Context, jobID string) ([]model.BatchAndFiles, error) {
+	b, err := pc.jc.WaitForStatus(ctx, jobID, jobWait())
 	if err != nil {
-		log.Warn("failed to get status")
-		return nil
+		return nil, errors.Wrap(err, "failed to get status")
 	}
 
 	var batches []model.BatchAndFiles
 	if err := json.Unmarshal(b, &batches); err != nil {
-		log.Warn("failed to unmarshal to batches")
-		return nil
+		return nil, errors.Wrap(err, "failed to unmarshal to batches")
 	}
 
+	// a failed batch does not end the job while others still run, only a cancel does
 	statuses := GetStatus(batches)
-	if (len(statuses) == 1 && statuses["COMPLETED"]) || statuses["FAILED"] {
-		return batches
+	if statuses["CANCELLED"] || !(statuses["QUEUED"] || statuses["RUNNING"]) {
+		return batches, nil
 	}
-	return nil
+	return nil, errJobUnfinished
+}
+
+// respondAsync reports whether the client would rather get a bulk data job than an error when the job takes too long
+func respondAsync(r *http.Request) bool {
+	async, _ := r.Context().Value(constants.ContextKeyRespondAsync).(bool)
+	return async
 }
 
 func (pc *PatientController) startExport(r *http.Request, mbi string) (string, error) {
@@ -177,7 +255,7 @@ func (pc *PatientController) startExport(r *http.Request, mbi string) (string, e
 			PatientMBI: mbi,
 		},
 	})
-	jobID, err := pc.jc.Export(r.Context(), exportRequest)
+	jobID, _, err := pc.jc.Export(r.Context(), exportRequest)
 	if err != nil {
 		return "", err
 	}
@@ -2,16 +2,24 @@ package v2
 
 import (
 	"context"
+	"fmt"
+	"github.com/CMSgov/dpc/api/apitest"
+	"github.com/CMSgov/dpc/api/client"
 	"github.com/CMSgov/dpc/api/conf"
 	"github.com/CMSgov/dpc/api/constants"
+	"github.com/CMSgov/dpc/api/model"
+	"github.com/CMSgov/dpc/api/storage"
 	"github.com/bxcodec/faker/v3"
+	"github.com/pkg/errors"
 	"github.com/samply/golang-fhir-models/fhir-models/fhir"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
 	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -19,6 +27,7 @@ import (
 type PatientControllerTestSuite struct {
 	suite.Suite
 	pc  *PatientController
+	mac *MockAttributionClient
 	mjc *MockJobClient
 }
 
@@ -26,18 +35,97 @@ func (suite *PatientControllerTestSuite) SetupTest() {
 	os.Setenv("DPC_EXPORTPATH", "../../test-data")
 	os.Setenv("DPC_JOBTIMEOUTINSECONDS", "1")
 	conf.NewConfig("../../configs")
-	mjc := new(MockJobClient)
-	suite.mjc = mjc
-	suite.pc = NewPatientController(suite.mjc)
+	suite.mac = new(MockAttributionClient)
+	suite.mjc = new(MockJobClient)
+	suite.pc = NewPatientController(suite.mac, suite.mjc, storage.NewLocalStore(conf.GetAsString("exportPath")))
 }
 
 func TestPatientControllerTestSuite(t *testing.T) {
 	suite.Run(t, new(PatientControllerTestSuite))
 }
 
+func (suite *PatientControllerTestSuite) TestPatientExport() {
+	first := apitest.AttributionToFHIRResponse(apitest.FilteredGroupjson)
+	second := apitest.AttributionToFHIRResponse(strings.Replace(apitest.FilteredGroupjson, `"member": [`, `"member": [
+    {
+      "extension": [
+        {
+          "url": "http://hl7.org/fhir/us/davinci-atr/StructureDefinition/ext-attributedProvider",
+          "valueReference": {
+            "type": "Practitioner",
+            "identifier": {"system": "http://hl7.org/fhir/sid/us-npi", "value": "1234567893"}
+          }
+        }
+      ],
+      "entity": {
+        "type": "Patient",
+        "identifier": {"value": "3SW4N00AA00", "system": "http://hl7.org/fhir/sid/us-mbi"}
+      }
+    },`, 1))
+	groups := []byte(fmt.Sprintf("[%s,%s]", first, second))
+
+	suite.mac.On("List", mock.Anything, client.Group).Return(groups, nil)
+	suite.mjc.On("Export", mock.Anything, mock.MatchedBy(func(er model.ExportRequest) bool {
+		return assert.ElementsMatch(suite.T(), []string{"2SW4N00AA00", "3SW4N00AA00"}, er.MBIs) &&
+			er.GroupID == "" &&
+			er.Since == "2021-01-01T00:00:00.000-00:00" &&
+			er.Type == "Patient,Coverage"
+	})).Return([]byte("test-export-job"), false, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/Patient/$export?_outputFormat=ndjson", nil)
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, constants.ContextKeyOrganization, "12345")
+	ctx = context.WithValue(ctx, constants.ContextKeyRequestURL, faker.URL())
+	ctx = context.WithValue(ctx, constants.ContextKeyRequestingIP, faker.IPv4())
+	ctx = context.WithValue(ctx, constants.ContextKeyResourceTypes, "Patient,Coverage")
+	ctx = context.WithValue(ctx, constants.ContextKeySince, "2021-01-01T00:00:00.000-00:00")
+	req = req.WithContext(ctx)
+	req.Header.Set("Prefer", "respond-async")
+
+	w := httptest.NewRecorder()
+	suite.pc.Export(w, req)
+	res := w.Result()
+
+	assert.Equal(suite.T(), http.StatusAccepted, res.StatusCode)
+	assert.Equal(suite.T(), "localhost:3000/api/v2/Jobs/test-export-job", res.Header.Get("Content-Location"))
+	suite.mjc.AssertExpectations(suite.T())
+}
+
+func (suite *PatientControllerTestSuite) TestPatientExportNoAttributedPatients() {
+	suite.mac.On("List", mock.Anything, client.Group).Return([]byte("[]"), nil)
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/Patient/$export", nil)
+	ctx := context.WithValue(req.Context(), constants.ContextKeyOrganization, "12345")
+	req = req.WithContext(ctx)
+	req.Header.Set("Prefer", "respond-async")
+
+	w := httptest.NewRecorder()
+	suite.pc.Export(w, req)
+	res := w.Result()
+
+	assert.Equal(suite.T(), http.StatusBadRequest, res.StatusCode)
+	suite.mjc.AssertNotCalled(suite.T(), "Export", mock.Anything, mock.Anything)
+}
+
+func (suite *PatientControllerTestSuite) TestPatientExportAttributionError() {
+	suite.mac.On("List", mock.Anything, client.Group).Return([]byte(nil), errors.New("error"))
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/Patient/$export", nil)
+	ctx := context.WithValue(req.Context(), constants.ContextKeyOrganization, "12345")
+	req = req.WithContext(ctx)
+	req.Header.Set("Prefer", "respond-async")
+
+	w := httptest.NewRecorder()
+	suite.pc.Export(w, req)
+	res := w.Result()
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, res.StatusCode)
+	suite.mjc.AssertNotCalled(suite.T(), "Export", mock.Anything, mock.Anything)
+}
+
 func (suite *PatientControllerTestSuite) TestPatientEverything() {
-	suite.mjc.On("Export", mock.Anything, mock.Anything).Return([]byte("job-id"), nil)
-	suite.mjc.On("Status", mock.Anything, mock.Anything).Return([]byte("[{\"batch\":{\"totalPatients\":11,\"patientsProcessed\":1,\"patientIndex\":-1,\"status\":\"COMPLETED\",\"transactionTime\":\"2021-06-07T20:55:08.681-05:00\",\"submitTime\":\"2021-08-16T14:49:00.735672-05:00\",\"completeTime\":\"2021-08-16T14:49:05.042966-05:00\",\"requestURL\":\"http://localhost:3000/api/v2/Patient/$everything\"},\"files\":[{\"resourceType\":\"Coverage\",\"batchID\":\"8cbc3c80-41ea-459c-ba93-c4a3c2f31485\",\"sequence\":0,\"fileName\":\"8cbc3c80-41ea-459c-ba93-c4a3c2f31485-0.coverage\",\"count\":4,\"checksum\":\"1aab1274b1a277ac178d45c7c0fa62bdc5056a79ebf4101147f75c890c05f6d4\",\"fileLength\":38367},{\"resourceType\":\"ExplanationOfBenefit\",\"batchID\":\"8cbc3c80-41ea-459c-ba93-c4a3c2f31485\",\"sequence\":0,\"fileName\":\"8cbc3c80-41ea-459c-ba93-c4a3c2f31485-0.explanationofbenefit\",\"count\":43,\"checksum\":\"93b0218fa1c614e286cf1e99b651d4bf4f4cdadc6269e3a6b1b32f4fd59ba1d9\",\"fileLength\":1216313},{\"resourceType\":\"Patient\",\"batchID\":\"8cbc3c80-41ea-459c-ba93-c4a3c2f31485\",\"sequence\":0,\"fileName\":\"8cbc3c80-41ea-459c-ba93-c4a3c2f31485-0.patient\",\"count\":1,\"checksum\":\"eae9ba4bac4b90a38630360d5055945f0c128fef7464bd1a5120ca358aff6d4f\",\"fileLength\":3480}]}]"), nil)
+	suite.mjc.On("Export", mock.Anything, mock.Anything).Return([]byte("job-id"), false, nil)
+	suite.mjc.On("WaitForStatus", mock.Anything, "job-id", time.Second).Return([]byte("[{\"batch\":{\"totalPatients\":11,\"patientsProcessed\":1,\"patientIndex\":-1,\"status\":\"COMPLETED\",\"transactionTime\":\"2021-06-07T20:55:08.681-05:00\",\"submitTime\":\"2021-08-16T14:49:00.735672-05:00\",\"completeTime\":\"2021-08-16T14:49:05.042966-05:00\",\"requestURL\":\"http://localhost:3000/api/v2/Patient/$everything\"},\"files\":[{\"resourceType\":\"Coverage\",\"batchID\":\"8cbc3c80-41ea-459c-ba93-c4a3c2f31485\",\"sequence\":0,\"fileName\":\"8cbc3c80-41ea-459c-ba93-c4a3c2f31485-0.coverage\",\"count\":4,\"checksum\":\"1aab1274b1a277ac178d45c7c0fa62bdc5056a79ebf4101147f75c890c05f6d4\",\"fileLength\":38367},{\"resourceType\":\"ExplanationOfBenefit\",\"batchID\":\"8cbc3c80-41ea-459c-ba93-c4a3c2f31485\",\"sequence\":0,\"fileName\":\"8cbc3c80-41ea-459c-ba93-c4a3c2f31485-0.explanationofbenefit\",\"count\":43,\"checksum\":\"93b0218fa1c614e286cf1e99b651d4bf4f4cdadc6269e3a6b1b32f4fd59ba1d9\",\"fileLength\":1216313},{\"resourceType\":\"Patient\",\"batchID\":\"8cbc3c80-41ea-459c-ba93-c4a3c2f31485\",\"sequence\":0,\"fileName\":\"8cbc3c80-41ea-459c-ba93-c4a3c2f31485-0.patient\",\"count\":1,\"checksum\":\"eae9ba4bac4b90a38630360d5055945f0c128fef7464bd1a5120ca358aff6d4f\",\"fileLength\":3480}]}]"), nil)
 
 	req := httptest.NewRequest("Post", "http://localhost/doesnotmatter", nil)
 	ctx := req.Context()
@@ -48,7 +136,7 @@ func (suite *PatientControllerTestSuite) TestPatientEverything() {
 	ctx = context.WithValue(ctx, constants.ContextKeyMBI, "mbi")
 	req = req.WithContext(ctx)
 	w := httptest.NewRecorder()
-	suite.pc.Export(w, req)
+	suite.pc.Everything(w, req)
 	res := w.Result()
 
 	b, _ := ioutil.ReadAll(res.Body)
@@ -57,23 +145,99 @@ func (suite *PatientControllerTestSuite) TestPatientEverything() {
 	assert.Equal(suite.T(), fhir.BundleTypeSearchset, bundle.Type)
 }
 
-func (suite *PatientControllerTestSuite) TestPatientEverythingTimedOut() {
-	suite.mjc.On("Export", mock.Anything, mock.Anything).Return([]byte("job-id"), nil)
-	suite.mjc.On("Status", mock.Anything, mock.Anything).Return([]byte("hello"), nil).WaitUntil(time.After(time.Second * 3))
-
-	req := httptest.NewRequest("Post", "http://localhost/doesnotmatter", nil)
+func (suite *PatientControllerTestSuite) everythingRequest(prefer string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/doesnotmatter", nil)
 	ctx := req.Context()
 	ctx = context.WithValue(ctx, constants.ContextKeyOrganization, "12345")
 	ctx = context.WithValue(ctx, constants.ContextKeyRequestURL, faker.URL())
 	ctx = context.WithValue(ctx, constants.ContextKeyRequestingIP, faker.IPv4())
 	ctx = context.WithValue(ctx, constants.ContextKeyResourceTypes, constants.AllResources)
 	ctx = context.WithValue(ctx, constants.ContextKeyMBI, "mbi")
-	req = req.WithContext(ctx)
+	ctx = context.WithValue(ctx, constants.ContextKeyRespondAsync, prefer == "respond-async")
+	return req.WithContext(ctx)
+}
+
+const runningJobStatus = `[{"batch":{"totalPatients":1,"patientsProcessed":0,"patientIndex":-1,"status":"RUNNING"},"files":[]}]`
+
+func (suite *PatientControllerTestSuite) TestPatientEverythingTimedOut() {
+	suite.mjc.On("Export", mock.Anything, mock.Anything).Return([]byte("job-id"), false, nil)
+	suite.mjc.On("WaitForStatus", mock.Anything, "job-id", time.Second).Return([]byte(runningJobStatus), nil)
+
 	w := httptest.NewRecorder()
-	suite.pc.Export(w, req)
+	suite.pc.Everything(w, suite.everythingRequest(""))
 	res := w.Result()
 
 	b, _ := ioutil.ReadAll(res.Body)
 	oo, _ := fhir.UnmarshalOperationOutcome(b)
+	assert.Equal(suite.T(), http.StatusInternalServerError, res.StatusCode)
 	assert.NotNil(suite.T(), oo)
+	suite.mjc.AssertNotCalled(suite.T(), "Status", mock.Anything, mock.Anything)
+}
+
+func (suite *PatientControllerTestSuite) TestPatientEverythingRespondAsync() {
+	suite.mjc.On("Export", mock.Anything, mock.Anything).Return([]byte("job-id"), false, nil)
+	suite.mjc.On("WaitForStatus", mock.Anything, "job-id", time.Second).Return([]byte(runningJobStatus), nil)
+
+	w := httptest.NewRecorder()
+	suite.pc.Everything(w, suite.everythingRequest("respond-async"))
+	res := w.Result()
+
+	assert.Equal(suite.T(), http.StatusAccepted, res.StatusCode)
+	assert.Equal(suite.T(), contentLocationHeader("job-id"), res.Header.Get("Content-Location"))
+}
+
+func (suite *PatientControllerTestSuite) TestPatientEverythingRespondAsyncBeforeWriteTimeout() {
+	os.Setenv("DPC_JOBTIMEOUTINSECONDS", "30")
+	os.Setenv("DPC_SERVER_WRITE_TIMEOUT_SECONDS", "2")
+	defer os.Setenv("DPC_JOBTIMEOUTINSECONDS", "1")
+	defer os.Unsetenv("DPC_SERVER_WRITE_TIMEOUT_SECONDS")
+
+	suite.mjc.On("Export", mock.Anything, mock.Anything).Return([]byte("job-id"), false, nil)
+	suite.mjc.On("WaitForStatus", mock.Anything, "job-id", 1500*time.Millisecond).Run(func(arg mock.Arguments) {
+		time.Sleep(arg.Get(2).(time.Duration))
+	}).Return([]byte(runningJobStatus), nil)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		suite.pc.Everything(w, r.WithContext(suite.everythingRequest("respond-async").Context()))
+	}))
+	ts.Config.WriteTimeout = conf.ServerWriteTimeout()
+	ts.Start()
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusAccepted, res.StatusCode)
+	assert.Equal(suite.T(), contentLocationHeader("job-id"), res.Header.Get("Content-Location"))
+}
+
+func (suite *PatientControllerTestSuite) TestJobWaitBelowWriteTimeout() {
+	os.Unsetenv("DPC_JOBTIMEOUTINSECONDS")
+	defer os.Setenv("DPC_JOBTIMEOUTINSECONDS", "1")
+
+	assert.Equal(suite.T(), 15*time.Second, jobWait())
+	assert.Less(suite.T(), int64(jobWait()), int64(conf.ServerWriteTimeout()))
+}
+
+func (suite *PatientControllerTestSuite) TestPatientEverythingFailedBatchWhileOthersRun() {
+	suite.mjc.On("Export", mock.Anything, mock.Anything).Return([]byte("job-id"), false, nil)
+	suite.mjc.On("WaitForStatus", mock.Anything, "job-id", time.Second).Return([]byte(`[`+
+		`{"batch":{"totalPatients":1,"patientsProcessed":0,"patientIndex":-1,"status":"FAILED"},"files":[]},`+
+		`{"batch":{"totalPatients":1,"patientsProcessed":0,"patientIndex":-1,"status":"RUNNING"},"files":[]}]`), nil)
+
+	w := httptest.NewRecorder()
+	suite.pc.Everything(w, suite.everythingRequest("respond-async"))
+
+	assert.Equal(suite.T(), http.StatusAccepted, w.Result().StatusCode)
+	assert.Equal(suite.T(), contentLocationHeader("job-id"), w.Result().Header.Get("Content-Location"))
+}
+
+func (suite *PatientControllerTestSuite) TestPatientEverythingStatusError() {
+	suite.mjc.On("Export", mock.Anything, mock.Anything).Return([]byte("job-id"), false, nil)
+	suite.mjc.On("WaitForStatus", mock.Anything, "job-id", time.Second).Return([]byte(nil), errors.New("error"))
+
+	w := httptest.NewRecorder()
+	suite.pc.Everything(w, suite.everythingRequest("respond-async"))
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Result().StatusCode)
 }
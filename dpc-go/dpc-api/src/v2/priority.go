@@ -0,0 +1,97 @@
+package v2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/CMSgov/dpc/api/client"
+	"github.com/CMSgov/dpc/api/constants"
+	"github.com/CMSgov/dpc/api/fhirror"
+	"github.com/CMSgov/dpc/api/logger"
+	"go.uber.org/zap"
+)
+
+// PriorityController is an interface for admins to manage the priority tier of an organization's exports
+type PriorityController interface {
+	ReadController
+	UpdateController
+}
+
+var priorityTiers = map[string]bool{"high": true, "standard": true, "low": true}
+
+// priorityTier is the priority tier and concurrency cap of an organization's exports, a cap of 0 means no cap
+type priorityTier struct {
+	Tier                 string `json:"tier"`
+	MaxConcurrentBatches *int   `json:"maxConcurrentBatches"`
+}
+
+// OrganizationPriorityController is a struct that defines what the controller has
+type OrganizationPriorityController struct {
+	ac client.Client
+}
+
+// NewPriorityController creates a priority controller and returns its reference
+func NewPriorityController(ac client.Client) *OrganizationPriorityController {
+	return &OrganizationPriorityController{
+		ac,
+	}
+}
+
+// Read function returns the priority tier of the organization from attribution
+func (pc *OrganizationPriorityController) Read(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	orgID, _ := r.Context().Value(constants.ContextKeyOrganization).(string)
+
+	resp, err := pc.ac.GetPriorityTier(r.Context(), orgID)
+	if err != nil {
+		log.Error("Failed to get the organization priority tier from attribution", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Failed to get organization priority tier")
+		return
+	}
+
+	if _, err := w.Write(resp); err != nil {
+		log.Error("Failed to write data to response", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+// Update function validates the priority tier and saves it for the organization in attribution
+func (pc *OrganizationPriorityController) Update(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	orgID, _ := r.Context().Value(constants.ContextKeyOrganization).(string)
+
+	var s priorityTier
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		log.Error("Failed to parse organization priority tier", zap.Error(err))
+		fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, "Body must have a tier and maxConcurrentBatches")
+		return
+	}
+	if !priorityTiers[s.Tier] {
+		fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, fmt.Sprintf("Invalid tier %q, must be one of high, standard or low", s.Tier))
+		return
+	}
+	if s.MaxConcurrentBatches == nil || *s.MaxConcurrentBatches < 0 {
+		fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, "maxConcurrentBatches must be 0 or more")
+		return
+	}
+
+	body := new(bytes.Buffer)
+	if err := json.NewEncoder(body).Encode(s); err != nil {
+		log.Error("Failed to convert organization priority tier to bytes", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	resp, err := pc.ac.UpdatePriorityTier(r.Context(), orgID, body.Bytes())
+	if err != nil {
+		log.Error("Failed to save the organization priority tier to attribution", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Failed to save organization priority tier")
+		return
+	}
+
+	if _, err := w.Write(resp); err != nil {
+		log.Error("Failed to write data to response", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Internal server error")
+	}
+}
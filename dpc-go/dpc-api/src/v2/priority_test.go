@@ -0,0 +1,90 @@
+package v2
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CMSgov/dpc/api/constants"
+	"github.com/go-chi/chi/middleware"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type PriorityControllerTestSuite struct {
+	suite.Suite
+	mac *MockAttributionClient
+	sc  PriorityController
+}
+
+func TestPriorityControllerTestSuite(t *testing.T) {
+	suite.Run(t, new(PriorityControllerTestSuite))
+}
+
+func (suite *PriorityControllerTestSuite) SetupTest() {
+	suite.mac = new(MockAttributionClient)
+	suite.sc = NewPriorityController(suite.mac)
+}
+
+func (suite *PriorityControllerTestSuite) request(method string, body string) *http.Request {
+	req := httptest.NewRequest(method, "http://example.com/Organization/12345/priority", strings.NewReader(body))
+	ctx := context.WithValue(req.Context(), middleware.RequestIDKey, "54321")
+	ctx = context.WithValue(ctx, constants.ContextKeyOrganization, "12345")
+	return req.WithContext(ctx)
+}
+
+func (suite *PriorityControllerTestSuite) TestRead() {
+	priority := `{"organizationID":"12345","tier":"low","maxConcurrentBatches":2}`
+	suite.mac.On("GetPriorityTier", mock.Anything, "12345").Return([]byte(priority), nil)
+
+	w := httptest.NewRecorder()
+	suite.sc.Read(w, suite.request(http.MethodGet, ""))
+
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	assert.Equal(suite.T(), priority, string(body))
+}
+
+func (suite *PriorityControllerTestSuite) TestReadError() {
+	suite.mac.On("GetPriorityTier", mock.Anything, "12345").Return([]byte(nil), errors.New("error"))
+
+	w := httptest.NewRecorder()
+	suite.sc.Read(w, suite.request(http.MethodGet, ""))
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Result().StatusCode)
+}
+
+func (suite *PriorityControllerTestSuite) TestUpdate() {
+	priority := `{"organizationID":"12345","tier":"high","maxConcurrentBatches":0}`
+	suite.mac.On("UpdatePriorityTier", mock.Anything, "12345", []byte("{\"tier\":\"high\",\"maxConcurrentBatches\":0}\n")).Return([]byte(priority), nil)
+
+	w := httptest.NewRecorder()
+	suite.sc.Update(w, suite.request(http.MethodPut, `{"tier":"high","maxConcurrentBatches":0}`))
+
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	assert.Equal(suite.T(), priority, string(body))
+}
+
+func (suite *PriorityControllerTestSuite) TestUpdateInvalid() {
+	for _, body := range []string{
+		``,
+		`{"tier":"urgent","maxConcurrentBatches":1}`,
+		`{"tier":"low"}`,
+		`{"tier":"low","maxConcurrentBatches":-1}`,
+	} {
+		w := httptest.NewRecorder()
+		suite.sc.Update(w, suite.request(http.MethodPut, body))
+
+		res := w.Result()
+		resp, _ := ioutil.ReadAll(res.Body)
+		assert.Equal(suite.T(), http.StatusBadRequest, res.StatusCode, body)
+		assert.Contains(suite.T(), string(resp), "OperationOutcome", body)
+	}
+	suite.mac.AssertNotCalled(suite.T(), "UpdatePriorityTier", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,103 @@
+package v2
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/CMSgov/dpc/api/client"
+	"github.com/CMSgov/dpc/api/constants"
+	"github.com/CMSgov/dpc/api/fhirror"
+	"github.com/CMSgov/dpc/api/logger"
+	"go.uber.org/zap"
+)
+
+// RetentionController is an interface for admins to manage how long the export files of an organization are kept
+type RetentionController interface {
+	ReadController
+	UpdateController
+	DeleteController
+}
+
+// retention is how many hours the export files of an organization are kept after its job finishes
+type retention struct {
+	Hours *int `json:"hours"`
+}
+
+// OrganizationRetentionController is a struct that defines what the controller has
+type OrganizationRetentionController struct {
+	ac client.Client
+}
+
+// NewRetentionController creates a retention controller and returns its reference
+func NewRetentionController(ac client.Client) *OrganizationRetentionController {
+	return &OrganizationRetentionController{
+		ac,
+	}
+}
+
+// Read function returns the retention of the organization from attribution, the default when none was set
+func (rc *OrganizationRetentionController) Read(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	orgID, _ := r.Context().Value(constants.ContextKeyOrganization).(string)
+
+	resp, err := rc.ac.GetRetention(r.Context(), orgID)
+	if err != nil {
+		log.Error("Failed to get the organization retention from attribution", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Failed to get organization retention")
+		return
+	}
+
+	if _, err := w.Write(resp); err != nil {
+		log.Error("Failed to write data to response", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+// Update function validates the retention and saves it for the organization in attribution
+func (rc *OrganizationRetentionController) Update(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	orgID, _ := r.Context().Value(constants.ContextKeyOrganization).(string)
+
+	var rt retention
+	if err := json.NewDecoder(r.Body).Decode(&rt); err != nil {
+		log.Error("Failed to parse organization retention", zap.Error(err))
+		fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, "Body must have hours")
+		return
+	}
+	if rt.Hours == nil || *rt.Hours < 1 {
+		fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, "hours must be 1 or more")
+		return
+	}
+
+	body := new(bytes.Buffer)
+	if err := json.NewEncoder(body).Encode(rt); err != nil {
+		log.Error("Failed to convert organization retention to bytes", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	resp, err := rc.ac.UpdateRetention(r.Context(), orgID, body.Bytes())
+	if err != nil {
+		log.Error("Failed to save the organization retention to attribution", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Failed to save organization retention")
+		return
+	}
+
+	if _, err := w.Write(resp); err != nil {
+		log.Error("Failed to write data to response", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+// Delete function resets the organization to the default retention in attribution
+func (rc *OrganizationRetentionController) Delete(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	orgID, _ := r.Context().Value(constants.ContextKeyOrganization).(string)
+
+	if err := rc.ac.DeleteRetention(r.Context(), orgID); err != nil {
+		log.Error("Failed to reset the organization retention in attribution", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Failed to reset organization retention")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
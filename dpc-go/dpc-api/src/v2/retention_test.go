@@ -0,0 +1,109 @@
+package v2
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CMSgov/dpc/api/constants"
+	"github.com/go-chi/chi/middleware"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type RetentionControllerTestSuite struct {
+	suite.Suite
+	mac *MockAttributionClient
+	rc  RetentionController
+}
+
+func TestRetentionControllerTestSuite(t *testing.T) {
+	suite.Run(t, new(RetentionControllerTestSuite))
+}
+
+func (suite *RetentionControllerTestSuite) SetupTest() {
+	suite.mac = new(MockAttributionClient)
+	suite.rc = NewRetentionController(suite.mac)
+}
+
+func (suite *RetentionControllerTestSuite) request(method string, body string) *http.Request {
+	req := httptest.NewRequest(method, "http://example.com/Organization/12345/retention", strings.NewReader(body))
+	ctx := context.WithValue(req.Context(), middleware.RequestIDKey, "54321")
+	ctx = context.WithValue(ctx, constants.ContextKeyOrganization, "12345")
+	return req.WithContext(ctx)
+}
+
+func (suite *RetentionControllerTestSuite) TestRead() {
+	retention := `{"organizationID":"12345","hours":24}`
+	suite.mac.On("GetRetention", mock.Anything, "12345").Return([]byte(retention), nil)
+
+	w := httptest.NewRecorder()
+	suite.rc.Read(w, suite.request(http.MethodGet, ""))
+
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	assert.Equal(suite.T(), retention, string(body))
+}
+
+func (suite *RetentionControllerTestSuite) TestReadError() {
+	suite.mac.On("GetRetention", mock.Anything, "12345").Return([]byte(nil), errors.New("error"))
+
+	w := httptest.NewRecorder()
+	suite.rc.Read(w, suite.request(http.MethodGet, ""))
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Result().StatusCode)
+}
+
+func (suite *RetentionControllerTestSuite) TestUpdate() {
+	retention := `{"organizationID":"12345","hours":168}`
+	suite.mac.On("UpdateRetention", mock.Anything, "12345", []byte("{\"hours\":168}\n")).Return([]byte(retention), nil)
+
+	w := httptest.NewRecorder()
+	suite.rc.Update(w, suite.request(http.MethodPut, `{"hours":168}`))
+
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	assert.Equal(suite.T(), retention, string(body))
+}
+
+func (suite *RetentionControllerTestSuite) TestUpdateInvalid() {
+	for _, body := range []string{
+		``,
+		`{}`,
+		`{"hours":0}`,
+		`{"hours":"a day"}`,
+	} {
+		w := httptest.NewRecorder()
+		suite.rc.Update(w, suite.request(http.MethodPut, body))
+
+		res := w.Result()
+		resp, _ := ioutil.ReadAll(res.Body)
+		assert.Equal(suite.T(), http.StatusBadRequest, res.StatusCode, body)
+		assert.Contains(suite.T(), string(resp), "OperationOutcome", body)
+	}
+	suite.mac.AssertNotCalled(suite.T(), "UpdateRetention", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *RetentionControllerTestSuite) TestDelete() {
+	suite.mac.On("DeleteRetention", mock.Anything, "12345").Return(nil)
+
+	w := httptest.NewRecorder()
+	suite.rc.Delete(w, suite.request(http.MethodDelete, ""))
+
+	assert.Equal(suite.T(), http.StatusNoContent, w.Result().StatusCode)
+	suite.mac.AssertExpectations(suite.T())
+}
+
+func (suite *RetentionControllerTestSuite) TestDeleteError() {
+	suite.mac.On("DeleteRetention", mock.Anything, "12345").Return(errors.New("error"))
+
+	w := httptest.NewRecorder()
+	suite.rc.Delete(w, suite.request(http.MethodDelete, ""))
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Result().StatusCode)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"github.com/CMSgov/dpc/api/auth"
 	"github.com/CMSgov/dpc/api/client"
 	"github.com/CMSgov/dpc/api/conf"
 	"github.com/CMSgov/dpc/api/constants"
@@ -14,18 +15,20 @@ import (
 	"go.uber.org/zap"
 	"io/ioutil"
 	"net/http"
+	"strings"
 )
 
 // SSASController is a struct that defines what the controller has
 type SSASController struct {
-	ssasClient client.SsasClient
-	attrClient client.Client
+	ssasClient   client.SsasClient
+	attrClient   client.Client
+	authProvider auth.Provider
 }
 
 // NewSSASController function that creates a ssas controller and returns it's reference
-func NewSSASController(ssasClient client.SsasClient, attrClient client.Client) *SSASController {
+func NewSSASController(ssasClient client.SsasClient, attrClient client.Client, authProvider auth.Provider) *SSASController {
 	return &SSASController{
-		ssasClient, attrClient,
+		ssasClient, attrClient, authProvider,
 	}
 }
 
@@ -178,6 +181,7 @@ func (sc *SSASController) GetSystem(w http.ResponseWriter, r *http.Request) {
 	proxyResp.ClientTokens = ssasResp.ClientTokens
 	proxyResp.PublicKeys = ssasResp.PublicKeys
 	proxyResp.IPs = ssasResp.IPs
+	proxyResp.Scopes = resourceScopes(ssasResp.APIScope)
 
 	respBytes, err := json.Marshal(proxyResp)
 	if err != nil {
@@ -280,6 +284,28 @@ func (sc *SSASController) AddKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	pub, err := auth.VerifyPublicKey(proxyReq.PublicKey, proxyReq.Signature)
+	if err != nil {
+		log.Error("Public key failed verification", zap.Error(err))
+		fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	system, err := sc.ssasClient.GetSystem(r.Context(), mOrg.SsasSystemID)
+	if err != nil {
+		log.Error("Failed to get system", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, 500, "Failed to add key")
+		return
+	}
+
+	for _, k := range system.PublicKeys {
+		if auth.SamePublicKey(pub, k["key"]) {
+			log.Error(fmt.Sprintf("Public key is already registered to system %s", mOrg.SsasSystemID))
+			fhirror.BusinessViolation(r.Context(), w, http.StatusConflict, "Public key is already registered for this system")
+			return
+		}
+	}
+
 	ssasResp, err := sc.ssasClient.AddPublicKey(r.Context(), mOrg.SsasSystemID, proxyReq)
 	if err != nil {
 		log.Error("Failed to add key", zap.Error(err))
@@ -345,6 +371,20 @@ func (sc *SSASController) CreateSystem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if _, err := auth.VerifyPublicKey(proxyReq.PublicKey, proxyReq.Signature); err != nil {
+		log.Error("Public key failed verification", zap.Error(err))
+		fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	for _, scope := range proxyReq.Scopes {
+		if _, err := auth.ParseScope(scope); err != nil {
+			log.Error("Invalid scope", zap.Error(err))
+			fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
 	ssasResp, err := sc.createSsasSystem(r, implementerID, organizationID, proxyReq)
 	if err != nil {
 		log.Error("Failed to create system", zap.Error(err))
@@ -371,6 +411,7 @@ func (sc *SSASController) CreateSystem(w http.ResponseWriter, r *http.Request) {
 	proxyResp.ExpiresAt = ssasResp.ExpiresAt
 	proxyResp.IPs = ssasResp.IPs
 	proxyResp.PublicKeyID = ssasResp.PublicKeyID
+	proxyResp.Scopes = resourceScopes(ssasResp.Scope)
 
 	respBytes, err := json.Marshal(proxyResp)
 	if err != nil {
@@ -399,7 +440,7 @@ func (sc *SSASController) GetAuthToken(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// TODO: May need to bring up error codes for more specific errors for troubleshooting
-	resBytes, err := sc.ssasClient.Authenticate(r.Context(), body)
+	resBytes, err := sc.authProvider.Authenticate(r.Context(), body)
 	if err != nil {
 		log.Error("Failed to authenticate", zap.Error(err))
 		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, fmt.Sprintf("Failed to authenticate token: %s", err))
@@ -407,8 +448,8 @@ func (sc *SSASController) GetAuthToken(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if len(resBytes) <= 0 {
-		log.Error("No token returned from SSAS")
-		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "No token returned from SSAS")
+		log.Error("No token returned from auth provider")
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "No token returned from auth provider")
 		return
 	}
 
@@ -429,8 +470,8 @@ func (sc *SSASController) ValidateToken(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Validate token with SSAS Client
-	resBytes, err := sc.ssasClient.ValidateToken(r.Context(), body)
+	// Validate token with the configured auth provider
+	resBytes, err := sc.authProvider.ValidateToken(r.Context(), body)
 	if err != nil {
 		log.Error("Failed to validate token", zap.Error(err))
 		fhirror.ServerIssue(r.Context(), w, http.StatusBadRequest, fmt.Sprintf("Failed to validate token: %s", err))
@@ -449,8 +490,9 @@ func (sc *SSASController) createSsasSystem(r *http.Request, implID string, orgID
 		return client.CreateSystemResponse{}, err
 	}
 
+	scope := strings.Join(append([]string{conf.GetAsString("apiScope", constants.APIScope)}, proxyReq.Scopes...), " ")
 	req := client.CreateSystemRequest{
-		Scope:      conf.GetAsString("apiScope", constants.APIScope),
+		Scope:      scope,
 		ClientName: proxyReq.ClientName,
 		GroupID:    groupID,
 		PublicKey:  proxyReq.PublicKey,
@@ -461,6 +503,17 @@ func (sc *SSASController) createSsasSystem(r *http.Request, implID string, orgID
 	return sc.ssasClient.CreateSystem(r.Context(), req)
 }
 
+// resourceScopes returns the resource scopes in a SSAS scope string, leaving out the API scope
+func resourceScopes(scope string) []string {
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if _, err := auth.ParseScope(s); err == nil {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
 func (sc *SSASController) getProviderOrg(r *http.Request, implID string, orgID string) (bool, client.ProviderOrg, error) {
 	orgs, err := sc.attrClient.GetProviderOrgs(r.Context(), implID)
 	if err != nil {
@@ -493,6 +546,8 @@ type ProxyCreateSystemRequest struct {
 	PublicKey  string   `json:"public_key"`
 	Signature  string   `json:"signature"`
 	IPs        []string `json:"ips"`
+	// Scopes restricts the system to the given system/<Resource>.<read|write|*> scopes. Empty grants full access.
+	Scopes []string `json:"scopes,omitempty"`
 }
 
 // ProxyCreateSystemResponse struct that models a proxy response to create a new system
@@ -503,6 +558,7 @@ type ProxyCreateSystemResponse struct {
 	ClientToken string   `json:"client_token"`
 	ExpiresAt   string   `json:"expires_at"`
 	PublicKeyID string   `json:"public_key_id"`
+	Scopes      []string `json:"scopes,omitempty"`
 }
 
 // ProxyGetSystemResponse struct that models a proxy response to get a system
@@ -512,6 +568,7 @@ type ProxyGetSystemResponse struct {
 	PublicKeys   []map[string]string `json:"public_keys"`
 	IPs          []map[string]string `json:"ips"`
 	ClientTokens []map[string]string `json:"client_tokens"`
+	Scopes       []string            `json:"scopes,omitempty"`
 }
 
 // TokenCreateRequest struct that models the creat request for a token
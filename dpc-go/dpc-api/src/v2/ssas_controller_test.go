@@ -2,6 +2,12 @@ package v2
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"github.com/CMSgov/dpc/api/apitest"
+	"github.com/CMSgov/dpc/api/auth"
 	"github.com/CMSgov/dpc/api/constants"
 	"io/ioutil"
 	"net/http"
@@ -28,7 +34,7 @@ func (suite *SsasControllerTestSuite) SetupTest() {
 	msc := new(MockSsasClient)
 	suite.mac = mac
 	suite.msc = msc
-	suite.sc = NewSSASController(suite.msc, suite.mac)
+	suite.sc = NewSSASController(suite.msc, suite.mac, auth.NewSSASProvider(suite.msc))
 
 }
 
@@ -108,6 +114,61 @@ func (suite *SsasControllerTestSuite) TestCreateSystemForInactiveRelation() {
 	assert.Contains(suite.T(), string(resp), "Implementer/Org relation is not active")
 }
 
+func (suite *SsasControllerTestSuite) TestCreateSystemInvalidKey() {
+	req, _ := suite.SetupHappyPathMocks()
+	req = withBody(req, keyRequestBody("not a key", "c2lnbmF0dXJl"))
+
+	w := httptest.NewRecorder()
+	suite.sc.CreateSystem(w, req)
+	res := w.Result()
+	resp, _ := ioutil.ReadAll(res.Body)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, res.StatusCode)
+	assert.Contains(suite.T(), string(resp), "Public key could not be parsed")
+	suite.msc.AssertNotCalled(suite.T(), "CreateSystem", mock.Anything, mock.Anything)
+}
+
+func (suite *SsasControllerTestSuite) TestCreateSystemWithScopes() {
+	req, _ := suite.SetupHappyPathMocks()
+	key := apitest.TestRSAKey()
+	b, _ := json.Marshal(map[string]interface{}{
+		"client_name": "Test Client",
+		"public_key":  apitest.PublicKeyPEM(key.Public()),
+		"signature":   apitest.SignSnippet(key),
+		"scopes":      []string{"system/Group.read", "system/Patient.read"},
+	})
+	req = withBody(req, string(b))
+
+	w := httptest.NewRecorder()
+	suite.sc.CreateSystem(w, req)
+
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	suite.msc.AssertCalled(suite.T(), "CreateSystem", mock.Anything, mock.MatchedBy(func(request client.CreateSystemRequest) bool {
+		return strings.HasSuffix(request.Scope, " system/Group.read system/Patient.read")
+	}))
+}
+
+func (suite *SsasControllerTestSuite) TestCreateSystemInvalidScope() {
+	req, _ := suite.SetupHappyPathMocks()
+	key := apitest.TestRSAKey()
+	b, _ := json.Marshal(map[string]interface{}{
+		"client_name": "Test Client",
+		"public_key":  apitest.PublicKeyPEM(key.Public()),
+		"signature":   apitest.SignSnippet(key),
+		"scopes":      []string{"patient/Group.read"},
+	})
+	req = withBody(req, string(b))
+
+	w := httptest.NewRecorder()
+	suite.sc.CreateSystem(w, req)
+	res := w.Result()
+	resp, _ := ioutil.ReadAll(res.Body)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, res.StatusCode)
+	assert.Contains(suite.T(), string(resp), "invalid scope")
+	suite.msc.AssertNotCalled(suite.T(), "CreateSystem", mock.Anything, mock.Anything)
+}
+
 func (suite *SsasControllerTestSuite) TestGetSystem() {
 
 	req, _ := suite.SetupHappyPathMocks()
@@ -291,6 +352,74 @@ func (suite *SsasControllerTestSuite) TestAddKey() {
     }`)
 }
 
+func (suite *SsasControllerTestSuite) TestAddKeyECP384() {
+	req, _ := suite.SetupHappyPathMocks()
+	suite.linkSystem()
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	req = withBody(req, keyRequestBody(apitest.PublicKeyPEM(ecKey.Public()), apitest.SignSnippet(ecKey)))
+
+	w := httptest.NewRecorder()
+	suite.sc.AddKey(w, req)
+	res := w.Result()
+
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+}
+
+func (suite *SsasControllerTestSuite) TestAddKeyInvalidSignature() {
+	req, _ := suite.SetupHappyPathMocks()
+	suite.linkSystem()
+
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	req = withBody(req, keyRequestBody(apitest.PublicKeyPEM(apitest.TestRSAKey().Public()), apitest.SignSnippet(otherKey)))
+
+	w := httptest.NewRecorder()
+	suite.sc.AddKey(w, req)
+	res := w.Result()
+	resp, _ := ioutil.ReadAll(res.Body)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, res.StatusCode)
+	assert.Contains(suite.T(), string(resp), "Signature does not match public key")
+	suite.msc.AssertNotCalled(suite.T(), "AddPublicKey", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *SsasControllerTestSuite) TestAddKeyUnsupportedCurve() {
+	req, _ := suite.SetupHappyPathMocks()
+	suite.linkSystem()
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	req = withBody(req, keyRequestBody(apitest.PublicKeyPEM(ecKey.Public()), apitest.SignSnippet(ecKey)))
+
+	w := httptest.NewRecorder()
+	suite.sc.AddKey(w, req)
+	res := w.Result()
+	resp, _ := ioutil.ReadAll(res.Body)
+
+	assert.Equal(suite.T(), http.StatusBadRequest, res.StatusCode)
+	assert.Contains(suite.T(), string(resp), "EC public key must use curve P-384, got P-256")
+	suite.msc.AssertNotCalled(suite.T(), "AddPublicKey", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *SsasControllerTestSuite) TestAddKeyDuplicate() {
+	req, _ := suite.SetupHappyPathMocks()
+	suite.linkSystem()
+
+	system := client.GetSystemResponse{
+		ClientID:   "c001",
+		PublicKeys: []map[string]string{{"key": apitest.PublicKeyPEM(apitest.TestRSAKey().Public()), "id": "public-key-1"}},
+	}
+	findExpectedCall(suite.msc.ExpectedCalls, "GetSystem").Return(system, nil)
+
+	w := httptest.NewRecorder()
+	suite.sc.AddKey(w, req)
+	res := w.Result()
+	resp, _ := ioutil.ReadAll(res.Body)
+
+	assert.Equal(suite.T(), http.StatusConflict, res.StatusCode)
+	assert.Contains(suite.T(), string(resp), "Public key is already registered for this system")
+	suite.msc.AssertNotCalled(suite.T(), "AddPublicKey", mock.Anything, mock.Anything, mock.Anything)
+}
+
 func (suite *SsasControllerTestSuite) TestAddKeySystemIDNotLinked() {
 	req, _ := suite.SetupHappyPathMocks()
 
@@ -338,12 +467,8 @@ func (suite *SsasControllerTestSuite) TestDeleteKeySystemIDNotLinked() {
 
 func (suite *SsasControllerTestSuite) SetupHappyPathMocks() (*http.Request, context.Context) {
 	//Setup request
-	reqBody := `{
-        "client_name" : "Test Client",
-        "public_key" : "public key",
-        "signature" : "signature",
-        "ips" : ["ip-1","ip-2"]
-    }`
+	key := apitest.TestRSAKey()
+	reqBody := keyRequestBody(apitest.PublicKeyPEM(key.Public()), apitest.SignSnippet(key))
 	req := httptest.NewRequest("Post", "http://localohost/v2/Implementer/123/Org/abc/Systemfoo", strings.NewReader(reqBody))
 	ctx := req.Context()
 	ctx = context.WithValue(ctx, constants.ContextKeyImplementer, "123")
@@ -419,6 +544,32 @@ func (suite *SsasControllerTestSuite) SetupHappyPathMocks() (*http.Request, cont
 	return req, ctx
 }
 
+func (suite *SsasControllerTestSuite) linkSystem() {
+	managedOrg := client.ProviderOrg{
+		OrgName:      "Test Org",
+		OrgID:        "abc",
+		Npi:          "npi-1",
+		Status:       "Active",
+		SsasSystemID: "system-id-1",
+	}
+	findExpectedCall(suite.mac.ExpectedCalls, "GetProviderOrgs").Return([]client.ProviderOrg{managedOrg}, nil)
+}
+
+func keyRequestBody(publicKey string, signature string) string {
+	b, _ := json.Marshal(map[string]interface{}{
+		"client_name": "Test Client",
+		"public_key":  publicKey,
+		"signature":   signature,
+		"ips":         []string{"ip-1", "ip-2"},
+	})
+	return string(b)
+}
+
+func withBody(req *http.Request, body string) *http.Request {
+	req.Body = ioutil.NopCloser(strings.NewReader(body))
+	return req
+}
+
 func findExpectedCall(calls []*mock.Call, methodName string) *mock.Call {
 	for _, c := range calls {
 		if c.Method == methodName {
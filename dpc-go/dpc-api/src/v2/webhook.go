@@ -0,0 +1,148 @@
+package v2
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/CMSgov/dpc/api/client"
+	"github.com/CMSgov/dpc/api/conf"
+	"github.com/CMSgov/dpc/api/fhirror"
+	"github.com/CMSgov/dpc/api/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// WebhookController is an interface for organizations to manage the webhook notified when their jobs finish
+type WebhookController interface {
+	ReadController
+	UpdateController
+	DeleteController
+	Deliveries(w http.ResponseWriter, r *http.Request)
+}
+
+// webhook is the callback URL an organization registers
+type webhook struct {
+	URL string `json:"url"`
+}
+
+// OrganizationWebhookController is a struct that defines what the controller has
+type OrganizationWebhookController struct {
+	ac client.Client
+}
+
+// NewWebhookController creates a webhook controller and returns its reference
+func NewWebhookController(ac client.Client) *OrganizationWebhookController {
+	return &OrganizationWebhookController{
+		ac,
+	}
+}
+
+// Read function returns the webhook of the organization from attribution
+func (wc *OrganizationWebhookController) Read(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	resp, err := wc.ac.GetWebhook(r.Context())
+	if errors.Is(err, client.ErrWebhookNotFound) {
+		fhirror.NotFound(r.Context(), w, "No webhook registered for the organization")
+		return
+	}
+	if err != nil {
+		log.Error("Failed to get the organization webhook from attribution", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Failed to get organization webhook")
+		return
+	}
+	writeResponse(w, r, resp)
+}
+
+// Update function validates the webhook and registers it for the organization in attribution. The response holds
+// the secret its notifications are signed with, which is not returned again.
+func (wc *OrganizationWebhookController) Update(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+
+	var hook webhook
+	if err := json.NewDecoder(r.Body).Decode(&hook); err != nil {
+		log.Error("Failed to parse organization webhook", zap.Error(err))
+		fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, "Body must be a webhook with a url")
+		return
+	}
+	if !validWebhookURL(hook.URL) {
+		fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, "url must be an absolute https URL")
+		return
+	}
+
+	body := new(bytes.Buffer)
+	if err := json.NewEncoder(body).Encode(hook); err != nil {
+		log.Error("Failed to convert organization webhook to bytes", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	resp, err := wc.ac.UpdateWebhook(r.Context(), body.Bytes())
+	if err != nil {
+		log.Error("Failed to save the organization webhook to attribution", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Failed to save organization webhook")
+		return
+	}
+	writeResponse(w, r, resp)
+}
+
+// Delete function removes the webhook of the organization
+func (wc *OrganizationWebhookController) Delete(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	err := wc.ac.DeleteWebhook(r.Context())
+	if errors.Is(err, client.ErrWebhookNotFound) {
+		fhirror.NotFound(r.Context(), w, "No webhook registered for the organization")
+		return
+	}
+	if err != nil {
+		log.Error("Failed to delete the organization webhook in attribution", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Failed to delete organization webhook")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Deliveries function returns the delivery log of the organization's webhook notifications, newest first
+func (wc *OrganizationWebhookController) Deliveries(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	resp, err := wc.ac.GetWebhookDeliveries(r.Context())
+	if err != nil {
+		log.Error("Failed to get the webhook deliveries from attribution", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Failed to get webhook deliveries")
+		return
+	}
+	writeResponse(w, r, resp)
+}
+
+// webhookRegistered writes a 400 to the response when a webhook was given at kickoff but the organization has not
+// registered one of its own, whose secret signs the notifications
+func webhookRegistered(w http.ResponseWriter, r *http.Request, ac client.Client, webhookURL string) bool {
+	if webhookURL == "" {
+		return true
+	}
+	_, err := ac.GetWebhook(r.Context())
+	if errors.Is(err, client.ErrWebhookNotFound) {
+		fhirror.BusinessViolation(r.Context(), w, http.StatusBadRequest, "The organization must register a webhook before giving one with _webhook")
+		return false
+	}
+	if err != nil {
+		logger.WithContext(r.Context()).Error("Failed to get the organization webhook from attribution", zap.Error(err))
+		fhirror.GenericServerIssue(r.Context(), w)
+		return false
+	}
+	return true
+}
+
+// validWebhookURL reports whether the URL is an absolute https URL, or http in the local environment. Attribution
+// also refuses internal hosts.
+func validWebhookURL(u string) bool {
+	parsed, err := url.Parse(u)
+	return err == nil && (parsed.Scheme == "https" || (parsed.Scheme == "http" && conf.IsLocal())) && parsed.Host != ""
+}
+
+func writeResponse(w http.ResponseWriter, r *http.Request, resp []byte) {
+	if _, err := w.Write(resp); err != nil {
+		logger.WithContext(r.Context()).Error("Failed to write data to response", zap.Error(err))
+		fhirror.ServerIssue(r.Context(), w, http.StatusInternalServerError, "Internal server error")
+	}
+}
@@ -0,0 +1,124 @@
+package v2
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CMSgov/dpc/api/client"
+	"github.com/CMSgov/dpc/api/constants"
+	"github.com/go-chi/chi/middleware"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type WebhookControllerTestSuite struct {
+	suite.Suite
+	mac *MockAttributionClient
+	wc  WebhookController
+}
+
+func TestWebhookControllerTestSuite(t *testing.T) {
+	suite.Run(t, new(WebhookControllerTestSuite))
+}
+
+func (suite *WebhookControllerTestSuite) SetupTest() {
+	suite.mac = new(MockAttributionClient)
+	suite.wc = NewWebhookController(suite.mac)
+}
+
+func (suite *WebhookControllerTestSuite) request(method string, body string) *http.Request {
+	req := httptest.NewRequest(method, "http://example.com/Webhook", strings.NewReader(body))
+	ctx := context.WithValue(req.Context(), middleware.RequestIDKey, "54321")
+	ctx = context.WithValue(ctx, constants.ContextKeyOrganization, "12345")
+	return req.WithContext(ctx)
+}
+
+func (suite *WebhookControllerTestSuite) TestRead() {
+	suite.mac.On("GetWebhook", mock.Anything).Return([]byte(`{"url":"https://example.com/hook"}`), nil)
+
+	w := httptest.NewRecorder()
+	suite.wc.Read(w, suite.request(http.MethodGet, ""))
+
+	resp, _ := ioutil.ReadAll(w.Result().Body)
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	assert.Equal(suite.T(), `{"url":"https://example.com/hook"}`, string(resp))
+}
+
+func (suite *WebhookControllerTestSuite) TestReadNotFound() {
+	suite.mac.On("GetWebhook", mock.Anything).Return([]byte(nil), client.ErrWebhookNotFound)
+
+	w := httptest.NewRecorder()
+	suite.wc.Read(w, suite.request(http.MethodGet, ""))
+
+	resp, _ := ioutil.ReadAll(w.Result().Body)
+	assert.Equal(suite.T(), http.StatusNotFound, w.Result().StatusCode)
+	assert.Contains(suite.T(), string(resp), "OperationOutcome")
+}
+
+func (suite *WebhookControllerTestSuite) TestUpdate() {
+	suite.mac.On("UpdateWebhook", mock.Anything, mock.MatchedBy(func(body []byte) bool {
+		return strings.TrimSpace(string(body)) == `{"url":"https://example.com/hook"}`
+	})).Return([]byte(`{"url":"https://example.com/hook","secret":"abc"}`), nil)
+
+	w := httptest.NewRecorder()
+	suite.wc.Update(w, suite.request(http.MethodPut, `{"url":"https://example.com/hook","secret":"mine"}`))
+
+	resp, _ := ioutil.ReadAll(w.Result().Body)
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	assert.Contains(suite.T(), string(resp), `"secret":"abc"`)
+	suite.mac.AssertExpectations(suite.T())
+}
+
+func (suite *WebhookControllerTestSuite) TestUpdateInvalid() {
+	for _, body := range []string{`{"url":"ftp://example.com/hook"}`, `{"url":"/hook"}`, `{"url":12}`, `not json`} {
+		w := httptest.NewRecorder()
+		suite.wc.Update(w, suite.request(http.MethodPut, body))
+
+		assert.Equal(suite.T(), http.StatusBadRequest, w.Result().StatusCode, body)
+	}
+	suite.mac.AssertNotCalled(suite.T(), "UpdateWebhook", mock.Anything, mock.Anything)
+}
+
+func (suite *WebhookControllerTestSuite) TestDelete() {
+	suite.mac.On("DeleteWebhook", mock.Anything).Once().Return(nil)
+	suite.mac.On("DeleteWebhook", mock.Anything).Once().Return(client.ErrWebhookNotFound)
+	suite.mac.On("DeleteWebhook", mock.Anything).Once().Return(errors.New("error"))
+
+	for _, status := range []int{http.StatusNoContent, http.StatusNotFound, http.StatusInternalServerError} {
+		w := httptest.NewRecorder()
+		suite.wc.Delete(w, suite.request(http.MethodDelete, ""))
+		assert.Equal(suite.T(), status, w.Result().StatusCode)
+	}
+}
+
+func (suite *WebhookControllerTestSuite) TestDeliveries() {
+	suite.mac.On("GetWebhookDeliveries", mock.Anything).Return([]byte(`[{"jobId":"job-1","status":"DELIVERED"}]`), nil)
+
+	w := httptest.NewRecorder()
+	suite.wc.Deliveries(w, suite.request(http.MethodGet, ""))
+
+	resp, _ := ioutil.ReadAll(w.Result().Body)
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	assert.Equal(suite.T(), `[{"jobId":"job-1","status":"DELIVERED"}]`, string(resp))
+}
+
+func (suite *WebhookControllerTestSuite) TestWebhookRegistered() {
+	w := httptest.NewRecorder()
+	assert.True(suite.T(), webhookRegistered(w, suite.request(http.MethodGet, ""), suite.mac, ""))
+	suite.mac.AssertNotCalled(suite.T(), "GetWebhook", mock.Anything)
+
+	suite.mac.On("GetWebhook", mock.Anything).Once().Return([]byte(nil), client.ErrWebhookNotFound)
+	w = httptest.NewRecorder()
+	assert.False(suite.T(), webhookRegistered(w, suite.request(http.MethodGet, ""), suite.mac, "https://example.com/hook"))
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Result().StatusCode)
+
+	suite.mac.On("GetWebhook", mock.Anything).Once().Return([]byte(`{}`), nil)
+	w = httptest.NewRecorder()
+	assert.True(suite.T(), webhookRegistered(w, suite.request(http.MethodGet, ""), suite.mac, "https://example.com/hook"))
+}
@@ -54,9 +54,18 @@ type ClaimsWindow struct {
 	UpperBound time.Time
 }
 
+// EOBFilter narrows the claims returned by GetExplanationOfBenefit, e.g. as requested by an export _typeFilter
+type EOBFilter struct {
+	ClaimsWindow
+	// ClaimTypes limits the claims to the given BFD claim types, e.g. carrier or outpatient
+	ClaimTypes []string
+	// ServiceDates are service-date search values with their comparison prefix, e.g. ge2021-01-01
+	ServiceDates []string
+}
+
 // APIClient is an interface for the API Client
 type APIClient interface {
-	GetExplanationOfBenefit(patientID, jobID, cmsID, since string, transactionTime time.Time, claimsWindow ClaimsWindow) (*models.Bundle, error)
+	GetExplanationOfBenefit(patientID, jobID, cmsID, since string, transactionTime time.Time, filter EOBFilter) (*models.Bundle, error)
 	GetPatient(patientID, jobID, cmsID, since string, transactionTime time.Time) (*models.Bundle, error)
 	GetCoverage(beneficiaryID, jobID, cmsID, since string, transactionTime time.Time) (*models.Bundle, error)
 	GetPatientByIdentifierHash(hashedIdentifier string) (string, error)
@@ -257,7 +266,7 @@ func (bfd *BfdClient) GetCoverage(beneficiaryID, jobID, cmsID, since string, tra
 }
 
 // GetExplanationOfBenefit is a method to get EOB data using a patient ID
-func (bfd *BfdClient) GetExplanationOfBenefit(patientID, jobID, cmsID, since string, transactionTime time.Time, claimsWindow ClaimsWindow) (*models.Bundle, error) {
+func (bfd *BfdClient) GetExplanationOfBenefit(patientID, jobID, cmsID, since string, transactionTime time.Time, filter EOBFilter) (*models.Bundle, error) {
 	// ServiceDate only uses yyyy-mm-dd
 	const svcDateFmt = "2006-01-02"
 
@@ -267,11 +276,17 @@ func (bfd *BfdClient) GetExplanationOfBenefit(patientID, jobID, cmsID, since str
 	params.Set("patient", patientID)
 	params.Set("excludeSAMHSA", "true")
 
-	if !claimsWindow.LowerBound.IsZero() {
-		params.Add("service-date", fmt.Sprintf("ge%s", claimsWindow.LowerBound.Format(svcDateFmt)))
+	if !filter.LowerBound.IsZero() {
+		params.Add("service-date", fmt.Sprintf("ge%s", filter.LowerBound.Format(svcDateFmt)))
+	}
+	if !filter.UpperBound.IsZero() {
+		params.Add("service-date", fmt.Sprintf("le%s", filter.UpperBound.Format(svcDateFmt)))
+	}
+	for _, d := range filter.ServiceDates {
+		params.Add("service-date", d)
 	}
-	if !claimsWindow.UpperBound.IsZero() {
-		params.Add("service-date", fmt.Sprintf("le%s", claimsWindow.UpperBound.Format(svcDateFmt)))
+	if len(filter.ClaimTypes) > 0 {
+		params.Set("type", strings.Join(filter.ClaimTypes, ","))
 	}
 
 	updateParamWithLastUpdated(&params, since, transactionTime)
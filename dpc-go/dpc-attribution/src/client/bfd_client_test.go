@@ -313,14 +313,14 @@ func (s *BfdRequestTestSuite) TestGetCoverage_500() {
 }
 
 func (s *BfdRequestTestSuite) TestGetExplanationOfBenefit() {
-	e, err := s.bbClient.GetExplanationOfBenefit("012345", "543210", "A0000", "", now, client.ClaimsWindow{})
+	e, err := s.bbClient.GetExplanationOfBenefit("012345", "543210", "A0000", "", now, client.EOBFilter{})
 	assert.Nil(s.T(), err)
 	assert.Equal(s.T(), 33, len(e.Entries))
 	assert.Equal(s.T(), "carrier-10525061996", e.Entries[3]["resource"].(map[string]interface{})["id"])
 }
 
 func (s *BfdRequestTestSuite) TestGetExplanationOfBenefit_500() {
-	e, err := s.bbClient.GetExplanationOfBenefit("012345", "543210", "A0000", "", now, client.ClaimsWindow{})
+	e, err := s.bbClient.GetExplanationOfBenefit("012345", "543210", "A0000", "", now, client.EOBFilter{})
 	assert.Regexp(s.T(), `BFD request failed \d+ time\(s\) failed to get bundle response`, err.Error())
 	assert.Nil(s.T(), e)
 }
@@ -386,7 +386,7 @@ func (s *BfdRequestTestSuite) TestValidateRequest() {
 		{
 			"GetExplanationOfBenefit",
 			func(bbClient *client.BfdClient, jobID, cmsID string) (interface{}, error) {
-				return bbClient.GetExplanationOfBenefit("patient1", jobID, cmsID, since, now, client.ClaimsWindow{})
+				return bbClient.GetExplanationOfBenefit("patient1", jobID, cmsID, since, now, client.EOBFilter{})
 			},
 			func(t *testing.T, payload interface{}) {
 				result, ok := payload.(*models.Bundle)
@@ -405,7 +405,7 @@ func (s *BfdRequestTestSuite) TestValidateRequest() {
 		{
 			"GetExplanationOfBenefitNoSince",
 			func(bbClient *client.BfdClient, jobID, cmsID string) (interface{}, error) {
-				return bbClient.GetExplanationOfBenefit("patient1", jobID, cmsID, "", now, client.ClaimsWindow{})
+				return bbClient.GetExplanationOfBenefit("patient1", jobID, cmsID, "", now, client.EOBFilter{})
 			},
 			func(t *testing.T, payload interface{}) {
 				result, ok := payload.(*models.Bundle)
@@ -424,7 +424,7 @@ func (s *BfdRequestTestSuite) TestValidateRequest() {
 		{
 			"GetExplanationOfBenefitWithUpperBoundServiceDate",
 			func(bbClient *client.BfdClient, jobID, cmsID string) (interface{}, error) {
-				return bbClient.GetExplanationOfBenefit("patient1", jobID, cmsID, since, now, client.ClaimsWindow{UpperBound: claimsDate.UpperBound})
+				return bbClient.GetExplanationOfBenefit("patient1", jobID, cmsID, since, now, client.EOBFilter{ClaimsWindow: client.ClaimsWindow{UpperBound: claimsDate.UpperBound}})
 			},
 			func(t *testing.T, payload interface{}) {
 				result, ok := payload.(*models.Bundle)
@@ -444,7 +444,7 @@ func (s *BfdRequestTestSuite) TestValidateRequest() {
 		{
 			"GetExplanationOfBenefitWithLowerBoundServiceDate",
 			func(bbClient *client.BfdClient, jobID, cmsID string) (interface{}, error) {
-				return bbClient.GetExplanationOfBenefit("patient1", jobID, cmsID, since, now, client.ClaimsWindow{LowerBound: claimsDate.LowerBound})
+				return bbClient.GetExplanationOfBenefit("patient1", jobID, cmsID, since, now, client.EOBFilter{ClaimsWindow: client.ClaimsWindow{LowerBound: claimsDate.LowerBound}})
 			},
 			func(t *testing.T, payload interface{}) {
 				result, ok := payload.(*models.Bundle)
@@ -464,7 +464,7 @@ func (s *BfdRequestTestSuite) TestValidateRequest() {
 		{
 			"GetExplanationOfBenefitWithLowerAndUpperBoundServiceDate",
 			func(bbClient *client.BfdClient, jobID, cmsID string) (interface{}, error) {
-				return bbClient.GetExplanationOfBenefit("patient1", jobID, cmsID, since, now, claimsDate)
+				return bbClient.GetExplanationOfBenefit("patient1", jobID, cmsID, since, now, client.EOBFilter{ClaimsWindow: claimsDate})
 			},
 			func(t *testing.T, payload interface{}) {
 				result, ok := payload.(*models.Bundle)
@@ -481,6 +481,26 @@ func (s *BfdRequestTestSuite) TestValidateRequest() {
 				includeTaxNumbersChecker,
 			},
 		},
+		{
+			"GetExplanationOfBenefitWithTypeFilter",
+			func(bbClient *client.BfdClient, jobID, cmsID string) (interface{}, error) {
+				return bbClient.GetExplanationOfBenefit("patient1", jobID, cmsID, since, now,
+					client.EOBFilter{ClaimTypes: []string{"carrier", "outpatient"}, ServiceDates: []string{"gt2021-01-01"}})
+			},
+			func(t *testing.T, payload interface{}) {
+				result, ok := payload.(*models.Bundle)
+				assert.True(t, ok)
+				assert.NotEmpty(t, result.Entries)
+			},
+			[]func(*testing.T, *http.Request){
+				sinceChecker,
+				nowChecker,
+				excludeSAMHSAChecker,
+				claimTypeChecker,
+				serviceDateFilterChecker,
+				includeTaxNumbersChecker,
+			},
+		},
 		{
 			"GetPatient",
 			func(bbClient *client.BfdClient, jobID, cmsID string) (interface{}, error) {
@@ -691,6 +711,12 @@ func excludeSAMHSAChecker(t *testing.T, req *http.Request) {
 func nowChecker(t *testing.T, req *http.Request) {
 	assert.Contains(t, req.URL.String(), fmt.Sprintf("_lastUpdated=le%s", nowFormatted))
 }
+func claimTypeChecker(t *testing.T, req *http.Request) {
+	assert.Equal(t, "carrier,outpatient", req.URL.Query().Get("type"))
+}
+func serviceDateFilterChecker(t *testing.T, req *http.Request) {
+	assert.Equal(t, []string{"gt2021-01-01"}, req.URL.Query()["service-date"])
+}
 func noServiceDateChecker(t *testing.T, req *http.Request) {
 	assert.Empty(t, req.URL.Query()["service-date"])
 }
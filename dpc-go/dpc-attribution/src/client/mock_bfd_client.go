@@ -21,8 +21,8 @@ type MockBfdClient struct {
 }
 
 // GetExplanationOfBenefit is used for testing
-func (bfd *MockBfdClient) GetExplanationOfBenefit(patientID, jobID, cmsID, since string, transactionTime time.Time, serviceDate ClaimsWindow) (*models.Bundle, error) {
-	args := bfd.Called(patientID, jobID, cmsID, since, transactionTime, serviceDate)
+func (bfd *MockBfdClient) GetExplanationOfBenefit(patientID, jobID, cmsID, since string, transactionTime time.Time, filter EOBFilter) (*models.Bundle, error) {
+	args := bfd.Called(patientID, jobID, cmsID, since, transactionTime, filter)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
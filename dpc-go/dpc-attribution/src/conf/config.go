@@ -54,6 +54,11 @@ func NewConfig(dir ...string) {
 	config.SetDefault("DecryptedDir", getDecryptedDir())
 }
 
+// IsLocal reports whether the service runs in the local environment, set by ENV=local
+func IsLocal() bool {
+	return os.Getenv("ENV") == "local"
+}
+
 // GetAsString is a function to retrieve the value from the viper config as a string
 // allowing to also pass in a default value
 func GetAsString(key string, dv ...string) string {
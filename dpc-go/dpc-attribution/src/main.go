@@ -9,9 +9,11 @@ import (
 	"fmt"
 	"github.com/CMSgov/dpc/attribution/client"
 	"net/http"
+	"time"
 
 	"github.com/CMSgov/dpc/attribution/conf"
 	"github.com/CMSgov/dpc/attribution/logger"
+	v1Model "github.com/CMSgov/dpc/attribution/model/v1"
 	v1Repo "github.com/CMSgov/dpc/attribution/repository/v1"
 	"go.uber.org/zap"
 
@@ -19,6 +21,8 @@ import (
 	"github.com/CMSgov/dpc/attribution/router"
 	"github.com/CMSgov/dpc/attribution/service"
 	v1 "github.com/CMSgov/dpc/attribution/service/v1"
+	"github.com/CMSgov/dpc/attribution/storage"
+	"github.com/CMSgov/dpc/attribution/worker"
 )
 
 func main() {
@@ -52,8 +56,39 @@ func main() {
 		logger.WithContext(ctx).Fatal("Failed to create BFD client", zap.Error(err))
 	}
 
+	store, err := storage.NewStore()
+	if err != nil {
+		logger.WithContext(ctx).Fatal("Failed to create export file storage", zap.Error(err))
+	}
+
 	gr := repository.NewGroupRepo(db)
-	js, ds := createJobServices(queueDbV1, or, bfdClient)
+	retention := worker.NewRetentionConfig()
+	listener, err := v1Repo.NewJobListener()
+	if err != nil {
+		logger.WithContext(ctx).Fatal("Failed to create finished batch listener", zap.Error(err))
+	}
+	waiter := v1.NewJobWaiter(listener, time.Duration(conf.GetAsInt("jobs.listenRetrySeconds", 5))*time.Second)
+	go waiter.Run(ctx)
+	js, ds, ps, ws, rts := createJobServices(queueDbV1, or, bfdClient, store, retention.Policy, waiter)
+
+	if conf.GetAsString("worker.enabled", "false") == "true" {
+		ew := worker.NewExportWorker(v1Repo.NewJobRepo(queueDbV1), bfdClient, store, worker.NewConfig())
+		go ew.Run(ctx)
+	}
+	if retention.Policy.Enabled {
+		rs := worker.NewRetentionSweeper(v1Repo.NewJobRepo(queueDbV1), store, retention)
+		go rs.Run(ctx)
+	}
+	if conf.GetAsString("webhooks.dispatcherEnabled", "false") == "true" {
+		wd := worker.NewWebhookDispatcher(v1Repo.NewJobRepo(queueDbV1), worker.NewWebhookConfig())
+		go wd.Run(ctx)
+	}
+	if conf.GetAsString("exportSchedules.runnerEnabled", "true") == "true" {
+		sr := worker.NewExportScheduleRunner(v1Repo.NewJobRepo(queueDbV1), gr, js, worker.NewExportScheduleConfig())
+		go sr.Run(ctx)
+	}
+	esr := v1Repo.NewJobRepo(queueDbV1)
+	es := v1.NewExportScheduleService(esr, gr, esr)
 	gs := service.NewGroupService(gr, js)
 
 	ir := repository.NewImplementerRepo(db)
@@ -64,7 +99,7 @@ func main() {
 
 	ios := service.NewImplementerOrgService(ir, or, ior, autoCreateOrg == "true")
 
-	attributionRouter := router.NewDPCAttributionRouter(os, gs, is, ios, ds, js)
+	attributionRouter := router.NewDPCAttributionRouter(os, gs, is, ios, ds, js, ps, rts, ws, es)
 	port := conf.GetAsString("port", "3001")
 
 	authType := conf.GetAsString("AUTH_TYPE", "TLS")
@@ -132,9 +167,11 @@ func startSecureServer(ctx context.Context, port string, handler http.Handler, u
 	}
 }
 
-func createJobServices(queueDbV1 *sql.DB, or repository.OrganizationRepo, client client.APIClient) (v1.JobService, v1.DataService) {
+func createJobServices(queueDbV1 *sql.DB, or repository.OrganizationRepo, client client.APIClient, store storage.Store, retention v1Model.RetentionPolicy, waiter *v1.JobWaiter) (v1.JobService, v1.DataService, v1.OrgPriorityService, v1.WebhookService, v1.OrgRetentionService) {
 	jr := v1Repo.NewJobRepo(queueDbV1)
-	return v1.NewJobService(jr, or, client), v1.NewDataService(jr)
+	scheduler := v1.NewScheduler(jr, v1.NewSchedulerConfig())
+	return v1.NewJobService(jr, or, client, store, retention, jr, scheduler, jr, waiter), v1.NewDataService(jr), v1.NewOrgPriorityService(jr),
+		v1.NewWebhookService(jr), v1.NewOrgRetentionService(jr, retention)
 }
 
 func getServerCertificates(ctx context.Context) (*x509.CertPool, tls.Certificate) {
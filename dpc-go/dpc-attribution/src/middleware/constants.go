@@ -10,6 +10,8 @@ const (
 	FwdHeader string = "X-Forwarded-For"
 	// RequestURLHeader is used to pass on the requestingUrl to attribution
 	RequestURLHeader string = "X-Request-Url"
+	// DuplicateJobHeader is set on the response of a kickoff that returned the job of an earlier one
+	DuplicateJobHeader string = "X-Duplicate-Job"
 	// SinceLayout is the time format for the since parameter
 	SinceLayout string = "2006-01-02T15:04:05-07:00"
 	// ContextKeyOrganization is the key in the context to retrieve the organizationID
@@ -22,4 +24,6 @@ const (
 	ContextKeyImplementer
 	// ContextKeyJobID is the key in the context to retrieve the JobID
 	ContextKeyJobID
+	// ContextKeyExportSchedule is the key in the context to retrieve the export schedule ID
+	ContextKeyExportSchedule
 )
@@ -55,6 +55,15 @@ func JobCtx(next http.Handler) http.Handler {
 	})
 }
 
+// ExportScheduleCtx middleware to extract the export schedule ID from the url and set it into the request context
+func ExportScheduleCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheduleID := chi.URLParam(r, "scheduleID")
+		ctx := context.WithValue(r.Context(), ContextKeyExportSchedule, scheduleID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 // AuthCtx middleware is placeholder to get org id from token
 func AuthCtx(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
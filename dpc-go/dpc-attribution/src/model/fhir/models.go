@@ -26,3 +26,45 @@ type Bundle struct {
 
 // BundleEntry models a FHIR bundle entry
 type BundleEntry map[string]interface{}
+
+// Group models the members of a FHIR group, each attributed to a practitioner by an extension
+type Group struct {
+	Member []GroupMember `json:"member"`
+}
+
+// GroupMember models a patient of a FHIR group
+type GroupMember struct {
+	Entity    Reference `json:"entity"`
+	Extension []struct {
+		ValueReference *Reference `json:"valueReference"`
+	} `json:"extension"`
+}
+
+// Reference models a FHIR reference by identifier
+type Reference struct {
+	Type       string `json:"type"`
+	Identifier struct {
+		System string `json:"system"`
+		Value  string `json:"value"`
+	} `json:"identifier"`
+}
+
+// Attributions returns the patient MBIs of the members attributed to a practitioner, and the NPIs of those
+// practitioners, in member order. It mirrors how the API reads a group when an export is kicked off.
+func (g Group) Attributions() (patientMBIs []string, providerNPIs []string) {
+	patientMBIs = make([]string, 0)
+	providerNPIs = make([]string, 0)
+	for _, m := range g.Member {
+		for _, e := range m.Extension {
+			if e.ValueReference == nil || e.ValueReference.Type != "Practitioner" {
+				continue
+			}
+			if m.Entity.Identifier.Value != "" && e.ValueReference.Identifier.Value != "" {
+				patientMBIs = append(patientMBIs, m.Entity.Identifier.Value)
+				providerNPIs = append(providerNPIs, e.ValueReference.Identifier.Value)
+			}
+			break
+		}
+	}
+	return patientMBIs, providerNPIs
+}
@@ -18,7 +18,36 @@ type BatchRequest struct {
 	PatientMBIs     string
 	IsBulk          bool
 	ResourceTypes   string
+	TypeFilter      string
+	Elements        string
+	Warnings        string
+	// WebhookURL is notified instead of the organization's webhook when the job finishes
+	WebhookURL      string
 	TransactionTime time.Time
+	// ScheduleID is the export schedule that enqueued the job, if any
+	ScheduleID string
+	// GroupID is the group that was exported, if any
+	GroupID string
+	// SinceAuto is set when Since was resolved from the group's last export for a _since=auto kickoff
+	SinceAuto bool
+}
+
+// JobDedupe identifies a kickoff so that repeating it returns the job it already started
+type JobDedupe struct {
+	Fingerprint    string
+	IdempotencyKey string
+	// FreshSince is how recently an identical job must have completed to be returned instead of a new one
+	FreshSince time.Time
+	// KeysSince is how far back jobs are matched by their idempotency key
+	KeysSince time.Time
+}
+
+// GroupExport is the latest completed export of a group that a _since=auto kickoff continues from
+type GroupExport struct {
+	JobID           string
+	TransactionTime time.Time
+	// PatientMBIs are the members of the group that the export covered
+	PatientMBIs []string
 }
 
 // BatchAndFiles is a struct to hold batch and file info from running job
@@ -37,6 +66,13 @@ type BatchInfo struct {
 	SubmitTime        time.Time  `json:"submitTime"`
 	CompleteTime      *time.Time `json:"completeTime"`
 	RequestURL        string     `json:"requestURL"`
+	// ExpiresAt is when the files of a finished batch are purged under the retention policy of its organization
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// QueuePosition and EstimatedWaitSeconds describe where the next batch of a queued job stands in the queue
+	QueuePosition        *int `json:"queuePosition,omitempty"`
+	EstimatedWaitSeconds *int `json:"estimatedWaitSeconds,omitempty"`
+	// EstimatedSecondsRemaining is how long until an unfinished batch completes, estimated from recent throughput
+	EstimatedSecondsRemaining *int `json:"estimatedSecondsRemaining,omitempty"`
 }
 
 // NewBatchInfo is a function to construct a BatchInfo from JobQueueBatch
@@ -46,7 +82,7 @@ func NewBatchInfo(batch JobQueueBatch) *BatchInfo {
 		patientIndex = int(batch.PatientIndex.Int64)
 	}
 	return &BatchInfo{
-		TotalPatients:     len(batch.PatientMBIs),
+		TotalPatients:     batch.PatientCount(),
 		PatientsProcessed: batch.PatientsProcessed(),
 		PatientIndex:      &patientIndex,
 		Status:            string(batch.Status),
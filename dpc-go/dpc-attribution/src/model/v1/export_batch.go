@@ -0,0 +1,104 @@
+package v1
+
+import (
+	"database/sql"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Batch status values as stored in job_queue_batch.status, the ordinals of the Java gov.cms.dpc.queue.JobStatus enum
+const (
+	StatusQueued = iota
+	StatusRunning
+	StatusCompleted
+	StatusFailed
+	StatusCancelled
+)
+
+// ExportBatch is a job_queue_batch row claimed by the export worker, holding what it needs to run the batch
+type ExportBatch struct {
+	BatchID         string
+	JobID           string
+	OrganizationID  string
+	PatientMBIs     string
+	ResourceTypes   string
+	TypeFilter      string
+	Elements        string
+	Warnings        []string
+	Since           sql.NullTime
+	TransactionTime time.Time
+	PatientIndex    sql.NullInt64
+}
+
+// Patients returns the MBIs of the batch
+func (eb *ExportBatch) Patients() []string {
+	if eb.PatientMBIs == "" {
+		return []string{}
+	}
+	return strings.Split(eb.PatientMBIs, ",")
+}
+
+// Types returns the requested resource types of the batch
+func (eb *ExportBatch) Types() []string {
+	return strings.Split(eb.ResourceTypes, ",")
+}
+
+// Filters returns the search parameters of every _typeFilter query requested for a resource type. TypeFilter holds
+// the queries comma separated, with their parameter values encoded. A resource matching any of the queries is exported.
+func (eb *ExportBatch) Filters(resourceType string) []url.Values {
+	filters := make([]url.Values, 0)
+	if eb.TypeFilter == "" {
+		return filters
+	}
+	for _, query := range strings.Split(eb.TypeFilter, ",") {
+		parts := strings.SplitN(query, "?", 2)
+		if len(parts) != 2 || parts[0] != resourceType {
+			continue
+		}
+		if params, err := url.ParseQuery(parts[1]); err == nil {
+			filters = append(filters, params)
+		}
+	}
+	return filters
+}
+
+// ElementsFor returns the top-level elements requested with _elements for a resource type. Elements prefixed with
+// another resource type are skipped.
+func (eb *ExportBatch) ElementsFor(resourceType string) []string {
+	if eb.Elements == "" {
+		return nil
+	}
+	elements := make([]string, 0)
+	for _, e := range strings.Split(eb.Elements, ",") {
+		if i := strings.Index(e, "."); i > 0 {
+			if e[:i] != resourceType {
+				continue
+			}
+			e = e[i+1:]
+		}
+		elements = append(elements, e)
+	}
+	return elements
+}
+
+// NextPatient returns the index of the first patient that has not been processed, so a restarted batch resumes
+func (eb *ExportBatch) NextPatient() int {
+	if eb.PatientIndex.Valid {
+		return int(eb.PatientIndex.Int64) + 1
+	}
+	return 0
+}
+
+// ExportFile is a gzipped NDJSON file written by the export worker, saved to job_queue_batch_file when the batch
+// completes. Checksum and FileLength describe the uncompressed NDJSON, like the files of the aggregation engine.
+type ExportFile struct {
+	ResourceType         string
+	Sequence             int
+	FileName             string
+	Count                int
+	Checksum             []byte
+	FileLength           int64
+	CompressedChecksum   []byte
+	CompressedFileLength int64
+}
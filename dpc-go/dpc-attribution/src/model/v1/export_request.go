@@ -1,11 +1,49 @@
 package v1
 
-//ExportRequest struct to hold data for export request
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// SinceAuto is the since value of a group export that continues from the group's last successful export
+const SinceAuto = "auto"
+
+// ExportRequest struct to hold data for export request
 type ExportRequest struct {
 	GroupID      string   `json:"groupID"`
 	OutputFormat string   `json:"outputFormat"`
 	Since        string   `json:"since"`
 	Type         string   `json:"type"`
+	TypeFilter   string   `json:"typeFilter"`
+	Elements     string   `json:"elements"`
 	MBIs         []string `json:"mbis"`
 	ProviderNPI  string   `json:"provider"`
+	Warnings     []string `json:"warnings"`
+	WebhookURL   string   `json:"webhookURL"`
+	// GroupVersion is the version of the group when the export was requested
+	GroupVersion int `json:"groupVersion"`
+	// IdempotencyKey is the Idempotency-Key header given at kickoff, if any
+	IdempotencyKey string `json:"idempotencyKey"`
+	// ExistingOnly asks for the job of a repeated kickoff without starting a new one
+	ExistingOnly bool `json:"existingOnly"`
+	// ScheduleID is the export schedule that enqueued the request, it is never read from a kickoff
+	ScheduleID string `json:"-"`
+	// FirstSince is where a _since=auto export starts when the group has no previous export, it is set by export
+	// schedules and never read from a kickoff
+	FirstSince *time.Time `json:"-"`
+}
+
+// Fingerprint identifies what the request exports, so that an identical kickoff can return the job already started
+// for it. The webhook and warnings do not change the exported data and are left out. Scheduled runs only match
+// runs of the same schedule.
+func (er ExportRequest) Fingerprint() string {
+	mbis := append([]string(nil), er.MBIs...)
+	sort.Strings(mbis)
+	b, _ := json.Marshal([]interface{}{er.GroupID, er.GroupVersion, er.OutputFormat, er.Since, er.Type, er.TypeFilter,
+		er.Elements, er.ProviderNPI, mbis, er.ScheduleID})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,62 @@
+package v1
+
+import "time"
+
+// Frequencies of an export schedule
+const (
+	FrequencyDaily   = "DAILY"
+	FrequencyWeekly  = "WEEKLY"
+	FrequencyMonthly = "MONTHLY"
+)
+
+// ValidFrequency reports whether the frequency is one an export schedule can run at
+func ValidFrequency(frequency string) bool {
+	return frequency == FrequencyDaily || frequency == FrequencyWeekly || frequency == FrequencyMonthly
+}
+
+// ExportSchedule is a group export that is enqueued automatically at a fixed frequency, starting at StartAt. Each
+// run is a _since=auto export, so members the group's previous export covered get what changed since it and members
+// added since then get their full history. The first export of the group starts from Since.
+type ExportSchedule struct {
+	ID             string     `json:"id"`
+	OrganizationID string     `json:"organizationID"`
+	GroupID        string     `json:"groupID"`
+	Frequency      string     `json:"frequency"`
+	StartAt        time.Time  `json:"startAt"`
+	NextRunAt      time.Time  `json:"nextRunAt"`
+	Type           string     `json:"type"`
+	Since          *time.Time `json:"since,omitempty"`
+	WebhookURL     string     `json:"webhookURL,omitempty"`
+	LastRunAt      *time.Time `json:"lastRunAt,omitempty"`
+	LastJobID      *string    `json:"lastJobID,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
+
+// ExportScheduleRequest is the body that creates or replaces an export schedule. Without StartAt, a new schedule
+// runs right away.
+type ExportScheduleRequest struct {
+	GroupID    string     `json:"groupID"`
+	Frequency  string     `json:"frequency"`
+	StartAt    *time.Time `json:"startAt"`
+	Type       string     `json:"type"`
+	Since      *time.Time `json:"since"`
+	WebhookURL string     `json:"webhookURL"`
+}
+
+// NextRunAfter returns the first run of the schedule after the given time. Runs missed while the runner was down
+// are skipped rather than enqueued back to back.
+func (s ExportSchedule) NextRunAfter(t time.Time) time.Time {
+	next := s.StartAt
+	for i := 1; !next.After(t); i++ {
+		switch s.Frequency {
+		case FrequencyDaily:
+			next = s.StartAt.AddDate(0, 0, i)
+		case FrequencyWeekly:
+			next = s.StartAt.AddDate(0, 0, 7*i)
+		default:
+			next = s.StartAt.AddDate(0, i, 0)
+		}
+	}
+	return next
+}
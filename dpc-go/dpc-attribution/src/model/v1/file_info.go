@@ -5,4 +5,7 @@ type FileInfo struct {
 	FileName     string
 	FileLength   int
 	FileCheckSum []byte
+	// CompressedFileLength and CompressedCheckSum are only set when the file is stored gzipped
+	CompressedFileLength int    `json:",omitempty"`
+	CompressedCheckSum   []byte `json:",omitempty"`
 }
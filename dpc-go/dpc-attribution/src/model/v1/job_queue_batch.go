@@ -8,7 +8,7 @@ import (
 	"time"
 )
 
-var statusMap = map[int]string{0: "QUEUED", 1: "RUNNING", 2: "COMPLETED", 3: "FAILED"}
+var statusMap = map[int]string{0: "QUEUED", 1: "RUNNING", 2: "COMPLETED", 3: "FAILED", 4: "CANCELLED"}
 
 type statusType string
 
@@ -39,9 +39,7 @@ func (st *statusType) Scan(value interface{}) error {
 func (jqb *JobQueueBatch) PatientsProcessed() int {
 	results := 0
 	if jqb.Status == "COMPLETED" {
-		if jqb.PatientMBIs != "" {
-			results = len(jqb.patients())
-		}
+		results = jqb.PatientCount()
 	} else {
 		results = 0
 		if jqb.PatientIndex.Valid {
@@ -51,6 +49,14 @@ func (jqb *JobQueueBatch) PatientsProcessed() int {
 	return results
 }
 
+// PatientCount function returns how many patients the batch exports
+func (jqb *JobQueueBatch) PatientCount() int {
+	if jqb.PatientMBIs == "" {
+		return 0
+	}
+	return len(jqb.patients())
+}
+
 func (jqb *JobQueueBatch) patients() []string {
 	return strings.Split(jqb.PatientMBIs, ",")
 }
@@ -3,6 +3,9 @@ package v1
 import (
 	"database/sql/driver"
 	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -22,6 +25,11 @@ type JobQueueBatchFile struct {
 	Count        int           `db:"count" json:"count"`
 	Checksum     *HexType      `db:"checksum" json:"checksum"`
 	FileLength   int           `db:"file_length" json:"fileLength"`
+	// CompressedChecksum and CompressedFileLength are only set for files stored gzipped
+	CompressedChecksum   *HexType `db:"compressed_checksum" json:"compressedChecksum,omitempty"`
+	CompressedFileLength *int     `db:"compressed_file_length" json:"compressedFileLength,omitempty"`
+	// PurgedAt is set once the retention sweeper has deleted the file
+	PurgedAt *time.Time `db:"purged_at" json:"purgedAt,omitempty"`
 }
 
 // Scan is a function to convert the database int to string resource type representation
@@ -45,3 +53,23 @@ func (ht *HexType) Scan(value interface{}) error {
 }
 
 var resourceMap = map[int]string{5: "OperationOutcome", 3: "ExplanationOfBenefit", 1: "Coverage", 7: "Patient"}
+
+// ResourceTypeCode returns the database int representation of a resource type
+func ResourceTypeCode(resourceType string) (int, bool) {
+	for code, name := range resourceMap {
+		if name == resourceType {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+// CompressedFileName returns the name a gzipped file is stored under on disk
+func CompressedFileName(fileName string) string {
+	return fmt.Sprintf("%s.ndjson.gz", fileName)
+}
+
+// FileName returns the name of the nth file of a resource type in a batch, matching the aggregation engine
+func FileName(batchID string, resourceType string, sequence int) string {
+	return fmt.Sprintf("%s-%d.%s", batchID, sequence, strings.ToLower(resourceType))
+}
@@ -0,0 +1,68 @@
+package v1
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// JobFilter holds the filters and paging for listing an organization's jobs
+type JobFilter struct {
+	Statuses        []int
+	SubmittedAfter  *time.Time
+	SubmittedBefore *time.Time
+	ScheduleID      string
+	Limit           int
+	Offset          int
+}
+
+// JobSummary is a job rolled up from its batches
+type JobSummary struct {
+	JobID         string     `json:"jobID"`
+	Status        string     `json:"status"`
+	SubmitTime    time.Time  `json:"submitTime"`
+	CompleteTime  *time.Time `json:"completeTime,omitempty"`
+	ResourceTypes []string   `json:"resourceTypes"`
+	PatientCount  int        `json:"patientCount"`
+	RequestURL    string     `json:"requestURL"`
+	// ScheduleID is the export schedule that enqueued the job, if any
+	ScheduleID string `json:"scheduleID,omitempty"`
+}
+
+// JobList is a page of job summaries
+type JobList struct {
+	Jobs    []JobSummary `json:"jobs"`
+	HasMore bool         `json:"hasMore"`
+}
+
+// NewJobSummary builds a JobSummary from the aggregated columns of a job
+func NewJobSummary(jobID string, status int, submitTime time.Time, completeTime sql.NullTime, resourceTypes string, patientCount int, requestURL string, scheduleID string) JobSummary {
+	js := JobSummary{
+		JobID:         jobID,
+		Status:        statusMap[status],
+		SubmitTime:    submitTime,
+		ResourceTypes: strings.Split(resourceTypes, ","),
+		PatientCount:  patientCount,
+		RequestURL:    requestURL,
+		ScheduleID:    scheduleID,
+	}
+	if completeTime.Valid && (status == StatusCompleted || status == StatusFailed || status == StatusCancelled) {
+		js.CompleteTime = &completeTime.Time
+	}
+	return js
+}
+
+// StatusCode returns the database int representation of a status name
+func StatusCode(status string) (int, bool) {
+	for code, name := range statusMap {
+		if name == status {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+// StatusName returns the name of a database int status
+func StatusName(code int) string {
+	return statusMap[code]
+}
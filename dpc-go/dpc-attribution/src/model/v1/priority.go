@@ -0,0 +1,44 @@
+package v1
+
+import "time"
+
+// Priority tiers an organization can be scheduled in, from first to last served
+const (
+	TierHigh     = "high"
+	TierStandard = "standard"
+	TierLow      = "low"
+)
+
+// ValidTier reports whether the tier is one of TierHigh, TierStandard or TierLow
+func ValidTier(tier string) bool {
+	return tier == TierHigh || tier == TierStandard || tier == TierLow
+}
+
+// PriorityTier holds the priority tier and concurrency cap an admin has set for an organization
+type PriorityTier struct {
+	OrganizationID string `json:"organizationID"`
+	Tier           string `json:"tier"`
+	// MaxConcurrentBatches caps how many batches of the organization run at once, 0 leaves it uncapped
+	MaxConcurrentBatches int `json:"maxConcurrentBatches"`
+}
+
+// DefaultPriorityTier is the priority tier of an organization an admin hasn't set one for
+func DefaultPriorityTier(orgID string) *PriorityTier {
+	return &PriorityTier{OrganizationID: orgID, Tier: TierStandard}
+}
+
+// OrgUsage is how much of the queue an organization is using and has recently used
+type OrgUsage struct {
+	// ActiveBatches counts the queued and running batches of the organization
+	ActiveBatches int
+	// RecentBatches counts the batches of the organization that finished within the usage window
+	RecentBatches int
+}
+
+// QueueEstimate is where the next batch of a job stands in the queue
+type QueueEstimate struct {
+	// Position counts the queued batches that will be claimed before it
+	Position int
+	// EstimatedWait is nil when no batch finished recently enough to estimate from
+	EstimatedWait *time.Duration
+}
@@ -0,0 +1,23 @@
+package v1
+
+import "time"
+
+// RetentionPolicy is how long the files of a finished job are kept, counted from the completion of its last batch
+type RetentionPolicy struct {
+	// Enabled is false when the retention sweeper is off, so files are kept until removed by other means
+	Enabled bool
+	// Default applies to organizations without an OrgRetention set by an admin
+	Default time.Duration
+}
+
+// OrgRetention is the retention period an admin has set for an organization, in hours
+type OrgRetention struct {
+	OrganizationID string `json:"organizationID"`
+	Hours          int    `json:"hours"`
+}
+
+// ExpiredJob is a finished job whose files have outlived the retention period of its organization
+type ExpiredJob struct {
+	JobID          string
+	OrganizationID string
+}
@@ -0,0 +1,65 @@
+package v1
+
+import "time"
+
+// Delivery statuses of a webhook notification
+const (
+	DeliveryPending   = "PENDING"
+	DeliveryDelivered = "DELIVERED"
+	DeliveryFailed    = "FAILED"
+)
+
+// OrgWebhook is the callback URL an organization registered to be notified when its jobs finish, and the secret its
+// notifications are signed with
+type OrgWebhook struct {
+	OrganizationID string    `json:"organizationID"`
+	URL            string    `json:"url"`
+	Secret         string    `json:"secret,omitempty"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// FinishedJob is a job whose batches have all reached a terminal state and that has a webhook to notify
+type FinishedJob struct {
+	JobID          string
+	OrganizationID string
+	// URL is the webhook given at kickoff, or else the one registered for the organization
+	URL          string
+	Status       string
+	CompleteTime time.Time
+}
+
+// WebhookPayload is the body POSTed to a webhook when a job finishes
+type WebhookPayload struct {
+	JobID        string    `json:"jobId"`
+	Status       string    `json:"status"`
+	ManifestURL  string    `json:"manifestUrl"`
+	CompleteTime time.Time `json:"completeTime"`
+}
+
+// WebhookDelivery is a notification of a finished job and the outcome of the attempts to send it
+type WebhookDelivery struct {
+	ID             string     `json:"id"`
+	JobID          string     `json:"jobId"`
+	OrganizationID string     `json:"-"`
+	URL            string     `json:"url"`
+	Payload        string     `json:"-"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"nextAttemptAt"`
+	LastStatusCode *int       `json:"lastStatusCode,omitempty"`
+	LastError      *string    `json:"lastError,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	DeliveredAt    *time.Time `json:"deliveredAt,omitempty"`
+	// Secret is the current signing secret of the organization, set on claimed deliveries only
+	Secret string `json:"-"`
+}
+
+// DeliveryAttempt is the outcome of sending a webhook delivery once
+type DeliveryAttempt struct {
+	Status     string
+	StatusCode *int
+	Error      *string
+	// NextAttemptAt is when a PENDING delivery is retried
+	NextAttemptAt time.Time
+	At            time.Time
+}
@@ -18,6 +18,7 @@ import (
 type GroupRepo interface {
 	Insert(ctx context.Context, body []byte) (*model.Group, error)
 	FindByID(ctx context.Context, id string) (*model.Group, error)
+	FindByOrganization(ctx context.Context) ([]model.Group, error)
 }
 
 // GroupRepository is a struct that defines what the repository has
@@ -100,3 +101,39 @@ func (gr *GroupRepository) FindByID(ctx context.Context, id string) (*model.Grou
 
 	return group, nil
 }
+
+// FindByOrganization function that finds all of the groups belonging to the organization in the context
+func (gr *GroupRepository) FindByOrganization(ctx context.Context) ([]model.Group, error) {
+	log := logger.WithContext(ctx)
+	organizationID, ok := ctx.Value(middleware.ContextKeyOrganization).(string)
+	if !ok {
+		log.Error("Failed to extract organization id from context")
+		return nil, errors.New("Failed to extract organization id from context")
+	}
+
+	sb := sqlFlavor.NewSelectBuilder()
+	sb.Select("id, version, created_at, updated_at, info, organization_id")
+	sb.From(`"groups"`)
+	sb.Where(sb.Equal("organization_id", organizationID))
+	sb.OrderBy("created_at")
+
+	q, args := sb.Build()
+
+	rows, err := gr.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := make([]model.Group, 0)
+	groupStruct := sqlbuilder.NewStruct(new(model.Group)).For(sqlFlavor)
+	for rows.Next() {
+		var group model.Group
+		if err := rows.Scan(groupStruct.Addr(&group)...); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, rows.Err()
+}
@@ -97,3 +97,34 @@ func (suite *GroupRepositoryTestSuite) TestFindByID() {
 	assert.NoError(suite.T(), err)
 	assert.Equal(suite.T(), suite.fakeGrp.ID, group.ID)
 }
+
+func (suite *GroupRepositoryTestSuite) TestFindByOrganization() {
+	db, mock := newMock()
+	defer db.Close()
+	repo := NewGroupRepo(db)
+	ctx := context.WithValue(context.Background(), middleware.ContextKeyOrganization, "12345")
+
+	expectedSelectQuery := `SELECT id, version, created_at, updated_at, info, organization_id FROM "groups" WHERE organization_id = \$1 ORDER BY created_at`
+
+	rows := sqlmock.NewRows([]string{"id", "version", "created_at", "updated_at", "info", "organization_id"}).
+		AddRow(suite.fakeGrp.ID, suite.fakeGrp.Version, suite.fakeGrp.CreatedAt, suite.fakeGrp.UpdatedAt, suite.fakeGrp.Info, suite.fakeGrp.OrganizationID).
+		AddRow("67890", suite.fakeGrp.Version, suite.fakeGrp.CreatedAt, suite.fakeGrp.UpdatedAt, suite.fakeGrp.Info, suite.fakeGrp.OrganizationID)
+
+	mock.ExpectQuery(expectedSelectQuery).WithArgs("12345").WillReturnRows(rows)
+
+	groups, err := repo.FindByOrganization(ctx)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), groups, 2)
+	assert.Equal(suite.T(), suite.fakeGrp.ID, groups[0].ID)
+	assert.Equal(suite.T(), "67890", groups[1].ID)
+}
+
+func (suite *GroupRepositoryTestSuite) TestFindByOrganizationMissingOrg() {
+	db, _ := newMock()
+	defer db.Close()
+	repo := NewGroupRepo(db)
+
+	groups, err := repo.FindByOrganization(context.Background())
+	assert.EqualError(suite.T(), err, "Failed to extract organization id from context")
+	assert.Nil(suite.T(), groups)
+}
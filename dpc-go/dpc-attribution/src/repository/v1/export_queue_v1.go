@@ -0,0 +1,196 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/CMSgov/dpc/attribution/model/v1"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/pkg/errors"
+)
+
+// ErrBatchNotOwned is returned when a batch update finds the batch no longer running under the worker's aggregator ID,
+// e.g. because it was restarted as stuck after missing heartbeats
+var ErrBatchNotOwned = errors.New("batch is not running under this aggregator")
+
+// ExportQueue is an interface for the export worker to claim and work job_queue_batch rows
+type ExportQueue interface {
+	ClaimBatch(ctx context.Context, aggregatorID string) (*v1.ExportBatch, error)
+	UpdatePatientIndex(ctx context.Context, batchID string, aggregatorID string, index int) error
+	Heartbeat(ctx context.Context, batchID string, aggregatorID string) error
+	CompleteBatch(ctx context.Context, batch *v1.ExportBatch, aggregatorID string, files []v1.ExportFile) error
+	FailBatch(ctx context.Context, batch *v1.ExportBatch, aggregatorID string, files []v1.ExportFile) error
+	RestartStuckBatches(ctx context.Context, staleBefore time.Time) (int64, error)
+}
+
+// cappedOrgsExpr excludes the organizations already running as many batches as their schedule allows. Workers
+// claiming at the same moment can each see room for one more batch, so a cap can be exceeded briefly.
+const cappedOrgsExpr = `organization_id NOT IN (SELECT r.organization_id FROM job_queue_batch r ` +
+	`JOIN organization_priority s ON s.organization_id = r.organization_id ` +
+	`WHERE r.status = %s AND s.max_concurrent_batches > 0 ` +
+	`GROUP BY r.organization_id, s.max_concurrent_batches HAVING COUNT(*) >= s.max_concurrent_batches)`
+
+// ClaimBatch locks the next QUEUED batch, skipping batches locked by other workers and those of organizations at
+// their concurrency cap, and marks it RUNNING under the aggregator ID. It returns nil when the queue is empty.
+func (jr *JobRepositoryV1) ClaimBatch(ctx context.Context, aggregatorID string) (*v1.ExportBatch, error) {
+	tx, err := jr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sb := sqlFlavor.NewSelectBuilder()
+	sb.Select("batch_id", "job_id", "organization_id", "patients", "resource_types", "type_filter", "elements", "warnings", "since", "transaction_time", "patient_index").
+		From("job_queue_batch").
+		Where(sb.Equal("status", v1.StatusQueued), fmt.Sprintf(cappedOrgsExpr, sb.Var(v1.StatusRunning))).
+		OrderBy("priority ASC", "submit_time ASC").
+		Limit(1).
+		ForUpdate().
+		SQL("SKIP LOCKED")
+	q, args := sb.Build()
+
+	batch := new(v1.ExportBatch)
+	var patients, typeFilter, elements, warnings sql.NullString
+	err = tx.QueryRowContext(ctx, q, args...).Scan(&batch.BatchID, &batch.JobID, &batch.OrganizationID, &patients,
+		&batch.ResourceTypes, &typeFilter, &elements, &warnings, &batch.Since, &batch.TransactionTime, &batch.PatientIndex)
+	if err == sql.ErrNoRows {
+		return nil, tx.Rollback()
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	batch.PatientMBIs = patients.String
+	batch.TypeFilter = typeFilter.String
+	batch.Elements = elements.String
+	if warnings.Valid {
+		batch.Warnings = strings.Split(warnings.String, "\n")
+	}
+
+	now := time.Now()
+	ub := sqlFlavor.NewUpdateBuilder()
+	ub.Update("job_queue_batch").
+		Set(ub.Assign("status", v1.StatusRunning), ub.Assign("aggregator_id", aggregatorID),
+			ub.Assign("start_time", now), ub.Assign("update_time", now)).
+		Where(ub.Equal("batch_id", batch.BatchID))
+	q, args = ub.Build()
+	if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// UpdatePatientIndex records the last processed patient of a running batch, which also counts as a heartbeat
+func (jr *JobRepositoryV1) UpdatePatientIndex(ctx context.Context, batchID string, aggregatorID string, index int) error {
+	ub := sqlFlavor.NewUpdateBuilder()
+	ub.Update("job_queue_batch").
+		Set(ub.Assign("patient_index", index), ub.Assign("update_time", time.Now())).
+		Where(jr.owned(ub, batchID, aggregatorID)...)
+	return jr.execOwned(ctx, ub)
+}
+
+// Heartbeat refreshes the update time of a running batch so it is not restarted as stuck
+func (jr *JobRepositoryV1) Heartbeat(ctx context.Context, batchID string, aggregatorID string) error {
+	ub := sqlFlavor.NewUpdateBuilder()
+	ub.Update("job_queue_batch").
+		Set(ub.Assign("update_time", time.Now())).
+		Where(jr.owned(ub, batchID, aggregatorID)...)
+	return jr.execOwned(ctx, ub)
+}
+
+// CompleteBatch saves the batch files and marks the batch COMPLETED within a single transaction
+func (jr *JobRepositoryV1) CompleteBatch(ctx context.Context, batch *v1.ExportBatch, aggregatorID string, files []v1.ExportFile) error {
+	return jr.finishBatch(ctx, batch, aggregatorID, files, v1.StatusCompleted)
+}
+
+// FailBatch saves the files written before the batch failed, including the OperationOutcome entries for the patients
+// it did not export, and marks the batch FAILED within a single transaction
+func (jr *JobRepositoryV1) FailBatch(ctx context.Context, batch *v1.ExportBatch, aggregatorID string, files []v1.ExportFile) error {
+	return jr.finishBatch(ctx, batch, aggregatorID, files, v1.StatusFailed)
+}
+
+func (jr *JobRepositoryV1) finishBatch(ctx context.Context, batch *v1.ExportBatch, aggregatorID string, files []v1.ExportFile, status int) error {
+	tx, err := jr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		code, ok := v1.ResourceTypeCode(f.ResourceType)
+		if !ok {
+			_ = tx.Rollback()
+			return errors.Errorf("unsupported resource type %s", f.ResourceType)
+		}
+		ib := sqlFlavor.NewInsertBuilder()
+		ib.InsertInto("job_queue_batch_file")
+		ib.Cols("batch_id", "job_id", "resource_type", "sequence", "file_name", "count", "checksum", "file_length", "compressed_checksum", "compressed_file_length")
+		ib.Values(batch.BatchID, batch.JobID, code, f.Sequence, f.FileName, f.Count, f.Checksum, f.FileLength, f.CompressedChecksum, f.CompressedFileLength)
+		q, args := ib.Build()
+		if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	now := time.Now()
+	ub := sqlFlavor.NewUpdateBuilder()
+	ub.Update("job_queue_batch").
+		Set(ub.Assign("status", status), ub.Assign("complete_time", now), ub.Assign("update_time", now)).
+		Where(jr.owned(ub, batch.BatchID, aggregatorID)...)
+	q, args := ub.Build()
+	res, err := tx.ExecContext(ctx, q, args...)
+	if err == nil {
+		err = checkOwned(res)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// RestartStuckBatches requeues RUNNING batches whose last heartbeat is older than staleBefore, keeping their patient
+// index so they resume where they stopped. A worker without the files of the previous attempt starts the batch over.
+func (jr *JobRepositoryV1) RestartStuckBatches(ctx context.Context, staleBefore time.Time) (int64, error) {
+	ub := sqlFlavor.NewUpdateBuilder()
+	ub.Update("job_queue_batch").
+		Set(ub.Assign("status", v1.StatusQueued), "aggregator_id = NULL").
+		Where(ub.Equal("status", v1.StatusRunning), ub.LessThan("update_time", staleBefore))
+	q, args := ub.Build()
+	res, err := jr.db.ExecContext(ctx, q, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (jr *JobRepositoryV1) owned(ub *sqlbuilder.UpdateBuilder, batchID string, aggregatorID string) []string {
+	return []string{ub.Equal("batch_id", batchID), ub.Equal("aggregator_id", aggregatorID), ub.Equal("status", v1.StatusRunning)}
+}
+
+func (jr *JobRepositoryV1) execOwned(ctx context.Context, ub *sqlbuilder.UpdateBuilder) error {
+	q, args := ub.Build()
+	res, err := jr.db.ExecContext(ctx, q, args...)
+	if err != nil {
+		return err
+	}
+	return checkOwned(res)
+}
+
+func checkOwned(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrBatchNotOwned
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	v1 "github.com/CMSgov/dpc/attribution/model/v1"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ExportQueueV1TestSuite struct {
+	suite.Suite
+}
+
+func TestExportQueueV1TestSuite(t *testing.T) {
+	suite.Run(t, new(ExportQueueV1TestSuite))
+}
+
+const expectedClaimQuery = `SELECT batch_id, job_id, organization_id, patients, resource_types, type_filter, elements, warnings, since, transaction_time, patient_index FROM job_queue_batch WHERE status = \$1 AND organization_id NOT IN \(SELECT r.organization_id FROM job_queue_batch r ` +
+	`JOIN organization_priority s ON s.organization_id = r.organization_id WHERE r.status = \$2 AND s.max_concurrent_batches > 0 ` +
+	`GROUP BY r.organization_id, s.max_concurrent_batches HAVING COUNT\(\*\) >= s.max_concurrent_batches\) ORDER BY priority ASC, submit_time ASC LIMIT 1 FOR UPDATE SKIP LOCKED`
+
+func (suite *ExportQueueV1TestSuite) TestClaimBatch() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	tt := time.Now()
+
+	mock.ExpectBegin()
+	rows := sqlmock.NewRows([]string{"batch_id", "job_id", "organization_id", "patients", "resource_types", "type_filter", "elements", "warnings", "since", "transaction_time", "patient_index"}).
+		AddRow("batch-1", "job-1", "org-1", "mbi-1,mbi-2", "Patient,Coverage", "ExplanationOfBenefit?type=carrier%2Cdme", "Patient.name,status", "first warning\nsecond warning", nil, tt, nil)
+	mock.ExpectQuery(expectedClaimQuery).WithArgs(v1.StatusQueued, v1.StatusRunning).WillReturnRows(rows)
+	mock.ExpectExec(`UPDATE job_queue_batch SET status = \$1, aggregator_id = \$2, start_time = \$3, update_time = \$4 WHERE batch_id = \$5`).
+		WithArgs(v1.StatusRunning, "agg-1", sqlmock.AnyArg(), sqlmock.AnyArg(), "batch-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	batch, err := repo.ClaimBatch(context.Background(), "agg-1")
+
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+	assert.Equal(suite.T(), "job-1", batch.JobID)
+	assert.Equal(suite.T(), []string{"mbi-1", "mbi-2"}, batch.Patients())
+	assert.Equal(suite.T(), []string{"Patient", "Coverage"}, batch.Types())
+	assert.Equal(suite.T(), 0, batch.NextPatient())
+	filters := batch.Filters("ExplanationOfBenefit")
+	assert.Len(suite.T(), filters, 1)
+	assert.Equal(suite.T(), "carrier,dme", filters[0].Get("type"))
+	assert.Empty(suite.T(), batch.Filters("Patient"))
+	assert.Equal(suite.T(), []string{"name", "status"}, batch.ElementsFor("Patient"))
+	assert.Equal(suite.T(), []string{"status"}, batch.ElementsFor("Coverage"))
+	assert.Equal(suite.T(), []string{"first warning", "second warning"}, batch.Warnings)
+}
+
+func (suite *ExportQueueV1TestSuite) TestClaimBatchEmptyQueue() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(expectedClaimQuery).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	batch, err := repo.ClaimBatch(context.Background(), "agg-1")
+
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), batch)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
+
+func (suite *ExportQueueV1TestSuite) TestUpdatePatientIndexNotOwned() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+
+	mock.ExpectExec(`UPDATE job_queue_batch SET patient_index = \$1, update_time = \$2 WHERE batch_id = \$3 AND aggregator_id = \$4 AND status = \$5`).
+		WithArgs(3, sqlmock.AnyArg(), "batch-1", "agg-1", v1.StatusRunning).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := repo.UpdatePatientIndex(context.Background(), "batch-1", "agg-1", 3)
+
+	assert.ErrorIs(suite.T(), err, ErrBatchNotOwned)
+}
+
+func (suite *ExportQueueV1TestSuite) TestCompleteBatch() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	batch := &v1.ExportBatch{BatchID: "batch-1", JobID: "job-1"}
+	files := []v1.ExportFile{{ResourceType: "Patient", Sequence: 0, FileName: "batch-1-0.patient", Count: 2, Checksum: []byte{1, 2}, FileLength: 10,
+		CompressedChecksum: []byte{3, 4}, CompressedFileLength: 4}}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO job_queue_batch_file \(batch_id, job_id, resource_type, sequence, file_name, count, checksum, file_length, compressed_checksum, compressed_file_length\)`).
+		WithArgs("batch-1", "job-1", 7, 0, "batch-1-0.patient", 2, []byte{1, 2}, int64(10), []byte{3, 4}, int64(4)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE job_queue_batch SET status = \$1, complete_time = \$2, update_time = \$3 WHERE batch_id = \$4 AND aggregator_id = \$5 AND status = \$6`).
+		WithArgs(v1.StatusCompleted, sqlmock.AnyArg(), sqlmock.AnyArg(), "batch-1", "agg-1", v1.StatusRunning).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := repo.CompleteBatch(context.Background(), batch, "agg-1", files)
+
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
+
+func (suite *ExportQueueV1TestSuite) TestFailBatch() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	batch := &v1.ExportBatch{BatchID: "batch-1", JobID: "job-1"}
+	files := []v1.ExportFile{{ResourceType: "OperationOutcome", Sequence: 0, FileName: "batch-1-0.operationoutcome", Count: 3, Checksum: []byte{3}, FileLength: 30}}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO job_queue_batch_file`).
+		WithArgs("batch-1", "job-1", 5, 0, "batch-1-0.operationoutcome", 3, []byte{3}, int64(30), []byte(nil), int64(0)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE job_queue_batch SET status = \$1, complete_time = \$2, update_time = \$3 WHERE batch_id = \$4 AND aggregator_id = \$5 AND status = \$6`).
+		WithArgs(v1.StatusFailed, sqlmock.AnyArg(), sqlmock.AnyArg(), "batch-1", "agg-1", v1.StatusRunning).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err := repo.FailBatch(context.Background(), batch, "agg-1", files)
+
+	assert.ErrorIs(suite.T(), err, ErrBatchNotOwned)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
+
+func (suite *ExportQueueV1TestSuite) TestRestartStuckBatches() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	staleBefore := time.Now()
+
+	mock.ExpectExec(`UPDATE job_queue_batch SET status = \$1, aggregator_id = NULL WHERE status = \$2 AND update_time < \$3`).
+		WithArgs(v1.StatusQueued, v1.StatusRunning, staleBefore).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	n, err := repo.RestartStuckBatches(context.Background(), staleBefore)
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(2), n)
+}
@@ -0,0 +1,233 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/CMSgov/dpc/attribution/model/v1"
+	"github.com/pkg/errors"
+)
+
+// ErrExportScheduleNotFound is returned when an export schedule does not exist for the organization
+var ErrExportScheduleNotFound = errors.New("export schedule not found")
+
+// ExportScheduleRepo is an interface for the export schedule service to manage the export schedules of an organization
+type ExportScheduleRepo interface {
+	FindExportSchedules(ctx context.Context, orgID string) ([]v1.ExportSchedule, error)
+	FindExportSchedule(ctx context.Context, orgID string, id string) (*v1.ExportSchedule, error)
+	InsertExportSchedule(ctx context.Context, schedule v1.ExportSchedule) error
+	UpdateExportSchedule(ctx context.Context, schedule v1.ExportSchedule) error
+	DeleteExportSchedule(ctx context.Context, orgID string, id string) error
+}
+
+// ExportScheduleQueue is an interface for the export schedule runner to enqueue the jobs of due schedules
+type ExportScheduleQueue interface {
+	ClaimDueSchedules(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]v1.ExportSchedule, error)
+	RecordScheduleRun(ctx context.Context, id string, jobID *string, ranAt time.Time, nextRunAt time.Time) error
+}
+
+var exportScheduleCols = []string{"id", "organization_id", "group_id", "frequency", "start_at", "next_run_at", "resource_types",
+	"since", "webhook_url", "last_run_at", "last_job_id", "created_at", "updated_at"}
+
+// FindExportSchedules returns the export schedules of the organization, oldest first
+func (jr *JobRepositoryV1) FindExportSchedules(ctx context.Context, orgID string) ([]v1.ExportSchedule, error) {
+	sb := sqlFlavor.NewSelectBuilder()
+	sb.Select(exportScheduleCols...).
+		From("export_schedule").
+		Where(sb.Equal("organization_id", orgID)).
+		OrderBy("created_at")
+	q, args := sb.Build()
+
+	rows, err := jr.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := make([]v1.ExportSchedule, 0)
+	for rows.Next() {
+		s, err := scanExportSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, *s)
+	}
+	return schedules, rows.Err()
+}
+
+// FindExportSchedule returns an export schedule of the organization, or ErrExportScheduleNotFound
+func (jr *JobRepositoryV1) FindExportSchedule(ctx context.Context, orgID string, id string) (*v1.ExportSchedule, error) {
+	sb := sqlFlavor.NewSelectBuilder()
+	sb.Select(exportScheduleCols...).
+		From("export_schedule").
+		Where(sb.Equal("organization_id", orgID), sb.Equal("id", id))
+	q, args := sb.Build()
+
+	s, err := scanExportSchedule(jr.db.QueryRowContext(ctx, q, args...))
+	if err == sql.ErrNoRows {
+		return nil, ErrExportScheduleNotFound
+	}
+	return s, err
+}
+
+// InsertExportSchedule saves a new export schedule
+func (jr *JobRepositoryV1) InsertExportSchedule(ctx context.Context, s v1.ExportSchedule) error {
+	ib := sqlFlavor.NewInsertBuilder()
+	ib.InsertInto("export_schedule").
+		Cols("id", "organization_id", "group_id", "frequency", "start_at", "next_run_at", "resource_types", "since",
+			"webhook_url", "created_at", "updated_at").
+		Values(s.ID, s.OrganizationID, s.GroupID, s.Frequency, s.StartAt, s.NextRunAt, s.Type, nullTime(s.Since),
+			sql.NullString{String: s.WebhookURL, Valid: s.WebhookURL != ""}, s.CreatedAt, s.UpdatedAt)
+	q, args := ib.Build()
+	_, err := jr.db.ExecContext(ctx, q, args...)
+	return err
+}
+
+// UpdateExportSchedule replaces the settings of an export schedule of the organization, or returns
+// ErrExportScheduleNotFound. Its run history is kept.
+func (jr *JobRepositoryV1) UpdateExportSchedule(ctx context.Context, s v1.ExportSchedule) error {
+	ub := sqlFlavor.NewUpdateBuilder()
+	ub.Update("export_schedule").
+		Set(ub.Assign("group_id", s.GroupID),
+			ub.Assign("frequency", s.Frequency),
+			ub.Assign("start_at", s.StartAt),
+			ub.Assign("next_run_at", s.NextRunAt),
+			ub.Assign("resource_types", s.Type),
+			ub.Assign("since", nullTime(s.Since)),
+			ub.Assign("webhook_url", sql.NullString{String: s.WebhookURL, Valid: s.WebhookURL != ""}),
+			ub.Assign("updated_at", s.UpdatedAt)).
+		Where(ub.Equal("organization_id", s.OrganizationID), ub.Equal("id", s.ID))
+	q, args := ub.Build()
+	return execExportSchedule(ctx, jr.db, q, args)
+}
+
+// DeleteExportSchedule removes an export schedule of the organization, or returns ErrExportScheduleNotFound. The
+// jobs it already enqueued are kept.
+func (jr *JobRepositoryV1) DeleteExportSchedule(ctx context.Context, orgID string, id string) error {
+	db := sqlFlavor.NewDeleteBuilder()
+	db.DeleteFrom("export_schedule").
+		Where(db.Equal("organization_id", orgID), db.Equal("id", id))
+	q, args := db.Build()
+	return execExportSchedule(ctx, jr.db, q, args)
+}
+
+// ClaimDueSchedules locks up to limit schedules whose next run is due, skipping those locked by other runners, and
+// leases them until the given time so they are not run twice. A schedule whose runner stops or fails before
+// recording the run is retried once the lease runs out.
+func (jr *JobRepositoryV1) ClaimDueSchedules(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]v1.ExportSchedule, error) {
+	tx, err := jr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sb := sqlFlavor.NewSelectBuilder()
+	sb.Select(exportScheduleCols...).
+		From("export_schedule").
+		Where(sb.LessEqualThan("next_run_at", now)).
+		OrderBy("next_run_at").
+		Limit(limit).
+		ForUpdate().
+		SQL("SKIP LOCKED")
+	q, args := sb.Build()
+
+	rows, err := tx.QueryContext(ctx, q, args...)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	schedules := make([]v1.ExportSchedule, 0)
+	ids := make([]interface{}, 0)
+	for rows.Next() {
+		s, err := scanExportSchedule(rows)
+		if err != nil {
+			_ = rows.Close()
+			_ = tx.Rollback()
+			return nil, err
+		}
+		schedules = append(schedules, *s)
+		ids = append(ids, s.ID)
+	}
+	_ = rows.Close()
+	if len(schedules) == 0 {
+		return schedules, tx.Rollback()
+	}
+
+	ub := sqlFlavor.NewUpdateBuilder()
+	ub.Update("export_schedule").
+		Set(ub.Assign("next_run_at", leaseUntil)).
+		Where(ub.In("id", ids...))
+	q, args = ub.Build()
+	if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// RecordScheduleRun saves when the schedule ran, the job the run enqueued, if any, and when the schedule runs next
+func (jr *JobRepositoryV1) RecordScheduleRun(ctx context.Context, id string, jobID *string, ranAt time.Time, nextRunAt time.Time) error {
+	ub := sqlFlavor.NewUpdateBuilder()
+	ub.Update("export_schedule").
+		Set(ub.Assign("last_run_at", ranAt),
+			ub.Assign("next_run_at", nextRunAt))
+	if jobID != nil {
+		ub.SetMore(ub.Assign("last_job_id", *jobID))
+	}
+	ub.Where(ub.Equal("id", id))
+	q, args := ub.Build()
+	_, err := jr.db.ExecContext(ctx, q, args...)
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanExportSchedule(row rowScanner) (*v1.ExportSchedule, error) {
+	s := new(v1.ExportSchedule)
+	var since, lastRunAt sql.NullTime
+	var webhookURL, lastJobID sql.NullString
+	if err := row.Scan(&s.ID, &s.OrganizationID, &s.GroupID, &s.Frequency, &s.StartAt, &s.NextRunAt, &s.Type, &since,
+		&webhookURL, &lastRunAt, &lastJobID, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if since.Valid {
+		s.Since = &since.Time
+	}
+	if lastRunAt.Valid {
+		s.LastRunAt = &lastRunAt.Time
+	}
+	if lastJobID.Valid {
+		s.LastJobID = &lastJobID.String
+	}
+	s.WebhookURL = webhookURL.String
+	return s, nil
+}
+
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
+// execExportSchedule runs a statement on a single export schedule, which must exist
+func execExportSchedule(ctx context.Context, db *sql.DB, q string, args []interface{}) error {
+	res, err := db.ExecContext(ctx, q, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrExportScheduleNotFound
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	v1 "github.com/CMSgov/dpc/attribution/model/v1"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ExportScheduleV1TestSuite struct {
+	suite.Suite
+}
+
+func TestExportScheduleV1TestSuite(t *testing.T) {
+	suite.Run(t, new(ExportScheduleV1TestSuite))
+}
+
+const exportScheduleSelect = `SELECT id, organization_id, group_id, frequency, start_at, next_run_at, resource_types, since, ` +
+	`webhook_url, last_run_at, last_job_id, created_at, updated_at FROM export_schedule `
+
+func exportScheduleRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "organization_id", "group_id", "frequency", "start_at", "next_run_at", "resource_types",
+		"since", "webhook_url", "last_run_at", "last_job_id", "created_at", "updated_at"})
+}
+
+func (suite *ExportScheduleV1TestSuite) TestFindExportSchedules() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	now := time.Now()
+
+	rows := exportScheduleRows().
+		AddRow("s-1", "org-1", "g-1", v1.FrequencyDaily, now, now, "Patient", nil, nil, nil, nil, now, now).
+		AddRow("s-2", "org-1", "g-2", v1.FrequencyWeekly, now, now, "Patient,Coverage", now, "https://example.com/hook", now, "job-1", now, now)
+	mock.ExpectQuery(exportScheduleSelect + `WHERE organization_id = \$1 ORDER BY created_at`).WithArgs("org-1").WillReturnRows(rows)
+
+	schedules, err := repo.FindExportSchedules(context.Background(), "org-1")
+
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+	assert.Len(suite.T(), schedules, 2)
+	assert.Nil(suite.T(), schedules[0].Since)
+	assert.Nil(suite.T(), schedules[0].LastJobID)
+	assert.Empty(suite.T(), schedules[0].WebhookURL)
+	assert.Equal(suite.T(), "https://example.com/hook", schedules[1].WebhookURL)
+	assert.Equal(suite.T(), "job-1", *schedules[1].LastJobID)
+	assert.Equal(suite.T(), now, *schedules[1].LastRunAt)
+}
+
+func (suite *ExportScheduleV1TestSuite) TestFindExportSchedule() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	now := time.Now()
+
+	query := exportScheduleSelect + `WHERE organization_id = \$1 AND id = \$2`
+	mock.ExpectQuery(query).WithArgs("org-1", "s-1").
+		WillReturnRows(exportScheduleRows().AddRow("s-1", "org-1", "g-1", v1.FrequencyMonthly, now, now, "Patient", nil, nil, nil, nil, now, now))
+	mock.ExpectQuery(query).WithArgs("org-1", "s-2").WillReturnError(sql.ErrNoRows)
+
+	schedule, err := repo.FindExportSchedule(context.Background(), "org-1", "s-1")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), v1.FrequencyMonthly, schedule.Frequency)
+
+	schedule, err = repo.FindExportSchedule(context.Background(), "org-1", "s-2")
+	assert.Equal(suite.T(), ErrExportScheduleNotFound, err)
+	assert.Nil(suite.T(), schedule)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
+
+func (suite *ExportScheduleV1TestSuite) TestInsertExportSchedule() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	now := time.Now()
+	schedule := v1.ExportSchedule{ID: "s-1", OrganizationID: "org-1", GroupID: "g-1", Frequency: v1.FrequencyDaily, StartAt: now,
+		NextRunAt: now, Type: "Patient", CreatedAt: now, UpdatedAt: now}
+
+	mock.ExpectExec(`INSERT INTO export_schedule \(id, organization_id, group_id, frequency, start_at, next_run_at, resource_types, since, `+
+		`webhook_url, created_at, updated_at\) VALUES \(\$1, \$2, \$3, \$4, \$5, \$6, \$7, \$8, \$9, \$10, \$11\)`).
+		WithArgs("s-1", "org-1", "g-1", v1.FrequencyDaily, now, now, "Patient", sql.NullTime{}, sql.NullString{}, now, now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(suite.T(), repo.InsertExportSchedule(context.Background(), schedule))
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
+
+func (suite *ExportScheduleV1TestSuite) TestUpdateExportSchedule() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	now := time.Now()
+	schedule := v1.ExportSchedule{ID: "s-1", OrganizationID: "org-1", GroupID: "g-1", Frequency: v1.FrequencyWeekly, StartAt: now,
+		NextRunAt: now, Type: "Patient", Since: &now, WebhookURL: "https://example.com/hook", UpdatedAt: now}
+
+	query := `UPDATE export_schedule SET group_id = \$1, frequency = \$2, start_at = \$3, next_run_at = \$4, resource_types = \$5, ` +
+		`since = \$6, webhook_url = \$7, updated_at = \$8 WHERE organization_id = \$9 AND id = \$10`
+	mock.ExpectExec(query).
+		WithArgs("g-1", v1.FrequencyWeekly, now, now, "Patient", sql.NullTime{Time: now, Valid: true},
+			sql.NullString{String: "https://example.com/hook", Valid: true}, now, "org-1", "s-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(suite.T(), repo.UpdateExportSchedule(context.Background(), schedule))
+	assert.Equal(suite.T(), ErrExportScheduleNotFound, repo.UpdateExportSchedule(context.Background(), schedule))
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
+
+func (suite *ExportScheduleV1TestSuite) TestDeleteExportSchedule() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+
+	query := `DELETE FROM export_schedule WHERE organization_id = \$1 AND id = \$2`
+	mock.ExpectExec(query).WithArgs("org-1", "s-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(query).WithArgs("org-1", "s-2").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(suite.T(), repo.DeleteExportSchedule(context.Background(), "org-1", "s-1"))
+	assert.Equal(suite.T(), ErrExportScheduleNotFound, repo.DeleteExportSchedule(context.Background(), "org-1", "s-2"))
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
+
+const claimSchedulesQuery = exportScheduleSelect + `WHERE next_run_at <= \$1 ORDER BY next_run_at LIMIT 10 FOR UPDATE SKIP LOCKED`
+
+func (suite *ExportScheduleV1TestSuite) TestClaimDueSchedules() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	now := time.Now()
+	lease := now.Add(time.Minute)
+
+	rows := exportScheduleRows().
+		AddRow("s-1", "org-1", "g-1", v1.FrequencyDaily, now, now, "Patient", nil, nil, nil, nil, now, now).
+		AddRow("s-2", "org-2", "g-2", v1.FrequencyDaily, now, now, "Patient", nil, nil, nil, nil, now, now)
+	mock.ExpectBegin()
+	mock.ExpectQuery(claimSchedulesQuery).WithArgs(now).WillReturnRows(rows)
+	mock.ExpectExec(`UPDATE export_schedule SET next_run_at = \$1 WHERE id IN \(\$2, \$3\)`).
+		WithArgs(lease, "s-1", "s-2").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	schedules, err := repo.ClaimDueSchedules(context.Background(), now, lease, 10)
+
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+	assert.Len(suite.T(), schedules, 2)
+	assert.Equal(suite.T(), "org-2", schedules[1].OrganizationID)
+}
+
+func (suite *ExportScheduleV1TestSuite) TestClaimDueSchedulesNoneDue() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(claimSchedulesQuery).WithArgs(now).WillReturnRows(exportScheduleRows())
+	mock.ExpectRollback()
+
+	schedules, err := repo.ClaimDueSchedules(context.Background(), now, now.Add(time.Minute), 10)
+
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+	assert.Empty(suite.T(), schedules)
+}
+
+func (suite *ExportScheduleV1TestSuite) TestRecordScheduleRun() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	ranAt := time.Now()
+	next := ranAt.AddDate(0, 0, 1)
+	jobID := "job-1"
+
+	mock.ExpectExec(`UPDATE export_schedule SET last_run_at = \$1, next_run_at = \$2, last_job_id = \$3 WHERE id = \$4`).
+		WithArgs(ranAt, next, "job-1", "s-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE export_schedule SET last_run_at = \$1, next_run_at = \$2 WHERE id = \$3`).
+		WithArgs(ranAt, next, "s-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(suite.T(), repo.RecordScheduleRun(context.Background(), "s-1", &jobID, ranAt, next))
+	assert.NoError(suite.T(), repo.RecordScheduleRun(context.Background(), "s-1", nil, ranAt, next))
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
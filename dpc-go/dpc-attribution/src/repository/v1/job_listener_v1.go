@@ -0,0 +1,58 @@
+package v1
+
+import (
+	"context"
+
+	"github.com/CMSgov/dpc/attribution/conf"
+	"github.com/jackc/pgx"
+)
+
+// BatchFinishedChannel is the channel the job_queue_batch trigger notifies with the job_id of each batch that
+// completes, fails or is cancelled
+const BatchFinishedChannel = "job_batch_finished"
+
+// JobListener is an interface for test mocking purposes
+type JobListener interface {
+	WaitForFinishedBatch(ctx context.Context) (string, error)
+}
+
+// JobListenerV1 listens for finished batches on a connection of its own, as a LISTEN holds the connection for as
+// long as it is listening
+type JobListenerV1 struct {
+	config pgx.ConnConfig
+	conn   *pgx.Conn
+}
+
+// NewJobListener creates a JobListenerV1 for the queue db, it connects on the first wait
+func NewJobListener() (*JobListenerV1, error) {
+	config, err := pgx.ParseConnectionString(conf.GetAsString("db.queueUrl"))
+	if err != nil {
+		return nil, err
+	}
+	return &JobListenerV1{
+		config: config,
+	}, nil
+}
+
+// WaitForFinishedBatch blocks until a batch finishes and returns the id of its job. After an error the connection
+// is closed and the next wait reconnects, notifications sent in between are lost.
+func (jl *JobListenerV1) WaitForFinishedBatch(ctx context.Context) (string, error) {
+	if jl.conn == nil {
+		conn, err := pgx.Connect(jl.config)
+		if err != nil {
+			return "", err
+		}
+		if err := conn.Listen(BatchFinishedChannel); err != nil {
+			_ = conn.Close()
+			return "", err
+		}
+		jl.conn = conn
+	}
+	n, err := jl.conn.WaitForNotification(ctx)
+	if err != nil {
+		_ = jl.conn.Close()
+		jl.conn = nil
+		return "", err
+	}
+	return n.Payload, nil
+}
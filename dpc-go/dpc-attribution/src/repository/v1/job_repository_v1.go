@@ -3,6 +3,7 @@ package v1
 import (
 	"context"
 	"database/sql"
+	"strings"
 	"time"
 
 	"github.com/CMSgov/dpc/attribution/logger"
@@ -18,10 +19,24 @@ import (
 type JobRepo interface {
 	GetFileInfo(ctx context.Context, orgID string, fileName string) (*v1.FileInfo, error)
 	Insert(ctx context.Context, orgID string, batches []v1.BatchRequest) (*string, error)
+	InsertUnlessDuplicate(ctx context.Context, orgID string, batches []v1.BatchRequest, dedupe v1.JobDedupe) (*string, bool, error)
+	FindDuplicateJob(ctx context.Context, orgID string, dedupe v1.JobDedupe) (*string, error)
 	FindBatchesByJobID(id string, orgID string) ([]v1.JobQueueBatch, error)
 	FindBatchFilesByBatchID(id string) ([]v1.JobQueueBatchFile, error)
+	CancelJob(ctx context.Context, jobID string, orgID string) ([]string, error)
+	FindJobs(ctx context.Context, orgID string, filter v1.JobFilter) (*v1.JobList, error)
+	FindLastGroupExport(ctx context.Context, orgID string, er v1.ExportRequest) (*v1.GroupExport, error)
 }
 
+// ErrJobNotFound is returned when a job does not exist for the organization or was already cancelled
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrIdempotencyKeyReused is returned when an idempotency key is given again for a different export request
+var ErrIdempotencyKeyReused = errors.New("idempotency key was used for a different request")
+
+// ErrFilePurged is returned for a file the retention sweeper has deleted
+var ErrFilePurged = errors.New("file purged")
+
 // JobRepositoryV1 is a struct that defines what the repository has
 type JobRepositoryV1 struct {
 	db *sql.DB
@@ -42,31 +57,145 @@ func (jr *JobRepositoryV1) Insert(ctx context.Context, orgID string, batches []v
 	if err != nil {
 		return nil, err
 	}
+	jobID, err := insertBatches(ctx, tx, orgID, batches, v1.JobDedupe{})
+	if err != nil {
+		err2 := tx.Rollback()
+		if err2 != nil {
+			return nil, err2
+		}
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return jobID, nil
+}
+
+// InsertUnlessDuplicate saves the batches of a new job, unless the organization already has a job for the same
+// idempotency key or an identical one that is unfinished or freshly completed. The id of that job is returned
+// instead, along with true. Kickoffs of the organization are serialized by an advisory lock, so that concurrent
+// retries cannot both insert a job.
+func (jr *JobRepositoryV1) InsertUnlessDuplicate(ctx context.Context, orgID string, batches []v1.BatchRequest, dedupe v1.JobDedupe) (*string, bool, error) {
+	tx, err := jr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", orgID); err != nil {
+		_ = tx.Rollback()
+		return nil, false, err
+	}
+
+	existing, err := findDuplicateJob(ctx, tx, orgID, dedupe)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, false, err
+	}
+	if existing != nil {
+		_ = tx.Rollback()
+		return existing, true, nil
+	}
+
+	jobID, err := insertBatches(ctx, tx, orgID, batches, dedupe)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+	return jobID, false, nil
+}
+
+// FindDuplicateJob returns the job a kickoff would be deduplicated to, or nil when it would start a new one. It does
+// not take the kickoff lock, so a kickoff that finds nothing must still insert with InsertUnlessDuplicate.
+func (jr *JobRepositoryV1) FindDuplicateJob(ctx context.Context, orgID string, dedupe v1.JobDedupe) (*string, error) {
+	return findDuplicateJob(ctx, jr.db, orgID, dedupe)
+}
+
+func insertBatches(ctx context.Context, tx *sql.Tx, orgID string, batches []v1.BatchRequest, dedupe v1.JobDedupe) (*string, error) {
 	jobID := uuid.New().String()
 	for _, b := range batches {
 		s, _ := b.Since.Value()
 		ib := sqlFlavor.NewInsertBuilder()
 		ib.InsertInto("job_queue_batch")
 		ib.Cols("batch_id", "job_id", "organization_id", "organization_npi", "provider_npi", "patients", "resource_types", "since",
-			"priority", "transaction_time", "status", "submit_time", "request_url", "requesting_ip", "is_bulk")
+			"priority", "transaction_time", "status", "submit_time", "request_url", "requesting_ip", "is_bulk", "type_filter", "elements", "warnings", "webhook_url",
+			"request_fingerprint", "idempotency_key", "schedule_id", "group_id", "since_auto")
 		batchID := uuid.New().String()
 		ib.Values(batchID, jobID, orgID, b.OrganizationNPI, b.ProviderNPI, b.PatientMBIs, b.ResourceTypes, s,
-			b.Priority, b.TransactionTime, 0, time.Now(), b.RequestURL, b.RequestingIP, b.IsBulk)
+			b.Priority, b.TransactionTime, 0, time.Now(), b.RequestURL, b.RequestingIP, b.IsBulk,
+			sql.NullString{String: b.TypeFilter, Valid: b.TypeFilter != ""}, sql.NullString{String: b.Elements, Valid: b.Elements != ""},
+			sql.NullString{String: b.Warnings, Valid: b.Warnings != ""}, sql.NullString{String: b.WebhookURL, Valid: b.WebhookURL != ""},
+			sql.NullString{String: dedupe.Fingerprint, Valid: dedupe.Fingerprint != ""},
+			sql.NullString{String: dedupe.IdempotencyKey, Valid: dedupe.IdempotencyKey != ""},
+			sql.NullString{String: b.ScheduleID, Valid: b.ScheduleID != ""},
+			sql.NullString{String: b.GroupID, Valid: b.GroupID != ""}, b.SinceAuto)
 		q, args := ib.Build()
-		_, err = tx.ExecContext(ctx, q, args...)
-		if err != nil {
-			err2 := tx.Rollback()
-			if err2 != nil {
-				return nil, err2
+		if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+			return nil, err
+		}
+	}
+	return &jobID, nil
+}
+
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// findDuplicateJob returns the job of the idempotency key or, without a key, the latest identical job that is
+// unfinished or was completed since dedupe.FreshSince. A key that was used for a different request is an error.
+func findDuplicateJob(ctx context.Context, tx rowQuerier, orgID string, dedupe v1.JobDedupe) (*string, error) {
+	if dedupe.IdempotencyKey != "" {
+		sb := sqlFlavor.NewSelectBuilder()
+		sb.Select("job_id", "MAX(request_fingerprint)").
+			From("job_queue_batch").
+			Where(sb.Equal("organization_id", orgID), sb.Equal("idempotency_key", dedupe.IdempotencyKey),
+				sb.GreaterEqualThan("submit_time", dedupe.KeysSince)).
+			GroupBy("job_id").
+			OrderBy("MIN(submit_time) DESC").Limit(1)
+		q, args := sb.Build()
+		var jobID string
+		var fingerprint sql.NullString
+		err := tx.QueryRowContext(ctx, q, args...).Scan(&jobID, &fingerprint)
+		if err == nil {
+			if fingerprint.String != dedupe.Fingerprint {
+				return nil, ErrIdempotencyKeyReused
 			}
+			return &jobID, nil
+		}
+		if err != sql.ErrNoRows {
 			return nil, err
 		}
 	}
-	err = tx.Commit()
+
+	inner := sqlFlavor.NewSelectBuilder()
+	inner.Select("job_id",
+		inner.As(jobStatusExpr, "job_status"),
+		inner.As("MIN(submit_time)", "submit_time"),
+		inner.As("MAX(complete_time)", "complete_time")).
+		From("job_queue_batch").
+		Where(inner.Equal("organization_id", orgID), inner.Equal("request_fingerprint", dedupe.Fingerprint)).
+		GroupBy("job_id")
+
+	sb := sqlFlavor.NewSelectBuilder()
+	sb.Select("job_id").
+		From(sb.BuilderAs(inner, "jobs")).
+		Where(sb.Or(
+			sb.In("job_status", v1.StatusQueued, v1.StatusRunning),
+			sb.And(sb.Equal("job_status", v1.StatusCompleted), sb.GreaterEqualThan("complete_time", dedupe.FreshSince)),
+		)).
+		OrderBy("submit_time DESC").Limit(1)
+	q, args := sb.Build()
+	var jobID string
+	err := tx.QueryRowContext(ctx, q, args...).Scan(&jobID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-
 	return &jobID, nil
 }
 
@@ -97,7 +226,7 @@ func (jr *JobRepositoryV1) FindBatchesByJobID(id string, orgID string) ([]v1.Job
 // FindBatchFilesByBatchID function that returns the batch files by batch id
 func (jr *JobRepositoryV1) FindBatchFilesByBatchID(id string) ([]v1.JobQueueBatchFile, error) {
 	sb := sqlFlavor.NewSelectBuilder()
-	q, args := sb.Select("resource_type", "batch_id", "sequence", "file_name", "count", "checksum", "file_length").
+	q, args := sb.Select("resource_type", "batch_id", "sequence", "file_name", "count", "checksum", "file_length", "compressed_checksum", "compressed_file_length", "purged_at").
 		From("job_queue_batch_file").
 		Where(sb.Equal("batch_id", id)).
 		Build()
@@ -123,7 +252,7 @@ func (jr *JobRepositoryV1) GetFileInfo(ctx context.Context, orgID string, fileNa
 	log := logger.WithContext(ctx)
 
 	sb := sqlFlavor.NewSelectBuilder()
-	sb.Select("f.job_id, b.start_time, f.file_length, f.checksum")
+	sb.Select("f.job_id, b.start_time, f.file_length, f.checksum, f.compressed_file_length, f.compressed_checksum, f.purged_at")
 	sb.From("job_queue_batch_file f")
 	sb.JoinWithOption(sqlbuilder.LeftJoin, "job_queue_batch b", "b.job_id = f.job_id")
 	sb.Where(sb.Equal("f.file_name", fileName), sb.Equal("b.organization_id", orgID))
@@ -133,10 +262,17 @@ func (jr *JobRepositoryV1) GetFileInfo(ctx context.Context, orgID string, fileNa
 	var startTime *time.Time
 	var fileLength int
 	var checksum []byte
-	if err := jr.db.QueryRowContext(ctx, q, args...).Scan(&jobID, &startTime, &fileLength, &checksum); err != nil {
+	var compressedFileLength sql.NullInt64
+	var compressedChecksum []byte
+	var purgedAt sql.NullTime
+	if err := jr.db.QueryRowContext(ctx, q, args...).Scan(&jobID, &startTime, &fileLength, &checksum, &compressedFileLength, &compressedChecksum, &purgedAt); err != nil {
 		return nil, err
 	}
 
+	if purgedAt.Valid {
+		return nil, ErrFilePurged
+	}
+
 	if startTime == nil {
 		return nil, errors.New("job batch for file doesn't have a valid start time")
 	}
@@ -164,10 +300,205 @@ func (jr *JobRepositoryV1) GetFileInfo(ctx context.Context, orgID string, fileNa
 		if err := rows.Scan(&status); err != nil {
 			log.Warn("Failed to get status", zap.Error(err))
 		}
-		if status != 2 {
-			return nil, errors.New("Not all job batches are completed")
+		if status != v1.StatusCompleted && status != v1.StatusFailed {
+			return nil, errors.New("Not all job batches are finished")
+		}
+	}
+
+	return &v1.FileInfo{FileName: fileName, FileLength: fileLength, FileCheckSum: checksum,
+		CompressedFileLength: int(compressedFileLength.Int64), CompressedCheckSum: compressedChecksum}, nil
+}
+
+// CancelJob marks the unfinished batches of the job CANCELLED and removes the file records of every batch within a
+// single transaction, returning all the batch IDs so the caller can delete files already written. Finished batches
+// keep their status. A running export worker notices on its next update.
+func (jr *JobRepositoryV1) CancelJob(ctx context.Context, jobID string, orgID string) ([]string, error) {
+	tx, err := jr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sb := sqlFlavor.NewSelectBuilder()
+	sb.Select("batch_id", "status").
+		From("job_queue_batch").
+		Where(sb.Equal("job_id", jobID), sb.Equal("organization_id", orgID)).
+		ForUpdate()
+	q, args := sb.Build()
+	rows, err := tx.QueryContext(ctx, q, args...)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	batchIDs := make([]string, 0)
+	cancelled := false
+	for rows.Next() {
+		var batchID string
+		var status int
+		if err := rows.Scan(&batchID, &status); err != nil {
+			_ = rows.Close()
+			_ = tx.Rollback()
+			return nil, err
+		}
+		cancelled = cancelled || status == v1.StatusCancelled
+		batchIDs = append(batchIDs, batchID)
+	}
+	_ = rows.Close()
+	if len(batchIDs) == 0 || cancelled {
+		_ = tx.Rollback()
+		return nil, ErrJobNotFound
+	}
+
+	now := time.Now()
+	ub := sqlFlavor.NewUpdateBuilder()
+	ub.Update("job_queue_batch").
+		Set(ub.Assign("status", v1.StatusCancelled), ub.Assign("complete_time", now), ub.Assign("update_time", now)).
+		Where(ub.Equal("job_id", jobID), ub.Equal("organization_id", orgID), ub.In("status", v1.StatusQueued, v1.StatusRunning))
+	q, args = ub.Build()
+	if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	db := sqlFlavor.NewDeleteBuilder()
+	db.DeleteFrom("job_queue_batch_file").Where(db.Equal("job_id", jobID))
+	q, args = db.Build()
+	if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return batchIDs, nil
+}
+
+// jobStatusExpr rolls the batch statuses of a job up into one status: any cancelled, then any failed batch decides
+// the job status, it is completed when every batch is, queued when none has started and running otherwise
+const jobStatusExpr = `CASE WHEN COUNT(*) FILTER (WHERE status = 4) > 0 THEN 4 ` +
+	`WHEN COUNT(*) FILTER (WHERE status = 3) > 0 THEN 3 ` +
+	`WHEN COUNT(*) FILTER (WHERE status = 2) = COUNT(*) THEN 2 ` +
+	`WHEN COUNT(*) FILTER (WHERE status = 0) = COUNT(*) THEN 0 ` +
+	`ELSE 1 END`
+
+const patientCountExpr = `SUM(CASE WHEN COALESCE(patients, '') = '' THEN 0 ELSE array_length(string_to_array(patients, ','), 1) END)`
+
+// FindJobs function that returns a page of the organization's jobs, newest first. One extra row is requested
+// to report whether more jobs follow.
+func (jr *JobRepositoryV1) FindJobs(ctx context.Context, orgID string, filter v1.JobFilter) (*v1.JobList, error) {
+	inner := sqlFlavor.NewSelectBuilder()
+	inner.Select("job_id",
+		inner.As(jobStatusExpr, "job_status"),
+		inner.As("MIN(submit_time)", "submit_time"),
+		inner.As("MAX(complete_time)", "complete_time"),
+		inner.As("MAX(resource_types)", "resource_types"),
+		inner.As(patientCountExpr, "patient_count"),
+		inner.As("MAX(request_url)", "request_url"),
+		inner.As("MAX(schedule_id::text)", "schedule_id")).
+		From("job_queue_batch").
+		Where(inner.Equal("organization_id", orgID)).
+		GroupBy("job_id")
+	if filter.ScheduleID != "" {
+		inner.Where(inner.Equal("schedule_id", filter.ScheduleID))
+	}
+
+	sb := sqlFlavor.NewSelectBuilder()
+	sb.Select("job_id", "job_status", "submit_time", "complete_time", "resource_types", "patient_count", "request_url", "schedule_id").
+		From(sb.BuilderAs(inner, "jobs"))
+	if len(filter.Statuses) > 0 {
+		statuses := make([]interface{}, len(filter.Statuses))
+		for i, s := range filter.Statuses {
+			statuses[i] = s
 		}
+		sb.Where(sb.In("job_status", statuses...))
+	}
+	if filter.SubmittedAfter != nil {
+		sb.Where(sb.GreaterEqualThan("submit_time", *filter.SubmittedAfter))
 	}
+	if filter.SubmittedBefore != nil {
+		sb.Where(sb.LessThan("submit_time", *filter.SubmittedBefore))
+	}
+	sb.OrderBy("submit_time DESC", "job_id").Limit(filter.Limit + 1).Offset(filter.Offset)
+	q, args := sb.Build()
 
-	return &v1.FileInfo{FileName: fileName, FileLength: fileLength, FileCheckSum: checksum}, nil
+	rows, err := jr.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := &v1.JobList{Jobs: make([]v1.JobSummary, 0)}
+	for rows.Next() {
+		var jobID, resourceTypes string
+		var requestURL, scheduleID sql.NullString
+		var status, patientCount int
+		var submitTime time.Time
+		var completeTime sql.NullTime
+		if err := rows.Scan(&jobID, &status, &submitTime, &completeTime, &resourceTypes, &patientCount, &requestURL, &scheduleID); err != nil {
+			return nil, err
+		}
+		if len(list.Jobs) == filter.Limit {
+			list.HasMore = true
+			break
+		}
+		list.Jobs = append(list.Jobs, v1.NewJobSummary(jobID, status, submitTime, completeTime, resourceTypes, patientCount, requestURL.String, scheduleID.String))
+	}
+	return list, rows.Err()
+}
+
+// FindLastGroupExport returns the latest completed export of the group that a _since=auto request continues from, or
+// nil when there is none. Only exports of the same resource types, _typeFilter and _elements count, and only those
+// whose batches had no _since or a resolved one, as an export since an arbitrary time misses what changed before it.
+func (jr *JobRepositoryV1) FindLastGroupExport(ctx context.Context, orgID string, er v1.ExportRequest) (*v1.GroupExport, error) {
+	inner := sqlFlavor.NewSelectBuilder()
+	inner.Select("job_id",
+		inner.As(jobStatusExpr, "job_status"),
+		inner.As("MAX(transaction_time)", "transaction_time")).
+		From("job_queue_batch").
+		Where(inner.Equal("organization_id", orgID),
+			inner.Equal("group_id", er.GroupID),
+			inner.Equal("resource_types", er.Type),
+			inner.Equal("COALESCE(type_filter, '')", er.TypeFilter),
+			inner.Equal("COALESCE(elements, '')", er.Elements)).
+		GroupBy("job_id").
+		Having("BOOL_AND(since IS NULL OR since_auto)")
+
+	sb := sqlFlavor.NewSelectBuilder()
+	sb.Select("job_id", "transaction_time").
+		From(sb.BuilderAs(inner, "jobs")).
+		Where(sb.Equal("job_status", v1.StatusCompleted)).
+		OrderBy("transaction_time DESC").
+		Limit(1)
+	q, args := sb.Build()
+
+	last := v1.GroupExport{PatientMBIs: make([]string, 0)}
+	err := jr.db.QueryRowContext(ctx, q, args...).Scan(&last.JobID, &last.TransactionTime)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pb := sqlFlavor.NewSelectBuilder()
+	pb.Select("patients").
+		From("job_queue_batch").
+		Where(pb.Equal("job_id", last.JobID))
+	q, args = pb.Build()
+
+	rows, err := jr.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var patients sql.NullString
+		if err := rows.Scan(&patients); err != nil {
+			return nil, err
+		}
+		if patients.String != "" {
+			last.PatientMBIs = append(last.PatientMBIs, strings.Split(patients.String, ",")...)
+		}
+	}
+	return &last, rows.Err()
 }
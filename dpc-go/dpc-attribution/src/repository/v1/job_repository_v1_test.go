@@ -74,7 +74,7 @@ func (suite *JobRepositoryV1TestSuite) TestInsert() {
 	ctx := context.Background()
 	batches := []v1.BatchRequest{suite.fakeBatch}
 
-	expectedInsertQuery := `INSERT INTO job_queue_batch \(batch_id, job_id, organization_id, organization_npi, provider_npi, patients, resource_types, since, priority, transaction_time, status, submit_time,  request_url, requesting_ip, is_bulk\) VALUES \(\$1, \$2, \$3, \$4, \$5, \$6, \$7, \$8, \$9, \$10, \$11, \$12, \$13, \$14, \$15\)`
+	expectedInsertQuery := `INSERT INTO job_queue_batch \(batch_id, job_id, organization_id, organization_npi, provider_npi, patients, resource_types, since, priority, transaction_time, status, submit_time,  request_url, requesting_ip, is_bulk, type_filter, elements, warnings, webhook_url, request_fingerprint, idempotency_key, schedule_id, group_id, since_auto\) VALUES \(\$1, \$2, \$3, \$4, \$5, \$6, \$7, \$8, \$9, \$10, \$11, \$12, \$13, \$14, \$15, \$16, \$17, \$18, \$19, \$20, \$21, \$22, \$23, \$24\)`
 
 	mock.ExpectBegin()
 	mock.ExpectExec(expectedInsertQuery).WithArgs(
@@ -93,6 +93,15 @@ func (suite *JobRepositoryV1TestSuite) TestInsert() {
 		suite.fakeBatch.RequestURL,
 		suite.fakeBatch.RequestingIP,
 		suite.fakeBatch.IsBulk,
+		sql.NullString{String: suite.fakeBatch.TypeFilter, Valid: true},
+		sql.NullString{String: suite.fakeBatch.Elements, Valid: true},
+		sql.NullString{String: suite.fakeBatch.Warnings, Valid: true},
+		sql.NullString{String: suite.fakeBatch.WebhookURL, Valid: true},
+		sql.NullString{},
+		sql.NullString{},
+		sql.NullString{String: suite.fakeBatch.ScheduleID, Valid: suite.fakeBatch.ScheduleID != ""},
+		sql.NullString{String: suite.fakeBatch.GroupID, Valid: suite.fakeBatch.GroupID != ""},
+		suite.fakeBatch.SinceAuto,
 	).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 	job, err := repo.Insert(ctx, "12345", batches)
@@ -103,13 +112,120 @@ func (suite *JobRepositoryV1TestSuite) TestInsert() {
 	assert.NotEmpty(suite.T(), job)
 }
 
+const (
+	expectedAdvisoryLock   = `SELECT pg_advisory_xact_lock\(hashtext\(\$1\)\)`
+	expectedKeyQuery       = `SELECT job_id, MAX\(request_fingerprint\) FROM job_queue_batch WHERE organization_id = \$1 AND idempotency_key = \$2 AND submit_time >= \$3 GROUP BY job_id ORDER BY MIN\(submit_time\) DESC LIMIT 1`
+	expectedDuplicateQuery = `SELECT job_id FROM \(SELECT job_id, .* FROM job_queue_batch WHERE organization_id = \$1 AND request_fingerprint = \$2 GROUP BY job_id\) AS jobs ` +
+		`WHERE \(job_status IN \(\$3, \$4\) OR \(job_status = \$5 AND complete_time >= \$6\)\) ORDER BY submit_time DESC LIMIT 1`
+)
+
+func (suite *JobRepositoryV1TestSuite) TestInsertUnlessDuplicate() {
+	db, mock := newMock()
+	defer db.Close()
+	repo := NewJobRepo(db)
+	dedupe := v1.JobDedupe{Fingerprint: "abc", IdempotencyKey: "key", FreshSince: time.Now().Add(-time.Hour), KeysSince: time.Now().Add(-24 * time.Hour)}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(expectedAdvisoryLock).WithArgs("12345").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(expectedKeyQuery).WithArgs("12345", "key", dedupe.KeysSince).WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(expectedDuplicateQuery).
+		WithArgs("12345", "abc", v1.StatusQueued, v1.StatusRunning, v1.StatusCompleted, dedupe.FreshSince).
+		WillReturnRows(sqlmock.NewRows([]string{"job_id"}))
+	mock.ExpectExec(`INSERT INTO job_queue_batch`).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "12345", sqlmock.AnyArg(),
+		sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), 0,
+		sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+		sqlmock.AnyArg(), sqlmock.AnyArg(), sql.NullString{String: "abc", Valid: true}, sql.NullString{String: "key", Valid: true}, sqlmock.AnyArg(),
+		sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	job, duplicate, err := repo.InsertUnlessDuplicate(context.Background(), "12345", []v1.BatchRequest{suite.fakeBatch}, dedupe)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), duplicate)
+	assert.NotEmpty(suite.T(), job)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
+
+func (suite *JobRepositoryV1TestSuite) TestInsertUnlessDuplicateExisting() {
+	db, mock := newMock()
+	defer db.Close()
+	repo := NewJobRepo(db)
+	dedupe := v1.JobDedupe{Fingerprint: "abc", FreshSince: time.Now().Add(-time.Hour)}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(expectedAdvisoryLock).WithArgs("12345").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(expectedDuplicateQuery).
+		WithArgs("12345", "abc", v1.StatusQueued, v1.StatusRunning, v1.StatusCompleted, dedupe.FreshSince).
+		WillReturnRows(sqlmock.NewRows([]string{"job_id"}).AddRow("existing"))
+	mock.ExpectRollback()
+
+	job, duplicate, err := repo.InsertUnlessDuplicate(context.Background(), "12345", []v1.BatchRequest{suite.fakeBatch}, dedupe)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), duplicate)
+	assert.Equal(suite.T(), "existing", *job)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
+
+func (suite *JobRepositoryV1TestSuite) TestInsertUnlessDuplicateIdempotencyKey() {
+	db, mock := newMock()
+	defer db.Close()
+	repo := NewJobRepo(db)
+	dedupe := v1.JobDedupe{Fingerprint: "abc", IdempotencyKey: "key", KeysSince: time.Now().Add(-24 * time.Hour)}
+
+	// the same key and request return the job of the key, whatever its status
+	mock.ExpectBegin()
+	mock.ExpectExec(expectedAdvisoryLock).WithArgs("12345").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(expectedKeyQuery).WithArgs("12345", "key", dedupe.KeysSince).
+		WillReturnRows(sqlmock.NewRows([]string{"job_id", "request_fingerprint"}).AddRow("keyed", "abc"))
+	mock.ExpectRollback()
+
+	job, duplicate, err := repo.InsertUnlessDuplicate(context.Background(), "12345", []v1.BatchRequest{suite.fakeBatch}, dedupe)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), duplicate)
+	assert.Equal(suite.T(), "keyed", *job)
+
+	// the same key for another request is refused
+	mock.ExpectBegin()
+	mock.ExpectExec(expectedAdvisoryLock).WithArgs("12345").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(expectedKeyQuery).WithArgs("12345", "key", dedupe.KeysSince).
+		WillReturnRows(sqlmock.NewRows([]string{"job_id", "request_fingerprint"}).AddRow("keyed", "other"))
+	mock.ExpectRollback()
+
+	job, _, err = repo.InsertUnlessDuplicate(context.Background(), "12345", []v1.BatchRequest{suite.fakeBatch}, dedupe)
+	assert.ErrorIs(suite.T(), err, ErrIdempotencyKeyReused)
+	assert.Nil(suite.T(), job)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
+
+func (suite *JobRepositoryV1TestSuite) TestFindDuplicateJob() {
+	db, mock := newMock()
+	defer db.Close()
+	repo := NewJobRepo(db)
+	dedupe := v1.JobDedupe{Fingerprint: "abc", FreshSince: time.Now().Add(-time.Hour)}
+
+	mock.ExpectQuery(expectedDuplicateQuery).
+		WithArgs("12345", "abc", v1.StatusQueued, v1.StatusRunning, v1.StatusCompleted, dedupe.FreshSince).
+		WillReturnRows(sqlmock.NewRows([]string{"job_id"}).AddRow("existing"))
+	job, err := repo.FindDuplicateJob(context.Background(), "12345", dedupe)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "existing", *job)
+
+	mock.ExpectQuery(expectedDuplicateQuery).
+		WithArgs("12345", "abc", v1.StatusQueued, v1.StatusRunning, v1.StatusCompleted, dedupe.FreshSince).
+		WillReturnRows(sqlmock.NewRows([]string{"job_id"}))
+	job, err = repo.FindDuplicateJob(context.Background(), "12345", dedupe)
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), job)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
+
 func (suite *JobRepositoryV1TestSuite) TestIsFileValid() {
 	db, mock := newMock()
 	repo := NewJobRepo(db)
 
-	expectedQuery := `SELECT f.job_id, b.start_time, f.file_length, f.checksum FROM job_queue_batch_file f LEFT JOIN job_queue_batch b ON b.job_id = f.job_id WHERE f.file_name = \$1 AND b.organization_id = \$2`
-	rows := sqlmock.NewRows([]string{"job_id", "start_time", "file_length", "checksum"}).
-		AddRow("54321", time.Now(), 1, make([]byte, 5))
+	expectedQuery := `SELECT f.job_id, b.start_time, f.file_length, f.checksum, f.compressed_file_length, f.compressed_checksum, f.purged_at FROM job_queue_batch_file f LEFT JOIN job_queue_batch b ON b.job_id = f.job_id WHERE f.file_name = \$1 AND b.organization_id = \$2`
+	rows := sqlmock.NewRows([]string{"job_id", "start_time", "file_length", "checksum", "compressed_file_length", "compressed_checksum", "purged_at"}).
+		AddRow("54321", time.Now(), 10, make([]byte, 5), 3, []byte{1, 2}, nil)
 	mock.ExpectQuery(expectedQuery).WithArgs("fileName", "12345").WillReturnRows(rows)
 
 	expectedStatusQuery := `SELECT status FROM job_queue_batch WHERE job_id = \$1`
@@ -121,15 +237,18 @@ func (suite *JobRepositoryV1TestSuite) TestIsFileValid() {
 
 	assert.NoError(suite.T(), err)
 	assert.Equal(suite.T(), "fileName", fi.FileName)
+	assert.Equal(suite.T(), 10, fi.FileLength)
+	assert.Equal(suite.T(), 3, fi.CompressedFileLength)
+	assert.Equal(suite.T(), []byte{1, 2}, fi.CompressedCheckSum)
 }
 
 func (suite *JobRepositoryV1TestSuite) TestIsFileValidIncompleteBatches() {
 	db, mock := newMock()
 	repo := NewJobRepo(db)
 
-	expectedQuery := `SELECT f.job_id, b.start_time, f.file_length, f.checksum FROM job_queue_batch_file f LEFT JOIN job_queue_batch b ON b.job_id = f.job_id WHERE f.file_name = \$1 AND b.organization_id = \$2`
-	rows := sqlmock.NewRows([]string{"job_id", "start_time", "file_length", "checksum"}).
-		AddRow("54321", time.Now(), 1, make([]byte, 5))
+	expectedQuery := `SELECT f.job_id, b.start_time, f.file_length, f.checksum, f.compressed_file_length, f.compressed_checksum, f.purged_at FROM job_queue_batch_file f LEFT JOIN job_queue_batch b ON b.job_id = f.job_id WHERE f.file_name = \$1 AND b.organization_id = \$2`
+	rows := sqlmock.NewRows([]string{"job_id", "start_time", "file_length", "checksum", "compressed_file_length", "compressed_checksum", "purged_at"}).
+		AddRow("54321", time.Now(), 10, make([]byte, 5), 3, []byte{1, 2}, nil)
 	mock.ExpectQuery(expectedQuery).WithArgs("fileName", "12345").WillReturnRows(rows)
 
 	expectedStatusQuery := `SELECT status FROM job_queue_batch WHERE job_id = \$1`
@@ -139,7 +258,62 @@ func (suite *JobRepositoryV1TestSuite) TestIsFileValidIncompleteBatches() {
 
 	_, err := repo.GetFileInfo(context.Background(), "12345", "fileName")
 
-	assert.Error(suite.T(), err, "Not all job batches are completed")
+	assert.Error(suite.T(), err, "Not all job batches are finished")
+}
+
+func (suite *JobRepositoryV1TestSuite) TestIsFileValidFailedBatch() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+
+	expectedQuery := `SELECT f.job_id, b.start_time, f.file_length, f.checksum, f.compressed_file_length, f.compressed_checksum, f.purged_at FROM job_queue_batch_file f LEFT JOIN job_queue_batch b ON b.job_id = f.job_id WHERE f.file_name = \$1 AND b.organization_id = \$2`
+	rows := sqlmock.NewRows([]string{"job_id", "start_time", "file_length", "checksum", "compressed_file_length", "compressed_checksum", "purged_at"}).
+		AddRow("54321", time.Now(), 10, make([]byte, 5), 3, []byte{1, 2}, nil)
+	mock.ExpectQuery(expectedQuery).WithArgs("OperationOutcome.ndjson", "12345").WillReturnRows(rows)
+
+	expectedStatusQuery := `SELECT status FROM job_queue_batch WHERE job_id = \$1`
+	rows = sqlmock.NewRows([]string{"status"}).
+		AddRow(v1.StatusCompleted).AddRow(v1.StatusFailed)
+	mock.ExpectQuery(expectedStatusQuery).WithArgs("54321").WillReturnRows(rows)
+
+	fi, err := repo.GetFileInfo(context.Background(), "12345", "OperationOutcome.ndjson")
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "OperationOutcome.ndjson", fi.FileName)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
+
+func (suite *JobRepositoryV1TestSuite) TestIsFileValidCancelledBatch() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+
+	expectedQuery := `SELECT f.job_id, b.start_time, f.file_length, f.checksum, f.compressed_file_length, f.compressed_checksum, f.purged_at FROM job_queue_batch_file f LEFT JOIN job_queue_batch b ON b.job_id = f.job_id WHERE f.file_name = \$1 AND b.organization_id = \$2`
+	rows := sqlmock.NewRows([]string{"job_id", "start_time", "file_length", "checksum", "compressed_file_length", "compressed_checksum", "purged_at"}).
+		AddRow("54321", time.Now(), 10, make([]byte, 5), 3, []byte{1, 2}, nil)
+	mock.ExpectQuery(expectedQuery).WithArgs("fileName", "12345").WillReturnRows(rows)
+
+	expectedStatusQuery := `SELECT status FROM job_queue_batch WHERE job_id = \$1`
+	rows = sqlmock.NewRows([]string{"status"}).
+		AddRow(v1.StatusCompleted).AddRow(v1.StatusCancelled)
+	mock.ExpectQuery(expectedStatusQuery).WithArgs("54321").WillReturnRows(rows)
+
+	_, err := repo.GetFileInfo(context.Background(), "12345", "fileName")
+
+	assert.Error(suite.T(), err)
+}
+
+func (suite *JobRepositoryV1TestSuite) TestIsFileValidPurged() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+
+	expectedQuery := `SELECT f.job_id, b.start_time, f.file_length, f.checksum, f.compressed_file_length, f.compressed_checksum, f.purged_at FROM job_queue_batch_file f LEFT JOIN job_queue_batch b ON b.job_id = f.job_id WHERE f.file_name = \$1 AND b.organization_id = \$2`
+	rows := sqlmock.NewRows([]string{"job_id", "start_time", "file_length", "checksum", "compressed_file_length", "compressed_checksum", "purged_at"}).
+		AddRow("54321", time.Now(), 10, make([]byte, 5), 3, []byte{1, 2}, time.Now())
+	mock.ExpectQuery(expectedQuery).WithArgs("fileName", "12345").WillReturnRows(rows)
+
+	_, err := repo.GetFileInfo(context.Background(), "12345", "fileName")
+
+	assert.ErrorIs(suite.T(), err, ErrFilePurged)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
 }
 
 func (suite *JobRepositoryV1TestSuite) TestFindBatchesByJobIDSQL() {
@@ -176,22 +350,24 @@ func (suite *JobRepositoryV1TestSuite) TestFindBatchFilesByBatchIDSQL() {
 	db, mock := newMock()
 	repo := NewJobRepo(db)
 
-	expectedQuery := `SELECT resource_type, batch_id, sequence, file_name, count, checksum, file_length FROM job_queue_batch_file WHERE batch_id = \$1`
-	rows := sqlmock.NewRows([]string{"resource_type", "batch_id", "sequence", "file_name", "count", "checksum", "file_length"}).
-		AddRow(77, 1, 0, "testFile", 1, []byte{}, 1234)
+	expectedQuery := `SELECT resource_type, batch_id, sequence, file_name, count, checksum, file_length, compressed_checksum, compressed_file_length, purged_at FROM job_queue_batch_file WHERE batch_id = \$1`
+	rows := sqlmock.NewRows([]string{"resource_type", "batch_id", "sequence", "file_name", "count", "checksum", "file_length", "compressed_checksum", "compressed_file_length", "purged_at"}).
+		AddRow(77, 1, 0, "testFile", 1, []byte{}, 1234, []byte{0xab}, 123, nil)
 	mock.ExpectQuery(expectedQuery).WithArgs("12345").WillReturnRows(rows)
 
 	files, err := repo.FindBatchFilesByBatchID("12345")
 
 	assert.NoError(suite.T(), err)
 	assert.Len(suite.T(), files, 1)
+	assert.Equal(suite.T(), v1.HexType("ab"), *files[0].CompressedChecksum)
+	assert.Equal(suite.T(), 123, *files[0].CompressedFileLength)
 }
 
 func (suite *JobRepositoryV1TestSuite) TestFindBatchFilesByBatchIDErrorHandling() {
 	db, mock := newMock()
 	repo := NewJobRepo(db)
 
-	expectedQuery := `SELECT resource_type, batch_id, sequence, file_name, count, checksum, file_length FROM job_queue_batch_file WHERE batch_id = \$1`
+	expectedQuery := `SELECT resource_type, batch_id, sequence, file_name, count, checksum, file_length, compressed_checksum, compressed_file_length, purged_at FROM job_queue_batch_file WHERE batch_id = \$1`
 	mock.ExpectQuery(expectedQuery).WithArgs("12345").WillReturnError(errors.New("error"))
 
 	files, err := repo.FindBatchFilesByBatchID("12345")
@@ -199,3 +375,110 @@ func (suite *JobRepositoryV1TestSuite) TestFindBatchFilesByBatchIDErrorHandling(
 	assert.Errorf(suite.T(), err, "error")
 	assert.Nil(suite.T(), files)
 }
+
+func (suite *JobRepositoryV1TestSuite) TestCancelJob() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+
+	mock.ExpectBegin()
+	rows := sqlmock.NewRows([]string{"batch_id", "status"}).AddRow("batch-1", 1).AddRow("batch-2", 2)
+	mock.ExpectQuery(`SELECT batch_id, status FROM job_queue_batch WHERE job_id = \$1 AND organization_id = \$2 FOR UPDATE`).
+		WithArgs("54321", "12345").WillReturnRows(rows)
+	mock.ExpectExec(`UPDATE job_queue_batch SET status = \$1, complete_time = \$2, update_time = \$3 WHERE job_id = \$4 AND organization_id = \$5 AND status IN \(\$6, \$7\)`).
+		WithArgs(v1.StatusCancelled, sqlmock.AnyArg(), sqlmock.AnyArg(), "54321", "12345", v1.StatusQueued, v1.StatusRunning).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM job_queue_batch_file WHERE job_id = \$1`).WithArgs("54321").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	batchIDs, err := repo.CancelJob(context.Background(), "54321", "12345")
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{"batch-1", "batch-2"}, batchIDs)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
+
+func (suite *JobRepositoryV1TestSuite) TestCancelJobAlreadyCancelled() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+
+	mock.ExpectBegin()
+	rows := sqlmock.NewRows([]string{"batch_id", "status"}).AddRow("batch-1", v1.StatusCancelled)
+	mock.ExpectQuery(`SELECT batch_id, status FROM job_queue_batch`).WithArgs("54321", "12345").WillReturnRows(rows)
+	mock.ExpectRollback()
+
+	_, err := repo.CancelJob(context.Background(), "54321", "12345")
+
+	assert.ErrorIs(suite.T(), err, ErrJobNotFound)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
+
+func (suite *JobRepositoryV1TestSuite) TestFindJobs() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+
+	after := time.Now().Add(-24 * time.Hour)
+	submitted := time.Now().Add(-time.Hour)
+	rows := sqlmock.NewRows([]string{"job_id", "job_status", "submit_time", "complete_time", "resource_types", "patient_count", "request_url", "schedule_id"}).
+		AddRow("job-1", v1.StatusCompleted, submitted, submitted.Add(time.Minute), "Patient,Coverage", 3, "http://dpc/Group/1/$export", nil).
+		AddRow("job-2", v1.StatusRunning, submitted, nil, "Patient", 1, nil, "schedule-1").
+		AddRow("job-3", v1.StatusQueued, submitted, nil, "Patient", 1, nil, nil)
+	mock.ExpectQuery(`SELECT job_id, job_status, submit_time, complete_time, resource_types, patient_count, request_url, schedule_id FROM \(SELECT job_id, .* FROM job_queue_batch WHERE organization_id = \$1 GROUP BY job_id\) AS jobs WHERE job_status IN \(\$2, \$3\) AND submit_time >= \$4 ORDER BY submit_time DESC, job_id LIMIT 3 OFFSET 2`).
+		WithArgs("12345", v1.StatusCompleted, v1.StatusRunning, after).WillReturnRows(rows)
+
+	list, err := repo.FindJobs(context.Background(), "12345", v1.JobFilter{
+		Statuses:       []int{v1.StatusCompleted, v1.StatusRunning},
+		SubmittedAfter: &after,
+		Limit:          2,
+		Offset:         2,
+	})
+
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), list.HasMore)
+	assert.Len(suite.T(), list.Jobs, 2)
+	assert.Equal(suite.T(), "COMPLETED", list.Jobs[0].Status)
+	assert.Equal(suite.T(), []string{"Patient", "Coverage"}, list.Jobs[0].ResourceTypes)
+	assert.Equal(suite.T(), 3, list.Jobs[0].PatientCount)
+	assert.NotNil(suite.T(), list.Jobs[0].CompleteTime)
+	assert.Equal(suite.T(), "RUNNING", list.Jobs[1].Status)
+	assert.Nil(suite.T(), list.Jobs[1].CompleteTime)
+	assert.Equal(suite.T(), "schedule-1", list.Jobs[1].ScheduleID)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
+
+const expectedLastGroupExportQuery = `SELECT job_id, transaction_time FROM \(SELECT job_id, .* FROM job_queue_batch ` +
+	`WHERE organization_id = \$1 AND group_id = \$2 AND resource_types = \$3 AND COALESCE\(type_filter, ''\) = \$4 AND COALESCE\(elements, ''\) = \$5 ` +
+	`GROUP BY job_id HAVING BOOL_AND\(since IS NULL OR since_auto\)\) AS jobs WHERE job_status = \$6 ORDER BY transaction_time DESC LIMIT 1`
+
+func (suite *JobRepositoryV1TestSuite) TestFindLastGroupExport() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	er := v1.ExportRequest{GroupID: "67890", Type: "Patient,Coverage"}
+	tt := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(expectedLastGroupExportQuery).
+		WithArgs("12345", "67890", "Patient,Coverage", "", "", v1.StatusCompleted).
+		WillReturnRows(sqlmock.NewRows([]string{"job_id", "transaction_time"}).AddRow("job-1", tt))
+	mock.ExpectQuery(`SELECT patients FROM job_queue_batch WHERE job_id = \$1`).WithArgs("job-1").
+		WillReturnRows(sqlmock.NewRows([]string{"patients"}).AddRow("1SW4N00AA00,2SW4N00AA00").AddRow("").AddRow("3SW4N00AA00"))
+
+	last, err := repo.FindLastGroupExport(context.Background(), "12345", er)
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "job-1", last.JobID)
+	assert.Equal(suite.T(), tt, last.TransactionTime)
+	assert.Equal(suite.T(), []string{"1SW4N00AA00", "2SW4N00AA00", "3SW4N00AA00"}, last.PatientMBIs)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
+
+func (suite *JobRepositoryV1TestSuite) TestFindLastGroupExportNone() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+
+	mock.ExpectQuery(expectedLastGroupExportQuery).WillReturnRows(sqlmock.NewRows([]string{"job_id", "transaction_time"}))
+
+	last, err := repo.FindLastGroupExport(context.Background(), "12345", v1.ExportRequest{GroupID: "67890", Type: "Patient"})
+
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), last)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
@@ -0,0 +1,131 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/CMSgov/dpc/attribution/model/v1"
+)
+
+// PriorityRepo is an interface for the job service to read the priority tiers and queue usage of organizations
+type PriorityRepo interface {
+	FindPriorityTier(ctx context.Context, orgID string) (*v1.PriorityTier, error)
+	SavePriorityTier(ctx context.Context, tier v1.PriorityTier) error
+	FindOrgUsage(ctx context.Context, orgID string, since time.Time) (*v1.OrgUsage, error)
+	FindQueueEstimate(ctx context.Context, jobID string, since time.Time) (*v1.QueueEstimate, error)
+	FindThroughput(ctx context.Context, since time.Time) (*float64, error)
+}
+
+// FindPriorityTier returns the priority tier set for the organization, or the default tier when none was set
+func (jr *JobRepositoryV1) FindPriorityTier(ctx context.Context, orgID string) (*v1.PriorityTier, error) {
+	sb := sqlFlavor.NewSelectBuilder()
+	sb.Select("priority_tier", "max_concurrent_batches").
+		From("organization_priority").
+		Where(sb.Equal("organization_id", orgID))
+	q, args := sb.Build()
+
+	priority := v1.DefaultPriorityTier(orgID)
+	err := jr.db.QueryRowContext(ctx, q, args...).Scan(&priority.Tier, &priority.MaxConcurrentBatches)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return priority, nil
+}
+
+// SavePriorityTier creates or replaces the priority tier of the organization
+func (jr *JobRepositoryV1) SavePriorityTier(ctx context.Context, tier v1.PriorityTier) error {
+	ib := sqlFlavor.NewInsertBuilder()
+	ib.InsertInto("organization_priority").
+		Cols("organization_id", "priority_tier", "max_concurrent_batches", "updated_at").
+		Values(tier.OrganizationID, tier.Tier, tier.MaxConcurrentBatches, time.Now()).
+		SQL("ON CONFLICT (organization_id) DO UPDATE SET priority_tier = EXCLUDED.priority_tier, " +
+			"max_concurrent_batches = EXCLUDED.max_concurrent_batches, updated_at = EXCLUDED.updated_at")
+	q, args := ib.Build()
+	_, err := jr.db.ExecContext(ctx, q, args...)
+	return err
+}
+
+// FindOrgUsage counts the active batches of the organization and those that finished since the given time
+func (jr *JobRepositoryV1) FindOrgUsage(ctx context.Context, orgID string, since time.Time) (*v1.OrgUsage, error) {
+	sb := sqlFlavor.NewSelectBuilder()
+	sb.Select(fmt.Sprintf("COUNT(*) FILTER (WHERE %s)", sb.In("status", v1.StatusQueued, v1.StatusRunning)),
+		fmt.Sprintf("COUNT(*) FILTER (WHERE %s)", sb.And(sb.In("status", v1.StatusCompleted, v1.StatusFailed), sb.GreaterEqualThan("complete_time", since)))).
+		From("job_queue_batch").
+		Where(sb.Equal("organization_id", orgID))
+	q, args := sb.Build()
+
+	usage := new(v1.OrgUsage)
+	if err := jr.db.QueryRowContext(ctx, q, args...).Scan(&usage.ActiveBatches, &usage.RecentBatches); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// FindQueueEstimate finds how many queued batches are ordered ahead of the next batch of the job, and estimates how
+// long until it starts from the average run time of the batches completed since the given time, spread over the
+// running workers. Batches of organizations at their concurrency cap are counted although they will be passed over.
+func (jr *JobRepositoryV1) FindQueueEstimate(ctx context.Context, jobID string, since time.Time) (*v1.QueueEstimate, error) {
+	next := sqlFlavor.NewSelectBuilder()
+	next.Select("priority", "submit_time").
+		From("job_queue_batch").
+		Where(next.Equal("job_id", jobID), next.Equal("status", v1.StatusQueued)).
+		OrderBy("priority", "submit_time").
+		Limit(1)
+
+	sb := sqlFlavor.NewSelectBuilder()
+	sb.Select("COUNT(*)").
+		From("job_queue_batch b").
+		Join(sb.BuilderAs(next, "n"), "b.priority < n.priority OR (b.priority = n.priority AND b.submit_time < n.submit_time)").
+		Where(sb.Equal("b.status", v1.StatusQueued))
+	q, args := sb.Build()
+
+	estimate := new(v1.QueueEstimate)
+	if err := jr.db.QueryRowContext(ctx, q, args...).Scan(&estimate.Position); err != nil {
+		return nil, err
+	}
+
+	sb = sqlFlavor.NewSelectBuilder()
+	sb.Select(fmt.Sprintf("AVG(EXTRACT(EPOCH FROM complete_time - start_time)) FILTER (WHERE %s)", sb.Equal("status", v1.StatusCompleted)),
+		fmt.Sprintf("COUNT(DISTINCT aggregator_id) FILTER (WHERE %s)", sb.Equal("status", v1.StatusRunning))).
+		From("job_queue_batch").
+		Where(sb.Or(sb.And(sb.Equal("status", v1.StatusCompleted), sb.GreaterEqualThan("complete_time", since)),
+			sb.Equal("status", v1.StatusRunning)))
+	q, args = sb.Build()
+
+	var avgSeconds sql.NullFloat64
+	var workers int
+	if err := jr.db.QueryRowContext(ctx, q, args...).Scan(&avgSeconds, &workers); err != nil {
+		return nil, err
+	}
+	if avgSeconds.Valid {
+		if workers < 1 {
+			workers = 1
+		}
+		// the batch starts once every batch ahead of it has been claimed, workers at a time
+		rounds := (estimate.Position + workers - 1) / workers
+		wait := time.Duration(float64(rounds) * avgSeconds.Float64 * float64(time.Second)).Round(time.Second)
+		estimate.EstimatedWait = &wait
+	}
+	return estimate, nil
+}
+
+// FindThroughput returns how many patients a batch exports per second, from the batches completed since the given
+// time, or nil when none completed
+func (jr *JobRepositoryV1) FindThroughput(ctx context.Context, since time.Time) (*float64, error) {
+	sb := sqlFlavor.NewSelectBuilder()
+	sb.Select("SUM(array_length(string_to_array(patients, ','), 1)) / NULLIF(SUM(EXTRACT(EPOCH FROM complete_time - start_time)), 0)").
+		From("job_queue_batch").
+		Where(sb.Equal("status", v1.StatusCompleted), sb.GreaterEqualThan("complete_time", since), sb.IsNotNull("start_time"))
+	q, args := sb.Build()
+
+	var throughput sql.NullFloat64
+	if err := jr.db.QueryRowContext(ctx, q, args...).Scan(&throughput); err != nil {
+		return nil, err
+	}
+	if !throughput.Valid {
+		return nil, nil
+	}
+	return &throughput.Float64, nil
+}
@@ -0,0 +1,144 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	v1 "github.com/CMSgov/dpc/attribution/model/v1"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type PriorityV1TestSuite struct {
+	suite.Suite
+}
+
+func TestPriorityV1TestSuite(t *testing.T) {
+	suite.Run(t, new(PriorityV1TestSuite))
+}
+
+const expectedPriorityQuery = `SELECT priority_tier, max_concurrent_batches FROM organization_priority WHERE organization_id = \$1`
+
+func (suite *PriorityV1TestSuite) TestFindPriorityTier() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+
+	mock.ExpectQuery(expectedPriorityQuery).WithArgs("org-1").
+		WillReturnRows(sqlmock.NewRows([]string{"priority_tier", "max_concurrent_batches"}).AddRow("high", 4))
+
+	priority, err := repo.FindPriorityTier(context.Background(), "org-1")
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), &v1.PriorityTier{OrganizationID: "org-1", Tier: v1.TierHigh, MaxConcurrentBatches: 4}, priority)
+}
+
+func (suite *PriorityV1TestSuite) TestFindPriorityTierDefault() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+
+	mock.ExpectQuery(expectedPriorityQuery).WithArgs("org-1").WillReturnError(sql.ErrNoRows)
+
+	priority, err := repo.FindPriorityTier(context.Background(), "org-1")
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), v1.DefaultPriorityTier("org-1"), priority)
+}
+
+func (suite *PriorityV1TestSuite) TestSavePriorityTier() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+
+	mock.ExpectExec(`INSERT INTO organization_priority \(organization_id, priority_tier, max_concurrent_batches, updated_at\) VALUES \(\$1, \$2, \$3, \$4\) `+
+		`ON CONFLICT \(organization_id\) DO UPDATE SET priority_tier = EXCLUDED.priority_tier, `+
+		`max_concurrent_batches = EXCLUDED.max_concurrent_batches, updated_at = EXCLUDED.updated_at`).
+		WithArgs("org-1", "low", 2, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.SavePriorityTier(context.Background(), v1.PriorityTier{OrganizationID: "org-1", Tier: v1.TierLow, MaxConcurrentBatches: 2})
+
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
+
+func (suite *PriorityV1TestSuite) TestFindOrgUsage() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	since := time.Now().Add(-24 * time.Hour)
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FILTER \(WHERE status IN \(\$1, \$2\)\), COUNT\(\*\) FILTER \(WHERE \(status IN \(\$3, \$4\) AND complete_time >= \$5\)\) `+
+		`FROM job_queue_batch WHERE organization_id = \$6`).
+		WithArgs(v1.StatusQueued, v1.StatusRunning, v1.StatusCompleted, v1.StatusFailed, since, "org-1").
+		WillReturnRows(sqlmock.NewRows([]string{"active", "recent"}).AddRow(30, 12))
+
+	usage, err := repo.FindOrgUsage(context.Background(), "org-1", since)
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), &v1.OrgUsage{ActiveBatches: 30, RecentBatches: 12}, usage)
+}
+
+const (
+	expectedPositionQuery = `SELECT COUNT\(\*\) FROM job_queue_batch b JOIN \(SELECT priority, submit_time FROM job_queue_batch ` +
+		`WHERE job_id = \$1 AND status = \$2 ORDER BY priority, submit_time LIMIT 1\) AS n ` +
+		`ON b.priority < n.priority OR \(b.priority = n.priority AND b.submit_time < n.submit_time\) WHERE b.status = \$3`
+	expectedThroughputQuery = `SELECT AVG\(EXTRACT\(EPOCH FROM complete_time - start_time\)\) FILTER \(WHERE status = \$1\), ` +
+		`COUNT\(DISTINCT aggregator_id\) FILTER \(WHERE status = \$2\) FROM job_queue_batch ` +
+		`WHERE \(\(status = \$3 AND complete_time >= \$4\) OR status = \$5\)`
+)
+
+func (suite *PriorityV1TestSuite) TestFindQueueEstimate() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	since := time.Now().Add(-time.Hour)
+
+	mock.ExpectQuery(expectedPositionQuery).WithArgs("job-1", v1.StatusQueued, v1.StatusQueued).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+	mock.ExpectQuery(expectedThroughputQuery).
+		WithArgs(v1.StatusCompleted, v1.StatusRunning, v1.StatusCompleted, since, v1.StatusRunning).
+		WillReturnRows(sqlmock.NewRows([]string{"avg", "workers"}).AddRow(30.0, 2))
+
+	estimate, err := repo.FindQueueEstimate(context.Background(), "job-1", since)
+
+	// five batches ahead, claimed two at a time, take three rounds of thirty seconds
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 5, estimate.Position)
+	assert.Equal(suite.T(), 90*time.Second, *estimate.EstimatedWait)
+}
+
+func (suite *PriorityV1TestSuite) TestFindQueueEstimateWithoutHistory() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+
+	mock.ExpectQuery(expectedPositionQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(expectedThroughputQuery).WillReturnRows(sqlmock.NewRows([]string{"avg", "workers"}).AddRow(nil, 0))
+
+	estimate, err := repo.FindQueueEstimate(context.Background(), "job-1", time.Now())
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 3, estimate.Position)
+	assert.Nil(suite.T(), estimate.EstimatedWait)
+}
+
+func (suite *PriorityV1TestSuite) TestFindThroughput() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	since := time.Now().Add(-time.Hour)
+	expectedQuery := `SELECT SUM\(array_length\(string_to_array\(patients, ','\), 1\)\) / ` +
+		`NULLIF\(SUM\(EXTRACT\(EPOCH FROM complete_time - start_time\)\), 0\) FROM job_queue_batch ` +
+		`WHERE status = \$1 AND complete_time >= \$2 AND start_time IS NOT NULL`
+
+	mock.ExpectQuery(expectedQuery).WithArgs(v1.StatusCompleted, since).
+		WillReturnRows(sqlmock.NewRows([]string{"throughput"}).AddRow(2.5))
+	mock.ExpectQuery(expectedQuery).WithArgs(v1.StatusCompleted, since).
+		WillReturnRows(sqlmock.NewRows([]string{"throughput"}).AddRow(nil))
+
+	throughput, err := repo.FindThroughput(context.Background(), since)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 2.5, *throughput)
+
+	throughput, err = repo.FindThroughput(context.Background(), since)
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), throughput)
+}
@@ -0,0 +1,112 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/CMSgov/dpc/attribution/model/v1"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// FileRetention is an interface for the retention sweeper to find and purge the files of expired jobs
+type FileRetention interface {
+	FindExpiredJobs(ctx context.Context, policy v1.RetentionPolicy, now time.Time, limit int) ([]v1.ExpiredJob, error)
+	FindBatchesByJobID(id string, orgID string) ([]v1.JobQueueBatch, error)
+	MarkJobFilesPurged(ctx context.Context, jobID string, purgedAt time.Time) error
+}
+
+// OrgRetentionRepo is an interface for admins to override how long the files of an organization are kept
+type OrgRetentionRepo interface {
+	FindRetentionHours(ctx context.Context, orgID string) (*int, error)
+	SaveRetentionHours(ctx context.Context, orgID string, hours int) error
+	DeleteRetentionHours(ctx context.Context, orgID string) error
+}
+
+const unpurgedFilesExpr = `EXISTS (SELECT 1 FROM job_queue_batch_file f WHERE f.job_id = b.job_id AND f.purged_at IS NULL)`
+
+// FindExpiredJobs returns up to limit jobs that still have unpurged files and whose batches all finished longer ago
+// than the retention period of their organization, the hours set in organization_retention or the policy default
+func (jr *JobRepositoryV1) FindExpiredJobs(ctx context.Context, policy v1.RetentionPolicy, now time.Time, limit int) ([]v1.ExpiredJob, error) {
+	sb := sqlFlavor.NewSelectBuilder()
+	sb.Select("b.job_id", "b.organization_id").
+		From("job_queue_batch b").
+		JoinWithOption(sqlbuilder.LeftJoin, "organization_retention r", "r.organization_id = b.organization_id").
+		Where(unpurgedFilesExpr).
+		GroupBy("b.job_id", "b.organization_id", "r.retention_hours").
+		Having(fmt.Sprintf("COUNT(*) FILTER (WHERE %s) = 0", sb.In("b.status", v1.StatusQueued, v1.StatusRunning)),
+			fmt.Sprintf("MAX(b.complete_time) + make_interval(hours => COALESCE(r.retention_hours, %s)) < %s",
+				sb.Var(int(policy.Default.Hours())), sb.Var(now))).
+		OrderBy("MAX(b.complete_time)").
+		Limit(limit)
+	q, args := sb.Build()
+
+	rows, err := jr.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := make([]v1.ExpiredJob, 0)
+	for rows.Next() {
+		var job v1.ExpiredJob
+		if err := rows.Scan(&job.JobID, &job.OrganizationID); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// MarkJobFilesPurged records that the files of the job were deleted, so they are no longer served
+func (jr *JobRepositoryV1) MarkJobFilesPurged(ctx context.Context, jobID string, purgedAt time.Time) error {
+	ub := sqlFlavor.NewUpdateBuilder()
+	ub.Update("job_queue_batch_file").
+		Set(ub.Assign("purged_at", purgedAt)).
+		Where(ub.Equal("job_id", jobID), ub.IsNull("purged_at"))
+	q, args := ub.Build()
+	_, err := jr.db.ExecContext(ctx, q, args...)
+	return err
+}
+
+// FindRetentionHours returns the retention hours set for the organization, or nil when it has the default
+func (jr *JobRepositoryV1) FindRetentionHours(ctx context.Context, orgID string) (*int, error) {
+	sb := sqlFlavor.NewSelectBuilder()
+	sb.Select("retention_hours").
+		From("organization_retention").
+		Where(sb.Equal("organization_id", orgID))
+	q, args := sb.Build()
+
+	var hours int
+	err := jr.db.QueryRowContext(ctx, q, args...).Scan(&hours)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &hours, nil
+}
+
+// SaveRetentionHours creates or replaces the retention hours of the organization
+func (jr *JobRepositoryV1) SaveRetentionHours(ctx context.Context, orgID string, hours int) error {
+	ib := sqlFlavor.NewInsertBuilder()
+	ib.InsertInto("organization_retention").
+		Cols("organization_id", "retention_hours", "updated_at").
+		Values(orgID, hours, time.Now()).
+		SQL("ON CONFLICT (organization_id) DO UPDATE SET retention_hours = EXCLUDED.retention_hours, updated_at = EXCLUDED.updated_at")
+	q, args := ib.Build()
+	_, err := jr.db.ExecContext(ctx, q, args...)
+	return err
+}
+
+// DeleteRetentionHours resets the organization to the default retention period
+func (jr *JobRepositoryV1) DeleteRetentionHours(ctx context.Context, orgID string) error {
+	db := sqlFlavor.NewDeleteBuilder()
+	db.DeleteFrom("organization_retention").
+		Where(db.Equal("organization_id", orgID))
+	q, args := db.Build()
+	_, err := jr.db.ExecContext(ctx, q, args...)
+	return err
+}
@@ -0,0 +1,117 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	v1 "github.com/CMSgov/dpc/attribution/model/v1"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type RetentionV1TestSuite struct {
+	suite.Suite
+}
+
+func TestRetentionV1TestSuite(t *testing.T) {
+	suite.Run(t, new(RetentionV1TestSuite))
+}
+
+func (suite *RetentionV1TestSuite) TestFindExpiredJobs() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	now := time.Now()
+
+	rows := sqlmock.NewRows([]string{"job_id", "organization_id"}).
+		AddRow("job-1", "org-1").
+		AddRow("job-2", "org-3")
+	mock.ExpectQuery(`SELECT b.job_id, b.organization_id FROM job_queue_batch b `+
+		`LEFT JOIN organization_retention r ON r.organization_id = b.organization_id `+
+		`WHERE EXISTS \(SELECT 1 FROM job_queue_batch_file f WHERE f.job_id = b.job_id AND f.purged_at IS NULL\) `+
+		`GROUP BY b.job_id, b.organization_id, r.retention_hours `+
+		`HAVING COUNT\(\*\) FILTER \(WHERE b.status IN \(\$1, \$2\)\) = 0 AND `+
+		`MAX\(b.complete_time\) \+ make_interval\(hours => COALESCE\(r.retention_hours, \$3\)\) < \$4 `+
+		`ORDER BY MAX\(b.complete_time\) LIMIT 10`).
+		WithArgs(v1.StatusQueued, v1.StatusRunning, 24, now).
+		WillReturnRows(rows)
+
+	jobs, err := repo.FindExpiredJobs(context.Background(), v1.RetentionPolicy{Enabled: true, Default: 24 * time.Hour}, now, 10)
+
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+	assert.Equal(suite.T(), []v1.ExpiredJob{{JobID: "job-1", OrganizationID: "org-1"}, {JobID: "job-2", OrganizationID: "org-3"}}, jobs)
+}
+
+const retentionHoursQuery = `SELECT retention_hours FROM organization_retention WHERE organization_id = \$1`
+
+func (suite *RetentionV1TestSuite) TestFindRetentionHours() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+
+	mock.ExpectQuery(retentionHoursQuery).WithArgs("org-1").
+		WillReturnRows(sqlmock.NewRows([]string{"retention_hours"}).AddRow(72))
+
+	hours, err := repo.FindRetentionHours(context.Background(), "org-1")
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 72, *hours)
+}
+
+func (suite *RetentionV1TestSuite) TestFindRetentionHoursDefault() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+
+	mock.ExpectQuery(retentionHoursQuery).WithArgs("org-1").WillReturnError(sql.ErrNoRows)
+
+	hours, err := repo.FindRetentionHours(context.Background(), "org-1")
+
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), hours)
+}
+
+func (suite *RetentionV1TestSuite) TestSaveRetentionHours() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+
+	mock.ExpectExec(`INSERT INTO organization_retention \(organization_id, retention_hours, updated_at\) VALUES \(\$1, \$2, \$3\) `+
+		`ON CONFLICT \(organization_id\) DO UPDATE SET retention_hours = EXCLUDED.retention_hours, updated_at = EXCLUDED.updated_at`).
+		WithArgs("org-1", 72, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.SaveRetentionHours(context.Background(), "org-1", 72)
+
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
+
+func (suite *RetentionV1TestSuite) TestDeleteRetentionHours() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+
+	mock.ExpectExec(`DELETE FROM organization_retention WHERE organization_id = \$1`).
+		WithArgs("org-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.DeleteRetentionHours(context.Background(), "org-1")
+
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
+
+func (suite *RetentionV1TestSuite) TestMarkJobFilesPurged() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	now := time.Now()
+
+	mock.ExpectExec(`UPDATE job_queue_batch_file SET purged_at = \$1 WHERE job_id = \$2 AND purged_at IS NULL`).
+		WithArgs(now, "job-1").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	err := repo.MarkJobFilesPurged(context.Background(), "job-1", now)
+
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
@@ -0,0 +1,260 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/CMSgov/dpc/attribution/model/v1"
+	"github.com/google/uuid"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/pkg/errors"
+)
+
+// ErrWebhookNotFound is returned when an organization has no registered webhook
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// WebhookRepo is an interface for the webhook service to manage the webhook of an organization and list its deliveries
+type WebhookRepo interface {
+	FindWebhook(ctx context.Context, orgID string) (*v1.OrgWebhook, error)
+	SaveWebhook(ctx context.Context, webhook v1.OrgWebhook) error
+	DeleteWebhook(ctx context.Context, orgID string) error
+	FindDeliveries(ctx context.Context, orgID string, limit int) ([]v1.WebhookDelivery, error)
+}
+
+// WebhookQueue is an interface for the webhook dispatcher to queue and send the notifications of finished jobs
+type WebhookQueue interface {
+	FindFinishedJobs(ctx context.Context, since time.Time, limit int) ([]v1.FinishedJob, error)
+	InsertDelivery(ctx context.Context, delivery v1.WebhookDelivery) error
+	ClaimDeliveries(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]v1.WebhookDelivery, error)
+	RecordAttempt(ctx context.Context, id string, attempt v1.DeliveryAttempt) error
+}
+
+// FindWebhook returns the webhook registered for the organization, or ErrWebhookNotFound
+func (jr *JobRepositoryV1) FindWebhook(ctx context.Context, orgID string) (*v1.OrgWebhook, error) {
+	sb := sqlFlavor.NewSelectBuilder()
+	sb.Select("url", "secret", "updated_at").
+		From("organization_webhook").
+		Where(sb.Equal("organization_id", orgID))
+	q, args := sb.Build()
+
+	webhook := &v1.OrgWebhook{OrganizationID: orgID}
+	err := jr.db.QueryRowContext(ctx, q, args...).Scan(&webhook.URL, &webhook.Secret, &webhook.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+// SaveWebhook creates or replaces the webhook of the organization
+func (jr *JobRepositoryV1) SaveWebhook(ctx context.Context, webhook v1.OrgWebhook) error {
+	ib := sqlFlavor.NewInsertBuilder()
+	ib.InsertInto("organization_webhook").
+		Cols("organization_id", "url", "secret", "updated_at").
+		Values(webhook.OrganizationID, webhook.URL, webhook.Secret, webhook.UpdatedAt).
+		SQL("ON CONFLICT (organization_id) DO UPDATE SET url = EXCLUDED.url, secret = EXCLUDED.secret, updated_at = EXCLUDED.updated_at")
+	q, args := ib.Build()
+	_, err := jr.db.ExecContext(ctx, q, args...)
+	return err
+}
+
+// DeleteWebhook removes the webhook of the organization, or returns ErrWebhookNotFound. Its pending deliveries can
+// no longer be signed, so the dispatcher fails them.
+func (jr *JobRepositoryV1) DeleteWebhook(ctx context.Context, orgID string) error {
+	db := sqlFlavor.NewDeleteBuilder()
+	db.DeleteFrom("organization_webhook").
+		Where(db.Equal("organization_id", orgID))
+	q, args := db.Build()
+	res, err := jr.db.ExecContext(ctx, q, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// FindDeliveries returns the latest deliveries of the organization, newest first
+func (jr *JobRepositoryV1) FindDeliveries(ctx context.Context, orgID string, limit int) ([]v1.WebhookDelivery, error) {
+	sb := sqlFlavor.NewSelectBuilder()
+	sb.Select("id", "job_id", "url", "status", "attempts", "next_attempt_at", "last_status_code", "last_error", "created_at", "delivered_at").
+		From("webhook_delivery").
+		Where(sb.Equal("organization_id", orgID)).
+		OrderBy("created_at DESC").
+		Limit(limit)
+	q, args := sb.Build()
+
+	rows, err := jr.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]v1.WebhookDelivery, 0)
+	for rows.Next() {
+		d := v1.WebhookDelivery{OrganizationID: orgID}
+		var statusCode sql.NullInt64
+		var lastError sql.NullString
+		var deliveredAt sql.NullTime
+		if err := rows.Scan(&d.ID, &d.JobID, &d.URL, &d.Status, &d.Attempts, &d.NextAttemptAt, &statusCode, &lastError,
+			&d.CreatedAt, &deliveredAt); err != nil {
+			return nil, err
+		}
+		if statusCode.Valid {
+			code := int(statusCode.Int64)
+			d.LastStatusCode = &code
+		}
+		if lastError.Valid {
+			d.LastError = &lastError.String
+		}
+		if deliveredAt.Valid {
+			d.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// webhookURLExpr is the webhook given at kickoff, which every batch of the job carries, or else the organization's
+const webhookURLExpr = `COALESCE(MAX(b.webhook_url), w.url)`
+
+// FindFinishedJobs returns up to limit jobs that have a webhook but no delivery yet, and whose batches have all
+// finished, the last of them since the given time. Only jobs with a batch completed since then are grouped, so older
+// history is not scanned. Jobs that finished earlier, like those of an organization before it registered its
+// webhook, are never notified.
+func (jr *JobRepositoryV1) FindFinishedJobs(ctx context.Context, since time.Time, limit int) ([]v1.FinishedJob, error) {
+	recent := sqlFlavor.NewSelectBuilder()
+	recent.Select("job_id").
+		From("job_queue_batch").
+		Where(recent.GreaterEqualThan("complete_time", since))
+
+	sb := sqlFlavor.NewSelectBuilder()
+	sb.Select("b.job_id", "b.organization_id", webhookURLExpr, jobStatusExpr, "MAX(b.complete_time)").
+		From("job_queue_batch b").
+		JoinWithOption(sqlbuilder.LeftJoin, "organization_webhook w", "w.organization_id = b.organization_id").
+		Where(sb.In("b.job_id", recent),
+			"NOT EXISTS (SELECT 1 FROM webhook_delivery d WHERE d.job_id = b.job_id)").
+		GroupBy("b.job_id", "b.organization_id", "w.url").
+		Having(fmt.Sprintf("COUNT(*) FILTER (WHERE %s) = 0", sb.In("b.status", v1.StatusQueued, v1.StatusRunning)),
+			webhookURLExpr+" IS NOT NULL").
+		OrderBy("MAX(b.complete_time)").
+		Limit(limit)
+	q, args := sb.Build()
+
+	rows, err := jr.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := make([]v1.FinishedJob, 0)
+	for rows.Next() {
+		var job v1.FinishedJob
+		var status int
+		if err := rows.Scan(&job.JobID, &job.OrganizationID, &job.URL, &status, &job.CompleteTime); err != nil {
+			return nil, err
+		}
+		job.Status = v1.StatusName(status)
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// InsertDelivery queues a delivery, unless the job already has one
+func (jr *JobRepositoryV1) InsertDelivery(ctx context.Context, d v1.WebhookDelivery) error {
+	ib := sqlFlavor.NewInsertBuilder()
+	ib.InsertInto("webhook_delivery").
+		Cols("id", "job_id", "organization_id", "url", "payload", "status", "attempts", "next_attempt_at", "created_at").
+		Values(uuid.New().String(), d.JobID, d.OrganizationID, d.URL, d.Payload, v1.DeliveryPending, 0, d.NextAttemptAt, d.CreatedAt).
+		SQL("ON CONFLICT (job_id) DO NOTHING")
+	q, args := ib.Build()
+	_, err := jr.db.ExecContext(ctx, q, args...)
+	return err
+}
+
+// ClaimDeliveries locks up to limit pending deliveries that are due, skipping those locked by other dispatchers,
+// and leases them until the given time so they are not sent twice. A delivery whose dispatcher stops before
+// recording the attempt is retried once the lease runs out.
+func (jr *JobRepositoryV1) ClaimDeliveries(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]v1.WebhookDelivery, error) {
+	tx, err := jr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sb := sqlFlavor.NewSelectBuilder()
+	sb.Select("d.id", "d.job_id", "d.organization_id", "d.url", "d.payload", "d.attempts", "d.created_at", "w.secret").
+		From("webhook_delivery d").
+		JoinWithOption(sqlbuilder.LeftJoin, "organization_webhook w", "w.organization_id = d.organization_id").
+		Where(sb.Equal("d.status", v1.DeliveryPending), sb.LessEqualThan("d.next_attempt_at", now)).
+		OrderBy("d.next_attempt_at").
+		Limit(limit).
+		ForUpdate().
+		SQL("OF d SKIP LOCKED")
+	q, args := sb.Build()
+
+	rows, err := tx.QueryContext(ctx, q, args...)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	deliveries := make([]v1.WebhookDelivery, 0)
+	ids := make([]interface{}, 0)
+	for rows.Next() {
+		d := v1.WebhookDelivery{Status: v1.DeliveryPending, NextAttemptAt: leaseUntil}
+		var secret sql.NullString
+		if err := rows.Scan(&d.ID, &d.JobID, &d.OrganizationID, &d.URL, &d.Payload, &d.Attempts, &d.CreatedAt, &secret); err != nil {
+			_ = rows.Close()
+			_ = tx.Rollback()
+			return nil, err
+		}
+		d.Secret = secret.String
+		deliveries = append(deliveries, d)
+		ids = append(ids, d.ID)
+	}
+	_ = rows.Close()
+	if len(deliveries) == 0 {
+		return deliveries, tx.Rollback()
+	}
+
+	ub := sqlFlavor.NewUpdateBuilder()
+	ub.Update("webhook_delivery").
+		Set(ub.Assign("next_attempt_at", leaseUntil)).
+		Where(ub.In("id", ids...))
+	q, args = ub.Build()
+	if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// RecordAttempt counts an attempt to send the delivery and saves its outcome to the delivery log
+func (jr *JobRepositoryV1) RecordAttempt(ctx context.Context, id string, attempt v1.DeliveryAttempt) error {
+	ub := sqlFlavor.NewUpdateBuilder()
+	ub.Update("webhook_delivery").
+		Set(ub.Assign("status", attempt.Status),
+			ub.Incr("attempts"),
+			ub.Assign("next_attempt_at", attempt.NextAttemptAt),
+			ub.Assign("last_status_code", attempt.StatusCode),
+			ub.Assign("last_error", attempt.Error))
+	if attempt.Status == v1.DeliveryDelivered {
+		ub.SetMore(ub.Assign("delivered_at", attempt.At))
+	}
+	ub.Where(ub.Equal("id", id))
+	q, args := ub.Build()
+	_, err := jr.db.ExecContext(ctx, q, args...)
+	return err
+}
@@ -0,0 +1,212 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	v1 "github.com/CMSgov/dpc/attribution/model/v1"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type WebhookV1TestSuite struct {
+	suite.Suite
+}
+
+func TestWebhookV1TestSuite(t *testing.T) {
+	suite.Run(t, new(WebhookV1TestSuite))
+}
+
+func (suite *WebhookV1TestSuite) TestFindWebhook() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	now := time.Now()
+
+	query := `SELECT url, secret, updated_at FROM organization_webhook WHERE organization_id = \$1`
+	mock.ExpectQuery(query).WithArgs("org-1").
+		WillReturnRows(sqlmock.NewRows([]string{"url", "secret", "updated_at"}).AddRow("https://example.com/hook", "secret", now))
+	mock.ExpectQuery(query).WithArgs("org-2").WillReturnError(sql.ErrNoRows)
+
+	webhook, err := repo.FindWebhook(context.Background(), "org-1")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), &v1.OrgWebhook{OrganizationID: "org-1", URL: "https://example.com/hook", Secret: "secret", UpdatedAt: now}, webhook)
+
+	webhook, err = repo.FindWebhook(context.Background(), "org-2")
+	assert.Equal(suite.T(), ErrWebhookNotFound, err)
+	assert.Nil(suite.T(), webhook)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
+
+func (suite *WebhookV1TestSuite) TestSaveWebhook() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	webhook := v1.OrgWebhook{OrganizationID: "org-1", URL: "https://example.com/hook", Secret: "secret", UpdatedAt: time.Now()}
+
+	mock.ExpectExec(`INSERT INTO organization_webhook \(organization_id, url, secret, updated_at\) VALUES \(\$1, \$2, \$3, \$4\) `+
+		`ON CONFLICT \(organization_id\) DO UPDATE SET url = EXCLUDED.url, secret = EXCLUDED.secret, updated_at = EXCLUDED.updated_at`).
+		WithArgs("org-1", "https://example.com/hook", "secret", webhook.UpdatedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.SaveWebhook(context.Background(), webhook)
+
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
+
+func (suite *WebhookV1TestSuite) TestDeleteWebhook() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+
+	query := `DELETE FROM organization_webhook WHERE organization_id = \$1`
+	mock.ExpectExec(query).WithArgs("org-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(query).WithArgs("org-2").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(suite.T(), repo.DeleteWebhook(context.Background(), "org-1"))
+	assert.Equal(suite.T(), ErrWebhookNotFound, repo.DeleteWebhook(context.Background(), "org-2"))
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
+
+func (suite *WebhookV1TestSuite) TestFindDeliveries() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	now := time.Now()
+
+	rows := sqlmock.NewRows([]string{"id", "job_id", "url", "status", "attempts", "next_attempt_at", "last_status_code", "last_error", "created_at", "delivered_at"}).
+		AddRow("d-1", "job-1", "https://example.com/hook", v1.DeliveryDelivered, 1, now, 204, nil, now, now).
+		AddRow("d-2", "job-2", "https://example.com/hook", v1.DeliveryPending, 2, now, nil, "connection refused", now, nil)
+	mock.ExpectQuery(`SELECT id, job_id, url, status, attempts, next_attempt_at, last_status_code, last_error, created_at, delivered_at ` +
+		`FROM webhook_delivery WHERE organization_id = \$1 ORDER BY created_at DESC LIMIT 10`).
+		WithArgs("org-1").
+		WillReturnRows(rows)
+
+	deliveries, err := repo.FindDeliveries(context.Background(), "org-1", 10)
+
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+	assert.Len(suite.T(), deliveries, 2)
+	assert.Equal(suite.T(), 204, *deliveries[0].LastStatusCode)
+	assert.Nil(suite.T(), deliveries[0].LastError)
+	assert.Equal(suite.T(), now, *deliveries[0].DeliveredAt)
+	assert.Nil(suite.T(), deliveries[1].LastStatusCode)
+	assert.Equal(suite.T(), "connection refused", *deliveries[1].LastError)
+	assert.Nil(suite.T(), deliveries[1].DeliveredAt)
+}
+
+func (suite *WebhookV1TestSuite) TestFindFinishedJobs() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	since := time.Now().Add(-24 * time.Hour)
+	completeTime := time.Now()
+
+	rows := sqlmock.NewRows([]string{"job_id", "organization_id", "url", "status", "complete_time"}).
+		AddRow("job-1", "org-1", "https://example.com/hook", v1.StatusCompleted, completeTime).
+		AddRow("job-2", "org-1", "https://example.com/job", v1.StatusCancelled, completeTime)
+	mock.ExpectQuery(`SELECT b.job_id, b.organization_id, COALESCE\(MAX\(b.webhook_url\), w.url\), CASE .* END, MAX\(b.complete_time\) `+
+		`FROM job_queue_batch b LEFT JOIN organization_webhook w ON w.organization_id = b.organization_id `+
+		`WHERE b.job_id IN \(SELECT job_id FROM job_queue_batch WHERE complete_time >= \$1\) AND `+
+		`NOT EXISTS \(SELECT 1 FROM webhook_delivery d WHERE d.job_id = b.job_id\) GROUP BY b.job_id, b.organization_id, w.url `+
+		`HAVING COUNT\(\*\) FILTER \(WHERE b.status IN \(\$2, \$3\)\) = 0 AND `+
+		`COALESCE\(MAX\(b.webhook_url\), w.url\) IS NOT NULL ORDER BY MAX\(b.complete_time\) LIMIT 5`).
+		WithArgs(since, v1.StatusQueued, v1.StatusRunning).
+		WillReturnRows(rows)
+
+	jobs, err := repo.FindFinishedJobs(context.Background(), since, 5)
+
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+	assert.Equal(suite.T(), []v1.FinishedJob{
+		{JobID: "job-1", OrganizationID: "org-1", URL: "https://example.com/hook", Status: "COMPLETED", CompleteTime: completeTime},
+		{JobID: "job-2", OrganizationID: "org-1", URL: "https://example.com/job", Status: "CANCELLED", CompleteTime: completeTime},
+	}, jobs)
+}
+
+func (suite *WebhookV1TestSuite) TestInsertDelivery() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	now := time.Now()
+
+	mock.ExpectExec(`INSERT INTO webhook_delivery \(id, job_id, organization_id, url, payload, status, attempts, next_attempt_at, created_at\) `+
+		`VALUES \(\$1, \$2, \$3, \$4, \$5, \$6, \$7, \$8, \$9\) ON CONFLICT \(job_id\) DO NOTHING`).
+		WithArgs(sqlmock.AnyArg(), "job-1", "org-1", "https://example.com/hook", "{}", v1.DeliveryPending, 0, now, now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.InsertDelivery(context.Background(), v1.WebhookDelivery{JobID: "job-1", OrganizationID: "org-1",
+		URL: "https://example.com/hook", Payload: "{}", NextAttemptAt: now, CreatedAt: now})
+
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
+
+const claimDeliveriesQuery = `SELECT d.id, d.job_id, d.organization_id, d.url, d.payload, d.attempts, d.created_at, w.secret ` +
+	`FROM webhook_delivery d LEFT JOIN organization_webhook w ON w.organization_id = d.organization_id ` +
+	`WHERE d.status = \$1 AND d.next_attempt_at <= \$2 ORDER BY d.next_attempt_at LIMIT 10 FOR UPDATE OF d SKIP LOCKED`
+
+func (suite *WebhookV1TestSuite) TestClaimDeliveries() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	now := time.Now()
+	lease := now.Add(time.Minute)
+
+	rows := sqlmock.NewRows([]string{"id", "job_id", "organization_id", "url", "payload", "attempts", "created_at", "secret"}).
+		AddRow("d-1", "job-1", "org-1", "https://example.com/hook", "{}", 0, now, "secret").
+		AddRow("d-2", "job-2", "org-2", "https://example.com/hook", "{}", 3, now, nil)
+	mock.ExpectBegin()
+	mock.ExpectQuery(claimDeliveriesQuery).WithArgs(v1.DeliveryPending, now).WillReturnRows(rows)
+	mock.ExpectExec(`UPDATE webhook_delivery SET next_attempt_at = \$1 WHERE id IN \(\$2, \$3\)`).
+		WithArgs(lease, "d-1", "d-2").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	deliveries, err := repo.ClaimDeliveries(context.Background(), now, lease, 10)
+
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+	assert.Len(suite.T(), deliveries, 2)
+	assert.Equal(suite.T(), "secret", deliveries[0].Secret)
+	assert.Equal(suite.T(), lease, deliveries[0].NextAttemptAt)
+	assert.Equal(suite.T(), 3, deliveries[1].Attempts)
+	assert.Empty(suite.T(), deliveries[1].Secret)
+}
+
+func (suite *WebhookV1TestSuite) TestClaimDeliveriesNoneDue() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(claimDeliveriesQuery).WithArgs(v1.DeliveryPending, now).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "job_id", "organization_id", "url", "payload", "attempts", "created_at", "secret"}))
+	mock.ExpectRollback()
+
+	deliveries, err := repo.ClaimDeliveries(context.Background(), now, now.Add(time.Minute), 10)
+
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+	assert.Empty(suite.T(), deliveries)
+}
+
+func (suite *WebhookV1TestSuite) TestRecordAttempt() {
+	db, mock := newMock()
+	repo := NewJobRepo(db)
+	now := time.Now()
+	code := 500
+	msg := "webhook responded with status 500"
+
+	mock.ExpectExec(`UPDATE webhook_delivery SET status = \$1, attempts = attempts \+ 1, next_attempt_at = \$2, last_status_code = \$3, last_error = \$4 WHERE id = \$5`).
+		WithArgs(v1.DeliveryPending, now.Add(time.Minute), code, msg, "d-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE webhook_delivery SET status = \$1, attempts = attempts \+ 1, next_attempt_at = \$2, last_status_code = \$3, last_error = \$4, delivered_at = \$5 WHERE id = \$6`).
+		WithArgs(v1.DeliveryDelivered, now, 200, nil, now, "d-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.RecordAttempt(context.Background(), "d-1", v1.DeliveryAttempt{Status: v1.DeliveryPending, StatusCode: &code, Error: &msg, NextAttemptAt: now.Add(time.Minute), At: now})
+	assert.NoError(suite.T(), err)
+
+	ok := 200
+	err = repo.RecordAttempt(context.Background(), "d-1", v1.DeliveryAttempt{Status: v1.DeliveryDelivered, StatusCode: &ok, NextAttemptAt: now, At: now})
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), mock.ExpectationsWereMet())
+}
@@ -13,7 +13,7 @@ import (
 )
 
 // NewDPCAttributionRouter function to build the attribution router
-func NewDPCAttributionRouter(o service.Service, g service.Service, impl service.Service, implOrg service.Service, d v1.DataService, js v1.JobService) http.Handler {
+func NewDPCAttributionRouter(o service.Service, g service.ListService, impl service.Service, implOrg service.Service, d v1.DataService, js v1.JobService, ps v1.OrgPriorityService, rts v1.OrgRetentionService, ws v1.WebhookService, es v1.ExportScheduleService) http.Handler {
 	r := chi.NewRouter()
 	r.Use(middleware2.Logging())
 	r.Use(middleware.SetHeader("Content-Type", "application/json; charset=UTF-8"))
@@ -25,11 +25,17 @@ func NewDPCAttributionRouter(o service.Service, g service.Service, impl service.
 				r.Get("/", o.Get)
 				r.Delete("/", o.Delete)
 				r.Put("/", o.Put)
+				r.Get("/priority", ps.Get)
+				r.Put("/priority", ps.Put)
+				r.Get("/retention", rts.Get)
+				r.Put("/retention", rts.Put)
+				r.Delete("/retention", rts.Delete)
 			})
 			r.Post("/", o.Post)
 		})
 		r.Route("/Group", func(r chi.Router) {
 			r.Use(middleware2.AuthCtx)
+			r.Get("/", g.List)
 			r.Post("/", g.Post)
 			r.Route("/{groupID}", func(r chi.Router) {
 				r.Use(middleware2.GroupCtx)
@@ -56,6 +62,26 @@ func NewDPCAttributionRouter(o service.Service, g service.Service, impl service.
 			})
 		})
 
+		r.Route("/Webhook", func(r chi.Router) {
+			r.Use(middleware2.AuthCtx)
+			r.Get("/", ws.Get)
+			r.Put("/", ws.Put)
+			r.Delete("/", ws.Delete)
+			r.Get("/deliveries", ws.Deliveries)
+		})
+
+		r.Route("/ExportSchedule", func(r chi.Router) {
+			r.Use(middleware2.AuthCtx)
+			r.Get("/", es.List)
+			r.Post("/", es.Post)
+			r.Route("/{scheduleID}", func(r chi.Router) {
+				r.Use(middleware2.ExportScheduleCtx)
+				r.Get("/", es.Get)
+				r.Put("/", es.Put)
+				r.Delete("/", es.Delete)
+			})
+		})
+
 		//Go away once shared job service
 		r.Route("/Data", func(r chi.Router) {
 			r.Use(middleware2.AuthCtx)
@@ -65,7 +91,9 @@ func NewDPCAttributionRouter(o service.Service, g service.Service, impl service.
 		//Go away once shared job service
 		r.Route("/Job", func(r chi.Router) {
 			r.Use(middleware2.AuthCtx)
+			r.Get("/", js.List)
 			r.With(middleware2.JobCtx).Get("/{jobID}", js.BatchesAndFiles)
+			r.With(middleware2.JobCtx).Delete("/{jobID}", js.Cancel)
 			r.Post("/", js.Export)
 		})
 	})
@@ -1,6 +1,7 @@
 package router
 
 import (
+	"context"
 	"github.com/bxcodec/faker/v3"
 	"io"
 	"io/ioutil"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/CMSgov/dpc/attribution/attributiontest"
 	middleware2 "github.com/CMSgov/dpc/attribution/middleware"
+	v1 "github.com/CMSgov/dpc/attribution/model/v1"
 	"github.com/darahayes/go-boom"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -37,6 +39,10 @@ func (ms *MockService) Put(w http.ResponseWriter, r *http.Request) {
 	ms.Called(w, r)
 }
 
+func (ms *MockService) List(w http.ResponseWriter, r *http.Request) {
+	ms.Called(w, r)
+}
+
 func (ms *MockService) Export(w http.ResponseWriter, r *http.Request) {
 	ms.Called(w, r)
 }
@@ -61,6 +67,67 @@ func (mjs *MockJobService) Export(w http.ResponseWriter, r *http.Request) {
 	mjs.Called(w, r)
 }
 
+func (mjs *MockJobService) Cancel(w http.ResponseWriter, r *http.Request) {
+	mjs.Called(w, r)
+}
+
+func (mjs *MockJobService) List(w http.ResponseWriter, r *http.Request) {
+	mjs.Called(w, r)
+}
+
+func (mjs *MockJobService) StartJob(ctx context.Context, orgID string, er v1.ExportRequest, url string, ip string) (*string, bool, error) {
+	args := mjs.Called(ctx, orgID, er, url, ip)
+	return args.Get(0).(*string), args.Bool(1), args.Error(2)
+}
+
+type MockOrgPriorityService struct {
+	mock.Mock
+}
+
+func (mss *MockOrgPriorityService) Get(w http.ResponseWriter, r *http.Request) {
+	mss.Called(w, r)
+}
+
+func (mss *MockOrgPriorityService) Put(w http.ResponseWriter, r *http.Request) {
+	mss.Called(w, r)
+}
+
+type MockOrgRetentionService struct {
+	mock.Mock
+}
+
+func (mrs *MockOrgRetentionService) Get(w http.ResponseWriter, r *http.Request) {
+	mrs.Called(w, r)
+}
+
+func (mrs *MockOrgRetentionService) Put(w http.ResponseWriter, r *http.Request) {
+	mrs.Called(w, r)
+}
+
+func (mrs *MockOrgRetentionService) Delete(w http.ResponseWriter, r *http.Request) {
+	mrs.Called(w, r)
+}
+
+type MockWebhookService struct {
+	mock.Mock
+}
+
+func (mws *MockWebhookService) Get(w http.ResponseWriter, r *http.Request) {
+	mws.Called(w, r)
+}
+
+func (mws *MockWebhookService) Put(w http.ResponseWriter, r *http.Request) {
+	mws.Called(w, r)
+}
+
+func (mws *MockWebhookService) Delete(w http.ResponseWriter, r *http.Request) {
+	mws.Called(w, r)
+}
+
+func (mws *MockWebhookService) Deliveries(w http.ResponseWriter, r *http.Request) {
+	mws.Called(w, r)
+}
+
 type RouterTestSuite struct {
 	suite.Suite
 	router                http.Handler
@@ -70,6 +137,10 @@ type RouterTestSuite struct {
 	mockImplementerOrgRel *MockService
 	mockData              *MockDataService
 	mockJob               *MockJobService
+	mockPriority          *MockOrgPriorityService
+	mockRetention         *MockOrgRetentionService
+	mockWebhook           *MockWebhookService
+	mockExportSchedule    *MockService
 }
 
 func TestRouterTestSuite(t *testing.T) {
@@ -81,7 +152,11 @@ func (suite *RouterTestSuite) SetupTest() {
 	suite.mockGroup = &MockService{}
 	suite.mockData = &MockDataService{}
 	suite.mockJob = &MockJobService{}
-	suite.router = NewDPCAttributionRouter(suite.mockOrg, suite.mockGroup, suite.mockImplementer, suite.mockImplementerOrgRel, suite.mockData, suite.mockJob)
+	suite.mockPriority = &MockOrgPriorityService{}
+	suite.mockRetention = &MockOrgRetentionService{}
+	suite.mockWebhook = &MockWebhookService{}
+	suite.mockExportSchedule = &MockService{}
+	suite.router = NewDPCAttributionRouter(suite.mockOrg, suite.mockGroup, suite.mockImplementer, suite.mockImplementerOrgRel, suite.mockData, suite.mockJob, suite.mockPriority, suite.mockRetention, suite.mockWebhook, suite.mockExportSchedule)
 }
 
 func (suite *RouterTestSuite) do(httpMethod string, route string, body io.Reader, headers map[string]string) *http.Response {
@@ -180,6 +255,117 @@ func (suite *RouterTestSuite) TestOrganizationPutRoute() {
 	assert.Equal(suite.T(), http.StatusMethodNotAllowed, res.StatusCode)
 }
 
+func (suite *RouterTestSuite) TestOrganizationPriorityRoutes() {
+	suite.mockPriority.On("Get", mock.Anything, mock.Anything).Once().Run(func(arg mock.Arguments) {
+		w := arg.Get(0).(http.ResponseWriter)
+		_, _ = w.Write([]byte(`{"organizationID":"1234","tier":"standard","maxConcurrentBatches":0}`))
+		r := arg.Get(1).(*http.Request)
+		assert.Equal(suite.T(), "1234", r.Context().Value(middleware2.ContextKeyOrganization))
+	})
+	suite.mockPriority.On("Put", mock.Anything, mock.Anything).Once().Run(func(arg mock.Arguments) {
+		w := arg.Get(0).(http.ResponseWriter)
+		_, _ = w.Write([]byte(`{"organizationID":"1234","tier":"high","maxConcurrentBatches":4}`))
+		r := arg.Get(1).(*http.Request)
+		assert.Equal(suite.T(), "1234", r.Context().Value(middleware2.ContextKeyOrganization))
+	})
+
+	res := suite.do(http.MethodGet, "/Organization/1234/priority", nil, nil)
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+
+	res = suite.do(http.MethodPut, "/Organization/1234/priority", strings.NewReader(`{"tier":"high","maxConcurrentBatches":4}`), nil)
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+
+	res = suite.do(http.MethodPost, "/Organization/1234/priority", nil, nil)
+	assert.Equal(suite.T(), http.StatusMethodNotAllowed, res.StatusCode)
+}
+
+func (suite *RouterTestSuite) TestOrganizationRetentionRoutes() {
+	for _, method := range []string{"Get", "Put", "Delete"} {
+		suite.mockRetention.On(method, mock.Anything, mock.Anything).Once().Run(func(arg mock.Arguments) {
+			r := arg.Get(1).(*http.Request)
+			assert.Equal(suite.T(), "1234", r.Context().Value(middleware2.ContextKeyOrganization))
+		})
+	}
+
+	res := suite.do(http.MethodGet, "/Organization/1234/retention", nil, nil)
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+
+	res = suite.do(http.MethodPut, "/Organization/1234/retention", strings.NewReader(`{"hours":72}`), nil)
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+
+	res = suite.do(http.MethodDelete, "/Organization/1234/retention", nil, nil)
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+
+	res = suite.do(http.MethodPost, "/Organization/1234/retention", nil, nil)
+	assert.Equal(suite.T(), http.StatusMethodNotAllowed, res.StatusCode)
+	suite.mockRetention.AssertExpectations(suite.T())
+}
+
+func (suite *RouterTestSuite) TestWebhookRoutes() {
+	for _, method := range []string{"Get", "Put", "Delete", "Deliveries"} {
+		suite.mockWebhook.On(method, mock.Anything, mock.Anything).Once().Run(func(arg mock.Arguments) {
+			w := arg.Get(0).(http.ResponseWriter)
+			w.WriteHeader(http.StatusOK)
+			r := arg.Get(1).(*http.Request)
+			assert.Equal(suite.T(), "12345", r.Context().Value(middleware2.ContextKeyOrganization))
+		})
+	}
+	headers := map[string]string{middleware2.OrgHeader: "12345"}
+
+	res := suite.do(http.MethodGet, "/Webhook", nil, headers)
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+
+	res = suite.do(http.MethodPut, "/Webhook", strings.NewReader(`{"url":"https://example.com/hook"}`), headers)
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+
+	res = suite.do(http.MethodDelete, "/Webhook", nil, headers)
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+
+	res = suite.do(http.MethodGet, "/Webhook/deliveries", nil, headers)
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+
+	suite.mockWebhook.AssertExpectations(suite.T())
+}
+
+func (suite *RouterTestSuite) TestExportScheduleRoutes() {
+	for _, method := range []string{"List", "Post"} {
+		suite.mockExportSchedule.On(method, mock.Anything, mock.Anything).Once().Run(func(arg mock.Arguments) {
+			w := arg.Get(0).(http.ResponseWriter)
+			w.WriteHeader(http.StatusOK)
+			r := arg.Get(1).(*http.Request)
+			assert.Equal(suite.T(), "12345", r.Context().Value(middleware2.ContextKeyOrganization))
+		})
+	}
+	for _, method := range []string{"Get", "Put", "Delete"} {
+		suite.mockExportSchedule.On(method, mock.Anything, mock.Anything).Once().Run(func(arg mock.Arguments) {
+			w := arg.Get(0).(http.ResponseWriter)
+			w.WriteHeader(http.StatusOK)
+			r := arg.Get(1).(*http.Request)
+			assert.Equal(suite.T(), "12345", r.Context().Value(middleware2.ContextKeyOrganization))
+			assert.Equal(suite.T(), "54321", r.Context().Value(middleware2.ContextKeyExportSchedule))
+		})
+	}
+	headers := map[string]string{middleware2.OrgHeader: "12345"}
+	body := `{"groupID":"67890","frequency":"DAILY","type":"Patient"}`
+
+	res := suite.do(http.MethodGet, "/ExportSchedule", nil, headers)
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+
+	res = suite.do(http.MethodPost, "/ExportSchedule", strings.NewReader(body), headers)
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+
+	res = suite.do(http.MethodGet, "/ExportSchedule/54321", nil, headers)
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+
+	res = suite.do(http.MethodPut, "/ExportSchedule/54321", strings.NewReader(body), headers)
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+
+	res = suite.do(http.MethodDelete, "/ExportSchedule/54321", nil, headers)
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+
+	suite.mockExportSchedule.AssertExpectations(suite.T())
+}
+
 func (suite *RouterTestSuite) TestGroupPostRoute() {
 	suite.mockGroup.On("Post", mock.Anything, mock.Anything).Once().Run(func(arg mock.Arguments) {
 		w := arg.Get(0).(http.ResponseWriter)
@@ -205,6 +391,21 @@ func (suite *RouterTestSuite) TestGroupPostRoute() {
 	assert.Equal(suite.T(), http.StatusInternalServerError, res.StatusCode)
 }
 
+func (suite *RouterTestSuite) TestGroupListRoute() {
+	suite.mockGroup.On("List", mock.Anything, mock.Anything).Once().Run(func(arg mock.Arguments) {
+		w := arg.Get(0).(http.ResponseWriter)
+		_, _ = w.Write([]byte("[]"))
+		r := arg.Get(1).(*http.Request)
+		assert.Equal(suite.T(), "12345", r.Context().Value(middleware2.ContextKeyOrganization))
+	})
+
+	res := suite.do(http.MethodGet, "/Group", nil, map[string]string{middleware2.OrgHeader: "12345"})
+	assert.Equal(suite.T(), "application/json; charset=UTF-8", res.Header.Get("Content-Type"))
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+	b, _ := ioutil.ReadAll(res.Body)
+	assert.Equal(suite.T(), "[]", string(b))
+}
+
 func (suite *RouterTestSuite) TestGroupExportRoute() {
 	fakeUrl := faker.URL()
 	fakeIP := faker.IPv4()
@@ -224,3 +425,29 @@ func (suite *RouterTestSuite) TestGroupExportRoute() {
 	b, _ := ioutil.ReadAll(res.Body)
 	assert.Equal(suite.T(), string(b), fakeJobID)
 }
+
+func (suite *RouterTestSuite) TestJobListRoute() {
+	suite.mockJob.On("List", mock.Anything, mock.Anything).Once().Run(func(arg mock.Arguments) {
+		w := arg.Get(0).(http.ResponseWriter)
+		r := arg.Get(1).(*http.Request)
+		assert.Equal(suite.T(), "12345", r.Context().Value(middleware2.ContextKeyOrganization))
+		assert.Equal(suite.T(), "COMPLETED", r.URL.Query().Get("status"))
+		_, _ = w.Write([]byte(`{"jobs":[],"hasMore":false}`))
+	})
+
+	res := suite.do(http.MethodGet, "/Job?status=COMPLETED", nil, map[string]string{middleware2.OrgHeader: "12345"})
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+}
+
+func (suite *RouterTestSuite) TestJobCancelRoute() {
+	suite.mockJob.On("Cancel", mock.Anything, mock.Anything).Once().Run(func(arg mock.Arguments) {
+		w := arg.Get(0).(http.ResponseWriter)
+		w.WriteHeader(http.StatusNoContent)
+		r := arg.Get(1).(*http.Request)
+		assert.Equal(suite.T(), "12345", r.Context().Value(middleware2.ContextKeyOrganization))
+		assert.Equal(suite.T(), "54321", r.Context().Value(middleware2.ContextKeyJobID))
+	})
+
+	res := suite.do(http.MethodDelete, "/Job/54321", nil, map[string]string{middleware2.OrgHeader: "12345"})
+	assert.Equal(suite.T(), http.StatusNoContent, res.StatusCode)
+}
@@ -80,6 +80,30 @@ func (gs *GroupService) Get(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// List function is to get all of the groups for an organization
+func (gs *GroupService) List(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+
+	groups, err := gs.repo.FindByOrganization(r.Context())
+	if err != nil {
+		log.Error("Failed to get groups", zap.Error(err))
+		boom.BadData(w, err)
+		return
+	}
+
+	groupBytes := new(bytes.Buffer)
+	if err := json.NewEncoder(groupBytes).Encode(groups); err != nil {
+		log.Error("Failed to convert orm model to bytes for groups", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return
+	}
+
+	if _, err := w.Write(groupBytes.Bytes()); err != nil {
+		log.Error("Failed to write groups to response", zap.Error(err))
+		boom.Internal(w, err.Error())
+	}
+}
+
 // Delete function is not currently used for v2.GroupService
 func (gs *GroupService) Delete(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNotImplemented)
@@ -41,6 +41,14 @@ func (m *MockGrpRepo) FindByID(ctx context.Context, id string) (*model.Group, er
 	return args.Get(0).(*model.Group), args.Error(1)
 }
 
+func (m *MockGrpRepo) FindByOrganization(ctx context.Context) ([]model.Group, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.Group), args.Error(1)
+}
+
 type GroupServiceTestSuite struct {
 	suite.Suite
 	repo    *MockGrpRepo
@@ -152,6 +160,36 @@ func (suite *GroupServiceTestSuite) TestGetError() {
     }`)
 }
 
+func (suite *GroupServiceTestSuite) TestList() {
+	g := attributiontest.GroupResponse()
+	suite.repo.On("FindByOrganization", mock.Anything).Return([]model.Group{*g}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	ctx := context.WithValue(req.Context(), middleware2.ContextKeyOrganization, "12345")
+	req = req.WithContext(ctx)
+
+	w := httptest.NewRecorder()
+	suite.service.List(w, req)
+	res := w.Result()
+
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+	var groups []model.Group
+	_ = json.NewDecoder(res.Body).Decode(&groups)
+	assert.Len(suite.T(), groups, 1)
+	assert.Equal(suite.T(), g.ID, groups[0].ID)
+}
+
+func (suite *GroupServiceTestSuite) TestListError() {
+	suite.repo.On("FindByOrganization", mock.Anything).Return(nil, errors.New("error"))
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	w := httptest.NewRecorder()
+	suite.service.List(w, req)
+	res := w.Result()
+
+	assert.Equal(suite.T(), http.StatusUnprocessableEntity, res.StatusCode)
+}
+
 func (suite *GroupServiceTestSuite) TestDeleteNotImplemented() {
 	req := httptest.NewRequest(http.MethodDelete, "http://example.com/foo", nil)
 	w := httptest.NewRecorder()
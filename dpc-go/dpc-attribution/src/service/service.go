@@ -9,3 +9,9 @@ type Service interface {
 	Delete(w http.ResponseWriter, r *http.Request)
 	Put(w http.ResponseWriter, r *http.Request)
 }
+
+// ListService is an interface for services that can also list all of an organization's resources
+type ListService interface {
+	Service
+	List(w http.ResponseWriter, r *http.Request)
+}
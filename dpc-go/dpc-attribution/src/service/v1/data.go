@@ -10,6 +10,7 @@ import (
 	"github.com/CMSgov/dpc/attribution/repository/v1"
 	"github.com/CMSgov/dpc/attribution/util"
 	"github.com/darahayes/go-boom"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
@@ -37,6 +38,10 @@ func (ds *DataServiceV1) GetFileInfo(w http.ResponseWriter, r *http.Request) {
 	orgID := util.FetchValueFromContext(r.Context(), w, middleware.ContextKeyOrganization)
 
 	fi, err := ds.jr.GetFileInfo(r.Context(), orgID, fileName)
+	if errors.Is(err, v1.ErrFilePurged) {
+		boom.ResourceGone(w, fmt.Sprintf("File %s has expired and was deleted", fileName))
+		return
+	}
 	if err != nil {
 		log.Error(fmt.Sprintf("File name: %s is not valid", fileName), zap.Error(err))
 		boom.BadRequest(w, "file name doesn't check out")
@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/CMSgov/dpc/attribution/middleware"
 	v1 "github.com/CMSgov/dpc/attribution/model/v1"
+	v1Repo "github.com/CMSgov/dpc/attribution/repository/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
@@ -54,3 +55,17 @@ func (suite *DataServiceTestSuite) TestGetFileInfo() {
 	//Everything happy
 	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
 }
+
+func (suite *DataServiceTestSuite) TestGetFileInfoPurged() {
+	r := httptest.NewRequest(http.MethodGet, "http://blah.com", nil)
+	ctx := context.WithValue(r.Context(), middleware.ContextKeyFileName, "fileName")
+	ctx = context.WithValue(ctx, middleware.ContextKeyOrganization, "12345")
+	r = r.WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	suite.jobRepo.On("GetFileInfo", mock.Anything, "12345", "fileName").Return((*v1.FileInfo)(nil), v1Repo.ErrFilePurged)
+
+	suite.service.GetFileInfo(w, r)
+
+	assert.Equal(suite.T(), http.StatusGone, w.Result().StatusCode)
+}
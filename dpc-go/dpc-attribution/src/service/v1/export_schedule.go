@@ -0,0 +1,240 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CMSgov/dpc/attribution/conf"
+	"github.com/CMSgov/dpc/attribution/logger"
+	"github.com/CMSgov/dpc/attribution/middleware"
+	"github.com/CMSgov/dpc/attribution/model/v1"
+	"github.com/CMSgov/dpc/attribution/repository"
+	v1Repo "github.com/CMSgov/dpc/attribution/repository/v1"
+	"github.com/CMSgov/dpc/attribution/util"
+	"github.com/darahayes/go-boom"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// ExportScheduleService is an interface for testing to be able to mock the services in the router test
+type ExportScheduleService interface {
+	List(w http.ResponseWriter, r *http.Request)
+	Post(w http.ResponseWriter, r *http.Request)
+	Get(w http.ResponseWriter, r *http.Request)
+	Put(w http.ResponseWriter, r *http.Request)
+	Delete(w http.ResponseWriter, r *http.Request)
+}
+
+// ExportScheduleServiceV1 is a struct that defines what the service has
+type ExportScheduleServiceV1 struct {
+	sr v1Repo.ExportScheduleRepo
+	gr repository.GroupRepo
+	wr v1Repo.WebhookRepo
+}
+
+// NewExportScheduleService creates a service for organizations to manage the group exports run on a schedule
+func NewExportScheduleService(sr v1Repo.ExportScheduleRepo, gr repository.GroupRepo, wr v1Repo.WebhookRepo) ExportScheduleService {
+	return &ExportScheduleServiceV1{
+		sr,
+		gr,
+		wr,
+	}
+}
+
+// List function returns the export schedules of the organization
+func (ss *ExportScheduleServiceV1) List(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	orgID := util.FetchValueFromContext(r.Context(), w, middleware.ContextKeyOrganization)
+
+	schedules, err := ss.sr.FindExportSchedules(r.Context(), orgID)
+	if err != nil {
+		log.Error("Failed to find export schedules", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return
+	}
+	writeJSON(w, r, schedules)
+}
+
+// Post function creates an export schedule for a group of the organization
+func (ss *ExportScheduleServiceV1) Post(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	orgID := util.FetchValueFromContext(r.Context(), w, middleware.ContextKeyOrganization)
+
+	req, ok := ss.readRequest(w, r, orgID)
+	if !ok {
+		return
+	}
+	schedules, err := ss.sr.FindExportSchedules(r.Context(), orgID)
+	if err != nil {
+		log.Error("Failed to find export schedules", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return
+	}
+	if max := conf.GetAsInt("exportSchedules.maxPerOrganization", 20); len(schedules) >= max {
+		boom.BadData(w, fmt.Sprintf("The organization already has the maximum of %d export schedules", max))
+		return
+	}
+
+	now := time.Now()
+	schedule := newExportSchedule(*req, now)
+	schedule.ID = uuid.New().String()
+	schedule.OrganizationID = orgID
+	schedule.CreatedAt = now
+	schedule.UpdatedAt = now
+	if err := ss.sr.InsertExportSchedule(r.Context(), schedule); err != nil {
+		log.Error("Failed to save export schedule", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return
+	}
+	log.Info(fmt.Sprintf("Created export schedule %s of group %s for organization %s", schedule.ID, schedule.GroupID, orgID))
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, r, schedule)
+}
+
+// Get function returns an export schedule of the organization
+func (ss *ExportScheduleServiceV1) Get(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	orgID := util.FetchValueFromContext(r.Context(), w, middleware.ContextKeyOrganization)
+	id := util.FetchValueFromContext(r.Context(), w, middleware.ContextKeyExportSchedule)
+
+	schedule, err := ss.sr.FindExportSchedule(r.Context(), orgID, id)
+	if errors.Is(err, v1Repo.ErrExportScheduleNotFound) {
+		boom.NotFound(w, "Export schedule not found")
+		return
+	}
+	if err != nil {
+		log.Error("Failed to find export schedule", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return
+	}
+	writeJSON(w, r, schedule)
+}
+
+// Put function replaces the settings of an export schedule of the organization, keeping its run history
+func (ss *ExportScheduleServiceV1) Put(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	orgID := util.FetchValueFromContext(r.Context(), w, middleware.ContextKeyOrganization)
+	id := util.FetchValueFromContext(r.Context(), w, middleware.ContextKeyExportSchedule)
+
+	req, ok := ss.readRequest(w, r, orgID)
+	if !ok {
+		return
+	}
+	existing, err := ss.sr.FindExportSchedule(r.Context(), orgID, id)
+	if errors.Is(err, v1Repo.ErrExportScheduleNotFound) {
+		boom.NotFound(w, "Export schedule not found")
+		return
+	}
+	if err != nil {
+		log.Error("Failed to find export schedule", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return
+	}
+
+	now := time.Now()
+	schedule := newExportSchedule(*req, now)
+	schedule.ID = existing.ID
+	schedule.OrganizationID = orgID
+	schedule.LastRunAt = existing.LastRunAt
+	schedule.LastJobID = existing.LastJobID
+	schedule.CreatedAt = existing.CreatedAt
+	schedule.UpdatedAt = now
+	err = ss.sr.UpdateExportSchedule(r.Context(), schedule)
+	if errors.Is(err, v1Repo.ErrExportScheduleNotFound) {
+		boom.NotFound(w, "Export schedule not found")
+		return
+	}
+	if err != nil {
+		log.Error("Failed to update export schedule", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return
+	}
+	log.Info(fmt.Sprintf("Updated export schedule %s of organization %s", id, orgID))
+	writeJSON(w, r, schedule)
+}
+
+// Delete function removes an export schedule of the organization, the jobs it already enqueued are kept
+func (ss *ExportScheduleServiceV1) Delete(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	orgID := util.FetchValueFromContext(r.Context(), w, middleware.ContextKeyOrganization)
+	id := util.FetchValueFromContext(r.Context(), w, middleware.ContextKeyExportSchedule)
+
+	err := ss.sr.DeleteExportSchedule(r.Context(), orgID, id)
+	if errors.Is(err, v1Repo.ErrExportScheduleNotFound) {
+		boom.NotFound(w, "Export schedule not found")
+		return
+	}
+	if err != nil {
+		log.Error("Failed to delete export schedule", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return
+	}
+	log.Info(fmt.Sprintf("Deleted export schedule %s of organization %s", id, orgID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readRequest parses and validates the body of a schedule, writing the error response when it is invalid
+func (ss *ExportScheduleServiceV1) readRequest(w http.ResponseWriter, r *http.Request, orgID string) (*v1.ExportScheduleRequest, bool) {
+	log := logger.WithContext(r.Context())
+
+	var req v1.ExportScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Error("Failed to parse export schedule", zap.Error(err))
+		boom.BadRequest(w, "Failed to parse export schedule")
+		return nil, false
+	}
+	req.Frequency = strings.ToUpper(req.Frequency)
+	if !v1.ValidFrequency(req.Frequency) {
+		boom.BadRequest(w, "Invalid frequency, must be one of DAILY, WEEKLY or MONTHLY")
+		return nil, false
+	}
+	if req.Type == "" {
+		boom.BadRequest(w, "Missing resource types")
+		return nil, false
+	}
+	if req.WebhookURL != "" && !checkWebhook(w, r, ss.wr, orgID, req.WebhookURL) {
+		return nil, false
+	}
+	if _, err := uuid.Parse(req.GroupID); err != nil {
+		boom.BadRequest(w, "Invalid groupID")
+		return nil, false
+	}
+	_, err := ss.gr.FindByID(r.Context(), req.GroupID)
+	if errors.Is(err, sql.ErrNoRows) {
+		boom.BadRequest(w, "Group not found")
+		return nil, false
+	}
+	if err != nil {
+		log.Error("Failed to find group", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return nil, false
+	}
+	return &req, true
+}
+
+// newExportSchedule creates the schedule of the request. It next runs at its start, or right away without one, and
+// a start in the past only sets when later runs happen.
+func newExportSchedule(req v1.ExportScheduleRequest, now time.Time) v1.ExportSchedule {
+	schedule := v1.ExportSchedule{
+		GroupID:    req.GroupID,
+		Frequency:  req.Frequency,
+		StartAt:    now,
+		NextRunAt:  now,
+		Type:       req.Type,
+		Since:      req.Since,
+		WebhookURL: req.WebhookURL,
+	}
+	if req.StartAt != nil {
+		schedule.StartAt = *req.StartAt
+		schedule.NextRunAt = *req.StartAt
+		if !req.StartAt.After(now) {
+			schedule.NextRunAt = schedule.NextRunAfter(now)
+		}
+	}
+	return schedule
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CMSgov/dpc/attribution/attributiontest"
+	"github.com/CMSgov/dpc/attribution/conf"
+	middleware2 "github.com/CMSgov/dpc/attribution/middleware"
+	"github.com/CMSgov/dpc/attribution/model"
+	"github.com/CMSgov/dpc/attribution/model/v1"
+	v1Repo "github.com/CMSgov/dpc/attribution/repository/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockExportScheduleRepo struct {
+	mock.Mock
+}
+
+func (m *MockExportScheduleRepo) FindExportSchedules(ctx context.Context, orgID string) ([]v1.ExportSchedule, error) {
+	args := m.Called(ctx, orgID)
+	return args.Get(0).([]v1.ExportSchedule), args.Error(1)
+}
+
+func (m *MockExportScheduleRepo) FindExportSchedule(ctx context.Context, orgID string, id string) (*v1.ExportSchedule, error) {
+	args := m.Called(ctx, orgID, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*v1.ExportSchedule), args.Error(1)
+}
+
+func (m *MockExportScheduleRepo) InsertExportSchedule(ctx context.Context, schedule v1.ExportSchedule) error {
+	args := m.Called(ctx, schedule)
+	return args.Error(0)
+}
+
+func (m *MockExportScheduleRepo) UpdateExportSchedule(ctx context.Context, schedule v1.ExportSchedule) error {
+	args := m.Called(ctx, schedule)
+	return args.Error(0)
+}
+
+func (m *MockExportScheduleRepo) DeleteExportSchedule(ctx context.Context, orgID string, id string) error {
+	args := m.Called(ctx, orgID, id)
+	return args.Error(0)
+}
+
+type MockGroupRepo struct {
+	mock.Mock
+}
+
+func (m *MockGroupRepo) Insert(ctx context.Context, body []byte) (*model.Group, error) {
+	args := m.Called(ctx, body)
+	return args.Get(0).(*model.Group), args.Error(1)
+}
+
+func (m *MockGroupRepo) FindByID(ctx context.Context, id string) (*model.Group, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Group), args.Error(1)
+}
+
+func (m *MockGroupRepo) FindByOrganization(ctx context.Context) ([]model.Group, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]model.Group), args.Error(1)
+}
+
+const scheduleGroupID = "0c527d2e-2e8a-4808-b11d-0fa06baf8254"
+
+type ExportScheduleServiceV1TestSuite struct {
+	suite.Suite
+	sr      *MockExportScheduleRepo
+	gr      *MockGroupRepo
+	wr      *MockWebhookRepo
+	service ExportScheduleService
+}
+
+func TestExportScheduleServiceV1TestSuite(t *testing.T) {
+	suite.Run(t, new(ExportScheduleServiceV1TestSuite))
+}
+
+func (suite *ExportScheduleServiceV1TestSuite) SetupTest() {
+	conf.NewConfig("../../../configs")
+	suite.sr = &MockExportScheduleRepo{}
+	suite.gr = &MockGroupRepo{}
+	suite.wr = &MockWebhookRepo{}
+	suite.service = NewExportScheduleService(suite.sr, suite.gr, suite.wr)
+}
+
+func (suite *ExportScheduleServiceV1TestSuite) request(method string, body string) *http.Request {
+	req := httptest.NewRequest(method, "http://doesnotmatter.com", strings.NewReader(body))
+	ctx := context.WithValue(req.Context(), middleware2.ContextKeyOrganization, "12345")
+	ctx = context.WithValue(ctx, middleware2.ContextKeyExportSchedule, "54321")
+	return req.WithContext(ctx)
+}
+
+func (suite *ExportScheduleServiceV1TestSuite) TestList() {
+	suite.sr.On("FindExportSchedules", mock.Anything, "12345").Return([]v1.ExportSchedule{{ID: "54321"}}, nil)
+
+	w := httptest.NewRecorder()
+	suite.service.List(w, suite.request(http.MethodGet, ""))
+
+	var schedules []v1.ExportSchedule
+	_ = json.NewDecoder(w.Result().Body).Decode(&schedules)
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	assert.Len(suite.T(), schedules, 1)
+}
+
+func (suite *ExportScheduleServiceV1TestSuite) TestPost() {
+	suite.gr.On("FindByID", mock.Anything, scheduleGroupID).Return(attributiontest.GroupResponse(), nil)
+	suite.sr.On("FindExportSchedules", mock.Anything, "12345").Return([]v1.ExportSchedule{}, nil)
+	suite.sr.On("InsertExportSchedule", mock.Anything, mock.Anything).Return(nil)
+
+	w := httptest.NewRecorder()
+	body := `{"groupID":"` + scheduleGroupID + `","frequency":"weekly","type":"Patient,Coverage"}`
+	suite.service.Post(w, suite.request(http.MethodPost, body))
+
+	var schedule v1.ExportSchedule
+	_ = json.NewDecoder(w.Result().Body).Decode(&schedule)
+	assert.Equal(suite.T(), http.StatusCreated, w.Result().StatusCode)
+	assert.NotEmpty(suite.T(), schedule.ID)
+	assert.Equal(suite.T(), "12345", schedule.OrganizationID)
+	assert.Equal(suite.T(), v1.FrequencyWeekly, schedule.Frequency)
+	assert.False(suite.T(), schedule.NextRunAt.After(time.Now()))
+	suite.sr.AssertExpectations(suite.T())
+}
+
+func (suite *ExportScheduleServiceV1TestSuite) TestPostStartInPast() {
+	suite.gr.On("FindByID", mock.Anything, scheduleGroupID).Return(attributiontest.GroupResponse(), nil)
+	suite.sr.On("FindExportSchedules", mock.Anything, "12345").Return([]v1.ExportSchedule{}, nil)
+	suite.sr.On("InsertExportSchedule", mock.Anything, mock.Anything).Return(nil)
+
+	start := time.Now().Add(-36 * time.Hour).UTC()
+	w := httptest.NewRecorder()
+	body := `{"groupID":"` + scheduleGroupID + `","frequency":"DAILY","type":"Patient","startAt":"` + start.Format(time.RFC3339Nano) + `"}`
+	suite.service.Post(w, suite.request(http.MethodPost, body))
+
+	schedule := suite.sr.Calls[1].Arguments.Get(1).(v1.ExportSchedule)
+	assert.Equal(suite.T(), http.StatusCreated, w.Result().StatusCode)
+	assert.True(suite.T(), start.Equal(schedule.StartAt))
+	assert.True(suite.T(), start.Add(48*time.Hour).Equal(schedule.NextRunAt))
+}
+
+func (suite *ExportScheduleServiceV1TestSuite) TestPostInvalid() {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"unparsable", `{`},
+		{"frequency", `{"groupID":"` + scheduleGroupID + `","frequency":"HOURLY","type":"Patient"}`},
+		{"type", `{"groupID":"` + scheduleGroupID + `","frequency":"DAILY"}`},
+		{"group id", `{"groupID":"abc","frequency":"DAILY","type":"Patient"}`},
+		{"webhook", `{"groupID":"` + scheduleGroupID + `","frequency":"DAILY","type":"Patient","webhookURL":"ftp://example.com"}`},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		suite.service.Post(w, suite.request(http.MethodPost, test.body))
+		assert.Equal(suite.T(), http.StatusBadRequest, w.Result().StatusCode, test.name)
+	}
+	suite.sr.AssertNotCalled(suite.T(), "InsertExportSchedule", mock.Anything, mock.Anything)
+}
+
+func (suite *ExportScheduleServiceV1TestSuite) TestPostGroupNotFound() {
+	suite.gr.On("FindByID", mock.Anything, scheduleGroupID).Return(nil, sql.ErrNoRows)
+
+	w := httptest.NewRecorder()
+	suite.service.Post(w, suite.request(http.MethodPost, `{"groupID":"`+scheduleGroupID+`","frequency":"DAILY","type":"Patient"}`))
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Result().StatusCode)
+	suite.sr.AssertNotCalled(suite.T(), "InsertExportSchedule", mock.Anything, mock.Anything)
+}
+
+func (suite *ExportScheduleServiceV1TestSuite) TestPostLimitReached() {
+	suite.gr.On("FindByID", mock.Anything, scheduleGroupID).Return(attributiontest.GroupResponse(), nil)
+	suite.sr.On("FindExportSchedules", mock.Anything, "12345").Return(make([]v1.ExportSchedule, 20), nil)
+
+	w := httptest.NewRecorder()
+	suite.service.Post(w, suite.request(http.MethodPost, `{"groupID":"`+scheduleGroupID+`","frequency":"DAILY","type":"Patient"}`))
+
+	assert.Equal(suite.T(), http.StatusUnprocessableEntity, w.Result().StatusCode)
+	suite.sr.AssertNotCalled(suite.T(), "InsertExportSchedule", mock.Anything, mock.Anything)
+}
+
+func (suite *ExportScheduleServiceV1TestSuite) TestGet() {
+	suite.sr.On("FindExportSchedule", mock.Anything, "12345", "54321").Return(&v1.ExportSchedule{ID: "54321"}, nil).Once()
+	suite.sr.On("FindExportSchedule", mock.Anything, "12345", "54321").Return(nil, v1Repo.ErrExportScheduleNotFound).Once()
+
+	w := httptest.NewRecorder()
+	suite.service.Get(w, suite.request(http.MethodGet, ""))
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+
+	w = httptest.NewRecorder()
+	suite.service.Get(w, suite.request(http.MethodGet, ""))
+	assert.Equal(suite.T(), http.StatusNotFound, w.Result().StatusCode)
+}
+
+func (suite *ExportScheduleServiceV1TestSuite) TestPutKeepsRunHistory() {
+	lastRun := time.Now().Add(-time.Hour)
+	lastJob := "job-1"
+	created := time.Now().Add(-72 * time.Hour)
+	suite.gr.On("FindByID", mock.Anything, scheduleGroupID).Return(attributiontest.GroupResponse(), nil)
+	suite.sr.On("FindExportSchedule", mock.Anything, "12345", "54321").
+		Return(&v1.ExportSchedule{ID: "54321", OrganizationID: "12345", LastRunAt: &lastRun, LastJobID: &lastJob, CreatedAt: created}, nil)
+	suite.sr.On("UpdateExportSchedule", mock.Anything, mock.Anything).Return(nil)
+
+	w := httptest.NewRecorder()
+	suite.service.Put(w, suite.request(http.MethodPut, `{"groupID":"`+scheduleGroupID+`","frequency":"MONTHLY","type":"Patient"}`))
+
+	schedule := suite.sr.Calls[1].Arguments.Get(1).(v1.ExportSchedule)
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	assert.Equal(suite.T(), "54321", schedule.ID)
+	assert.Equal(suite.T(), v1.FrequencyMonthly, schedule.Frequency)
+	assert.Equal(suite.T(), &lastJob, schedule.LastJobID)
+	assert.Equal(suite.T(), created, schedule.CreatedAt)
+}
+
+func (suite *ExportScheduleServiceV1TestSuite) TestDelete() {
+	suite.sr.On("DeleteExportSchedule", mock.Anything, "12345", "54321").Return(nil).Once()
+	suite.sr.On("DeleteExportSchedule", mock.Anything, "12345", "54321").Return(v1Repo.ErrExportScheduleNotFound).Once()
+
+	w := httptest.NewRecorder()
+	suite.service.Delete(w, suite.request(http.MethodDelete, ""))
+	assert.Equal(suite.T(), http.StatusNoContent, w.Result().StatusCode)
+
+	w = httptest.NewRecorder()
+	suite.service.Delete(w, suite.request(http.MethodDelete, ""))
+	assert.Equal(suite.T(), http.StatusNotFound, w.Result().StatusCode)
+}
@@ -1,13 +1,17 @@
 package service
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"github.com/CMSgov/dpc/attribution/conf"
 	"github.com/CMSgov/dpc/attribution/repository"
 	"io/ioutil"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -23,12 +27,16 @@ import (
 
 	"github.com/CMSgov/dpc/attribution/logger"
 	v1Repo "github.com/CMSgov/dpc/attribution/repository/v1"
+	"github.com/CMSgov/dpc/attribution/storage"
 )
 
 // JobService is an interface that defines what a JobService does
 type JobService interface {
 	Export(w http.ResponseWriter, r *http.Request)
 	BatchesAndFiles(w http.ResponseWriter, r *http.Request)
+	Cancel(w http.ResponseWriter, r *http.Request)
+	List(w http.ResponseWriter, r *http.Request)
+	StartJob(ctx context.Context, orgID string, er v1.ExportRequest, url string, ip string) (*string, bool, error)
 }
 
 // JobServiceV1 is a struct that defines what the service has
@@ -36,14 +44,26 @@ type JobServiceV1 struct {
 	jr        v1Repo.JobRepo
 	or        repository.OrganizationRepo
 	bfdClient client.APIClient
+	store     storage.Store
+	retention v1.RetentionPolicy
+	rr        v1Repo.OrgRetentionRepo
+	scheduler *Scheduler
+	wr        v1Repo.WebhookRepo
+	waiter    *JobWaiter
 }
 
 // NewJobService function that creates and returns a JobService
-func NewJobService(jr v1Repo.JobRepo, or repository.OrganizationRepo, bfdClient client.APIClient) JobService {
+func NewJobService(jr v1Repo.JobRepo, or repository.OrganizationRepo, bfdClient client.APIClient, store storage.Store, retention v1.RetentionPolicy, rr v1Repo.OrgRetentionRepo, scheduler *Scheduler, wr v1Repo.WebhookRepo, waiter *JobWaiter) JobService {
 	return &JobServiceV1{
 		jr,
 		or,
 		bfdClient,
+		store,
+		retention,
+		rr,
+		scheduler,
+		wr,
+		waiter,
 	}
 }
 
@@ -51,19 +71,6 @@ func NewJobService(jr v1Repo.JobRepo, or repository.OrganizationRepo, bfdClient
 func (js *JobServiceV1) Export(w http.ResponseWriter, r *http.Request) {
 	log := logger.WithContext(r.Context())
 	orgID := util.FetchValueFromContext(r.Context(), w, middleware.ContextKeyOrganization)
-	org, err := js.or.FindByID(r.Context(), orgID)
-	if err != nil {
-		log.Error("Failed to get org", zap.Error(err))
-		boom.Internal(w, err.Error())
-		return
-	}
-
-	npi, err := org.GetNPI()
-	if err != nil {
-		log.Error("Failed to get NPI", zap.Error(err))
-		boom.Internal(w, err.Error())
-		return
-	}
 
 	var er v1.ExportRequest
 	b, err := ioutil.ReadAll(r.Body)
@@ -79,29 +86,52 @@ func (js *JobServiceV1) Export(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	url := r.Header.Get(middleware.RequestURLHeader)
-	ip := r.Header.Get(middleware.FwdHeader)
-	batches, err := js.buildV1Batches(er, npi, url, ip)
-	if err != nil {
-		log.Error("Failed to build v1 batches", zap.Error(err))
-		boom.Internal(w, err.Error())
+	if er.WebhookURL != "" && !checkWebhook(w, r, js.wr, orgID, er.WebhookURL) {
+		return
+	}
+
+	// a repeated kickoff is answered before preparing batches, which calls BFD and the scheduler
+	dedupe := newJobDedupe(er)
+	job, err := js.jr.FindDuplicateJob(r.Context(), orgID, dedupe)
+	duplicate := job != nil
+	if err == nil && !duplicate {
+		if er.ExistingOnly {
+			boom.NotFound(w, "No existing job for the export request")
+			return
+		}
+		url := r.Header.Get(middleware.RequestURLHeader)
+		ip := r.Header.Get(middleware.FwdHeader)
+		batches, prepErr := js.prepareBatches(r.Context(), orgID, er, url, ip)
+		if prepErr != nil {
+			log.Error("Failed to prepare job", zap.Error(prepErr))
+			boom.Internal(w, prepErr.Error())
+			return
+		}
+		job, duplicate, err = js.jr.InsertUnlessDuplicate(r.Context(), orgID, batches, dedupe)
+	}
+	if errors.Is(err, v1Repo.ErrIdempotencyKeyReused) {
+		boom.Conflict(w, "The Idempotency-Key was already used for a different export request")
 		return
 	}
-	job, err := js.jr.Insert(r.Context(), orgID, batches)
 	if err != nil {
 		log.Error("Failed to create job", zap.Error(err))
 		boom.BadData(w, err.Error())
 		return
 	}
 
-	log.Info(fmt.Sprintf(
-		"dpcMetric=jobCreated,jobId=%s,orgId=%s,groupId=%s,totalPatients=%x,resourcesRequested=%s",
-		*job,
-		orgID,
-		er.GroupID,
-		len(er.MBIs),
-		strings.ReplaceAll(er.Type, ",", ";")),
-	)
+	if duplicate {
+		w.Header().Set(middleware.DuplicateJobHeader, "true")
+		log.Info(fmt.Sprintf("dpcMetric=jobDeduplicated,jobId=%s,orgId=%s,groupId=%s", *job, orgID, er.GroupID))
+	} else {
+		log.Info(fmt.Sprintf(
+			"dpcMetric=jobCreated,jobId=%s,orgId=%s,groupId=%s,totalPatients=%x,resourcesRequested=%s",
+			*job,
+			orgID,
+			er.GroupID,
+			len(er.MBIs),
+			strings.ReplaceAll(er.Type, ",", ";")),
+		)
+	}
 
 	if _, err := w.Write([]byte(*job)); err != nil {
 		log.Error("Failed to write job ID to response", zap.Error(err))
@@ -110,6 +140,87 @@ func (js *JobServiceV1) Export(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// StartJob enqueues the batches of an export job for the organization, or returns the existing job of an identical
+// request along with true
+func (js *JobServiceV1) StartJob(ctx context.Context, orgID string, er v1.ExportRequest, url string, ip string) (*string, bool, error) {
+	dedupe := newJobDedupe(er)
+	existing, err := js.jr.FindDuplicateJob(ctx, orgID, dedupe)
+	if err != nil || existing != nil {
+		return existing, existing != nil, err
+	}
+	batches, err := js.prepareBatches(ctx, orgID, er, url, ip)
+	if err != nil {
+		return nil, false, err
+	}
+	return js.jr.InsertUnlessDuplicate(ctx, orgID, batches, dedupe)
+}
+
+// prepareBatches splits the export request of the organization into batches and prioritizes them
+func (js *JobServiceV1) prepareBatches(ctx context.Context, orgID string, er v1.ExportRequest, url string, ip string) ([]v1.BatchRequest, error) {
+	org, err := js.or.FindByID(ctx, orgID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get org")
+	}
+	npi, err := org.GetNPI()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get NPI")
+	}
+	var last *v1.GroupExport
+	if er.Since == v1.SinceAuto {
+		if er.GroupID == "" {
+			return nil, errors.New("_since=auto is only supported for group exports")
+		}
+		last, err = js.jr.FindLastGroupExport(ctx, orgID, er)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to find last group export")
+		}
+	}
+	batches, err := js.buildV1Batches(er, last, npi, url, ip)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build v1 batches")
+	}
+	if err := js.scheduler.Assign(ctx, orgID, batches, len(er.MBIs)); err != nil {
+		return nil, errors.Wrap(err, "failed to schedule batches")
+	}
+	return batches, nil
+}
+
+// checkWebhook validates a webhook given at kickoff, which can only be notified once the organization has
+// registered a webhook of its own, as its secret signs the notifications. It must be on the registered webhook's
+// host, so a kickoff cannot point notifications anywhere else.
+func checkWebhook(w http.ResponseWriter, r *http.Request, wr v1Repo.WebhookRepo, orgID string, webhookURL string) bool {
+	if !ValidWebhookURL(webhookURL) {
+		boom.BadRequest(w, "Invalid webhook url, must be an absolute https URL on a public host")
+		return false
+	}
+	registered, err := wr.FindWebhook(r.Context(), orgID)
+	if errors.Is(err, v1Repo.ErrWebhookNotFound) {
+		boom.BadRequest(w, "The organization must register a webhook before giving one at kickoff")
+		return false
+	}
+	if err != nil {
+		logger.WithContext(r.Context()).Error("Failed to find organization webhook", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return false
+	}
+	if !sameWebhookHost(registered.URL, webhookURL) {
+		boom.BadRequest(w, "The webhook url must be on the host of the organization's registered webhook")
+		return false
+	}
+	return true
+}
+
+// newJobDedupe identifies the kickoff of the export request, so that repeating it returns the job it started
+func newJobDedupe(er v1.ExportRequest) v1.JobDedupe {
+	now := time.Now()
+	return v1.JobDedupe{
+		Fingerprint:    er.Fingerprint(),
+		IdempotencyKey: er.IdempotencyKey,
+		FreshSince:     now.Add(-time.Duration(conf.GetAsInt("jobs.dedupeWindowMinutes", 60)) * time.Minute),
+		KeysSince:      now.Add(-time.Duration(conf.GetAsInt("jobs.idempotencyKeyHours", 24)) * time.Hour),
+	}
+}
+
 func (js *JobServiceV1) fetchTransactionTime() (*time.Time, error) {
 	b, err := js.bfdClient.GetPatient("FAKE_PATIENT", uuid.New().String(), uuid.New().String(), "", time.Now())
 	if err != nil {
@@ -121,21 +232,43 @@ func (js *JobServiceV1) fetchTransactionTime() (*time.Time, error) {
 	return &b.Resource.Meta.LastUpdated, nil
 }
 
-// BatchesAndFiles function returns all the batches and it's files for a job
+// BatchesAndFiles function returns all the batches and it's files for a job. With a wait param, the response is held
+// for up to that many seconds until the job finishes.
 func (js *JobServiceV1) BatchesAndFiles(w http.ResponseWriter, r *http.Request) {
 	log := logger.WithContext(r.Context())
 	orgID := util.FetchValueFromContext(r.Context(), w, middleware.ContextKeyOrganization)
 	jobID := util.FetchValueFromContext(r.Context(), w, middleware.ContextKeyJobID)
 
+	wait, err := parseWait(r.URL.Query().Get("wait"))
+	if err != nil {
+		boom.BadRequest(w, err.Error())
+		return
+	}
+
 	response := make([]v1.BatchAndFiles, 0)
 
-	batches, err := js.jr.FindBatchesByJobID(jobID, orgID)
+	batches, err := js.waitForJob(r.Context(), jobID, orgID, wait)
 	if err != nil {
 		log.Error("Failed to find batches by job id", zap.Error(err))
 		boom.Internal(w, err.Error())
 		return
 	}
 
+	if len(batches) == 0 || isCancelled(batches) {
+		boom.NotFound(w, fmt.Sprintf("Job %s not found", jobID))
+		return
+	}
+
+	// finished batches report when their files are purged, unless the retention sweeper is off
+	var retention time.Duration
+	if js.retention.Enabled {
+		if retention, err = retentionFor(r.Context(), js.rr, js.retention, orgID); err != nil {
+			log.Error("Failed to find organization retention", zap.Error(err))
+			boom.Internal(w, err.Error())
+			return
+		}
+	}
+
 	for _, b := range batches {
 		files, err := js.jr.FindBatchFilesByBatchID(b.BatchID)
 		if err != nil {
@@ -147,9 +280,16 @@ func (js *JobServiceV1) BatchesAndFiles(w http.ResponseWriter, r *http.Request)
 			Batch: v1.NewBatchInfo(b),
 			Files: files,
 		}
+		if b.CompleteTime.Valid && js.retention.Enabled {
+			expiresAt := b.CompleteTime.Time.Add(retention)
+			bf.Batch.ExpiresAt = &expiresAt
+		}
 		response = append(response, bf)
 	}
 
+	js.estimateQueue(r.Context(), jobID, response)
+	js.estimateRemaining(r.Context(), response)
+
 	b, err := json.Marshal(response)
 	if err != nil {
 		log.Error("Failed to write json bytes", zap.Error(err))
@@ -162,13 +302,240 @@ func (js *JobServiceV1) BatchesAndFiles(w http.ResponseWriter, r *http.Request)
 	}
 }
 
-func (js *JobServiceV1) buildV1Batches(er v1.ExportRequest, orgNPI string, url string, ip string) ([]v1.BatchRequest, error) {
-	priority := 5000
-	if len(er.MBIs) == 1 {
-		priority = 1000
+// waitForJob returns the batches of the job once it has finished, or when the wait is over. The batches are reloaded
+// every time the job waiter reports that one of them finished. Without a waiter they are returned right away.
+func (js *JobServiceV1) waitForJob(ctx context.Context, jobID string, orgID string, wait time.Duration) ([]v1.JobQueueBatch, error) {
+	if wait <= 0 || js.waiter == nil {
+		return js.jr.FindBatchesByJobID(jobID, orgID)
+	}
+	// subscribing before loading the batches makes sure a batch that finishes in between is not missed
+	finished, stop := js.waiter.Subscribe(jobID)
+	defer stop()
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+	for {
+		batches, err := js.jr.FindBatchesByJobID(jobID, orgID)
+		if err != nil || len(batches) == 0 || isFinished(batches) {
+			return batches, err
+		}
+		select {
+		case <-finished:
+		case <-timeout.C:
+			return batches, nil
+		case <-ctx.Done():
+			return batches, nil
+		}
+	}
+}
+
+// parseWait reads the seconds to wait for a job to finish, capped at jobs.maxWaitSeconds
+func parseWait(param string) (time.Duration, error) {
+	if param == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.Atoi(param)
+	if err != nil || seconds < 0 {
+		return 0, errors.New("wait must be a non-negative number of seconds")
 	}
+	if max := conf.GetAsInt("jobs.maxWaitSeconds", 60); seconds > max {
+		seconds = max
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
 
-	since, err := parseSinceParam(er.Since)
+// estimateQueue sets the queue position and estimated wait of the job on its queued batches. The job status is
+// still useful without them, so a failure is only logged.
+func (js *JobServiceV1) estimateQueue(ctx context.Context, jobID string, batches []v1.BatchAndFiles) {
+	queued := false
+	for _, b := range batches {
+		queued = queued || b.Batch.Status == "QUEUED"
+	}
+	if !queued {
+		return
+	}
+	estimate, err := js.scheduler.Estimate(ctx, jobID)
+	if err != nil {
+		logger.WithContext(ctx).Warn("Failed to estimate queue position", zap.Error(err))
+		return
+	}
+	for _, b := range batches {
+		if b.Batch.Status != "QUEUED" {
+			continue
+		}
+		position := estimate.Position
+		b.Batch.QueuePosition = &position
+		if estimate.EstimatedWait != nil {
+			wait := int(estimate.EstimatedWait.Seconds())
+			b.Batch.EstimatedWaitSeconds = &wait
+		}
+	}
+}
+
+// estimateRemaining sets how long until each unfinished batch completes, from the patients it has left at the recent
+// throughput of a batch. A queued batch first waits for its turn, so it is only estimated when its wait is. The job
+// status is still useful without them, so a failure is only logged.
+func (js *JobServiceV1) estimateRemaining(ctx context.Context, batches []v1.BatchAndFiles) {
+	unfinished := false
+	for _, b := range batches {
+		unfinished = unfinished || b.Batch.Status == "QUEUED" || b.Batch.Status == "RUNNING"
+	}
+	if !unfinished {
+		return
+	}
+	throughput, err := js.scheduler.Throughput(ctx)
+	if err != nil {
+		logger.WithContext(ctx).Warn("Failed to find export throughput", zap.Error(err))
+		return
+	}
+	if throughput == nil || *throughput <= 0 {
+		return
+	}
+	for _, b := range batches {
+		wait := 0
+		if b.Batch.Status == "QUEUED" && b.Batch.EstimatedWaitSeconds != nil {
+			wait = *b.Batch.EstimatedWaitSeconds
+		} else if b.Batch.Status != "RUNNING" {
+			continue
+		}
+		remaining := wait + int(math.Ceil(float64(b.Batch.TotalPatients-b.Batch.PatientsProcessed) / *throughput))
+		b.Batch.EstimatedSecondsRemaining = &remaining
+	}
+}
+
+// Cancel function cancels all batches of a job and deletes the files they produced
+func (js *JobServiceV1) Cancel(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	orgID := util.FetchValueFromContext(r.Context(), w, middleware.ContextKeyOrganization)
+	jobID := util.FetchValueFromContext(r.Context(), w, middleware.ContextKeyJobID)
+
+	batchIDs, err := js.jr.CancelJob(r.Context(), jobID, orgID)
+	if errors.Is(err, v1Repo.ErrJobNotFound) {
+		boom.NotFound(w, fmt.Sprintf("Job %s not found", jobID))
+		return
+	}
+	if err != nil {
+		log.Error("Failed to cancel job", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return
+	}
+
+	for _, batchID := range batchIDs {
+		if err := js.store.DeletePrefix(r.Context(), fmt.Sprintf("%s-", batchID)); err != nil {
+			log.Warn(fmt.Sprintf("Failed to delete files of batch %s of cancelled job", batchID), zap.Error(err))
+		}
+	}
+
+	log.Info(fmt.Sprintf("dpcMetric=jobCancelled,jobId=%s,orgId=%s,batches=%d", jobID, orgID, len(batchIDs)))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// List function returns a page of the organization's jobs, filtered by status and submit date
+func (js *JobServiceV1) List(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	orgID := util.FetchValueFromContext(r.Context(), w, middleware.ContextKeyOrganization)
+
+	filter, err := parseJobFilter(r.URL.Query())
+	if err != nil {
+		boom.BadRequest(w, err.Error())
+		return
+	}
+
+	list, err := js.jr.FindJobs(r.Context(), orgID, *filter)
+	if err != nil {
+		log.Error("Failed to find jobs", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return
+	}
+
+	b, err := json.Marshal(list)
+	if err != nil {
+		log.Error("Failed to write json bytes", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return
+	}
+
+	if _, err := w.Write(b); err != nil {
+		log.Error("Failed to write job list to response", zap.Error(err))
+		boom.Internal(w, err.Error())
+	}
+}
+
+func parseJobFilter(query url.Values) (*v1.JobFilter, error) {
+	filter := v1.JobFilter{Limit: conf.GetAsInt("jobs.defaultPageSize", 50)}
+
+	if s := query.Get("status"); s != "" {
+		for _, name := range strings.Split(s, ",") {
+			code, ok := v1.StatusCode(strings.ToUpper(strings.TrimSpace(name)))
+			if !ok {
+				return nil, errors.Errorf("Invalid status %s", name)
+			}
+			filter.Statuses = append(filter.Statuses, code)
+		}
+	}
+
+	for param, dst := range map[string]**time.Time{"submittedAfter": &filter.SubmittedAfter, "submittedBefore": &filter.SubmittedBefore} {
+		if s := query.Get(param); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return nil, errors.Errorf("Invalid %s, must be an RFC3339 timestamp", param)
+			}
+			*dst = &t
+		}
+	}
+
+	if s := query.Get("scheduleId"); s != "" {
+		if _, err := uuid.Parse(s); err != nil {
+			return nil, errors.New("Invalid scheduleId")
+		}
+		filter.ScheduleID = s
+	}
+
+	maxPageSize := conf.GetAsInt("jobs.maxPageSize", 500)
+	if s := query.Get("_count"); s != "" {
+		count, err := strconv.Atoi(s)
+		if err != nil || count < 1 || count > maxPageSize {
+			return nil, errors.Errorf("Invalid _count, must be between 1 and %d", maxPageSize)
+		}
+		filter.Limit = count
+	}
+
+	if s := query.Get("page"); s != "" {
+		page, err := strconv.Atoi(s)
+		if err != nil || page < 1 {
+			return nil, errors.New("Invalid page, must be a positive number")
+		}
+		filter.Offset = (page - 1) * filter.Limit
+	}
+	return &filter, nil
+}
+
+func isCancelled(batches []v1.JobQueueBatch) bool {
+	for _, b := range batches {
+		if b.Status == "CANCELLED" {
+			return true
+		}
+	}
+	return false
+}
+
+// isFinished reports whether the job of the batches is over, it is once none of them is queued or running. A
+// cancelled job is over at once, as its remaining batches are never run.
+func isFinished(batches []v1.JobQueueBatch) bool {
+	for _, b := range batches {
+		if b.Status == "CANCELLED" {
+			return true
+		}
+	}
+	for _, b := range batches {
+		if b.Status == "QUEUED" || b.Status == "RUNNING" {
+			return false
+		}
+	}
+	return true
+}
+
+func (js *JobServiceV1) buildV1Batches(er v1.ExportRequest, last *v1.GroupExport, orgNPI string, url string, ip string) ([]v1.BatchRequest, error) {
+	cohorts, err := sinceCohorts(er, last)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to parse since")
 	}
@@ -178,29 +545,85 @@ func (js *JobServiceV1) buildV1Batches(er v1.ExportRequest, orgNPI string, url s
 		return nil, errors.Errorf("Failed to fetch Transaction Time from BFD: %s", err.Error())
 	}
 
-	patientBatches := batchPatientMBIs(er.MBIs, conf.GetAsInt("queue.batchSize", 100))
+	batchSize := conf.GetAsInt("queue.batchSize", 100)
 	var batches []v1.BatchRequest
-	for _, batchedPatients := range patientBatches {
-		batch := v1.BatchRequest{
-			Since:           since,
-			RequestURL:      url,
-			RequestingIP:    ip,
-			OrganizationNPI: orgNPI,
-			ProviderNPI:     er.ProviderNPI,
-			PatientMBIs:     strings.Join(batchedPatients, ","),
-			IsBulk:          len(batchedPatients) > 1,
-			ResourceTypes:   er.Type,
-		}
-		batch.Priority = priority
-		if since.Valid && !tt.After(since.Time) {
-			batch.PatientMBIs = ""
-		}
-		batch.TransactionTime = *tt
-		batches = append(batches, batch)
+	for _, c := range cohorts {
+		for _, batchedPatients := range batchPatientMBIs(c.patientMBIs, batchSize) {
+			batch := v1.BatchRequest{
+				Since:           c.since,
+				RequestURL:      url,
+				RequestingIP:    ip,
+				OrganizationNPI: orgNPI,
+				ProviderNPI:     er.ProviderNPI,
+				PatientMBIs:     strings.Join(batchedPatients, ","),
+				IsBulk:          len(batchedPatients) > 1,
+				ResourceTypes:   er.Type,
+				TypeFilter:      er.TypeFilter,
+				Elements:        er.Elements,
+				WebhookURL:      er.WebhookURL,
+				ScheduleID:      er.ScheduleID,
+				GroupID:         er.GroupID,
+				SinceAuto:       c.auto,
+			}
+			// kickoff warnings apply to the whole job, so they are only reported once, by its first batch
+			if len(batches) == 0 {
+				batch.Warnings = strings.Join(er.Warnings, "\n")
+			}
+			// the patients of a resolved _since are kept, as the next _since=auto export reads the members from them
+			if !c.auto && c.since.Valid && !tt.After(c.since.Time) {
+				batch.PatientMBIs = ""
+			}
+			batch.TransactionTime = *tt
+			batches = append(batches, batch)
+		}
 	}
 	return batches, nil
 }
 
+// sinceCohort is a set of patients of an export request that are exported since the same time
+type sinceCohort struct {
+	since       *sql.NullTime
+	auto        bool
+	patientMBIs []string
+}
+
+// sinceCohorts groups the patients of the request by the _since they are exported from. For _since=auto, the members
+// the group's last export covered continue from its transaction time, while members added since then get their full
+// history. On a first export, all of them get their full history, or start from FirstSince when it is set.
+func sinceCohorts(er v1.ExportRequest, last *v1.GroupExport) ([]sinceCohort, error) {
+	if er.Since != v1.SinceAuto {
+		since, err := parseSinceParam(er.Since)
+		if err != nil {
+			return nil, err
+		}
+		return []sinceCohort{{since: since, patientMBIs: er.MBIs}}, nil
+	}
+	if last == nil {
+		since := &sql.NullTime{}
+		if er.FirstSince != nil {
+			since = &sql.NullTime{Time: *er.FirstSince, Valid: true}
+		}
+		return []sinceCohort{{since: since, auto: true, patientMBIs: er.MBIs}}, nil
+	}
+
+	exported := make(map[string]bool, len(last.PatientMBIs))
+	for _, mbi := range last.PatientMBIs {
+		exported[mbi] = true
+	}
+	var continued, added []string
+	for _, mbi := range er.MBIs {
+		if exported[mbi] {
+			continued = append(continued, mbi)
+		} else {
+			added = append(added, mbi)
+		}
+	}
+	return []sinceCohort{
+		{since: &sql.NullTime{Time: last.TransactionTime, Valid: true}, auto: true, patientMBIs: continued},
+		{since: &sql.NullTime{}, auto: true, patientMBIs: added},
+	}, nil
+}
+
 func batchPatientMBIs(patientMBIs []string, batchSize int) [][]string {
 	var batches [][]string
 	for i := 0; i < len(patientMBIs); i += batchSize {
@@ -3,6 +3,7 @@ package service
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"encoding/json"
 	"github.com/CMSgov/dpc/attribution/attributiontest"
 	"github.com/CMSgov/dpc/attribution/client"
@@ -11,12 +12,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/CMSgov/dpc/attribution/conf"
 	middleware2 "github.com/CMSgov/dpc/attribution/middleware"
 	"github.com/CMSgov/dpc/attribution/model/v1"
+	v1Repo "github.com/CMSgov/dpc/attribution/repository/v1"
+	"github.com/CMSgov/dpc/attribution/storage"
 	"github.com/bxcodec/faker/v3"
 	"github.com/kinbiko/jsonassert"
 	"github.com/pkg/errors"
@@ -37,6 +41,22 @@ func (m *MockJobRepo) Insert(ctx context.Context, orgID string, b []v1.BatchRequ
 	return args.Get(0).(*string), args.Error(1)
 }
 
+func (m *MockJobRepo) InsertUnlessDuplicate(ctx context.Context, orgID string, b []v1.BatchRequest, dedupe v1.JobDedupe) (*string, bool, error) {
+	args := m.Called(ctx, orgID, b, dedupe)
+	if args.Get(0) == nil {
+		return nil, args.Bool(1), args.Error(2)
+	}
+	return args.Get(0).(*string), args.Bool(1), args.Error(2)
+}
+
+func (m *MockJobRepo) FindDuplicateJob(ctx context.Context, orgID string, dedupe v1.JobDedupe) (*string, error) {
+	args := m.Called(ctx, orgID, dedupe)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*string), args.Error(1)
+}
+
 func (m *MockJobRepo) FindBatchesByJobID(id string, orgID string) ([]v1.JobQueueBatch, error) {
 	args := m.Called(id, orgID)
 	return args.Get(0).([]v1.JobQueueBatch), args.Error(1)
@@ -47,6 +67,30 @@ func (m *MockJobRepo) FindBatchFilesByBatchID(id string) ([]v1.JobQueueBatchFile
 	return args.Get(0).([]v1.JobQueueBatchFile), args.Error(1)
 }
 
+func (m *MockJobRepo) CancelJob(ctx context.Context, jobID string, orgID string) ([]string, error) {
+	args := m.Called(ctx, jobID, orgID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockJobRepo) FindJobs(ctx context.Context, orgID string, filter v1.JobFilter) (*v1.JobList, error) {
+	args := m.Called(ctx, orgID, filter)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*v1.JobList), args.Error(1)
+}
+
+func (m *MockJobRepo) FindLastGroupExport(ctx context.Context, orgID string, er v1.ExportRequest) (*v1.GroupExport, error) {
+	args := m.Called(ctx, orgID, er)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*v1.GroupExport), args.Error(1)
+}
+
 func (m *MockJobRepo) GetFileInfo(ctx context.Context, orgID string, fileName string) (*v1.FileInfo, error) {
 	args := m.Called(ctx, orgID, fileName)
 	return args.Get(0).(*v1.FileInfo), args.Error(1)
@@ -91,12 +135,80 @@ func (m *MockOrgRepo) Update(ctx context.Context, id string, body []byte) (*v2.O
 	return args.Get(0).(*v2.Organization), args.Error(1)
 }
 
+type MockPriorityRepo struct {
+	mock.Mock
+}
+
+func (m *MockPriorityRepo) FindPriorityTier(ctx context.Context, orgID string) (*v1.PriorityTier, error) {
+	args := m.Called(ctx, orgID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*v1.PriorityTier), args.Error(1)
+}
+
+func (m *MockPriorityRepo) SavePriorityTier(ctx context.Context, tier v1.PriorityTier) error {
+	args := m.Called(ctx, tier)
+	return args.Error(0)
+}
+
+func (m *MockPriorityRepo) FindOrgUsage(ctx context.Context, orgID string, since time.Time) (*v1.OrgUsage, error) {
+	args := m.Called(ctx, orgID, since)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*v1.OrgUsage), args.Error(1)
+}
+
+func (m *MockPriorityRepo) FindQueueEstimate(ctx context.Context, jobID string, since time.Time) (*v1.QueueEstimate, error) {
+	args := m.Called(ctx, jobID, since)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*v1.QueueEstimate), args.Error(1)
+}
+
+func (m *MockPriorityRepo) FindThroughput(ctx context.Context, since time.Time) (*float64, error) {
+	args := m.Called(ctx, since)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*float64), args.Error(1)
+}
+
+type MockOrgRetentionRepo struct {
+	mock.Mock
+}
+
+func (m *MockOrgRetentionRepo) FindRetentionHours(ctx context.Context, orgID string) (*int, error) {
+	args := m.Called(ctx, orgID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*int), args.Error(1)
+}
+
+func (m *MockOrgRetentionRepo) SaveRetentionHours(ctx context.Context, orgID string, hours int) error {
+	args := m.Called(ctx, orgID, hours)
+	return args.Error(0)
+}
+
+func (m *MockOrgRetentionRepo) DeleteRetentionHours(ctx context.Context, orgID string) error {
+	args := m.Called(ctx, orgID)
+	return args.Error(0)
+}
+
 type JobServiceV1TestSuite struct {
 	suite.Suite
 	jr      *MockJobRepo
+	sr      *MockPriorityRepo
+	rr      *MockOrgRetentionRepo
+	wr      *MockWebhookRepo
 	or      *MockOrgRepo
+	waiter  *JobWaiter
 	service JobService
 	client  *client.MockBfdClient
+	dir     string
 }
 
 func TestJobServiceV1TestSuite(t *testing.T) {
@@ -111,11 +223,20 @@ func (suite *JobServiceV1TestSuite) SetupTest() {
 	conf.NewConfig("../../../configs")
 	suite.jr = &MockJobRepo{}
 	suite.or = &MockOrgRepo{}
+	suite.sr = &MockPriorityRepo{}
+	suite.rr = &MockOrgRetentionRepo{}
+	suite.wr = &MockWebhookRepo{}
+	suite.waiter = NewJobWaiter(&MockJobListener{}, time.Second)
 	suite.client = &client.MockBfdClient{}
 	suite.client.BasePath = "../../client/"
-	suite.service = NewJobService(suite.jr, suite.or, suite.client)
+	suite.dir = suite.T().TempDir()
+	suite.service = NewJobService(suite.jr, suite.or, suite.client, storage.NewLocalStore(suite.dir),
+		v1.RetentionPolicy{Enabled: true, Default: 24 * time.Hour}, suite.rr,
+		NewScheduler(suite.sr, SchedulerConfig{UsageWindow: 24 * time.Hour, EstimateWindow: time.Hour}), suite.wr, suite.waiter)
 
 	suite.or.On("FindByID", mock.Anything, mock.Anything).Return(attributiontest.OrgResponse(), nil)
+	hours := 72
+	suite.rr.On("FindRetentionHours", mock.Anything, "12345").Return(&hours, nil)
 	suite.client.On("GetPatient", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
 		Return(suite.client.GetBundleData("Patient", "12345"))
 }
@@ -124,7 +245,10 @@ func (suite *JobServiceV1TestSuite) TestExport() {
 	ja := jsonassert.New(suite.T())
 
 	id := "12345"
-	suite.jr.On("Insert", mock.Anything, mock.Anything, mock.Anything).Return(&id, nil)
+	suite.jr.On("FindDuplicateJob", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+	suite.jr.On("InsertUnlessDuplicate", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&id, false, nil)
+	suite.sr.On("FindPriorityTier", mock.Anything, "12345").Return(v1.DefaultPriorityTier("12345"), nil)
+	suite.sr.On("FindOrgUsage", mock.Anything, "12345", mock.Anything).Return(&v1.OrgUsage{ActiveBatches: 2, RecentBatches: 3}, nil)
 
 	exportRequest := v1.ExportRequest{
 		GroupID:      faker.UUIDHyphenated(),
@@ -154,12 +278,244 @@ func (suite *JobServiceV1TestSuite) TestExport() {
 	resp, _ := ioutil.ReadAll(res.Body)
 
 	ja.Assertf(string(resp), id)
+	// a bulk job of the standard tier with a single batch, behind the organization's usage
+	suite.jr.AssertCalled(suite.T(), "InsertUnlessDuplicate", mock.Anything, "12345", mock.MatchedBy(func(b []v1.BatchRequest) bool {
+		return len(b) == 1 && b[0].Priority == 1000+bulkJobPriority+1+2*activeBatchPriority+3
+	}), mock.MatchedBy(func(d v1.JobDedupe) bool {
+		return d.Fingerprint == exportRequest.Fingerprint() && d.IdempotencyKey == "" && d.FreshSince.After(d.KeysSince)
+	}))
+}
+
+func (suite *JobServiceV1TestSuite) webhookExportRequest(webhookURL string) *http.Request {
+	exportRequest := v1.ExportRequest{
+		GroupID:     faker.UUIDHyphenated(),
+		Type:        "Patient",
+		MBIs:        []string{faker.UUIDDigit()},
+		ProviderNPI: faker.UUIDHyphenated(),
+		WebhookURL:  webhookURL,
+	}
+	b, _ := json.Marshal(exportRequest)
+
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/v2/Job", bytes.NewReader(b))
+	req.Header.Set(middleware2.FwdHeader, faker.IPv4())
+	req.Header.Set(middleware2.RequestURLHeader, faker.URL())
+	return req.WithContext(context.WithValue(req.Context(), middleware2.ContextKeyOrganization, "12345"))
+}
+
+func (suite *JobServiceV1TestSuite) TestExportWithWebhook() {
+	id := "12345"
+	suite.jr.On("FindDuplicateJob", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+	suite.jr.On("InsertUnlessDuplicate", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&id, false, nil)
+	suite.sr.On("FindPriorityTier", mock.Anything, "12345").Return(v1.DefaultPriorityTier("12345"), nil)
+	suite.sr.On("FindOrgUsage", mock.Anything, "12345", mock.Anything).Return(&v1.OrgUsage{}, nil)
+	suite.wr.On("FindWebhook", mock.Anything, "12345").Return(&v1.OrgWebhook{OrganizationID: "12345", URL: "https://example.com/org", Secret: "secret"}, nil)
+
+	w := httptest.NewRecorder()
+	suite.service.Export(w, suite.webhookExportRequest("https://example.com/job"))
+
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	suite.jr.AssertCalled(suite.T(), "InsertUnlessDuplicate", mock.Anything, "12345", mock.MatchedBy(func(b []v1.BatchRequest) bool {
+		return len(b) == 1 && b[0].WebhookURL == "https://example.com/job"
+	}), mock.Anything)
+}
+
+func (suite *JobServiceV1TestSuite) TestExportWithWebhookInvalid() {
+	suite.wr.On("FindWebhook", mock.Anything, "12345").Once().Return(nil, v1Repo.ErrWebhookNotFound)
+	suite.wr.On("FindWebhook", mock.Anything, "12345").Return(&v1.OrgWebhook{OrganizationID: "12345", URL: "https://example.com/org", Secret: "secret"}, nil)
+
+	// not a url, no registered webhook, plain http, an internal host and another host than the registered webhook
+	for _, webhookURL := range []string{"not a url", "https://example.com/job", "http://example.com/job",
+		"https://169.254.169.254/latest", "https://attacker.example.org/job"} {
+		w := httptest.NewRecorder()
+		suite.service.Export(w, suite.webhookExportRequest(webhookURL))
+		assert.Equal(suite.T(), http.StatusBadRequest, w.Result().StatusCode, webhookURL)
+	}
+	suite.jr.AssertNotCalled(suite.T(), "InsertUnlessDuplicate", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *JobServiceV1TestSuite) TestExportDuplicate() {
+	id := "existing"
+	suite.jr.On("FindDuplicateJob", mock.Anything, "12345", mock.Anything).Return(&id, nil)
+
+	w := httptest.NewRecorder()
+	suite.service.Export(w, suite.webhookExportRequest(""))
+
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	assert.Equal(suite.T(), "existing", w.Body.String())
+	assert.Equal(suite.T(), "true", w.Result().Header.Get(middleware2.DuplicateJobHeader))
+	// the batches of a repeated kickoff are never prepared
+	suite.sr.AssertNotCalled(suite.T(), "FindPriorityTier", mock.Anything, mock.Anything)
+	suite.jr.AssertNotCalled(suite.T(), "InsertUnlessDuplicate", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *JobServiceV1TestSuite) TestExportDuplicateUnderLock() {
+	id := "existing"
+	suite.jr.On("FindDuplicateJob", mock.Anything, "12345", mock.Anything).Return(nil, nil)
+	suite.jr.On("InsertUnlessDuplicate", mock.Anything, "12345", mock.Anything, mock.Anything).Return(&id, true, nil)
+	suite.sr.On("FindPriorityTier", mock.Anything, "12345").Return(v1.DefaultPriorityTier("12345"), nil)
+	suite.sr.On("FindOrgUsage", mock.Anything, "12345", mock.Anything).Return(&v1.OrgUsage{}, nil)
+
+	w := httptest.NewRecorder()
+	suite.service.Export(w, suite.webhookExportRequest(""))
+
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	assert.Equal(suite.T(), "existing", w.Body.String())
+	assert.Equal(suite.T(), "true", w.Result().Header.Get(middleware2.DuplicateJobHeader))
+}
+
+func (suite *JobServiceV1TestSuite) TestExportExistingOnly() {
+	suite.jr.On("FindDuplicateJob", mock.Anything, "12345", mock.Anything).Return(nil, nil)
+
+	b, _ := json.Marshal(v1.ExportRequest{
+		GroupID:      faker.UUIDHyphenated(),
+		Type:         "Patient",
+		MBIs:         []string{faker.UUIDDigit()},
+		ProviderNPI:  faker.UUIDHyphenated(),
+		ExistingOnly: true,
+	})
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/v2/Job", bytes.NewReader(b))
+	req = req.WithContext(context.WithValue(req.Context(), middleware2.ContextKeyOrganization, "12345"))
+
+	w := httptest.NewRecorder()
+	suite.service.Export(w, req)
+
+	assert.Equal(suite.T(), http.StatusNotFound, w.Result().StatusCode)
+	suite.jr.AssertNotCalled(suite.T(), "InsertUnlessDuplicate", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *JobServiceV1TestSuite) sinceAutoExportRequest(mbis ...string) *http.Request {
+	b, _ := json.Marshal(v1.ExportRequest{
+		GroupID:     "67890",
+		Since:       v1.SinceAuto,
+		Type:        "Patient,Coverage",
+		MBIs:        mbis,
+		ProviderNPI: faker.UUIDHyphenated(),
+	})
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/v2/Job", bytes.NewReader(b))
+	return req.WithContext(context.WithValue(req.Context(), middleware2.ContextKeyOrganization, "12345"))
+}
+
+func (suite *JobServiceV1TestSuite) TestExportSinceAuto() {
+	id := "12345"
+	last := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	suite.jr.On("FindLastGroupExport", mock.Anything, "12345", mock.MatchedBy(func(er v1.ExportRequest) bool {
+		return er.GroupID == "67890" && er.Type == "Patient,Coverage"
+	})).Return(&v1.GroupExport{JobID: "job-1", TransactionTime: last, PatientMBIs: []string{"1SW4N00AA00", "3SW4N00AA00"}}, nil)
+	suite.jr.On("FindDuplicateJob", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+	suite.jr.On("InsertUnlessDuplicate", mock.Anything, "12345", mock.Anything, mock.Anything).Return(&id, false, nil)
+	suite.sr.On("FindPriorityTier", mock.Anything, "12345").Return(v1.DefaultPriorityTier("12345"), nil)
+	suite.sr.On("FindOrgUsage", mock.Anything, "12345", mock.Anything).Return(&v1.OrgUsage{}, nil)
+
+	w := httptest.NewRecorder()
+	suite.service.Export(w, suite.sinceAutoExportRequest("1SW4N00AA00", "2SW4N00AA00", "3SW4N00AA00"))
+
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	// the members of the last export continue from it, the member added since gets its full history
+	batches := suite.jr.Calls[2].Arguments.Get(2).([]v1.BatchRequest)
+	assert.Len(suite.T(), batches, 2)
+	assert.Equal(suite.T(), "1SW4N00AA00,3SW4N00AA00", batches[0].PatientMBIs)
+	assert.Equal(suite.T(), sql.NullTime{Time: last, Valid: true}, *batches[0].Since)
+	assert.Equal(suite.T(), "2SW4N00AA00", batches[1].PatientMBIs)
+	assert.False(suite.T(), batches[1].Since.Valid)
+	for _, b := range batches {
+		assert.True(suite.T(), b.SinceAuto)
+		assert.Equal(suite.T(), "67890", b.GroupID)
+	}
+}
+
+func (suite *JobServiceV1TestSuite) TestExportSinceAutoFirstExport() {
+	id := "12345"
+	suite.jr.On("FindLastGroupExport", mock.Anything, "12345", mock.Anything).Return(nil, nil)
+	suite.jr.On("FindDuplicateJob", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+	suite.jr.On("InsertUnlessDuplicate", mock.Anything, "12345", mock.Anything, mock.Anything).Return(&id, false, nil)
+	suite.sr.On("FindPriorityTier", mock.Anything, "12345").Return(v1.DefaultPriorityTier("12345"), nil)
+	suite.sr.On("FindOrgUsage", mock.Anything, "12345", mock.Anything).Return(&v1.OrgUsage{}, nil)
+
+	w := httptest.NewRecorder()
+	suite.service.Export(w, suite.sinceAutoExportRequest("1SW4N00AA00", "2SW4N00AA00"))
+
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	suite.jr.AssertCalled(suite.T(), "InsertUnlessDuplicate", mock.Anything, "12345", mock.MatchedBy(func(b []v1.BatchRequest) bool {
+		return len(b) == 1 && !b[0].Since.Valid && b[0].SinceAuto && b[0].PatientMBIs == "1SW4N00AA00,2SW4N00AA00"
+	}), mock.Anything)
+}
+
+func (suite *JobServiceV1TestSuite) TestSinceCohortsFirstSince() {
+	first := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	er := v1.ExportRequest{Since: v1.SinceAuto, FirstSince: &first, MBIs: []string{"1SW4N00AA00", "2SW4N00AA00"}}
+
+	cohorts, err := sinceCohorts(er, nil)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), cohorts, 1)
+	assert.Equal(suite.T(), sql.NullTime{Time: first, Valid: true}, *cohorts[0].since)
+	assert.True(suite.T(), cohorts[0].auto)
+
+	// once the group was exported, the schedule's since no longer applies and added members get their full history
+	cohorts, err = sinceCohorts(er, &v1.GroupExport{TransactionTime: first.AddDate(0, 1, 0), PatientMBIs: []string{"1SW4N00AA00"}})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{"1SW4N00AA00"}, cohorts[0].patientMBIs)
+	assert.Equal(suite.T(), first.AddDate(0, 1, 0), cohorts[0].since.Time)
+	assert.Equal(suite.T(), []string{"2SW4N00AA00"}, cohorts[1].patientMBIs)
+	assert.False(suite.T(), cohorts[1].since.Valid)
+}
+
+func (suite *JobServiceV1TestSuite) TestExportIdempotencyKeyReused() {
+	suite.jr.On("FindDuplicateJob", mock.Anything, "12345", mock.Anything).Return(nil, v1Repo.ErrIdempotencyKeyReused)
+
+	exportRequest := v1.ExportRequest{
+		GroupID:        faker.UUIDHyphenated(),
+		Type:           "Patient",
+		MBIs:           []string{faker.UUIDDigit()},
+		ProviderNPI:    faker.UUIDHyphenated(),
+		IdempotencyKey: "retry-1",
+	}
+	b, _ := json.Marshal(exportRequest)
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/v2/Job", bytes.NewReader(b))
+	req = req.WithContext(context.WithValue(req.Context(), middleware2.ContextKeyOrganization, "12345"))
+
+	w := httptest.NewRecorder()
+	suite.service.Export(w, req)
+
+	assert.Equal(suite.T(), http.StatusConflict, w.Result().StatusCode)
+	suite.jr.AssertNotCalled(suite.T(), "InsertUnlessDuplicate", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	suite.jr.AssertCalled(suite.T(), "FindDuplicateJob", mock.Anything, "12345", mock.MatchedBy(func(d v1.JobDedupe) bool {
+		return d.IdempotencyKey == "retry-1"
+	}))
+}
+
+func (suite *JobServiceV1TestSuite) TestExportScheduleError() {
+	suite.jr.On("FindDuplicateJob", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+	suite.sr.On("FindPriorityTier", mock.Anything, "12345").Return(nil, errors.New("error"))
+
+	exportRequest := v1.ExportRequest{
+		GroupID:     faker.UUIDHyphenated(),
+		Since:       time.Now().Format(middleware2.SinceLayout),
+		Type:        "Patient",
+		MBIs:        []string{faker.UUIDDigit()},
+		ProviderNPI: faker.UUIDHyphenated(),
+	}
+	b, _ := json.Marshal(exportRequest)
+
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/v2/Job", bytes.NewReader(b))
+	ctx := context.WithValue(req.Context(), middleware2.ContextKeyOrganization, "12345")
+	req.Header.Set(middleware2.FwdHeader, faker.IPv4())
+	req.Header.Set(middleware2.RequestURLHeader, faker.URL())
+	req = req.WithContext(ctx)
+
+	w := httptest.NewRecorder()
+	suite.service.Export(w, req)
+
+	assert.Equal(suite.T(), http.StatusInternalServerError, w.Result().StatusCode)
+	suite.jr.AssertNotCalled(suite.T(), "InsertUnlessDuplicate", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 }
 
 func (suite *JobServiceV1TestSuite) TestExportRepoError() {
 	ja := jsonassert.New(suite.T())
 
-	suite.jr.On("Insert", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("error"))
+	suite.jr.On("FindDuplicateJob", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+	suite.jr.On("InsertUnlessDuplicate", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, false, errors.New("error"))
+	suite.sr.On("FindPriorityTier", mock.Anything, "12345").Return(v1.DefaultPriorityTier("12345"), nil)
+	suite.sr.On("FindOrgUsage", mock.Anything, "12345", mock.Anything).Return(&v1.OrgUsage{}, nil)
 
 	exportRequest := v1.ExportRequest{
 		GroupID:      faker.UUIDHyphenated(),
@@ -200,6 +556,8 @@ func (suite *JobServiceV1TestSuite) TestExportRepoError() {
 func (suite *JobServiceV1TestSuite) TestGetBatchesAndFiles() {
 	jqb := v1.JobQueueBatch{}
 	_ = faker.FakeData(&jqb)
+	completeTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	jqb.CompleteTime = sql.NullTime{Time: completeTime, Valid: true}
 
 	req := httptest.NewRequest("GET", "http://doesnotmatter.com", nil)
 	ctx := req.Context()
@@ -240,4 +598,217 @@ func (suite *JobServiceV1TestSuite) TestGetBatchesAndFiles() {
 	assert.NotNil(suite.T(), batchesAndFiles)
 	assert.Len(suite.T(), batchesAndFiles, 1)
 	assert.Equal(suite.T(), "testFileName", batchesAndFiles[0].Files[0].FileName)
+	assert.Equal(suite.T(), completeTime.Add(72*time.Hour), batchesAndFiles[0].Batch.ExpiresAt.UTC())
+}
+
+func (suite *JobServiceV1TestSuite) TestCancel() {
+	written := filepath.Join(suite.dir, "batch-1-0.patient.ndjson.gz")
+	other := filepath.Join(suite.dir, "batch-9-0.patient.ndjson.gz")
+	_ = ioutil.WriteFile(written, []byte("{}\n"), 0600)
+	_ = ioutil.WriteFile(other, []byte("{}\n"), 0600)
+
+	req := httptest.NewRequest(http.MethodDelete, "http://doesnotmatter.com", nil)
+	ctx := context.WithValue(req.Context(), middleware2.ContextKeyOrganization, "12345")
+	ctx = context.WithValue(ctx, middleware2.ContextKeyJobID, "54321")
+	req = req.WithContext(ctx)
+
+	suite.jr.On("CancelJob", mock.Anything, "54321", "12345").Return([]string{"batch-1", "batch-2"}, nil)
+
+	w := httptest.NewRecorder()
+	suite.service.Cancel(w, req)
+
+	assert.Equal(suite.T(), http.StatusNoContent, w.Result().StatusCode)
+	assert.NoFileExists(suite.T(), written)
+	assert.FileExists(suite.T(), other)
+}
+
+func (suite *JobServiceV1TestSuite) TestCancelNotFound() {
+	req := httptest.NewRequest(http.MethodDelete, "http://doesnotmatter.com", nil)
+	ctx := context.WithValue(req.Context(), middleware2.ContextKeyOrganization, "12345")
+	ctx = context.WithValue(ctx, middleware2.ContextKeyJobID, "54321")
+	req = req.WithContext(ctx)
+
+	suite.jr.On("CancelJob", mock.Anything, "54321", "12345").Return(nil, v1Repo.ErrJobNotFound)
+
+	w := httptest.NewRecorder()
+	suite.service.Cancel(w, req)
+
+	assert.Equal(suite.T(), http.StatusNotFound, w.Result().StatusCode)
+}
+
+func (suite *JobServiceV1TestSuite) TestList() {
+	req := httptest.NewRequest(http.MethodGet, "http://doesnotmatter.com?status=completed,failed&submittedAfter=2021-01-01T00:00:00Z&_count=10&page=3", nil)
+	ctx := context.WithValue(req.Context(), middleware2.ContextKeyOrganization, "12345")
+	req = req.WithContext(ctx)
+
+	after, _ := time.Parse(time.RFC3339, "2021-01-01T00:00:00Z")
+	complete := after.Add(time.Hour)
+	expected := v1.JobFilter{Statuses: []int{v1.StatusCompleted, v1.StatusFailed}, SubmittedAfter: &after, Limit: 10, Offset: 20}
+	list := &v1.JobList{Jobs: []v1.JobSummary{{JobID: "54321", Status: "COMPLETED", SubmitTime: after, CompleteTime: &complete, ResourceTypes: []string{"Patient"}, PatientCount: 2}}, HasMore: true}
+	suite.jr.On("FindJobs", mock.Anything, "12345", mock.MatchedBy(func(f v1.JobFilter) bool {
+		return assert.ObjectsAreEqual(expected.Statuses, f.Statuses) && f.SubmittedAfter.Equal(after) && f.SubmittedBefore == nil &&
+			f.Limit == expected.Limit && f.Offset == expected.Offset
+	})).Return(list, nil)
+
+	w := httptest.NewRecorder()
+	suite.service.List(w, req)
+
+	res := w.Result()
+	assert.Equal(suite.T(), http.StatusOK, res.StatusCode)
+	var actual v1.JobList
+	_ = json.NewDecoder(res.Body).Decode(&actual)
+	assert.True(suite.T(), actual.HasMore)
+	assert.Len(suite.T(), actual.Jobs, 1)
+	assert.Equal(suite.T(), "54321", actual.Jobs[0].JobID)
+	assert.Equal(suite.T(), 2, actual.Jobs[0].PatientCount)
+}
+
+func (suite *JobServiceV1TestSuite) TestListBadParams() {
+	for _, q := range []string{"status=DONE", "submittedAfter=yesterday", "_count=0", "_count=abc", "page=0", "scheduleId=abc"} {
+		req := httptest.NewRequest(http.MethodGet, "http://doesnotmatter.com?"+q, nil)
+		req = req.WithContext(context.WithValue(req.Context(), middleware2.ContextKeyOrganization, "12345"))
+
+		w := httptest.NewRecorder()
+		suite.service.List(w, req)
+
+		assert.Equal(suite.T(), http.StatusBadRequest, w.Result().StatusCode, q)
+	}
+	suite.jr.AssertNotCalled(suite.T(), "FindJobs", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *JobServiceV1TestSuite) TestGetBatchesAndFilesCancelledJob() {
+	req := httptest.NewRequest(http.MethodGet, "http://doesnotmatter.com", nil)
+	ctx := context.WithValue(req.Context(), middleware2.ContextKeyOrganization, "12345")
+	ctx = context.WithValue(ctx, middleware2.ContextKeyJobID, "54321")
+	req = req.WithContext(ctx)
+
+	suite.jr.On("FindBatchesByJobID", "54321", "12345").Return([]v1.JobQueueBatch{{BatchID: "batch-1", Status: "CANCELLED"}}, nil)
+
+	w := httptest.NewRecorder()
+	suite.service.BatchesAndFiles(w, req)
+
+	assert.Equal(suite.T(), http.StatusNotFound, w.Result().StatusCode)
+	suite.jr.AssertNotCalled(suite.T(), "FindBatchFilesByBatchID", mock.Anything)
+}
+
+func (suite *JobServiceV1TestSuite) TestGetBatchesAndFilesQueued() {
+	req := httptest.NewRequest(http.MethodGet, "http://doesnotmatter.com", nil)
+	ctx := context.WithValue(req.Context(), middleware2.ContextKeyOrganization, "12345")
+	ctx = context.WithValue(ctx, middleware2.ContextKeyJobID, "54321")
+	req = req.WithContext(ctx)
+
+	wait := 90 * time.Second
+	throughput := 0.5
+	suite.jr.On("FindBatchesByJobID", "54321", "12345").Return([]v1.JobQueueBatch{
+		{BatchID: "batch-1", Status: "RUNNING", PatientMBIs: "1,2,3,4,5", PatientIndex: sql.NullInt64{Int64: 1, Valid: true}},
+		{BatchID: "batch-2", Status: "QUEUED", PatientMBIs: "6,7,8,9"},
+	}, nil)
+	suite.jr.On("FindBatchFilesByBatchID", mock.Anything).Return([]v1.JobQueueBatchFile{}, nil)
+	suite.sr.On("FindQueueEstimate", mock.Anything, "54321", mock.Anything).Return(&v1.QueueEstimate{Position: 5, EstimatedWait: &wait}, nil)
+	suite.sr.On("FindThroughput", mock.Anything, mock.Anything).Return(&throughput, nil)
+
+	w := httptest.NewRecorder()
+	suite.service.BatchesAndFiles(w, req)
+
+	var batchesAndFiles []v1.BatchAndFiles
+	_ = json.NewDecoder(w.Result().Body).Decode(&batchesAndFiles)
+	assert.Len(suite.T(), batchesAndFiles, 2)
+	assert.Nil(suite.T(), batchesAndFiles[0].Batch.QueuePosition)
+	assert.Equal(suite.T(), 5, *batchesAndFiles[1].Batch.QueuePosition)
+	assert.Equal(suite.T(), 90, *batchesAndFiles[1].Batch.EstimatedWaitSeconds)
+	// the running batch has three of its five patients left, the queued batch waits its turn before exporting four
+	assert.Equal(suite.T(), 5, batchesAndFiles[0].Batch.TotalPatients)
+	assert.Equal(suite.T(), 2, batchesAndFiles[0].Batch.PatientsProcessed)
+	assert.Equal(suite.T(), 6, *batchesAndFiles[0].Batch.EstimatedSecondsRemaining)
+	assert.Equal(suite.T(), 98, *batchesAndFiles[1].Batch.EstimatedSecondsRemaining)
+}
+
+func (suite *JobServiceV1TestSuite) waitRequest(wait string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "http://doesnotmatter.com/Job/54321?wait="+wait, nil)
+	ctx := context.WithValue(req.Context(), middleware2.ContextKeyOrganization, "12345")
+	ctx = context.WithValue(ctx, middleware2.ContextKeyJobID, "54321")
+	return req.WithContext(ctx)
+}
+
+func (suite *JobServiceV1TestSuite) TestGetBatchesAndFilesWaitUntilFinished() {
+	suite.jr.On("FindBatchesByJobID", "54321", "12345").Return([]v1.JobQueueBatch{
+		{BatchID: "batch-1", Status: "RUNNING", PatientMBIs: "1"},
+	}, nil).Once().Run(func(args mock.Arguments) {
+		// the batch finishes once the request is waiting
+		go suite.waiter.wake("54321")
+	})
+	suite.jr.On("FindBatchesByJobID", "54321", "12345").Return([]v1.JobQueueBatch{
+		{BatchID: "batch-1", Status: "COMPLETED", PatientMBIs: "1"},
+	}, nil).Once()
+	suite.jr.On("FindBatchFilesByBatchID", "batch-1").Return([]v1.JobQueueBatchFile{}, nil)
+
+	w := httptest.NewRecorder()
+	suite.service.BatchesAndFiles(w, suite.waitRequest("30"))
+
+	var batchesAndFiles []v1.BatchAndFiles
+	_ = json.NewDecoder(w.Result().Body).Decode(&batchesAndFiles)
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	assert.Equal(suite.T(), "COMPLETED", batchesAndFiles[0].Batch.Status)
+	suite.jr.AssertNumberOfCalls(suite.T(), "FindBatchesByJobID", 2)
+}
+
+func (suite *JobServiceV1TestSuite) TestGetBatchesAndFilesWaitTimesOut() {
+	conf.SetEnv(suite.T(), "jobs.maxWaitSeconds", "1")
+	throughput := 1.0
+	suite.jr.On("FindBatchesByJobID", "54321", "12345").Return([]v1.JobQueueBatch{
+		{BatchID: "batch-1", Status: "RUNNING", PatientMBIs: "1"},
+	}, nil)
+	suite.jr.On("FindBatchFilesByBatchID", "batch-1").Return([]v1.JobQueueBatchFile{}, nil)
+	suite.sr.On("FindThroughput", mock.Anything, mock.Anything).Return(&throughput, nil)
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	suite.service.BatchesAndFiles(w, suite.waitRequest("600"))
+
+	var batchesAndFiles []v1.BatchAndFiles
+	_ = json.NewDecoder(w.Result().Body).Decode(&batchesAndFiles)
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	assert.Equal(suite.T(), "RUNNING", batchesAndFiles[0].Batch.Status)
+	assert.True(suite.T(), time.Since(start) >= time.Second)
+	suite.jr.AssertNumberOfCalls(suite.T(), "FindBatchesByJobID", 1)
+}
+
+func (suite *JobServiceV1TestSuite) TestGetBatchesAndFilesBadWait() {
+	w := httptest.NewRecorder()
+	suite.service.BatchesAndFiles(w, suite.waitRequest("-1"))
+
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Result().StatusCode)
+	suite.jr.AssertNotCalled(suite.T(), "FindBatchesByJobID", mock.Anything, mock.Anything)
+}
+
+func (suite *JobServiceV1TestSuite) TestGetBatchesAndFilesWithoutThroughput() {
+	req := httptest.NewRequest(http.MethodGet, "http://doesnotmatter.com", nil)
+	ctx := context.WithValue(req.Context(), middleware2.ContextKeyOrganization, "12345")
+	ctx = context.WithValue(ctx, middleware2.ContextKeyJobID, "54321")
+	req = req.WithContext(ctx)
+
+	suite.jr.On("FindBatchesByJobID", "54321", "12345").Return([]v1.JobQueueBatch{
+		{BatchID: "batch-1", Status: "RUNNING", PatientMBIs: "1,2,3"},
+	}, nil)
+	suite.jr.On("FindBatchFilesByBatchID", mock.Anything).Return([]v1.JobQueueBatchFile{}, nil)
+	suite.sr.On("FindThroughput", mock.Anything, mock.Anything).Return(nil, errors.New("error"))
+
+	w := httptest.NewRecorder()
+	suite.service.BatchesAndFiles(w, req)
+
+	var batchesAndFiles []v1.BatchAndFiles
+	_ = json.NewDecoder(w.Result().Body).Decode(&batchesAndFiles)
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	assert.Len(suite.T(), batchesAndFiles, 1)
+	assert.Nil(suite.T(), batchesAndFiles[0].Batch.EstimatedSecondsRemaining)
+}
+
+func TestIsFinished(t *testing.T) {
+	assert.True(t, isFinished([]v1.JobQueueBatch{{Status: "COMPLETED"}, {Status: "COMPLETED"}}))
+	assert.True(t, isFinished([]v1.JobQueueBatch{{Status: "COMPLETED"}, {Status: "FAILED"}}))
+	assert.True(t, isFinished([]v1.JobQueueBatch{{Status: "RUNNING"}, {Status: "CANCELLED"}}))
+	// a failed batch does not end the job while others are still to run
+	assert.False(t, isFinished([]v1.JobQueueBatch{{Status: "FAILED"}, {Status: "RUNNING"}}))
+	assert.False(t, isFinished([]v1.JobQueueBatch{{Status: "FAILED"}, {Status: "QUEUED"}}))
+	assert.False(t, isFinished([]v1.JobQueueBatch{{Status: "COMPLETED"}, {Status: "QUEUED"}}))
 }
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/CMSgov/dpc/attribution/logger"
+	v1Repo "github.com/CMSgov/dpc/attribution/repository/v1"
+	"go.uber.org/zap"
+)
+
+// JobWaiter wakes the requests waiting on a job whenever one of its batches finishes. All of them share the single
+// connection of the listener, so a waiting request holds no db connection.
+type JobWaiter struct {
+	listener   v1Repo.JobListener
+	retryDelay time.Duration
+	mu         sync.Mutex
+	waiters    map[string]map[chan struct{}]bool
+}
+
+// NewJobWaiter creates a JobWaiter, which is notified once Run is started
+func NewJobWaiter(listener v1Repo.JobListener, retryDelay time.Duration) *JobWaiter {
+	return &JobWaiter{
+		listener:   listener,
+		retryDelay: retryDelay,
+		waiters:    make(map[string]map[chan struct{}]bool),
+	}
+}
+
+// Run receives the finished batches until the context is done. When listening fails, every waiter is woken to
+// reload its job, as the notifications sent until the listener reconnects are lost.
+func (jw *JobWaiter) Run(ctx context.Context) {
+	log := logger.WithContext(ctx)
+	for {
+		jobID, err := jw.listener.WaitForFinishedBatch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Error("Failed to listen for finished batches", zap.Error(err))
+			jw.wakeAll()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(jw.retryDelay):
+			}
+			continue
+		}
+		jw.wake(jobID)
+	}
+}
+
+// Subscribe returns a channel that receives when a batch of the job finishes, and the function to stop receiving.
+// Finishes that happen before the receiver reads the channel are coalesced into one.
+func (jw *JobWaiter) Subscribe(jobID string) (<-chan struct{}, func()) {
+	c := make(chan struct{}, 1)
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+	if jw.waiters[jobID] == nil {
+		jw.waiters[jobID] = make(map[chan struct{}]bool)
+	}
+	jw.waiters[jobID][c] = true
+	return c, func() {
+		jw.mu.Lock()
+		defer jw.mu.Unlock()
+		delete(jw.waiters[jobID], c)
+		if len(jw.waiters[jobID]) == 0 {
+			delete(jw.waiters, jobID)
+		}
+	}
+}
+
+func (jw *JobWaiter) wake(jobID string) {
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+	for c := range jw.waiters[jobID] {
+		notify(c)
+	}
+}
+
+func (jw *JobWaiter) wakeAll() {
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+	for _, waiters := range jw.waiters {
+		for c := range waiters {
+			notify(c)
+		}
+	}
+}
+
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockJobListener struct {
+	mock.Mock
+}
+
+func (m *MockJobListener) WaitForFinishedBatch(ctx context.Context) (string, error) {
+	args := m.Called(ctx)
+	return args.String(0), args.Error(1)
+}
+
+type JobWaiterTestSuite struct {
+	suite.Suite
+	listener *MockJobListener
+	waiter   *JobWaiter
+}
+
+func TestJobWaiterTestSuite(t *testing.T) {
+	suite.Run(t, new(JobWaiterTestSuite))
+}
+
+func (suite *JobWaiterTestSuite) SetupTest() {
+	suite.listener = new(MockJobListener)
+	suite.waiter = NewJobWaiter(suite.listener, time.Millisecond)
+}
+
+func received(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	case <-time.After(time.Second):
+		return false
+	}
+}
+
+func (suite *JobWaiterTestSuite) TestRunWakesWaitersOfJob() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	job1, stop1 := suite.waiter.Subscribe("job-1")
+	defer stop1()
+	job2, stop2 := suite.waiter.Subscribe("job-2")
+	defer stop2()
+
+	suite.listener.On("WaitForFinishedBatch", mock.Anything).Return("job-1", nil).Once()
+	suite.listener.On("WaitForFinishedBatch", mock.Anything).Return("", context.Canceled).Run(func(args mock.Arguments) {
+		cancel()
+	})
+
+	suite.waiter.Run(ctx)
+
+	assert.True(suite.T(), received(job1))
+	assert.Len(suite.T(), job2, 0)
+}
+
+func (suite *JobWaiterTestSuite) TestRunWakesAllWaitersWhenListeningFails() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	job1, stop1 := suite.waiter.Subscribe("job-1")
+	defer stop1()
+	job2, stop2 := suite.waiter.Subscribe("job-2")
+	defer stop2()
+
+	suite.listener.On("WaitForFinishedBatch", mock.Anything).Return("", errors.New("connection reset")).Once()
+	suite.listener.On("WaitForFinishedBatch", mock.Anything).Return("", context.Canceled).Run(func(args mock.Arguments) {
+		cancel()
+	})
+
+	suite.waiter.Run(ctx)
+
+	assert.True(suite.T(), received(job1))
+	assert.True(suite.T(), received(job2))
+}
+
+func (suite *JobWaiterTestSuite) TestUnsubscribe() {
+	c, stop := suite.waiter.Subscribe("job-1")
+	stop()
+
+	suite.waiter.wake("job-1")
+
+	assert.Len(suite.T(), c, 0)
+	assert.Empty(suite.T(), suite.waiter.waiters)
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/CMSgov/dpc/attribution/logger"
+	"github.com/CMSgov/dpc/attribution/middleware"
+	"github.com/CMSgov/dpc/attribution/model/v1"
+	v1Repo "github.com/CMSgov/dpc/attribution/repository/v1"
+	"github.com/CMSgov/dpc/attribution/util"
+	"github.com/darahayes/go-boom"
+	"go.uber.org/zap"
+)
+
+// OrgPriorityService is an interface for testing to be able to mock the services in the router test
+type OrgPriorityService interface {
+	Get(w http.ResponseWriter, r *http.Request)
+	Put(w http.ResponseWriter, r *http.Request)
+}
+
+// OrgPriorityServiceV1 is a struct that defines what the service has
+type OrgPriorityServiceV1 struct {
+	sr v1Repo.PriorityRepo
+}
+
+// NewOrgPriorityService creates a service for admins to manage the priority tier and concurrency cap of organizations
+func NewOrgPriorityService(sr v1Repo.PriorityRepo) OrgPriorityService {
+	return &OrgPriorityServiceV1{
+		sr,
+	}
+}
+
+// Get function returns the priority tier of the organization
+func (ps *OrgPriorityServiceV1) Get(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	orgID := util.FetchValueFromContext(r.Context(), w, middleware.ContextKeyOrganization)
+
+	priority, err := ps.sr.FindPriorityTier(r.Context(), orgID)
+	if err != nil {
+		log.Error("Failed to find organization priority tier", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return
+	}
+	writePriorityTier(w, r, priority)
+}
+
+// Put function replaces the priority tier of the organization
+func (ps *OrgPriorityServiceV1) Put(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	orgID := util.FetchValueFromContext(r.Context(), w, middleware.ContextKeyOrganization)
+
+	priority := v1.DefaultPriorityTier(orgID)
+	if err := json.NewDecoder(r.Body).Decode(priority); err != nil {
+		log.Error("Failed to parse priority tier", zap.Error(err))
+		boom.BadRequest(w, "Failed to parse priority tier")
+		return
+	}
+	priority.OrganizationID = orgID
+	if !v1.ValidTier(priority.Tier) {
+		boom.BadData(w, fmt.Sprintf("Invalid tier %s, must be one of high, standard or low", priority.Tier))
+		return
+	}
+	if priority.MaxConcurrentBatches < 0 {
+		boom.BadData(w, "maxConcurrentBatches can't be negative")
+		return
+	}
+
+	if err := ps.sr.SavePriorityTier(r.Context(), *priority); err != nil {
+		log.Error("Failed to save organization priority tier", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return
+	}
+	log.Info(fmt.Sprintf("Set priority tier of organization %s to tier %s with at most %d concurrent batches", orgID, priority.Tier, priority.MaxConcurrentBatches))
+	writePriorityTier(w, r, priority)
+}
+
+func writePriorityTier(w http.ResponseWriter, r *http.Request, priority *v1.PriorityTier) {
+	log := logger.WithContext(r.Context())
+	b, err := json.Marshal(priority)
+	if err != nil {
+		log.Error("Failed to convert priority tier to bytes", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return
+	}
+	if _, err := w.Write(b); err != nil {
+		log.Error("Failed to write priority tier to response", zap.Error(err))
+		boom.Internal(w, err.Error())
+	}
+}
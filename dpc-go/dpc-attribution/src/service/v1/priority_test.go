@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	middleware2 "github.com/CMSgov/dpc/attribution/middleware"
+	"github.com/CMSgov/dpc/attribution/model/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type OrgPriorityServiceV1TestSuite struct {
+	suite.Suite
+	sr      *MockPriorityRepo
+	service OrgPriorityService
+}
+
+func TestOrgPriorityServiceV1TestSuite(t *testing.T) {
+	suite.Run(t, new(OrgPriorityServiceV1TestSuite))
+}
+
+func (suite *OrgPriorityServiceV1TestSuite) SetupTest() {
+	suite.sr = &MockPriorityRepo{}
+	suite.service = NewOrgPriorityService(suite.sr)
+}
+
+func (suite *OrgPriorityServiceV1TestSuite) request(method string, body string) *http.Request {
+	req := httptest.NewRequest(method, "http://doesnotmatter.com", strings.NewReader(body))
+	return req.WithContext(context.WithValue(req.Context(), middleware2.ContextKeyOrganization, "12345"))
+}
+
+func (suite *OrgPriorityServiceV1TestSuite) TestGet() {
+	suite.sr.On("FindPriorityTier", mock.Anything, "12345").Return(&v1.PriorityTier{OrganizationID: "12345", Tier: v1.TierLow, MaxConcurrentBatches: 2}, nil)
+
+	w := httptest.NewRecorder()
+	suite.service.Get(w, suite.request(http.MethodGet, ""))
+
+	var priority v1.PriorityTier
+	_ = json.NewDecoder(w.Result().Body).Decode(&priority)
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	assert.Equal(suite.T(), v1.TierLow, priority.Tier)
+	assert.Equal(suite.T(), 2, priority.MaxConcurrentBatches)
+}
+
+func (suite *OrgPriorityServiceV1TestSuite) TestPut() {
+	expected := v1.PriorityTier{OrganizationID: "12345", Tier: v1.TierHigh, MaxConcurrentBatches: 4}
+	suite.sr.On("SavePriorityTier", mock.Anything, expected).Return(nil)
+
+	w := httptest.NewRecorder()
+	suite.service.Put(w, suite.request(http.MethodPut, `{"organizationID":"other","tier":"high","maxConcurrentBatches":4}`))
+
+	var priority v1.PriorityTier
+	_ = json.NewDecoder(w.Result().Body).Decode(&priority)
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	assert.Equal(suite.T(), expected, priority)
+	suite.sr.AssertExpectations(suite.T())
+}
+
+func (suite *OrgPriorityServiceV1TestSuite) TestPutInvalid() {
+	for body, status := range map[string]int{
+		`{"tier":"urgent"}`:                              http.StatusUnprocessableEntity,
+		`{"tier":"low","maxConcurrentBatches":-1}`:       http.StatusUnprocessableEntity,
+		`{"tier":"low","maxConcurrentBatches":"twelve"}`: http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		suite.service.Put(w, suite.request(http.MethodPut, body))
+
+		assert.Equal(suite.T(), status, w.Result().StatusCode, body)
+	}
+	suite.sr.AssertNotCalled(suite.T(), "SavePriorityTier", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/CMSgov/dpc/attribution/logger"
+	"github.com/CMSgov/dpc/attribution/middleware"
+	"github.com/CMSgov/dpc/attribution/model/v1"
+	v1Repo "github.com/CMSgov/dpc/attribution/repository/v1"
+	"github.com/CMSgov/dpc/attribution/util"
+	"github.com/darahayes/go-boom"
+	"go.uber.org/zap"
+)
+
+// OrgRetentionService is an interface for testing to be able to mock the services in the router test
+type OrgRetentionService interface {
+	Get(w http.ResponseWriter, r *http.Request)
+	Put(w http.ResponseWriter, r *http.Request)
+	Delete(w http.ResponseWriter, r *http.Request)
+}
+
+// OrgRetentionServiceV1 is a struct that defines what the service has
+type OrgRetentionServiceV1 struct {
+	rr     v1Repo.OrgRetentionRepo
+	policy v1.RetentionPolicy
+}
+
+// NewOrgRetentionService creates a service for admins to manage how long the files of an organization are kept
+func NewOrgRetentionService(rr v1Repo.OrgRetentionRepo, policy v1.RetentionPolicy) OrgRetentionService {
+	return &OrgRetentionServiceV1{
+		rr,
+		policy,
+	}
+}
+
+// Get function returns the retention period of the organization, the default when an admin hasn't set one
+func (rs *OrgRetentionServiceV1) Get(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	orgID := util.FetchValueFromContext(r.Context(), w, middleware.ContextKeyOrganization)
+
+	retention, err := retentionFor(r.Context(), rs.rr, rs.policy, orgID)
+	if err != nil {
+		log.Error("Failed to find organization retention", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return
+	}
+	writeRetention(w, r, v1.OrgRetention{OrganizationID: orgID, Hours: int(retention.Hours())})
+}
+
+// Put function overrides the retention period of the organization
+func (rs *OrgRetentionServiceV1) Put(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	orgID := util.FetchValueFromContext(r.Context(), w, middleware.ContextKeyOrganization)
+
+	var retention v1.OrgRetention
+	if err := json.NewDecoder(r.Body).Decode(&retention); err != nil {
+		log.Error("Failed to parse retention", zap.Error(err))
+		boom.BadRequest(w, "Failed to parse retention")
+		return
+	}
+	retention.OrganizationID = orgID
+	if retention.Hours < 1 {
+		boom.BadData(w, "hours must be 1 or more")
+		return
+	}
+
+	if err := rs.rr.SaveRetentionHours(r.Context(), orgID, retention.Hours); err != nil {
+		log.Error("Failed to save organization retention", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return
+	}
+	log.Info(fmt.Sprintf("Set retention of organization %s to %d hours", orgID, retention.Hours))
+	writeRetention(w, r, retention)
+}
+
+// Delete function resets the organization to the default retention period
+func (rs *OrgRetentionServiceV1) Delete(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	orgID := util.FetchValueFromContext(r.Context(), w, middleware.ContextKeyOrganization)
+
+	if err := rs.rr.DeleteRetentionHours(r.Context(), orgID); err != nil {
+		log.Error("Failed to reset organization retention", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return
+	}
+	log.Info(fmt.Sprintf("Reset retention of organization %s to the default", orgID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// retentionFor returns how long the files of the organization are kept, the hours an admin set or the default
+func retentionFor(ctx context.Context, rr v1Repo.OrgRetentionRepo, policy v1.RetentionPolicy, orgID string) (time.Duration, error) {
+	hours, err := rr.FindRetentionHours(ctx, orgID)
+	if err != nil {
+		return 0, err
+	}
+	if hours == nil {
+		return policy.Default, nil
+	}
+	return time.Duration(*hours) * time.Hour, nil
+}
+
+func writeRetention(w http.ResponseWriter, r *http.Request, retention v1.OrgRetention) {
+	log := logger.WithContext(r.Context())
+	b, err := json.Marshal(retention)
+	if err != nil {
+		log.Error("Failed to convert retention to bytes", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return
+	}
+	if _, err := w.Write(b); err != nil {
+		log.Error("Failed to write retention to response", zap.Error(err))
+		boom.Internal(w, err.Error())
+	}
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	middleware2 "github.com/CMSgov/dpc/attribution/middleware"
+	"github.com/CMSgov/dpc/attribution/model/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type OrgRetentionServiceV1TestSuite struct {
+	suite.Suite
+	rr      *MockOrgRetentionRepo
+	service OrgRetentionService
+}
+
+func TestOrgRetentionServiceV1TestSuite(t *testing.T) {
+	suite.Run(t, new(OrgRetentionServiceV1TestSuite))
+}
+
+func (suite *OrgRetentionServiceV1TestSuite) SetupTest() {
+	suite.rr = &MockOrgRetentionRepo{}
+	suite.service = NewOrgRetentionService(suite.rr, v1.RetentionPolicy{Enabled: true, Default: 24 * time.Hour})
+}
+
+func (suite *OrgRetentionServiceV1TestSuite) request(method string, body string) *http.Request {
+	req := httptest.NewRequest(method, "http://doesnotmatter.com", strings.NewReader(body))
+	return req.WithContext(context.WithValue(req.Context(), middleware2.ContextKeyOrganization, "12345"))
+}
+
+func (suite *OrgRetentionServiceV1TestSuite) TestGet() {
+	hours := 72
+	suite.rr.On("FindRetentionHours", mock.Anything, "12345").Return(&hours, nil)
+
+	w := httptest.NewRecorder()
+	suite.service.Get(w, suite.request(http.MethodGet, ""))
+
+	var retention v1.OrgRetention
+	_ = json.NewDecoder(w.Result().Body).Decode(&retention)
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	assert.Equal(suite.T(), v1.OrgRetention{OrganizationID: "12345", Hours: 72}, retention)
+}
+
+func (suite *OrgRetentionServiceV1TestSuite) TestGetDefault() {
+	suite.rr.On("FindRetentionHours", mock.Anything, "12345").Return(nil, nil)
+
+	w := httptest.NewRecorder()
+	suite.service.Get(w, suite.request(http.MethodGet, ""))
+
+	var retention v1.OrgRetention
+	_ = json.NewDecoder(w.Result().Body).Decode(&retention)
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	assert.Equal(suite.T(), v1.OrgRetention{OrganizationID: "12345", Hours: 24}, retention)
+}
+
+func (suite *OrgRetentionServiceV1TestSuite) TestPut() {
+	suite.rr.On("SaveRetentionHours", mock.Anything, "12345", 168).Return(nil)
+
+	w := httptest.NewRecorder()
+	suite.service.Put(w, suite.request(http.MethodPut, `{"organizationID":"other","hours":168}`))
+
+	var retention v1.OrgRetention
+	_ = json.NewDecoder(w.Result().Body).Decode(&retention)
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	assert.Equal(suite.T(), v1.OrgRetention{OrganizationID: "12345", Hours: 168}, retention)
+	suite.rr.AssertExpectations(suite.T())
+}
+
+func (suite *OrgRetentionServiceV1TestSuite) TestPutInvalid() {
+	for body, status := range map[string]int{
+		`{"hours":0}`:       http.StatusUnprocessableEntity,
+		`{"hours":-24}`:     http.StatusUnprocessableEntity,
+		`{"hours":"a day"}`: http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		suite.service.Put(w, suite.request(http.MethodPut, body))
+
+		assert.Equal(suite.T(), status, w.Result().StatusCode, body)
+	}
+	suite.rr.AssertNotCalled(suite.T(), "SaveRetentionHours", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *OrgRetentionServiceV1TestSuite) TestDelete() {
+	suite.rr.On("DeleteRetentionHours", mock.Anything, "12345").Return(nil)
+
+	w := httptest.NewRecorder()
+	suite.service.Delete(w, suite.request(http.MethodDelete, ""))
+
+	assert.Equal(suite.T(), http.StatusNoContent, w.Result().StatusCode)
+	suite.rr.AssertExpectations(suite.T())
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/CMSgov/dpc/attribution/conf"
+	"github.com/CMSgov/dpc/attribution/model/v1"
+	v1Repo "github.com/CMSgov/dpc/attribution/repository/v1"
+)
+
+// Batch priorities are claimed lowest first. A new job starts from the base priority of its organization's tier,
+// bulk jobs queue behind single patient jobs as they always have, and the cost of the job's size and the
+// organization's recent usage is added on top. Each batch of a job then ranks a step behind the one before, so the
+// later batches of a large job interleave with the jobs submitted after it instead of starving them.
+const (
+	bulkJobPriority = 4000
+	// maxSizePriority caps the cost of a job's size, which is one per batch
+	maxSizePriority = 500
+	// activeBatchPriority is the cost of each queued or running batch of the organization
+	activeBatchPriority = 5
+	// maxUsagePriority caps the cost of an organization's usage
+	maxUsagePriority  = 1000
+	batchStepPriority = 10
+)
+
+var tierPriorities = map[string]int{v1.TierHigh: 0, v1.TierStandard: 1000, v1.TierLow: 3000}
+
+// SchedulerConfig holds the settings of a Scheduler
+type SchedulerConfig struct {
+	// UsageWindow is how far back finished batches count towards an organization's usage
+	UsageWindow time.Duration
+	// EstimateWindow is how far back finished batches are averaged to estimate queue waits and time remaining
+	EstimateWindow time.Duration
+}
+
+// NewSchedulerConfig reads the scheduler settings from config
+func NewSchedulerConfig() SchedulerConfig {
+	return SchedulerConfig{
+		UsageWindow:    time.Duration(conf.GetAsInt("scheduler.usageWindowHours", 24)) * time.Hour,
+		EstimateWindow: time.Duration(conf.GetAsInt("scheduler.estimateWindowMinutes", 60)) * time.Minute,
+	}
+}
+
+// Scheduler assigns the priorities of new batches so organizations get a fair share of the export workers
+type Scheduler struct {
+	sr     v1Repo.PriorityRepo
+	config SchedulerConfig
+}
+
+// NewScheduler creates a Scheduler
+func NewScheduler(sr v1Repo.PriorityRepo, config SchedulerConfig) *Scheduler {
+	return &Scheduler{
+		sr,
+		config,
+	}
+}
+
+// Assign sets the priority of each batch of a new job of the organization exporting the given number of patients
+func (s *Scheduler) Assign(ctx context.Context, orgID string, batches []v1.BatchRequest, patients int) error {
+	tier, err := s.sr.FindPriorityTier(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	usage, err := s.sr.FindOrgUsage(ctx, orgID, time.Now().Add(-s.config.UsageWindow))
+	if err != nil {
+		return err
+	}
+
+	priority := tierPriorities[tier.Tier]
+	if patients > 1 {
+		priority += bulkJobPriority + minInt(len(batches), maxSizePriority)
+	}
+	priority += minInt(usage.ActiveBatches*activeBatchPriority+usage.RecentBatches, maxUsagePriority)
+	for i := range batches {
+		batches[i].Priority = priority + i*batchStepPriority
+	}
+	return nil
+}
+
+// Estimate returns where the next queued batch of the job stands in the queue
+func (s *Scheduler) Estimate(ctx context.Context, jobID string) (*v1.QueueEstimate, error) {
+	return s.sr.FindQueueEstimate(ctx, jobID, time.Now().Add(-s.config.EstimateWindow))
+}
+
+// Throughput returns how many patients a batch recently exported per second, or nil without recent batches
+func (s *Scheduler) Throughput(ctx context.Context) (*float64, error) {
+	return s.sr.FindThroughput(ctx, time.Now().Add(-s.config.EstimateWindow))
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CMSgov/dpc/attribution/model/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSchedulerAssign(t *testing.T) {
+	tests := []struct {
+		name     string
+		tier     *v1.PriorityTier
+		usage    *v1.OrgUsage
+		batches  int
+		patients int
+		expected []int
+	}{
+		{"single patient high tier", &v1.PriorityTier{Tier: v1.TierHigh}, &v1.OrgUsage{}, 1, 1, []int{0}},
+		{"bulk standard tier", &v1.PriorityTier{Tier: v1.TierStandard}, &v1.OrgUsage{}, 3, 300, []int{5003, 5013, 5023}},
+		{"bulk low tier with usage", &v1.PriorityTier{Tier: v1.TierLow}, &v1.OrgUsage{ActiveBatches: 10, RecentBatches: 20}, 2, 200, []int{7072, 7082}},
+		{"usage is capped", &v1.PriorityTier{Tier: v1.TierStandard}, &v1.OrgUsage{ActiveBatches: 1000}, 1, 1, []int{2000}},
+	}
+	for _, test := range tests {
+		sr := &MockPriorityRepo{}
+		sr.On("FindPriorityTier", mock.Anything, "12345").Return(test.tier, nil)
+		sr.On("FindOrgUsage", mock.Anything, "12345", mock.Anything).Return(test.usage, nil)
+		scheduler := NewScheduler(sr, SchedulerConfig{UsageWindow: time.Hour})
+
+		batches := make([]v1.BatchRequest, test.batches)
+		err := scheduler.Assign(context.Background(), "12345", batches, test.patients)
+
+		assert.NoError(t, err, test.name)
+		for i, b := range batches {
+			assert.Equal(t, test.expected[i], b.Priority, test.name)
+		}
+	}
+}
+
+func TestSchedulerLaterBatchesInterleave(t *testing.T) {
+	sr := &MockPriorityRepo{}
+	sr.On("FindPriorityTier", mock.Anything, mock.Anything).Return(&v1.PriorityTier{Tier: v1.TierStandard}, nil)
+	sr.On("FindOrgUsage", mock.Anything, "big", mock.Anything).Return(&v1.OrgUsage{}, nil)
+	sr.On("FindOrgUsage", mock.Anything, "small", mock.Anything).Return(&v1.OrgUsage{ActiveBatches: 50}, nil)
+	scheduler := NewScheduler(sr, SchedulerConfig{UsageWindow: time.Hour})
+
+	big := make([]v1.BatchRequest, 100)
+	small := make([]v1.BatchRequest, 1)
+	_ = scheduler.Assign(context.Background(), "big", big, 10000)
+	_ = scheduler.Assign(context.Background(), "small", small, 10)
+
+	// the small job submitted later still runs before most of the big job
+	assert.Less(t, small[0].Priority, big[len(big)-1].Priority)
+	assert.Greater(t, small[0].Priority, big[0].Priority)
+}
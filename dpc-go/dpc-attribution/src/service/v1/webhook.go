@@ -0,0 +1,174 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/CMSgov/dpc/attribution/conf"
+	"github.com/CMSgov/dpc/attribution/logger"
+	"github.com/CMSgov/dpc/attribution/middleware"
+	"github.com/CMSgov/dpc/attribution/model/v1"
+	v1Repo "github.com/CMSgov/dpc/attribution/repository/v1"
+	"github.com/CMSgov/dpc/attribution/util"
+	"github.com/darahayes/go-boom"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// WebhookService is an interface for testing to be able to mock the services in the router test
+type WebhookService interface {
+	Get(w http.ResponseWriter, r *http.Request)
+	Put(w http.ResponseWriter, r *http.Request)
+	Delete(w http.ResponseWriter, r *http.Request)
+	Deliveries(w http.ResponseWriter, r *http.Request)
+}
+
+// WebhookServiceV1 is a struct that defines what the service has
+type WebhookServiceV1 struct {
+	wr v1Repo.WebhookRepo
+}
+
+// NewWebhookService creates a service for organizations to manage the webhook notified when their jobs finish
+func NewWebhookService(wr v1Repo.WebhookRepo) WebhookService {
+	return &WebhookServiceV1{
+		wr,
+	}
+}
+
+// Get function returns the webhook of the organization, without its secret
+func (ws *WebhookServiceV1) Get(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	orgID := util.FetchValueFromContext(r.Context(), w, middleware.ContextKeyOrganization)
+
+	webhook, err := ws.wr.FindWebhook(r.Context(), orgID)
+	if errors.Is(err, v1Repo.ErrWebhookNotFound) {
+		boom.NotFound(w, "No webhook registered for the organization")
+		return
+	}
+	if err != nil {
+		log.Error("Failed to find organization webhook", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return
+	}
+	webhook.Secret = ""
+	writeJSON(w, r, webhook)
+}
+
+// Put function registers the webhook of the organization with a newly generated secret, which is only returned
+// by this call
+func (ws *WebhookServiceV1) Put(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	orgID := util.FetchValueFromContext(r.Context(), w, middleware.ContextKeyOrganization)
+
+	var webhook v1.OrgWebhook
+	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+		log.Error("Failed to parse webhook", zap.Error(err))
+		boom.BadRequest(w, "Failed to parse webhook")
+		return
+	}
+	if !ValidWebhookURL(webhook.URL) {
+		boom.BadData(w, "Invalid webhook url, must be an absolute https URL on a public host")
+		return
+	}
+	secret, err := newWebhookSecret()
+	if err != nil {
+		log.Error("Failed to generate webhook secret", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return
+	}
+	webhook.OrganizationID = orgID
+	webhook.Secret = secret
+	webhook.UpdatedAt = time.Now()
+
+	if err := ws.wr.SaveWebhook(r.Context(), webhook); err != nil {
+		log.Error("Failed to save organization webhook", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return
+	}
+	log.Info(fmt.Sprintf("Registered webhook of organization %s", orgID))
+	writeJSON(w, r, webhook)
+}
+
+// Delete function removes the webhook of the organization
+func (ws *WebhookServiceV1) Delete(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	orgID := util.FetchValueFromContext(r.Context(), w, middleware.ContextKeyOrganization)
+
+	err := ws.wr.DeleteWebhook(r.Context(), orgID)
+	if errors.Is(err, v1Repo.ErrWebhookNotFound) {
+		boom.NotFound(w, "No webhook registered for the organization")
+		return
+	}
+	if err != nil {
+		log.Error("Failed to delete organization webhook", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return
+	}
+	log.Info(fmt.Sprintf("Deleted webhook of organization %s", orgID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Deliveries function returns the delivery log of the organization, newest first
+func (ws *WebhookServiceV1) Deliveries(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+	orgID := util.FetchValueFromContext(r.Context(), w, middleware.ContextKeyOrganization)
+
+	deliveries, err := ws.wr.FindDeliveries(r.Context(), orgID, conf.GetAsInt("webhooks.deliveriesPageSize", 100))
+	if err != nil {
+		log.Error("Failed to find webhook deliveries", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return
+	}
+	writeJSON(w, r, deliveries)
+}
+
+// ValidWebhookURL reports whether the URL is an absolute https URL on a public host. Plain http and internal hosts
+// are only allowed in the local environment.
+func ValidWebhookURL(u string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	if conf.IsLocal() {
+		return parsed.Scheme == "http" || parsed.Scheme == "https"
+	}
+	return parsed.Scheme == "https" && util.PublicHost(parsed)
+}
+
+// sameWebhookHost reports whether the webhook URL is on the host of the organization's registered webhook
+func sameWebhookHost(registered string, u string) bool {
+	r, err := url.Parse(registered)
+	if err != nil {
+		return false
+	}
+	parsed, err := url.Parse(u)
+	return err == nil && strings.EqualFold(r.Host, parsed.Host)
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	log := logger.WithContext(r.Context())
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Error("Failed to convert response to bytes", zap.Error(err))
+		boom.Internal(w, err.Error())
+		return
+	}
+	if _, err := w.Write(b); err != nil {
+		log.Error("Failed to write response", zap.Error(err))
+		boom.Internal(w, err.Error())
+	}
+}
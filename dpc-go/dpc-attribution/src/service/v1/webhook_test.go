@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	middleware2 "github.com/CMSgov/dpc/attribution/middleware"
+	"github.com/CMSgov/dpc/attribution/model/v1"
+	v1Repo "github.com/CMSgov/dpc/attribution/repository/v1"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockWebhookRepo struct {
+	mock.Mock
+}
+
+func (m *MockWebhookRepo) FindWebhook(ctx context.Context, orgID string) (*v1.OrgWebhook, error) {
+	args := m.Called(ctx, orgID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*v1.OrgWebhook), args.Error(1)
+}
+
+func (m *MockWebhookRepo) SaveWebhook(ctx context.Context, webhook v1.OrgWebhook) error {
+	args := m.Called(ctx, webhook)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepo) DeleteWebhook(ctx context.Context, orgID string) error {
+	args := m.Called(ctx, orgID)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepo) FindDeliveries(ctx context.Context, orgID string, limit int) ([]v1.WebhookDelivery, error) {
+	args := m.Called(ctx, orgID, limit)
+	return args.Get(0).([]v1.WebhookDelivery), args.Error(1)
+}
+
+type WebhookServiceV1TestSuite struct {
+	suite.Suite
+	wr      *MockWebhookRepo
+	service WebhookService
+}
+
+func TestWebhookServiceV1TestSuite(t *testing.T) {
+	suite.Run(t, new(WebhookServiceV1TestSuite))
+}
+
+func (suite *WebhookServiceV1TestSuite) SetupTest() {
+	suite.wr = &MockWebhookRepo{}
+	suite.service = NewWebhookService(suite.wr)
+}
+
+func (suite *WebhookServiceV1TestSuite) request(method string, body string) *http.Request {
+	req := httptest.NewRequest(method, "http://doesnotmatter.com", strings.NewReader(body))
+	return req.WithContext(context.WithValue(req.Context(), middleware2.ContextKeyOrganization, "12345"))
+}
+
+func (suite *WebhookServiceV1TestSuite) TestGet() {
+	suite.wr.On("FindWebhook", mock.Anything, "12345").Return(&v1.OrgWebhook{OrganizationID: "12345", URL: "https://example.com/hook", Secret: "secret"}, nil)
+
+	w := httptest.NewRecorder()
+	suite.service.Get(w, suite.request(http.MethodGet, ""))
+
+	var webhook v1.OrgWebhook
+	_ = json.NewDecoder(w.Result().Body).Decode(&webhook)
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	assert.Equal(suite.T(), "https://example.com/hook", webhook.URL)
+	assert.Empty(suite.T(), webhook.Secret)
+}
+
+func (suite *WebhookServiceV1TestSuite) TestGetNotFound() {
+	suite.wr.On("FindWebhook", mock.Anything, "12345").Return(nil, v1Repo.ErrWebhookNotFound)
+
+	w := httptest.NewRecorder()
+	suite.service.Get(w, suite.request(http.MethodGet, ""))
+
+	assert.Equal(suite.T(), http.StatusNotFound, w.Result().StatusCode)
+}
+
+func (suite *WebhookServiceV1TestSuite) TestPut() {
+	suite.wr.On("SaveWebhook", mock.Anything, mock.MatchedBy(func(w v1.OrgWebhook) bool {
+		return w.OrganizationID == "12345" && w.URL == "https://example.com/hook" && len(w.Secret) == 64
+	})).Return(nil)
+
+	w := httptest.NewRecorder()
+	suite.service.Put(w, suite.request(http.MethodPut, `{"organizationID":"other","url":"https://example.com/hook","secret":"mine"}`))
+
+	var webhook v1.OrgWebhook
+	_ = json.NewDecoder(w.Result().Body).Decode(&webhook)
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	assert.Equal(suite.T(), "12345", webhook.OrganizationID)
+	assert.Len(suite.T(), webhook.Secret, 64)
+	assert.NotEqual(suite.T(), "mine", webhook.Secret)
+	suite.wr.AssertExpectations(suite.T())
+}
+
+func (suite *WebhookServiceV1TestSuite) TestPutInvalid() {
+	for body, status := range map[string]int{
+		`{"url":"ftp://example.com/hook"}`: http.StatusUnprocessableEntity,
+		`{"url":"/hook"}`:                  http.StatusUnprocessableEntity,
+		`{"url":12}`:                       http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		suite.service.Put(w, suite.request(http.MethodPut, body))
+
+		assert.Equal(suite.T(), status, w.Result().StatusCode, body)
+	}
+	suite.wr.AssertNotCalled(suite.T(), "SaveWebhook", mock.Anything, mock.Anything)
+}
+
+func (suite *WebhookServiceV1TestSuite) TestDelete() {
+	suite.wr.On("DeleteWebhook", mock.Anything, "12345").Once().Return(nil)
+	suite.wr.On("DeleteWebhook", mock.Anything, "12345").Once().Return(v1Repo.ErrWebhookNotFound)
+	suite.wr.On("DeleteWebhook", mock.Anything, "12345").Once().Return(errors.New("error"))
+
+	for _, status := range []int{http.StatusNoContent, http.StatusNotFound, http.StatusInternalServerError} {
+		w := httptest.NewRecorder()
+		suite.service.Delete(w, suite.request(http.MethodDelete, ""))
+		assert.Equal(suite.T(), status, w.Result().StatusCode)
+	}
+}
+
+func (suite *WebhookServiceV1TestSuite) TestDeliveries() {
+	code := http.StatusServiceUnavailable
+	suite.wr.On("FindDeliveries", mock.Anything, "12345", mock.Anything).Return([]v1.WebhookDelivery{
+		{ID: "d-1", JobID: "job-1", URL: "https://example.com/hook", Status: v1.DeliveryPending, Attempts: 2,
+			LastStatusCode: &code, NextAttemptAt: time.Now(), CreatedAt: time.Now(), Payload: "{}", Secret: "secret"},
+	}, nil)
+
+	w := httptest.NewRecorder()
+	suite.service.Deliveries(w, suite.request(http.MethodGet, ""))
+
+	var deliveries []map[string]interface{}
+	_ = json.NewDecoder(w.Result().Body).Decode(&deliveries)
+	assert.Equal(suite.T(), http.StatusOK, w.Result().StatusCode)
+	assert.Len(suite.T(), deliveries, 1)
+	assert.Equal(suite.T(), "job-1", deliveries[0]["jobId"])
+	assert.Equal(suite.T(), float64(503), deliveries[0]["lastStatusCode"])
+	assert.NotContains(suite.T(), deliveries[0], "secret")
+	assert.NotContains(suite.T(), deliveries[0], "payload")
+}
+
+func (suite *WebhookServiceV1TestSuite) TestValidWebhookURL() {
+	assert.True(suite.T(), ValidWebhookURL("https://example.com/hook"))
+	assert.True(suite.T(), ValidWebhookURL("https://93.184.216.34/hook"))
+	// plain http and internal hosts are refused outside the local environment
+	for _, u := range []string{"http://example.com/hook", "https://localhost:8080", "https://127.0.0.1/hook",
+		"https://10.0.0.1/hook", "https://169.254.169.254/latest", "https://[::1]/hook", "https://0.0.0.0/hook"} {
+		assert.False(suite.T(), ValidWebhookURL(u), u)
+	}
+	suite.T().Setenv("ENV", "local")
+	assert.True(suite.T(), ValidWebhookURL("http://localhost:8080"))
+	assert.False(suite.T(), ValidWebhookURL("example.com/hook"))
+	assert.False(suite.T(), ValidWebhookURL("mailto:someone@example.com"))
+	assert.False(suite.T(), ValidWebhookURL(""))
+}
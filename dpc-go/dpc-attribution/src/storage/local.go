@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// LocalStore keeps objects as files in a directory, which the API and the export worker must share
+type LocalStore struct {
+	root string
+}
+
+// NewLocalStore creates a store of the files in the root directory
+func NewLocalStore(root string) *LocalStore {
+	return &LocalStore{root}
+}
+
+func (s *LocalStore) path(name string) string {
+	return filepath.Join(s.root, filepath.Clean("/"+name))
+}
+
+// Upload moves the file into the root directory, doing nothing when it is already there
+func (s *LocalStore) Upload(ctx context.Context, name string, file string) error {
+	dest := s.path(name)
+	if filepath.Clean(file) == dest {
+		return nil
+	}
+	if err := os.MkdirAll(s.root, 0750); err != nil {
+		return err
+	}
+	if err := os.Rename(file, dest); err == nil {
+		return nil
+	}
+	// the file can't be renamed across filesystems, so it is copied instead
+	if err := copyFile(file, dest); err != nil {
+		return err
+	}
+	return os.Remove(file)
+}
+
+// DeletePrefix deletes the files in the root directory whose names start with prefix
+func (s *LocalStore) DeletePrefix(ctx context.Context, prefix string) error {
+	files, err := filepath.Glob(s.path(prefix) + "*")
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(src string, dest string) error {
+	in, err := os.Open(filepath.Clean(src))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(filepath.Clean(dest), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// S3Config is a struct to hold the configuration of an S3 compatible store
+type S3Config struct {
+	Bucket string
+	// Prefix is prepended to the names of the objects in the bucket
+	Prefix string
+	Region string
+	// Endpoint overrides the AWS endpoint, for S3 compatible services like MinIO
+	Endpoint       string
+	ForcePathStyle bool
+	// AccessKeyID and SecretAccessKey are optional, the default AWS credential chain is used without them
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// S3Store keeps objects in an S3 compatible bucket
+type S3Store struct {
+	config S3Config
+	client *s3.S3
+}
+
+// NewS3Store creates a store of the objects in the configured bucket
+func NewS3Store(config S3Config) (*S3Store, error) {
+	awsConfig := aws.NewConfig().WithRegion(config.Region).WithS3ForcePathStyle(config.ForcePathStyle)
+	if config.Endpoint != "" {
+		awsConfig = awsConfig.WithEndpoint(config.Endpoint)
+	}
+	if config.AccessKeyID != "" {
+		awsConfig = awsConfig.WithCredentials(credentials.NewStaticCredentials(config.AccessKeyID, config.SecretAccessKey, ""))
+	}
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &S3Store{config: config, client: s3.New(sess)}, nil
+}
+
+func (s *S3Store) key(name string) string {
+	return path.Join(s.config.Prefix, name)
+}
+
+// Upload puts the file in the bucket, then removes the local copy
+func (s *S3Store) Upload(ctx context.Context, name string, file string) error {
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return err
+	}
+	_, err = s.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.config.Bucket),
+		Key:    aws.String(s.key(name)),
+		Body:   f,
+	})
+	_ = f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Remove(file)
+}
+
+// DeletePrefix deletes the objects in the bucket whose names start with prefix, a page of them at a time
+func (s *S3Store) DeletePrefix(ctx context.Context, prefix string) error {
+	var deleteErr error
+	err := s.client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.config.Bucket),
+		Prefix: aws.String(s.key(prefix)),
+	}, func(page *s3.ListObjectsV2Output, last bool) bool {
+		if len(page.Contents) == 0 {
+			return true
+		}
+		objects := make([]*s3.ObjectIdentifier, 0, len(page.Contents))
+		for _, o := range page.Contents {
+			objects = append(objects, &s3.ObjectIdentifier{Key: o.Key})
+		}
+		_, deleteErr = s.client.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(s.config.Bucket),
+			Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		return deleteErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return deleteErr
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/CMSgov/dpc/attribution/conf"
+)
+
+// Store is where the export worker keeps the files it writes, so any instance of the API can serve them
+type Store interface {
+	// Upload moves the local file into the store as the named object
+	Upload(ctx context.Context, name string, file string) error
+	// DeletePrefix deletes every object whose name starts with prefix
+	DeletePrefix(ctx context.Context, prefix string) error
+}
+
+// NewStore creates the store set by the storage.type config, the local exportPath directory by default
+func NewStore() (Store, error) {
+	switch t := conf.GetAsString("storage.type", "local"); t {
+	case "local":
+		return NewLocalStore(conf.GetAsString("exportPath", "/tmp")), nil
+	case "s3":
+		return NewS3Store(S3Config{
+			Bucket:          conf.GetAsString("storage.s3.bucket"),
+			Prefix:          conf.GetAsString("storage.s3.prefix"),
+			Region:          conf.GetAsString("storage.s3.region", "us-east-1"),
+			Endpoint:        conf.GetAsString("storage.s3.endpoint"),
+			ForcePathStyle:  conf.GetAsString("storage.s3.forcePathStyle", "false") == "true",
+			AccessKeyID:     conf.GetAsString("storage.s3.accessKeyID"),
+			SecretAccessKey: conf.GetAsString("storage.s3.secretAccessKey"),
+		})
+	default:
+		return nil, fmt.Errorf("unsupported storage type %s", t)
+	}
+}
@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// fakeS3 is a stand-in for an S3 compatible service like MinIO, keeping objects in memory with path style URLs
+type fakeS3 struct {
+	*httptest.Server
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3() *fakeS3 {
+	f := &fakeS3{objects: make(map[string][]byte)}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	return f
+}
+
+func (f *fakeS3) serve(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	bucket := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)[0]
+	switch {
+	case r.Method == http.MethodPut:
+		b, _ := ioutil.ReadAll(r.Body)
+		f.objects[r.URL.Path] = b
+	case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		prefix := fmt.Sprintf("/%s/%s", bucket, r.URL.Query().Get("prefix"))
+		keys := make([]string, 0)
+		for k := range f.objects {
+			if strings.HasPrefix(k, prefix) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		_, _ = fmt.Fprint(w, `<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">`)
+		for _, k := range keys {
+			_, _ = fmt.Fprintf(w, "<Contents><Key>%s</Key></Contents>", strings.TrimPrefix(k, "/"+bucket+"/"))
+		}
+		_, _ = fmt.Fprintf(w, "<KeyCount>%d</KeyCount><IsTruncated>false</IsTruncated></ListBucketResult>", len(keys))
+	case r.Method == http.MethodPost && r.URL.Query()["delete"] != nil:
+		var req struct {
+			Objects []struct {
+				Key string `xml:"Key"`
+			} `xml:"Object"`
+		}
+		_ = xml.NewDecoder(r.Body).Decode(&req)
+		for _, o := range req.Objects {
+			delete(f.objects, fmt.Sprintf("/%s/%s", bucket, o.Key))
+		}
+		_, _ = fmt.Fprint(w, `<DeleteResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"></DeleteResult>`)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+type StorageTestSuite struct {
+	suite.Suite
+	s3  *fakeS3
+	dir string
+}
+
+func TestStorageTestSuite(t *testing.T) {
+	suite.Run(t, new(StorageTestSuite))
+}
+
+func (suite *StorageTestSuite) SetupTest() {
+	suite.s3 = newFakeS3()
+	suite.dir = suite.T().TempDir()
+}
+
+func (suite *StorageTestSuite) TearDownTest() {
+	suite.s3.Close()
+}
+
+func (suite *StorageTestSuite) write(name string) string {
+	path := filepath.Join(suite.dir, name)
+	assert.NoError(suite.T(), ioutil.WriteFile(path, []byte("data"), 0600))
+	return path
+}
+
+func (suite *StorageTestSuite) TestLocalUpload() {
+	root := suite.T().TempDir()
+	store := NewLocalStore(root)
+
+	assert.NoError(suite.T(), store.Upload(context.Background(), "batch-0.patient.ndjson.gz", suite.write("batch-0.patient.ndjson.gz")))
+	assert.NoFileExists(suite.T(), filepath.Join(suite.dir, "batch-0.patient.ndjson.gz"))
+	b, _ := ioutil.ReadFile(filepath.Join(root, "batch-0.patient.ndjson.gz"))
+	assert.Equal(suite.T(), "data", string(b))
+
+	// a file written straight into the store's directory is left where it is
+	assert.NoError(suite.T(), store.Upload(context.Background(), "batch-0.patient.ndjson.gz", filepath.Join(root, "batch-0.patient.ndjson.gz")))
+	assert.FileExists(suite.T(), filepath.Join(root, "batch-0.patient.ndjson.gz"))
+}
+
+func (suite *StorageTestSuite) TestLocalDeletePrefix() {
+	store := NewLocalStore(suite.dir)
+	suite.write("batch-1-0.patient.ndjson.gz")
+	suite.write("batch-1-0.coverage.ndjson")
+	suite.write("batch-10-0.patient.ndjson.gz")
+
+	assert.NoError(suite.T(), store.DeletePrefix(context.Background(), "batch-1-"))
+
+	assert.NoFileExists(suite.T(), filepath.Join(suite.dir, "batch-1-0.patient.ndjson.gz"))
+	assert.NoFileExists(suite.T(), filepath.Join(suite.dir, "batch-1-0.coverage.ndjson"))
+	assert.FileExists(suite.T(), filepath.Join(suite.dir, "batch-10-0.patient.ndjson.gz"))
+}
+
+func (suite *StorageTestSuite) TestS3() {
+	store, err := NewS3Store(S3Config{
+		Bucket:          "exports",
+		Prefix:          "dpc",
+		Region:          "us-east-1",
+		Endpoint:        suite.s3.URL,
+		ForcePathStyle:  true,
+		AccessKeyID:     "test-key",
+		SecretAccessKey: "test-secret",
+	})
+	assert.NoError(suite.T(), err)
+
+	for _, name := range []string{"batch-1-0.patient.ndjson.gz", "batch-1-1.patient.ndjson.gz", "batch-10-0.patient.ndjson.gz"} {
+		assert.NoError(suite.T(), store.Upload(context.Background(), name, suite.write(name)))
+		assert.NoFileExists(suite.T(), filepath.Join(suite.dir, name))
+	}
+	assert.Equal(suite.T(), []byte("data"), suite.s3.objects["/exports/dpc/batch-1-0.patient.ndjson.gz"])
+	assert.Len(suite.T(), suite.s3.objects, 3)
+
+	assert.NoError(suite.T(), store.DeletePrefix(context.Background(), "batch-1-"))
+	assert.Len(suite.T(), suite.s3.objects, 1)
+	assert.Contains(suite.T(), suite.s3.objects, "/exports/dpc/batch-10-0.patient.ndjson.gz")
+}
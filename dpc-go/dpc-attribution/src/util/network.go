@@ -0,0 +1,41 @@
+package util
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// PublicIP reports whether the address is reachable on the public internet, and not a loopback, link-local,
+// private or otherwise internal address
+func PublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast())
+}
+
+// PublicHost reports whether the host of the URL can be public. A host name is checked once it is resolved, by
+// RefusePrivateAddress.
+func PublicHost(u *url.URL) bool {
+	host := u.Hostname()
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip == nil || PublicIP(ip)
+}
+
+// RefusePrivateAddress is a net.Dialer Control that refuses to connect to an address that is not public. It runs
+// after the host name is resolved, so a name resolving to an internal address is refused too.
+func RefusePrivateAddress(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !PublicIP(ip) {
+		return errors.Errorf("refusing to connect to non-public address %s", host)
+	}
+	return nil
+}
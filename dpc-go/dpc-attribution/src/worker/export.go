@@ -0,0 +1,455 @@
+// Package worker contains the export worker that processes job_queue_batch rows queued by the job service,
+// taking over the work of the Java aggregation engine for the Go stack.
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/CMSgov/dpc/attribution/client"
+	"github.com/CMSgov/dpc/attribution/conf"
+	"github.com/CMSgov/dpc/attribution/logger"
+	models "github.com/CMSgov/dpc/attribution/model/fhir"
+	"github.com/CMSgov/dpc/attribution/model/v1"
+	v1Repo "github.com/CMSgov/dpc/attribution/repository/v1"
+	"github.com/CMSgov/dpc/attribution/storage"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Resource types the worker can export
+const (
+	patientType              = "Patient"
+	coverageType             = "Coverage"
+	explanationOfBenefitType = "ExplanationOfBenefit"
+	operationOutcomeType     = "OperationOutcome"
+)
+
+// Config holds the settings of an ExportWorker
+type Config struct {
+	// ExportPath is the local directory files are written to while a batch runs, before they are moved to the store
+	ExportPath        string
+	PollInterval      time.Duration
+	HeartbeatInterval time.Duration
+	// StuckAfter is how long a RUNNING batch can go without a heartbeat before it is requeued
+	StuckAfter       time.Duration
+	ResourcesPerFile int
+}
+
+// NewConfig reads the worker settings from config
+func NewConfig() Config {
+	return Config{
+		ExportPath:        conf.GetAsString("worker.workPath", conf.GetAsString("exportPath", "/tmp")),
+		PollInterval:      time.Duration(conf.GetAsInt("worker.pollIntervalMS", 1000)) * time.Millisecond,
+		HeartbeatInterval: time.Duration(conf.GetAsInt("worker.heartbeatSeconds", 30)) * time.Second,
+		StuckAfter:        time.Duration(conf.GetAsInt("worker.stuckAfterMinutes", 5)) * time.Minute,
+		ResourcesPerFile:  conf.GetAsInt("worker.resourcesPerFile", 10000),
+	}
+}
+
+// ExportWorker claims queued batches and exports the data of their patients to NDJSON files
+type ExportWorker struct {
+	queue        v1Repo.ExportQueue
+	bfdClient    client.APIClient
+	store        storage.Store
+	config       Config
+	aggregatorID string
+}
+
+// NewExportWorker creates an ExportWorker with a new aggregator ID
+func NewExportWorker(queue v1Repo.ExportQueue, bfdClient client.APIClient, store storage.Store, config Config) *ExportWorker {
+	return &ExportWorker{
+		queue,
+		bfdClient,
+		store,
+		config,
+		uuid.New().String(),
+	}
+}
+
+// Run processes batches until the context is cancelled, waiting PollInterval whenever the queue is empty
+func (w *ExportWorker) Run(ctx context.Context) {
+	log := logger.WithContext(ctx).With(zap.String("aggregatorID", w.aggregatorID))
+	log.Info("Starting export worker")
+	for {
+		worked, err := w.ProcessNext(ctx)
+		if err != nil {
+			log.Error("Failed to process batch", zap.Error(err))
+		}
+		if worked && err == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			log.Info("Stopping export worker")
+			return
+		case <-time.After(w.config.PollInterval):
+		}
+	}
+}
+
+// ProcessNext requeues stuck batches, then claims and runs the next queued batch.
+// It reports whether a batch was claimed.
+func (w *ExportWorker) ProcessNext(ctx context.Context) (bool, error) {
+	log := logger.WithContext(ctx)
+	restarted, err := w.queue.RestartStuckBatches(ctx, time.Now().Add(-w.config.StuckAfter))
+	if err != nil {
+		return false, errors.Wrap(err, "failed to restart stuck batches")
+	}
+	if restarted > 0 {
+		log.Warn(fmt.Sprintf("Restarted %d stuck batches", restarted))
+	}
+
+	batch, err := w.queue.ClaimBatch(ctx, w.aggregatorID)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to claim batch")
+	}
+	if batch == nil {
+		return false, nil
+	}
+
+	ctx = logger.NewContext(ctx, zap.String("jobID", batch.JobID), zap.String("batchID", batch.BatchID),
+		zap.String("aggregatorID", w.aggregatorID))
+	log = logger.WithContext(ctx)
+	log.Info("Processing batch")
+
+	files, err := w.runBatch(ctx, batch)
+	switch {
+	case err == nil:
+		log.Info(fmt.Sprintf("dpcMetric=batchCompleted,jobId=%s,batchId=%s,totalPatients=%d", batch.JobID, batch.BatchID, len(batch.Patients())))
+		return true, nil
+	case errors.Is(err, v1Repo.ErrBatchNotOwned):
+		log.Warn("Batch was taken over by another aggregator, abandoning it")
+		return true, nil
+	case ctx.Err() != nil:
+		// leave the batch RUNNING so it is requeued as stuck and resumed from its patient index
+		log.Info("Batch paused by shutdown")
+		return true, nil
+	}
+
+	log.Error("Batch failed", zap.Error(err))
+	if failErr := w.queue.FailBatch(ctx, batch, w.aggregatorID, files); failErr != nil {
+		log.Error("Failed to mark batch as failed", zap.Error(failErr))
+	}
+	return true, err
+}
+
+// runBatch exports the remaining patients of the batch and completes it. When the batch fails, it returns the files
+// written so far, with an OperationOutcome entry for every patient it did not export, so the job keeps a partial result.
+func (w *ExportWorker) runBatch(ctx context.Context, batch *v1.ExportBatch) ([]v1.ExportFile, error) {
+	hbCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go w.heartbeat(hbCtx, batch.BatchID)
+
+	if err := os.MkdirAll(w.config.ExportPath, 0750); err != nil {
+		return nil, err
+	}
+	writers := make(map[string]*ndjsonWriter)
+	writer := func(resourceType string) (*ndjsonWriter, error) {
+		if wr, ok := writers[resourceType]; ok {
+			return wr, nil
+		}
+		var elements []string
+		if resourceType != operationOutcomeType {
+			elements = batch.ElementsFor(resourceType)
+		}
+		wr, err := newNDJSONWriter(w.config.ExportPath, batch.BatchID, resourceType, w.config.ResourcesPerFile, elements)
+		if err != nil {
+			return nil, err
+		}
+		writers[resourceType] = wr
+		return wr, nil
+	}
+	patients := batch.Patients()
+	start := batch.NextPatient()
+	// open writers for every type up front, so files from a previous attempt are reported even if no new data arrives
+	recovered := false
+	for _, t := range append(batch.Types(), operationOutcomeType) {
+		wr, err := writer(t)
+		if err != nil {
+			return w.partialFiles(ctx, writers, patients[start:], err), err
+		}
+		recovered = recovered || wr.Recovered()
+	}
+	// the files of a previous attempt stay in the work directory of the instance that ran it, so a batch resumed
+	// elsewhere starts over instead of completing without the patients that were already exported
+	if start > 0 && !recovered {
+		logger.WithContext(ctx).Warn(fmt.Sprintf("No files of the previous attempt were found, restarting the batch from patient 0 instead of %d", start))
+		start = 0
+	}
+
+	if start == 0 && len(batch.Warnings) > 0 {
+		if err := writers[operationOutcomeType].Write(warningOutcome(batch.Warnings)); err != nil {
+			return w.partialFiles(ctx, writers, patients, err), err
+		}
+	}
+
+	for i := start; i < len(patients); i++ {
+		if err := w.exportNext(ctx, batch, i, writer, writers); err != nil {
+			return w.partialFiles(ctx, writers, patients[i:], err), err
+		}
+	}
+
+	files := make([]v1.ExportFile, 0)
+	for _, wr := range writers {
+		f, err := wr.Close()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f...)
+	}
+	if err := w.upload(ctx, files); err != nil {
+		return nil, err
+	}
+	return files, w.queue.CompleteBatch(ctx, batch, w.aggregatorID, files)
+}
+
+// upload moves the files of a finished batch to the store, where the API serves them from
+func (w *ExportWorker) upload(ctx context.Context, files []v1.ExportFile) error {
+	for _, f := range files {
+		name := v1.CompressedFileName(f.FileName)
+		if err := w.store.Upload(ctx, name, filepath.Join(w.config.ExportPath, name)); err != nil {
+			return errors.Wrapf(err, "failed to store file %s", name)
+		}
+	}
+	return nil
+}
+
+// exportNext exports the patient at index i and records the index once its data is flushed
+func (w *ExportWorker) exportNext(ctx context.Context, batch *v1.ExportBatch, i int, writer func(string) (*ndjsonWriter, error), writers map[string]*ndjsonWriter) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := w.exportPatient(ctx, batch, batch.Patients()[i], writer); err != nil {
+		return err
+	}
+	for _, wr := range writers {
+		if err := wr.Flush(); err != nil {
+			return err
+		}
+	}
+	return w.queue.UpdatePatientIndex(ctx, batch.BatchID, w.aggregatorID, i)
+}
+
+// partialFiles writes an OperationOutcome entry for each patient left unexported by a failed batch and closes the
+// writers, returning whatever files could be completed. A batch that is paused or taken over will be resumed and
+// must not report those patients as failed, so its writers are only closed.
+func (w *ExportWorker) partialFiles(ctx context.Context, writers map[string]*ndjsonWriter, remaining []string, cause error) []v1.ExportFile {
+	log := logger.WithContext(ctx)
+	if ctx.Err() != nil || errors.Is(cause, v1Repo.ErrBatchNotOwned) {
+		releaseWriters(ctx, writers, errors.Is(cause, v1Repo.ErrBatchNotOwned))
+		return nil
+	}
+	if outcomes, ok := writers[operationOutcomeType]; ok {
+		for _, mbi := range remaining {
+			if err := outcomes.Write(operationOutcome(mbi, fmt.Sprintf("Patient was not exported, the batch failed: %s", cause))); err != nil {
+				log.Warn("Failed to record unexported patients", zap.Error(err))
+				break
+			}
+		}
+	}
+
+	files := make([]v1.ExportFile, 0)
+	for resourceType, wr := range writers {
+		f, err := wr.Close()
+		if err != nil {
+			log.Warn(fmt.Sprintf("Failed to close %s file of failed batch", resourceType), zap.Error(err))
+			continue
+		}
+		if err := w.upload(ctx, f); err != nil {
+			log.Warn(fmt.Sprintf("Failed to store %s file of failed batch", resourceType), zap.Error(err))
+			continue
+		}
+		files = append(files, f...)
+	}
+	return files
+}
+
+// releaseWriters closes the writers of a batch that stopped without finishing. A paused batch keeps its files in the
+// work directory to resume from, while the files of a batch another worker took over are removed.
+func releaseWriters(ctx context.Context, writers map[string]*ndjsonWriter, discard bool) {
+	log := logger.WithContext(ctx)
+	for resourceType, wr := range writers {
+		var err error
+		if discard {
+			err = wr.Discard()
+		} else {
+			err = wr.Release()
+		}
+		if err != nil {
+			log.Warn(fmt.Sprintf("Failed to close %s file of stopped batch", resourceType), zap.Error(err))
+		}
+	}
+}
+
+func (w *ExportWorker) heartbeat(ctx context.Context, batchID string) {
+	ticker := time.NewTicker(w.config.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.queue.Heartbeat(ctx, batchID, w.aggregatorID); err != nil && ctx.Err() == nil {
+				logger.WithContext(ctx).Warn("Failed to send batch heartbeat", zap.Error(err))
+			}
+		}
+	}
+}
+
+// exportPatient writes the requested resources of one patient. Failures fetching data are written to the
+// OperationOutcome file for the patient rather than failing the batch; only write errors are returned.
+func (w *ExportWorker) exportPatient(ctx context.Context, batch *v1.ExportBatch, mbi string, writer func(string) (*ndjsonWriter, error)) error {
+	log := logger.WithContext(ctx)
+	outcomes, err := writer(operationOutcomeType)
+	if err != nil {
+		return err
+	}
+
+	patientID, err := w.lookupPatientID(mbi)
+	if err != nil {
+		log.Warn("Failed to find patient", zap.Error(err))
+		return outcomes.Write(operationOutcome(mbi, fmt.Sprintf("Failed to find patient: %s", err)))
+	}
+
+	since := ""
+	if batch.Since.Valid {
+		since = "gt" + batch.Since.Time.Format(time.RFC3339Nano)
+	}
+	for _, resourceType := range batch.Types() {
+		bundle, err := w.fetch(resourceType, patientID, batch, since)
+		if err != nil {
+			log.Warn(fmt.Sprintf("Failed to fetch %s", resourceType), zap.Error(err))
+			if err := outcomes.Write(operationOutcome(mbi, fmt.Sprintf("Failed to fetch %s: %s", resourceType, err))); err != nil {
+				return err
+			}
+			continue
+		}
+		wr, err := writer(resourceType)
+		if err != nil {
+			return err
+		}
+		for _, entry := range bundle.Entries {
+			if resource, ok := entry["resource"]; ok {
+				if err := wr.Write(resource); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (w *ExportWorker) fetch(resourceType string, patientID string, batch *v1.ExportBatch, since string) (*models.Bundle, error) {
+	switch resourceType {
+	case patientType:
+		return w.bfdClient.GetPatient(patientID, batch.JobID, batch.OrganizationID, since, batch.TransactionTime)
+	case coverageType:
+		return w.bfdClient.GetCoverage(patientID, batch.JobID, batch.OrganizationID, since, batch.TransactionTime)
+	case explanationOfBenefitType:
+		return w.fetchExplanationOfBenefit(patientID, batch, since)
+	default:
+		return nil, errors.Errorf("unsupported resource type %s", resourceType)
+	}
+}
+
+// fetchExplanationOfBenefit runs a BFD search for each ExplanationOfBenefit _typeFilter of the batch and merges the
+// results, so a claim matching any of the queries is exported once
+func (w *ExportWorker) fetchExplanationOfBenefit(patientID string, batch *v1.ExportBatch, since string) (*models.Bundle, error) {
+	var merged *models.Bundle
+	seen := make(map[string]bool)
+	for _, filter := range eobFilters(batch) {
+		b, err := w.bfdClient.GetExplanationOfBenefit(patientID, batch.JobID, batch.OrganizationID, since, batch.TransactionTime, filter)
+		if err != nil {
+			return nil, err
+		}
+		if merged == nil {
+			merged = &models.Bundle{Resource: b.Resource}
+		}
+		for _, entry := range b.Entries {
+			resource, _ := entry["resource"].(map[string]interface{})
+			id, _ := resource["id"].(string)
+			if id != "" && seen[id] {
+				continue
+			}
+			seen[id] = true
+			merged.Entries = append(merged.Entries, entry)
+		}
+	}
+	return merged, nil
+}
+
+// eobFilters builds a BFD claim filter from each ExplanationOfBenefit _typeFilter of the batch, or a single empty
+// filter when there are none
+func eobFilters(batch *v1.ExportBatch) []client.EOBFilter {
+	queries := batch.Filters(explanationOfBenefitType)
+	if len(queries) == 0 {
+		return []client.EOBFilter{{}}
+	}
+	filters := make([]client.EOBFilter, 0, len(queries))
+	for _, params := range queries {
+		filter := client.EOBFilter{ServiceDates: params["service-date"]}
+		for _, types := range params["type"] {
+			filter.ClaimTypes = append(filter.ClaimTypes, strings.Split(types, ",")...)
+		}
+		filters = append(filters, filter)
+	}
+	return filters
+}
+
+// lookupPatientID finds the BFD patient ID for an MBI
+func (w *ExportWorker) lookupPatientID(mbi string) (string, error) {
+	raw, err := w.bfdClient.GetPatientByIdentifierHash(client.HashIdentifier(mbi))
+	if err != nil {
+		return "", err
+	}
+	var bundle models.Bundle
+	if err := json.Unmarshal([]byte(raw), &bundle); err != nil {
+		return "", errors.Wrap(err, "failed to parse patient bundle")
+	}
+	if len(bundle.Entries) != 1 {
+		return "", errors.Errorf("expected one patient, found %d", len(bundle.Entries))
+	}
+	resource, _ := bundle.Entries[0]["resource"].(map[string]interface{})
+	id, _ := resource["id"].(string)
+	if id == "" {
+		return "", errors.New("patient has no id")
+	}
+	return id, nil
+}
+
+// warningOutcome reports the kickoff params ignored by lenient handling, with an issue for each
+func warningOutcome(warnings []string) map[string]interface{} {
+	issues := make([]map[string]interface{}, 0, len(warnings))
+	for _, warning := range warnings {
+		issues = append(issues, map[string]interface{}{
+			"severity": "warning",
+			"code":     "not-supported",
+			"details":  map[string]string{"text": warning},
+		})
+	}
+	return map[string]interface{}{
+		"resourceType": operationOutcomeType,
+		"id":           uuid.New().String(),
+		"issue":        issues,
+	}
+}
+
+func operationOutcome(mbi string, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"resourceType": operationOutcomeType,
+		"id":           uuid.New().String(),
+		"issue": []map[string]interface{}{{
+			"severity": "error",
+			"code":     "exception",
+			"details":  map[string]string{"text": message},
+			"location": []string{"Patient", "id", mbi},
+		}},
+	}
+}
@@ -0,0 +1,158 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/CMSgov/dpc/attribution/conf"
+	"github.com/CMSgov/dpc/attribution/logger"
+	"github.com/CMSgov/dpc/attribution/middleware"
+	"github.com/CMSgov/dpc/attribution/model/fhir"
+	"github.com/CMSgov/dpc/attribution/model/v1"
+	"github.com/CMSgov/dpc/attribution/repository"
+	v1Repo "github.com/CMSgov/dpc/attribution/repository/v1"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// JobStarter enqueues export jobs, it is implemented by the job service
+type JobStarter interface {
+	StartJob(ctx context.Context, orgID string, er v1.ExportRequest, url string, ip string) (*string, bool, error)
+}
+
+// ExportScheduleConfig holds the settings of an ExportScheduleRunner
+type ExportScheduleConfig struct {
+	// RequestBaseURL is prepended to /Group/{groupID}/$export to build the request URL of scheduled jobs
+	RequestBaseURL   string
+	PollInterval     time.Duration
+	SchedulesPerPoll int
+	// RetryDelay is how long a run that failed to enqueue its job waits to be retried
+	RetryDelay time.Duration
+}
+
+// NewExportScheduleConfig reads the export schedule runner settings from config
+func NewExportScheduleConfig() ExportScheduleConfig {
+	return ExportScheduleConfig{
+		RequestBaseURL:   strings.TrimSuffix(conf.GetAsString("exportSchedules.requestBaseURL", "http://localhost:3000/api/v2"), "/"),
+		PollInterval:     time.Duration(conf.GetAsInt("exportSchedules.pollIntervalSeconds", 60)) * time.Second,
+		SchedulesPerPoll: conf.GetAsInt("exportSchedules.schedulesPerPoll", 20),
+		RetryDelay:       time.Duration(conf.GetAsInt("exportSchedules.retryMinutes", 15)) * time.Minute,
+	}
+}
+
+// ExportScheduleRunner enqueues a group export for every export schedule that is due. Each run is a _since=auto
+// export that continues from the group's previous successful export. Runs are exempt from the daily export quotas
+// the API enforces on kickoffs, the number of schedules of an organization bounds them instead.
+type ExportScheduleRunner struct {
+	queue   v1Repo.ExportScheduleQueue
+	groups  repository.GroupRepo
+	starter JobStarter
+	config  ExportScheduleConfig
+}
+
+// NewExportScheduleRunner creates an ExportScheduleRunner
+func NewExportScheduleRunner(queue v1Repo.ExportScheduleQueue, groups repository.GroupRepo, starter JobStarter, config ExportScheduleConfig) *ExportScheduleRunner {
+	return &ExportScheduleRunner{
+		queue,
+		groups,
+		starter,
+		config,
+	}
+}
+
+// Run runs the due schedules every PollInterval until the context is cancelled
+func (sr *ExportScheduleRunner) Run(ctx context.Context) {
+	log := logger.WithContext(ctx)
+	log.Info("Starting export schedule runner")
+	for {
+		if _, err := sr.RunDue(ctx); err != nil {
+			log.Error("Failed to run export schedules", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			log.Info("Stopping export schedule runner")
+			return
+		case <-time.After(sr.config.PollInterval):
+		}
+	}
+}
+
+// RunDue enqueues the jobs of the schedules that are due and returns how many were enqueued. A schedule that fails
+// to enqueue its job is retried after RetryDelay.
+func (sr *ExportScheduleRunner) RunDue(ctx context.Context) (int, error) {
+	now := time.Now()
+	schedules, err := sr.queue.ClaimDueSchedules(ctx, now, now.Add(sr.config.RetryDelay), sr.config.SchedulesPerPoll)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to claim due export schedules")
+	}
+	enqueued := 0
+	for _, s := range schedules {
+		jobID, err := sr.run(ctx, s)
+		if err != nil {
+			logger.WithContext(ctx).Warn(fmt.Sprintf("Failed to run export schedule %s", s.ID), zap.Error(err))
+			continue
+		}
+		ranAt := time.Now()
+		if jobID == nil {
+			logger.WithContext(ctx).Warn(fmt.Sprintf("Skipped the run of export schedule %s, its group has no attributed patients", s.ID))
+		}
+		if err := sr.queue.RecordScheduleRun(ctx, s.ID, jobID, ranAt, s.NextRunAfter(ranAt)); err != nil {
+			logger.WithContext(ctx).Error(fmt.Sprintf("Failed to record the run of export schedule %s", s.ID), zap.Error(err))
+			continue
+		}
+		if jobID != nil {
+			enqueued++
+		}
+	}
+	return enqueued, nil
+}
+
+// run enqueues the export of the group of the schedule and returns its job ID, or nil when the group has no
+// attributed patients to export
+func (sr *ExportScheduleRunner) run(ctx context.Context, s v1.ExportSchedule) (*string, error) {
+	orgCtx := context.WithValue(ctx, middleware.ContextKeyOrganization, s.OrganizationID)
+	group, err := sr.groups.FindByID(orgCtx, s.GroupID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find the group")
+	}
+	b, err := json.Marshal(group.Info)
+	if err != nil {
+		return nil, err
+	}
+	var members fhir.Group
+	if err := json.Unmarshal(b, &members); err != nil {
+		return nil, errors.Wrap(err, "failed to read the group members")
+	}
+	mbis, npis := members.Attributions()
+	if len(mbis) == 0 {
+		return nil, nil
+	}
+
+	er := v1.ExportRequest{
+		GroupID:      s.GroupID,
+		GroupVersion: group.Version,
+		Type:         s.Type,
+		MBIs:         mbis,
+		ProviderNPI:  strings.Join(npis, ","),
+		WebhookURL:   s.WebhookURL,
+		ScheduleID:   s.ID,
+		Since:        v1.SinceAuto,
+		FirstSince:   s.Since,
+	}
+	query := url.Values{}
+	query.Set("_type", s.Type)
+	query.Set("_since", er.Since)
+	requestURL := fmt.Sprintf("%s/Group/%s/$export?%s", sr.config.RequestBaseURL, s.GroupID, query.Encode())
+
+	jobID, duplicate, err := sr.starter.StartJob(orgCtx, s.OrganizationID, er, requestURL, "")
+	if err != nil {
+		return nil, err
+	}
+	logger.WithContext(ctx).Info(fmt.Sprintf("dpcMetric=scheduledJobCreated,jobId=%s,orgId=%s,groupId=%s,scheduleId=%s,totalPatients=%d,duplicate=%t",
+		*jobID, s.OrganizationID, s.GroupID, s.ID, len(mbis), duplicate))
+	return jobID, nil
+}
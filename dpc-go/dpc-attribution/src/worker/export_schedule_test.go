@@ -0,0 +1,205 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CMSgov/dpc/attribution/attributiontest"
+	"github.com/CMSgov/dpc/attribution/model"
+	v1 "github.com/CMSgov/dpc/attribution/model/v1"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockExportScheduleQueue struct {
+	mock.Mock
+}
+
+func (m *MockExportScheduleQueue) ClaimDueSchedules(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]v1.ExportSchedule, error) {
+	args := m.Called(ctx, now, leaseUntil, limit)
+	return args.Get(0).([]v1.ExportSchedule), args.Error(1)
+}
+
+func (m *MockExportScheduleQueue) RecordScheduleRun(ctx context.Context, id string, jobID *string, ranAt time.Time, nextRunAt time.Time) error {
+	args := m.Called(ctx, id, jobID, ranAt, nextRunAt)
+	return args.Error(0)
+}
+
+type MockGroupRepo struct {
+	mock.Mock
+}
+
+func (m *MockGroupRepo) Insert(ctx context.Context, body []byte) (*model.Group, error) {
+	args := m.Called(ctx, body)
+	return args.Get(0).(*model.Group), args.Error(1)
+}
+
+func (m *MockGroupRepo) FindByID(ctx context.Context, id string) (*model.Group, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Group), args.Error(1)
+}
+
+func (m *MockGroupRepo) FindByOrganization(ctx context.Context) ([]model.Group, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]model.Group), args.Error(1)
+}
+
+type MockJobStarter struct {
+	mock.Mock
+}
+
+func (m *MockJobStarter) StartJob(ctx context.Context, orgID string, er v1.ExportRequest, url string, ip string) (*string, bool, error) {
+	args := m.Called(ctx, orgID, er, url, ip)
+	if args.Get(0) == nil {
+		return nil, false, args.Error(2)
+	}
+	return args.Get(0).(*string), args.Bool(1), args.Error(2)
+}
+
+type ExportScheduleRunnerTestSuite struct {
+	suite.Suite
+	queue   *MockExportScheduleQueue
+	groups  *MockGroupRepo
+	starter *MockJobStarter
+	runner  *ExportScheduleRunner
+}
+
+func TestExportScheduleRunnerTestSuite(t *testing.T) {
+	suite.Run(t, new(ExportScheduleRunnerTestSuite))
+}
+
+func (suite *ExportScheduleRunnerTestSuite) SetupTest() {
+	suite.queue = new(MockExportScheduleQueue)
+	suite.groups = new(MockGroupRepo)
+	suite.starter = new(MockJobStarter)
+	suite.runner = NewExportScheduleRunner(suite.queue, suite.groups, suite.starter, ExportScheduleConfig{
+		RequestBaseURL:   "https://dpc.example.com/api/v2",
+		PollInterval:     time.Second,
+		SchedulesPerPoll: 10,
+		RetryDelay:       time.Minute,
+	})
+}
+
+func (suite *ExportScheduleRunnerTestSuite) schedule() v1.ExportSchedule {
+	start := time.Now().Add(-time.Hour)
+	return v1.ExportSchedule{
+		ID:             "schedule-1",
+		OrganizationID: "org-1",
+		GroupID:        "group-1",
+		Frequency:      v1.FrequencyDaily,
+		StartAt:        start,
+		NextRunAt:      start,
+		Type:           "Patient,Coverage",
+	}
+}
+
+func (suite *ExportScheduleRunnerTestSuite) TestRunDueStartsSinceAutoJob() {
+	s := suite.schedule()
+	since := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.Since = &since
+	group := attributiontest.GroupResponse()
+	group.Version = 3
+	jobID := "job-1"
+
+	suite.queue.On("ClaimDueSchedules", mock.Anything, mock.Anything, mock.Anything, 10).Return([]v1.ExportSchedule{s}, nil)
+	suite.groups.On("FindByID", mock.Anything, "group-1").Return(group, nil)
+	suite.starter.On("StartJob", mock.Anything, "org-1", mock.Anything, mock.Anything, "").Return(&jobID, false, nil)
+	suite.queue.On("RecordScheduleRun", mock.Anything, "schedule-1", &jobID, mock.Anything, mock.Anything).Return(nil)
+
+	enqueued, err := suite.runner.RunDue(context.Background())
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, enqueued)
+	er := suite.starter.Calls[0].Arguments.Get(2).(v1.ExportRequest)
+	assert.Equal(suite.T(), []string{"2SW4N00AA00"}, er.MBIs)
+	assert.Equal(suite.T(), "9941339108", er.ProviderNPI)
+	assert.Equal(suite.T(), "schedule-1", er.ScheduleID)
+	assert.Equal(suite.T(), 3, er.GroupVersion)
+	// runs continue from the group's previous export, members added since then get their full history
+	assert.Equal(suite.T(), v1.SinceAuto, er.Since)
+	assert.Equal(suite.T(), &since, er.FirstSince)
+	assert.Equal(suite.T(), "https://dpc.example.com/api/v2/Group/group-1/$export?_since=auto&_type=Patient%2CCoverage",
+		suite.starter.Calls[0].Arguments.String(3))
+	next := suite.queue.Calls[1].Arguments.Get(4).(time.Time)
+	assert.True(suite.T(), next.After(time.Now()))
+	suite.queue.AssertExpectations(suite.T())
+}
+
+func (suite *ExportScheduleRunnerTestSuite) TestRunDueIsExemptFromExportQuotas() {
+	first, second := suite.schedule(), suite.schedule()
+	second.ID = "schedule-2"
+	jobIDs := []string{"job-1", "job-2"}
+
+	// every due schedule of the organization is run, however many jobs it already started today
+	suite.queue.On("ClaimDueSchedules", mock.Anything, mock.Anything, mock.Anything, 10).Return([]v1.ExportSchedule{first, second}, nil)
+	suite.groups.On("FindByID", mock.Anything, "group-1").Return(attributiontest.GroupResponse(), nil)
+	suite.starter.On("StartJob", mock.Anything, "org-1", mock.Anything, mock.Anything, "").Return(&jobIDs[0], false, nil).Once()
+	suite.starter.On("StartJob", mock.Anything, "org-1", mock.Anything, mock.Anything, "").Return(&jobIDs[1], false, nil).Once()
+	suite.queue.On("RecordScheduleRun", mock.Anything, "schedule-1", &jobIDs[0], mock.Anything, mock.Anything).Return(nil)
+	suite.queue.On("RecordScheduleRun", mock.Anything, "schedule-2", &jobIDs[1], mock.Anything, mock.Anything).Return(nil)
+
+	enqueued, err := suite.runner.RunDue(context.Background())
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 2, enqueued)
+	suite.starter.AssertNumberOfCalls(suite.T(), "StartJob", 2)
+	suite.queue.AssertExpectations(suite.T())
+}
+
+func (suite *ExportScheduleRunnerTestSuite) TestRunDueSkipsEmptyGroup() {
+	s := suite.schedule()
+	group := attributiontest.GroupResponse()
+	group.Info = model.Info{"resourceType": "Group"}
+
+	suite.queue.On("ClaimDueSchedules", mock.Anything, mock.Anything, mock.Anything, 10).Return([]v1.ExportSchedule{s}, nil)
+	suite.groups.On("FindByID", mock.Anything, "group-1").Return(group, nil)
+	suite.queue.On("RecordScheduleRun", mock.Anything, "schedule-1", (*string)(nil), mock.Anything, mock.Anything).Return(nil)
+
+	enqueued, err := suite.runner.RunDue(context.Background())
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, enqueued)
+	suite.starter.AssertNotCalled(suite.T(), "StartJob", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	suite.queue.AssertExpectations(suite.T())
+}
+
+func (suite *ExportScheduleRunnerTestSuite) TestRunDueLeavesFailedRunForRetry() {
+	s := suite.schedule()
+
+	suite.queue.On("ClaimDueSchedules", mock.Anything, mock.Anything, mock.Anything, 10).Return([]v1.ExportSchedule{s}, nil)
+	suite.groups.On("FindByID", mock.Anything, "group-1").Return(attributiontest.GroupResponse(), nil)
+	suite.starter.On("StartJob", mock.Anything, "org-1", mock.Anything, mock.Anything, "").Return(nil, false, errors.New("quota exceeded"))
+
+	enqueued, err := suite.runner.RunDue(context.Background())
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, enqueued)
+	suite.queue.AssertNotCalled(suite.T(), "RecordScheduleRun", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *ExportScheduleRunnerTestSuite) TestRunDueClaimError() {
+	suite.queue.On("ClaimDueSchedules", mock.Anything, mock.Anything, mock.Anything, 10).Return([]v1.ExportSchedule{}, errors.New("db down"))
+
+	_, err := suite.runner.RunDue(context.Background())
+
+	assert.Error(suite.T(), err)
+}
+
+func TestNextRunAfter(t *testing.T) {
+	start := time.Date(2021, 1, 31, 6, 0, 0, 0, time.UTC)
+	s := v1.ExportSchedule{StartAt: start, Frequency: v1.FrequencyDaily}
+	assert.Equal(t, time.Date(2021, 2, 3, 6, 0, 0, 0, time.UTC), s.NextRunAfter(time.Date(2021, 2, 2, 7, 0, 0, 0, time.UTC)))
+	assert.Equal(t, start, s.NextRunAfter(start.Add(-time.Second)))
+
+	s.Frequency = v1.FrequencyWeekly
+	assert.Equal(t, time.Date(2021, 2, 7, 6, 0, 0, 0, time.UTC), s.NextRunAfter(start))
+
+	s.Frequency = v1.FrequencyMonthly
+	assert.Equal(t, time.Date(2021, 3, 31, 6, 0, 0, 0, time.UTC), s.NextRunAfter(time.Date(2021, 3, 3, 6, 0, 0, 0, time.UTC)))
+}
@@ -0,0 +1,387 @@
+package worker
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CMSgov/dpc/attribution/client"
+	models "github.com/CMSgov/dpc/attribution/model/fhir"
+	v1 "github.com/CMSgov/dpc/attribution/model/v1"
+	v1Repo "github.com/CMSgov/dpc/attribution/repository/v1"
+	"github.com/CMSgov/dpc/attribution/storage"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockExportQueue struct {
+	mock.Mock
+}
+
+func (m *MockExportQueue) ClaimBatch(ctx context.Context, aggregatorID string) (*v1.ExportBatch, error) {
+	args := m.Called(ctx, aggregatorID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*v1.ExportBatch), args.Error(1)
+}
+
+func (m *MockExportQueue) UpdatePatientIndex(ctx context.Context, batchID string, aggregatorID string, index int) error {
+	args := m.Called(ctx, batchID, aggregatorID, index)
+	return args.Error(0)
+}
+
+func (m *MockExportQueue) Heartbeat(ctx context.Context, batchID string, aggregatorID string) error {
+	args := m.Called(ctx, batchID, aggregatorID)
+	return args.Error(0)
+}
+
+func (m *MockExportQueue) CompleteBatch(ctx context.Context, batch *v1.ExportBatch, aggregatorID string, files []v1.ExportFile) error {
+	args := m.Called(ctx, batch, aggregatorID, files)
+	return args.Error(0)
+}
+
+func (m *MockExportQueue) FailBatch(ctx context.Context, batch *v1.ExportBatch, aggregatorID string, files []v1.ExportFile) error {
+	args := m.Called(ctx, batch, aggregatorID, files)
+	return args.Error(0)
+}
+
+func (m *MockExportQueue) RestartStuckBatches(ctx context.Context, staleBefore time.Time) (int64, error) {
+	args := m.Called(ctx, staleBefore)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type ExportWorkerTestSuite struct {
+	suite.Suite
+	queue  *MockExportQueue
+	bfd    *client.MockBfdClient
+	worker *ExportWorker
+	dir    string
+	stored string
+}
+
+func TestExportWorkerTestSuite(t *testing.T) {
+	suite.Run(t, new(ExportWorkerTestSuite))
+}
+
+func (suite *ExportWorkerTestSuite) SetupTest() {
+	suite.queue = new(MockExportQueue)
+	suite.bfd = new(client.MockBfdClient)
+	suite.dir = suite.T().TempDir()
+	suite.stored = suite.T().TempDir()
+	suite.worker = NewExportWorker(suite.queue, suite.bfd, storage.NewLocalStore(suite.stored), Config{
+		ExportPath:        suite.dir,
+		PollInterval:      time.Millisecond,
+		HeartbeatInterval: time.Hour,
+		StuckAfter:        5 * time.Minute,
+		ResourcesPerFile:  2,
+	})
+	suite.queue.On("RestartStuckBatches", mock.Anything, mock.Anything).Return(int64(0), nil)
+}
+
+func bundle(resourceType string, ids ...string) *models.Bundle {
+	b := &models.Bundle{}
+	for _, id := range ids {
+		b.Entries = append(b.Entries, models.BundleEntry{"resource": map[string]interface{}{"resourceType": resourceType, "id": id}})
+	}
+	return b
+}
+
+func (suite *ExportWorkerTestSuite) TestProcessNextEmptyQueue() {
+	suite.queue.On("ClaimBatch", mock.Anything, suite.worker.aggregatorID).Return(nil, nil)
+
+	worked, err := suite.worker.ProcessNext(context.Background())
+
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), worked)
+}
+
+func (suite *ExportWorkerTestSuite) TestProcessNext() {
+	batch := &v1.ExportBatch{BatchID: "batch-1", JobID: "job-1", OrganizationID: "org-1", PatientMBIs: "mbi-1,mbi-2,mbi-3",
+		ResourceTypes: "Patient,Coverage", TransactionTime: time.Now()}
+	suite.queue.On("ClaimBatch", mock.Anything, suite.worker.aggregatorID).Return(batch, nil)
+	suite.queue.On("UpdatePatientIndex", mock.Anything, "batch-1", suite.worker.aggregatorID, mock.Anything).Return(nil)
+
+	var files []v1.ExportFile
+	suite.queue.On("CompleteBatch", mock.Anything, batch, suite.worker.aggregatorID, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		files = args.Get(3).([]v1.ExportFile)
+	})
+
+	suite.bfd.On("GetPatientByIdentifierHash", mock.Anything).Return(`{"entry": [{"resource": {"resourceType": "Patient", "id": "bene-1"}}]}`, nil).Twice()
+	suite.bfd.On("GetPatientByIdentifierHash", mock.Anything).Return(`{"entry": []}`, nil).Once()
+	suite.bfd.On("GetPatient", "bene-1", "job-1", "org-1", "", batch.TransactionTime).Return(bundle("Patient", "bene-1"), nil)
+	suite.bfd.On("GetCoverage", "bene-1", "job-1", "org-1", "", batch.TransactionTime).Return(bundle("Coverage", "c-1", "c-2"), nil)
+
+	worked, err := suite.worker.ProcessNext(context.Background())
+
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), worked)
+	suite.queue.AssertNumberOfCalls(suite.T(), "UpdatePatientIndex", 3)
+	suite.queue.AssertNotCalled(suite.T(), "FailBatch", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	counts := make(map[string]int)
+	for _, f := range files {
+		counts[f.FileName] = f.Count
+		assert.NoFileExists(suite.T(), filepath.Join(suite.dir, f.FileName+".ndjson.gz"))
+		compressed, _ := ioutil.ReadFile(filepath.Join(suite.stored, f.FileName+".ndjson.gz"))
+		sum := sha256.Sum256(compressed)
+		assert.Equal(suite.T(), sum[:], f.CompressedChecksum)
+		assert.Equal(suite.T(), int64(len(compressed)), f.CompressedFileLength)
+		b := suite.read(f.FileName)
+		sum = sha256.Sum256(b)
+		assert.Equal(suite.T(), sum[:], f.Checksum)
+		assert.Equal(suite.T(), int64(len(b)), f.FileLength)
+		assert.Equal(suite.T(), f.Count, suite.lines(f.FileName))
+	}
+	assert.Equal(suite.T(), map[string]int{
+		"batch-1-0.patient":          2,
+		"batch-1-0.coverage":         2,
+		"batch-1-1.coverage":         2,
+		"batch-1-0.operationoutcome": 1,
+	}, counts)
+}
+
+func (suite *ExportWorkerTestSuite) TestProcessNextAppliesTypeFilter() {
+	batch := &v1.ExportBatch{BatchID: "batch-5", JobID: "job-5", OrganizationID: "org-1", PatientMBIs: "mbi-1",
+		ResourceTypes: "ExplanationOfBenefit", TransactionTime: time.Now(),
+		TypeFilter: "ExplanationOfBenefit?service-date=ge2021-01-01&type=carrier%2Coutpatient"}
+	suite.queue.On("ClaimBatch", mock.Anything, suite.worker.aggregatorID).Return(batch, nil)
+	suite.queue.On("UpdatePatientIndex", mock.Anything, "batch-5", suite.worker.aggregatorID, 0).Return(nil)
+	suite.queue.On("CompleteBatch", mock.Anything, batch, suite.worker.aggregatorID, mock.Anything).Return(nil)
+	suite.bfd.On("GetPatientByIdentifierHash", mock.Anything).Return(`{"entry": [{"resource": {"resourceType": "Patient", "id": "bene-1"}}]}`, nil)
+	filter := client.EOBFilter{ClaimTypes: []string{"carrier", "outpatient"}, ServiceDates: []string{"ge2021-01-01"}}
+	suite.bfd.On("GetExplanationOfBenefit", "bene-1", "job-5", "org-1", "", batch.TransactionTime, filter).Return(bundle("ExplanationOfBenefit", "eob-1"), nil)
+
+	_, err := suite.worker.ProcessNext(context.Background())
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, suite.lines("batch-5-0.explanationofbenefit"))
+}
+
+func (suite *ExportWorkerTestSuite) TestProcessNextMergesTypeFilters() {
+	batch := &v1.ExportBatch{BatchID: "batch-7", JobID: "job-7", OrganizationID: "org-1", PatientMBIs: "mbi-1",
+		ResourceTypes: "ExplanationOfBenefit", TransactionTime: time.Now(),
+		TypeFilter: "ExplanationOfBenefit?type=carrier,ExplanationOfBenefit?service-date=ge2021-01-01"}
+	suite.queue.On("ClaimBatch", mock.Anything, suite.worker.aggregatorID).Return(batch, nil)
+	suite.queue.On("UpdatePatientIndex", mock.Anything, "batch-7", suite.worker.aggregatorID, 0).Return(nil)
+	suite.queue.On("CompleteBatch", mock.Anything, batch, suite.worker.aggregatorID, mock.Anything).Return(nil)
+	suite.bfd.On("GetPatientByIdentifierHash", mock.Anything).Return(`{"entry": [{"resource": {"resourceType": "Patient", "id": "bene-1"}}]}`, nil)
+	carrier := client.EOBFilter{ClaimTypes: []string{"carrier"}}
+	recent := client.EOBFilter{ServiceDates: []string{"ge2021-01-01"}}
+	suite.bfd.On("GetExplanationOfBenefit", "bene-1", "job-7", "org-1", "", batch.TransactionTime, carrier).Return(bundle("ExplanationOfBenefit", "eob-1", "eob-2"), nil)
+	suite.bfd.On("GetExplanationOfBenefit", "bene-1", "job-7", "org-1", "", batch.TransactionTime, recent).Return(bundle("ExplanationOfBenefit", "eob-2", "eob-3"), nil)
+
+	_, err := suite.worker.ProcessNext(context.Background())
+
+	assert.NoError(suite.T(), err)
+	suite.bfd.AssertNumberOfCalls(suite.T(), "GetExplanationOfBenefit", 2)
+	assert.Equal(suite.T(), 2, suite.lines("batch-7-0.explanationofbenefit"))
+	assert.Equal(suite.T(), 1, suite.lines("batch-7-1.explanationofbenefit"))
+}
+
+func (suite *ExportWorkerTestSuite) TestProcessNextAppliesElements() {
+	batch := &v1.ExportBatch{BatchID: "batch-6", JobID: "job-6", OrganizationID: "org-1", PatientMBIs: "mbi-1",
+		ResourceTypes: "Patient", TransactionTime: time.Now(), Elements: "Patient.name,Coverage.status"}
+	suite.queue.On("ClaimBatch", mock.Anything, suite.worker.aggregatorID).Return(batch, nil)
+	suite.queue.On("UpdatePatientIndex", mock.Anything, "batch-6", suite.worker.aggregatorID, 0).Return(nil)
+	suite.queue.On("CompleteBatch", mock.Anything, batch, suite.worker.aggregatorID, mock.Anything).Return(nil)
+	suite.bfd.On("GetPatientByIdentifierHash", mock.Anything).Return(`{"entry": [{"resource": {"resourceType": "Patient", "id": "bene-1"}}]}`, nil)
+	patient := &models.Bundle{Entries: []models.BundleEntry{{"resource": map[string]interface{}{
+		"resourceType": "Patient", "id": "bene-1", "name": []interface{}{"n"}, "gender": "female", "meta": map[string]interface{}{"lastUpdated": "2021-01-01"},
+	}}}}
+	suite.bfd.On("GetPatient", "bene-1", "job-6", "org-1", "", batch.TransactionTime).Return(patient, nil)
+
+	_, err := suite.worker.ProcessNext(context.Background())
+
+	assert.NoError(suite.T(), err)
+	b := suite.read("batch-6-0.patient")
+	var written map[string]interface{}
+	assert.NoError(suite.T(), json.Unmarshal(b, &written))
+	assert.Equal(suite.T(), map[string]interface{}{
+		"resourceType": "Patient",
+		"id":           "bene-1",
+		"name":         []interface{}{"n"},
+		"meta": map[string]interface{}{
+			"lastUpdated": "2021-01-01",
+			"tag":         []interface{}{map[string]interface{}{"system": "http://terminology.hl7.org/CodeSystem/v3-ObservationValue", "code": "SUBSETTED"}},
+		},
+	}, written)
+}
+
+func (suite *ExportWorkerTestSuite) TestProcessNextReportsWarnings() {
+	batch := &v1.ExportBatch{BatchID: "batch-7", JobID: "job-7", OrganizationID: "org-1", PatientMBIs: "mbi-1",
+		ResourceTypes: "Patient", TransactionTime: time.Now(), Warnings: []string{"Unsupported parameter _count, the parameter was ignored"}}
+	suite.queue.On("ClaimBatch", mock.Anything, suite.worker.aggregatorID).Return(batch, nil)
+	suite.queue.On("UpdatePatientIndex", mock.Anything, "batch-7", suite.worker.aggregatorID, 0).Return(nil)
+	suite.queue.On("CompleteBatch", mock.Anything, batch, suite.worker.aggregatorID, mock.Anything).Return(nil)
+	suite.bfd.On("GetPatientByIdentifierHash", mock.Anything).Return(`{"entry": [{"resource": {"resourceType": "Patient", "id": "bene-1"}}]}`, nil)
+	suite.bfd.On("GetPatient", "bene-1", "job-7", "org-1", "", batch.TransactionTime).Return(bundle("Patient", "bene-1"), nil)
+
+	_, err := suite.worker.ProcessNext(context.Background())
+
+	assert.NoError(suite.T(), err)
+	b := suite.read("batch-7-0.operationoutcome")
+	var written map[string]interface{}
+	assert.NoError(suite.T(), json.Unmarshal(b, &written))
+	issue := written["issue"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(suite.T(), "warning", issue["severity"])
+	assert.Equal(suite.T(), "Unsupported parameter _count, the parameter was ignored", issue["details"].(map[string]interface{})["text"])
+}
+
+func (suite *ExportWorkerTestSuite) TestProcessNextResumesBatch() {
+	batch := &v1.ExportBatch{BatchID: "batch-2", JobID: "job-2", OrganizationID: "org-1", PatientMBIs: "mbi-1,mbi-2",
+		ResourceTypes: "Patient", TransactionTime: time.Now(), PatientIndex: sql.NullInt64{Int64: 0, Valid: true},
+		Since: sql.NullTime{Time: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), Valid: true}}
+	// the previous attempt was paused after flushing its first patient, so the file has no gzip trailer
+	var previous bytes.Buffer
+	gz := gzip.NewWriter(&previous)
+	_, _ = gz.Write([]byte("{\"id\":\"first\"}\n{\"id\":"))
+	_ = gz.Flush()
+	assert.NoError(suite.T(), ioutil.WriteFile(filepath.Join(suite.dir, "batch-2-0.patient.ndjson.gz"), previous.Bytes()[:previous.Len()-5], 0600))
+
+	suite.queue.On("ClaimBatch", mock.Anything, suite.worker.aggregatorID).Return(batch, nil)
+	suite.queue.On("UpdatePatientIndex", mock.Anything, "batch-2", suite.worker.aggregatorID, 1).Return(nil)
+	var files []v1.ExportFile
+	suite.queue.On("CompleteBatch", mock.Anything, batch, suite.worker.aggregatorID, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		files = args.Get(3).([]v1.ExportFile)
+	})
+	suite.bfd.On("GetPatientByIdentifierHash", mock.Anything).Return(`{"entry": [{"resource": {"resourceType": "Patient", "id": "bene-2"}}]}`, nil).Once()
+	suite.bfd.On("GetPatient", "bene-2", "job-2", "org-1", "gt2021-01-01T00:00:00Z", batch.TransactionTime).Return(bundle("Patient", "bene-2"), nil)
+
+	_, err := suite.worker.ProcessNext(context.Background())
+
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), files, 1)
+	assert.Equal(suite.T(), 2, files[0].Count)
+	assert.Equal(suite.T(), 2, suite.lines("batch-2-0.patient"))
+}
+
+func (suite *ExportWorkerTestSuite) TestProcessNextRestartsBatchWithoutPreviousFiles() {
+	// the previous attempt ran on another instance, so the work directory has none of its files
+	batch := &v1.ExportBatch{BatchID: "batch-8", JobID: "job-8", OrganizationID: "org-1", PatientMBIs: "mbi-1,mbi-2",
+		ResourceTypes: "Patient", TransactionTime: time.Now(), PatientIndex: sql.NullInt64{Int64: 0, Valid: true}}
+	suite.queue.On("ClaimBatch", mock.Anything, suite.worker.aggregatorID).Return(batch, nil)
+	suite.queue.On("UpdatePatientIndex", mock.Anything, "batch-8", suite.worker.aggregatorID, mock.Anything).Return(nil)
+	var files []v1.ExportFile
+	suite.queue.On("CompleteBatch", mock.Anything, batch, suite.worker.aggregatorID, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		files = args.Get(3).([]v1.ExportFile)
+	})
+	suite.bfd.On("GetPatientByIdentifierHash", mock.Anything).Return(`{"entry": [{"resource": {"resourceType": "Patient", "id": "bene-1"}}]}`, nil).Twice()
+	suite.bfd.On("GetPatient", "bene-1", "job-8", "org-1", "", batch.TransactionTime).Return(bundle("Patient", "bene-1"), nil)
+
+	_, err := suite.worker.ProcessNext(context.Background())
+
+	assert.NoError(suite.T(), err)
+	suite.queue.AssertCalled(suite.T(), "UpdatePatientIndex", mock.Anything, "batch-8", suite.worker.aggregatorID, 0)
+	suite.queue.AssertCalled(suite.T(), "UpdatePatientIndex", mock.Anything, "batch-8", suite.worker.aggregatorID, 1)
+	assert.Len(suite.T(), files, 1)
+	assert.Equal(suite.T(), 2, files[0].Count)
+	assert.Equal(suite.T(), 2, suite.lines("batch-8-0.patient"))
+}
+
+func (suite *ExportWorkerTestSuite) TestProcessNextFailsBatch() {
+	batch := &v1.ExportBatch{BatchID: "batch-3", JobID: "job-3", PatientMBIs: "mbi-1,mbi-2", ResourceTypes: "Patient"}
+	suite.queue.On("ClaimBatch", mock.Anything, suite.worker.aggregatorID).Return(batch, nil)
+	suite.queue.On("UpdatePatientIndex", mock.Anything, "batch-3", suite.worker.aggregatorID, 0).Return(errors.New("db down"))
+	var files []v1.ExportFile
+	suite.queue.On("FailBatch", mock.Anything, batch, suite.worker.aggregatorID, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		files = args.Get(3).([]v1.ExportFile)
+	})
+	suite.bfd.On("GetPatientByIdentifierHash", mock.Anything).Return("", errors.New("bfd down"))
+
+	worked, err := suite.worker.ProcessNext(context.Background())
+
+	assert.True(suite.T(), worked)
+	assert.Error(suite.T(), err)
+	suite.queue.AssertNotCalled(suite.T(), "CompleteBatch", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	// one outcome for the failed lookup, then one for each patient the batch did not finish
+	total := 0
+	for _, f := range files {
+		assert.Equal(suite.T(), "OperationOutcome", f.ResourceType)
+		total += f.Count
+	}
+	assert.Equal(suite.T(), 3, total)
+}
+
+func (suite *ExportWorkerTestSuite) TestProcessNextPausedBatchIsNotFailed() {
+	batch := &v1.ExportBatch{BatchID: "batch-4", JobID: "job-4", PatientMBIs: "mbi-1,mbi-2", ResourceTypes: "Patient"}
+	ctx, cancel := context.WithCancel(context.Background())
+	suite.queue.On("ClaimBatch", mock.Anything, suite.worker.aggregatorID).Return(batch, nil)
+	suite.queue.On("UpdatePatientIndex", mock.Anything, "batch-4", suite.worker.aggregatorID, 0).Return(nil).Run(func(mock.Arguments) {
+		cancel()
+	})
+	suite.bfd.On("GetPatientByIdentifierHash", mock.Anything).Return("", errors.New("bfd down"))
+
+	worked, err := suite.worker.ProcessNext(ctx)
+
+	assert.True(suite.T(), worked)
+	assert.NoError(suite.T(), err)
+	suite.queue.AssertNotCalled(suite.T(), "FailBatch", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	assert.Equal(suite.T(), 1, suite.lines("batch-4-0.operationoutcome"))
+	// the writers were closed, so the file is complete for the batch to resume from
+	f, _ := os.Open(filepath.Join(suite.dir, "batch-4-0.operationoutcome.ndjson.gz"))
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	assert.NoError(suite.T(), err)
+	_, err = ioutil.ReadAll(gz)
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *ExportWorkerTestSuite) TestProcessNextTakenOverBatchDiscardsFiles() {
+	batch := &v1.ExportBatch{BatchID: "batch-9", JobID: "job-9", PatientMBIs: "mbi-1,mbi-2", ResourceTypes: "Patient"}
+	suite.queue.On("ClaimBatch", mock.Anything, suite.worker.aggregatorID).Return(batch, nil)
+	suite.queue.On("UpdatePatientIndex", mock.Anything, "batch-9", suite.worker.aggregatorID, 0).Return(v1Repo.ErrBatchNotOwned)
+	suite.bfd.On("GetPatientByIdentifierHash", mock.Anything).Return("", errors.New("bfd down"))
+
+	worked, err := suite.worker.ProcessNext(context.Background())
+
+	assert.True(suite.T(), worked)
+	assert.NoError(suite.T(), err)
+	suite.queue.AssertNotCalled(suite.T(), "FailBatch", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	assert.NoFileExists(suite.T(), filepath.Join(suite.dir, "batch-9-0.operationoutcome.ndjson.gz"))
+	entries, _ := ioutil.ReadDir(suite.stored)
+	assert.Empty(suite.T(), entries)
+}
+
+// read returns the uncompressed content of an export file, from the store once its batch finished or else from the
+// worker's directory. A crashed batch leaves its files without a gzip trailer, so a truncated file returns what was flushed.
+func (suite *ExportWorkerTestSuite) read(fileName string) []byte {
+	f, err := os.Open(filepath.Join(suite.stored, fileName+".ndjson.gz"))
+	if os.IsNotExist(err) {
+		f, err = os.Open(filepath.Join(suite.dir, fileName+".ndjson.gz"))
+	}
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if !assert.NoError(suite.T(), err) {
+		return nil
+	}
+	b, err := ioutil.ReadAll(gz)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		assert.NoError(suite.T(), err)
+	}
+	return b
+}
+
+func (suite *ExportWorkerTestSuite) lines(fileName string) int {
+	s := bufio.NewScanner(bytes.NewReader(suite.read(fileName)))
+	n := 0
+	for s.Scan() {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,306 @@
+package worker
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/CMSgov/dpc/attribution/model/v1"
+)
+
+// ndjsonWriter writes the resources of one type in a batch to gzip-compressed NDJSON files, starting a new file every
+// limit resources. When elements are given, resources are trimmed to those top-level elements.
+type ndjsonWriter struct {
+	dir          string
+	batchID      string
+	resourceType string
+	limit        int
+	elements     []string
+
+	files   []*v1.ExportFile
+	current *os.File
+	gz      *gzip.Writer
+	buf     *bufio.Writer
+}
+
+// newNDJSONWriter creates a writer, picking up files already written for the batch so a restarted batch appends
+// to them instead of overwriting the output of patients it already processed
+func newNDJSONWriter(dir string, batchID string, resourceType string, limit int, elements []string) (*ndjsonWriter, error) {
+	w := &ndjsonWriter{dir: dir, batchID: batchID, resourceType: resourceType, limit: limit, elements: elements}
+	for seq := 0; ; seq++ {
+		name := v1.FileName(batchID, resourceType, seq)
+		count, err := recoverFile(w.path(name))
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		w.files = append(w.files, &v1.ExportFile{ResourceType: resourceType, Sequence: seq, FileName: name, Count: count})
+	}
+	return w, nil
+}
+
+// Recovered reports whether files written by a previous attempt at the batch were picked up
+func (w *ndjsonWriter) Recovered() bool {
+	return len(w.files) > 0
+}
+
+func (w *ndjsonWriter) path(fileName string) string {
+	return filepath.Join(w.dir, v1.CompressedFileName(fileName))
+}
+
+// Write appends a resource as a single line
+func (w *ndjsonWriter) Write(resource interface{}) error {
+	if m, ok := resource.(map[string]interface{}); ok && len(w.elements) > 0 {
+		resource = subsetResource(m, w.elements)
+	}
+	b, err := json.Marshal(resource)
+	if err != nil {
+		return err
+	}
+	if err := w.ensureFile(); err != nil {
+		return err
+	}
+	if _, err := w.buf.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	w.files[len(w.files)-1].Count++
+	return nil
+}
+
+func (w *ndjsonWriter) ensureFile() error {
+	var last *v1.ExportFile
+	if len(w.files) > 0 {
+		last = w.files[len(w.files)-1]
+	}
+	if w.current != nil && last.Count < w.limit {
+		return nil
+	}
+	if err := w.closeCurrent(); err != nil {
+		return err
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if last == nil || last.Count >= w.limit {
+		seq := len(w.files)
+		last = &v1.ExportFile{ResourceType: w.resourceType, Sequence: seq, FileName: v1.FileName(w.batchID, w.resourceType, seq)}
+		w.files = append(w.files, last)
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(w.path(last.FileName), flags, 0600)
+	if err != nil {
+		return err
+	}
+	// a file reopened by a restarted batch gets a new gzip member appended, which readers decompress as one stream
+	w.current = f
+	w.gz = gzip.NewWriter(f)
+	w.buf = bufio.NewWriter(w.gz)
+	return nil
+}
+
+// Flush writes buffered resources to disk, so they can be read back if the batch is resumed
+func (w *ndjsonWriter) Flush() error {
+	if w.buf == nil {
+		return nil
+	}
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	return w.gz.Flush()
+}
+
+// closeCurrent flushes and closes the open file. The file handle is released even when flushing fails.
+func (w *ndjsonWriter) closeCurrent() error {
+	if w.current == nil {
+		return nil
+	}
+	err := w.buf.Flush()
+	if gzErr := w.gz.Close(); err == nil {
+		err = gzErr
+	}
+	if fileErr := w.current.Close(); err == nil {
+		err = fileErr
+	}
+	w.current, w.gz, w.buf = nil, nil, nil
+	return err
+}
+
+// Release closes the open file without reporting the files, leaving them in place for the batch to resume from
+func (w *ndjsonWriter) Release() error {
+	return w.closeCurrent()
+}
+
+// Discard closes the open file and removes every file of the writer from the work directory
+func (w *ndjsonWriter) Discard() error {
+	err := w.closeCurrent()
+	for _, f := range w.files {
+		if rmErr := os.Remove(w.path(f.FileName)); rmErr != nil && !os.IsNotExist(rmErr) && err == nil {
+			err = rmErr
+		}
+	}
+	w.files = nil
+	return err
+}
+
+// Close closes the open file and computes the checksum and length of every file written, both as stored and uncompressed
+func (w *ndjsonWriter) Close() ([]v1.ExportFile, error) {
+	if err := w.closeCurrent(); err != nil {
+		return nil, err
+	}
+	files := make([]v1.ExportFile, 0, len(w.files))
+	for _, f := range w.files {
+		sums, err := checksumFile(w.path(f.FileName))
+		if err != nil {
+			return nil, err
+		}
+		f.Checksum, f.FileLength = sums.checksum, sums.length
+		f.CompressedChecksum, f.CompressedFileLength = sums.compressedChecksum, sums.compressedLength
+		files = append(files, *f)
+	}
+	return files, nil
+}
+
+// subsettedTag is the meta tag that marks a resource trimmed by _elements, per the FHIR spec
+var subsettedTag = map[string]interface{}{
+	"system": "http://terminology.hl7.org/CodeSystem/v3-ObservationValue",
+	"code":   "SUBSETTED",
+}
+
+// subsetResource trims a resource to the given top-level elements, keeping the mandatory id, resourceType and meta
+// elements, and tags it as SUBSETTED
+func subsetResource(resource map[string]interface{}, elements []string) map[string]interface{} {
+	subset := map[string]interface{}{"resourceType": resource["resourceType"], "id": resource["id"]}
+	for _, name := range elements {
+		if value, ok := resource[name]; ok {
+			subset[name] = value
+		}
+	}
+	meta := make(map[string]interface{})
+	if existing, ok := resource["meta"].(map[string]interface{}); ok {
+		for k, v := range existing {
+			meta[k] = v
+		}
+	}
+	tags, _ := meta["tag"].([]interface{})
+	meta["tag"] = append(tags, subsettedTag)
+	subset["meta"] = meta
+	return subset
+}
+
+// fileSums are the SHA-256 checksums and lengths of a gzipped file and of its uncompressed content
+type fileSums struct {
+	checksum           []byte
+	length             int64
+	compressedChecksum []byte
+	compressedLength   int64
+}
+
+// checksumFile returns the checksums and lengths of a gzipped file, reading it once
+func checksumFile(path string) (fileSums, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return fileSums{}, err
+	}
+	defer f.Close()
+	compressed := sha256.New()
+	counter := &countingWriter{w: compressed}
+	tee := io.TeeReader(f, counter)
+	gz, err := gzip.NewReader(tee)
+	if err != nil {
+		return fileSums{}, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(h, gz)
+	if err != nil {
+		return fileSums{}, err
+	}
+	if _, err := io.Copy(ioutil.Discard, tee); err != nil {
+		return fileSums{}, err
+	}
+	return fileSums{checksum: h.Sum(nil), length: n, compressedChecksum: compressed.Sum(nil), compressedLength: counter.n}, nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// recoverFile returns the number of lines in a gzipped NDJSON file written by an earlier attempt at the batch.
+// A file left without its gzip trailer, because that attempt was paused or crashed, is rewritten with just its
+// complete lines, so new resources can be appended to it.
+func recoverFile(path string) (int, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	count, err := copyLines(ioutil.Discard, f)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		return count, err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	tmp := path + ".tmp"
+	out, err := os.OpenFile(filepath.Clean(tmp), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, err
+	}
+	gz := gzip.NewWriter(out)
+	count, err = copyLines(gz, f)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		_ = out.Close()
+		return 0, err
+	}
+	if err := gz.Close(); err != nil {
+		_ = out.Close()
+		return 0, err
+	}
+	if err := out.Close(); err != nil {
+		return 0, err
+	}
+	return count, os.Rename(tmp, path)
+}
+
+// copyLines copies the complete lines of a gzip stream to w and returns how many there were. It returns
+// io.ErrUnexpectedEOF, along with the lines it could read, when the stream is truncated.
+func copyLines(w io.Writer, r io.Reader) (int, error) {
+	gz, err := gzip.NewReader(r)
+	if errors.Is(err, io.EOF) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return 0, err
+	}
+	br := bufio.NewReader(gz)
+	count := 0
+	for {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		if _, err := w.Write(line); err != nil {
+			return count, err
+		}
+		count++
+	}
+}
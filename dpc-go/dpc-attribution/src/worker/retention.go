@@ -0,0 +1,122 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/CMSgov/dpc/attribution/conf"
+	"github.com/CMSgov/dpc/attribution/logger"
+	"github.com/CMSgov/dpc/attribution/model/v1"
+	v1Repo "github.com/CMSgov/dpc/attribution/repository/v1"
+	"github.com/CMSgov/dpc/attribution/storage"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// NewRetentionPolicy reads the retention policy from config. The sweeper is off unless retention.sweeperEnabled is
+// true, and then keeps files for retention.defaultHours, 24 by default, unless an admin set other hours for the
+// organization.
+func NewRetentionPolicy() v1.RetentionPolicy {
+	return v1.RetentionPolicy{
+		Enabled: conf.GetAsString("retention.sweeperEnabled", "false") == "true",
+		Default: time.Duration(conf.GetAsInt("retention.defaultHours", 24)) * time.Hour,
+	}
+}
+
+// RetentionConfig holds the settings of a RetentionSweeper
+type RetentionConfig struct {
+	Policy        v1.RetentionPolicy
+	SweepInterval time.Duration
+	// JobsPerSweep caps how many jobs are purged between two checks of the queue
+	JobsPerSweep int
+}
+
+// NewRetentionConfig reads the retention sweeper settings from config
+func NewRetentionConfig() RetentionConfig {
+	return RetentionConfig{
+		Policy:        NewRetentionPolicy(),
+		SweepInterval: time.Duration(conf.GetAsInt("retention.sweepIntervalMinutes", 60)) * time.Minute,
+		JobsPerSweep:  conf.GetAsInt("retention.jobsPerSweep", 100),
+	}
+}
+
+// RetentionSweeper deletes the files of jobs that outlived the retention period of their organization and marks
+// their job_queue_batch_file rows purged, so the API answers 410 for them
+type RetentionSweeper struct {
+	queue  v1Repo.FileRetention
+	store  storage.Store
+	config RetentionConfig
+}
+
+// NewRetentionSweeper creates a RetentionSweeper
+func NewRetentionSweeper(queue v1Repo.FileRetention, store storage.Store, config RetentionConfig) *RetentionSweeper {
+	return &RetentionSweeper{
+		queue,
+		store,
+		config,
+	}
+}
+
+// Run sweeps every SweepInterval until the context is cancelled
+func (s *RetentionSweeper) Run(ctx context.Context) {
+	log := logger.WithContext(ctx)
+	log.Info("Starting retention sweeper")
+	for {
+		purged, err := s.Sweep(ctx)
+		if err != nil {
+			log.Error("Failed to sweep expired export files", zap.Error(err))
+		}
+		if purged > 0 {
+			log.Info(fmt.Sprintf("Purged the files of %d expired jobs", purged))
+		}
+		select {
+		case <-ctx.Done():
+			log.Info("Stopping retention sweeper")
+			return
+		case <-time.After(s.config.SweepInterval):
+		}
+	}
+}
+
+// Sweep purges expired jobs a page at a time until none are left or a job fails to purge, which is retried on
+// the next sweep. It returns the number of jobs purged.
+func (s *RetentionSweeper) Sweep(ctx context.Context) (int, error) {
+	purged := 0
+	for {
+		jobs, err := s.queue.FindExpiredJobs(ctx, s.config.Policy, time.Now(), s.config.JobsPerSweep)
+		if err != nil {
+			return purged, errors.Wrap(err, "failed to find expired jobs")
+		}
+		failed := false
+		for _, job := range jobs {
+			if err := s.purge(ctx, job); err != nil {
+				logger.WithContext(ctx).Warn(fmt.Sprintf("Failed to purge the files of job %s", job.JobID), zap.Error(err))
+				failed = true
+				continue
+			}
+			purged++
+		}
+		if failed || len(jobs) < s.config.JobsPerSweep || ctx.Err() != nil {
+			return purged, nil
+		}
+	}
+}
+
+// purge deletes the files of every batch of the job before marking them purged, so a failed delete is retried
+func (s *RetentionSweeper) purge(ctx context.Context, job v1.ExpiredJob) error {
+	batches, err := s.queue.FindBatchesByJobID(job.JobID, job.OrganizationID)
+	if err != nil {
+		return err
+	}
+	for _, b := range batches {
+		if err := s.store.DeletePrefix(ctx, b.BatchID+"-"); err != nil {
+			return err
+		}
+	}
+	if err := s.queue.MarkJobFilesPurged(ctx, job.JobID, time.Now()); err != nil {
+		return err
+	}
+	logger.WithContext(ctx).Info(fmt.Sprintf("dpcMetric=jobFilesPurged,jobId=%s,orgId=%s", job.JobID, job.OrganizationID))
+	return nil
+}
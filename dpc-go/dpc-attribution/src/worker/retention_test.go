@@ -0,0 +1,149 @@
+package worker
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CMSgov/dpc/attribution/conf"
+	v1 "github.com/CMSgov/dpc/attribution/model/v1"
+	"github.com/CMSgov/dpc/attribution/storage"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockFileRetention struct {
+	mock.Mock
+}
+
+func (m *MockFileRetention) FindExpiredJobs(ctx context.Context, policy v1.RetentionPolicy, now time.Time, limit int) ([]v1.ExpiredJob, error) {
+	args := m.Called(ctx, policy, now, limit)
+	return args.Get(0).([]v1.ExpiredJob), args.Error(1)
+}
+
+func (m *MockFileRetention) FindBatchesByJobID(id string, orgID string) ([]v1.JobQueueBatch, error) {
+	args := m.Called(id, orgID)
+	return args.Get(0).([]v1.JobQueueBatch), args.Error(1)
+}
+
+func (m *MockFileRetention) MarkJobFilesPurged(ctx context.Context, jobID string, purgedAt time.Time) error {
+	args := m.Called(ctx, jobID, purgedAt)
+	return args.Error(0)
+}
+
+type MockStore struct {
+	mock.Mock
+}
+
+func (m *MockStore) Upload(ctx context.Context, name string, file string) error {
+	args := m.Called(ctx, name, file)
+	return args.Error(0)
+}
+
+func (m *MockStore) DeletePrefix(ctx context.Context, prefix string) error {
+	args := m.Called(ctx, prefix)
+	return args.Error(0)
+}
+
+type RetentionSweeperTestSuite struct {
+	suite.Suite
+	queue   *MockFileRetention
+	dir     string
+	sweeper *RetentionSweeper
+}
+
+func TestRetentionSweeperTestSuite(t *testing.T) {
+	suite.Run(t, new(RetentionSweeperTestSuite))
+}
+
+func (suite *RetentionSweeperTestSuite) SetupTest() {
+	suite.queue = new(MockFileRetention)
+	suite.dir = suite.T().TempDir()
+	suite.sweeper = NewRetentionSweeper(suite.queue, storage.NewLocalStore(suite.dir), RetentionConfig{
+		Policy:        v1.RetentionPolicy{Enabled: true, Default: 24 * time.Hour},
+		SweepInterval: time.Hour,
+		JobsPerSweep:  2,
+	})
+}
+
+func (suite *RetentionSweeperTestSuite) write(name string) string {
+	path := filepath.Join(suite.dir, name)
+	assert.NoError(suite.T(), ioutil.WriteFile(path, []byte("{}\n"), 0600))
+	return path
+}
+
+func (suite *RetentionSweeperTestSuite) TestSweep() {
+	expired := suite.write("batch-1-0.patient.ndjson.gz")
+	expiredError := suite.write("batch-2-0.operationoutcome.ndjson.gz")
+	kept := suite.write("batch-3-0.patient.ndjson.gz")
+
+	suite.queue.On("FindExpiredJobs", mock.Anything, suite.sweeper.config.Policy, mock.Anything, 2).
+		Return([]v1.ExpiredJob{{JobID: "job-1", OrganizationID: "org-1"}, {JobID: "job-2", OrganizationID: "org-1"}}, nil).Once()
+	suite.queue.On("FindExpiredJobs", mock.Anything, suite.sweeper.config.Policy, mock.Anything, 2).
+		Return([]v1.ExpiredJob{}, nil).Once()
+	suite.queue.On("FindBatchesByJobID", "job-1", "org-1").Return([]v1.JobQueueBatch{{BatchID: "batch-1"}}, nil)
+	suite.queue.On("FindBatchesByJobID", "job-2", "org-1").Return([]v1.JobQueueBatch{{BatchID: "batch-2"}}, nil)
+	suite.queue.On("MarkJobFilesPurged", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	purged, err := suite.sweeper.Sweep(context.Background())
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 2, purged)
+	assert.NoFileExists(suite.T(), expired)
+	assert.NoFileExists(suite.T(), expiredError)
+	assert.FileExists(suite.T(), kept)
+	suite.queue.AssertCalled(suite.T(), "MarkJobFilesPurged", mock.Anything, "job-1", mock.Anything)
+	suite.queue.AssertCalled(suite.T(), "MarkJobFilesPurged", mock.Anything, "job-2", mock.Anything)
+}
+
+func (suite *RetentionSweeperTestSuite) TestSweepLeavesFailedJobsUnpurged() {
+	store := new(MockStore)
+	sweeper := NewRetentionSweeper(suite.queue, store, suite.sweeper.config)
+
+	suite.queue.On("FindExpiredJobs", mock.Anything, mock.Anything, mock.Anything, 2).
+		Return([]v1.ExpiredJob{{JobID: "job-1", OrganizationID: "org-1"}, {JobID: "job-2", OrganizationID: "org-1"}}, nil).Once()
+	suite.queue.On("FindBatchesByJobID", "job-1", "org-1").Return([]v1.JobQueueBatch{{BatchID: "batch-1"}}, nil)
+	suite.queue.On("FindBatchesByJobID", "job-2", "org-1").Return([]v1.JobQueueBatch{{BatchID: "batch-2"}}, nil)
+	store.On("DeletePrefix", mock.Anything, "batch-1-").Return(errors.New("bucket unavailable"))
+	store.On("DeletePrefix", mock.Anything, "batch-2-").Return(nil)
+	suite.queue.On("MarkJobFilesPurged", mock.Anything, "job-2", mock.Anything).Return(nil)
+
+	purged, err := sweeper.Sweep(context.Background())
+
+	// the full page is not fetched again, so job-1 waits for the next sweep rather than being retried in a loop
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, purged)
+	suite.queue.AssertNotCalled(suite.T(), "MarkJobFilesPurged", mock.Anything, "job-1", mock.Anything)
+	suite.queue.AssertNumberOfCalls(suite.T(), "FindExpiredJobs", 1)
+}
+
+func (suite *RetentionSweeperTestSuite) TestSweepQueueError() {
+	suite.queue.On("FindExpiredJobs", mock.Anything, mock.Anything, mock.Anything, 2).
+		Return([]v1.ExpiredJob{}, errors.New("connection refused"))
+
+	purged, err := suite.sweeper.Sweep(context.Background())
+
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), 0, purged)
+}
+
+func (suite *RetentionSweeperTestSuite) TestNewRetentionPolicy() {
+	conf.NewConfig("../../configs")
+
+	policy := NewRetentionPolicy()
+
+	assert.False(suite.T(), policy.Enabled)
+	assert.Equal(suite.T(), 24*time.Hour, policy.Default)
+
+	conf.SetEnv(suite.T(), "retention.sweeperEnabled", "true")
+	conf.SetEnv(suite.T(), "retention.defaultHours", 48)
+
+	policy = NewRetentionPolicy()
+
+	assert.True(suite.T(), policy.Enabled)
+	assert.Equal(suite.T(), 48*time.Hour, policy.Default)
+}
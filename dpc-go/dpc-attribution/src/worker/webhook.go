@@ -0,0 +1,238 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CMSgov/dpc/attribution/conf"
+	"github.com/CMSgov/dpc/attribution/logger"
+	"github.com/CMSgov/dpc/attribution/model/v1"
+	v1Repo "github.com/CMSgov/dpc/attribution/repository/v1"
+	"github.com/CMSgov/dpc/attribution/util"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Headers set on every webhook notification. The signature is the hex HMAC-SHA256, keyed by the organization's
+// webhook secret, of the timestamp header, a dot and the body, prefixed with sha256=
+const (
+	SignatureHeader = "X-DPC-Signature"
+	TimestampHeader = "X-DPC-Timestamp"
+	DeliveryHeader  = "X-DPC-Delivery"
+)
+
+// SignWebhook returns the signature header value of a notification body sent at the unix timestamp
+func SignWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookConfig holds the settings of a WebhookDispatcher
+type WebhookConfig struct {
+	// ManifestBaseURL is prepended to /Jobs/{jobID} to build the job status URL sent in the notification
+	ManifestBaseURL string
+	PollInterval    time.Duration
+	// Lookback is how long after a job finished it is still notified, e.g. after the dispatcher was down
+	Lookback          time.Duration
+	DeliveriesPerPoll int
+	MaxAttempts       int
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	Timeout           time.Duration
+	// AllowPrivateNetworks lets notifications go over plain http to internal addresses, which is only wanted locally
+	AllowPrivateNetworks bool
+}
+
+// NewWebhookConfig reads the webhook dispatcher settings from config
+func NewWebhookConfig() WebhookConfig {
+	return WebhookConfig{
+		ManifestBaseURL:      strings.TrimSuffix(conf.GetAsString("webhooks.manifestBaseURL", "http://localhost:3000/api/v2"), "/"),
+		PollInterval:         time.Duration(conf.GetAsInt("webhooks.pollIntervalSeconds", 10)) * time.Second,
+		Lookback:             time.Duration(conf.GetAsInt("webhooks.lookbackHours", 24)) * time.Hour,
+		DeliveriesPerPoll:    conf.GetAsInt("webhooks.deliveriesPerPoll", 50),
+		MaxAttempts:          conf.GetAsInt("webhooks.maxAttempts", 8),
+		InitialBackoff:       time.Duration(conf.GetAsInt("webhooks.initialBackoffSeconds", 30)) * time.Second,
+		MaxBackoff:           time.Duration(conf.GetAsInt("webhooks.maxBackoffMinutes", 60)) * time.Minute,
+		Timeout:              time.Duration(conf.GetAsInt("webhooks.timeoutSeconds", 10)) * time.Second,
+		AllowPrivateNetworks: conf.IsLocal(),
+	}
+}
+
+// WebhookDispatcher queues a delivery for each job that finishes with a webhook to notify, and POSTs the signed
+// notifications, retrying failed ones with exponential backoff until MaxAttempts. Every attempt is recorded in
+// the webhook_delivery table, which is the delivery log organizations can read.
+type WebhookDispatcher struct {
+	queue  v1Repo.WebhookQueue
+	client *http.Client
+	config WebhookConfig
+}
+
+// NewWebhookDispatcher creates a WebhookDispatcher. Its client connects only to public addresses, checked once the
+// host is resolved, and does not follow redirects, so a webhook cannot be used to reach internal services.
+func NewWebhookDispatcher(queue v1Repo.WebhookQueue, config WebhookConfig) *WebhookDispatcher {
+	dialer := &net.Dialer{Timeout: config.Timeout}
+	if !config.AllowPrivateNetworks {
+		dialer.Control = util.RefusePrivateAddress
+	}
+	return &WebhookDispatcher{
+		queue,
+		&http.Client{
+			Timeout:   config.Timeout,
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		config,
+	}
+}
+
+// Run dispatches every PollInterval until the context is cancelled
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	log := logger.WithContext(ctx)
+	log.Info("Starting webhook dispatcher")
+	for {
+		if _, err := d.Dispatch(ctx); err != nil {
+			log.Error("Failed to dispatch webhooks", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			log.Info("Stopping webhook dispatcher")
+			return
+		case <-time.After(d.config.PollInterval):
+		}
+	}
+}
+
+// Dispatch queues the deliveries of newly finished jobs and sends those that are due. It returns the number of
+// deliveries attempted.
+func (d *WebhookDispatcher) Dispatch(ctx context.Context) (int, error) {
+	now := time.Now()
+	if err := d.enqueue(ctx, now); err != nil {
+		return 0, err
+	}
+
+	// a claimed delivery is leased for long enough to be sent, so other dispatchers leave it alone
+	deliveries, err := d.queue.ClaimDeliveries(ctx, now, now.Add(2*d.config.Timeout), d.config.DeliveriesPerPoll)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to claim webhook deliveries")
+	}
+	for _, delivery := range deliveries {
+		attempt := d.send(ctx, delivery)
+		if err := d.queue.RecordAttempt(ctx, delivery.ID, attempt); err != nil {
+			logger.WithContext(ctx).Error(fmt.Sprintf("Failed to record attempt of webhook delivery %s", delivery.ID), zap.Error(err))
+		}
+	}
+	return len(deliveries), nil
+}
+
+func (d *WebhookDispatcher) enqueue(ctx context.Context, now time.Time) error {
+	jobs, err := d.queue.FindFinishedJobs(ctx, now.Add(-d.config.Lookback), d.config.DeliveriesPerPoll)
+	if err != nil {
+		return errors.Wrap(err, "failed to find finished jobs")
+	}
+	for _, job := range jobs {
+		payload, err := json.Marshal(v1.WebhookPayload{
+			JobID:        job.JobID,
+			Status:       job.Status,
+			ManifestURL:  fmt.Sprintf("%s/Jobs/%s", d.config.ManifestBaseURL, job.JobID),
+			CompleteTime: job.CompleteTime,
+		})
+		if err != nil {
+			return err
+		}
+		err = d.queue.InsertDelivery(ctx, v1.WebhookDelivery{
+			JobID:          job.JobID,
+			OrganizationID: job.OrganizationID,
+			URL:            job.URL,
+			Payload:        string(payload),
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to queue webhook delivery")
+		}
+	}
+	return nil
+}
+
+// send POSTs the delivery once and returns the outcome to record
+func (d *WebhookDispatcher) send(ctx context.Context, delivery v1.WebhookDelivery) v1.DeliveryAttempt {
+	log := logger.WithContext(ctx)
+	if delivery.Secret == "" {
+		msg := "organization has no webhook secret to sign with"
+		return v1.DeliveryAttempt{Status: v1.DeliveryFailed, Error: &msg, NextAttemptAt: time.Now(), At: time.Now()}
+	}
+
+	statusCode, err := d.post(ctx, delivery)
+	now := time.Now()
+	attempt := v1.DeliveryAttempt{StatusCode: statusCode, At: now, NextAttemptAt: now}
+	if err == nil {
+		attempt.Status = v1.DeliveryDelivered
+		log.Info(fmt.Sprintf("dpcMetric=webhookDelivered,jobId=%s,orgId=%s,attempts=%d", delivery.JobID, delivery.OrganizationID, delivery.Attempts+1))
+		return attempt
+	}
+
+	msg := err.Error()
+	attempt.Error = &msg
+	if delivery.Attempts+1 >= d.config.MaxAttempts {
+		attempt.Status = v1.DeliveryFailed
+		log.Warn(fmt.Sprintf("dpcMetric=webhookFailed,jobId=%s,orgId=%s,attempts=%d", delivery.JobID, delivery.OrganizationID, delivery.Attempts+1), zap.Error(err))
+		return attempt
+	}
+	attempt.Status = v1.DeliveryPending
+	attempt.NextAttemptAt = now.Add(d.backoff(delivery.Attempts + 1))
+	log.Warn(fmt.Sprintf("Failed to deliver webhook %s for job %s, retrying at %s", delivery.ID, delivery.JobID, attempt.NextAttemptAt.Format(time.RFC3339)), zap.Error(err))
+	return attempt
+}
+
+func (d *WebhookDispatcher) post(ctx context.Context, delivery v1.WebhookDelivery) (*int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if req.URL.Scheme != "https" && !d.config.AllowPrivateNetworks {
+		return nil, errors.Errorf("webhook url must be https")
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, SignWebhook(delivery.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &resp.StatusCode, errors.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return &resp.StatusCode, nil
+}
+
+// backoff returns the wait after the given number of failed attempts, doubling from InitialBackoff up to MaxBackoff
+func (d *WebhookDispatcher) backoff(attempts int) time.Duration {
+	wait := d.config.InitialBackoff
+	for i := 1; i < attempts && wait < d.config.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > d.config.MaxBackoff {
+		wait = d.config.MaxBackoff
+	}
+	return wait
+}
@@ -0,0 +1,259 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "github.com/CMSgov/dpc/attribution/model/v1"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockWebhookQueue struct {
+	mock.Mock
+}
+
+func (m *MockWebhookQueue) FindFinishedJobs(ctx context.Context, since time.Time, limit int) ([]v1.FinishedJob, error) {
+	args := m.Called(ctx, since, limit)
+	return args.Get(0).([]v1.FinishedJob), args.Error(1)
+}
+
+func (m *MockWebhookQueue) InsertDelivery(ctx context.Context, delivery v1.WebhookDelivery) error {
+	args := m.Called(ctx, delivery)
+	return args.Error(0)
+}
+
+func (m *MockWebhookQueue) ClaimDeliveries(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]v1.WebhookDelivery, error) {
+	args := m.Called(ctx, now, leaseUntil, limit)
+	return args.Get(0).([]v1.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockWebhookQueue) RecordAttempt(ctx context.Context, id string, attempt v1.DeliveryAttempt) error {
+	args := m.Called(ctx, id, attempt)
+	return args.Error(0)
+}
+
+// receivedWebhook is a notification received by the local test receiver
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+type WebhookDispatcherTestSuite struct {
+	suite.Suite
+	queue      *MockWebhookQueue
+	dispatcher *WebhookDispatcher
+	server     *httptest.Server
+	mu         sync.Mutex
+	received   []receivedWebhook
+	status     int
+	location   string
+}
+
+func TestWebhookDispatcherTestSuite(t *testing.T) {
+	suite.Run(t, new(WebhookDispatcherTestSuite))
+}
+
+func (suite *WebhookDispatcherTestSuite) SetupTest() {
+	suite.received = nil
+	suite.status = http.StatusOK
+	suite.location = ""
+	suite.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		suite.mu.Lock()
+		defer suite.mu.Unlock()
+		suite.received = append(suite.received, receivedWebhook{r.Header, body})
+		if suite.location != "" {
+			w.Header().Set("Location", suite.location)
+		}
+		w.WriteHeader(suite.status)
+	}))
+	suite.queue = new(MockWebhookQueue)
+	suite.dispatcher = NewWebhookDispatcher(suite.queue, WebhookConfig{
+		ManifestBaseURL:   "https://dpc.example.com/api/v2",
+		PollInterval:      time.Second,
+		Lookback:          24 * time.Hour,
+		DeliveriesPerPoll: 10,
+		MaxAttempts:       3,
+		InitialBackoff:    time.Minute,
+		MaxBackoff:        3 * time.Minute,
+		Timeout:           time.Second,
+		// the test receiver listens on plain http on the loopback address
+		AllowPrivateNetworks: true,
+	})
+}
+
+func (suite *WebhookDispatcherTestSuite) TearDownTest() {
+	suite.server.Close()
+}
+
+func (suite *WebhookDispatcherTestSuite) delivery(attempts int) v1.WebhookDelivery {
+	return v1.WebhookDelivery{
+		ID:             "delivery-1",
+		JobID:          "job-1",
+		OrganizationID: "org-1",
+		URL:            suite.server.URL + "/hook",
+		Payload:        `{"jobId":"job-1","status":"COMPLETED"}`,
+		Status:         v1.DeliveryPending,
+		Attempts:       attempts,
+		Secret:         "secret",
+	}
+}
+
+func (suite *WebhookDispatcherTestSuite) TestDispatchQueuesFinishedJobs() {
+	completeTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	suite.queue.On("FindFinishedJobs", mock.Anything, mock.Anything, 10).Return([]v1.FinishedJob{
+		{JobID: "job-1", OrganizationID: "org-1", URL: "https://example.com/hook", Status: "FAILED", CompleteTime: completeTime},
+	}, nil)
+	suite.queue.On("InsertDelivery", mock.Anything, mock.Anything).Return(nil)
+	suite.queue.On("ClaimDeliveries", mock.Anything, mock.Anything, mock.Anything, 10).Return([]v1.WebhookDelivery{}, nil)
+
+	attempted, err := suite.dispatcher.Dispatch(context.Background())
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, attempted)
+	suite.queue.AssertCalled(suite.T(), "InsertDelivery", mock.Anything, mock.MatchedBy(func(d v1.WebhookDelivery) bool {
+		var payload v1.WebhookPayload
+		_ = json.Unmarshal([]byte(d.Payload), &payload)
+		return d.JobID == "job-1" && d.OrganizationID == "org-1" && d.URL == "https://example.com/hook" &&
+			payload == v1.WebhookPayload{JobID: "job-1", Status: "FAILED", ManifestURL: "https://dpc.example.com/api/v2/Jobs/job-1", CompleteTime: completeTime}
+	}))
+}
+
+func (suite *WebhookDispatcherTestSuite) TestDispatchDelivers() {
+	suite.queue.On("FindFinishedJobs", mock.Anything, mock.Anything, 10).Return([]v1.FinishedJob{}, nil)
+	suite.queue.On("ClaimDeliveries", mock.Anything, mock.Anything, mock.Anything, 10).Return([]v1.WebhookDelivery{suite.delivery(0)}, nil)
+	suite.queue.On("RecordAttempt", mock.Anything, "delivery-1", mock.Anything).Return(nil)
+
+	attempted, err := suite.dispatcher.Dispatch(context.Background())
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, attempted)
+	assert.Len(suite.T(), suite.received, 1)
+	received := suite.received[0]
+	assert.Equal(suite.T(), `{"jobId":"job-1","status":"COMPLETED"}`, string(received.body))
+	assert.Equal(suite.T(), "application/json", received.header.Get("Content-Type"))
+	assert.Equal(suite.T(), "delivery-1", received.header.Get(DeliveryHeader))
+	assert.Equal(suite.T(), SignWebhook("secret", received.header.Get(TimestampHeader), received.body), received.header.Get(SignatureHeader))
+	suite.queue.AssertCalled(suite.T(), "RecordAttempt", mock.Anything, "delivery-1", mock.MatchedBy(func(a v1.DeliveryAttempt) bool {
+		return a.Status == v1.DeliveryDelivered && *a.StatusCode == http.StatusOK && a.Error == nil
+	}))
+}
+
+func (suite *WebhookDispatcherTestSuite) TestDispatchRetriesWithBackoff() {
+	suite.status = http.StatusServiceUnavailable
+	suite.queue.On("FindFinishedJobs", mock.Anything, mock.Anything, 10).Return([]v1.FinishedJob{}, nil)
+	suite.queue.On("ClaimDeliveries", mock.Anything, mock.Anything, mock.Anything, 10).Return([]v1.WebhookDelivery{suite.delivery(1)}, nil)
+	suite.queue.On("RecordAttempt", mock.Anything, "delivery-1", mock.Anything).Return(nil)
+
+	start := time.Now()
+	_, err := suite.dispatcher.Dispatch(context.Background())
+
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), suite.received, 1)
+	// the second failed attempt waits twice the initial backoff
+	suite.queue.AssertCalled(suite.T(), "RecordAttempt", mock.Anything, "delivery-1", mock.MatchedBy(func(a v1.DeliveryAttempt) bool {
+		return a.Status == v1.DeliveryPending && *a.StatusCode == http.StatusServiceUnavailable && *a.Error != "" &&
+			!a.NextAttemptAt.Before(start.Add(2*time.Minute)) && a.NextAttemptAt.Before(time.Now().Add(2*time.Minute+time.Second))
+	}))
+}
+
+func (suite *WebhookDispatcherTestSuite) TestDispatchFailsAfterMaxAttempts() {
+	suite.status = http.StatusInternalServerError
+	suite.queue.On("FindFinishedJobs", mock.Anything, mock.Anything, 10).Return([]v1.FinishedJob{}, nil)
+	suite.queue.On("ClaimDeliveries", mock.Anything, mock.Anything, mock.Anything, 10).Return([]v1.WebhookDelivery{suite.delivery(2)}, nil)
+	suite.queue.On("RecordAttempt", mock.Anything, "delivery-1", mock.Anything).Return(nil)
+
+	_, err := suite.dispatcher.Dispatch(context.Background())
+
+	assert.NoError(suite.T(), err)
+	suite.queue.AssertCalled(suite.T(), "RecordAttempt", mock.Anything, "delivery-1", mock.MatchedBy(func(a v1.DeliveryAttempt) bool {
+		return a.Status == v1.DeliveryFailed && *a.StatusCode == http.StatusInternalServerError
+	}))
+}
+
+func (suite *WebhookDispatcherTestSuite) TestDispatchFailsWithoutSecret() {
+	delivery := suite.delivery(0)
+	delivery.Secret = ""
+	suite.queue.On("FindFinishedJobs", mock.Anything, mock.Anything, 10).Return([]v1.FinishedJob{}, nil)
+	suite.queue.On("ClaimDeliveries", mock.Anything, mock.Anything, mock.Anything, 10).Return([]v1.WebhookDelivery{delivery}, nil)
+	suite.queue.On("RecordAttempt", mock.Anything, "delivery-1", mock.Anything).Return(nil)
+
+	_, err := suite.dispatcher.Dispatch(context.Background())
+
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), suite.received)
+	suite.queue.AssertCalled(suite.T(), "RecordAttempt", mock.Anything, "delivery-1", mock.MatchedBy(func(a v1.DeliveryAttempt) bool {
+		return a.Status == v1.DeliveryFailed && a.StatusCode == nil && a.Error != nil
+	}))
+}
+
+func (suite *WebhookDispatcherTestSuite) TestDispatchDoesNotFollowRedirects() {
+	suite.status = http.StatusTemporaryRedirect
+	suite.location = suite.server.URL + "/internal"
+	suite.queue.On("FindFinishedJobs", mock.Anything, mock.Anything, 10).Return([]v1.FinishedJob{}, nil)
+	suite.queue.On("ClaimDeliveries", mock.Anything, mock.Anything, mock.Anything, 10).Return([]v1.WebhookDelivery{suite.delivery(0)}, nil)
+	suite.queue.On("RecordAttempt", mock.Anything, "delivery-1", mock.Anything).Return(nil)
+
+	_, err := suite.dispatcher.Dispatch(context.Background())
+
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), suite.received, 1)
+	suite.queue.AssertCalled(suite.T(), "RecordAttempt", mock.Anything, "delivery-1", mock.MatchedBy(func(a v1.DeliveryAttempt) bool {
+		return a.Status == v1.DeliveryPending && *a.StatusCode == http.StatusTemporaryRedirect
+	}))
+}
+
+func (suite *WebhookDispatcherTestSuite) TestDispatchRefusesPrivateAddresses() {
+	config := suite.dispatcher.config
+	config.AllowPrivateNetworks = false
+	dispatcher := NewWebhookDispatcher(suite.queue, config)
+	port := suite.server.URL[strings.LastIndex(suite.server.URL, ":")+1:]
+	plain, private := suite.delivery(0), suite.delivery(0)
+	private.ID = "delivery-2"
+	private.URL = "https://127.0.0.1:" + port + "/hook"
+	suite.queue.On("FindFinishedJobs", mock.Anything, mock.Anything, 10).Return([]v1.FinishedJob{}, nil)
+	suite.queue.On("ClaimDeliveries", mock.Anything, mock.Anything, mock.Anything, 10).Return([]v1.WebhookDelivery{plain, private}, nil)
+	suite.queue.On("RecordAttempt", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	_, err := dispatcher.Dispatch(context.Background())
+
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), suite.received)
+	suite.queue.AssertCalled(suite.T(), "RecordAttempt", mock.Anything, "delivery-1", mock.MatchedBy(func(a v1.DeliveryAttempt) bool {
+		return a.Status == v1.DeliveryPending && a.StatusCode == nil && strings.Contains(*a.Error, "must be https")
+	}))
+	suite.queue.AssertCalled(suite.T(), "RecordAttempt", mock.Anything, "delivery-2", mock.MatchedBy(func(a v1.DeliveryAttempt) bool {
+		return a.Status == v1.DeliveryPending && a.StatusCode == nil && strings.Contains(*a.Error, "non-public address 127.0.0.1")
+	}))
+}
+
+func (suite *WebhookDispatcherTestSuite) TestDispatchFindError() {
+	suite.queue.On("FindFinishedJobs", mock.Anything, mock.Anything, 10).Return([]v1.FinishedJob{}, errors.New("error"))
+
+	_, err := suite.dispatcher.Dispatch(context.Background())
+
+	assert.Error(suite.T(), err)
+	suite.queue.AssertNotCalled(suite.T(), "ClaimDeliveries", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *WebhookDispatcherTestSuite) TestBackoff() {
+	assert.Equal(suite.T(), time.Minute, suite.dispatcher.backoff(1))
+	assert.Equal(suite.T(), 2*time.Minute, suite.dispatcher.backoff(2))
+	assert.Equal(suite.T(), 3*time.Minute, suite.dispatcher.backoff(3))
+	assert.Equal(suite.T(), 3*time.Minute, suite.dispatcher.backoff(30))
+}
+
+func TestSignWebhook(t *testing.T) {
+	// echo -n '1609459200.{}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "sha256=c3951831ae6935b48c94e1165919cff34d5a733d531a5abed39cacbdd9d8f594", SignWebhook("secret", "1609459200", []byte("{}")))
+}
@@ -223,6 +223,8 @@ public class JobQueueBatch implements Serializable {
             case COMPLETED:
             case FAILED:
                 return submitTime != null && startTime != null && updateTime != null && completeTime != null && aggregatorID == null;
+            case CANCELLED:
+                return submitTime != null && completeTime != null;
             default:
                 return false;
         }